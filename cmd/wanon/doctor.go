@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/doctor"
+	"gorm.io/gorm"
+)
+
+// runDoctor checks the environment the server would start in and prints a
+// JSON report, failing when a check does. Unlike /doctor it needs no
+// running bot, so deploy pipelines can run it before switching versions.
+// cfgErr is why the config did not load, reported as a failed check.
+func runDoctor(cfg *config.Config, cfgErr error, args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	timeout := flags.Duration("timeout", 30*time.Second, "how long the checks may take")
+	migrate := flags.Bool("migrate", false, "pass with pending migrations, as the default command applies them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	report := doctor.Report{Checks: []doctor.Check{doctor.CheckConfig(cfg, cfgErr)}}
+	if report.Checks[0].OK {
+		var gdb *gorm.DB
+		db, dbErr := connectDatabase(ctx, &cfg.Database)
+		if dbErr == nil {
+			defer db.Close()
+			gdb = db.DB
+		}
+		b, err := bot.New(cfg.Telegram.Token, append(telegramOptions(cfg.Telegram), bot.WithSkipGetMe())...)
+		if err != nil {
+			return fmt.Errorf("failed to create Telegram bot: %w", err)
+		}
+		preflight := doctor.New(gdb, b, nil, doctor.Options{
+			MigrationsDir:  cfg.Database.Migrations,
+			MigrateOnStart: *migrate,
+			WebhookURL:     cfg.Telegram.Webhook,
+		}).Preflight(ctx, dbErr)
+		report.Checks = append(report.Checks, preflight.Checks...)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	if failed := report.Failed(); failed > 0 {
+		return fmt.Errorf("doctor: %d of %d checks failed", failed, len(report.Checks))
+	}
+	return nil
+}
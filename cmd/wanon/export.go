@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/archive"
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/storage"
+)
+
+// runExport writes the quotes of a chat into a versioned JSON archive that
+// wanon import --format wanon restores
+func runExport(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	chatID := flags.Int64("chat", 0, "chat ID to export (required)")
+	out := flags.String("out", "", "output file (default quotes-<chat>.v1.json)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *chatID == 0 {
+		return fmt.Errorf("export: --chat is required")
+	}
+	if *out == "" {
+		*out = archive.FileName(*chatID)
+	}
+
+	db, err := storage.New(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", *out, err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	manifest, err := archive.Export(context.Background(), w, quotes.NewStore(db.DB), *chatID, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *out, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *out, err)
+	}
+
+	slog.Info("exported quotes", "chat_id", *chatID, "file", *out, "quotes", manifest.Quotes, "entries", manifest.Entries, "checksum", manifest.Checksum)
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/graffic/wanon-go/internal/book"
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/settings"
+	"github.com/graffic/wanon-go/internal/storage"
+)
+
+// runExportPDF typesets the quotes of a chat into a PDF book on disk
+func runExportPDF(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("export-pdf", flag.ContinueOnError)
+	chatID := flags.Int64("chat", 0, "chat ID to export (required)")
+	out := flags.String("out", "", "output file (default quotes-<chat>.pdf)")
+	title := flags.String("title", "Quotes", "book title")
+	fontDir := flags.String("font-dir", cfg.Export.FontDir, "directory with DejaVu fonts for Unicode text")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *chatID == 0 {
+		return fmt.Errorf("export-pdf: --chat is required")
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("quotes-%d.pdf", *chatID)
+	}
+
+	ctx := context.Background()
+
+	db, err := storage.New(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	cs, err := settings.NewService(db.DB).Get(ctx, *chatID)
+	if err != nil {
+		return err
+	}
+
+	opts := book.OptionsFor(cs, *title, *fontDir, "")
+	if opts.Authors, err = quotes.LoadAuthors(ctx, db.DB, *chatID); err != nil {
+		return err
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", *out, err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	b, err := book.Export(ctx, w, quotes.NewStore(db.DB), *chatID, opts)
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *out, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *out, err)
+	}
+
+	slog.Info("exported quote book", "chat_id", *chatID, "file", *out, "quotes", b.Quotes(), "pages", b.Pages())
+	return nil
+}
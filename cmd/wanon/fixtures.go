@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/fixtures"
+	"github.com/graffic/wanon-go/internal/storage"
+)
+
+// runFixtures runs the fixtures subcommands; only capture so far
+func runFixtures(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "capture" {
+		return fmt.Errorf("usage: wanon fixtures capture --chat <chat id> [flags]")
+	}
+	return runFixturesCapture(cfg, args[1:])
+}
+
+// runFixturesCapture writes the last cached messages of a chat, anonymized,
+// as a fixture file for tests
+func runFixturesCapture(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("fixtures capture", flag.ContinueOnError)
+	chatID := flags.Int64("chat", 0, "chat whose cached messages are captured (required)")
+	last := flags.Int("last", 20, "how many of the newest cached messages to capture")
+	out := flags.String("out", "", "output file, e.g. testdata/fixture.5.bug.json (default stdout)")
+	keepText := flags.Bool("keep-text", false, "keep the words of the messages instead of scrubbing them; read them before committing the fixture")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *chatID == 0 {
+		return fmt.Errorf("fixtures capture: --chat is required")
+	}
+	if *last <= 0 {
+		return fmt.Errorf("fixtures capture: --last must be positive")
+	}
+
+	db, err := storage.New(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	updates, err := fixtures.Capture(context.Background(), db.DB, *chatID, *last, fixtures.Options{KeepText: *keepText})
+	if err != nil {
+		return err
+	}
+	if len(updates) == 0 {
+		return fmt.Errorf("fixtures capture: no cached messages in chat %d", *chatID)
+	}
+	data, err := fixtures.Marshal(updates)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *out, err)
+	}
+	slog.Info("captured fixture", "chat_id", *chatID, "file", *out, "messages", len(updates))
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/graffic/wanon-go/internal/archive"
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/importer"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/storage"
+)
+
+// runImport imports quotes exported by other quote bots into a chat
+func runImport(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "export format: "+strings.Join(append(importer.Formats(), archiveFormat), ", ")+" (required)")
+	chatID := flags.Int64("chat", 0, "chat ID to import into (required; wanon: defaults to the exported chat)")
+	dryRun := flags.Bool("dry-run", false, "validate the file and report what would be imported")
+	skipInvalid := flags.Bool("skip-invalid", false, "import the valid quotes even if some records are invalid")
+	delimiter := flags.String("delimiter", ",", "csv: field separator")
+	noHeader := flags.Bool("no-header", false, "csv: the first row is data, not column names")
+	authorCol := flags.String("author-col", "", "csv: author column name or 1-based position (default \"author\")")
+	textCol := flags.String("text-col", "", "csv: text column name or 1-based position (default \"text\")")
+	dateCol := flags.String("date-col", "", "csv: date column name or 1-based position (default \"date\")")
+	dateLayout := flags.String("date-layout", "", "Go layout of the dates (default: common layouts and Unix timestamps)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format == archiveFormat && flags.NArg() == 1 {
+		return runRestore(cfg, flags.Arg(0), *chatID, *dryRun)
+	}
+	if *format == "" || *chatID == 0 || flags.NArg() != 1 {
+		return fmt.Errorf("usage: wanon import --format <format> --chat <id> [flags] <file>")
+	}
+
+	parser, err := importer.ParserFor(*format)
+	if err != nil {
+		return err
+	}
+	switch p := parser.(type) {
+	case *importer.CSVParser:
+		sep, size := utf8.DecodeRuneInString(*delimiter)
+		if size == 0 || size != len(*delimiter) {
+			return fmt.Errorf("import: --delimiter must be a single character")
+		}
+		p.Delimiter = sep
+		p.NoHeader = *noHeader
+		p.AuthorColumn = *authorCol
+		p.TextColumn = *textCol
+		p.DateColumn = *dateCol
+		p.DateLayout = *dateLayout
+	case *importer.IRCParser:
+		p.DateLayout = *dateLayout
+	}
+
+	file := flags.Arg(0)
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer f.Close()
+
+	result, err := parser.Parse(f)
+	if err != nil {
+		return err
+	}
+
+	for _, lineErr := range result.Errors {
+		fmt.Fprintf(os.Stderr, "%s:%v\n", file, lineErr)
+	}
+	fmt.Printf("%s: %d valid quote(s), %d invalid record(s)\n", file, len(result.Quotes), len(result.Errors))
+
+	if *dryRun {
+		return nil
+	}
+	if len(result.Errors) > 0 && !*skipInvalid {
+		return fmt.Errorf("import aborted: fix the invalid records or pass --skip-invalid")
+	}
+
+	db, err := storage.New(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	bus, closeEvents, err := newEventBus(cfg.Events)
+	if err != nil {
+		return err
+	}
+	defer closeEvents()
+
+	imported, err := importer.Import(context.Background(), quotes.NewStore(db.DB).WithEvents(bus), *chatID, result.Quotes)
+	if err != nil {
+		return fmt.Errorf("import failed, nothing was imported: %w", err)
+	}
+
+	slog.Info("imported quotes", "chat_id", *chatID, "file", file, "format", *format, "quotes", imported)
+	return nil
+}
+
+// archiveFormat imports the archives written by wanon export
+const archiveFormat = "wanon"
+
+// runRestore verifies an archive written by wanon export and restores its
+// quotes into a chat, the exported one unless chatID is set
+func runRestore(cfg *config.Config, file string, chatID int64, dryRun bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer f.Close()
+
+	arch, err := archive.Read(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if chatID == 0 {
+		chatID = arch.ChatID
+	}
+	fmt.Printf("%s: version %d archive of chat %d exported %s, %d quote(s) verified\n",
+		file, arch.Version, arch.ChatID, arch.ExportedAt.Format(time.RFC3339), len(arch.Quotes))
+
+	if dryRun {
+		return nil
+	}
+
+	policy, err := creatorPolicy(cfg)
+	if err != nil {
+		return err
+	}
+
+	db, err := storage.New(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	bus, closeEvents, err := newEventBus(cfg.Events)
+	if err != nil {
+		return err
+	}
+	defer closeEvents()
+
+	restored, err := archive.Restore(context.Background(), quotes.NewStore(db.DB).WithCreatorPolicy(policy).WithEvents(bus), chatID, arch.Quotes)
+	if err != nil {
+		return fmt.Errorf("import failed, nothing was imported: %w", err)
+	}
+
+	slog.Info("imported quotes", "chat_id", chatID, "file", file, "format", archiveFormat, "quotes", restored)
+	return nil
+}
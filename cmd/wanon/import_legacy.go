@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/importer"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/storage"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// runImportLegacy copies the quotes of the Elixir bot's database into the
+// configured one
+func runImportLegacy(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("import-legacy", flag.ContinueOnError)
+	dsn := flags.String("dsn", "", "DSN of the Elixir bot's database, e.g. \"host=old port=5432 user=wanon dbname=wanon_prod\" (required)")
+	chatID := flags.Int64("chat", 0, "import only the quotes of this chat (default: every chat)")
+	quotesTable := flags.String("quotes-table", importer.DefaultLegacyTables.Quotes, "table of the legacy quotes")
+	entriesTable := flags.String("entries-table", importer.DefaultLegacyTables.Entries, "table of the legacy quote entries")
+	dryRun := flags.Bool("dry-run", false, "read and map the quotes and report what would be imported")
+	skipInvalid := flags.Bool("skip-invalid", false, "import the valid quotes even if some cannot be mapped")
+	force := flags.Bool("force", false, "import into chats that already have quotes, which duplicates them on a second run")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *dsn == "" || flags.NArg() != 0 {
+		return fmt.Errorf("usage: wanon import-legacy --dsn <dsn> [flags]")
+	}
+
+	ctx := context.Background()
+	legacyDB, err := gorm.Open(postgres.Open(*dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return fmt.Errorf("failed to connect to the legacy database: %w", err)
+	}
+	if sqlDB, err := legacyDB.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	tables := importer.LegacyTables{Quotes: *quotesTable, Entries: *entriesTable}
+	legacy, invalid, err := importer.ReadLegacy(ctx, legacyDB, tables, *chatID)
+	if err != nil {
+		return err
+	}
+	for _, quoteErr := range invalid {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", tables.Quotes, quoteErr)
+	}
+	chats := importer.LegacyChats(legacy)
+	fmt.Printf("%s: %d valid quote(s) in %d chat(s), %d invalid quote(s)\n", tables.Quotes, len(legacy), len(chats), len(invalid))
+
+	if *dryRun {
+		return nil
+	}
+	if len(invalid) > 0 && !*skipInvalid {
+		return fmt.Errorf("import aborted: fix the invalid quotes or pass --skip-invalid")
+	}
+
+	policy, err := creatorPolicy(cfg)
+	if err != nil {
+		return err
+	}
+
+	db, err := storage.New(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	store := quotes.NewStore(db.DB).WithCreatorPolicy(policy)
+	if !*force {
+		for _, chat := range chats {
+			count, err := store.CountForChat(ctx, chat)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("import aborted: chat %d already has %d quote(s), pass --force to import into it anyway", chat, count)
+			}
+		}
+	}
+
+	bus, closeEvents, err := newEventBus(cfg.Events)
+	if err != nil {
+		return err
+	}
+	defer closeEvents()
+
+	imported, err := importer.ImportLegacy(ctx, store.WithEvents(bus), legacy)
+	if err != nil {
+		return fmt.Errorf("import failed, nothing was imported: %w", err)
+	}
+
+	slog.Info("imported legacy quotes", "chats", len(chats), "quotes", imported)
+	return nil
+}
@@ -2,21 +2,55 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"regexp"
+	"strings"
 	"syscall"
+	"time"
+	_ "time/tzdata" // Embedded time zones for per-chat date rendering
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/allowlist"
+	"github.com/graffic/wanon-go/internal/analytics"
+	"github.com/graffic/wanon-go/internal/api"
+	"github.com/graffic/wanon-go/internal/archive"
+	"github.com/graffic/wanon-go/internal/book"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
 	"github.com/graffic/wanon-go/internal/bot/middleware"
 	"github.com/graffic/wanon-go/internal/cache"
+	"github.com/graffic/wanon-go/internal/changelog"
 	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/doctor"
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/history"
+	"github.com/graffic/wanon-go/internal/kv"
+	"github.com/graffic/wanon-go/internal/metrics"
+	"github.com/graffic/wanon-go/internal/notifications"
+	"github.com/graffic/wanon-go/internal/onboarding"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/plugin"
 	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/redact"
+	"github.com/graffic/wanon-go/internal/settings"
+	"github.com/graffic/wanon-go/internal/startup"
 	"github.com/graffic/wanon-go/internal/storage"
+	"github.com/graffic/wanon-go/internal/systemd"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"github.com/graffic/wanon-go/internal/telemetry"
+	"github.com/graffic/wanon-go/internal/tenancy"
+	"github.com/graffic/wanon-go/internal/usage"
 	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
 )
 
 func main() {
@@ -34,8 +68,11 @@ func run() error {
 	handler := slog.NewTextHandler(os.Stderr, opts)
 	slog.SetDefault(slog.New(handler))
 
-	// Parse command/subcommand
-	cmd := parseCommand()
+	// Parse global flags and the command/subcommand
+	global, cmd, args, err := parseCommand(os.Args[1:])
+	if err != nil {
+		return err
+	}
 
 	// Load configuration
 	env := os.Getenv("ENV")
@@ -43,32 +80,81 @@ func run() error {
 		env = "development"
 	}
 
-	cfg, err := config.Load(env)
+	cfg, err := config.LoadFrom(global.configDir, env)
+	if cmd == "doctor" {
+		return runDoctor(cfg, err, args) // A broken config is one of its checks
+	}
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return startup.Fail(startup.StageConfig, err)
 	}
 
 	// Execute command
 	switch cmd {
 	case "server":
-		return runServer(cfg)
+		return runServer(cfg, serverOptions{skipTelegramCheck: global.skipTelegramCheck})
+	case "export":
+		return runExport(cfg, args)
+	case "export-pdf":
+		return runExportPDF(cfg, args)
+	case "publish":
+		return runPublish(cfg, args)
+	case "import":
+		return runImport(cfg, args)
+	case "import-legacy":
+		return runImportLegacy(cfg, args)
+	case "merge-authors":
+		return runMergeAuthors(cfg, args)
+	case "sync-commands":
+		return runSyncCommands(cfg, args)
+	case "redact-creators":
+		return runRedactCreators(cfg, args)
+	case "verify":
+		return runVerify(cfg, args)
+	case "switch-mode":
+		return runSwitchMode(cfg, args)
+	case "usage-report":
+		return runUsageReport(cfg, args)
+	case "replay":
+		return runReplay(cfg, args)
+	case "fixtures":
+		return runFixtures(cfg, args)
 	default:
 		// Default: run migrations and server
-		if err := storage.RunMigrations(&cfg.Database); err != nil {
-			return err
-		}
-		return runServer(cfg)
+		return runServer(cfg, serverOptions{migrate: true, skipTelegramCheck: global.skipTelegramCheck})
 	}
 }
 
-func parseCommand() string {
-	if len(os.Args) < 2 {
-		return "default"
+// globalFlags are the flags going before the command
+type globalFlags struct {
+	configDir         string
+	skipTelegramCheck bool
+}
+
+// parseCommand parses the global flags, which go before the command, and
+// returns the command with its arguments
+func parseCommand(args []string) (global globalFlags, cmd string, rest []string, err error) {
+	fs := flag.NewFlagSet("wanon", flag.ContinueOnError)
+	fs.StringVar(&global.configDir, "config-dir", config.DefaultDir, "directory with base.yaml and the <ENV>.yaml overlays")
+	fs.BoolVar(&global.skipTelegramCheck, "skip-telegram-check", false, "start the server without checking the bot token with getMe, e.g. offline against a fake Bot API server")
+	if err := fs.Parse(args); err != nil {
+		return globalFlags{}, "", nil, err
+	}
+	if fs.NArg() == 0 {
+		return global, "default", nil, nil
 	}
-	return os.Args[1]
+	return global, fs.Arg(0), fs.Args()[1:], nil
 }
 
-func runServer(cfg *config.Config) error {
+// serverOptions tunes the server startup
+type serverOptions struct {
+	migrate           bool // Migrate the database before starting
+	skipTelegramCheck bool // Start without checking the token with getMe
+}
+
+// runServer starts the server in stages, after the config: the database,
+// its migrations, the Telegram check and the components. Errors name the
+// stage that failed.
+func runServer(cfg *config.Config, options serverOptions) (err error) {
 	slog.Info("starting wanon server", "environment", cfg.Environment)
 
 	// Create context with signal handling
@@ -79,67 +165,496 @@ func runServer(cfg *config.Config) error {
 	)
 	defer cancel()
 
-	// Initialize database
-	db, err := storage.New(&cfg.Database)
+	var db *storage.DB
+	var user *models.User
+	err = startup.Run(ctx, slog.Default(),
+		startup.Stage{Name: startup.StageDatabase, Timeout: cfg.Startup.DatabaseTimeout, Run: func(ctx context.Context) error {
+			var err error
+			db, err = connectDatabase(ctx, &cfg.Database)
+			return err
+		}},
+		startup.Stage{Name: startup.StageMigrations, Timeout: cfg.Startup.MigrationsTimeout, Skip: !options.migrate, Run: func(ctx context.Context) error {
+			return runMigrations(ctx, cfg)
+		}},
+		startup.Stage{Name: startup.StageTelegram, Timeout: cfg.Startup.TelegramTimeout, Skip: options.skipTelegramCheck, Run: func(ctx context.Context) error {
+			var err error
+			user, err = verifyTelegram(ctx, cfg.Telegram)
+			return err
+		}},
+	)
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return err // The process exits, closing the database if it connected
 	}
 	defer db.Close()
+	if user == nil {
+		// Without the check the username is unknown, so there are no deep
+		// links to the bot
+		user = &models.User{FirstName: "wanon"}
+	}
+
+	// Errors from here until every component runs fail the components stage
+	started := false
+	defer func() {
+		if !started {
+			err = startup.Fail(startup.StageComponents, err)
+		}
+	}()
+
+	if cfg.API.Enabled && cfg.API.Token == "" {
+		return fmt.Errorf("api.token is required when the admin API is enabled")
+	}
+
+	// Initialize cache service, masking sensitive data before it is cached
+	redactor, err := newRedactor(db.DB, cfg)
+	if err != nil {
+		return err
+	}
+	cacheService := cache.NewService(db.DB).WithRedactor(redactor)
+
+	// Owners allow more chats at runtime with /allowchat
+	allowed := allowlist.New(db.DB, cfg.AllowedChatIDs)
+	if err := allowed.Load(ctx); err != nil {
+		return err
+	}
+	slog.Info("Chat filter", "allowAll", allowed.AllowsAll(), "autoLeave", cfg.AutoLeaveUnauthorized, "chatIds", allowed.IDs())
+
+	// Hosted communities are held to the limits of their plans
+	tenants, err := newTenants(cfg.Tenancy)
+	if err != nil {
+		return err
+	}
+	enforcer := tenancy.NewEnforcer(tenants, tenancy.NewMeter(db.DB), slog.Default()).WithRefresh(cfg.Tenancy.Refresh)
+	slog.Info("Tenancy", "enabled", tenants.Enabled(), "tenants", len(tenants.Tenants()))
+
+	// Domain events go to the event log and the audit log
+	bus, closeEvents, err := newEventBus(cfg.Events)
+	if err != nil {
+		return err
+	}
+	defer closeEvents()
+	var quoteWebhook *quotes.QuoteWebhook
+	if cfg.Events.Webhook.URL != "" {
+		quoteWebhook, err = quotes.NewQuoteWebhook(cfg.Events.Webhook.URL, cfg.Events.Webhook.Secret, slog.Default())
+		if err != nil {
+			return fmt.Errorf("invalid events config: %w", err)
+		}
+		bus.Subscribe("webhook", quoteWebhook)
+	}
 
-	// Initialize cache service
-	cacheService := cache.NewService(db.DB)
+	// Replicas share their hot state through Redis when it is configured
+	shared, closeShared, err := newSharedStore(ctx, cfg.Redis)
+	if err != nil {
+		return err
+	}
+	defer closeShared()
 
 	// Create middlewares
-	chatFilterMiddleware := middleware.ChatFilter(cfg.AllowedChatIDs, cfg.AutoLeaveUnauthorized, slog.Default())
-	cacheMiddleware := createCacheMiddleware(cacheService)
+	// Users export and list their own quotes in private, wherever the chats
+	// are allowed. Answers to the game polls have no chat.
+	chatFilterMiddleware := middleware.ExceptPollAnswers(middleware.ExceptPrivateCallbacks(middleware.ExceptPrivateCommands(
+		middleware.ChatFilterFunc(allowed.Allowed, cfg.AutoLeaveUnauthorized, slog.Default()), "myexport", "saved"), "bookmark:"))
+	cacheMiddleware := cache.NewMiddleware(cacheService, slog.Default()).
+		WithQuota(enforcer.Quota(tenancy.ResourceCachedMessages)).
+		BotMiddleware()
+	coalesceMiddleware := middleware.NewCoalescer(cfg.Quotes.CoalesceWindow, []string{"rquote"}, slog.Default()).
+		WithStore(shared).
+		Middleware()
+
+	// Record the commands run in each chat for the usage reports
+	handlers, err := newCommandHandlers(db.DB, db.Reads(), cfg)
+	if err != nil {
+		return err
+	}
+	usageMiddleware := usage.Middleware(usage.NewLog(db.DB), handlers.names(), slog.Default())
+	handlers.addQuote.WithQuota(enforcer.Quota(tenancy.ResourceQuotes))
+	handlers.withEvents(bus)
+	handlers.withStore(shared)
+
+	// Admin checks share a cache of chat administrators, dropped for a chat
+	// when someone there is promoted or demoted
+	admins := telegram.NewAdminService(cfg.Telegram.AdminCacheTTL).WithStore(shared)
+	handlers.withAdmins(admins)
+
+	// Commands past the monthly API calls of their tenant's plan are dropped
+	// before they are recorded
+	tenancyMiddleware := tenancy.Middleware(enforcer, handlers.names(), slog.Default())
+
+	// Admins turn commands off per chat with /disable
+	toggleMiddleware := settings.Middleware(settings.NewService(db.DB), handlers.toggleable(), slog.Default())
+
+	// Malformed updates are dropped before anything else sees them
+	validator := middleware.NewValidator(slog.Default())
+
+	// Bound the updates handled at once so bursts wait instead of piling up
+	backpressure := middleware.NewBackpressure(cfg.Telegram.MaxInFlight, cfg.Telegram.QueueTimeout, slog.Default())
+
+	// Chats the bot joins get their cache filled from a provided export
+	warmer := cache.NewWarmer(cacheService, cfg.Cache.WarmupDir, cfg.Cache.KeepDuration, slog.Default())
+
+	// Updates without a command or callback handler go by kind
+	router := newRouter(warmer, handlers.saved, handlers.quoteGame)
+	slog.Info("Update router", "kinds", router.Kinds())
 
 	// Create bot options
 	opts := []bot.Option{
-		bot.WithMiddlewares(chatFilterMiddleware, cacheMiddleware),
-		bot.WithDefaultHandler(defaultHandler),
+		bot.WithMiddlewares(validator.Middleware(), backpressure.Middleware(), admins.Middleware(), chatFilterMiddleware, cacheMiddleware, toggleMiddleware, coalesceMiddleware, tenancyMiddleware, usageMiddleware, events.Middleware()),
+		bot.WithDefaultHandler(router.Dispatch),
+		bot.WithUpdatesChannelCap(cfg.Telegram.UpdatesBuffer),
+		bot.WithWorkers(cfg.Telegram.Workers),
+		bot.WithAllowedUpdates(telegram.AllowedUpdates),
+	}
+	if cfg.Telegram.BlockingHandlers {
+		opts = append(opts, bot.WithNotAsyncHandlers())
+	}
+	chaos := telegram.ChaosConfig(cfg.Telegram.Chaos)
+	polling, err := telegram.PollingConfig{
+		Timeout:  cfg.Telegram.PollTimeout,
+		Limit:    cfg.Telegram.PollLimit,
+		Interval: cfg.Telegram.PollInterval,
+		Chaos:    chaos,
+	}.Options()
+	if err != nil {
+		return fmt.Errorf("invalid telegram config: %w", err)
+	}
+	opts = append(opts, polling...)
+	if chaos.Enabled() {
+		slog.Warn("Chaos mode on, failing Telegram API requests at random", "rateLimit", chaos.RateLimit, "serverError", chaos.ServerError,
+			"drop", chaos.Drop, "latency", chaos.Latency, "methods", chaos.Methods, "seed", chaos.Seed)
 	}
+	if cfg.Telegram.WebhookSecret != "" {
+		opts = append(opts, bot.WithWebhookSecretToken(cfg.Telegram.WebhookSecret))
+	}
+	slog.Info("Update pipeline", "buffer", cfg.Telegram.UpdatesBuffer, "workers", cfg.Telegram.Workers,
+		"blocking", cfg.Telegram.BlockingHandlers, "maxInFlight", cfg.Telegram.MaxInFlight, "queueTimeout", cfg.Telegram.QueueTimeout,
+		"pollTimeout", cfg.Telegram.PollTimeout, "pollLimit", cfg.Telegram.PollLimit, "pollInterval", cfg.Telegram.PollInterval)
 
-	// Initialize Telegram bot
+	// Initialize Telegram bot, whose token the telegram stage checked
+	opts = append(opts, bot.WithSkipGetMe())
+	opts = append(opts, telegramOptions(cfg.Telegram)...)
 	b, err := bot.New(cfg.Telegram.Token, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to create Telegram bot: %w", err)
 	}
 
-	// Register command handlers
-	addQuoteHandler := quotes.NewAddQuoteHandler(db.DB)
-	rquoteHandler := quotes.NewRQuoteHandler(db.DB)
+	// Saved quotes without a message link open their chat with an invite
+	// link, dropped by the router when the bot loses its admin rights
+	handlers.saved.WithInviteLinks(telegram.NewInviteLinks(b, b.ID(), telegram.DefaultInviteLinkTTL))
+
+	// Register command handlers, measuring each of them
+	recorder := metrics.NewRecorder(cfg.Metrics.SLOWindow)
+	recorder.Register(validator)
+	recorder.Register(backpressure)
+
+	// How much of each quoted thread was cached, for /cachestats
+	buildStats := quotes.NewBuildStats()
+	handlers.addQuote.WithBuildStats(buildStats)
+	recorder.Register(buildStats)
 
 	// Register handlers for specific commands
-	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/addquote`), wrapHandler(addQuoteHandler))
-	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/rquote`), wrapHandler(rquoteHandler))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/addquote`), wrapHandler(recorder, handlers.addQuote))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/rquote`), wrapHandler(recorder, handlers.rquote))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/quote(@\w+)?(\s|$)`), wrapHandler(recorder, handlers.quote))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/quotefrom`), wrapHandler(recorder, handlers.quoteFrom))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/fquote`), wrapHandler(recorder, handlers.fquote))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/findquote`), wrapHandler(recorder, handlers.findQuote))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/listquotes`), wrapHandler(recorder, handlers.listQuotes))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/quotestats`), wrapHandler(recorder, handlers.quoteStats))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/topquotes`), wrapHandler(recorder, handlers.topQuotes))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/quoteduel`), wrapHandler(recorder, handlers.quoteDuel))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/quotegame`), wrapHandler(recorder, handlers.quoteGame))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/gamescore`), wrapHandler(recorder, handlers.gameScore))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/quotecontest`), wrapHandler(recorder, handlers.quoteContest))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/reorder`), wrapHandler(recorder, handlers.reorder))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/delquote`), wrapHandler(recorder, handlers.delQuote))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/quotehistory`), wrapHandler(recorder, handlers.quoteHistory))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/settings`), wrapHandler(recorder, handlers.settings))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/disable`), wrapHandler(recorder, handlers.disable))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/enable`), wrapHandler(recorder, handlers.enable))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/purgequotes`), wrapHandler(recorder, handlers.purgeQuotes))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/exportpdf`), wrapHandler(recorder, handlers.exportPDF))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/exportquotes`), wrapHandler(recorder, handlers.exportQuotes))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/blockquoter`), wrapHandler(recorder, handlers.blockQuoter))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/unblockquoter`), wrapHandler(recorder, handlers.unblockQuoter))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/nick`), wrapHandler(recorder, handlers.nick))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/mergeauthors`), wrapHandler(recorder, handlers.mergeAuthors))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/unmergeauthors`), wrapHandler(recorder, handlers.unmergeAuthors))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/heatmap`), wrapHandler(recorder, handlers.heatmap))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/history`), wrapHandler(recorder, handlers.history))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/keep`), wrapHandler(recorder, handlers.keep))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/myexport`), wrapHandler(recorder, handlers.myExport))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/saved`), wrapHandler(recorder, handlers.saved))
+	registerPluginHandlers(b, recorder, handlers.plugins)
 
-	// Create errgroup for concurrent component management
-	g, ctx := errgroup.WithContext(ctx)
+	// Register inline keyboard callbacks
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, "addquote:", bot.MatchTypePrefix, wrapHandler(recorder, handlerFunc(handlers.addQuote.HandleCallback)))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, "purgequotes:", bot.MatchTypePrefix, wrapHandler(recorder, handlerFunc(handlers.purgeQuotes.HandleCallback)))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, "quoteduel:", bot.MatchTypePrefix, wrapHandler(recorder, handlerFunc(handlers.quoteDuel.HandleCallback)))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, "quotecontest:", bot.MatchTypePrefix, wrapHandler(recorder, handlerFunc(handlers.quoteContest.HandleCallback)))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, "findquote:", bot.MatchTypePrefix, wrapHandler(recorder, handlerFunc(handlers.findQuote.HandleCallback)))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, "listquotes:", bot.MatchTypePrefix, wrapHandler(recorder, handlerFunc(handlers.listQuotes.HandleCallback)))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, "quoterate:", bot.MatchTypePrefix, wrapHandler(recorder, handlerFunc(handlers.rate.HandleCallback)))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, "bookmark:", bot.MatchTypePrefix, wrapHandler(recorder, handlerFunc(handlers.saved.HandleCallback)))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, "settings:", bot.MatchTypePrefix, wrapHandler(recorder, handlerFunc(handlers.settings.HandleCallback)))
 
-	// Verify bot
-	user, err := b.GetMe(ctx)
+	// Alerts, reports and errors go to the configured notification sinks
+	notifier, err := newNotifier(cfg, db.DB, b)
 	if err != nil {
-		return ctx.Err()
+		return err
 	}
+	warmer.WithReport(notifier.Func(notifications.KindReport, "Cache warm-up"))
+	enforcer.WithHook(notifyLimit(notifier.Func(notifications.KindAlert, "Plan limit reached")))
 
-	// Component 1: Bot polling
-	g.Go(func() error {
-		slog.Info("starting bot polling", "firstName", user.FirstName, "lastName", user.LastName)
-		b.Start(ctx)
-		return ctx.Err()
-	})
+	// Create errgroup for concurrent component management
+	g, ctx := errgroup.WithContext(ctx)
 
-	// Component 2: Cache cleaner
+	// Onboarding lists the other commands and, like the deep links to search
+	// results, needs the bot username
+	startHandler := onboarding.NewHandler(db.DB, handlers.menu(), onboarding.Options{
+		BotUsername:    user.Username,
+		WebURL:         cfg.Web.URL,
+		AllowedChatIDs: allowed.IDs(),
+	}).WithDeepLink(quotes.FindQuoteDeepLinkPrefix, handlers.findQuote.OpenDeepLink)
+	handlers.findQuote.WithBotUsername(user.Username)
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/start`), wrapHandler(recorder, startHandler))
+
+	// Newly allowed chats are onboarded with the same command list
+	onboarder := onboarding.NewOnboarder(db.DB, handlers.menu()).WithWarmer(warmer)
+	allowChat := allowlist.NewAllowChatHandler(db.DB, allowed, onboarder, cfg.OwnerIDs, cfg.AdminChatID)
+	disallowChat := allowlist.NewDisallowChatHandler(db.DB, allowed, cfg.OwnerIDs)
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/allowchat`), wrapHandler(recorder, allowChat))
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/disallowchat`), wrapHandler(recorder, disallowChat))
+
+	// Keep Telegram's command menu in line with the registered commands
+	if err := botcmd.SyncMenu(ctx, b, handlers.menu()); err != nil {
+		slog.Error("failed to sync the command menu", "error", err)
+	}
+
+	// The cache cleaner reports its runs to /doctor
 	cleanerConfig := cache.Config{
 		CleanInterval: cfg.Cache.CleanInterval,
 		KeepDuration:  cfg.Cache.KeepDuration,
+		CompactAfter:  cfg.Cache.CompactAfter,
 	}
-	cleaner := cache.NewCleaner(cacheService, cleanerConfig, slog.Default())
+	cleaner := cache.NewCleaner(cacheService, cleanerConfig, slog.Default()).WithEvents(bus)
+	var maintainer *cache.Maintainer
+	if cfg.Cache.Maintenance.Interval > 0 {
+		maintenance, err := maintenanceConfig(cfg)
+		if err != nil {
+			return err
+		}
+		maintainer = cache.NewMaintainer(db.DB, maintenance, slog.Default())
+		recorder.Register(maintainer)
+	}
+	doctorHandler := doctor.NewHandler(db.DB, doctor.New(db.DB, b, cleaner, doctor.Options{
+		MigrationsDir: cfg.Database.Migrations,
+		WebhookURL:    cfg.Telegram.Webhook,
+		CleanInterval: cfg.Cache.CleanInterval,
+	}), cfg.OwnerIDs)
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/doctor`), wrapHandler(recorder, doctorHandler))
+	cacheStats := quotes.NewCacheStatsHandler(db.DB, buildStats, cfg.OwnerIDs)
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/cachestats`), wrapHandler(recorder, cacheStats))
+
+	// Anonymous usage for the maintainers, from the command metrics, if
+	// opted in; /telemetry tells anyone what is shared
+	telemetryMode, err := telemetry.ParseMode(cfg.Telemetry.Mode)
+	if err != nil {
+		return err
+	}
+	telemetryReporter, err := telemetry.NewReporter(telemetryMode, cfg.Telemetry.Endpoint, recorder, slog.Default())
+	if err != nil {
+		return err
+	}
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/telemetry`), wrapHandler(recorder, telemetry.NewHandler(db.DB, telemetryReporter)))
+
+	// Resend messages lost to a crash or failed sends before the last stop
+	resent, err := outbox.New(db.DB).RetryPending(ctx, b)
+	if err != nil {
+		slog.Error("failed to retry outbox messages", "error", err)
+	} else if resent > 0 {
+		slog.Info("resent pending outbox messages", "count", resent)
+	}
+
+	// Tell the admin and the chats with news on what is new since the last
+	// release announced
+	releases, err := changelog.Load()
+	if err != nil {
+		slog.Error("failed to load the changelog", "error", err)
+	} else {
+		announcer := changelog.NewAnnouncer(db.DB, releases, slog.Default()).
+			WithAdmin(notifier.Func(notifications.KindReport, "What's new")).
+			WithAllowed(allowed.Allowed)
+		if err := announcer.Announce(ctx, b, telemetry.Version()); err != nil {
+			slog.Error("failed to announce the release", "error", err)
+		}
+	}
+
+	// Component 1: Bot updates, polled or taken from the webhook. The server
+	// does not set the webhook: wanon switch-mode moves Telegram over once
+	// this instance is up, so a polling instance can hand over without gaps.
+	if cfg.Telegram.Webhook != "" {
+		server, err := webhookServer(cfg.Telegram, b)
+		if err != nil {
+			return err
+		}
+		g.Go(func() error {
+			slog.Info("taking updates from the webhook", "firstName", user.FirstName, "lastName", user.LastName,
+				"url", cfg.Telegram.Webhook, "address", server.Addr)
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("webhook server: %w", err)
+			}
+			return nil
+		})
+		g.Go(func() error {
+			b.StartWebhook(ctx)
+			return server.Shutdown(context.Background())
+		})
+	} else {
+		g.Go(func() error {
+			slog.Info("starting bot polling", "firstName", user.FirstName, "lastName", user.LastName)
+			b.Start(ctx)
+			return ctx.Err()
+		})
+	}
+
+	// Component 2: Cache cleaner
 	g.Go(func() error {
 		return cleaner.Start(ctx)
 	})
 
+	// Component 3: Prometheus metrics
+	if cfg.Metrics.Listen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", recorder)
+		mux.Handle("/stats", usage.NewAPI(db.Reads()))
+		server := &http.Server{Addr: cfg.Metrics.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		g.Go(func() error {
+			slog.Info("serving metrics", "address", cfg.Metrics.Listen)
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("metrics server: %w", err)
+			}
+			return nil
+		})
+		g.Go(func() error {
+			<-ctx.Done()
+			return server.Shutdown(context.Background())
+		})
+	}
+
+	// Component 4: Command latency objective
+	if cfg.Metrics.SLOLatency > 0 {
+		monitor := metrics.NewSLOMonitor(recorder, cfg.Metrics.SLOLatency, func(ctx context.Context, alert metrics.Alert) {
+			_ = notifier.Notify(ctx, notifications.Notification{
+				Kind:    notifications.KindAlert,
+				Subject: "Command latency over objective",
+				Text:    "⚠️ " + alert.String(),
+			})
+		}, slog.Default())
+		g.Go(func() error {
+			return monitor.Start(ctx, time.Minute)
+		})
+	}
+
+	// Component 5: Quote duel results
+	referee := quotes.NewDuelReferee(db.DB, b, slog.Default())
+	g.Go(func() error {
+		return referee.Start(ctx, time.Minute)
+	})
+
+	// Component 6: Monthly usage report
+	if cfg.Usage.MonthlyReport && !notifier.Empty() {
+		reporter := usage.NewReporter(db.Reads(), notifier.Func(notifications.KindReport, "Monthly usage report"), slog.Default())
+		g.Go(func() error {
+			return reporter.Start(ctx, time.Hour)
+		})
+	}
+
+	// Component 7: Deletion of transient replies in chats with autodelete
+	sweeper := settings.NewReplySweeper(db.DB, b, slog.Default())
+	g.Go(func() error {
+		return sweeper.Start(ctx, 5*time.Second)
+	})
+
+	// Component 8: Quote webhook deliveries
+	if quoteWebhook != nil {
+		g.Go(func() error {
+			return quoteWebhook.Start(ctx)
+		})
+	}
+
+	// Component 9: Quote contest results
+	contestReferee := quotes.NewContestReferee(db.DB, b, slog.Default())
+	g.Go(func() error {
+		return contestReferee.Start(ctx, time.Minute)
+	})
+
+	// Component 10: Read replica health checks
+	if replicas := db.Replicas(); replicas != nil {
+		g.Go(func() error {
+			return replicas.Start(ctx, cfg.Database.ReplicaCheckInterval)
+		})
+	}
+
+	// Component 11: Telemetry reports
+	if telemetryMode != telemetry.ModeOff {
+		g.Go(func() error {
+			slog.Info("reporting telemetry", "mode", telemetryMode, "interval", cfg.Telemetry.Interval)
+			return telemetryReporter.Start(ctx, cfg.Telemetry.Interval)
+		})
+	}
+
+	// Component 12: Cache table maintenance in quiet hours
+	if maintainer != nil {
+		g.Go(func() error {
+			return maintainer.Start(ctx, time.Minute)
+		})
+	}
+
+	// Component 13: Admin HTTP API
+	if cfg.API.Enabled {
+		server := &http.Server{
+			Addr:              cfg.API.Listen,
+			Handler:           api.New(db.DB, buildStats, cfg.API.Token).WithEvents(bus),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		g.Go(func() error {
+			slog.Info("serving admin API", "address", cfg.API.Listen)
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("admin API server: %w", err)
+			}
+			return nil
+		})
+		g.Go(func() error {
+			<-ctx.Done()
+			return server.Shutdown(context.Background())
+		})
+	}
+
+	// Component 14: systemd watchdog pings while the database answers, and
+	// the shutdown notice
+	sd := systemd.FromEnv(slog.Default())
+	if sd.Enabled() {
+		g.Go(func() error {
+			return sd.Start(ctx, func(ctx context.Context) error {
+				sqlDB, err := db.DB.DB()
+				if err != nil {
+					return err
+				}
+				return sqlDB.PingContext(ctx)
+			})
+		})
+	}
+
+	// Component 15: Quote game reveals
+	gameReferee := quotes.NewGameReferee(db.DB, b, slog.Default())
+	g.Go(func() error {
+		return gameReferee.Start(ctx, 15*time.Second)
+	})
+
+	started = true
 	slog.Info("all components started, waiting for shutdown signal")
+	if err := sd.Ready(); err != nil {
+		slog.Warn("failed to notify systemd of the start", "error", err)
+	}
 
 	// Wait for all components to complete
 	if err := g.Wait(); err != nil {
@@ -147,6 +662,14 @@ func runServer(cfg *config.Config) error {
 			slog.Info("graceful shutdown completed")
 			return nil
 		}
+		// The signal context is gone, give the sinks a moment of their own
+		notifyCtx, cancelNotify := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancelNotify()
+		_ = notifier.Notify(notifyCtx, notifications.Notification{
+			Kind:    notifications.KindError,
+			Subject: "wanon stopped",
+			Text:    "🛑 wanon stopped: " + err.Error(),
+		})
 		return fmt.Errorf("component error: %w", err)
 	}
 
@@ -154,47 +677,503 @@ func runServer(cfg *config.Config) error {
 	return nil
 }
 
-// createCacheMiddleware creates a bot middleware that processes updates through cache
-func createCacheMiddleware(cacheService *cache.Service) bot.Middleware {
-	cacheMw := cache.NewMiddleware(cacheService, slog.Default())
+// connectDatabase opens the database and checks it answers
+func connectDatabase(ctx context.Context, cfg *config.DatabaseConfig) (*storage.DB, error) {
+	db, err := storage.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	sqlDB, err := db.DB.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
 
-	return func(next bot.HandlerFunc) bot.HandlerFunc {
-		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
-			// Process through cache first
-			if err := cacheMw.HandleUpdate(ctx, update); err != nil {
-				slog.Error("cache middleware error", "error", err)
-			}
-			// Continue to next handler
-			next(ctx, b, update)
+// verifyTelegram checks the bot token with getMe and returns the bot user
+func verifyTelegram(ctx context.Context, cfg config.TelegramConfig) (*models.User, error) {
+	b, err := bot.New(cfg.Token, append(telegramOptions(cfg), bot.WithSkipGetMe())...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Telegram bot: %w", err)
+	}
+	user, err := b.GetMe(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify the bot token: %w", err)
+	}
+	slog.Info("bot verified", "username", user.Username)
+	return user, nil
+}
+
+// telegramOptions points the bot to the configured Bot API server, if any
+func telegramOptions(cfg config.TelegramConfig) []bot.Option {
+	if cfg.APIURL == "" {
+		return nil
+	}
+	return []bot.Option{bot.WithServerURL(cfg.APIURL)}
+}
+
+// webhookServer serves the bot webhook on the path of its public URL
+func webhookServer(cfg config.TelegramConfig, b *bot.Bot) (*http.Server, error) {
+	webhook, err := url.Parse(cfg.Webhook)
+	if err != nil || webhook.Scheme != "https" {
+		return nil, fmt.Errorf("invalid telegram webhook %q: Telegram only posts to https URLs", cfg.Webhook)
+	}
+	path := webhook.Path
+	if path == "" {
+		path = "/"
+	}
+	mux := http.NewServeMux()
+	mux.Handle("POST "+path, b.WebhookHandler())
+	return &http.Server{Addr: cfg.WebhookListen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}, nil
+}
+
+// commandHandlers holds the handlers of the commands listed in the command
+// menu and the /start help
+type commandHandlers struct {
+	addQuote       *quotes.AddQuoteHandler
+	rquote         *quotes.RQuoteHandler
+	quote          *quotes.QuoteHandler
+	quoteFrom      *quotes.QuoteFromHandler
+	fquote         *quotes.FQuoteHandler
+	findQuote      *quotes.FindQuoteHandler
+	listQuotes     *quotes.ListQuotesHandler
+	quoteStats     *quotes.QuoteStatsHandler
+	topQuotes      *quotes.TopQuotesHandler
+	rate           *quotes.RateHandler
+	quoteDuel      *quotes.QuoteDuelHandler
+	quoteGame      *quotes.QuoteGameHandler
+	gameScore      *quotes.GameScoreHandler
+	quoteContest   *quotes.QuoteContestHandler
+	reorder        *quotes.ReorderHandler
+	delQuote       *quotes.DelQuoteHandler
+	quoteHistory   *quotes.QuoteHistoryHandler
+	settings       *settings.Handler
+	disable        *settings.CommandToggleHandler
+	enable         *settings.CommandToggleHandler
+	exportPDF      *book.Handler
+	exportQuotes   *archive.ExportQuotesHandler
+	purgeQuotes    *quotes.PurgeQuotesHandler
+	blockQuoter    *quotes.QuoterBlockHandler
+	unblockQuoter  *quotes.QuoterBlockHandler
+	nick           *quotes.NickHandler
+	mergeAuthors   *quotes.MergeAuthorsHandler
+	unmergeAuthors *quotes.MergeAuthorsHandler
+	heatmap        *analytics.HeatmapHandler
+	history        *history.Handler
+	keep           *cache.KeepHandler
+	myExport       *archive.MyExportHandler
+	saved          *quotes.SavedHandler
+	plugins        []*plugin.Handler
+}
+
+// newCommandHandlers creates the command handlers. Searches, statistics and
+// exports read from reads, the read replicas if there are any.
+func newCommandHandlers(db, reads *gorm.DB, cfg *config.Config) (*commandHandlers, error) {
+	creators, err := creatorPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	redactor, err := newRedactor(db, cfg)
+	if err != nil {
+		return nil, err
+	}
+	junkGuard, err := quotes.ParseJunkGuard(cfg.Quotes.JunkGuard)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quotes config: %w", err)
+	}
+	h := &commandHandlers{
+		addQuote: quotes.NewAddQuoteHandler(db).
+			WithSkipAnonymousAdmins(cfg.Quotes.SkipAnonymousAdmins).
+			WithSkipOwnMessages(cfg.Quotes.SkipOwnMessages).
+			WithAppendReplies(cfg.Quotes.AppendReplies).
+			WithMaxDepth(cfg.Quotes.MaxThreadDepth).
+			WithRedactor(redactor).
+			WithJunkGuard(junkGuard).
+			WithCreatorPolicy(creators).
+			WithEditWindow(cfg.Quotes.CreatorEditWindow),
+		rquote:         quotes.NewRQuoteHandler(db).WithCustomEmoji(cfg.Quotes.CustomEmoji),
+		quote:          quotes.NewQuoteHandler(db).WithCustomEmoji(cfg.Quotes.CustomEmoji),
+		quoteFrom:      quotes.NewQuoteFromHandler(db).WithCustomEmoji(cfg.Quotes.CustomEmoji),
+		fquote:         quotes.NewFQuoteHandler(reads).WithCustomEmoji(cfg.Quotes.CustomEmoji),
+		findQuote:      quotes.NewFindQuoteHandler(reads),
+		listQuotes:     quotes.NewListQuotesHandler(reads),
+		quoteStats:     quotes.NewQuoteStatsHandler(reads),
+		topQuotes:      quotes.NewTopQuotesHandler(reads),
+		rate:           quotes.NewRateHandler(db),
+		quoteDuel:      quotes.NewQuoteDuelHandler(db).WithWindow(cfg.Quotes.DuelWindow),
+		quoteGame:      quotes.NewQuoteGameHandler(db).WithWindow(cfg.Quotes.GameWindow),
+		gameScore:      quotes.NewGameScoreHandler(reads),
+		quoteContest:   quotes.NewQuoteContestHandler(db),
+		reorder:        quotes.NewReorderHandler(db).WithCreatorPolicy(creators).WithCustomEmoji(cfg.Quotes.CustomEmoji).WithEditWindow(cfg.Quotes.CreatorEditWindow),
+		delQuote:       quotes.NewDelQuoteHandler(db).WithCreatorPolicy(creators).WithEditWindow(cfg.Quotes.CreatorEditWindow),
+		quoteHistory:   quotes.NewQuoteHistoryHandler(db).WithCustomEmoji(cfg.Quotes.CustomEmoji),
+		settings:       settings.NewHandler(db),
+		disable:        settings.NewDisableHandler(db),
+		enable:         settings.NewEnableHandler(db),
+		exportPDF:      book.NewHandler(reads, cfg.Export.FontDir),
+		exportQuotes:   archive.NewExportQuotesHandler(reads),
+		purgeQuotes:    quotes.NewPurgeQuotesHandler(db),
+		blockQuoter:    quotes.NewBlockQuoterHandler(db),
+		unblockQuoter:  quotes.NewUnblockQuoterHandler(db),
+		nick:           quotes.NewNickHandler(db),
+		mergeAuthors:   quotes.NewMergeAuthorsHandler(db),
+		unmergeAuthors: quotes.NewUnmergeAuthorsHandler(db),
+		heatmap:        analytics.NewHeatmapHandler(reads),
+		history:        history.NewHandler(reads).WithLimit(cfg.History.Searches, cfg.History.Window),
+		keep:           cache.NewKeepHandler(db).WithMaxDays(cfg.Cache.KeepMaxDays),
+		myExport:       archive.NewMyExportHandler(reads).WithCreatorPolicy(creators),
+		saved:          quotes.NewSavedHandler(db),
+	}
+	h.plugins, err = plugin.Load(plugin.Registered(), db, cfg.Plugins, slog.Default(), h.names())
+	if err != nil {
+		return nil, err
+	}
+	toggleable := h.toggleable()
+	h.settings.WithCommands(toggleable)
+	h.disable.WithCommands(toggleable)
+	h.enable.WithCommands(toggleable)
+	return h, nil
+}
+
+// withEvents publishes the domain events of the handlers that change quotes
+// or settings
+func (h *commandHandlers) withEvents(publisher events.Publisher) {
+	h.addQuote.WithEvents(publisher)
+	h.reorder.WithEvents(publisher)
+	h.delQuote.WithEvents(publisher)
+	h.quoteHistory.WithEvents(publisher)
+	h.purgeQuotes.WithEvents(publisher)
+	h.settings.WithEvents(publisher)
+	h.disable.WithEvents(publisher)
+	h.enable.WithEvents(publisher)
+}
+
+// withAdmins checks the admins of the handlers' permissioned commands
+// against a shared cache
+func (h *commandHandlers) withAdmins(admins *telegram.AdminService) {
+	h.addQuote.WithAdmins(admins)
+	h.reorder.WithAdmins(admins)
+	h.delQuote.WithAdmins(admins)
+	h.quoteHistory.WithAdmins(admins)
+	h.quoteContest.WithAdmins(admins)
+	h.settings.WithAdmins(admins)
+	h.disable.WithAdmins(admins)
+	h.enable.WithAdmins(admins)
+	h.exportPDF.WithAdmins(admins)
+	h.exportQuotes.WithAdmins(admins)
+	h.purgeQuotes.WithAdmins(admins)
+	h.blockQuoter.WithAdmins(admins)
+	h.unblockQuoter.WithAdmins(admins)
+	h.nick.WithAdmins(admins)
+	h.mergeAuthors.WithAdmins(admins)
+	h.unmergeAuthors.WithAdmins(admins)
+}
+
+// withStore shares the rate limits, pending confirmations and settings
+// menus of the handlers with the other replicas
+func (h *commandHandlers) withStore(store kv.Store) {
+	h.addQuote.WithStore(store)
+	h.findQuote.WithStore(store)
+	h.purgeQuotes.WithStore(store)
+	h.history.WithStore(store)
+	h.settings.WithStore(store)
+}
+
+// creatorPolicy returns the configured retention of quote creators
+func creatorPolicy(cfg *config.Config) (quotes.CreatorPolicy, error) {
+	policy, err := quotes.NewCreatorPolicy(cfg.Quotes.CreatorRetention, cfg.Quotes.CreatorHashKey)
+	if err != nil {
+		return quotes.CreatorPolicy{}, fmt.Errorf("invalid quotes config: %w", err)
+	}
+	return policy, nil
+}
+
+// newRedactor returns the configured redaction of cached messages, honouring
+// the chats that turn it off
+func newRedactor(db *gorm.DB, cfg *config.Config) (*redact.Redactor, error) {
+	redactor, err := redact.New(cfg.Cache.Redact.Rules, cfg.Cache.Redact.Patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache config: %w", err)
+	}
+	return redactor.WithSettings(settings.NewService(db)), nil
+}
+
+// maintenanceConfig returns the configured maintenance of the cache tables
+func maintenanceConfig(cfg *config.Config) (cache.MaintenanceConfig, error) {
+	mode, err := cache.ParseMaintenanceMode(cfg.Cache.Maintenance.Mode)
+	if err != nil {
+		return cache.MaintenanceConfig{}, fmt.Errorf("invalid cache config: %w", err)
+	}
+	var window settings.QuietHours
+	if cfg.Cache.Maintenance.Window != "" {
+		if window, err = settings.ParseQuietHours(cfg.Cache.Maintenance.Window); err != nil {
+			return cache.MaintenanceConfig{}, fmt.Errorf("invalid cache config: %w", err)
 		}
 	}
+	return cache.MaintenanceConfig{
+		Interval: cfg.Cache.Maintenance.Interval,
+		Window:   window,
+		Mode:     mode,
+		Tables:   cfg.Cache.Maintenance.Tables,
+	}, nil
 }
 
-// defaultHandler handles non-command messages
-func defaultHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	// Extract message from update
-	var msg *models.Message
-	if update.Message != nil {
-		msg = update.Message
-	} else if update.EditedMessage != nil {
-		msg = update.EditedMessage
+// names returns the names of every command, without the leading slash,
+// including those left out of the menu
+func (h *commandHandlers) names() []string {
+	names := []string{"start", "doctor", "cachestats", "allowchat", "disallowchat"}
+	for _, command := range h.menu() {
+		names = append(names, strings.TrimPrefix(command.Command(), "/"))
 	}
+	return names
+}
 
-	if msg == nil {
-		return
+// menu returns the commands in the order the command menu shows them, the
+// plugins' last
+func (h *commandHandlers) menu() []botcmd.MenuCommand {
+	menu := []botcmd.MenuCommand{
+		h.addQuote, h.rquote, h.quote, h.quoteFrom, h.fquote, h.findQuote, h.listQuotes, h.quoteStats, h.topQuotes, h.quoteDuel, h.quoteGame, h.gameScore, h.quoteContest, h.reorder, h.delQuote, h.quoteHistory, h.settings, h.disable, h.enable, h.exportPDF, h.exportQuotes, h.purgeQuotes,
+		h.blockQuoter, h.unblockQuoter, h.nick, h.mergeAuthors, h.unmergeAuthors,
+		h.heatmap, h.history, h.keep, h.myExport, h.saved,
 	}
+	for _, handler := range h.plugins {
+		menu = append(menu, handler)
+	}
+	return menu
+}
 
-	// Default handler - just log the message
+// toggleable returns the menu commands admins can turn off in a chat: all
+// but those changing settings, so a chat cannot lock itself out
+func (h *commandHandlers) toggleable() []string {
+	var names []string
+	for _, command := range h.menu() {
+		switch name := strings.TrimPrefix(command.Command(), "/"); name {
+		case "settings", "disable", "enable":
+		default:
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// newRouter routes the updates no command or callback handler matched by
+// their kind
+func newRouter(warmer *cache.Warmer, saved *quotes.SavedHandler, game *quotes.QuoteGameHandler) *botcmd.Router {
+	return botcmd.NewRouter(slog.Default()).
+		Handle(botcmd.KindMessage, logMessage).
+		Handle(botcmd.KindEdited, logMessage).
+		Handle(botcmd.KindReaction, bookmarkOnReaction(saved)).
+		Handle(botcmd.KindPollAnswer, answerGame(game)).
+		Handle(botcmd.KindMyChatMember, logMembership).
+		Handle(botcmd.KindMyChatMember, warmUpOnJoin(warmer)).
+		Handle(botcmd.KindMyChatMember, dropInviteLinks(saved))
+}
+
+// logMessage logs non-command messages and edits, which the cache
+// middleware has already stored
+func logMessage(ctx context.Context, b *bot.Bot, update *models.Update) {
+	msg := update.Message
+	if msg == nil {
+		msg = update.EditedMessage
+	}
 	slog.Debug("received message", "chat_id", msg.Chat.ID, "text", msg.Text)
 }
 
-// wrapHandler wraps a command handler to match bot.HandlerFunc signature
-func wrapHandler(handler interface {
+// logMembership logs the bot being added to, promoted in or removed from
+// a chat
+func logMembership(ctx context.Context, b *bot.Bot, update *models.Update) {
+	change := update.MyChatMember
+	slog.Info("bot membership changed", "audit", true, "chat_id", change.Chat.ID, "user_id", change.From.ID,
+		"from", change.OldChatMember.Type, "to", change.NewChatMember.Type)
+}
+
+// warmUpOnJoin fills the cache of the chats the bot is added to from their
+// export, if one was provided
+func warmUpOnJoin(warmer *cache.Warmer) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		change := update.MyChatMember
+		if !isMember(change.NewChatMember) || isMember(change.OldChatMember) {
+			return
+		}
+		if _, _, err := warmer.Warm(ctx, change.Chat.ID); err != nil {
+			slog.Error("failed to warm up the cache", "chat_id", change.Chat.ID, "error", err)
+		}
+	}
+}
+
+// dropInviteLinks forgets the invite links of the chats where the bot is no
+// longer an administrator, as Telegram revokes them
+func dropInviteLinks(saved *quotes.SavedHandler) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		saved.HandleMyChatMember(update)
+	}
+}
+
+// bookmarkOnReaction saves the quotes users react to with ⭐
+func bookmarkOnReaction(saved *quotes.SavedHandler) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		if err := saved.HandleReaction(ctx, b, update); err != nil {
+			slog.Error("failed to bookmark quote", "chat_id", update.MessageReaction.Chat.ID, "error", err)
+		}
+	}
+}
+
+// answerGame records the answers to quote game polls
+func answerGame(game *quotes.QuoteGameHandler) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		if err := game.HandlePollAnswer(ctx, b, update); err != nil {
+			slog.Error("failed to record game answer", "poll_id", update.PollAnswer.PollID, "error", err)
+		}
+	}
+}
+
+// isMember reports whether a chat member is in the chat
+func isMember(member models.ChatMember) bool {
+	switch member.Type {
+	case models.ChatMemberTypeLeft, models.ChatMemberTypeBanned:
+		return false
+	case models.ChatMemberTypeRestricted:
+		return member.Restricted != nil && member.Restricted.IsMember
+	}
+	return true
+}
+
+// handlerFunc adapts a handler method, such as a callback handler, to the
+// interface accepted by wrapHandler
+type handlerFunc func(ctx context.Context, b *bot.Bot, update *models.Update) error
+
+// Handle implements the handler interface
+func (f handlerFunc) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	return f(ctx, b, update)
+}
+
+// wrapHandler wraps a command handler to match bot.HandlerFunc signature,
+// recording how long it takes and whether it fails
+func wrapHandler(recorder *metrics.Recorder, handler interface {
 	Handle(ctx context.Context, b *bot.Bot, update *models.Update) error
 }) bot.HandlerFunc {
+	command := commandName(handler)
 	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
-		if err := handler.Handle(ctx, b, update); err != nil {
-			slog.Error("command handler error", "error", err)
+		start := time.Now()
+		err := handler.Handle(ctx, b, update)
+		recorder.Observe(command, time.Since(start), err)
+		if err != nil {
+			slog.Error("command handler error", "command", command, "error", err)
+		}
+	}
+}
+
+// commandName names a handler in metrics: its command without the slash, or
+// "callback" for handlers of inline keyboard buttons
+func commandName(handler any) string {
+	if c, ok := handler.(interface{ Command() string }); ok {
+		return strings.TrimPrefix(c.Command(), "/")
+	}
+	return "callback"
+}
+
+// newEventBus creates the bus of domain events with the configured
+// subscribers. The returned function closes the event log.
+func newEventBus(cfg config.EventsConfig) (*events.Bus, func() error, error) {
+	bus := events.NewBus(slog.Default())
+	if cfg.AuditLog {
+		bus.Subscribe("audit", events.NewAuditLog(slog.Default()))
+	}
+	if cfg.File == "" {
+		return bus, func() error { return nil }, nil
+	}
+	log, err := events.OpenFileLog(cfg.File)
+	if err != nil {
+		return nil, nil, err
+	}
+	bus.Subscribe("file", log)
+	return bus, log.Close, nil
+}
+
+// newSharedStore connects to the configured Redis server, checking it
+// answers. Without one it returns a nil store, and each replica keeps its
+// state in process. The returned function closes the connections.
+func newSharedStore(ctx context.Context, cfg config.RedisConfig) (kv.Store, func() error, error) {
+	if cfg.Addr == "" {
+		slog.Info("Shared state", "store", "in process")
+		return nil, func() error { return nil }, nil
+	}
+	opts := kv.RedisOptions{
+		Addr:     cfg.Addr,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	}
+	if strings.Contains(cfg.Addr, "://") {
+		parsed, err := kv.ParseRedisURL(cfg.Addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts.Addr, opts.TLS = parsed.Addr, parsed.TLS
+		if parsed.Password != "" {
+			opts.Username, opts.Password = parsed.Username, parsed.Password
+		}
+		if parsed.DB != 0 {
+			opts.DB = parsed.DB
+		}
+	}
+	if cfg.TLS && opts.TLS == nil {
+		host, _, _ := net.SplitHostPort(opts.Addr)
+		opts.TLS = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	}
+	opts.Prefix, opts.Timeout = cfg.Prefix, cfg.Timeout
+	store := kv.NewRedis(opts)
+	if err := store.Ping(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	slog.Info("Shared state", "store", "redis", "addr", opts.Addr, "tls", opts.TLS != nil, "db", opts.DB, "prefix", cfg.Prefix)
+	return store, store.Close, nil
+}
+
+// newNotifier creates the notifier of alerts, reports and errors from the
+// configured sinks
+func newNotifier(cfg *config.Config, db *gorm.DB, b *bot.Bot) (*notifications.Notifier, error) {
+	nc := cfg.Notifications
+	notifier := notifications.New(slog.Default())
+
+	chatIDs := cfg.OwnerIDs
+	if cfg.AdminChatID != 0 {
+		chatIDs = []int64{cfg.AdminChatID}
+	}
+	if nc.Telegram && len(chatIDs) > 0 {
+		kinds, err := notifications.ParseKinds(nc.TelegramEvents)
+		if err != nil {
+			return nil, fmt.Errorf("notifications.telegram_events: %w", err)
+		}
+		notifier.Add("telegram", notifications.NewTelegramSink(db, b, chatIDs), kinds...)
+	}
+
+	for i, webhook := range nc.Webhooks {
+		sink, err := notifications.NewWebhookSink(webhook.URL, webhook.Format)
+		if err != nil {
+			return nil, fmt.Errorf("notifications.webhooks[%d]: %w", i, err)
+		}
+		kinds, err := notifications.ParseKinds(webhook.Events)
+		if err != nil {
+			return nil, fmt.Errorf("notifications.webhooks[%d]: %w", i, err)
+		}
+		notifier.Add(fmt.Sprintf("webhook %d", i), sink, kinds...)
+	}
+
+	if smtpCfg := nc.SMTP; smtpCfg.Host != "" {
+		sink, err := notifications.NewSMTPSink(smtpCfg.Host, smtpCfg.Port, smtpCfg.Username, smtpCfg.Password, smtpCfg.From, smtpCfg.To)
+		if err != nil {
+			return nil, fmt.Errorf("notifications.smtp: %w", err)
+		}
+		kinds, err := notifications.ParseKinds(smtpCfg.Events)
+		if err != nil {
+			return nil, fmt.Errorf("notifications.smtp: %w", err)
 		}
+		notifier.Add("smtp", sink, kinds...)
 	}
+	return notifier, nil
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/storage"
+)
+
+// runMergeAuthors merges two author identities of a chat, or undoes a merge
+func runMergeAuthors(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("merge-authors", flag.ContinueOnError)
+	chatID := flags.Int64("chat", 0, "chat ID (required)")
+	from := flags.Int64("from", 0, "user ID to merge (required)")
+	into := flags.Int64("into", 0, "user ID to keep (required unless --undo)")
+	undo := flags.Bool("undo", false, "make --from its own author again")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *chatID == 0 || *from == 0 || (*into == 0 && !*undo) {
+		return fmt.Errorf("merge-authors: --chat, --from and --into are required")
+	}
+
+	ctx := context.Background()
+
+	db, err := storage.New(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	aliases := quotes.NewAliases(db.DB)
+	if *undo {
+		removed, err := aliases.Unmerge(ctx, *chatID, *from)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return fmt.Errorf("merge-authors: user %d is not merged into anyone", *from)
+		}
+		slog.Info("author unmerged", "audit", true, "chat_id", *chatID, "alias_id", *from)
+		return nil
+	}
+
+	canonicalID, err := aliases.Merge(ctx, *chatID, *from, *into, 0)
+	if errors.Is(err, quotes.ErrSameAuthor) {
+		return fmt.Errorf("merge-authors: %w", err)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("authors merged", "audit", true, "chat_id", *chatID, "alias_id", *from, "canonical_id", canonicalID)
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+
+	"github.com/go-telegram/bot"
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/metrics"
+	"github.com/graffic/wanon-go/internal/plugin"
+	"github.com/graffic/wanon-go/internal/storage"
+)
+
+// runMigrations applies the bot's migrations, then those of each plugin
+func runMigrations(ctx context.Context, cfg *config.Config) error {
+	if err := storage.RunMigrations(ctx, &cfg.Database); err != nil {
+		return err
+	}
+	for _, p := range plugin.Registered() {
+		migrations := p.Migrations()
+		if migrations == nil {
+			continue
+		}
+		if err := storage.RunPluginMigrations(ctx, &cfg.Database, p.Name(), migrations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerPluginHandlers registers the commands of the plugins. A command
+// only matches as a whole word, so a plugin's /stat does not catch /stats.
+func registerPluginHandlers(b *bot.Bot, recorder *metrics.Recorder, handlers []*plugin.Handler) {
+	for _, handler := range handlers {
+		pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(handler.Command()) + `(@|\s|$)`)
+		b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, pattern, wrapHandler(recorder, handler))
+		slog.Info("Registered plugin command", "plugin", handler.Plugin(), "command", handler.Command())
+	}
+}
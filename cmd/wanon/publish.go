@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-telegram/bot"
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/publish"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/settings"
+	"github.com/graffic/wanon-go/internal/storage"
+	"github.com/graffic/wanon-go/internal/telegram"
+)
+
+// runPublish generates a static HTML archive of the quotes of a chat
+func runPublish(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("publish", flag.ContinueOnError)
+	chatID := flags.Int64("chat", 0, "chat ID to publish (required)")
+	out := flags.String("out", "./site", "output directory")
+	title := flags.String("title", "Quotes", "site title")
+	avatars := flags.Bool("avatars", cfg.Web.Avatars.Enabled, "show the profile photos of authors, fetched with the bot token")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *chatID == 0 {
+		return fmt.Errorf("publish: --chat is required")
+	}
+
+	ctx := context.Background()
+
+	db, err := storage.New(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	cs, err := settings.NewService(db.DB).Get(ctx, *chatID)
+	if err != nil {
+		return err
+	}
+
+	authors, err := quotes.LoadAuthors(ctx, db.DB, *chatID)
+	if err != nil {
+		return err
+	}
+
+	opts := publish.Options{
+		Title:    *title,
+		Location: cs.Location(""),
+		Layout:   cs.Layout(""),
+		Authors:  authors,
+	}
+	if *avatars {
+		if opts.Avatars, err = newAvatars(cfg); err != nil {
+			return err
+		}
+	}
+
+	site, err := publish.Publish(ctx, quotes.NewStore(db.Reads()), *chatID, *out, opts)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("published quote archive", "chat_id", *chatID, "dir", *out, "quotes", site.Quotes())
+	return nil
+}
+
+// newAvatars creates the profile photo service of the configured cache
+func newAvatars(cfg *config.Config) (*telegram.Avatars, error) {
+	b, err := bot.New(cfg.Telegram.Token, append(telegramOptions(cfg.Telegram), bot.WithSkipGetMe())...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Telegram bot: %w", err)
+	}
+	return telegram.NewAvatars(b, telegram.AvatarConfig{
+		Dir:          cfg.Web.Avatars.Dir,
+		TTL:          cfg.Web.Avatars.TTL,
+		MaxCacheSize: cfg.Web.Avatars.MaxCacheMB << 20,
+	})
+}
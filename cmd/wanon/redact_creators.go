@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/storage"
+)
+
+// runRedactCreators rewrites the creator of every stored quote to what
+// quotes.creator_retention keeps
+func runRedactCreators(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("redact-creators", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "count the quotes to change without changing them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	policy, err := creatorPolicy(cfg)
+	if err != nil {
+		return err
+	}
+
+	db, err := storage.New(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	store := quotes.NewStore(db.DB).WithCreatorPolicy(policy)
+	changed, err := store.RedactCreators(context.Background(), *dryRun)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Printf("%d quote(s) would be redacted to creator retention %q\n", changed, policy.Retention)
+		return nil
+	}
+	slog.Info("quote creators redacted", "audit", true, "retention", policy.Retention, "quotes", changed)
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/replay"
+	"github.com/graffic/wanon-go/internal/storage"
+)
+
+// runReplay rebuilds the quotes and chat settings of a fresh database from
+// the event log, up to --until for a point-in-time restore
+func runReplay(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	until := flags.String("until", "", "restore the state at this time, RFC 3339 (default the end of the log)")
+	dryRun := flags.Bool("dry-run", false, "check the log without writing to the database")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	file := cfg.Events.File
+	if flags.NArg() > 0 {
+		file = flags.Arg(0)
+	}
+	if file == "" {
+		return fmt.Errorf("replay: give the event log file, or set events.file")
+	}
+
+	var opts replay.Options
+	opts.DryRun = *dryRun
+	if *until != "" {
+		parsed, err := time.Parse(time.RFC3339, *until)
+		if err != nil {
+			return fmt.Errorf("replay: --until must be RFC 3339, e.g. 2026-09-15T12:00:00Z")
+		}
+		opts.Until = parsed
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer f.Close()
+
+	if opts.DryRun {
+		result, err := replay.Replay(context.Background(), nil, f, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", file, result)
+		return nil
+	}
+
+	if err := runMigrations(context.Background(), cfg); err != nil {
+		return err
+	}
+	db, err := storage.New(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	result, err := replay.Replay(context.Background(), db.DB, f, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s\n", file, result)
+	slog.Info("replayed event log", "audit", true, "file", file, "until", *until, "last", result.Last)
+	return nil
+}
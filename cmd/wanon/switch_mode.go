@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/telegram"
+)
+
+// runSwitchMode moves update delivery between polling and the configured
+// webhook, rolling back if the new side does not take the updates
+func runSwitchMode(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("switch-mode", flag.ContinueOnError)
+	dropPending := flags.Bool("drop-pending", false, "discard the updates waiting for the new mode")
+	timeout := flags.Duration("timeout", time.Minute, "how long to wait for each side to take the pending updates")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: wanon switch-mode [--drop-pending] [--timeout 1m] %s|%s", telegram.ModePolling, telegram.ModeWebhook)
+	}
+	mode := flags.Arg(0)
+	if mode == telegram.ModeWebhook && cfg.Telegram.Webhook == "" {
+		return fmt.Errorf("set telegram.webhook to the public URL of the webhook first")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	// Only Bot API calls are made; nothing polls for updates
+	b, err := bot.New(cfg.Telegram.Token, append(telegramOptions(cfg.Telegram), bot.WithSkipGetMe())...)
+	if err != nil {
+		return fmt.Errorf("failed to create Telegram bot: %w", err)
+	}
+	return telegram.NewSwitchover(b, *timeout, slog.Default()).Switch(ctx, mode, telegram.SwitchOptions{
+		Webhook: telegram.WebhookTarget{
+			URL:         cfg.Telegram.Webhook,
+			SecretToken: cfg.Telegram.WebhookSecret,
+		},
+		DropPending: *dropPending,
+	})
+}
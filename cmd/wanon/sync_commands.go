@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/go-telegram/bot"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/config"
+)
+
+// runSyncCommands pushes the command menu, in every translated language, to
+// Telegram without starting the server
+func runSyncCommands(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("sync-commands", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the menus instead of sending them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// Only the command names and descriptions are used, so the handlers
+	// need no database
+	handlers, err := newCommandHandlers(nil, nil, cfg)
+	if err != nil {
+		return err
+	}
+	menu := handlers.menu()
+
+	if *dryRun {
+		for _, language := range append([]string{""}, botcmd.MenuLanguages()...) {
+			fmt.Fprintf(os.Stdout, "[%s]\n", orDefaultLanguage(language))
+			for _, command := range botcmd.Menu(menu, language) {
+				fmt.Fprintf(os.Stdout, "%s - %s\n", command.Command, command.Description)
+			}
+		}
+		return nil
+	}
+
+	b, err := bot.New(cfg.Telegram.Token, telegramOptions(cfg.Telegram)...)
+	if err != nil {
+		return fmt.Errorf("failed to create Telegram bot: %w", err)
+	}
+	if err := botcmd.SyncMenu(context.Background(), b, menu); err != nil {
+		return err
+	}
+	slog.Info("command menu synced", "commands", len(menu), "languages", len(botcmd.MenuLanguages()))
+	return nil
+}
+
+// orDefaultLanguage names the menu of a language code
+func orDefaultLanguage(language string) string {
+	if language == "" {
+		return "default"
+	}
+	return language
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/storage"
+	"github.com/graffic/wanon-go/internal/tenancy"
+	"github.com/graffic/wanon-go/internal/usage"
+)
+
+// runUsageReport writes the usage of every tenant in a month against its
+// plan, as CSV for billing or JSON
+func runUsageReport(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("usage-report", flag.ContinueOnError)
+	monthFlag := flags.String("month", "", "month to report, YYYY-MM (default the current month)")
+	format := flags.String("format", "csv", "output format: csv or json")
+	out := flags.String("out", "", "output file (default stdout)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("usage-report: unknown format %q, expected csv or json", *format)
+	}
+	month := usage.MonthOf(time.Now())
+	if *monthFlag != "" {
+		parsed, err := time.Parse("2006-01", *monthFlag)
+		if err != nil {
+			return fmt.Errorf("usage-report: --month must be YYYY-MM")
+		}
+		month = parsed
+	}
+
+	tenants, err := newTenants(cfg.Tenancy)
+	if err != nil {
+		return err
+	}
+	if !tenants.Enabled() {
+		return fmt.Errorf("usage-report: no tenants configured in tenancy.tenants")
+	}
+
+	db, err := storage.New(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	report, err := tenancy.BuildReport(context.Background(), tenants, tenancy.NewMeter(db.DB), month)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = report.WriteCSV(w)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write usage report: %w", err)
+	}
+	return nil
+}
+
+// newTenants builds the tenant registry from the config
+func newTenants(cfg config.TenancyConfig) (*tenancy.Registry, error) {
+	plans := make([]tenancy.Plan, 0, len(cfg.Plans))
+	for _, plan := range cfg.Plans {
+		plans = append(plans, tenancy.Plan{
+			Name:              plan.Name,
+			MaxQuotes:         plan.MaxQuotes,
+			MaxCachedMessages: plan.MaxCachedMessages,
+			MaxAPICalls:       plan.MaxAPICalls,
+		})
+	}
+	tenants := make([]tenancy.TenantConfig, 0, len(cfg.Tenants))
+	for _, tenant := range cfg.Tenants {
+		tenants = append(tenants, tenancy.TenantConfig{Name: tenant.Name, Plan: tenant.Plan, ChatIDs: tenant.ChatIDs})
+	}
+	registry, err := tenancy.New(plans, tenants)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenancy config: %w", err)
+	}
+	return registry, nil
+}
+
+// notifyLimit tells the operator that a tenant reached a plan limit
+func notifyLimit(notify func(ctx context.Context, text string)) tenancy.Hook {
+	return func(ctx context.Context, event tenancy.Event) {
+		notify(ctx, fmt.Sprintf("Tenant %s reached the %s limit of its %s plan in %s: %d of %d (first refused in chat %d).",
+			event.Tenant.Name, event.Resource, event.Tenant.Plan.Name, event.Month.Format("January 2006"), event.Used, event.Limit, event.ChatID))
+	}
+}
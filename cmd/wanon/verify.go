@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/integrity"
+	"github.com/graffic/wanon-go/internal/storage"
+)
+
+// runVerify scans the database for integrity issues, deleting the
+// offending rows with --fix. It fails while issues remain, so it can run
+// from cron or CI.
+func runVerify(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "delete the offending rows")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := storage.New(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	report, err := integrity.Verify(context.Background(), db.DB, *fix)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report.String())
+
+	if *fix && report.Found() > 0 {
+		slog.Info("fixed integrity issues", "audit", true, "rows", report.Found())
+	}
+	if remaining := report.Remaining(); remaining > 0 {
+		return fmt.Errorf("verify: %d row(s) with integrity issues", remaining)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ go 1.25
 
 require (
 	github.com/go-telegram/bot v1.18.0
+	github.com/jung-kurt/gofpdf v1.16.2
 	github.com/knadh/koanf/parsers/yaml v0.1.0
 	github.com/knadh/koanf/providers/env v0.1.0
 	github.com/knadh/koanf/providers/file v0.1.0
@@ -15,7 +16,8 @@ require (
 	golang.org/x/sync v0.19.0
 	gorm.io/datatypes v1.2.0
 	gorm.io/driver/postgres v1.5.2
-	gorm.io/gorm v1.25.4
+	gorm.io/gorm v1.25.12
+	gorm.io/plugin/dbresolver v1.5.3
 )
 
 require (
@@ -78,7 +80,7 @@ require (
 	golang.org/x/text v0.33.0 // indirect
 	golang.org/x/time v0.14.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
-	gorm.io/driver/mysql v1.4.7 // indirect
+	gorm.io/driver/mysql v1.5.7 // indirect
 )
 
 exclude google.golang.org/genproto v0.0.0-20230110181048-76db0878b65f
@@ -0,0 +1,130 @@
+// Package allowlist holds the chats the bot works in: those configured in
+// allowed_chat_ids and those the owners allow at runtime with /allowchat.
+package allowlist
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AllowedChat is a chat allowed at runtime
+type AllowedChat struct {
+	ChatID    int64     `gorm:"primaryKey" json:"chat_id"`
+	AddedBy   int64     `gorm:"not null" json:"added_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for AllowedChat
+func (AllowedChat) TableName() string {
+	return "allowed_chat"
+}
+
+// Allowlist answers which chats are allowed. With no configured chats every
+// chat is allowed, as before runtime allowlisting existed.
+type Allowlist struct {
+	db         *gorm.DB
+	configured map[int64]bool
+
+	mu      sync.RWMutex
+	runtime map[int64]bool
+}
+
+// New creates an allowlist of the configured chats. Call Load to add the
+// chats allowed at runtime.
+func New(db *gorm.DB, configured []int64) *Allowlist {
+	list := &Allowlist{
+		db:         db,
+		configured: make(map[int64]bool, len(configured)),
+		runtime:    make(map[int64]bool),
+	}
+	for _, id := range configured {
+		list.configured[id] = true
+	}
+	return list
+}
+
+// Load reads the chats allowed at runtime
+func (l *Allowlist) Load(ctx context.Context) error {
+	var chats []AllowedChat
+	if err := l.db.WithContext(ctx).Find(&chats).Error; err != nil {
+		return fmt.Errorf("failed to load allowed chats: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.runtime = make(map[int64]bool, len(chats))
+	for _, chat := range chats {
+		l.runtime[chat.ChatID] = true
+	}
+	return nil
+}
+
+// AllowsAll reports whether every chat is allowed
+func (l *Allowlist) AllowsAll() bool {
+	return len(l.configured) == 0
+}
+
+// Allowed reports whether the bot works in a chat
+func (l *Allowlist) Allowed(chatID int64) bool {
+	if l.AllowsAll() || l.configured[chatID] {
+		return true
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.runtime[chatID]
+}
+
+// Add allows a chat, reporting whether it was not allowed before
+func (l *Allowlist) Add(ctx context.Context, chatID, addedBy int64) (bool, error) {
+	if l.Allowed(chatID) {
+		return false, nil
+	}
+	err := l.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&AllowedChat{ChatID: chatID, AddedBy: addedBy}).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to allow chat: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.runtime[chatID] = true
+	return true, nil
+}
+
+// Remove disallows a chat allowed at runtime, reporting whether it was.
+// Configured chats stay allowed.
+func (l *Allowlist) Remove(ctx context.Context, chatID int64) (bool, error) {
+	result := l.db.WithContext(ctx).Where("chat_id = ?", chatID).Delete(&AllowedChat{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to disallow chat: %w", result.Error)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.runtime, chatID)
+	return result.RowsAffected > 0, nil
+}
+
+// IDs returns the allowed chats, configured and runtime, in order
+func (l *Allowlist) IDs() []int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	ids := make([]int64, 0, len(l.configured)+len(l.runtime))
+	for id := range l.configured {
+		ids = append(ids, id)
+	}
+	for id := range l.runtime {
+		if !l.configured[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,56 @@
+package allowlist
+
+import (
+	"context"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowlist_Configured(t *testing.T) {
+	all := New(nil, nil)
+	assert.True(t, all.AllowsAll())
+	assert.True(t, all.Allowed(-100123))
+
+	list := New(nil, []int64{-100123, 42})
+	assert.False(t, list.AllowsAll())
+	assert.True(t, list.Allowed(-100123))
+	assert.False(t, list.Allowed(-100999))
+	assert.Equal(t, []int64{-100123, 42}, list.IDs())
+}
+
+func TestAllowlist_Runtime(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+	list := New(db.DB, []int64{-100123})
+
+	added, err := list.Add(ctx, -100999, 1)
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.True(t, list.Allowed(-100999))
+
+	// Already allowed, by the config or at runtime
+	added, err = list.Add(ctx, -100999, 1)
+	require.NoError(t, err)
+	assert.False(t, added)
+	added, err = list.Add(ctx, -100123, 1)
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	// Runtime chats survive restarts
+	restarted := New(db.DB, []int64{-100123})
+	require.NoError(t, restarted.Load(ctx))
+	assert.True(t, restarted.Allowed(-100999))
+	assert.Equal(t, []int64{-100999, -100123}, restarted.IDs())
+
+	removed, err := restarted.Remove(ctx, -100999)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	assert.False(t, restarted.Allowed(-100999))
+
+	removed, err = restarted.Remove(ctx, -100999)
+	require.NoError(t, err)
+	assert.False(t, removed)
+}
@@ -0,0 +1,148 @@
+package allowlist
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/onboarding"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"gorm.io/gorm"
+)
+
+// Handler handles /allowchat and /disallowchat
+type Handler struct {
+	list      *Allowlist
+	onboarder *onboarding.Onboarder
+	outbox    *outbox.Outbox
+	owners    map[int64]bool
+	adminChat int64
+	allow     bool
+}
+
+// NewAllowChatHandler creates the /allowchat handler answering only the
+// given owners. Onboarding reports go to adminChat, or to the owner who
+// allowed the chat when it is zero.
+func NewAllowChatHandler(db *gorm.DB, list *Allowlist, onboarder *onboarding.Onboarder, ownerIDs []int64, adminChat int64) *Handler {
+	h := NewDisallowChatHandler(db, list, ownerIDs)
+	h.onboarder = onboarder
+	h.adminChat = adminChat
+	h.allow = true
+	return h
+}
+
+// NewDisallowChatHandler creates the /disallowchat handler answering only
+// the given owners
+func NewDisallowChatHandler(db *gorm.DB, list *Allowlist, ownerIDs []int64) *Handler {
+	owners := make(map[int64]bool, len(ownerIDs))
+	for _, id := range ownerIDs {
+		owners[id] = true
+	}
+	return &Handler{list: list, outbox: outbox.New(db), owners: owners}
+}
+
+// Handle processes /allowchat <chat id> and /disallowchat <chat id>. Without
+// a chat ID both list the allowed chats. Commands from anyone but the owners
+// are ignored.
+func (h *Handler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	if !h.owners[msg.From.ID] {
+		slog.Info("ignoring allowlist command from non-owner", "audit", true, "chat_id", msg.Chat.ID, "user_id", msg.From.ID)
+		return nil
+	}
+
+	if h.list.AllowsAll() {
+		return h.reply(ctx, b, msg, "Every chat is allowed: allowed_chat_ids is empty.")
+	}
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	if args.Len() == 0 {
+		return h.reply(ctx, b, msg, h.listText())
+	}
+	chatID, err := strconv.ParseInt(args.Arg(0), 10, 64)
+	if err != nil || chatID == 0 {
+		return h.reply(ctx, b, msg, fmt.Sprintf("Usage: %s <chat id>", h.Command()))
+	}
+
+	if !h.allow {
+		return h.disallow(ctx, b, msg, chatID)
+	}
+
+	added, err := h.list.Add(ctx, chatID, msg.From.ID)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return h.reply(ctx, b, msg, fmt.Sprintf("Chat %d is already allowed.", chatID))
+	}
+	slog.Info("chat allowed", "audit", true, "chat_id", chatID, "user_id", msg.From.ID)
+
+	checklist := h.onboarder.Run(ctx, b, chatID)
+	slog.Info("chat onboarded", "chat_id", chatID, "ready", checklist.Ready())
+
+	reportChat := h.adminChat
+	if reportChat == 0 {
+		reportChat = msg.Chat.ID
+	}
+	_, err = h.outbox.Send(ctx, b, &outbox.Message{ChatID: reportChat, Text: checklist.String()})
+	return err
+}
+
+// disallow removes a chat allowed at runtime
+func (h *Handler) disallow(ctx context.Context, b *bot.Bot, msg *models.Message, chatID int64) error {
+	if h.list.configured[chatID] {
+		return h.reply(ctx, b, msg, fmt.Sprintf("Chat %d is in allowed_chat_ids; remove it from the config instead.", chatID))
+	}
+	removed, err := h.list.Remove(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return h.reply(ctx, b, msg, fmt.Sprintf("Chat %d is not allowed.", chatID))
+	}
+	slog.Info("chat disallowed", "audit", true, "chat_id", chatID, "user_id", msg.From.ID)
+	return h.reply(ctx, b, msg, fmt.Sprintf("Chat %d is no longer allowed.", chatID))
+}
+
+// listText lists the allowed chats
+func (h *Handler) listText() string {
+	lines := []string{"Allowed chats:"}
+	for _, id := range h.list.IDs() {
+		line := strconv.FormatInt(id, 10)
+		if h.list.configured[id] {
+			line += " (config)"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// reply answers the owner in the chat of the command
+func (h *Handler) reply(ctx context.Context, b *bot.Bot, msg *models.Message, text string) error {
+	_, err := h.outbox.Send(ctx, b, &outbox.Message{ChatID: msg.Chat.ID, Text: text})
+	return err
+}
+
+// Command returns the command name
+func (h *Handler) Command() string {
+	if h.allow {
+		return "/allowchat"
+	}
+	return "/disallowchat"
+}
+
+// Description returns the command description
+func (h *Handler) Description() string {
+	if h.allow {
+		return "Allow a chat and onboard it (owners only)"
+	}
+	return "Stop working in a chat allowed with /allowchat (owners only)"
+}
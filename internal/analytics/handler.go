@@ -0,0 +1,67 @@
+package analytics
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/settings"
+	"gorm.io/gorm"
+)
+
+// HeatmapHandler handles the /heatmap command
+type HeatmapHandler struct {
+	db       *gorm.DB
+	settings *settings.Service
+	outbox   *outbox.Outbox
+}
+
+// NewHeatmapHandler creates a new heatmap handler
+func NewHeatmapHandler(db *gorm.DB) *HeatmapHandler {
+	return &HeatmapHandler{
+		db:       db,
+		settings: settings.NewService(db),
+		outbox:   outbox.New(db),
+	}
+}
+
+// Handle processes the /heatmap command, replying with the hour by weekday
+// activity of the chat in its time zone
+func (h *HeatmapHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+	slog.Info("executing /heatmap command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	cs, err := h.settings.Get(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	loc := cs.Location(msg.From.LanguageCode)
+
+	heatmap, err := BuildHeatmap(ctx, h.db, chatID, loc)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.outbox.Send(ctx, b, &outbox.Message{
+		ChatID:    chatID,
+		Text:      heatmap.HTML(loc),
+		ParseMode: models.ParseModeHTML,
+	})
+	return err
+}
+
+// Command returns the command name
+func (h *HeatmapHandler) Command() string {
+	return "/heatmap"
+}
+
+// Description returns the command description
+func (h *HeatmapHandler) Description() string {
+	return "Show when the chat is most active"
+}
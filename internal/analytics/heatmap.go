@@ -0,0 +1,125 @@
+// Package analytics aggregates chat activity from the message cache.
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// heatmapShades draw the activity of a cell, from none to the busiest
+var heatmapShades = []rune{'·', '░', '▒', '▓', '█'}
+
+// weekdayNames label the heatmap rows, starting on Monday
+var weekdayNames = [7]string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// Heatmap counts messages by weekday (Monday first) and hour of the day
+type Heatmap struct {
+	Counts [7][24]int64
+}
+
+// Add counts n messages sent on a weekday at an hour
+func (h *Heatmap) Add(weekday time.Weekday, hour int, n int64) {
+	// time.Weekday starts on Sunday
+	h.Counts[(int(weekday)+6)%7][hour] += n
+}
+
+// Total returns the number of messages counted
+func (h *Heatmap) Total() int64 {
+	var total int64
+	for _, day := range h.Counts {
+		for _, n := range day {
+			total += n
+		}
+	}
+	return total
+}
+
+// Busiest returns the weekday and hour with the most messages
+func (h *Heatmap) Busiest() (time.Weekday, int) {
+	var best int64 = -1
+	day, hour := 0, 0
+	for d, hours := range h.Counts {
+		for hr, n := range hours {
+			if n > best {
+				best, day, hour = n, d, hr
+			}
+		}
+	}
+	return time.Weekday((day + 1) % 7), hour
+}
+
+// Grid renders the heatmap as a text grid, a row per weekday and a column
+// per hour, shaded relative to the busiest hour
+func (h *Heatmap) Grid() string {
+	var peak int64
+	for _, day := range h.Counts {
+		for _, n := range day {
+			peak = max(peak, n)
+		}
+	}
+
+	lines := []string{"    0     6     12    18    "}
+	for d, hours := range h.Counts {
+		var row strings.Builder
+		row.WriteString(weekdayNames[d] + " ")
+		for _, n := range hours {
+			row.WriteRune(shade(n, peak))
+		}
+		lines = append(lines, row.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// shade picks the character of a cell
+func shade(n, peak int64) rune {
+	if n == 0 || peak == 0 {
+		return heatmapShades[0]
+	}
+	// Any activity gets at least the lightest shade
+	levels := int64(len(heatmapShades) - 1)
+	level := 1 + (n*levels-1)/peak
+	return heatmapShades[min(level, levels)]
+}
+
+// HTML renders the heatmap as a Telegram HTML message
+func (h *Heatmap) HTML(loc *time.Location) string {
+	if h.Total() == 0 {
+		return "No recent messages to analyse."
+	}
+	day, hour := h.Busiest()
+	return fmt.Sprintf("Activity of the last %d cached messages (%s):\n<pre>%s</pre>\nBusiest: %s at %02d:00",
+		h.Total(), html.EscapeString(loc.String()), html.EscapeString(h.Grid()), day, hour)
+}
+
+// BuildHeatmap aggregates the cached messages of a chat by weekday and hour
+// in the given time zone
+func BuildHeatmap(ctx context.Context, db *gorm.DB, chatID int64, loc *time.Location) (*Heatmap, error) {
+	var rows []struct {
+		Weekday  int
+		Hour     int
+		Messages int64
+	}
+	err := db.WithContext(ctx).Raw(`
+		SELECT EXTRACT(DOW FROM local_time)::int AS weekday, EXTRACT(HOUR FROM local_time)::int AS hour, COUNT(*) AS messages
+		FROM (
+			SELECT to_timestamp(date) AT TIME ZONE ? AS local_time
+			FROM cache_entry
+			WHERE chat_id = ?
+		) dates
+		GROUP BY 1, 2`, loc.String(), chatID).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate chat activity: %w", err)
+	}
+
+	heatmap := &Heatmap{}
+	for _, row := range rows {
+		heatmap.Add(time.Weekday(row.Weekday), row.Hour, row.Messages)
+	}
+	return heatmap, nil
+}
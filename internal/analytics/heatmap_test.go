@@ -0,0 +1,102 @@
+package analytics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/cache"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestHeatmap_Add(t *testing.T) {
+	var heatmap Heatmap
+	heatmap.Add(time.Sunday, 23, 2)
+	heatmap.Add(time.Monday, 0, 1)
+	heatmap.Add(time.Monday, 0, 1)
+
+	assert.Equal(t, int64(2), heatmap.Counts[6][23])
+	assert.Equal(t, int64(2), heatmap.Counts[0][0])
+	assert.Equal(t, int64(4), heatmap.Total())
+}
+
+func TestHeatmap_Busiest(t *testing.T) {
+	var heatmap Heatmap
+	heatmap.Add(time.Tuesday, 9, 3)
+	heatmap.Add(time.Sunday, 21, 5)
+
+	day, hour := heatmap.Busiest()
+	assert.Equal(t, time.Sunday, day)
+	assert.Equal(t, 21, hour)
+}
+
+func TestHeatmap_Grid(t *testing.T) {
+	var heatmap Heatmap
+	heatmap.Add(time.Monday, 0, 100)
+	heatmap.Add(time.Monday, 1, 1)
+	heatmap.Add(time.Sunday, 23, 50)
+
+	lines := strings.Split(heatmap.Grid(), "\n")
+	require.Len(t, lines, 8)
+
+	monday := []rune(lines[1])
+	assert.Equal(t, "Mon ", string(monday[:4]))
+	assert.Equal(t, '█', monday[4])
+	assert.Equal(t, '░', monday[5], "any activity is visible")
+	assert.Equal(t, '·', monday[6])
+
+	sunday := []rune(lines[7])
+	assert.Equal(t, "Sun ", string(sunday[:4]))
+	assert.Equal(t, '▒', sunday[27])
+}
+
+func TestHeatmap_HTML(t *testing.T) {
+	var heatmap Heatmap
+	assert.Equal(t, "No recent messages to analyse.", heatmap.HTML(time.UTC))
+
+	heatmap.Add(time.Friday, 18, 7)
+	text := heatmap.HTML(time.UTC)
+	assert.Contains(t, text, "last 7 cached messages (UTC)")
+	assert.Contains(t, text, "<pre>")
+	assert.Contains(t, text, "Busiest: Friday at 18:00")
+}
+
+func TestBuildHeatmap(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+
+	// Sunday 23:30 UTC is Monday 00:30 in Madrid
+	dates := []time.Time{
+		time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC),
+		time.Date(2024, 3, 10, 23, 45, 0, 0, time.UTC),
+		time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC),
+	}
+	for i, date := range dates {
+		require.NoError(t, db.DB.Create(&cache.CacheEntry{
+			ChatID:    -100123,
+			MessageID: int64(i + 1),
+			Date:      date.Unix(),
+			Message:   datatypes.JSON(`{}`),
+		}).Error)
+	}
+	require.NoError(t, db.DB.Create(&cache.CacheEntry{
+		ChatID:    -100999,
+		MessageID: 1,
+		Date:      dates[0].Unix(),
+		Message:   datatypes.JSON(`{}`),
+	}).Error)
+
+	heatmap, err := BuildHeatmap(ctx, db.DB, -100123, madrid)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(3), heatmap.Total())
+	assert.Equal(t, int64(2), heatmap.Counts[0][0], "Monday 00:xx in Madrid")
+	assert.Equal(t, int64(1), heatmap.Counts[2][13], "Wednesday 13:00 in Madrid")
+}
@@ -0,0 +1,238 @@
+// Package api serves an admin HTTP API to manage quotes and check the
+// cache, for tooling and dashboards outside Telegram. Every request needs
+// the configured token as a bearer token.
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultLimit = 20  // Quotes listed when no limit is given
+	maxLimit     = 100 // Most quotes listed at once
+)
+
+// API is the admin HTTP API:
+//
+//	GET    /api/quotes?chat_id=&q=&offset=&limit=  list a chat's quotes, newest first, or those containing q
+//	GET    /api/quotes/{id}                         get a quote
+//	DELETE /api/quotes/{id}                         delete a quote
+//	GET    /api/cache/stats                         cached messages and quote builds
+type API struct {
+	db     *gorm.DB
+	store  *quotes.Store
+	builds *quotes.BuildStats
+	token  string
+	mux    *http.ServeMux
+}
+
+// New creates the API answering requests with token. builds are the quote
+// builds of this replica, shown in the cache stats.
+func New(db *gorm.DB, builds *quotes.BuildStats, token string) *API {
+	a := &API{db: db, store: quotes.NewStore(db), builds: builds, token: token, mux: http.NewServeMux()}
+	a.mux.HandleFunc("GET /api/quotes", a.listQuotes)
+	a.mux.HandleFunc("GET /api/quotes/{id}", a.getQuote)
+	a.mux.HandleFunc("DELETE /api/quotes/{id}", a.deleteQuote)
+	a.mux.HandleFunc("GET /api/cache/stats", a.cacheStats)
+	return a
+}
+
+// WithEvents publishes the deletions made through the API, like those
+// made with /delquote
+func (a *API) WithEvents(publisher events.Publisher) *API {
+	a.store.WithEvents(publisher)
+	return a
+}
+
+// ServeHTTP checks the token and routes the request
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || a.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		writeError(w, http.StatusUnauthorized, "missing or invalid token")
+		return
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+// quoteList is a page of quotes
+type quoteList struct {
+	Quotes []quotes.Quote `json:"quotes"`
+	Total  int64          `json:"total"` // Quotes in the chat, or matching q
+}
+
+func (a *API) listQuotes(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	chatID, err := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "chat_id is required")
+		return
+	}
+	offset, err := intParam(params.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "offset must be a number from 0")
+		return
+	}
+	limit, err := intParam(params.Get("limit"), defaultLimit)
+	if err != nil || limit < 1 || limit > maxLimit {
+		writeError(w, http.StatusBadRequest, "limit must be a number from 1 to 100")
+		return
+	}
+
+	var list quoteList
+	if query := strings.TrimSpace(params.Get("q")); query != "" {
+		if offset > 0 {
+			writeError(w, http.StatusBadRequest, "offset cannot be used with q")
+			return
+		}
+		list.Quotes, list.Total, err = a.store.FindForChat(r.Context(), chatID, query, limit)
+	} else {
+		list.Quotes, list.Total, err = a.store.ListForChat(r.Context(), chatID, offset, limit)
+	}
+	if err != nil {
+		internalError(w, "failed to list quotes", err)
+		return
+	}
+	if list.Quotes == nil {
+		list.Quotes = []quotes.Quote{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (a *API) getQuote(w http.ResponseWriter, r *http.Request) {
+	quote, ok := a.quote(w, r)
+	if ok {
+		writeJSON(w, http.StatusOK, quote)
+	}
+}
+
+func (a *API) deleteQuote(w http.ResponseWriter, r *http.Request) {
+	quote, ok := a.quote(w, r)
+	if !ok {
+		return
+	}
+	if err := a.store.Delete(r.Context(), quote.ID); err != nil {
+		internalError(w, "failed to delete quote", err)
+		return
+	}
+	slog.Info("quote deleted through the API", "audit", true, "chat_id", quote.ChatID, "quote_id", quote.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// quote reads the quote of the request path, answering the request when it
+// does not exist
+func (a *API) quote(w http.ResponseWriter, r *http.Request) (*quotes.Quote, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil || id == 0 {
+		writeError(w, http.StatusBadRequest, "invalid quote id")
+		return nil, false
+	}
+	quote, err := a.store.GetByID(r.Context(), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeError(w, http.StatusNotFound, "quote not found")
+		return nil, false
+	}
+	if err != nil {
+		internalError(w, "failed to get quote", err)
+		return nil, false
+	}
+	return quote, true
+}
+
+// cacheStats is how many messages are cached and how completely the cache
+// covered the quotes built
+type cacheStats struct {
+	Entries int64      `json:"entries"`
+	Chats   int64      `json:"chats"`
+	Oldest  *time.Time `json:"oldest,omitempty"` // Date of the oldest cached message
+	Newest  *time.Time `json:"newest,omitempty"`
+	Builds  buildStats `json:"builds"`
+}
+
+// buildStats are the quote builds of this replica since it started, as
+// /cachestats shows them
+type buildStats struct {
+	Since     time.Time `json:"since"`
+	Full      uint64    `json:"full"`
+	Partial   uint64    `json:"partial"`
+	Truncated uint64    `json:"truncated"`
+	Fallback  uint64    `json:"fallback"`
+}
+
+func (a *API) cacheStats(w http.ResponseWriter, r *http.Request) {
+	var row struct {
+		Entries int64
+		Chats   int64
+		Oldest  *int64
+		Newest  *int64
+	}
+	err := a.db.WithContext(r.Context()).Raw(`
+		SELECT count(*) AS entries, count(DISTINCT chat_id) AS chats, min(date) AS oldest, max(date) AS newest
+		FROM cache_entry`).
+		Scan(&row).Error
+	if err != nil {
+		internalError(w, "failed to read cache stats", err)
+		return
+	}
+
+	counts, since := a.builds.Counts()
+	stats := cacheStats{
+		Entries: row.Entries,
+		Chats:   row.Chats,
+		Oldest:  unixTime(row.Oldest),
+		Newest:  unixTime(row.Newest),
+		Builds: buildStats{
+			Since:     since.UTC(),
+			Full:      counts.Full,
+			Partial:   counts.Partial,
+			Truncated: counts.Truncated,
+			Fallback:  counts.Fallback,
+		},
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// unixTime converts a Unix time from the database, nil when there is none
+func unixTime(seconds *int64) *time.Time {
+	if seconds == nil {
+		return nil
+	}
+	t := time.Unix(*seconds, 0).UTC()
+	return &t
+}
+
+// intParam parses an optional number parameter
+func intParam(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("failed to write API response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// internalError logs a failure and answers with a generic error
+func internalError(w http.ResponseWriter, message string, err error) {
+	slog.Error(message, "error", err)
+	writeError(w, http.StatusInternalServerError, message)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/cache"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// request sends a request to the API with a token, empty for none
+func request(a *API, method, target, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPI_Token(t *testing.T) {
+	a := New(nil, quotes.NewBuildStats(), "secret")
+	for _, token := range []string{"", "wrong", "secret2"} {
+		rec := request(a, http.MethodGet, "/api/cache/stats", token)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, token)
+	}
+
+	// Without a token configured nothing gets through
+	rec := request(New(nil, quotes.NewBuildStats(), ""), http.MethodGet, "/api/cache/stats", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// Bad parameters are turned down before reaching the database
+	rec = request(a, http.MethodGet, "/api/quotes", "secret")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = request(a, http.MethodGet, "/api/quotes?chat_id=1&limit=500", "secret")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = request(a, http.MethodGet, "/api/quotes/abc", "secret")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = request(a, http.MethodPost, "/api/quotes/1", "secret")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestAPI(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+	store := quotes.NewStore(db.DB)
+
+	var ids []uint
+	for _, text := range []string{"good morning", "good night", "hello"} {
+		quote, err := store.Store(ctx, quotes.StoreOptions{
+			ChatID:  -100123,
+			Creator: map[string]interface{}{"id": 1},
+			Entries: []cache.CacheEntry{{Message: datatypes.JSON(`{"text":"` + text + `"}`)}},
+		})
+		require.NoError(t, err)
+		ids = append(ids, quote.ID)
+	}
+	for id := int64(1); id <= 2; id++ {
+		require.NoError(t, db.DB.Create(&cache.CacheEntry{ChatID: -100123, MessageID: id, Date: 1700000000 + id, Message: datatypes.JSON(`{}`)}).Error)
+	}
+
+	a := New(db.DB, quotes.NewBuildStats(), "secret")
+	list := func(target string) quoteList {
+		t.Helper()
+		rec := request(a, http.MethodGet, target, "secret")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var list quoteList
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+		return list
+	}
+
+	page := list("/api/quotes?chat_id=-100123&offset=1&limit=1")
+	assert.Equal(t, int64(3), page.Total)
+	require.Len(t, page.Quotes, 1)
+	assert.Equal(t, ids[1], page.Quotes[0].ID)
+	require.Len(t, page.Quotes[0].Entries, 1)
+
+	found := list("/api/quotes?chat_id=-100123&q=good")
+	assert.Equal(t, int64(2), found.Total)
+
+	empty := list("/api/quotes?chat_id=-100999")
+	assert.NotNil(t, empty.Quotes)
+	assert.Zero(t, empty.Total)
+
+	rec := request(a, http.MethodGet, "/api/cache/stats", "secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var stats cacheStats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	assert.Equal(t, int64(2), stats.Entries)
+	assert.Equal(t, int64(1), stats.Chats)
+	require.NotNil(t, stats.Oldest)
+	assert.Equal(t, int64(1700000001), stats.Oldest.Unix())
+
+	// Deleted quotes are gone from the API
+	target := fmt.Sprintf("/api/quotes/%d", ids[2])
+	rec = request(a, http.MethodDelete, target, "secret")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = request(a, http.MethodGet, target, "secret")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = request(a, http.MethodDelete, target, "secret")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, int64(2), list("/api/quotes?chat_id=-100123").Total)
+}
@@ -0,0 +1,315 @@
+// Package archive reads and writes the versioned JSON export of a chat's
+// quotes (quotes.v1.json). Every quote carries a checksum and the file ends
+// with a manifest, so restores detect truncated or corrupted files. The
+// format is described in docs/export-format.md.
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/quotes"
+	"gorm.io/datatypes"
+)
+
+const (
+	// Format identifies wanon quote archives
+	Format = "wanon.quotes"
+	// Version is the schema version written by this build. Older versions
+	// stay readable.
+	Version = 1
+)
+
+var (
+	// ErrNotArchive is returned for JSON files that are not quote archives
+	ErrNotArchive = errors.New("not a wanon quote archive")
+	// ErrTruncated is returned for archives cut short
+	ErrTruncated = errors.New("archive is truncated")
+	// ErrCorrupted is returned for archives whose checksums do not match
+	ErrCorrupted = errors.New("archive is corrupted")
+)
+
+// FileName is the default name of the archive of a chat
+func FileName(chatID int64) string {
+	return fmt.Sprintf("quotes-%d.v%d.json", chatID, Version)
+}
+
+// Record is a single quote of an archive
+type Record struct {
+	ID        uint              `json:"id"`
+	CreatedAt time.Time         `json:"created_at"`
+	QuotedAt  *time.Time        `json:"quoted_at,omitempty"`
+	Creator   json.RawMessage   `json:"creator"`
+	Entries   []json.RawMessage `json:"entries"` // Telegram messages, in order
+	Checksum  string            `json:"checksum,omitempty"`
+}
+
+// NewRecord builds the record of a stored quote
+func NewRecord(quote *quotes.Quote) (Record, error) {
+	record := Record{
+		ID:        quote.ID,
+		CreatedAt: quote.CreatedAt.UTC(),
+		Creator:   json.RawMessage(quote.Creator),
+		Entries:   make([]json.RawMessage, len(quote.Entries)),
+	}
+	if quote.QuotedAt != nil {
+		at := quote.QuotedAt.UTC()
+		record.QuotedAt = &at
+	}
+	for i, entry := range quote.Entries {
+		record.Entries[i] = json.RawMessage(entry.Message)
+	}
+	sum, err := record.sum()
+	if err != nil {
+		return Record{}, err
+	}
+	record.Checksum = sum
+	return record, nil
+}
+
+// sum is the checksum of the record: the SHA-256 of its compact JSON
+// without the checksum
+func (r Record) sum() (string, error) {
+	r.Checksum = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode quote %d: %w", r.ID, err)
+	}
+	hash := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(hash[:]), nil
+}
+
+// Manifest closes an archive with what it holds
+type Manifest struct {
+	Quotes  int `json:"quotes"`
+	Entries int `json:"entries"`
+	// Checksum is the SHA-256 of the quote checksums, one per line in order
+	Checksum string `json:"checksum"`
+}
+
+// manifestSum accumulates the checksum of the manifest
+type manifestSum struct {
+	manifest Manifest
+	sums     strings.Builder
+}
+
+func (m *manifestSum) add(record Record) {
+	m.manifest.Quotes++
+	m.manifest.Entries += len(record.Entries)
+	m.sums.WriteString(record.Checksum + "\n")
+}
+
+func (m *manifestSum) result() Manifest {
+	hash := sha256.Sum256([]byte(m.sums.String()))
+	manifest := m.manifest
+	manifest.Checksum = "sha256:" + hex.EncodeToString(hash[:])
+	return manifest
+}
+
+// header is the start of an archive
+type header struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ChatID     int64     `json:"chat_id"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// Writer streams quotes into an archive
+type Writer struct {
+	w       io.Writer
+	sum     manifestSum
+	started bool
+}
+
+// NewWriter starts the archive of a chat
+func NewWriter(w io.Writer, chatID int64, exportedAt time.Time) (*Writer, error) {
+	data, err := json.Marshal(header{Format: Format, Version: Version, ChatID: chatID, ExportedAt: exportedAt.UTC()})
+	if err != nil {
+		return nil, err
+	}
+	// Leave the object open for the quotes
+	if _, err := fmt.Fprintf(w, "%s,\n\"quotes\":[", data[:len(data)-1]); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// Write adds a quote to the archive
+func (wr *Writer) Write(quote *quotes.Quote) error {
+	record, err := NewRecord(quote)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode quote %d: %w", quote.ID, err)
+	}
+	sep := ",\n"
+	if !wr.started {
+		sep = "\n"
+		wr.started = true
+	}
+	if _, err := io.WriteString(wr.w, sep+string(data)); err != nil {
+		return err
+	}
+	wr.sum.add(record)
+	return nil
+}
+
+// Close ends the archive with its manifest, which it returns
+func (wr *Writer) Close() (Manifest, error) {
+	manifest := wr.sum.result()
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if _, err := fmt.Fprintf(wr.w, "\n],\n\"manifest\":%s}\n", data); err != nil {
+		return Manifest{}, err
+	}
+	return manifest, nil
+}
+
+// Export writes every quote of a chat into an archive
+func Export(ctx context.Context, w io.Writer, store *quotes.Store, chatID int64, now time.Time) (Manifest, error) {
+	wr, err := NewWriter(w, chatID, now)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err := store.EachForChat(ctx, chatID, 100, wr.Write); err != nil {
+		return Manifest{}, err
+	}
+	return wr.Close()
+}
+
+// Archive is a verified archive
+type Archive struct {
+	Version    int
+	ChatID     int64
+	ExportedAt time.Time
+	Quotes     []Record
+	Manifest   Manifest
+}
+
+// Read reads and verifies an archive: the quote checksums, their count and
+// the manifest checksum must all match
+func Read(r io.Reader) (*Archive, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		return nil, ErrNotArchive
+	}
+	var head header
+	if err := json.Unmarshal(data, &head); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) && syntaxErr.Offset >= int64(len(bytes.TrimRight(data, " \t\r\n"))) {
+			return nil, fmt.Errorf("%w: %v", ErrTruncated, err)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	if head.Format != Format {
+		return nil, ErrNotArchive
+	}
+
+	// Each version keeps its decoder, upgrading its records to the current
+	// ones, so old archives stay importable
+	switch head.Version {
+	case 1:
+		return readV1(data, head)
+	default:
+		return nil, fmt.Errorf("archive version %d is newer than this build supports (%d)", head.Version, Version)
+	}
+}
+
+// readV1 reads version 1 archives
+func readV1(data []byte, head header) (*Archive, error) {
+	var file struct {
+		Quotes   []Record  `json:"quotes"`
+		Manifest *Manifest `json:"manifest"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	if file.Manifest == nil {
+		return nil, fmt.Errorf("%w: no manifest", ErrTruncated)
+	}
+
+	var sum manifestSum
+	for i, record := range file.Quotes {
+		expected, err := record.sum()
+		if err != nil {
+			return nil, err
+		}
+		if record.Checksum != expected {
+			return nil, fmt.Errorf("%w: quote %d (#%d) checksum mismatch", ErrCorrupted, record.ID, i+1)
+		}
+		sum.add(record)
+	}
+	got := sum.result()
+	if got.Quotes != file.Manifest.Quotes || got.Entries != file.Manifest.Entries {
+		return nil, fmt.Errorf("%w: %d quotes and %d entries, the manifest lists %d and %d",
+			ErrTruncated, got.Quotes, got.Entries, file.Manifest.Quotes, file.Manifest.Entries)
+	}
+	if got.Checksum != file.Manifest.Checksum {
+		return nil, fmt.Errorf("%w: manifest checksum mismatch", ErrCorrupted)
+	}
+
+	return &Archive{
+		Version:    head.Version,
+		ChatID:     head.ChatID,
+		ExportedAt: head.ExportedAt,
+		Quotes:     file.Quotes,
+		Manifest:   *file.Manifest,
+	}, nil
+}
+
+// Restore stores the quotes of an archive in a chat. Either every quote is
+// stored or, on error, none is.
+func Restore(ctx context.Context, store *quotes.Store, chatID int64, records []Record) (int, error) {
+	err := store.Transaction(ctx, func(tx *quotes.Store) error {
+		for _, record := range records {
+			opts, err := storeOptions(chatID, record)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Store(ctx, opts); err != nil {
+				return fmt.Errorf("quote %d: %w", record.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// storeOptions turns a record into the options storing it in a chat
+func storeOptions(chatID int64, record Record) (quotes.StoreOptions, error) {
+	var creator map[string]interface{}
+	if err := json.Unmarshal(record.Creator, &creator); err != nil {
+		return quotes.StoreOptions{}, fmt.Errorf("quote %d: invalid creator: %w", record.ID, err)
+	}
+	opts := quotes.StoreOptions{Creator: creator, ChatID: chatID, CreatedAt: record.CreatedAt}
+	for _, entry := range record.Entries {
+		var msg struct {
+			Date int64 `json:"date"`
+		}
+		if err := json.Unmarshal(entry, &msg); err != nil {
+			return quotes.StoreOptions{}, fmt.Errorf("quote %d: invalid entry: %w", record.ID, err)
+		}
+		opts.Entries = append(opts.Entries, quotes.CacheEntry{ChatID: chatID, Date: msg.Date, Message: datatypes.JSON(entry)})
+	}
+	return opts, nil
+}
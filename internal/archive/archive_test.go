@@ -0,0 +1,135 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+var exportedAt = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func testQuote(id uint, texts ...string) *quotes.Quote {
+	quotedAt := time.Date(2024, 5, 1, 22, 14, 0, 0, time.UTC)
+	quote := &quotes.Quote{
+		ID:        id,
+		Creator:   datatypes.JSON(`{"id": 1, "first_name": "Ana"}`),
+		ChatID:    -100123,
+		CreatedAt: quotedAt.Add(time.Hour),
+		QuotedAt:  &quotedAt,
+	}
+	for i, text := range texts {
+		quote.Entries = append(quote.Entries, quotes.QuoteEntry{
+			Order:   i,
+			Message: datatypes.JSON(`{"date": 1714601640, "chat": {"id": -100123}, "from": {"first_name": "Bob"}, "text": "` + text + `"}`),
+		})
+	}
+	return quote
+}
+
+func writeArchive(t *testing.T, quoteList ...*quotes.Quote) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, -100123, exportedAt)
+	require.NoError(t, err)
+	for _, quote := range quoteList {
+		require.NoError(t, w.Write(quote))
+	}
+	_, err = w.Close()
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := writeArchive(t, testQuote(1, "hi", "hello"), testQuote(2, "<b>bye</b>"))
+
+	arch, err := Read(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, Version, arch.Version)
+	assert.Equal(t, int64(-100123), arch.ChatID)
+	assert.Equal(t, exportedAt, arch.ExportedAt)
+	assert.Equal(t, 2, arch.Manifest.Quotes)
+	assert.Equal(t, 3, arch.Manifest.Entries)
+	require.Len(t, arch.Quotes, 2)
+	assert.Equal(t, uint(2), arch.Quotes[1].ID)
+	assert.True(t, strings.HasPrefix(arch.Quotes[0].Checksum, "sha256:"))
+
+	// Reformatting the JSON keeps the checksums valid
+	var indented bytes.Buffer
+	require.NoError(t, json.Indent(&indented, data, "", "  "))
+	_, err = Read(&indented)
+	assert.NoError(t, err)
+
+	// Empty chats have a manifest too
+	arch, err = Read(bytes.NewReader(writeArchive(t)))
+	require.NoError(t, err)
+	assert.Empty(t, arch.Quotes)
+}
+
+func TestRead_Truncated(t *testing.T) {
+	data := writeArchive(t, testQuote(1, "hi"), testQuote(2, "bye"))
+
+	_, err := Read(bytes.NewReader(data[:len(data)/2]))
+	assert.ErrorIs(t, err, ErrTruncated)
+
+	// Dropping a quote from a well-formed file breaks the manifest
+	lines := strings.Split(string(data), "\n")
+	require.True(t, strings.HasPrefix(lines[2], `{"id":1,`))
+	_, err = Read(strings.NewReader(strings.Replace(string(data), lines[2]+"\n", "", 1)))
+	assert.ErrorIs(t, err, ErrTruncated)
+
+	// So does losing the manifest
+	withoutManifest := string(data[:bytes.LastIndex(data, []byte(`,`+"\n"+`"manifest"`))]) + "}"
+	_, err = Read(strings.NewReader(withoutManifest))
+	assert.ErrorIs(t, err, ErrTruncated)
+}
+
+func TestRead_Corrupted(t *testing.T) {
+	data := writeArchive(t, testQuote(1, "hi"))
+
+	_, err := Read(bytes.NewReader(bytes.Replace(data, []byte(`hi`), []byte(`ho`), 1)))
+	assert.ErrorIs(t, err, ErrCorrupted)
+}
+
+func TestRead_Versions(t *testing.T) {
+	_, err := Read(strings.NewReader(`{"format": "wanon.quotes", "version": 2}`))
+	assert.ErrorContains(t, err, "version 2 is newer")
+
+	_, err = Read(strings.NewReader(`{"quotes": []}`))
+	assert.ErrorIs(t, err, ErrNotArchive)
+
+	_, err = Read(strings.NewReader(`author,text`))
+	assert.ErrorIs(t, err, ErrNotArchive)
+}
+
+func TestRestore(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+	store := quotes.NewStore(db.DB)
+
+	arch, err := Read(bytes.NewReader(writeArchive(t, testQuote(1, "hi", "hello"), testQuote(2, "bye"))))
+	require.NoError(t, err)
+
+	restored, err := Restore(ctx, store, -100999, arch.Quotes)
+	require.NoError(t, err)
+	assert.Equal(t, 2, restored)
+
+	// The restored chat exports the same quotes
+	var buf bytes.Buffer
+	manifest, err := Export(ctx, &buf, store, -100999, exportedAt)
+	require.NoError(t, err)
+	assert.Equal(t, 2, manifest.Quotes)
+	assert.Equal(t, 3, manifest.Entries)
+	again, err := Read(&buf)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(arch.Quotes[0].Entries[1]), string(again.Quotes[0].Entries[1]))
+	assert.Equal(t, arch.Quotes[0].CreatedAt, again.Quotes[0].CreatedAt)
+}
@@ -0,0 +1,217 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"gorm.io/gorm"
+)
+
+// ExportClient is the part of the Bot API /myexport uses; *bot.Bot
+// implements it
+type ExportClient interface {
+	outbox.Sender
+	telegram.MemberClient
+	telegram.DocumentClient
+	GetChat(ctx context.Context, params *bot.GetChatParams) (*models.ChatFullInfo, error)
+}
+
+// MyExportHandler handles the /myexport command
+type MyExportHandler struct {
+	store  *quotes.Store
+	outbox *outbox.Outbox
+}
+
+// NewMyExportHandler creates a new myexport handler
+func NewMyExportHandler(db *gorm.DB) *MyExportHandler {
+	return &MyExportHandler{store: quotes.NewStore(db), outbox: outbox.New(db)}
+}
+
+// WithCreatorPolicy matches creators stored as a hash with the policy key
+func (h *MyExportHandler) WithCreatorPolicy(policy quotes.CreatorPolicy) *MyExportHandler {
+	h.store.WithCreatorPolicy(policy)
+	return h
+}
+
+// Handle processes /myexport [json|text] in a private chat
+func (h *MyExportHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	return h.handle(ctx, b, update)
+}
+
+// handle replies with the quotes the sender added or appears in, from
+// every chat they still share with the bot
+func (h *MyExportHandler) handle(ctx context.Context, client ExportClient, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID, userID := msg.Chat.ID, msg.From.ID
+	if msg.Chat.Type != models.ChatTypePrivate {
+		_, err := h.outbox.Send(ctx, client, &outbox.Message{
+			ChatID: chatID, Text: "Send /myexport to me in a private chat.", Transient: true,
+		})
+		return err
+	}
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	format := strings.ToLower(args.Arg(0))
+	if format != "" && format != "json" && format != "text" {
+		return h.reply(ctx, client, chatID, "Usage: /myexport [json|text]")
+	}
+	slog.Info("executing /myexport command", "audit", true, "user_id", userID, "format", format)
+
+	chats, err := h.sharedChats(ctx, client, userID)
+	if err != nil {
+		return err
+	}
+	if len(chats) == 0 {
+		return h.reply(ctx, client, chatID, "You have no quotes in the chats we share.")
+	}
+
+	var buf bytes.Buffer
+	var count int
+	name := fmt.Sprintf("myquotes-%d.v%d.json", userID, Version)
+	if format == "text" {
+		name = fmt.Sprintf("myquotes-%d.txt", userID)
+		count, err = ExportUserText(ctx, &buf, h.store, userID, chats)
+	} else {
+		count, err = ExportUser(ctx, &buf, h.store, userID, chats, time.Now())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to export quotes of user: %w", err)
+	}
+
+	_, err = client.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID:   chatID,
+		Document: &models.InputFileUpload{Filename: name, Data: &buf},
+		Caption:  fmt.Sprintf("%d quote(s) from %d chat(s)", count, len(chats)),
+	})
+	return err
+}
+
+// sharedChats returns the chats with quotes of the user that the user is
+// still a member of. Chats the bot cannot see any more are left out.
+func (h *MyExportHandler) sharedChats(ctx context.Context, client ExportClient, userID int64) ([]Chat, error) {
+	ids, err := h.store.UserChats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var chats []Chat
+	for _, id := range ids {
+		member, err := telegram.IsChatMember(ctx, client, id, userID)
+		if err != nil {
+			slog.Warn("cannot check chat membership for /myexport", "chat_id", id, "user_id", userID, "error", err)
+			continue
+		}
+		if !member {
+			continue
+		}
+		chat := Chat{ID: id}
+		if info, err := client.GetChat(ctx, &bot.GetChatParams{ChatID: id}); err == nil {
+			chat.Title = info.Title
+		}
+		chats = append(chats, chat)
+	}
+	return chats, nil
+}
+
+// reply answers in the private chat
+func (h *MyExportHandler) reply(ctx context.Context, client ExportClient, chatID int64, text string) error {
+	_, err := h.outbox.Send(ctx, client, &outbox.Message{ChatID: chatID, Text: text})
+	return err
+}
+
+// Command returns the command name
+func (h *MyExportHandler) Command() string {
+	return "/myexport"
+}
+
+// Description returns the command description
+func (h *MyExportHandler) Description() string {
+	return "Get the quotes you added or appear in, in a private chat"
+}
+
+// ExportQuotesHandler handles the /exportquotes admin command
+type ExportQuotesHandler struct {
+	store  *quotes.Store
+	outbox *outbox.Outbox
+	admins *telegram.AdminService
+}
+
+// NewExportQuotesHandler creates a new exportquotes handler
+func NewExportQuotesHandler(db *gorm.DB) *ExportQuotesHandler {
+	return &ExportQuotesHandler{store: quotes.NewStore(db), outbox: outbox.New(db)}
+}
+
+// WithAdmins checks admins against a shared cache of chat administrators
+func (h *ExportQuotesHandler) WithAdmins(admins *telegram.AdminService) *ExportQuotesHandler {
+	h.admins = admins
+	return h
+}
+
+// Handle processes the /exportquotes command, replying with the archive of
+// the chat quotes that wanon import --format wanon restores
+func (h *ExportQuotesHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	slog.Info("executing /exportquotes command", "audit", true, "chat_id", chatID, "user_id", msg.From.ID)
+
+	admin, err := h.admins.IsSenderAdmin(ctx, b, msg)
+	var refused *telegram.OriginError
+	if errors.As(err, &refused) {
+		return h.reply(ctx, b, chatID, refused.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return h.reply(ctx, b, chatID, "Only chat administrators can export the quotes.")
+	}
+
+	var buf bytes.Buffer
+	manifest, err := Export(ctx, &buf, h.store, chatID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to export quotes: %w", err)
+	}
+	if manifest.Quotes == 0 {
+		return h.reply(ctx, b, chatID, "There are no quotes to export yet.")
+	}
+
+	_, err = b.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID:   chatID,
+		Document: &models.InputFileUpload{Filename: FileName(chatID), Data: &buf},
+		Caption:  fmt.Sprintf("%d quote(s), %d message(s)", manifest.Quotes, manifest.Entries),
+	})
+	return err
+}
+
+// reply answers in the chat
+func (h *ExportQuotesHandler) reply(ctx context.Context, b *bot.Bot, chatID int64, text string) error {
+	_, err := h.outbox.Send(ctx, b, &outbox.Message{ChatID: chatID, Text: text})
+	return err
+}
+
+// Command returns the command name
+func (h *ExportQuotesHandler) Command() string {
+	return "/exportquotes"
+}
+
+// Description returns the command description
+func (h *ExportQuotesHandler) Description() string {
+	return "Export the chat quotes as a JSON archive for backups (admins only)"
+}
@@ -0,0 +1,39 @@
+package archive
+
+import (
+	"context"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestExportQuotesHandler_Handle(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	const chatID = -100123
+	h.Register(NewExportQuotesHandler(h.DB.DB))
+
+	h.SendText(chatID, "/exportquotes")
+	assert.Equal(t, "Only chat administrators can export the quotes.", h.LastReply())
+
+	h.SetAdmin(chatID, h.User.ID)
+	h.SendText(chatID, "/exportquotes")
+	assert.Equal(t, "There are no quotes to export yet.", h.LastReply())
+
+	_, err := quotes.NewStore(h.DB.DB).Store(context.Background(), quotes.StoreOptions{
+		ChatID:  chatID,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []quotes.CacheEntry{
+			{Message: datatypes.JSON(`{"text":"first"}`)},
+			{Message: datatypes.JSON(`{"text":"second"}`)},
+		},
+	})
+	require.NoError(t, err)
+	h.SendText(chatID, "/exportquotes")
+	documents := h.Requests("sendDocument")
+	require.Len(t, documents, 1)
+	assert.Equal(t, "1 quote(s), 2 message(s)", documents[0].Params["caption"])
+}
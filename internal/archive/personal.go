@@ -0,0 +1,101 @@
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/quotes"
+)
+
+// PersonalFormat identifies the personal collections of /myexport
+const PersonalFormat = "wanon.myquotes"
+
+// Chat is a chat of a personal collection
+type Chat struct {
+	ID    int64
+	Title string
+}
+
+// personalHeader is the start of a personal collection
+type personalHeader struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	UserID     int64     `json:"user_id"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// ExportUser writes the quotes a user added or appears in as a personal
+// collection: a regular archive per chat, each restorable on its own. It
+// returns how many quotes were written.
+func ExportUser(ctx context.Context, w io.Writer, store *quotes.Store, userID int64, chats []Chat, now time.Time) (int, error) {
+	data, err := json.Marshal(personalHeader{Format: PersonalFormat, Version: Version, UserID: userID, ExportedAt: now.UTC()})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := fmt.Fprintf(w, "%s,\n\"archives\":[", data[:len(data)-1]); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for i, chat := range chats {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return 0, err
+			}
+		}
+		wr, err := NewWriter(w, chat.ID, now)
+		if err != nil {
+			return 0, err
+		}
+		if err := store.EachForUser(ctx, chat.ID, userID, 100, wr.Write); err != nil {
+			return 0, err
+		}
+		manifest, err := wr.Close()
+		if err != nil {
+			return 0, err
+		}
+		total += manifest.Quotes
+	}
+
+	if _, err := io.WriteString(w, "]}\n"); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// ExportUserText writes the quotes a user added or appears in as plain
+// text, a section per chat. It returns how many quotes were written.
+func ExportUserText(ctx context.Context, w io.Writer, store *quotes.Store, userID int64, chats []Chat) (int, error) {
+	renderer := quotes.NewRenderer()
+	total := 0
+	for i, chat := range chats {
+		title := chat.Title
+		if title == "" {
+			title = fmt.Sprintf("Chat %d", chat.ID)
+		}
+		heading := title + "\n" + strings.Repeat("=", len([]rune(title))) + "\n"
+		if i > 0 {
+			heading = "\n" + heading
+		}
+		if _, err := io.WriteString(w, heading); err != nil {
+			return 0, err
+		}
+		err := store.EachForUser(ctx, chat.ID, userID, 100, func(quote *quotes.Quote) error {
+			text, err := renderer.RenderWithDate(quote)
+			if err != nil {
+				return fmt.Errorf("failed to render quote %d: %w", quote.ID, err)
+			}
+			total++
+			_, err = io.WriteString(w, "\n"+text+"\n")
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
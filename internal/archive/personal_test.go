@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestExportUser(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+	store := quotes.NewStore(db.DB)
+
+	add := func(chatID, creatorID, authorID int64, text string) {
+		_, err := store.Store(ctx, quotes.StoreOptions{
+			Creator: map[string]interface{}{"id": creatorID, "first_name": "Creator"},
+			ChatID:  chatID,
+			Entries: []quotes.CacheEntry{{
+				ChatID: chatID,
+				Date:   1714601640,
+				Message: datatypes.JSON(fmt.Sprintf(
+					`{"date": 1714601640, "chat": {"id": %d}, "from": {"id": %d, "first_name": "Author"}, "text": %q}`,
+					chatID, authorID, text)),
+			}},
+		})
+		require.NoError(t, err)
+	}
+	add(-100123, 7, 2, "added by the user")
+	add(-100123, 2, 7, "said by the user")
+	add(-100123, 2, 3, "someone else's")
+	add(-100456, 2, 7, "said elsewhere")
+	add(-100789, 2, 3, "not the user's chat")
+
+	chatIDs, err := store.UserChats(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{-100456, -100123}, chatIDs)
+
+	chats := []Chat{{ID: -100123, Title: "Friends"}, {ID: -100456}}
+	var buf bytes.Buffer
+	count, err := ExportUser(ctx, &buf, store, 7, chats, exportedAt)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	// Each chat is a regular archive
+	var collection struct {
+		Format   string            `json:"format"`
+		UserID   int64             `json:"user_id"`
+		Archives []json.RawMessage `json:"archives"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &collection))
+	assert.Equal(t, PersonalFormat, collection.Format)
+	assert.Equal(t, int64(7), collection.UserID)
+	require.Len(t, collection.Archives, 2)
+	arch, err := Read(bytes.NewReader(collection.Archives[0]))
+	require.NoError(t, err)
+	assert.Equal(t, int64(-100123), arch.ChatID)
+	assert.Equal(t, 2, arch.Manifest.Quotes)
+
+	buf.Reset()
+	count, err = ExportUserText(ctx, &buf, store, 7, chats)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Contains(t, buf.String(), "Friends\n=======\n")
+	assert.Contains(t, buf.String(), "Chat -100456\n")
+	assert.Contains(t, buf.String(), "said elsewhere")
+	assert.NotContains(t, buf.String(), "someone else's")
+}
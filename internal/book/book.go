@@ -0,0 +1,203 @@
+// Package book typesets the quotes of a chat into a printable PDF.
+package book
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Font files looked up in Options.FontDir
+const (
+	regularFontFile = "DejaVuSerif.ttf"
+	boldFontFile    = "DejaVuSerif-Bold.ttf"
+)
+
+// batchSize is the number of quotes loaded from the database at a time
+const batchSize = 200
+
+// Page layout, in millimetres
+const (
+	margin     = 20.0
+	lineHeight = 5.5
+	// minQuoteSpace is the room left on a page below which the next quote
+	// starts on a new page instead of being split
+	minQuoteSpace = 35.0
+)
+
+// Options configures a quote book
+type Options struct {
+	Title    string
+	FontDir  string          // Directory with DejaVu fonts, empty for built-in fonts
+	Location *time.Location  // Time zone used for chapters and dates, UTC if nil
+	Layout   string          // Date layout, quotes.DefaultDateLayout if empty
+	Authors  *quotes.Authors // Chat nicknames shown instead of Telegram names
+}
+
+// Book is a quote book being typeset. Quotes must be added in chronological
+// order; each year starts a new chapter.
+type Book struct {
+	pdf      *gofpdf.Fpdf
+	renderer *quotes.Renderer
+	opts     Options
+	font     string
+	tr       func(string) string
+	year     int
+	quotes   int
+}
+
+// New creates an empty book with its cover page
+func New(opts Options) (*Book, error) {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if opts.Layout == "" {
+		opts.Layout = quotes.DefaultDateLayout
+	}
+
+	pdf := gofpdf.New("P", "mm", "A5", opts.FontDir)
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin)
+	pdf.SetTitle(opts.Title, true)
+	pdf.SetCreator("wanon", true)
+	pdf.AliasNbPages("")
+
+	b := &Book{
+		pdf:      pdf,
+		renderer: quotes.NewRenderer(),
+		opts:     opts,
+		font:     "Times",
+		tr:       pdf.UnicodeTranslatorFromDescriptor(""),
+	}
+
+	if opts.FontDir != "" {
+		pdf.AddUTF8Font("DejaVuSerif", "", regularFontFile)
+		pdf.AddUTF8Font("DejaVuSerif", "B", boldFontFile)
+		if err := pdf.Error(); err != nil {
+			return nil, fmt.Errorf("failed to load fonts from %s: %w", opts.FontDir, err)
+		}
+		b.font = "DejaVuSerif"
+		b.tr = func(s string) string { return s }
+	}
+
+	pdf.SetFooterFunc(b.footer)
+	b.cover()
+
+	return b, pdf.Error()
+}
+
+// cover typesets the title page
+func (b *Book) cover() {
+	b.pdf.AddPage()
+	_, pageHeight := b.pdf.GetPageSize()
+	b.pdf.SetY(pageHeight / 3)
+	b.pdf.SetFont(b.font, "B", 24)
+	b.pdf.MultiCell(0, 12, b.tr(b.opts.Title), "", "C", false)
+}
+
+// footer prints the page number on every page but the cover
+func (b *Book) footer() {
+	if b.pdf.PageNo() == 1 {
+		return
+	}
+	b.pdf.SetY(-margin + 5)
+	b.pdf.SetFont(b.font, "", 8)
+	b.pdf.SetTextColor(128, 128, 128)
+	b.pdf.CellFormat(0, 5, strconv.Itoa(b.pdf.PageNo()), "", 0, "C", false, 0, "")
+	b.pdf.SetTextColor(0, 0, 0)
+}
+
+// chapter starts a new chapter for the given year
+func (b *Book) chapter(year int) {
+	b.year = year
+	title := strconv.Itoa(year)
+
+	b.pdf.AddPage()
+	b.pdf.Bookmark(title, 0, -1)
+	b.pdf.SetFont(b.font, "B", 20)
+	b.pdf.CellFormat(0, 14, title, "B", 1, "L", false, 0, "")
+	b.pdf.Ln(6)
+}
+
+// AddQuote typesets a quote, starting a new chapter when its year changes
+func (b *Book) AddQuote(quote *quotes.Quote) error {
+	entries, err := b.renderer.Entries(quote, b.opts.Authors)
+	if err != nil {
+		return fmt.Errorf("failed to render quote %d: %w", quote.ID, err)
+	}
+
+	created := quote.CreatedAt.In(b.opts.Location)
+	if created.Year() != b.year {
+		b.chapter(created.Year())
+	} else {
+		_, pageHeight := b.pdf.GetPageSize()
+		if b.pdf.GetY() > pageHeight-margin-minQuoteSpace {
+			b.pdf.AddPage()
+		}
+	}
+
+	// Quote header: number and date
+	b.pdf.SetFont(b.font, "", 8)
+	b.pdf.SetTextColor(128, 128, 128)
+	header := fmt.Sprintf("#%d · %s", quote.ID, created.Format(b.opts.Layout))
+	b.pdf.CellFormat(0, lineHeight, b.tr(header), "", 1, "L", false, 0, "")
+	b.pdf.SetTextColor(0, 0, 0)
+
+	for _, entry := range entries {
+		b.pdf.SetFont(b.font, "B", 11)
+		b.pdf.Write(lineHeight, b.tr(entry.Author+": "))
+		b.pdf.SetFont(b.font, "", 11)
+		b.pdf.Write(lineHeight, b.tr(entry.Text))
+		b.pdf.Ln(lineHeight)
+	}
+	b.pdf.Ln(lineHeight)
+
+	b.quotes++
+	return b.pdf.Error()
+}
+
+// Quotes returns the number of quotes added to the book
+func (b *Book) Quotes() int {
+	return b.quotes
+}
+
+// Pages returns the number of pages typeset so far
+func (b *Book) Pages() int {
+	return b.pdf.PageCount()
+}
+
+// Output writes the finished PDF to w
+func (b *Book) Output(w io.Writer) error {
+	if b.quotes == 0 {
+		b.pdf.AddPage()
+		b.pdf.SetFont(b.font, "", 11)
+		b.pdf.MultiCell(0, lineHeight, b.tr("This chat has no quotes yet."), "", "C", false)
+	}
+	if err := b.pdf.Output(w); err != nil {
+		return fmt.Errorf("failed to write PDF: %w", err)
+	}
+	return nil
+}
+
+// Export typesets every quote of a chat and writes the PDF to w.
+// Quotes are loaded in batches, oldest first.
+func Export(ctx context.Context, w io.Writer, store *quotes.Store, chatID int64, opts Options) (*Book, error) {
+	b, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.EachForChat(ctx, chatID, batchSize, b.AddQuote); err != nil {
+		return nil, err
+	}
+
+	if err := b.Output(w); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,101 @@
+package book
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// quoteAt builds a quote with a single entry created at the given time
+func quoteAt(id uint, created time.Time, text string) *quotes.Quote {
+	message := fmt.Sprintf(`{"text":%q,"date":%d,"from":{"id":1,"first_name":"José"}}`, text, created.Unix())
+	return &quotes.Quote{
+		ID:        id,
+		ChatID:    -100123,
+		CreatedAt: created,
+		Entries:   []quotes.QuoteEntry{{Message: datatypes.JSON(message)}},
+	}
+}
+
+func TestBook_ChaptersByYear(t *testing.T) {
+	b, err := New(Options{Title: "Our quotes"})
+	require.NoError(t, err)
+
+	require.NoError(t, b.AddQuote(quoteAt(1, time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC), "first")))
+	require.NoError(t, b.AddQuote(quoteAt(2, time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC), "second")))
+	require.NoError(t, b.AddQuote(quoteAt(3, time.Date(2021, 1, 5, 10, 0, 0, 0, time.UTC), "ñandú")))
+
+	var buf bytes.Buffer
+	require.NoError(t, b.Output(&buf))
+
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+	assert.Equal(t, 3, b.Quotes())
+	// Cover plus one chapter per year
+	assert.Equal(t, 3, b.Pages())
+	assert.Contains(t, buf.String(), "/Title (2019)")
+	assert.Contains(t, buf.String(), "/Title (2021)")
+}
+
+func TestBook_ChaptersUseLocation(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+
+	b, err := New(Options{Title: "Quotes", Location: madrid})
+	require.NoError(t, err)
+
+	// Still 2019 in UTC, already 2020 in Madrid
+	require.NoError(t, b.AddQuote(quoteAt(1, time.Date(2019, 12, 31, 23, 30, 0, 0, time.UTC), "happy new year")))
+	assert.Equal(t, 2020, b.year)
+}
+
+func TestBook_PaginatesLongChapters(t *testing.T) {
+	b, err := New(Options{Title: "Quotes"})
+	require.NoError(t, err)
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 60; i++ {
+		require.NoError(t, b.AddQuote(quoteAt(uint(i+1), start.Add(time.Duration(i)*time.Hour), "a reasonably long line of text that should wrap at least once on an A5 page")))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, b.Output(&buf))
+	assert.Greater(t, b.Pages(), 5)
+}
+
+func TestBook_Empty(t *testing.T) {
+	b, err := New(Options{Title: "Quotes"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, b.Output(&buf))
+	assert.Equal(t, 0, b.Quotes())
+	assert.Equal(t, 2, b.Pages())
+}
+
+func TestNew_MissingFonts(t *testing.T) {
+	_, err := New(Options{Title: "Quotes", FontDir: t.TempDir()})
+	assert.Error(t, err)
+}
+
+func TestNew_UnicodeFonts(t *testing.T) {
+	fontDir := "/usr/share/fonts/truetype/dejavu"
+	if _, err := os.Stat(filepath.Join(fontDir, regularFontFile)); err != nil {
+		t.Skip("DejaVu fonts not installed")
+	}
+
+	b, err := New(Options{Title: "Цитаты", FontDir: fontDir})
+	require.NoError(t, err)
+	require.NoError(t, b.AddQuote(quoteAt(1, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), "Привет, мир")))
+
+	var buf bytes.Buffer
+	require.NoError(t, b.Output(&buf))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")))
+}
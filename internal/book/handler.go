@@ -0,0 +1,124 @@
+package book
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/settings"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"gorm.io/gorm"
+)
+
+// Handler handles the /exportpdf admin command
+type Handler struct {
+	db       *gorm.DB
+	store    *quotes.Store
+	settings *settings.Service
+	outbox   *outbox.Outbox
+	admins   *telegram.AdminService
+	fontDir  string
+}
+
+// NewHandler creates a new exportpdf handler
+func NewHandler(db *gorm.DB, fontDir string) *Handler {
+	return &Handler{
+		db:       db,
+		store:    quotes.NewStore(db),
+		settings: settings.NewService(db),
+		outbox:   outbox.New(db),
+		fontDir:  fontDir,
+	}
+}
+
+// WithAdmins checks admins against a shared cache of chat administrators
+func (h *Handler) WithAdmins(admins *telegram.AdminService) *Handler {
+	h.admins = admins
+	return h
+}
+
+// Handle processes the /exportpdf command, replying with the quote book of
+// the chat as a document
+func (h *Handler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	slog.Info("executing /exportpdf command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	admin, err := h.admins.IsSenderAdmin(ctx, b, msg)
+	var refused *telegram.OriginError
+	if errors.As(err, &refused) {
+		_, err := h.outbox.Send(ctx, b, &outbox.Message{ChatID: chatID, Text: refused.Error()})
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		_, err := h.outbox.Send(ctx, b, &outbox.Message{
+			ChatID: chatID,
+			Text:   "Only chat administrators can export the quote book.",
+		})
+		return err
+	}
+
+	cs, err := h.settings.Get(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	title := msg.Chat.Title
+	if title == "" {
+		title = "Quotes"
+	}
+
+	opts := OptionsFor(cs, title, h.fontDir, msg.From.LanguageCode)
+	if opts.Authors, err = quotes.LoadAuthors(ctx, h.db, chatID); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	book, err := Export(ctx, &buf, h.store, chatID, opts)
+	if err != nil {
+		return fmt.Errorf("failed to export quote book: %w", err)
+	}
+
+	_, err = b.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID: chatID,
+		Document: &models.InputFileUpload{
+			Filename: fmt.Sprintf("quotes-%d.pdf", chatID),
+			Data:     &buf,
+		},
+		Caption: fmt.Sprintf("%d quote(s), %d page(s)", book.Quotes(), book.Pages()),
+	})
+	return err
+}
+
+// OptionsFor builds book options following the chat date settings
+func OptionsFor(cs *settings.ChatSettings, title, fontDir, fallbackLanguage string) Options {
+	return Options{
+		Title:    title,
+		FontDir:  fontDir,
+		Location: cs.Location(fallbackLanguage),
+		Layout:   cs.Layout(fallbackLanguage),
+	}
+}
+
+// Command returns the command name
+func (h *Handler) Command() string {
+	return "/exportpdf"
+}
+
+// Description returns the command description
+func (h *Handler) Description() string {
+	return "Export the chat quotes as a PDF book (admins only)"
+}
@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Args holds a command invocation split into its parts
+type Args struct {
+	Command string   // Command name without the leading slash, e.g. "settings"
+	Mention string   // Bot username the command was addressed to, if any
+	Raw     string   // Text after the command, with surrounding spaces trimmed
+	Fields  []string // Raw split into arguments, honouring quotes
+
+	// offsets[i] is where Fields[i] starts in Raw
+	offsets []int
+}
+
+// ParseArgs splits a command message such as `/cmd@bot one "two three"`.
+// Arguments are separated by spaces; single, double or typographic quotes
+// group words and a backslash escapes the next character. It returns false
+// when text is not a command.
+func ParseArgs(text string) (Args, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return Args{}, false
+	}
+
+	head, rest, _ := strings.Cut(text[1:], " ")
+	if i := strings.IndexAny(head, "\n\t"); i >= 0 {
+		rest = head[i:] + " " + rest
+		head = head[:i]
+	}
+	name, mention, _ := strings.Cut(head, "@")
+	if name == "" {
+		return Args{}, false
+	}
+
+	args := Args{
+		Command: name,
+		Mention: mention,
+		Raw:     strings.TrimSpace(rest),
+	}
+	args.Fields, args.offsets = splitArgs(args.Raw)
+	return args, true
+}
+
+// Len returns the number of arguments
+func (a Args) Len() int {
+	return len(a.Fields)
+}
+
+// Arg returns the i-th argument, or "" if there are fewer arguments
+func (a Args) Arg(i int) string {
+	if i < 0 || i >= len(a.Fields) {
+		return ""
+	}
+	return a.Fields[i]
+}
+
+// Rest returns the raw text starting at the i-th argument, keeping its
+// original spacing and quotes. It is meant for free text values such as
+// `/settings dateformat Jan 2, 2006`.
+func (a Args) Rest(i int) string {
+	if i < 0 || i >= len(a.offsets) {
+		return ""
+	}
+	return a.Raw[a.offsets[i]:]
+}
+
+// Exclusions are the negative filters among the arguments of a command,
+// such as the `-#nsfw -@bob` of `/rquote -#nsfw -@bob`
+type Exclusions struct {
+	Tags    []string // Hashtags to leave out, without the #
+	Authors []string // Usernames to leave out, without the @
+}
+
+// IsEmpty reports whether nothing is excluded
+func (e Exclusions) IsEmpty() bool {
+	return len(e.Tags) == 0 && len(e.Authors) == 0
+}
+
+// Exclusions returns the arguments of the form -#tag and -@user, and the
+// other arguments in order
+func (a Args) Exclusions() (Exclusions, []string) {
+	var exclusions Exclusions
+	var rest []string
+	for _, field := range a.Fields {
+		switch {
+		case strings.HasPrefix(field, "-#") && len(field) > 2:
+			exclusions.Tags = append(exclusions.Tags, field[2:])
+		case strings.HasPrefix(field, "-@") && len(field) > 2:
+			exclusions.Authors = append(exclusions.Authors, field[2:])
+		default:
+			rest = append(rest, field)
+		}
+	}
+	return exclusions, rest
+}
+
+// closingQuotes maps each opening quote to the quote that closes it
+var closingQuotes = map[rune]rune{
+	'"':  '"',
+	'\'': '\'',
+	'“':  '”',
+	'‘':  '’',
+	'«':  '»',
+}
+
+// splitArgs splits text into arguments and records where each one starts
+func splitArgs(text string) ([]string, []int) {
+	var fields []string
+	var offsets []int
+	var current strings.Builder
+	inField := false
+	var closing rune // Closing quote being waited for, 0 outside quotes
+	escaped := false
+
+	for i, c := range text {
+		switch {
+		case escaped:
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case closing != 0:
+			if c == closing {
+				closing = 0
+			} else {
+				current.WriteRune(c)
+			}
+			continue
+		case unicode.IsSpace(c):
+			if inField {
+				fields = append(fields, current.String())
+				current.Reset()
+				inField = false
+			}
+			continue
+		case !inField && closingQuotes[c] != 0:
+			// Quotes only group words at the start of an argument, so
+			// apostrophes such as in "don't" are kept
+			closing = closingQuotes[c]
+		default:
+			current.WriteRune(c)
+		}
+		if !inField {
+			offsets = append(offsets, i)
+			inField = true
+		}
+	}
+	if escaped {
+		current.WriteRune('\\')
+	}
+	if inField {
+		fields = append(fields, current.String())
+	}
+	return fields, offsets
+}
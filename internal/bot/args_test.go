@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		ok       bool
+		command  string
+		mention  string
+		raw      string
+		fields   []string
+		restFrom int
+		rest     string
+	}{
+		{
+			name:    "no arguments",
+			text:    "/rquote",
+			ok:      true,
+			command: "rquote",
+		},
+		{
+			name:    "bot mention",
+			text:    "/rquote@wanonbot",
+			ok:      true,
+			command: "rquote",
+			mention: "wanonbot",
+		},
+		{
+			name:     "plain arguments",
+			text:     "/settings  timezone   Europe/Madrid ",
+			ok:       true,
+			command:  "settings",
+			raw:      "timezone   Europe/Madrid",
+			fields:   []string{"timezone", "Europe/Madrid"},
+			restFrom: 1,
+			rest:     "Europe/Madrid",
+		},
+		{
+			name:     "quoted arguments",
+			text:     `/purgequotes author:@bob "two words" 'single quoted' “smart quotes”`,
+			ok:       true,
+			command:  "purgequotes",
+			raw:      `author:@bob "two words" 'single quoted' “smart quotes”`,
+			fields:   []string{"author:@bob", "two words", "single quoted", "smart quotes"},
+			restFrom: 2,
+			rest:     `'single quoted' “smart quotes”`,
+		},
+		{
+			name:    "apostrophes inside words",
+			text:    "/addnote don't panic",
+			ok:      true,
+			command: "addnote",
+			raw:     "don't panic",
+			fields:  []string{"don't", "panic"},
+		},
+		{
+			name:    "escapes",
+			text:    `/say a\ b "quote \" inside"`,
+			ok:      true,
+			command: "say",
+			raw:     `a\ b "quote \" inside"`,
+			fields:  []string{"a b", `quote " inside`},
+		},
+		{
+			name:    "unterminated quote",
+			text:    `/say "open ended`,
+			ok:      true,
+			command: "say",
+			raw:     `"open ended`,
+			fields:  []string{"open ended"},
+		},
+		{
+			name:    "newline after command",
+			text:    "/say\nhello there",
+			ok:      true,
+			command: "say",
+			raw:     "hello there",
+			fields:  []string{"hello", "there"},
+		},
+		{name: "not a command", text: "hello /world"},
+		{name: "bare slash", text: "/"},
+		{name: "empty", text: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, ok := ParseArgs(tt.text)
+			assert.Equal(t, tt.ok, ok)
+			if !ok {
+				return
+			}
+			assert.Equal(t, tt.command, args.Command)
+			assert.Equal(t, tt.mention, args.Mention)
+			assert.Equal(t, tt.raw, args.Raw)
+			assert.Equal(t, tt.fields, args.Fields)
+			assert.Equal(t, len(tt.fields), args.Len())
+			if tt.rest != "" {
+				assert.Equal(t, tt.rest, args.Rest(tt.restFrom))
+			}
+		})
+	}
+}
+
+func TestArgs_OutOfRange(t *testing.T) {
+	args, _ := ParseArgs("/cmd one")
+	assert.Equal(t, "one", args.Arg(0))
+	assert.Equal(t, "", args.Arg(1))
+	assert.Equal(t, "", args.Arg(-1))
+	assert.Equal(t, "", args.Rest(1))
+}
+
+func TestArgs_Exclusions(t *testing.T) {
+	args, _ := ParseArgs("/rquote -#nsfw extra -@bob -#Work -# -@")
+	exclusions, rest := args.Exclusions()
+	assert.Equal(t, []string{"nsfw", "Work"}, exclusions.Tags)
+	assert.Equal(t, []string{"bob"}, exclusions.Authors)
+	assert.Equal(t, []string{"extra", "-#", "-@"}, rest)
+	assert.False(t, exclusions.IsEmpty())
+
+	args, _ = ParseArgs("/rquote")
+	exclusions, rest = args.Exclusions()
+	assert.True(t, exclusions.IsEmpty())
+	assert.Empty(t, rest)
+}
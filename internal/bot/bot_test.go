@@ -83,7 +83,7 @@ func TestRegistry_RegisterAndGet(t *testing.T) {
 	registry := NewRegistry()
 
 	// Create a simple command
-	cmd := CommandFunc(func(ctx context.Context, msg *models.Message) error {
+	cmd := CommandFunc(func(ctx context.Context, msg *models.Message, args Args) error {
 		return nil
 	})
 
@@ -103,7 +103,7 @@ func TestRegistry_List(t *testing.T) {
 	registry := NewRegistry()
 
 	// Register multiple commands
-	cmd := CommandFunc(func(ctx context.Context, msg *models.Message) error {
+	cmd := CommandFunc(func(ctx context.Context, msg *models.Message, args Args) error {
 		return nil
 	})
 
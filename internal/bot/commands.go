@@ -8,16 +8,17 @@ import (
 
 // Command represents a bot command that can be executed
 type Command interface {
-	// Execute runs the command with the given message context
-	Execute(ctx context.Context, msg *models.Message) error
+	// Execute runs the command with the given message context and the
+	// arguments that followed the command name
+	Execute(ctx context.Context, msg *models.Message, args Args) error
 }
 
 // CommandFunc is an adapter to allow ordinary functions to be used as commands
-type CommandFunc func(ctx context.Context, msg *models.Message) error
+type CommandFunc func(ctx context.Context, msg *models.Message, args Args) error
 
 // Execute implements the Command interface
-func (f CommandFunc) Execute(ctx context.Context, msg *models.Message) error {
-	return f(ctx, msg)
+func (f CommandFunc) Execute(ctx context.Context, msg *models.Message, args Args) error {
+	return f(ctx, msg, args)
 }
 
 // Registry holds all registered commands
@@ -0,0 +1,273 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// MenuCommand is a command shown in Telegram's command menu; the command
+// handlers implement it
+type MenuCommand interface {
+	Command() string     // Command with its leading slash, e.g. "/rquote"
+	Description() string // English description, the menu default
+}
+
+// MenuClient is the part of the Bot API that sets the command menu
+type MenuClient interface {
+	SetMyCommands(ctx context.Context, params *bot.SetMyCommandsParams) (bool, error)
+}
+
+// menuTranslations holds the command descriptions per language code, keyed
+// by command name. Commands missing from a language use the English text.
+var menuTranslations = map[string]map[string]string{
+	"es": {
+		"addquote":       "Guarda una cita respondiendo a un mensaje",
+		"rquote":         "Muestra una cita al azar de este chat",
+		"quote":          "Muestra la cita con ese número",
+		"settings":       "Muestra o cambia los ajustes del chat",
+		"disable":        "Desactiva un comando en este chat (solo admins)",
+		"enable":         "Vuelve a activar un comando desactivado (solo admins)",
+		"exportpdf":      "Exporta las citas del chat como libro PDF (solo admins)",
+		"exportquotes":   "Exporta las citas del chat en un archivo JSON para copias de seguridad (solo admins)",
+		"purgequotes":    "Borra citas por autor o fechas (solo admins)",
+		"blockquoter":    "Impide a un usuario añadir citas (solo admins)",
+		"unblockquoter":  "Permite de nuevo añadir citas a un usuario (solo admins)",
+		"nick":           "Muestra a un autor con un apodo en las citas (solo admins)",
+		"mergeauthors":   "Trata dos IDs de usuario como el mismo autor (solo admins)",
+		"unmergeauthors": "Deshace una unión de autores (solo admins)",
+		"heatmap":        "Muestra cuándo hay más actividad en el chat",
+		"history":        "Busca en los mensajes recientes del chat",
+		"keep":           "Evita que un mensaje caduque para citarlo más tarde",
+		"myexport":       "Recibe en privado las citas que añadiste o en las que sales",
+		"quotefrom":      "Muestra una cita al azar de un mes (AAAA-MM) o año",
+		"fquote":         "Muestra una cita al azar que contenga unas palabras",
+		"findquote":      "Lista las citas que contienen unas palabras",
+		"listquotes":     "Lista las citas del chat, de 10 en 10",
+		"quotestats":     "Muestra estadísticas de las citas del chat",
+		"topquotes":      "Muestra las citas mejor valoradas del chat",
+		"quotecontest":   "Muestra la clasificación del concurso de citas o inicia uno (solo admins)",
+		"quoteduel":      "Vota entre dos citas al azar",
+		"quotegame":      "Adivina quién dijo una cita al azar",
+		"gamescore":      "Muestra la clasificación del juego de citas del chat",
+		"reorder":        "Cambia el orden de los mensajes de una cita (autor o admins)",
+		"delquote":       "Borra una cita (su autor durante un rato tras añadirla, o admins)",
+		"quotehistory":   "Lista o restaura versiones anteriores de una cita (solo admins)",
+		"saved":          "Muestra en privado las citas que guardaste con ⭐",
+	},
+	"ca": {
+		"addquote":       "Desa una cita responent a un missatge",
+		"rquote":         "Mostra una cita a l'atzar d'aquest xat",
+		"quote":          "Mostra la cita amb aquest número",
+		"settings":       "Mostra o canvia la configuració del xat",
+		"disable":        "Desactiva una ordre en aquest xat (només admins)",
+		"enable":         "Torna a activar una ordre desactivada (només admins)",
+		"exportpdf":      "Exporta les cites del xat com a llibre PDF (només admins)",
+		"exportquotes":   "Exporta les cites del xat en un arxiu JSON per a còpies de seguretat (només admins)",
+		"purgequotes":    "Esborra cites per autor o dates (només admins)",
+		"blockquoter":    "Impedeix a un usuari afegir cites (només admins)",
+		"unblockquoter":  "Torna a permetre afegir cites a un usuari (només admins)",
+		"nick":           "Mostra un autor amb un sobrenom a les cites (només admins)",
+		"mergeauthors":   "Tracta dos IDs d'usuari com el mateix autor (només admins)",
+		"unmergeauthors": "Desfà una unió d'autors (només admins)",
+		"heatmap":        "Mostra quan hi ha més activitat al xat",
+		"history":        "Cerca als missatges recents del xat",
+		"keep":           "Evita que un missatge caduqui per citar-lo més tard",
+		"myexport":       "Rep en privat les cites que has afegit o on surts",
+		"quotefrom":      "Mostra una cita a l'atzar d'un mes (AAAA-MM) o any",
+		"fquote":         "Mostra una cita a l'atzar que contingui unes paraules",
+		"findquote":      "Llista les cites que contenen unes paraules",
+		"listquotes":     "Llista les cites del xat, de 10 en 10",
+		"quotestats":     "Mostra estadístiques de les cites del xat",
+		"topquotes":      "Mostra les cites més ben valorades del xat",
+		"quotecontest":   "Mostra la classificació del concurs de cites o n'inicia un (només admins)",
+		"quoteduel":      "Vota entre dues cites a l'atzar",
+		"quotegame":      "Endevina qui va dir una cita a l'atzar",
+		"gamescore":      "Mostra la classificació del joc de cites del xat",
+		"reorder":        "Canvia l'ordre dels missatges d'una cita (autor o admins)",
+		"delquote":       "Esborra una cita (el seu autor durant una estona després d'afegir-la, o admins)",
+		"quotehistory":   "Llista o restaura versions anteriors d'una cita (només admins)",
+		"saved":          "Mostra en privat les cites que has desat amb ⭐",
+	},
+	"fr": {
+		"addquote":       "Enregistre une citation en répondant à un message",
+		"rquote":         "Affiche une citation au hasard de ce chat",
+		"quote":          "Affiche la citation portant ce numéro",
+		"settings":       "Affiche ou modifie les réglages du chat",
+		"disable":        "Désactive une commande dans ce chat (admins)",
+		"enable":         "Réactive une commande désactivée (admins)",
+		"exportpdf":      "Exporte les citations du chat en livre PDF (admins)",
+		"exportquotes":   "Exporte les citations du chat en archive JSON pour les sauvegardes (admins)",
+		"purgequotes":    "Supprime des citations par auteur ou par dates (admins)",
+		"blockquoter":    "Empêche un utilisateur d'ajouter des citations (admins)",
+		"unblockquoter":  "Autorise à nouveau un utilisateur à ajouter des citations (admins)",
+		"nick":           "Affiche un auteur avec un surnom dans les citations (admins)",
+		"mergeauthors":   "Traite deux IDs d'utilisateur comme le même auteur (admins)",
+		"unmergeauthors": "Annule une fusion d'auteurs (admins)",
+		"heatmap":        "Montre quand le chat est le plus actif",
+		"history":        "Cherche dans les messages récents du chat",
+		"keep":           "Empêche un message d'expirer pour le citer plus tard",
+		"myexport":       "Recevez en privé les citations que vous avez ajoutées ou où vous apparaissez",
+		"quotefrom":      "Affiche une citation au hasard d'un mois (AAAA-MM) ou d'une année",
+		"fquote":         "Affiche une citation au hasard contenant des mots",
+		"findquote":      "Liste les citations contenant des mots",
+		"listquotes":     "Liste les citations du chat, 10 par 10",
+		"quotestats":     "Affiche les statistiques des citations du chat",
+		"topquotes":      "Affiche les citations les mieux notées du chat",
+		"quotecontest":   "Affiche le classement du concours de citations ou en lance un (admins seulement)",
+		"quoteduel":      "Votez entre deux citations au hasard",
+		"quotegame":      "Devinez qui a dit une citation au hasard",
+		"gamescore":      "Affiche le classement du jeu de citations du chat",
+		"reorder":        "Change l'ordre des messages d'une citation (auteur ou admins)",
+		"delquote":       "Supprime une citation (son auteur peu après l'ajout, ou admins)",
+		"quotehistory":   "Liste ou restaure les versions précédentes d'une citation (admins)",
+		"saved":          "Affiche en privé les citations que vous avez enregistrées avec ⭐",
+	},
+	"de": {
+		"addquote":       "Speichert ein Zitat als Antwort auf eine Nachricht",
+		"rquote":         "Zeigt ein zufälliges Zitat aus diesem Chat",
+		"quote":          "Zeigt das Zitat mit dieser Nummer",
+		"settings":       "Zeigt oder ändert die Chat-Einstellungen",
+		"disable":        "Deaktiviert einen Befehl in diesem Chat (nur Admins)",
+		"enable":         "Aktiviert einen deaktivierten Befehl wieder (nur Admins)",
+		"exportpdf":      "Exportiert die Zitate des Chats als PDF-Buch (nur Admins)",
+		"exportquotes":   "Exportiert die Zitate des Chats als JSON-Archiv für Backups (nur Admins)",
+		"purgequotes":    "Löscht Zitate nach Autor oder Zeitraum (nur Admins)",
+		"blockquoter":    "Hindert einen Nutzer am Hinzufügen von Zitaten (nur Admins)",
+		"unblockquoter":  "Erlaubt einem Nutzer wieder, Zitate hinzuzufügen (nur Admins)",
+		"nick":           "Zeigt einen Autor in Zitaten mit Spitznamen (nur Admins)",
+		"mergeauthors":   "Behandelt zwei Nutzer-IDs als denselben Autor (nur Admins)",
+		"unmergeauthors": "Macht das Zusammenführen von Autoren rückgängig (nur Admins)",
+		"heatmap":        "Zeigt, wann im Chat am meisten los ist",
+		"history":        "Durchsucht die letzten Nachrichten des Chats",
+		"keep":           "Bewahrt eine Nachricht auf, um sie später zu zitieren",
+		"myexport":       "Schickt dir privat die Zitate, die du hinzugefügt hast oder in denen du vorkommst",
+		"quotefrom":      "Zeigt ein zufälliges Zitat aus einem Monat (JJJJ-MM) oder Jahr",
+		"fquote":         "Zeigt ein zufälliges Zitat mit bestimmten Wörtern",
+		"findquote":      "Listet die Zitate mit bestimmten Wörtern auf",
+		"listquotes":     "Listet die Zitate des Chats auf, jeweils 10",
+		"quotestats":     "Zeigt Statistiken zu den Zitaten des Chats",
+		"topquotes":      "Zeigt die am besten bewerteten Zitate des Chats",
+		"quotecontest":   "Zeigt den Stand des Zitatwettbewerbs oder startet einen (nur Admins)",
+		"quoteduel":      "Abstimmung zwischen zwei zufälligen Zitaten",
+		"quotegame":      "Rate, wer ein zufälliges Zitat gesagt hat",
+		"gamescore":      "Zeigt die Rangliste des Zitatspiels des Chats",
+		"reorder":        "Ändert die Reihenfolge der Nachrichten eines Zitats (Ersteller oder Admins)",
+		"delquote":       "Löscht ein Zitat (sein Ersteller kurz nach dem Hinzufügen, oder Admins)",
+		"quotehistory":   "Listet frühere Versionen eines Zitats auf oder stellt sie wieder her (nur Admins)",
+		"saved":          "Zeigt dir privat die Zitate, die du mit ⭐ gespeichert hast",
+	},
+	"it": {
+		"addquote":       "Salva una citazione rispondendo a un messaggio",
+		"rquote":         "Mostra una citazione a caso di questa chat",
+		"quote":          "Mostra la citazione con quel numero",
+		"settings":       "Mostra o modifica le impostazioni della chat",
+		"disable":        "Disattiva un comando in questa chat (solo admin)",
+		"enable":         "Riattiva un comando disattivato (solo admin)",
+		"exportpdf":      "Esporta le citazioni della chat come libro PDF (solo admin)",
+		"exportquotes":   "Esporta le citazioni della chat in un archivio JSON per i backup (solo admin)",
+		"purgequotes":    "Elimina citazioni per autore o date (solo admin)",
+		"blockquoter":    "Impedisce a un utente di aggiungere citazioni (solo admin)",
+		"unblockquoter":  "Permette di nuovo a un utente di aggiungere citazioni (solo admin)",
+		"nick":           "Mostra un autore con un soprannome nelle citazioni (solo admin)",
+		"mergeauthors":   "Tratta due ID utente come lo stesso autore (solo admin)",
+		"unmergeauthors": "Annulla l'unione di autori (solo admin)",
+		"heatmap":        "Mostra quando la chat è più attiva",
+		"history":        "Cerca nei messaggi recenti della chat",
+		"keep":           "Evita che un messaggio scada per citarlo più tardi",
+		"myexport":       "Ricevi in privato le citazioni che hai aggiunto o in cui compari",
+		"quotefrom":      "Mostra una citazione a caso di un mese (AAAA-MM) o anno",
+		"fquote":         "Mostra una citazione a caso che contiene delle parole",
+		"findquote":      "Elenca le citazioni che contengono delle parole",
+		"listquotes":     "Elenca le citazioni della chat, 10 alla volta",
+		"quotestats":     "Mostra le statistiche delle citazioni della chat",
+		"topquotes":      "Mostra le citazioni più votate della chat",
+		"quotecontest":   "Mostra la classifica del concorso di citazioni o ne avvia uno (solo admin)",
+		"quoteduel":      "Vota tra due citazioni a caso",
+		"quotegame":      "Indovina chi ha detto una citazione a caso",
+		"gamescore":      "Mostra la classifica del gioco delle citazioni della chat",
+		"reorder":        "Cambia l'ordine dei messaggi di una citazione (autore o admin)",
+		"delquote":       "Elimina una citazione (il suo autore poco dopo averla aggiunta, o admin)",
+		"quotehistory":   "Elenca o ripristina le versioni precedenti di una citazione (solo admin)",
+		"saved":          "Mostra in privato le citazioni che hai salvato con ⭐",
+	},
+	"pt": {
+		"addquote":       "Guarda uma citação respondendo a uma mensagem",
+		"rquote":         "Mostra uma citação aleatória deste chat",
+		"quote":          "Mostra a citação com esse número",
+		"settings":       "Mostra ou altera as definições do chat",
+		"disable":        "Desativa um comando neste chat (só admins)",
+		"enable":         "Volta a ativar um comando desativado (só admins)",
+		"exportpdf":      "Exporta as citações do chat como livro PDF (só admins)",
+		"exportquotes":   "Exporta as citações do chat num arquivo JSON para cópias de segurança (só admins)",
+		"purgequotes":    "Apaga citações por autor ou datas (só admins)",
+		"blockquoter":    "Impede um utilizador de adicionar citações (só admins)",
+		"unblockquoter":  "Permite de novo a um utilizador adicionar citações (só admins)",
+		"nick":           "Mostra um autor com uma alcunha nas citações (só admins)",
+		"mergeauthors":   "Trata dois IDs de utilizador como o mesmo autor (só admins)",
+		"unmergeauthors": "Desfaz uma junção de autores (só admins)",
+		"heatmap":        "Mostra quando o chat está mais ativo",
+		"history":        "Pesquisa as mensagens recentes do chat",
+		"keep":           "Evita que uma mensagem expire para a citares mais tarde",
+		"myexport":       "Recebe em privado as citações que adicionaste ou em que apareces",
+		"quotefrom":      "Mostra uma citação aleatória de um mês (AAAA-MM) ou ano",
+		"fquote":         "Mostra uma citação aleatória que contenha umas palavras",
+		"findquote":      "Lista as citações que contêm umas palavras",
+		"listquotes":     "Lista as citações do chat, de 10 em 10",
+		"quotestats":     "Mostra estatísticas das citações do chat",
+		"topquotes":      "Mostra as citações mais bem avaliadas do chat",
+		"quotecontest":   "Mostra a classificação do concurso de citações ou inicia um (só admins)",
+		"quoteduel":      "Vote entre duas citações aleatórias",
+		"quotegame":      "Adivinhe quem disse uma citação aleatória",
+		"gamescore":      "Mostra a classificação do jogo de citações do chat",
+		"reorder":        "Muda a ordem das mensagens de uma citação (autor ou admins)",
+		"delquote":       "Apaga uma citação (o seu autor pouco depois de a adicionar, ou admins)",
+		"quotehistory":   "Lista ou restaura versões anteriores de uma citação (só admins)",
+		"saved":          "Mostra em privado as citações que guardaste com ⭐",
+	},
+}
+
+// MenuLanguages returns the language codes with translated descriptions
+func MenuLanguages() []string {
+	languages := make([]string, 0, len(menuTranslations))
+	for language := range menuTranslations {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Menu builds the command menu for a language code, empty for the default
+// English menu
+func Menu(commands []MenuCommand, language string) []models.BotCommand {
+	translations := menuTranslations[language]
+	menu := make([]models.BotCommand, 0, len(commands))
+	for _, command := range commands {
+		name := strings.TrimPrefix(command.Command(), "/")
+		description, ok := translations[name]
+		if !ok {
+			description = command.Description()
+		}
+		menu = append(menu, models.BotCommand{Command: name, Description: description})
+	}
+	return menu
+}
+
+// SyncMenu sets the default command menu and one per translated language,
+// so Telegram shows users the commands in their own language
+func SyncMenu(ctx context.Context, client MenuClient, commands []MenuCommand) error {
+	for _, language := range append([]string{""}, MenuLanguages()...) {
+		_, err := client.SetMyCommands(ctx, &bot.SetMyCommandsParams{
+			Commands:     Menu(commands, language),
+			LanguageCode: language,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set commands for language %q: %w", language, err)
+		}
+	}
+	return nil
+}
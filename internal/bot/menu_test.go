@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type menuCommand struct {
+	command     string
+	description string
+}
+
+func (c menuCommand) Command() string     { return c.command }
+func (c menuCommand) Description() string { return c.description }
+
+type fakeMenuClient struct {
+	calls []*bot.SetMyCommandsParams
+	err   error
+}
+
+func (c *fakeMenuClient) SetMyCommands(_ context.Context, params *bot.SetMyCommandsParams) (bool, error) {
+	c.calls = append(c.calls, params)
+	return c.err == nil, c.err
+}
+
+var testMenu = []MenuCommand{
+	menuCommand{"/rquote", "Get a random quote from this chat"},
+	menuCommand{"/newcommand", "Not translated yet"},
+}
+
+func TestMenu(t *testing.T) {
+	assert.Equal(t, []models.BotCommand{
+		{Command: "rquote", Description: "Get a random quote from this chat"},
+		{Command: "newcommand", Description: "Not translated yet"},
+	}, Menu(testMenu, ""))
+
+	assert.Equal(t, []models.BotCommand{
+		{Command: "rquote", Description: "Muestra una cita al azar de este chat"},
+		{Command: "newcommand", Description: "Not translated yet"},
+	}, Menu(testMenu, "es"))
+}
+
+func TestMenuTranslations(t *testing.T) {
+	for language, translations := range menuTranslations {
+		for command, description := range translations {
+			length := utf8.RuneCountInString(description)
+			assert.True(t, length > 0 && length <= 256, "%s /%s description length %d", language, command, length)
+		}
+	}
+}
+
+func TestSyncMenu(t *testing.T) {
+	client := &fakeMenuClient{}
+	require.NoError(t, SyncMenu(context.Background(), client, testMenu))
+
+	require.Len(t, client.calls, len(MenuLanguages())+1)
+	assert.Equal(t, "", client.calls[0].LanguageCode)
+	for i, language := range MenuLanguages() {
+		assert.Equal(t, language, client.calls[i+1].LanguageCode)
+		assert.Len(t, client.calls[i+1].Commands, len(testMenu))
+	}
+}
+
+func TestSyncMenu_Error(t *testing.T) {
+	client := &fakeMenuClient{err: errors.New("too many requests")}
+	err := SyncMenu(context.Background(), client, testMenu)
+	assert.ErrorContains(t, err, "too many requests")
+	assert.Len(t, client.calls, 1)
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// highWatermark is the share of the limit above which the limiter warns
+const highWatermark = 0.8
+
+// Backpressure limits how many updates are handled at once. Updates over
+// the limit wait for a free slot instead of piling up goroutines; those
+// still waiting after the timeout are logged and counted, never dropped
+// without a trace.
+type Backpressure struct {
+	limit   int
+	timeout time.Duration
+	logger  *slog.Logger
+	slots   chan struct{}
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	waited   uint64
+	timedOut uint64
+	warned   bool // Over the high watermark since the last warning
+}
+
+// NewBackpressure creates a limiter of limit concurrent updates. Updates
+// wait up to timeout for a slot; zero waits until the update is cancelled.
+// A limit of zero or less only measures the updates in flight.
+func NewBackpressure(limit int, timeout time.Duration, logger *slog.Logger) *Backpressure {
+	bp := &Backpressure{limit: limit, timeout: timeout, logger: logger}
+	if limit > 0 {
+		bp.slots = make(chan struct{}, limit)
+	}
+	return bp
+}
+
+// Middleware returns the bot middleware applying the limit
+func (bp *Backpressure) Middleware() bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if err := bp.acquire(ctx); err != nil {
+				bp.logger.Error("update not handled, too many updates in flight",
+					"update_id", update.ID, "limit", bp.limit, "error", err)
+				return
+			}
+			defer bp.release()
+			next(ctx, b, update)
+		}
+	}
+}
+
+// acquire takes a slot, waiting for one while the limit is reached
+func (bp *Backpressure) acquire(ctx context.Context) error {
+	if bp.slots != nil {
+		select {
+		case bp.slots <- struct{}{}:
+		default:
+			if err := bp.wait(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	bp.inFlight++
+	if bp.inFlight > bp.peak {
+		bp.peak = bp.inFlight
+	}
+	if bp.limit > 0 && !bp.warned && float64(bp.inFlight) >= highWatermark*float64(bp.limit) {
+		bp.warned = true
+		bp.logger.Warn("updates in flight over the high watermark", "in_flight", bp.inFlight, "limit", bp.limit)
+	}
+	return nil
+}
+
+// wait blocks until a slot is free, the timeout passes or ctx is done
+func (bp *Backpressure) wait(ctx context.Context) error {
+	bp.mu.Lock()
+	bp.waited++
+	bp.mu.Unlock()
+
+	if bp.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, bp.timeout)
+		defer cancel()
+	}
+	select {
+	case bp.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		bp.mu.Lock()
+		bp.timedOut++
+		bp.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// release frees the slot of a handled update
+func (bp *Backpressure) release() {
+	bp.mu.Lock()
+	bp.inFlight--
+	if bp.warned && float64(bp.inFlight) < highWatermark*float64(bp.limit)/2 {
+		// Warn again on the next surge, not on every update of this one
+		bp.warned = false
+	}
+	bp.mu.Unlock()
+
+	if bp.slots != nil {
+		<-bp.slots
+	}
+}
+
+// BackpressureStats are the measurements of the limiter
+type BackpressureStats struct {
+	InFlight int    // Updates being handled
+	Peak     int    // Most updates handled at once
+	Waited   uint64 // Updates that had to wait for a slot
+	TimedOut uint64 // Updates given up after waiting
+}
+
+// Stats returns the current measurements
+func (bp *Backpressure) Stats() BackpressureStats {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	return BackpressureStats{InFlight: bp.inFlight, Peak: bp.peak, Waited: bp.waited, TimedOut: bp.timedOut}
+}
+
+// WritePrometheus writes the measurements in the Prometheus text format
+func (bp *Backpressure) WritePrometheus(w io.Writer) error {
+	stats := bp.Stats()
+	_, err := fmt.Fprintf(w,
+		"# HELP wanon_updates_in_flight Updates being handled.\n"+
+			"# TYPE wanon_updates_in_flight gauge\n"+
+			"wanon_updates_in_flight %d\n"+
+			"# HELP wanon_updates_in_flight_peak Most updates handled at once since startup.\n"+
+			"# TYPE wanon_updates_in_flight_peak gauge\n"+
+			"wanon_updates_in_flight_peak %d\n"+
+			"# HELP wanon_updates_in_flight_limit Most updates handled at once before waiting; 0 is unlimited.\n"+
+			"# TYPE wanon_updates_in_flight_limit gauge\n"+
+			"wanon_updates_in_flight_limit %d\n"+
+			"# HELP wanon_updates_waited_total Updates that waited for a free slot.\n"+
+			"# TYPE wanon_updates_waited_total counter\n"+
+			"wanon_updates_waited_total %d\n"+
+			"# HELP wanon_updates_timed_out_total Updates not handled after waiting for a slot.\n"+
+			"# TYPE wanon_updates_timed_out_total counter\n"+
+			"wanon_updates_timed_out_total %d\n",
+		stats.InFlight, stats.Peak, bp.limit, stats.Waited, stats.TimedOut)
+	return err
+}
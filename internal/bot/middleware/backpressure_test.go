@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestBackpressure_WaitsForSlot(t *testing.T) {
+	bp := NewBackpressure(1, time.Second, newTestLogger())
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := bp.Middleware()(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		if update.ID == 1 {
+			close(started)
+			<-release
+		}
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		handler(context.Background(), nil, &models.Update{ID: 1})
+	}()
+	<-started
+	go func() {
+		defer wg.Done()
+		handler(context.Background(), nil, &models.Update{ID: 2})
+	}()
+
+	// The second update waits for the first one
+	deadline := time.Now().Add(time.Second)
+	for bp.Stats().Waited == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	stats := bp.Stats()
+	if stats.Waited != 1 || stats.TimedOut != 0 || stats.Peak != 1 || stats.InFlight != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestBackpressure_TimesOut(t *testing.T) {
+	bp := NewBackpressure(1, 10*time.Millisecond, newTestLogger())
+	calls := 0
+	handler := bp.Middleware()(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		calls++
+	})
+
+	// Hold the only slot
+	if err := bp.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	handler(context.Background(), nil, &models.Update{ID: 1})
+	if calls != 0 {
+		t.Fatal("expected the update to give up waiting")
+	}
+	bp.release()
+
+	// Cancelled updates stop waiting too
+	bp = NewBackpressure(1, 0, newTestLogger())
+	if err := bp.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bp.acquire(ctx); err == nil {
+		t.Fatal("expected a cancelled update not to get a slot")
+	}
+	if stats := bp.Stats(); stats.TimedOut != 1 || stats.InFlight != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestBackpressure_Unlimited(t *testing.T) {
+	bp := NewBackpressure(0, 0, newTestLogger())
+	handler := bp.Middleware()(func(ctx context.Context, b *bot.Bot, update *models.Update) {})
+	for i := 0; i < 3; i++ {
+		handler(context.Background(), nil, &models.Update{ID: int64(i)})
+	}
+
+	var out strings.Builder
+	if err := bp.WritePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"wanon_updates_in_flight 0\n", "wanon_updates_in_flight_peak 1\n", "wanon_updates_in_flight_limit 0\n", "wanon_updates_timed_out_total 0\n"} {
+		if !strings.Contains(out.String(), line) {
+			t.Fatalf("expected %q in\n%s", line, out.String())
+		}
+	}
+}
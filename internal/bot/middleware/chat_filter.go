@@ -4,6 +4,7 @@ package middleware
 import (
 	"context"
 	"log/slog"
+	"strings"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -22,6 +23,15 @@ func ChatFilter(allowedChatIDs []int64, autoLeave bool, logger *slog.Logger) bot
 
 	logger.Info("Chat filter", "allowAll", allowAll, "autoLeave", autoLeave, "chatIds", allowedChatIDs)
 
+	return ChatFilterFunc(func(chatID int64) bool {
+		return allowAll || allowed[chatID]
+	}, autoLeave, logger)
+}
+
+// ChatFilterFunc creates a middleware that only passes updates from chats
+// for which allowed returns true, for allowlists that change at runtime.
+// If autoLeave is true, the bot will attempt to leave unauthorized chats.
+func ChatFilterFunc(allowed func(chatID int64) bool, autoLeave bool, logger *slog.Logger) bot.Middleware {
 	return func(next bot.HandlerFunc) bot.HandlerFunc {
 		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
 			// Extract chat ID from update
@@ -32,7 +42,7 @@ func ChatFilter(allowedChatIDs []int64, autoLeave bool, logger *slog.Logger) bot
 			}
 
 			// Check if chat is allowed
-			if !allowAll && !allowed[chatID] {
+			if !allowed(chatID) {
 				if logger != nil {
 					logger.Info("ignoring update from unauthorized chat", "chat_id", chatID)
 				}
@@ -57,6 +67,75 @@ func ChatFilter(allowedChatIDs []int64, autoLeave bool, logger *slog.Logger) bot
 	}
 }
 
+// ExceptPrivateCommands wraps a chat filter so that the given commands,
+// without the leading slash, always pass when sent in a private chat. Users
+// reach personal commands such as /myexport there, outside the allowlist.
+func ExceptPrivateCommands(filter bot.Middleware, commands ...string) bot.Middleware {
+	exempt := make(map[string]bool, len(commands))
+	for _, command := range commands {
+		exempt[command] = true
+	}
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		filtered := filter(next)
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if msg := update.Message; msg != nil && msg.Chat.Type == models.ChatTypePrivate && exempt[commandName(msg.Text)] {
+				next(ctx, b, update)
+				return
+			}
+			filtered(ctx, b, update)
+		}
+	}
+}
+
+// ExceptPrivateCallbacks wraps a chat filter so that the buttons whose
+// callback data starts with one of the given prefixes always pass when
+// pressed in a private chat, such as those of the messages answering
+// personal commands
+func ExceptPrivateCallbacks(filter bot.Middleware, prefixes ...string) bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		filtered := filter(next)
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if query := update.CallbackQuery; query != nil && query.Message.Message != nil &&
+				query.Message.Message.Chat.Type == models.ChatTypePrivate {
+				for _, prefix := range prefixes {
+					if strings.HasPrefix(query.Data, prefix) {
+						next(ctx, b, update)
+						return
+					}
+				}
+			}
+			filtered(ctx, b, update)
+		}
+	}
+}
+
+// ExceptPollAnswers wraps a chat filter so that poll answers, which carry
+// no chat, pass. Telegram only sends them for polls the bot sent, in chats
+// the filter let in.
+func ExceptPollAnswers(filter bot.Middleware) bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		filtered := filter(next)
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if update != nil && update.PollAnswer != nil {
+				next(ctx, b, update)
+				return
+			}
+			filtered(ctx, b, update)
+		}
+	}
+}
+
+// commandName returns the command of a message text without the slash and
+// bot username, or "" if the text is not a command
+func commandName(text string) string {
+	if !strings.HasPrefix(text, "/") {
+		return ""
+	}
+	name := strings.TrimPrefix(strings.Fields(text)[0], "/")
+	name, _, _ = strings.Cut(name, "@")
+	return name
+}
+
 // extractChatID extracts the chat ID from an update.
 // Returns 0 if no chat ID can be determined.
 func extractChatID(update *models.Update) int64 {
@@ -358,3 +358,101 @@ func TestChatFilter_NoAutoLeaveWhenDisabled(t *testing.T) {
 		t.Error("expected handler NOT to be called for unauthorized chat")
 	}
 }
+
+func TestChatFilterFunc_FollowsAllowlistChanges(t *testing.T) {
+	allowed := map[int64]bool{}
+	middleware := ChatFilterFunc(func(chatID int64) bool { return allowed[chatID] }, false, newTestLogger())
+
+	calls := 0
+	handler := middleware(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		calls++
+	})
+	update := &models.Update{Message: &models.Message{Chat: models.Chat{ID: -100123}}}
+
+	handler(context.Background(), nil, update)
+	if calls != 0 {
+		t.Fatal("expected handler NOT to be called before the chat is allowed")
+	}
+
+	allowed[-100123] = true
+	handler(context.Background(), nil, update)
+	if calls != 1 {
+		t.Error("expected handler to be called once the chat is allowed")
+	}
+}
+
+func TestExceptPrivateCommands(t *testing.T) {
+	filter := ExceptPrivateCommands(ChatFilter([]int64{-100123}, false, newTestLogger()), "myexport")
+
+	tests := []struct {
+		name     string
+		chat     models.Chat
+		text     string
+		expected bool
+	}{
+		{"exempt command in private", models.Chat{ID: 42, Type: models.ChatTypePrivate}, "/myexport text", true},
+		{"exempt command with bot name", models.Chat{ID: 42, Type: models.ChatTypePrivate}, "/myexport@wanon_bot", true},
+		{"other command in private", models.Chat{ID: 42, Type: models.ChatTypePrivate}, "/rquote", false},
+		{"exempt command in a group", models.Chat{ID: -100999, Type: models.ChatTypeSupergroup}, "/myexport", false},
+		{"allowed chat", models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}, "/rquote", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			next := func(ctx context.Context, b *bot.Bot, update *models.Update) {
+				called = true
+			}
+			filter(next)(context.Background(), nil, &models.Update{Message: &models.Message{Chat: tt.chat, Text: tt.text}})
+			if called != tt.expected {
+				t.Errorf("expected called=%v, got %v", tt.expected, called)
+			}
+		})
+	}
+}
+
+func TestExceptPrivateCallbacks(t *testing.T) {
+	filter := ExceptPrivateCallbacks(ChatFilter([]int64{-100123}, false, newTestLogger()), "bookmark:")
+	private := models.Chat{ID: 42, Type: models.ChatTypePrivate}
+
+	tests := []struct {
+		name     string
+		chat     models.Chat
+		data     string
+		expected bool
+	}{
+		{"exempt button in private", private, "bookmark:remove:7", true},
+		{"other button in private", private, "purgequotes:confirm:abc", false},
+		{"exempt button in a group", models.Chat{ID: -100999, Type: models.ChatTypeSupergroup}, "bookmark:save:7", false},
+		{"allowed chat", models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}, "bookmark:save:7", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			next := func(ctx context.Context, b *bot.Bot, update *models.Update) {
+				called = true
+			}
+			filter(next)(context.Background(), nil, &models.Update{CallbackQuery: &models.CallbackQuery{
+				Data:    tt.data,
+				Message: models.MaybeInaccessibleMessage{Message: &models.Message{Chat: tt.chat}},
+			}})
+			if called != tt.expected {
+				t.Errorf("expected called=%v, got %v", tt.expected, called)
+			}
+		})
+	}
+}
+
+func TestExceptPollAnswers(t *testing.T) {
+	filter := ExceptPollAnswers(ChatFilter([]int64{-100123}, false, newTestLogger()))
+	var handled []int64
+	next := func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		handled = append(handled, update.ID)
+	}
+
+	filter(next)(context.Background(), nil, &models.Update{ID: 1, PollAnswer: &models.PollAnswer{PollID: "p", User: &models.User{ID: 42}}})
+	filter(next)(context.Background(), nil, &models.Update{ID: 2, Message: &models.Message{Chat: models.Chat{ID: -100999}}})
+	filter(next)(context.Background(), nil, &models.Update{ID: 3, Message: &models.Message{Chat: models.Chat{ID: -100123}}})
+	if len(handled) != 2 || handled[0] != 1 || handled[1] != 3 {
+		t.Errorf("expected updates 1 and 3 handled, got %v", handled)
+	}
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/kv"
+)
+
+// coalesceAck is the reaction put on commands folded into an earlier one
+const coalesceAck = "👀"
+
+// Coalescer folds bursts of the same command in a chat into a single run.
+// The first command of a burst is handled; repeats with the same arguments
+// within the window only get a reaction, so a burst of /rquote posts a
+// single quote while /rquote media still gets its own.
+type Coalescer struct {
+	window   time.Duration
+	commands map[string]bool
+	logger   *slog.Logger
+	clock    clock.Clock
+	store    kv.Store // Shared bursts, instead of bursts
+
+	mu     sync.Mutex
+	bursts map[burstKey]time.Time // Start of the current burst
+}
+
+// burstKey identifies the bursts of a command and its arguments in a chat
+type burstKey struct {
+	chatID  int64
+	command string
+	args    string // Normalized by burstArgs
+}
+
+// NewCoalescer creates a coalescer for the given command names, without
+// the leading slash. A zero window disables coalescing.
+func NewCoalescer(window time.Duration, commands []string, logger *slog.Logger) *Coalescer {
+	names := make(map[string]bool, len(commands))
+	for _, command := range commands {
+		names[command] = true
+	}
+	return &Coalescer{
+		window:   window,
+		commands: names,
+		logger:   logger,
+		clock:    clock.System{},
+		bursts:   make(map[burstKey]time.Time),
+	}
+}
+
+// WithClock replaces the time source used to measure the window
+func (c *Coalescer) WithClock(clk clock.Clock) *Coalescer {
+	c.clock = clk
+	return c
+}
+
+// WithStore keeps the bursts in a store shared by every replica, so a burst
+// spread over replicas still runs the command once
+func (c *Coalescer) WithStore(store kv.Store) *Coalescer {
+	c.store = store
+	return c
+}
+
+// Middleware returns the bot middleware applying the coalescer
+func (c *Coalescer) Middleware() bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			msg := update.Message
+			if msg == nil || c.window <= 0 {
+				next(ctx, b, update)
+				return
+			}
+			args, ok := botcmd.ParseArgs(msg.Text)
+			if !ok || !c.commands[args.Command] || c.allow(ctx, burstKey{chatID: msg.Chat.ID, command: args.Command, args: burstArgs(args)}) {
+				next(ctx, b, update)
+				return
+			}
+
+			c.logger.Debug("coalescing command", "chat_id", msg.Chat.ID, "command", args.Command, "message_id", msg.ID)
+			if b == nil {
+				return
+			}
+			_, err := b.SetMessageReaction(ctx, &bot.SetMessageReactionParams{
+				ChatID:    msg.Chat.ID,
+				MessageID: msg.ID,
+				Reaction: []models.ReactionType{{
+					Type:              models.ReactionTypeTypeEmoji,
+					ReactionTypeEmoji: &models.ReactionTypeEmoji{Emoji: coalesceAck},
+				}},
+			})
+			if err != nil {
+				c.logger.Debug("failed to acknowledge coalesced command", "chat_id", msg.Chat.ID, "error", err)
+			}
+		}
+	}
+}
+
+// burstArgs normalizes the arguments of a command, so that only spacing,
+// case and order differences fall in the same burst: /rquote -#a -@b asks
+// for the same as /rquote -@b -#a
+func burstArgs(args botcmd.Args) string {
+	fields := make([]string, len(args.Fields))
+	for i, field := range args.Fields {
+		fields[i] = strings.ToLower(field)
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, " ")
+}
+
+// allow reports whether a command starts a new burst, recording it if so
+func (c *Coalescer) allow(ctx context.Context, key burstKey) bool {
+	if c.store != nil {
+		started, err := c.store.SetNX(ctx, fmt.Sprintf("coalesce:%d:%s:%s", key.chatID, key.command, key.args), []byte("1"), c.window)
+		if err != nil {
+			c.logger.Warn("failed to check a shared burst, running the command", "chat_id", key.chatID, "command", key.command, "error", err)
+			return true
+		}
+		return started
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	if start, ok := c.bursts[key]; ok && now.Sub(start) < c.window {
+		return false
+	}
+
+	// Forget finished bursts so idle chats do not pile up
+	for k, start := range c.bursts {
+		if now.Sub(start) >= c.window {
+			delete(c.bursts, k)
+		}
+	}
+	c.bursts[key] = now
+	return true
+}
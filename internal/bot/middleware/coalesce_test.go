@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/kv"
+)
+
+func commandUpdate(chatID int64, text string) *models.Update {
+	return &models.Update{
+		Message: &models.Message{
+			ID:   1,
+			Chat: models.Chat{ID: chatID},
+			Text: text,
+		},
+	}
+}
+
+func TestCoalescer_FoldsBursts(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	coalescer := NewCoalescer(3*time.Second, []string{"rquote"}, newTestLogger()).WithClock(clk)
+
+	calls := 0
+	handler := coalescer.Middleware()(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		calls++
+	})
+
+	handler(context.Background(), nil, commandUpdate(1, "/rquote"))
+	handler(context.Background(), nil, commandUpdate(1, "/rquote@wanonbot"))
+	clk.Advance(2 * time.Second)
+	handler(context.Background(), nil, commandUpdate(1, "/rquote"))
+	if calls != 1 {
+		t.Fatalf("expected a burst to be handled once, got %d calls", calls)
+	}
+
+	// Other chats have their own bursts
+	handler(context.Background(), nil, commandUpdate(2, "/rquote"))
+	if calls != 2 {
+		t.Fatalf("expected another chat to be handled, got %d calls", calls)
+	}
+
+	// The window is measured from the start of the burst
+	clk.Advance(time.Second)
+	handler(context.Background(), nil, commandUpdate(1, "/rquote"))
+	if calls != 3 {
+		t.Fatalf("expected a new burst after the window, got %d calls", calls)
+	}
+}
+
+func TestCoalescer_ArgumentsStartTheirOwnBurst(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := kv.NewMemory().WithClock(clk)
+
+	for name, coalescer := range map[string]*Coalescer{
+		"local":  NewCoalescer(3*time.Second, []string{"rquote"}, newTestLogger()).WithClock(clk),
+		"shared": NewCoalescer(3*time.Second, []string{"rquote"}, newTestLogger()).WithClock(clk).WithStore(store),
+	} {
+		calls := 0
+		handler := coalescer.Middleware()(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			calls++
+		})
+
+		handler(context.Background(), nil, commandUpdate(1, "/rquote"))
+		handler(context.Background(), nil, commandUpdate(1, "/rquote media"))
+		handler(context.Background(), nil, commandUpdate(1, "/rquote  Media"))
+		if calls != 2 {
+			t.Fatalf("%s: expected /rquote media to be handled apart from /rquote once, got %d calls", name, calls)
+		}
+		clk.Advance(3 * time.Second)
+	}
+}
+
+func TestCoalescer_FiltersStartTheirOwnBurst(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	coalescer := NewCoalescer(3*time.Second, []string{"rquote"}, newTestLogger()).WithClock(clk)
+
+	calls := 0
+	handler := coalescer.Middleware()(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		calls++
+	})
+
+	handler(context.Background(), nil, commandUpdate(1, "/rquote"))
+	handler(context.Background(), nil, commandUpdate(1, "/rquote -#nsfw -@bob"))
+	if calls != 2 {
+		t.Fatalf("expected a filtered /rquote to be handled after a plain one, got %d calls", calls)
+	}
+
+	// The same filters in another order are a repeat
+	handler(context.Background(), nil, commandUpdate(1, "/rquote -@Bob -#nsfw"))
+	if calls != 2 {
+		t.Fatalf("expected the same filters to be coalesced, got %d calls", calls)
+	}
+	handler(context.Background(), nil, commandUpdate(1, "/rquote -#nsfw"))
+	if calls != 3 {
+		t.Fatalf("expected other filters to be handled, got %d calls", calls)
+	}
+}
+
+func TestCoalescer_SharedBursts(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := kv.NewMemory().WithClock(clk)
+
+	calls := 0
+	count := func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		calls++
+	}
+	// Two replicas share the bursts
+	first := NewCoalescer(3*time.Second, []string{"rquote"}, newTestLogger()).WithClock(clk).WithStore(store).Middleware()(count)
+	second := NewCoalescer(3*time.Second, []string{"rquote"}, newTestLogger()).WithClock(clk).WithStore(store).Middleware()(count)
+
+	first(context.Background(), nil, commandUpdate(1, "/rquote"))
+	second(context.Background(), nil, commandUpdate(1, "/rquote"))
+	if calls != 1 {
+		t.Fatalf("expected a burst over replicas to be handled once, got %d calls", calls)
+	}
+
+	clk.Advance(3 * time.Second)
+	second(context.Background(), nil, commandUpdate(1, "/rquote"))
+	if calls != 2 {
+		t.Fatalf("expected a new burst after the window, got %d calls", calls)
+	}
+}
+
+func TestCoalescer_IgnoresOtherUpdates(t *testing.T) {
+	coalescer := NewCoalescer(time.Minute, []string{"rquote"}, newTestLogger())
+
+	calls := 0
+	handler := coalescer.Middleware()(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		calls++
+	})
+
+	for i := 0; i < 3; i++ {
+		handler(context.Background(), nil, commandUpdate(1, "/addquote"))
+		handler(context.Background(), nil, commandUpdate(1, "hello"))
+		handler(context.Background(), nil, &models.Update{})
+	}
+	if calls != 9 {
+		t.Fatalf("expected every update to pass, got %d calls", calls)
+	}
+}
+
+func TestCoalescer_ZeroWindowDisables(t *testing.T) {
+	coalescer := NewCoalescer(0, []string{"rquote"}, newTestLogger())
+
+	calls := 0
+	handler := coalescer.Middleware()(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		calls++
+	})
+
+	handler(context.Background(), nil, commandUpdate(1, "/rquote"))
+	handler(context.Background(), nil, commandUpdate(1, "/rquote"))
+	if calls != 2 {
+		t.Fatalf("expected coalescing to be disabled, got %d calls", calls)
+	}
+}
@@ -0,0 +1,303 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/textutil"
+)
+
+const (
+	// maxTextUnits is the longest text or caption Telegram sends, in UTF-16
+	// code units
+	maxTextUnits = 4096
+	// maxClockSkew is how far in the future an update date may be before it
+	// is taken as bogus rather than a clock off by a little
+	maxClockSkew = time.Hour
+)
+
+// telegramEpoch is earlier than any date Telegram can put on an update
+var telegramEpoch = time.Date(2013, 8, 1, 0, 0, 0, 0, time.UTC)
+
+// Validator drops malformed updates before they reach the cache and the
+// handlers, which then can count on the fields Telegram always sends: IDs
+// of messages, chats and senders, dates and entities inside their text.
+type Validator struct {
+	logger   *slog.Logger
+	clock    clock.Clock
+	rejected atomic.Uint64
+}
+
+// NewValidator creates a validator
+func NewValidator(logger *slog.Logger) *Validator {
+	return &Validator{logger: logger, clock: clock.System{}}
+}
+
+// WithClock replaces the time source dates are checked against
+func (v *Validator) WithClock(clk clock.Clock) *Validator {
+	v.clock = clk
+	return v
+}
+
+// Middleware returns the bot middleware dropping invalid updates. It goes
+// first in the chain, so no other middleware sees them.
+func (v *Validator) Middleware() bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if err := ValidateUpdate(update, v.clock.Now()); err != nil {
+				v.rejected.Add(1)
+				v.logger.Warn("dropping invalid update", "update_id", updateID(update), "error", err)
+				return
+			}
+			next(ctx, b, update)
+		}
+	}
+}
+
+// Rejected returns the number of updates dropped since startup
+func (v *Validator) Rejected() uint64 {
+	return v.rejected.Load()
+}
+
+// WritePrometheus writes the measurements in the Prometheus text format
+func (v *Validator) WritePrometheus(w io.Writer) error {
+	_, err := fmt.Fprintf(w,
+		"# HELP wanon_updates_rejected_total Updates dropped as malformed before handling.\n"+
+			"# TYPE wanon_updates_rejected_total counter\n"+
+			"wanon_updates_rejected_total %d\n",
+		v.Rejected())
+	return err
+}
+
+// ValidateUpdate checks that an update has the shape Telegram gives it at
+// time now. Kinds of update the bot does not handle are not looked into.
+func ValidateUpdate(update *models.Update, now time.Time) error {
+	if update == nil {
+		return errors.New("empty update")
+	}
+	if update.ID <= 0 {
+		return errors.New("update without an ID")
+	}
+
+	payloads := []struct {
+		name     string
+		present  bool
+		validate func() error
+	}{
+		{"message", update.Message != nil, func() error {
+			return validateMessage(update.Message, now, true)
+		}},
+		{"edited_message", update.EditedMessage != nil, func() error {
+			return validateEdited(update.EditedMessage, now)
+		}},
+		{"channel_post", update.ChannelPost != nil, func() error {
+			return validateMessage(update.ChannelPost, now, true)
+		}},
+		{"edited_channel_post", update.EditedChannelPost != nil, func() error {
+			return validateEdited(update.EditedChannelPost, now)
+		}},
+		{"callback_query", update.CallbackQuery != nil, func() error {
+			return validateCallback(update.CallbackQuery, now)
+		}},
+		{"message_reaction", update.MessageReaction != nil, func() error {
+			return validateReaction(update.MessageReaction, now)
+		}},
+		{"my_chat_member", update.MyChatMember != nil, func() error {
+			return validateMember(update.MyChatMember, now)
+		}},
+		{"chat_member", update.ChatMember != nil, func() error {
+			return validateMember(update.ChatMember, now)
+		}},
+		{"poll_answer", update.PollAnswer != nil, func() error {
+			if update.PollAnswer.PollID == "" {
+				return errors.New("answer without a poll ID")
+			}
+			if update.PollAnswer.User == nil {
+				if update.PollAnswer.VoterChat == nil || update.PollAnswer.VoterChat.ID == 0 {
+					return errors.New("answer without a voter")
+				}
+				return nil
+			}
+			return validateUser(update.PollAnswer.User)
+		}},
+		{"inline_query", update.InlineQuery != nil, func() error {
+			if update.InlineQuery.ID == "" {
+				return errors.New("query without an ID")
+			}
+			if update.InlineQuery.From == nil {
+				return errors.New("query without a sender")
+			}
+			return validateUser(update.InlineQuery.From)
+		}},
+	}
+
+	found := ""
+	for _, payload := range payloads {
+		if !payload.present {
+			continue
+		}
+		if found != "" {
+			return fmt.Errorf("update with both %s and %s", found, payload.name)
+		}
+		found = payload.name
+		if err := payload.validate(); err != nil {
+			return fmt.Errorf("%s: %w", payload.name, err)
+		}
+	}
+	return nil
+}
+
+// validateMessage checks a message. Replies carry the message they answer,
+// which Telegram never nests further.
+func validateMessage(msg *models.Message, now time.Time, allowReply bool) error {
+	if msg.ID <= 0 {
+		return errors.New("message without an ID")
+	}
+	if msg.Chat.ID == 0 {
+		return errors.New("message without a chat")
+	}
+	if err := validateDate(msg.Date, now); err != nil {
+		return err
+	}
+	if msg.From != nil {
+		if err := validateUser(msg.From); err != nil {
+			return err
+		}
+	}
+	if msg.SenderChat != nil && msg.SenderChat.ID == 0 {
+		return errors.New("sender chat without an ID")
+	}
+	if err := validateText(msg.Text, msg.Entities); err != nil {
+		return fmt.Errorf("text: %w", err)
+	}
+	if err := validateText(msg.Caption, msg.CaptionEntities); err != nil {
+		return fmt.Errorf("caption: %w", err)
+	}
+	if msg.ReplyToMessage != nil {
+		if !allowReply {
+			return errors.New("reply nested in a reply")
+		}
+		if err := validateMessage(msg.ReplyToMessage, now, false); err != nil {
+			return fmt.Errorf("reply_to_message: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateEdited checks an edited message, which also has its edit date
+func validateEdited(msg *models.Message, now time.Time) error {
+	if err := validateMessage(msg, now, true); err != nil {
+		return err
+	}
+	if msg.EditDate == 0 {
+		return nil
+	}
+	if err := validateDate(msg.EditDate, now); err != nil {
+		return fmt.Errorf("edit %w", err)
+	}
+	if msg.EditDate < msg.Date {
+		return errors.New("edited before it was sent")
+	}
+	return nil
+}
+
+// validateCallback checks a callback query. Queries from inline messages
+// come without the message.
+func validateCallback(query *models.CallbackQuery, now time.Time) error {
+	if query.ID == "" {
+		return errors.New("query without an ID")
+	}
+	if err := validateUser(&query.From); err != nil {
+		return err
+	}
+	switch query.Message.Type {
+	case models.MaybeInaccessibleMessageTypeMessage:
+		if query.Message.Message != nil {
+			return validateMessage(query.Message.Message, now, true)
+		}
+	case models.MaybeInaccessibleMessageTypeInaccessibleMessage:
+		if query.Message.InaccessibleMessage != nil && query.Message.InaccessibleMessage.Chat.ID == 0 {
+			return errors.New("message without a chat")
+		}
+	}
+	return nil
+}
+
+// validateReaction checks a change of the reactions to a message
+func validateReaction(reaction *models.MessageReactionUpdated, now time.Time) error {
+	if reaction.Chat.ID == 0 {
+		return errors.New("reaction without a chat")
+	}
+	if reaction.MessageID <= 0 {
+		return errors.New("reaction without a message ID")
+	}
+	if reaction.User != nil {
+		if err := validateUser(reaction.User); err != nil {
+			return err
+		}
+	}
+	return validateDate(reaction.Date, now)
+}
+
+// validateMember checks a change of a chat member
+func validateMember(member *models.ChatMemberUpdated, now time.Time) error {
+	if member.Chat.ID == 0 {
+		return errors.New("member change without a chat")
+	}
+	if err := validateUser(&member.From); err != nil {
+		return err
+	}
+	return validateDate(member.Date, now)
+}
+
+// validateUser checks the sender of an update
+func validateUser(user *models.User) error {
+	if user.ID == 0 {
+		return errors.New("sender without an ID")
+	}
+	return nil
+}
+
+// validateDate checks a Unix date is neither before Telegram existed nor
+// in the future
+func validateDate(date int, now time.Time) error {
+	at := time.Unix(int64(date), 0)
+	if at.Before(telegramEpoch) {
+		return fmt.Errorf("date %d before Telegram", date)
+	}
+	if at.After(now.Add(maxClockSkew)) {
+		return fmt.Errorf("date %s in the future", at.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// validateText checks the length of a text and that its entities fall
+// inside it
+func validateText(text string, entities []models.MessageEntity) error {
+	units := textutil.UTF16Len(text)
+	if units > maxTextUnits {
+		return fmt.Errorf("%d characters, more than Telegram allows", units)
+	}
+	for _, entity := range entities {
+		if entity.Offset < 0 || entity.Length <= 0 || entity.Offset+entity.Length > units {
+			return fmt.Errorf("%s entity at %d+%d outside of the text", entity.Type, entity.Offset, entity.Length)
+		}
+	}
+	return nil
+}
+
+// updateID returns the ID of an update, 0 for none
+func updateID(update *models.Update) int64 {
+	if update == nil {
+		return 0
+	}
+	return update.ID
+}
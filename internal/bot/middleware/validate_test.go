@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/message"
+	"github.com/graffic/wanon-go/internal/tenancy"
+	"github.com/graffic/wanon-go/internal/usage"
+)
+
+var validateNow = time.Date(2026, 9, 15, 12, 0, 0, 0, time.UTC)
+
+func validMessage() *models.Message {
+	return &models.Message{
+		ID:   10,
+		Date: int(validateNow.Add(-time.Minute).Unix()),
+		Chat: models.Chat{ID: -100123},
+		From: &models.User{ID: 42},
+		Text: "/addquote hi",
+		Entities: []models.MessageEntity{
+			{Type: models.MessageEntityTypeBotCommand, Offset: 0, Length: 9},
+		},
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func() *models.Update
+		err    string
+	}{
+		{"valid message", func() *models.Update {
+			return &models.Update{ID: 1, Message: validMessage()}
+		}, ""},
+		{"nil", func() *models.Update { return nil }, "empty update"},
+		{"zero ID", func() *models.Update {
+			return &models.Update{Message: validMessage()}
+		}, "update without an ID"},
+		{"two payloads", func() *models.Update {
+			return &models.Update{ID: 1, Message: validMessage(), EditedMessage: validMessage()}
+		}, "update with both message and edited_message"},
+		{"message without chat", func() *models.Update {
+			msg := validMessage()
+			msg.Chat.ID = 0
+			return &models.Update{ID: 1, Message: msg}
+		}, "message: message without a chat"},
+		{"sender without ID", func() *models.Update {
+			msg := validMessage()
+			msg.From = &models.User{}
+			return &models.Update{ID: 1, Message: msg}
+		}, "message: sender without an ID"},
+		{"date before Telegram", func() *models.Update {
+			msg := validMessage()
+			msg.Date = 0
+			return &models.Update{ID: 1, Message: msg}
+		}, "message: date 0 before Telegram"},
+		{"date in the future", func() *models.Update {
+			msg := validMessage()
+			msg.Date = int(validateNow.Add(48 * time.Hour).Unix())
+			return &models.Update{ID: 1, Message: msg}
+		}, "message: date 2026-09-17T12:00:00Z in the future"},
+		{"entity past the text", func() *models.Update {
+			msg := validMessage()
+			msg.Entities[0].Length = 20
+			return &models.Update{ID: 1, Message: msg}
+		}, "message: text: bot_command entity at 0+20 outside of the text"},
+		{"text too long", func() *models.Update {
+			msg := validMessage()
+			msg.Text = strings.Repeat("😀", 2049)
+			return &models.Update{ID: 1, Message: msg}
+		}, "message: text: 4098 characters, more than Telegram allows"},
+		{"nested reply", func() *models.Update {
+			msg := validMessage()
+			msg.ReplyToMessage = validMessage()
+			msg.ReplyToMessage.ReplyToMessage = validMessage()
+			return &models.Update{ID: 1, Message: msg}
+		}, "message: reply_to_message: reply nested in a reply"},
+		{"edited before sent", func() *models.Update {
+			msg := validMessage()
+			msg.EditDate = msg.Date - 60
+			return &models.Update{ID: 1, EditedMessage: msg}
+		}, "edited_message: edited before it was sent"},
+		{"callback without sender", func() *models.Update {
+			return &models.Update{ID: 1, CallbackQuery: &models.CallbackQuery{ID: "q"}}
+		}, "callback_query: sender without an ID"},
+		{"inline callback", func() *models.Update {
+			return &models.Update{ID: 1, CallbackQuery: &models.CallbackQuery{ID: "q", From: models.User{ID: 42}, InlineMessageID: "i"}}
+		}, ""},
+		{"reaction without message", func() *models.Update {
+			return &models.Update{ID: 1, MessageReaction: &models.MessageReactionUpdated{Chat: models.Chat{ID: -100123}, Date: validMessage().Date}}
+		}, "message_reaction: reaction without a message ID"},
+		{"poll answer", func() *models.Update {
+			return &models.Update{ID: 1, PollAnswer: &models.PollAnswer{PollID: "p", User: &models.User{ID: 42}, OptionIDs: []int{1}}}
+		}, ""},
+		{"poll answer without voter", func() *models.Update {
+			return &models.Update{ID: 1, PollAnswer: &models.PollAnswer{PollID: "p"}}
+		}, "poll_answer: answer without a voter"},
+		{"unhandled kind", func() *models.Update {
+			return &models.Update{ID: 1, Poll: &models.Poll{}}
+		}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateUpdate(tt.update(), validateNow)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("expected a valid update, got %v", err)
+			case tt.err != "" && (err == nil || err.Error() != tt.err):
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestValidator_DropsInvalidUpdates(t *testing.T) {
+	validator := NewValidator(newTestLogger()).WithClock(clock.NewMock(validateNow))
+	var handled []int64
+	handler := validator.Middleware()(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		handled = append(handled, update.ID)
+	})
+
+	handler(context.Background(), nil, &models.Update{ID: 1, Message: validMessage()})
+	handler(context.Background(), nil, &models.Update{ID: 2, Message: &models.Message{}})
+	handler(context.Background(), nil, nil)
+
+	if len(handled) != 1 || handled[0] != 1 {
+		t.Errorf("expected only update 1 handled, got %v", handled)
+	}
+	if validator.Rejected() != 2 {
+		t.Errorf("expected 2 rejected updates, got %d", validator.Rejected())
+	}
+	var out strings.Builder
+	if err := validator.WritePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "wanon_updates_rejected_total 2\n") {
+		t.Errorf("unexpected metrics:\n%s", out.String())
+	}
+}
+
+// discardRecorder accepts usage entries without storing them
+type discardRecorder struct{}
+
+func (discardRecorder) Record(ctx context.Context, entry *usage.Entry) error { return nil }
+
+// FuzzMiddlewareChain feeds update JSON through the middlewares that run
+// without a database or Telegram, in the order the bot chains them, and a
+// handler doing what the cache does with messages. Any panic fails.
+func FuzzMiddlewareChain(f *testing.F) {
+	seeds := []any{
+		&models.Update{ID: 1, Message: validMessage()},
+		&models.Update{ID: 2, EditedMessage: validMessage()},
+		&models.Update{ID: 3, CallbackQuery: &models.CallbackQuery{ID: "q", From: models.User{ID: 42}, Data: "page:2"}},
+		&models.Update{ID: 4, MessageReaction: &models.MessageReactionUpdated{Chat: models.Chat{ID: -100123}, MessageID: 10, Date: validMessage().Date}},
+		&models.Update{ID: 5, PollAnswer: &models.PollAnswer{PollID: "p", User: &models.User{ID: 42}, OptionIDs: []int{0}}},
+	}
+	for _, seed := range seeds {
+		data, err := json.Marshal(seed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte(`{"update_id":5,"message":{"message_id":1,"date":1757930400,"chat":{"id":1,"type":"private"},"text":"/rquote@wanonbot","entities":[{"type":"bot_command","offset":0,"length":16}]}}`))
+	f.Add([]byte(`{"update_id":6,"message":{"message_id":1,"date":1757930400,"chat":{"id":-1},"text":"😀","entities":[{"type":"bold","offset":1,"length":1}]}}`))
+	f.Add([]byte(`{"update_id":7,"callback_query":{"id":"q","from":{"id":1},"message":{"chat":{"id":-1},"message_id":3,"date":0}}}`))
+	f.Add([]byte(`{"update_id":8,"message":null}`))
+	f.Add([]byte(`{}`))
+
+	logger := newTestLogger()
+	commands := []string{"addquote", "rquote"}
+	tenants, err := tenancy.New(nil, nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+	chain := []bot.Middleware{
+		NewValidator(logger).WithClock(clock.NewMock(validateNow)).Middleware(),
+		ExceptPrivateCommands(ChatFilterFunc(func(int64) bool { return true }, false, logger), "myexport"),
+		NewCoalescer(time.Minute, []string{"rquote"}, logger).WithClock(clock.NewMock(validateNow)).Middleware(),
+		tenancy.Middleware(tenancy.NewEnforcer(tenants, nil, logger), commands, logger),
+		usage.Middleware(discardRecorder{}, commands, logger),
+		events.Middleware(),
+	}
+	router := botcmd.NewRouter(logger).Handle(botcmd.KindMessage, func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		if _, err := message.FromTelegram(update.Message).JSON(); err != nil {
+			panic(err)
+		}
+	})
+	handler := router.Dispatch
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var update models.Update
+		if err := json.Unmarshal(data, &update); err != nil {
+			return
+		}
+		handler(context.Background(), nil, &update)
+	})
+}
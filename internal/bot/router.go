@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// UpdateKind is the kind of an update, named after its Bot API field
+type UpdateKind string
+
+const (
+	KindMessage      UpdateKind = "message"
+	KindEdited       UpdateKind = "edited_message"
+	KindChannelPost  UpdateKind = "channel_post"
+	KindReaction     UpdateKind = "message_reaction"
+	KindCallback     UpdateKind = "callback_query"
+	KindMyChatMember UpdateKind = "my_chat_member"
+	KindChatMember   UpdateKind = "chat_member"
+	KindInline       UpdateKind = "inline_query"
+	KindPollAnswer   UpdateKind = "poll_answer"
+	KindUnknown      UpdateKind = ""
+)
+
+// KindOf returns the kind of an update
+func KindOf(update *models.Update) UpdateKind {
+	switch {
+	case update == nil:
+		return KindUnknown
+	case update.Message != nil:
+		return KindMessage
+	case update.EditedMessage != nil:
+		return KindEdited
+	case update.ChannelPost != nil:
+		return KindChannelPost
+	case update.MessageReaction != nil:
+		return KindReaction
+	case update.CallbackQuery != nil:
+		return KindCallback
+	case update.MyChatMember != nil:
+		return KindMyChatMember
+	case update.ChatMember != nil:
+		return KindChatMember
+	case update.InlineQuery != nil:
+		return KindInline
+	case update.PollAnswer != nil:
+		return KindPollAnswer
+	}
+	return KindUnknown
+}
+
+// Router dispatches the updates no command or callback handler matched to
+// the handlers of their kind. It is the bot's default handler: a subsystem
+// taking a new kind of update registers for it here.
+type Router struct {
+	routes map[UpdateKind][]bot.HandlerFunc
+	logger *slog.Logger
+}
+
+// NewRouter creates a router without routes
+func NewRouter(logger *slog.Logger) *Router {
+	return &Router{routes: make(map[UpdateKind][]bot.HandlerFunc), logger: logger}
+}
+
+// Handle routes the updates of a kind to handler, run through its own
+// middlewares, the first one outermost. Handlers of the same kind run in
+// the order they were registered.
+func (r *Router) Handle(kind UpdateKind, handler bot.HandlerFunc, middlewares ...bot.Middleware) *Router {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	r.routes[kind] = append(r.routes[kind], handler)
+	return r
+}
+
+// Kinds returns the kinds of update with a route, in order
+func (r *Router) Kinds() []UpdateKind {
+	kinds := make([]UpdateKind, 0, len(r.routes))
+	for kind := range r.routes {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+	return kinds
+}
+
+// Dispatch runs the handlers of the update kind. Updates of kinds without
+// a route are only logged.
+func (r *Router) Dispatch(ctx context.Context, b *bot.Bot, update *models.Update) {
+	kind := KindOf(update)
+	handlers := r.routes[kind]
+	if len(handlers) == 0 {
+		r.logger.Debug("no route for update", "kind", kind, "update_id", updateID(update))
+		return
+	}
+	for _, handler := range handlers {
+		handler(ctx, b, update)
+	}
+}
+
+// updateID returns the ID of an update, 0 for none
+func updateID(update *models.Update) int64 {
+	if update == nil {
+		return 0
+	}
+	return update.ID
+}
@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		update   *models.Update
+		expected UpdateKind
+	}{
+		{&models.Update{Message: &models.Message{}}, KindMessage},
+		{&models.Update{EditedMessage: &models.Message{}}, KindEdited},
+		{&models.Update{ChannelPost: &models.Message{}}, KindChannelPost},
+		{&models.Update{MessageReaction: &models.MessageReactionUpdated{}}, KindReaction},
+		{&models.Update{CallbackQuery: &models.CallbackQuery{}}, KindCallback},
+		{&models.Update{MyChatMember: &models.ChatMemberUpdated{}}, KindMyChatMember},
+		{&models.Update{ChatMember: &models.ChatMemberUpdated{}}, KindChatMember},
+		{&models.Update{InlineQuery: &models.InlineQuery{}}, KindInline},
+		{&models.Update{PollAnswer: &models.PollAnswer{}}, KindPollAnswer},
+		{&models.Update{Poll: &models.Poll{}}, KindUnknown},
+		{nil, KindUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.expected), func(t *testing.T) {
+			assert.Equal(t, tt.expected, KindOf(tt.update))
+		})
+	}
+}
+
+func TestRouter_Dispatch(t *testing.T) {
+	var calls []string
+	record := func(name string) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			calls = append(calls, name)
+		}
+	}
+	wrap := func(name string) bot.Middleware {
+		return func(next bot.HandlerFunc) bot.HandlerFunc {
+			return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+				calls = append(calls, name)
+				next(ctx, b, update)
+			}
+		}
+	}
+
+	router := NewRouter(slog.New(slog.NewTextHandler(io.Discard, nil))).
+		Handle(KindMessage, record("messages"), wrap("outer"), wrap("inner")).
+		Handle(KindMessage, record("messages again")).
+		Handle(KindReaction, record("reactions"))
+	assert.Equal(t, []UpdateKind{KindMessage, KindReaction}, router.Kinds())
+
+	router.Dispatch(context.Background(), nil, &models.Update{Message: &models.Message{}})
+	assert.Equal(t, []string{"outer", "inner", "messages", "messages again"}, calls)
+
+	calls = nil
+	router.Dispatch(context.Background(), nil, &models.Update{MessageReaction: &models.MessageReactionUpdated{}})
+	assert.Equal(t, []string{"reactions"}, calls)
+
+	// Kinds without a route are dropped
+	calls = nil
+	router.Dispatch(context.Background(), nil, &models.Update{InlineQuery: &models.InlineQuery{}})
+	assert.Empty(t, calls)
+}
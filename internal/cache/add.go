@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"log/slog"
 
+	"github.com/graffic/wanon-go/internal/message"
 	"gorm.io/datatypes"
 )
 
@@ -24,15 +25,12 @@ func NewAddCommand(service *Service, logger *slog.Logger) *AddCommand {
 
 // Execute processes a message and adds it to the cache
 func (c *AddCommand) Execute(ctx context.Context, rawMessage json.RawMessage) error {
-	var msg Message
-	if err := json.Unmarshal(rawMessage, &msg); err != nil {
+	msg, err := message.Parse(rawMessage)
+	if err != nil {
 		c.logger.Error("failed to unmarshal message", "error", err)
 		return err
 	}
 
-	// Store the raw message for later use
-	msg.Raw = rawMessage
-
 	c.logger.Debug("adding message to cache",
 		"chat_id", msg.Chat.ID,
 		"message_id", msg.MessageID,
@@ -42,15 +40,16 @@ func (c *AddCommand) Execute(ctx context.Context, rawMessage json.RawMessage) er
 	entry := &CacheEntry{
 		ChatID:    msg.Chat.ID,
 		MessageID: msg.MessageID,
+		ReplyID:   msg.ReplyToID(),
 		Date:      msg.Date,
 	}
 
-	if msg.ReplyTo != nil {
-		entry.ReplyID = &msg.ReplyTo.MessageID
+	// Store the message in its canonical form, sensitive data masked
+	if err := c.service.redactor.Apply(ctx, msg); err != nil {
+		c.logger.Error("failed to redact message", "error", err)
+		return err
 	}
-
-	// Store the full message as JSON
-	messageJSON, err := json.Marshal(msg)
+	messageJSON, err := msg.JSON()
 	if err != nil {
 		c.logger.Error("failed to marshal message", "error", err)
 		return err
@@ -99,6 +99,36 @@ func TestAdd_StoresFullMessageJSON(t *testing.T) {
 	assert.Equal(t, message.Text, storedMessage.Text)
 }
 
+func TestAdd_StoresSenderFields(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	adder := NewAddCommand(NewService(db.DB), logger)
+
+	err := adder.Execute(context.Background(), json.RawMessage(`{
+		"message_id": 1,
+		"chat": {"id": 123, "type": "supergroup"},
+		"date": 1609459200,
+		"text": "New episode",
+		"from": {"id": 777000, "first_name": "Telegram"},
+		"via_bot": {"id": 9, "first_name": "GIF", "username": "gif", "is_bot": true},
+		"sender_chat": {"id": -100555, "type": "channel", "title": "News"},
+		"is_automatic_forward": true
+	}`))
+	require.NoError(t, err)
+
+	var entry CacheEntry
+	err = db.DB.First(&entry, "chat_id = ? AND message_id = ?", 123, 1).Error
+	require.NoError(t, err)
+
+	var stored Message
+	require.NoError(t, json.Unmarshal(entry.Message, &stored))
+	assert.True(t, stored.IsAutomaticForward)
+	require.NotNil(t, stored.SenderChat)
+	assert.Equal(t, "News", stored.SenderChat.Title)
+	require.NotNil(t, stored.ViaBot)
+	assert.True(t, stored.ViaBot.IsBot)
+}
+
 func TestAdd_DuplicateMessageUpdates(t *testing.T) {
 	db := testutils.NewTestDB(t)
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
@@ -2,9 +2,11 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
 	"time"
 
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/message"
+	"github.com/graffic/wanon-go/internal/redact"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
@@ -17,6 +19,8 @@ type CacheEntry struct {
 	ReplyID   *int64         `gorm:"index"`
 	Date      int64          `gorm:"index;not null"`
 	Message   datatypes.JSON `gorm:"type:jsonb;not null"`
+	KeepUntil *int64         // Unix time until which the cleaner spares it, set by /keep
+	Outgoing  bool           `gorm:"not null;default:false"` // Sent by the bot itself, see AddOutgoing
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -28,52 +32,51 @@ func (CacheEntry) TableName() string {
 
 // Service provides cache operations
 type Service struct {
-	db *gorm.DB
+	db       *gorm.DB
+	clock    clock.Clock
+	redactor *redact.Redactor
 }
 
 // NewService creates a new cache service
 func NewService(db *gorm.DB) *Service {
-	return &Service{db: db}
+	return &Service{db: db, clock: clock.System{}}
 }
 
-// Message represents a Telegram message for caching
-type Message struct {
-	MessageID int64           `json:"message_id"`
-	Chat      Chat            `json:"chat"`
-	Date      int64           `json:"date"`
-	Text      string          `json:"text,omitempty"`
-	From      *User           `json:"from,omitempty"`
-	ReplyTo   *Message        `json:"reply_to_message,omitempty"`
-	Raw       json.RawMessage `json:"-"`
+// WithClock replaces the time source used to compute cutoffs
+func (s *Service) WithClock(clk clock.Clock) *Service {
+	s.clock = clk
+	return s
 }
 
-// Chat represents a Telegram chat
-type Chat struct {
-	ID   int64  `json:"id"`
-	Type string `json:"type"`
+// WithRedactor masks sensitive data in the messages before they are cached
+func (s *Service) WithRedactor(redactor *redact.Redactor) *Service {
+	s.redactor = redactor
+	return s
 }
 
-// User represents a Telegram user
-type User struct {
-	ID        int64  `json:"id"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name,omitempty"`
-	Username  string `json:"username,omitempty"`
-}
+// Message is a Telegram message as cached, in its canonical form
+type Message = message.Message
+
+// Chat is a Telegram chat
+type Chat = message.Chat
+
+// User is a Telegram user
+type User = message.User
 
 // Add adds or updates a message in the cache
 func (s *Service) Add(ctx context.Context, msg *Message) error {
+	if err := s.redactor.Apply(ctx, msg); err != nil {
+		return err
+	}
 	entry := &CacheEntry{
 		ChatID:    msg.Chat.ID,
 		MessageID: msg.MessageID,
 		Date:      msg.Date,
 	}
 
-	if msg.ReplyTo != nil {
-		entry.ReplyID = &msg.ReplyTo.MessageID
-	}
+	entry.ReplyID = msg.ReplyToID()
 
-	messageJSON, err := json.Marshal(msg)
+	messageJSON, err := msg.JSON()
 	if err != nil {
 		return err
 	}
@@ -86,6 +89,26 @@ func (s *Service) Add(ctx context.Context, msg *Message) error {
 		FirstOrCreate(entry).Error
 }
 
+// AddOutgoing adds or updates a message the bot sent, replying to replyID
+// if not nil. Telegram does not send bots their own messages, so they are
+// cached from the replies that carry them, which leave out what the
+// message replied to in turn.
+func (s *Service) AddOutgoing(ctx context.Context, msg *Message, replyID *int64) error {
+	if err := s.redactor.Apply(ctx, msg); err != nil {
+		return err
+	}
+	messageJSON, err := msg.JSON()
+	if err != nil {
+		return err
+	}
+	entry := &CacheEntry{ChatID: msg.Chat.ID, MessageID: msg.MessageID}
+	return s.db.WithContext(ctx).
+		Where("chat_id = ? AND message_id = ?", entry.ChatID, entry.MessageID).
+		Attrs(map[string]interface{}{"reply_id": replyID, "outgoing": true}).
+		Assign(map[string]interface{}{"date": msg.Date, "message": datatypes.JSON(messageJSON)}).
+		FirstOrCreate(entry).Error
+}
+
 // Edit updates a cached message with edited content
 func (s *Service) Edit(ctx context.Context, msg *Message) error {
 	var entry CacheEntry
@@ -102,7 +125,10 @@ func (s *Service) Edit(ctx context.Context, msg *Message) error {
 	}
 
 	// Update the message JSON
-	messageJSON, err := json.Marshal(msg)
+	if err := s.redactor.Apply(ctx, msg); err != nil {
+		return err
+	}
+	messageJSON, err := msg.JSON()
 	if err != nil {
 		return err
 	}
@@ -136,41 +162,43 @@ func (s *Service) GetByReply(ctx context.Context, chatID, replyID int64) ([]Cach
 
 // Clean removes cache entries older than the specified duration
 func (s *Service) Clean(ctx context.Context, keepDuration time.Duration) error {
-	cutoff := time.Now().Add(-keepDuration).Unix()
+	cutoff := s.clock.Now().Add(-keepDuration).Unix()
 	return s.db.WithContext(ctx).
-		Where("date < ?", cutoff).
+		Where("date < ? AND (keep_until IS NULL OR keep_until < ?)", cutoff, s.clock.Now().Unix()).
 		Delete(&CacheEntry{}).Error
 }
 
-// GetChain retrieves a chain of messages starting from a given message ID
-// It follows reply chains recursively
-func (s *Service) GetChain(ctx context.Context, chatID, messageID int64) ([]CacheEntry, error) {
-	var entries []CacheEntry
-	currentID := messageID
-	seen := make(map[int64]bool)
-
-	for {
-		if seen[currentID] {
-			// Prevent infinite loops
-			break
-		}
-		seen[currentID] = true
-
-		entry, err := s.Get(ctx, chatID, currentID)
-		if err != nil {
-			if err == gorm.ErrRecordNotFound {
-				break
-			}
-			return nil, err
-		}
-
-		entries = append([]CacheEntry{*entry}, entries...)
-
-		if entry.ReplyID == nil {
-			break
-		}
-		currentID = *entry.ReplyID
+// Keep spares a cached message and the messages it replies to from the
+// cleaner until the given time, or longer if they were already kept longer.
+// It returns how many messages are kept, 0 when the message is not cached.
+func (s *Service) Keep(ctx context.Context, chatID, messageID int64, until time.Time) (int, error) {
+	chain, err := s.GetChain(ctx, chatID, messageID)
+	if err != nil {
+		return 0, err
+	}
+	if len(chain) == 0 {
+		return 0, nil
+	}
+	ids := make([]uint, len(chain))
+	for i, entry := range chain {
+		ids[i] = entry.ID
 	}
+	err = s.db.WithContext(ctx).
+		Model(&CacheEntry{}).
+		Where("id IN ?", ids).
+		Update("keep_until", gorm.Expr("GREATEST(COALESCE(keep_until, 0), ?)", until.Unix())).Error
+	if err != nil {
+		return 0, err
+	}
+	return len(chain), nil
+}
 
-	return entries, nil
+// GetChain retrieves the reply chain ending at a message, oldest first,
+// up to DefaultMaxChainDepth messages
+func (s *Service) GetChain(ctx context.Context, chatID, messageID int64) ([]CacheEntry, error) {
+	chain, err := s.Chain(ctx, chatID, messageID, ChainOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return chain.Entries, nil
 }
@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// DefaultMaxChainDepth is how many messages of a reply chain are followed
+// unless told otherwise
+const DefaultMaxChainDepth = 100
+
+// ChainEnd tells why following a reply chain stopped
+type ChainEnd string
+
+const (
+	// ChainRoot is a complete chain: its oldest message replies to nothing
+	// or starts a thread of its own
+	ChainRoot ChainEnd = "root"
+	// ChainMissing is a chain whose next message is not cached, usually
+	// because it expired
+	ChainMissing ChainEnd = "missing"
+	// ChainCycle is a chain whose next message was already in it
+	ChainCycle ChainEnd = "cycle"
+	// ChainMaxDepth is a chain longer than the maximum depth, cut at its
+	// newest messages
+	ChainMaxDepth ChainEnd = "max_depth"
+)
+
+// Chain is a reply chain read from the cache
+type Chain struct {
+	Entries []CacheEntry // Oldest message first
+	End     ChainEnd
+}
+
+// Partial reports whether older messages of the chain were left out for
+// the maximum depth. A cycle leaves nothing out, every message in it is
+// already in the chain, and expired messages are not in the cache to begin
+// with.
+func (c *Chain) Partial() bool {
+	return c.End == ChainMaxDepth
+}
+
+// ChainOptions tunes how a reply chain is followed
+type ChainOptions struct {
+	// MaxDepth is the most messages followed; DefaultMaxChainDepth if 0
+	MaxDepth int
+	// Resolve replaces each message before it joins the chain, e.g. a
+	// forward by its original in another chat. The chain goes on with the
+	// replacement's reply. Nil keeps every message.
+	Resolve func(ctx context.Context, entry CacheEntry) (CacheEntry, error)
+	// Root reports whether a message is the root of its chain even if it
+	// replies to another one. Nil only stops at messages without a reply.
+	Root func(entry CacheEntry) bool
+}
+
+// chainQuery reads the part of a reply chain within one chat, newest
+// message first, in a single query. The depth bounds it, cycles included.
+const chainQuery = `
+WITH RECURSIVE chain AS (
+	SELECT e.*, 1 AS depth FROM cache_entry e WHERE e.chat_id = ? AND e.message_id = ?
+	UNION ALL
+	SELECT e.*, c.depth + 1 FROM cache_entry e
+	JOIN chain c ON e.chat_id = c.chat_id AND e.message_id = c.reply_id
+	WHERE c.depth < ?
+)
+SELECT * FROM chain ORDER BY depth`
+
+// Chain follows the reply chain ending at a message back through the cache.
+// It stops at the root, at an uncached message, at a message already seen,
+// which reply chains across forwards can lead back to, or at the maximum
+// depth, and reports which in the chain's End.
+//
+// The messages are read a chat at a time with a recursive query rather
+// than one query per message, so a chain costs one query plus one for
+// every jump Resolve makes to another chat.
+func (s *Service) Chain(ctx context.Context, chatID, messageID int64, opts ChainOptions) (*Chain, error) {
+	maxDepth := opts.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxChainDepth
+	}
+
+	chain := &Chain{}
+	fetched := newChainWindow()
+	visited := make(map[[2]int64]bool)
+	currentChat, currentID := chatID, messageID
+	for {
+		entry, ok := fetched.get(currentChat, currentID)
+		if !ok && !fetched.missing[[2]int64{currentChat, currentID}] {
+			if err := s.fetchChain(ctx, fetched, currentChat, currentID, maxDepth-len(chain.Entries)); err != nil {
+				return nil, err
+			}
+			entry, ok = fetched.get(currentChat, currentID)
+		}
+		if !ok {
+			chain.End = ChainMissing
+			break
+		}
+		if opts.Resolve != nil {
+			resolved, err := opts.Resolve(ctx, *entry)
+			if err != nil {
+				return nil, err
+			}
+			entry = &resolved
+		}
+
+		key := [2]int64{entry.ChatID, entry.MessageID}
+		if visited[key] {
+			chain.End = ChainCycle
+			break
+		}
+		visited[key] = true
+		chain.Entries = append(chain.Entries, *entry)
+
+		if entry.ReplyID == nil || *entry.ReplyID == 0 || (opts.Root != nil && opts.Root(*entry)) {
+			chain.End = ChainRoot
+			break
+		}
+		if len(chain.Entries) == maxDepth {
+			chain.End = ChainMaxDepth
+			break
+		}
+		currentChat, currentID = entry.ChatID, *entry.ReplyID
+	}
+
+	slices.Reverse(chain.Entries)
+	return chain, nil
+}
+
+// chainWindow holds the messages read ahead while following a chain, and
+// the ones known not to be cached
+type chainWindow struct {
+	entries map[[2]int64]CacheEntry
+	missing map[[2]int64]bool
+}
+
+func newChainWindow() *chainWindow {
+	return &chainWindow{entries: make(map[[2]int64]CacheEntry), missing: make(map[[2]int64]bool)}
+}
+
+// get returns a message read ahead
+func (w *chainWindow) get(chatID, messageID int64) (*CacheEntry, bool) {
+	entry, ok := w.entries[[2]int64{chatID, messageID}]
+	return &entry, ok
+}
+
+// fetchChain reads up to depth messages of the chain from a message into
+// the window. When the chain ends before depth, the message the last one
+// replies to is not cached.
+func (s *Service) fetchChain(ctx context.Context, window *chainWindow, chatID, messageID int64, depth int) error {
+	var entries []CacheEntry
+	if err := s.db.WithContext(ctx).Raw(chainQuery, chatID, messageID, depth).Scan(&entries).Error; err != nil {
+		return fmt.Errorf("failed to fetch cache entries: %w", err)
+	}
+	for _, entry := range entries {
+		window.entries[[2]int64{entry.ChatID, entry.MessageID}] = entry
+	}
+	if len(entries) == 0 {
+		window.missing[[2]int64{chatID, messageID}] = true
+		return nil
+	}
+	if last := entries[len(entries)-1]; len(entries) < depth && last.ReplyID != nil && *last.ReplyID != 0 {
+		window.missing[[2]int64{last.ChatID, *last.ReplyID}] = true
+	}
+	return nil
+}
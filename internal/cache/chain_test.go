@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// createChain caches messages 1 to n of chat 1, each replying to the one
+// before
+func createChain(t *testing.T, db *testutils.TestDB, n int64) {
+	t.Helper()
+	for id := int64(1); id <= n; id++ {
+		entry := CacheEntry{ChatID: 1, MessageID: id, Date: 100 + id, Message: datatypes.JSON(`{}`)}
+		if id > 1 {
+			reply := id - 1
+			entry.ReplyID = &reply
+		}
+		require.NoError(t, db.DB.Create(&entry).Error)
+	}
+}
+
+func messageIDs(entries []CacheEntry) []int64 {
+	ids := make([]int64, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.MessageID
+	}
+	return ids
+}
+
+func TestService_Chain(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	service := NewService(db.DB)
+	ctx := context.Background()
+	createChain(t, db, 5)
+
+	chain, err := service.Chain(ctx, 1, 5, ChainOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, messageIDs(chain.Entries))
+	assert.Equal(t, ChainRoot, chain.End)
+	assert.False(t, chain.Partial())
+
+	// Exactly as long as the maximum depth is still complete
+	chain, err = service.Chain(ctx, 1, 5, ChainOptions{MaxDepth: 5})
+	require.NoError(t, err)
+	assert.Equal(t, ChainRoot, chain.End)
+
+	chain, err = service.Chain(ctx, 1, 5, ChainOptions{MaxDepth: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 4, 5}, messageIDs(chain.Entries), "the newest messages are kept")
+	assert.Equal(t, ChainMaxDepth, chain.End)
+	assert.True(t, chain.Partial())
+
+	chain, err = service.Chain(ctx, 1, 5, ChainOptions{Root: func(entry CacheEntry) bool { return entry.MessageID == 4 }})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4, 5}, messageIDs(chain.Entries))
+	assert.Equal(t, ChainRoot, chain.End)
+
+	chain, err = service.Chain(ctx, 1, 99, ChainOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, chain.Entries)
+	assert.Equal(t, ChainMissing, chain.End)
+}
+
+func TestService_Chain_Missing(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	service := NewService(db.DB)
+	createChain(t, db, 3)
+	require.NoError(t, db.DB.Where("message_id = ?", 1).Delete(&CacheEntry{}).Error)
+
+	chain, err := service.Chain(context.Background(), 1, 3, ChainOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 3}, messageIDs(chain.Entries))
+	assert.Equal(t, ChainMissing, chain.End)
+	assert.False(t, chain.Partial())
+}
+
+func TestService_Chain_Cycle(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	service := NewService(db.DB)
+	createChain(t, db, 3)
+	// Message 1 answering message 3 closes a loop
+	require.NoError(t, db.DB.Model(&CacheEntry{}).Where("message_id = ?", 1).Update("reply_id", 3).Error)
+
+	chain, err := service.Chain(context.Background(), 1, 3, ChainOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, messageIDs(chain.Entries), "each message once")
+	assert.Equal(t, ChainCycle, chain.End)
+	assert.False(t, chain.Partial())
+}
+
+func TestService_Chain_Resolve(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	service := NewService(db.DB)
+	createChain(t, db, 2)
+	// A copy of message 2 in chat 2 resolves back to the original
+	require.NoError(t, db.DB.Create(&CacheEntry{ChatID: 2, MessageID: 7, Date: 110, Message: datatypes.JSON(`{}`)}).Error)
+
+	resolve := func(ctx context.Context, entry CacheEntry) (CacheEntry, error) {
+		if entry.ChatID != 2 {
+			return entry, nil
+		}
+		original, err := service.Get(ctx, 1, 2)
+		if err != nil {
+			return entry, err
+		}
+		return *original, nil
+	}
+	chain, err := service.Chain(context.Background(), 2, 7, ChainOptions{Resolve: resolve})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, messageIDs(chain.Entries))
+	assert.Equal(t, int64(1), chain.Entries[1].ChatID)
+}
+
+// queryCounter counts the statements run through a gorm session
+type queryCounter struct {
+	logger.Interface
+	queries atomic.Int64
+}
+
+func (c *queryCounter) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	c.queries.Add(1)
+}
+
+func TestService_Chain_SingleQuery(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	createChain(t, db, 30)
+	counter := &queryCounter{Interface: logger.Discard}
+	service := NewService(db.DB.Session(&gorm.Session{Logger: counter}))
+
+	chain, err := service.Chain(context.Background(), 1, 30, ChainOptions{})
+	require.NoError(t, err)
+	assert.Len(t, chain.Entries, 30)
+	assert.Equal(t, int64(1), counter.queries.Load(), "the whole chain in one query")
+
+	// A chain cut short by an expired message does not look it up again
+	require.NoError(t, db.DB.Where("message_id = ?", 10).Delete(&CacheEntry{}).Error)
+	counter.queries.Store(0)
+	chain, err = service.Chain(context.Background(), 1, 30, ChainOptions{})
+	require.NoError(t, err)
+	assert.Len(t, chain.Entries, 20)
+	assert.Equal(t, ChainMissing, chain.End)
+	assert.Equal(t, int64(1), counter.queries.Load())
+}
@@ -3,13 +3,40 @@ package cache
 import (
 	"context"
 	"log/slog"
+	"sync"
 	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/events"
 )
 
 // Config holds cache cleaner configuration
 type Config struct {
 	CleanInterval time.Duration
 	KeepDuration  time.Duration
+	// CompactAfter is the age after which cached messages are stripped down to
+	// their quotable fields. Zero disables compaction.
+	CompactAfter time.Duration
+}
+
+// quotableFields are the top-level message keys kept by compaction. They are
+// everything the Builder and Renderer need to turn a cache entry into a quote.
+var quotableFields = []string{
+	"message_id",
+	"chat",
+	"date",
+	"edit_date",
+	"text",
+	"caption",
+	"entities",
+	"caption_entities",
+	"from",
+	"via_bot",
+	"sender_chat",
+	"is_automatic_forward",
+	"forward_origin",
+	"reply_to_message",
+	"media",
 }
 
 // Cleaner periodically cleans old cache entries
@@ -17,6 +44,12 @@ type Cleaner struct {
 	service *Service
 	config  Config
 	logger  *slog.Logger
+	clock   clock.Clock
+	events  events.Publisher
+
+	mu      sync.Mutex
+	lastRun time.Time // Zero until the first cleanup finishes
+	lastErr error
 }
 
 // NewCleaner creates a new cache cleaner
@@ -25,18 +58,32 @@ func NewCleaner(service *Service, config Config, logger *slog.Logger) *Cleaner {
 		service: service,
 		config:  config,
 		logger:  logger,
+		clock:   clock.System{},
 	}
 }
 
+// WithClock replaces the time source used to compute cutoffs
+func (c *Cleaner) WithClock(clk clock.Clock) *Cleaner {
+	c.clock = clk
+	return c
+}
+
+// WithEvents publishes every cleanup
+func (c *Cleaner) WithEvents(publisher events.Publisher) *Cleaner {
+	c.events = publisher
+	return c
+}
+
 // Start begins the periodic cleanup process
 func (c *Cleaner) Start(ctx context.Context) error {
 	c.logger.Info("starting cache cleaner",
 		"clean_interval", c.config.CleanInterval,
 		"keep_duration", c.config.KeepDuration,
+		"compact_after", c.config.CompactAfter,
 	)
 
 	// Perform initial cleanup
-	if err := c.clean(ctx); err != nil {
+	if err := c.run(ctx); err != nil {
 		c.logger.Error("initial cache cleanup failed", "error", err)
 	}
 
@@ -50,22 +97,52 @@ func (c *Cleaner) Start(ctx context.Context) error {
 			c.logger.Info("stopping cache cleaner")
 			return ctx.Err()
 		case <-ticker.C:
-			if err := c.clean(ctx); err != nil {
+			if err := c.run(ctx); err != nil {
 				c.logger.Error("cache cleanup failed", "error", err)
 			}
 		}
 	}
 }
 
-// clean removes old cache entries
+// run cleans the cache and records the outcome for LastRun
+func (c *Cleaner) run(ctx context.Context) error {
+	err := c.clean(ctx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastRun = c.clock.Now()
+	c.lastErr = err
+	return err
+}
+
+// LastRun returns when the last cleanup finished and its error, if any.
+// The time is zero if no cleanup has run yet.
+func (c *Cleaner) LastRun() (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastRun, c.lastErr
+}
+
+// clean removes old cache entries. Chats with a cache retention in their
+// settings use it instead of the global KeepDuration, and entries kept with
+// /keep stay until their keep_until.
 func (c *Cleaner) clean(ctx context.Context) error {
 	c.logger.Debug("running cache cleanup")
 
-	cutoff := time.Now().Add(-c.config.KeepDuration).Unix()
+	now := c.clock.Now().Unix()
+	keep := int64(c.config.KeepDuration / time.Second)
+	cutoff := now - keep
 
-	result := c.service.db.WithContext(ctx).
-		Where("date < ?", cutoff).
-		Delete(&CacheEntry{})
+	result := c.service.db.WithContext(ctx).Exec(`
+		DELETE FROM cache_entry
+		WHERE id IN (
+			SELECT e.id
+			FROM cache_entry e
+			LEFT JOIN chat_settings s ON s.chat_id = e.chat_id
+			WHERE e.date < ? - COALESCE(NULLIF(s.cache_retention_seconds, 0), ?)
+			AND (e.keep_until IS NULL OR e.keep_until < ?)
+		)`,
+		now, keep, now,
+	)
 
 	if result.Error != nil {
 		return result.Error
@@ -76,10 +153,52 @@ func (c *Cleaner) clean(ctx context.Context) error {
 		"cutoff_unix", cutoff,
 	)
 
+	compacted, err := c.compact(ctx)
+	if err != nil {
+		return err
+	}
+	events.Publish(ctx, c.events, events.CacheCleaned, 0, events.CacheCleanup{Deleted: result.RowsAffected, Compacted: compacted})
 	return nil
 }
 
+// compact strips heavy fields (media thumbnails, keyboards...) from entries
+// older than CompactAfter, keeping only the quotable fields. Entries
+// that are already compact are left untouched.
+func (c *Cleaner) compact(ctx context.Context) (int64, error) {
+	if c.config.CompactAfter <= 0 {
+		return 0, nil
+	}
+
+	cutoff := c.clock.Now().Add(-c.config.CompactAfter).Unix()
+
+	result := c.service.db.WithContext(ctx).Exec(`
+		UPDATE cache_entry
+		SET message = (
+				SELECT COALESCE(jsonb_object_agg(key, value), '{}'::jsonb)
+				FROM jsonb_each(message)
+				WHERE key IN ?
+			),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE date < ?
+		AND EXISTS (
+			SELECT 1 FROM jsonb_object_keys(message) AS key WHERE key NOT IN ?
+		)`,
+		quotableFields, cutoff, quotableFields,
+	)
+
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	c.logger.Info("cache compaction completed",
+		"compacted", result.RowsAffected,
+		"cutoff_unix", cutoff,
+	)
+
+	return result.RowsAffected, nil
+}
+
 // CleanOnce performs a single cleanup operation (useful for testing or manual cleanup)
 func (c *Cleaner) CleanOnce(ctx context.Context) error {
-	return c.clean(ctx)
+	return c.run(ctx)
 }
@@ -2,11 +2,14 @@ package cache
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log/slog"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/graffic/wanon-go/internal/clock"
 	"github.com/graffic/wanon-go/internal/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -165,3 +168,167 @@ func TestCleaner_StartStop(t *testing.T) {
 	db.DB.Model(&CacheEntry{}).Count(&count)
 	assert.Equal(t, int64(0), count)
 }
+
+func TestClean_CompactsOldEntries(t *testing.T) {
+	db := testutils.NewTestDB(t)
+
+	heavy := `{"message_id":1,"chat":{"id":1},"date":%d,"text":"hello","from":{"id":7,"first_name":"Ann"},` +
+		`"reply_to_message":{"message_id":0},"entities":[{"type":"bold","offset":0,"length":5}],` +
+		`"reply_markup":{"inline_keyboard":[]},"photo":[{"file_id":"x"}]}`
+
+	// Entry past the compaction threshold but inside the retention window
+	oldTime := time.Now().Add(-12 * time.Hour).Unix()
+	old := CacheEntry{ChatID: 1, MessageID: 1, Date: oldTime, Message: datatypes.JSON(fmt.Sprintf(heavy, oldTime))}
+	require.NoError(t, db.DB.Create(&old).Error)
+
+	// Recent entry that must keep every field
+	recentTime := time.Now().Add(-1 * time.Hour).Unix()
+	recent := CacheEntry{ChatID: 1, MessageID: 2, Date: recentTime, Message: datatypes.JSON(fmt.Sprintf(heavy, recentTime))}
+	require.NoError(t, db.DB.Create(&recent).Error)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	config := Config{
+		CleanInterval: time.Hour,
+		KeepDuration:  48 * time.Hour,
+		CompactAfter:  6 * time.Hour,
+	}
+	cleaner := NewCleaner(NewService(db.DB), config, logger)
+	require.NoError(t, cleaner.CleanOnce(context.Background()))
+
+	var compacted CacheEntry
+	require.NoError(t, db.DB.First(&compacted, old.ID).Error)
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(compacted.Message, &fields))
+	assert.Equal(t, "hello", fields["text"])
+	assert.Contains(t, fields, "from")
+	assert.Contains(t, fields, "reply_to_message")
+	assert.Contains(t, fields, "entities", "custom emoji are quoted from the entities")
+	assert.NotContains(t, fields, "reply_markup")
+	assert.NotContains(t, fields, "photo")
+
+	var untouched CacheEntry
+	require.NoError(t, db.DB.First(&untouched, recent.ID).Error)
+	fields = nil
+	require.NoError(t, json.Unmarshal(untouched.Message, &fields))
+	assert.Contains(t, fields, "entities")
+	assert.Contains(t, fields, "photo")
+}
+
+func TestClean_CompactionDisabled(t *testing.T) {
+	db := testutils.NewTestDB(t)
+
+	oldTime := time.Now().Add(-12 * time.Hour).Unix()
+	entry := CacheEntry{ChatID: 1, MessageID: 1, Date: oldTime, Message: datatypes.JSON(`{"text":"old","entities":[]}`)}
+	require.NoError(t, db.DB.Create(&entry).Error)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	config := Config{
+		CleanInterval: time.Hour,
+		KeepDuration:  48 * time.Hour,
+	}
+	cleaner := NewCleaner(NewService(db.DB), config, logger)
+	require.NoError(t, cleaner.CleanOnce(context.Background()))
+
+	var stored CacheEntry
+	require.NoError(t, db.DB.First(&stored, entry.ID).Error)
+	assert.Contains(t, string(stored.Message), "entities")
+}
+
+func TestClean_UsesInjectedClock(t *testing.T) {
+	db := testutils.NewTestDB(t)
+
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	entries := []CacheEntry{
+		{ChatID: 1, MessageID: 1, Date: now.Add(-49 * time.Hour).Unix(), Message: datatypes.JSON(`{"text":"old"}`)},
+		{ChatID: 1, MessageID: 2, Date: now.Add(-47 * time.Hour).Unix(), Message: datatypes.JSON(`{"text":"recent"}`)},
+	}
+	for _, entry := range entries {
+		require.NoError(t, db.DB.Create(&entry).Error)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	config := Config{
+		CleanInterval: time.Hour,
+		KeepDuration:  48 * time.Hour,
+	}
+	clk := clock.NewMock(now)
+	cleaner := NewCleaner(NewService(db.DB), config, logger).WithClock(clk)
+
+	lastRun, _ := cleaner.LastRun()
+	assert.True(t, lastRun.IsZero())
+
+	require.NoError(t, cleaner.CleanOnce(context.Background()))
+	lastRun, err := cleaner.LastRun()
+	require.NoError(t, err)
+	assert.Equal(t, now, lastRun)
+
+	var count int64
+	db.DB.Model(&CacheEntry{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// Two hours later the remaining entry expires too
+	clk.Advance(2 * time.Hour)
+	require.NoError(t, cleaner.CleanOnce(context.Background()))
+	db.DB.Model(&CacheEntry{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestClean_UsesPerChatRetention(t *testing.T) {
+	db := testutils.NewTestDB(t)
+
+	// Chat 2 keeps messages for a week, chat 3 only for a day
+	require.NoError(t, db.DB.Exec(`INSERT INTO chat_settings (chat_id, cache_retention_seconds) VALUES (2, ?), (3, ?)`,
+		int64((7*24*time.Hour).Seconds()), int64((24*time.Hour).Seconds())).Error)
+
+	threeDaysAgo := time.Now().Add(-72 * time.Hour).Unix()
+	thirtyHoursAgo := time.Now().Add(-30 * time.Hour).Unix()
+	entries := []CacheEntry{
+		{ChatID: 1, MessageID: 1, Date: threeDaysAgo, Message: datatypes.JSON(`{"text":"global old"}`)},
+		{ChatID: 1, MessageID: 2, Date: thirtyHoursAgo, Message: datatypes.JSON(`{"text":"global recent"}`)},
+		{ChatID: 2, MessageID: 1, Date: threeDaysAgo, Message: datatypes.JSON(`{"text":"week old"}`)},
+		{ChatID: 3, MessageID: 1, Date: thirtyHoursAgo, Message: datatypes.JSON(`{"text":"day old"}`)},
+	}
+	for _, entry := range entries {
+		require.NoError(t, db.DB.Create(&entry).Error)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	config := Config{
+		CleanInterval: time.Hour,
+		KeepDuration:  48 * time.Hour,
+	}
+	cleaner := NewCleaner(NewService(db.DB), config, logger)
+	require.NoError(t, cleaner.CleanOnce(context.Background()))
+
+	var remaining []CacheEntry
+	require.NoError(t, db.DB.Order("chat_id, message_id").Find(&remaining).Error)
+	require.Len(t, remaining, 2)
+	assert.Equal(t, int64(1), remaining[0].ChatID)
+	assert.Equal(t, int64(2), remaining[0].MessageID)
+	assert.Equal(t, int64(2), remaining[1].ChatID)
+}
+
+func TestClean_SparesKeptEntries(t *testing.T) {
+	db := testutils.NewTestDB(t)
+
+	oldTime := time.Now().Add(-72 * time.Hour).Unix()
+	keptUntil := time.Now().Add(24 * time.Hour).Unix()
+	expiredKeep := time.Now().Add(-time.Hour).Unix()
+	entries := []CacheEntry{
+		{ChatID: 1, MessageID: 1, Date: oldTime, Message: datatypes.JSON(`{"text":"kept"}`), KeepUntil: &keptUntil},
+		{ChatID: 1, MessageID: 2, Date: oldTime, Message: datatypes.JSON(`{"text":"keep over"}`), KeepUntil: &expiredKeep},
+		{ChatID: 1, MessageID: 3, Date: oldTime, Message: datatypes.JSON(`{"text":"old"}`)},
+	}
+	for _, entry := range entries {
+		require.NoError(t, db.DB.Create(&entry).Error)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	cleaner := NewCleaner(NewService(db.DB), Config{CleanInterval: time.Hour, KeepDuration: 48 * time.Hour}, logger)
+	require.NoError(t, cleaner.CleanOnce(context.Background()))
+
+	var remaining []CacheEntry
+	require.NoError(t, db.DB.Find(&remaining).Error)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, int64(1), remaining[0].MessageID)
+}
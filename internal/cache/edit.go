@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"log/slog"
 
+	"github.com/graffic/wanon-go/internal/message"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
@@ -23,20 +24,13 @@ func NewEditCommand(service *Service, logger *slog.Logger) *EditCommand {
 	}
 }
 
-// EditedMessage represents a message edit from Telegram
-type EditedMessage struct {
-	MessageID int64  `json:"message_id"`
-	Chat      Chat   `json:"chat"`
-	Date      int64  `json:"date"`
-	EditDate  int64  `json:"edit_date"`
-	Text      string `json:"text,omitempty"`
-	From      *User  `json:"from,omitempty"`
-}
+// EditedMessage is a message edit from Telegram, with its EditDate set
+type EditedMessage = Message
 
 // Execute processes an edited message and updates it in the cache
 func (c *EditCommand) Execute(ctx context.Context, rawMessage json.RawMessage) error {
-	var editedMsg EditedMessage
-	if err := json.Unmarshal(rawMessage, &editedMsg); err != nil {
+	editedMsg, err := message.Parse(rawMessage)
+	if err != nil {
 		c.logger.Error("failed to unmarshal edited message", "error", err)
 		return err
 	}
@@ -66,20 +60,26 @@ func (c *EditCommand) Execute(ctx context.Context, rawMessage json.RawMessage) e
 	}
 
 	// Parse the existing message
-	var existingMsg Message
-	if err := json.Unmarshal(entry.Message, &existingMsg); err != nil {
+	existingMsg, err := message.Parse(entry.Message)
+	if err != nil {
 		c.logger.Error("failed to unmarshal existing message", "error", err)
 		return err
 	}
 
-	// Update the message fields
+	// Update the message fields, sensitive data masked
+	if err := c.service.redactor.Apply(ctx, editedMsg); err != nil {
+		c.logger.Error("failed to redact edited message", "error", err)
+		return err
+	}
 	existingMsg.Text = editedMsg.Text
+	existingMsg.Caption = editedMsg.Caption
+	existingMsg.EditDate = editedMsg.EditDate
 	if editedMsg.From != nil {
 		existingMsg.From = editedMsg.From
 	}
 
 	// Marshal the updated message
-	updatedJSON, err := json.Marshal(existingMsg)
+	updatedJSON, err := existingMsg.JSON()
 	if err != nil {
 		c.logger.Error("failed to marshal updated message", "error", err)
 		return err
@@ -57,6 +57,7 @@ func TestEdit_UpdatesExistingMessage(t *testing.T) {
 	err = json.Unmarshal(updatedEntry.Message, &storedMessage)
 	require.NoError(t, err)
 	assert.Equal(t, "Edited text", storedMessage.Text)
+	assert.Equal(t, int64(1609459260), storedMessage.EditDate)
 }
 
 func TestEdit_NonExistentMessage(t *testing.T) {
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"gorm.io/gorm"
+)
+
+// defaultKeepDays is how long /keep spares a message without a number of
+// days
+const defaultKeepDays = 7
+
+// KeepHandler handles the /keep command
+type KeepHandler struct {
+	service *Service
+	outbox  *outbox.Outbox
+	maxDays int
+}
+
+// NewKeepHandler creates a new keep handler allowing up to 30 days
+func NewKeepHandler(db *gorm.DB) *KeepHandler {
+	return &KeepHandler{
+		service: NewService(db),
+		outbox:  outbox.New(db),
+		maxDays: 30,
+	}
+}
+
+// WithMaxDays sets the most days a message can be kept for
+func (h *KeepHandler) WithMaxDays(days int) *KeepHandler {
+	h.maxDays = days
+	return h
+}
+
+// Handle processes /keep [days] in reply to a message, sparing the message
+// and the ones it replies to from the cache cleaner so they can be quoted
+// later
+func (h *KeepHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+	days := min(defaultKeepDays, h.maxDays)
+	usage := fmt.Sprintf("Reply to a message with /keep [days] to keep it from expiring, for %d days or up to %d.", days, h.maxDays)
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	switch args.Len() {
+	case 0:
+	case 1:
+		n, err := strconv.Atoi(args.Arg(0))
+		if err != nil || n < 1 || n > h.maxDays {
+			return h.notice(ctx, b, chatID, usage)
+		}
+		days = n
+	default:
+		return h.notice(ctx, b, chatID, usage)
+	}
+	if msg.ReplyToMessage == nil {
+		return h.notice(ctx, b, chatID, usage)
+	}
+
+	until := h.service.clock.Now().AddDate(0, 0, days)
+	kept, err := h.service.Keep(ctx, chatID, int64(msg.ReplyToMessage.ID), until)
+	if err != nil {
+		return fmt.Errorf("failed to keep message: %w", err)
+	}
+	if kept == 0 {
+		return h.notice(ctx, b, chatID, "That message is no longer cached, so it cannot be kept.")
+	}
+	slog.Info("kept cached messages", "chat_id", chatID, "user_id", msg.From.ID, "message_id", msg.ReplyToMessage.ID, "messages", kept, "days", days)
+
+	text := fmt.Sprintf("📌 Kept this message for %d days. Quote it with /addquote before then.", days)
+	if kept > 1 {
+		text = fmt.Sprintf("📌 Kept this message and the %d before it for %d days. Quote them with /addquote before then.", kept-1, days)
+	}
+	return h.notice(ctx, b, chatID, text)
+}
+
+// notice sends a reply deleted after the chat's autodelete delay
+func (h *KeepHandler) notice(ctx context.Context, b *bot.Bot, chatID int64, text string) error {
+	_, err := h.outbox.Send(ctx, b, &outbox.Message{ChatID: chatID, Text: text, Transient: true})
+	return err
+}
+
+// Command returns the command name
+func (h *KeepHandler) Command() string {
+	return "/keep"
+}
+
+// Description returns the command description
+func (h *KeepHandler) Description() string {
+	return "Keep a message from expiring so you can quote it later"
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestService_Keep(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	service := NewService(db.DB)
+	ctx := context.Background()
+
+	first := int64(1)
+	for _, entry := range []CacheEntry{
+		{ChatID: 1, MessageID: 1, Date: 100, Message: datatypes.JSON(`{"text":"first"}`)},
+		{ChatID: 1, MessageID: 2, ReplyID: &first, Date: 101, Message: datatypes.JSON(`{"text":"answer"}`)},
+		{ChatID: 1, MessageID: 3, Date: 102, Message: datatypes.JSON(`{"text":"unrelated"}`)},
+	} {
+		require.NoError(t, db.DB.Create(&entry).Error)
+	}
+
+	until := time.Unix(5000, 0)
+	kept, err := service.Keep(ctx, 1, 2, until)
+	require.NoError(t, err)
+	assert.Equal(t, 2, kept, "the message and the one it replies to")
+
+	// Keeping for less does not shorten an earlier keep
+	kept, err = service.Keep(ctx, 1, 1, time.Unix(4000, 0))
+	require.NoError(t, err)
+	assert.Equal(t, 1, kept)
+
+	var entries []CacheEntry
+	require.NoError(t, db.DB.Order("message_id").Find(&entries).Error)
+	require.Len(t, entries, 3)
+	require.NotNil(t, entries[0].KeepUntil)
+	assert.Equal(t, int64(5000), *entries[0].KeepUntil)
+	require.NotNil(t, entries[1].KeepUntil)
+	assert.Equal(t, int64(5000), *entries[1].KeepUntil)
+	assert.Nil(t, entries[2].KeepUntil)
+
+	kept, err = service.Keep(ctx, 1, 99, until)
+	require.NoError(t, err)
+	assert.Zero(t, kept)
+}
+
+func TestKeepHandler(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	h.Register(NewKeepHandler(h.DB.DB).WithMaxDays(10))
+
+	cached := h.SendText(-100123, "worth quoting")
+	require.NoError(t, h.DB.DB.Create(&CacheEntry{
+		ChatID:    -100123,
+		MessageID: int64(cached.ID),
+		Date:      int64(cached.Date),
+		Message:   datatypes.JSON(`{"text":"worth quoting"}`),
+	}).Error)
+
+	h.ReplyText(cached, "/keep 3")
+	assert.Equal(t, "📌 Kept this message for 3 days. Quote it with /addquote before then.", h.LastReply())
+	var entry CacheEntry
+	require.NoError(t, h.DB.DB.Where("message_id = ?", cached.ID).First(&entry).Error)
+	require.NotNil(t, entry.KeepUntil)
+	assert.InDelta(t, time.Now().AddDate(0, 0, 3).Unix(), *entry.KeepUntil, 60)
+
+	usage := "Reply to a message with /keep [days] to keep it from expiring, for 7 days or up to 10."
+	h.SendText(-100123, "/keep")
+	assert.Equal(t, usage, h.LastReply())
+	h.ReplyText(cached, "/keep 11")
+	assert.Equal(t, usage, h.LastReply())
+	h.ReplyText(cached, "/keep soon")
+	assert.Equal(t, usage, h.LastReply())
+
+	gone := &models.Message{ID: 9999, Chat: models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}}
+	h.ReplyText(gone, "/keep")
+	assert.Equal(t, "That message is no longer cached, so it cannot be kept.", h.LastReply())
+}
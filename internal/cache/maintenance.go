@@ -0,0 +1,245 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/settings"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaintenanceMode is what the maintenance job runs on each table
+type MaintenanceMode string
+
+const (
+	// MaintenanceVacuum reclaims the space of deleted rows and refreshes
+	// the planner statistics
+	MaintenanceVacuum MaintenanceMode = "vacuum"
+	// MaintenanceAnalyze only refreshes the planner statistics
+	MaintenanceAnalyze MaintenanceMode = "analyze"
+)
+
+// ParseMaintenanceMode parses a maintenance mode, vacuum when empty
+func ParseMaintenanceMode(text string) (MaintenanceMode, error) {
+	switch mode := MaintenanceMode(text); mode {
+	case "":
+		return MaintenanceVacuum, nil
+	case MaintenanceVacuum, MaintenanceAnalyze:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown maintenance mode %q, expected vacuum or analyze", text)
+}
+
+// MaintenanceConfig holds the periodic maintenance of the cache tables
+type MaintenanceConfig struct {
+	// Interval is the least time between runs
+	Interval time.Duration
+	// Window holds the hours of the day, in UTC, runs may start in. Zero
+	// runs at any hour.
+	Window settings.QuietHours
+	Mode   MaintenanceMode
+	Tables []string
+}
+
+// tableStats are the measurements of a maintained table
+type tableStats struct {
+	live     int64 // Estimated live rows
+	dead     int64 // Estimated dead rows, the bloat a vacuum reclaims
+	bytes    int64 // Size with indexes and TOAST
+	ok       uint64
+	failed   uint64
+	duration time.Duration // Of the last run
+}
+
+// Maintainer vacuums and analyzes the high churn cache tables during quiet
+// hours, so the cleaner's deletes do not leave them bloated
+type Maintainer struct {
+	db     *gorm.DB
+	config MaintenanceConfig
+	logger *slog.Logger
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	lastRun time.Time // Zero until the first run starts
+	tables  map[string]*tableStats
+}
+
+// NewMaintainer creates the maintenance job of the configured tables
+func NewMaintainer(db *gorm.DB, config MaintenanceConfig, logger *slog.Logger) *Maintainer {
+	tables := make(map[string]*tableStats, len(config.Tables))
+	for _, table := range config.Tables {
+		tables[table] = &tableStats{}
+	}
+	return &Maintainer{
+		db:     db,
+		config: config,
+		logger: logger,
+		clock:  clock.System{},
+		tables: tables,
+	}
+}
+
+// WithClock replaces the time source deciding when to run
+func (m *Maintainer) WithClock(clk clock.Clock) *Maintainer {
+	m.clock = clk
+	return m
+}
+
+// Start measures the tables every check and maintains them when a run is
+// due, until ctx is done
+func (m *Maintainer) Start(ctx context.Context, check time.Duration) error {
+	m.logger.Info("starting cache maintenance",
+		"interval", m.config.Interval,
+		"window", m.config.Window.String(),
+		"mode", m.config.Mode,
+		"tables", m.config.Tables,
+	)
+
+	ticker := time.NewTicker(check)
+	defer ticker.Stop()
+
+	for {
+		if err := m.measure(ctx); err != nil {
+			m.logger.Error("failed to measure the cache tables", "error", err)
+		}
+		if m.due(m.clock.Now()) {
+			m.RunOnce(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			m.logger.Info("stopping cache maintenance")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// due reports whether a run should start at now: within the window and at
+// least an interval after the last one
+func (m *Maintainer) due(now time.Time) bool {
+	if !m.config.Window.IsZero() && m.config.Window.Defer(now, time.UTC).Equal(now) {
+		return false // Outside the window
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastRun.IsZero() || now.Sub(m.lastRun) >= m.config.Interval
+}
+
+// RunOnce maintains every table and measures them again afterwards. Failed
+// tables are logged and counted; the rest still run.
+func (m *Maintainer) RunOnce(ctx context.Context) {
+	m.mu.Lock()
+	m.lastRun = m.clock.Now()
+	m.mu.Unlock()
+
+	for _, table := range m.config.Tables {
+		start := time.Now()
+		err := m.maintain(ctx, table)
+		duration := time.Since(start)
+
+		m.mu.Lock()
+		stats := m.tables[table]
+		stats.duration = duration
+		if err != nil {
+			stats.failed++
+		} else {
+			stats.ok++
+		}
+		m.mu.Unlock()
+
+		if err != nil {
+			m.logger.Error("cache table maintenance failed", "table", table, "mode", m.config.Mode, "error", err)
+			continue
+		}
+		m.logger.Info("cache table maintenance completed", "table", table, "mode", m.config.Mode, "duration", duration)
+	}
+
+	if err := m.measure(ctx); err != nil {
+		m.logger.Error("failed to measure the cache tables", "error", err)
+	}
+}
+
+// maintain runs the configured mode on a table. VACUUM cannot run inside a
+// transaction, so it goes straight to the connection pool.
+func (m *Maintainer) maintain(ctx context.Context, table string) error {
+	sql := "VACUUM (ANALYZE) ?"
+	if m.config.Mode == MaintenanceAnalyze {
+		sql = "ANALYZE ?"
+	}
+	return m.db.WithContext(ctx).Exec(sql, clause.Table{Name: table}).Error
+}
+
+// measure refreshes the size and bloat of the tables from the statistics
+// Postgres keeps for the autovacuum
+func (m *Maintainer) measure(ctx context.Context) error {
+	var rows []struct {
+		Name  string
+		Live  int64
+		Dead  int64
+		Bytes int64
+	}
+	err := m.db.WithContext(ctx).Raw(`
+		SELECT relname AS name, n_live_tup AS live, n_dead_tup AS dead, pg_total_relation_size(relid) AS bytes
+		FROM pg_stat_user_tables
+		WHERE relname IN ?`,
+		m.config.Tables,
+	).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, row := range rows {
+		if stats, ok := m.tables[row.Name]; ok {
+			stats.live, stats.dead, stats.bytes = row.Live, row.Dead, row.Bytes
+		}
+	}
+	return nil
+}
+
+// WritePrometheus writes the table measurements and maintenance runs in the
+// Prometheus text format
+func (m *Maintainer) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tables := slices.Sorted(maps.Keys(m.tables))
+
+	var sb strings.Builder
+	metric := func(name, kind, help string, value func(*tableStats) string) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, table := range tables {
+			fmt.Fprintf(&sb, "%s{table=%q} %s\n", name, table, value(m.tables[table]))
+		}
+	}
+	metric("wanon_cache_table_live_rows", "gauge", "Estimated live rows of the maintained cache tables.",
+		func(s *tableStats) string { return fmt.Sprint(s.live) })
+	metric("wanon_cache_table_dead_rows", "gauge", "Estimated dead rows of the maintained cache tables, the bloat a vacuum reclaims.",
+		func(s *tableStats) string { return fmt.Sprint(s.dead) })
+	metric("wanon_cache_table_bytes", "gauge", "Size of the maintained cache tables with their indexes.",
+		func(s *tableStats) string { return fmt.Sprint(s.bytes) })
+	metric("wanon_cache_maintenance_duration_seconds", "gauge", "Duration of the last maintenance of each cache table.",
+		func(s *tableStats) string { return fmt.Sprint(s.duration.Seconds()) })
+
+	sb.WriteString("# HELP wanon_cache_maintenance_runs_total Maintenance runs of each cache table by result.\n" +
+		"# TYPE wanon_cache_maintenance_runs_total counter\n")
+	for _, table := range tables {
+		stats := m.tables[table]
+		fmt.Fprintf(&sb, "wanon_cache_maintenance_runs_total{table=%q,result=\"ok\"} %d\n", table, stats.ok)
+		fmt.Fprintf(&sb, "wanon_cache_maintenance_runs_total{table=%q,result=\"error\"} %d\n", table, stats.failed)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
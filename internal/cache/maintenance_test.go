@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/settings"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestParseMaintenanceMode(t *testing.T) {
+	mode, err := ParseMaintenanceMode("")
+	require.NoError(t, err)
+	assert.Equal(t, MaintenanceVacuum, mode)
+
+	mode, err = ParseMaintenanceMode("analyze")
+	require.NoError(t, err)
+	assert.Equal(t, MaintenanceAnalyze, mode)
+
+	_, err = ParseMaintenanceMode("repack")
+	assert.Error(t, err)
+}
+
+func TestMaintainer_Due(t *testing.T) {
+	window, err := settings.ParseQuietHours("23:00-02:00")
+	require.NoError(t, err)
+	m := NewMaintainer(nil, MaintenanceConfig{Interval: 20 * time.Hour, Window: window, Tables: []string{"cache_entry"}}, slog.Default())
+	day := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.False(t, m.due(day.Add(12*time.Hour)), "outside the window")
+	assert.True(t, m.due(day.Add(23*time.Hour)))
+	assert.True(t, m.due(day.Add(25*time.Hour)), "the window wraps past midnight")
+	assert.False(t, m.due(day.Add(26*time.Hour)), "the window ends")
+
+	m.lastRun = day.Add(23 * time.Hour)
+	assert.False(t, m.due(day.Add(24*time.Hour)), "already ran in this window")
+	assert.True(t, m.due(day.Add(47*time.Hour)))
+
+	m.config.Window = settings.QuietHours{}
+	assert.True(t, m.due(day.Add(67*time.Hour)), "no window runs at any hour")
+}
+
+func TestMaintainer_WritePrometheus(t *testing.T) {
+	m := NewMaintainer(nil, MaintenanceConfig{Tables: []string{"cache_entry"}}, slog.Default())
+	m.tables["cache_entry"] = &tableStats{live: 100, dead: 40, bytes: 8192, ok: 2, failed: 1, duration: 1500 * time.Millisecond}
+
+	var buf bytes.Buffer
+	require.NoError(t, m.WritePrometheus(&buf))
+	out := buf.String()
+	assert.Contains(t, out, "# TYPE wanon_cache_table_dead_rows gauge\nwanon_cache_table_dead_rows{table=\"cache_entry\"} 40\n")
+	assert.Contains(t, out, "wanon_cache_table_live_rows{table=\"cache_entry\"} 100\n")
+	assert.Contains(t, out, "wanon_cache_table_bytes{table=\"cache_entry\"} 8192\n")
+	assert.Contains(t, out, "wanon_cache_maintenance_duration_seconds{table=\"cache_entry\"} 1.5\n")
+	assert.Contains(t, out, "wanon_cache_maintenance_runs_total{table=\"cache_entry\",result=\"ok\"} 2\n")
+	assert.Contains(t, out, "wanon_cache_maintenance_runs_total{table=\"cache_entry\",result=\"error\"} 1\n")
+}
+
+func TestMaintainer_RunOnce(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	for i := int64(1); i <= 10; i++ {
+		require.NoError(t, db.DB.Create(&CacheEntry{ChatID: 1, MessageID: i, Date: 1, Message: datatypes.JSON(`{"text":"old"}`)}).Error)
+	}
+	require.NoError(t, db.DB.Where("chat_id = ?", 1).Delete(&CacheEntry{}).Error)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	now := time.Date(2024, time.May, 1, 3, 0, 0, 0, time.UTC)
+	m := NewMaintainer(db.DB, MaintenanceConfig{Interval: time.Hour, Mode: MaintenanceVacuum, Tables: []string{"cache_entry", "missing_table"}}, logger).
+		WithClock(clock.NewMock(now))
+	m.RunOnce(context.Background())
+
+	assert.Equal(t, uint64(1), m.tables["cache_entry"].ok)
+	assert.Equal(t, uint64(1), m.tables["missing_table"].failed, "a failing table does not stop the rest")
+	assert.Equal(t, now, m.lastRun)
+	assert.False(t, m.due(now.Add(time.Minute)))
+}
@@ -2,34 +2,55 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
 	"log/slog"
 
+	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/message"
+	"github.com/graffic/wanon-go/internal/outbox"
 )
 
 // Middleware provides cache integration for the dispatcher
 type Middleware struct {
+	service     *Service
 	addCommand  *AddCommand
 	editCommand *EditCommand
+	outbox      *outbox.Outbox
 	logger      *slog.Logger
+	quota       func(ctx context.Context, chatID int64) error
 }
 
 // NewMiddleware creates a new cache middleware
 func NewMiddleware(service *Service, logger *slog.Logger) *Middleware {
 	return &Middleware{
+		service:     service,
 		addCommand:  NewAddCommand(service, logger),
 		editCommand: NewEditCommand(service, logger),
+		outbox:      outbox.New(service.db),
 		logger:      logger,
 	}
 }
 
+// WithQuota checks each new message against a quota before caching it,
+// such as the cached messages of a hosting plan. Refused messages are not
+// cached; edits of cached messages still are.
+func (m *Middleware) WithQuota(quota func(ctx context.Context, chatID int64) error) *Middleware {
+	m.quota = quota
+	return m
+}
+
 // HandleUpdate processes an update through the cache
 // This should be registered with the dispatcher's AddUpdateHandler
 func (m *Middleware) HandleUpdate(ctx context.Context, update *models.Update) error {
+	return m.handleUpdate(ctx, 0, update)
+}
+
+// handleUpdate processes an update through the cache. With the ID of the
+// bot, self, the messages of the bot replied to are cached too.
+func (m *Middleware) handleUpdate(ctx context.Context, self int64, update *models.Update) error {
 	// Handle regular messages
 	if update.Message != nil {
-		return m.handleMessage(ctx, update.Message)
+		return m.handleMessage(ctx, self, update.Message)
 	}
 
 	// Handle edited messages
@@ -40,81 +61,66 @@ func (m *Middleware) HandleUpdate(ctx context.Context, update *models.Update) er
 	return nil
 }
 
-// handleMessage processes a regular message and adds it to cache
-func (m *Middleware) handleMessage(ctx context.Context, msg *models.Message) error {
-	// Convert to JSON for the AddCommand
-	msgData := map[string]interface{}{
-		"message_id": msg.ID,
-		"chat": map[string]interface{}{
-			"id":   msg.Chat.ID,
-			"type": msg.Chat.Type,
-		},
-		"date": msg.Date,
-	}
-
-	if msg.Text != "" {
-		msgData["text"] = msg.Text
-	}
-
-	if msg.From != nil {
-		msgData["from"] = map[string]interface{}{
-			"id":         msg.From.ID,
-			"first_name": msg.From.FirstName,
-		}
-		if msg.From.LastName != "" {
-			msgData["from"].(map[string]interface{})["last_name"] = msg.From.LastName
-		}
-		if msg.From.Username != "" {
-			msgData["from"].(map[string]interface{})["username"] = msg.From.Username
+// BotMiddleware returns a bot middleware caching every update before the
+// handlers run. Cache errors are logged and do not stop the update.
+func (m *Middleware) BotMiddleware() bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if err := m.handleUpdate(ctx, b.ID(), update); err != nil {
+				m.logger.Error("cache middleware error", "error", err)
+			}
+			next(ctx, b, update)
 		}
 	}
+}
 
-	if msg.ReplyToMessage != nil {
-		msgData["reply_to_message"] = map[string]interface{}{
-			"message_id": msg.ReplyToMessage.ID,
+// handleMessage processes a regular message and adds it to cache
+func (m *Middleware) handleMessage(ctx context.Context, self int64, msg *models.Message) error {
+	if m.quota != nil {
+		if err := m.quota(ctx, msg.Chat.ID); err != nil {
+			m.logger.Debug("not caching message over quota", "chat_id", msg.Chat.ID, "reason", err)
+			return nil
 		}
 	}
 
-	rawJSON, err := json.Marshal(msgData)
+	rawJSON, err := message.FromTelegram(msg).JSON()
 	if err != nil {
 		m.logger.Error("failed to marshal message for cache", "error", err)
 		return err
 	}
 
-	return m.addCommand.Execute(ctx, rawJSON)
+	if err := m.addCommand.Execute(ctx, rawJSON); err != nil {
+		return err
+	}
+	return m.handleOutgoing(ctx, self, msg.ReplyToMessage)
 }
 
-// handleEditedMessage processes an edited message and updates the cache
-func (m *Middleware) handleEditedMessage(ctx context.Context, msg *models.Message) error {
-	// Convert to JSON for the EditCommand
-	msgData := map[string]interface{}{
-		"message_id": msg.ID,
-		"chat": map[string]interface{}{
-			"id":   msg.Chat.ID,
-			"type": msg.Chat.Type,
-		},
-		"date":      msg.Date,
-		"edit_date": msg.EditDate,
+// handleOutgoing caches reply, the message a new one replies to, when the
+// bot sent it, so that reply chains go on through it. The message it
+// replied to in turn is taken from the outbox.
+func (m *Middleware) handleOutgoing(ctx context.Context, self int64, reply *models.Message) error {
+	if self == 0 || reply == nil || reply.From == nil || reply.From.ID != self {
+		return nil
 	}
-
-	if msg.Text != "" {
-		msgData["text"] = msg.Text
+	var replyID *int64
+	sent, err := m.outbox.Sent(ctx, reply.Chat.ID, reply.ID)
+	if err != nil {
+		return err
 	}
-
-	if msg.From != nil {
-		msgData["from"] = map[string]interface{}{
-			"id":         msg.From.ID,
-			"first_name": msg.From.FirstName,
-		}
-		if msg.From.LastName != "" {
-			msgData["from"].(map[string]interface{})["last_name"] = msg.From.LastName
-		}
-		if msg.From.Username != "" {
-			msgData["from"].(map[string]interface{})["username"] = msg.From.Username
-		}
+	if sent != nil && sent.ReplyToMessageID != 0 {
+		id := int64(sent.ReplyToMessageID)
+		replyID = &id
+	}
+	if err := m.service.AddOutgoing(ctx, message.FromTelegram(reply), replyID); err != nil {
+		m.logger.Error("failed to add bot message to cache", "error", err)
+		return err
 	}
+	return nil
+}
 
-	rawJSON, err := json.Marshal(msgData)
+// handleEditedMessage processes an edited message and updates the cache
+func (m *Middleware) handleEditedMessage(ctx context.Context, msg *models.Message) error {
+	rawJSON, err := message.FromTelegram(msg).JSON()
 	if err != nil {
 		m.logger.Error("failed to marshal edited message for cache", "error", err)
 		return err
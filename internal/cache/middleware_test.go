@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware_HandleUpdate_IgnoresOtherUpdates(t *testing.T) {
+	m := NewMiddleware(NewService(nil), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	assert.NoError(t, m.HandleUpdate(context.Background(), &models.Update{}))
+	assert.NoError(t, m.HandleUpdate(context.Background(), &models.Update{CallbackQuery: &models.CallbackQuery{ID: "1"}}))
+}
+
+func TestMiddleware_HandleUpdate_OverQuota(t *testing.T) {
+	var checked []int64
+	m := NewMiddleware(NewService(nil), slog.New(slog.NewTextHandler(io.Discard, nil))).
+		WithQuota(func(ctx context.Context, chatID int64) error {
+			checked = append(checked, chatID)
+			return errors.New("over quota")
+		})
+
+	// The service has no database: reaching it would panic
+	err := m.HandleUpdate(context.Background(), &models.Update{Message: &models.Message{ID: 1, Chat: models.Chat{ID: -100123}, Text: "hi"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{-100123}, checked)
+}
+
+func TestMiddleware_HandleOutgoing_IgnoresOthers(t *testing.T) {
+	m := NewMiddleware(NewService(nil), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	// The service has no database: reaching it would panic
+	assert.NoError(t, m.handleOutgoing(ctx, 99, nil))
+	assert.NoError(t, m.handleOutgoing(ctx, 99, &models.Message{ID: 1, Chat: models.Chat{ID: -100123}}))
+	assert.NoError(t, m.handleOutgoing(ctx, 99, &models.Message{ID: 1, Chat: models.Chat{ID: -100123}, From: &models.User{ID: 1}}))
+	assert.NoError(t, m.handleOutgoing(ctx, 0, &models.Message{ID: 1, Chat: models.Chat{ID: -100123}, From: &models.User{ID: 99, IsBot: true}}))
+}
+
+func TestMiddleware_HandleUpdate_CachesRepliedBotMessages(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+	service := NewService(db.DB)
+	m := NewMiddleware(service, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	chat := models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}
+
+	// The bot answered message 10 with message 11, through the outbox
+	now := time.Now()
+	require.NoError(t, db.DB.Create(&outbox.Message{ChatID: chat.ID, Text: "Sunny", ReplyToMessageID: 10, MessageID: 11, SentAt: &now}).Error)
+
+	self := &models.User{ID: 99, IsBot: true, FirstName: "wanon"}
+	update := &models.Update{Message: &models.Message{
+		ID:             12,
+		Chat:           chat,
+		From:           &models.User{ID: 1, FirstName: "Alice"},
+		Date:           1609459200,
+		Text:           "told you",
+		ReplyToMessage: &models.Message{ID: 11, Chat: chat, From: self, Date: 1609459100, Text: "Sunny"},
+	}}
+	require.NoError(t, m.handleUpdate(ctx, self.ID, update))
+
+	entry, err := service.Get(ctx, chat.ID, 11)
+	require.NoError(t, err)
+	assert.True(t, entry.Outgoing)
+	require.NotNil(t, entry.ReplyID)
+	assert.Equal(t, int64(10), *entry.ReplyID)
+	assert.Equal(t, int64(1609459100), entry.Date)
+
+	entry, err = service.Get(ctx, chat.ID, 12)
+	require.NoError(t, err)
+	assert.False(t, entry.Outgoing)
+
+	// Without the bot ID replies to it are cached alone
+	update.Message.ID = 13
+	update.Message.ReplyToMessage.ID = 14
+	require.NoError(t, m.HandleUpdate(ctx, update))
+	_, err = service.Get(ctx, chat.ID, 14)
+	assert.Error(t, err)
+}
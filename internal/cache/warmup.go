@@ -0,0 +1,298 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/message"
+)
+
+// warmupReportEvery is how many read messages go between progress reports
+const warmupReportEvery = 5000
+
+// Warmer fills the cache of a chat the bot just joined from a Telegram
+// Desktop export, so /addquote finds reply chains older than the bot. The
+// Bot API has no way to read past messages.
+type Warmer struct {
+	service *Service
+	dir     string
+	keep    time.Duration
+	logger  *slog.Logger
+	clock   clock.Clock
+	report  func(ctx context.Context, text string)
+}
+
+// NewWarmer creates a warmer loading "<chat id>.json" exports from dir. It
+// skips messages older than keep, or the chat's cache retention if set.
+func NewWarmer(service *Service, dir string, keep time.Duration, logger *slog.Logger) *Warmer {
+	return &Warmer{
+		service: service,
+		dir:     dir,
+		keep:    keep,
+		logger:  logger,
+		clock:   clock.System{},
+		report:  func(context.Context, string) {},
+	}
+}
+
+// WithClock replaces the time source used to skip old messages
+func (w *Warmer) WithClock(clk clock.Clock) *Warmer {
+	w.clock = clk
+	return w
+}
+
+// WithReport sets where progress reports go, e.g. the admin chat
+func (w *Warmer) WithReport(report func(ctx context.Context, text string)) *Warmer {
+	w.report = report
+	return w
+}
+
+// Enabled reports whether the warmer has a directory to load exports from
+func (w *Warmer) Enabled() bool {
+	return w.dir != ""
+}
+
+// WarmupResult is how a warm-up went
+type WarmupResult struct {
+	ChatID  int64
+	Read    int // Messages in the export
+	Added   int // Messages added to the cache
+	Old     int // Messages older than the retention
+	Skipped int // Service messages and messages without text
+}
+
+// String summarizes the result
+func (r WarmupResult) String() string {
+	return fmt.Sprintf("read %d messages of chat %d: %d cached, %d too old, %d skipped", r.Read, r.ChatID, r.Added, r.Old, r.Skipped)
+}
+
+// Warm loads the export of a chat if there is one. It returns false when
+// the warmer is disabled or has no export for the chat.
+func (w *Warmer) Warm(ctx context.Context, chatID int64) (WarmupResult, bool, error) {
+	if !w.Enabled() {
+		return WarmupResult{}, false, nil
+	}
+	path := filepath.Join(w.dir, strconv.FormatInt(chatID, 10)+".json")
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		w.logger.Debug("no export to warm up the cache", "chat_id", chatID, "path", path)
+		return WarmupResult{}, false, nil
+	}
+	if err != nil {
+		return WarmupResult{}, false, fmt.Errorf("failed to open export: %w", err)
+	}
+	defer f.Close()
+
+	w.report(ctx, fmt.Sprintf("Warming up the cache of chat %d from %s", chatID, filepath.Base(path)))
+	result, err := w.Load(ctx, chatID, f)
+	if err != nil {
+		w.report(ctx, fmt.Sprintf("Cache warm-up of chat %d failed after %d messages: %v", chatID, result.Read, err))
+		return result, true, err
+	}
+	w.report(ctx, "Cache warm-up done: "+result.String())
+	return result, true, nil
+}
+
+// Load adds the recent messages of a Telegram Desktop export (result.json)
+// to the cache of a chat. Only supergroup exports are accepted: message
+// IDs of basic groups differ between the exporting account and the bot.
+func (w *Warmer) Load(ctx context.Context, chatID int64, r io.Reader) (WarmupResult, error) {
+	result := WarmupResult{ChatID: chatID}
+	cutoff, err := w.cutoff(ctx, chatID)
+	if err != nil {
+		return result, err
+	}
+
+	dec := json.NewDecoder(r)
+	if err := readExportHeader(dec, chatID); err != nil {
+		return result, err
+	}
+	for dec.More() {
+		var entry exportMessage
+		if err := dec.Decode(&entry); err != nil {
+			return result, fmt.Errorf("invalid export message: %w", err)
+		}
+		result.Read++
+
+		msg := entry.message(chatID)
+		switch {
+		case msg == nil:
+			result.Skipped++
+		case msg.Date < cutoff:
+			result.Old++
+		default:
+			if err := w.service.Add(ctx, msg); err != nil {
+				return result, fmt.Errorf("failed to cache message %d: %w", msg.MessageID, err)
+			}
+			result.Added++
+		}
+
+		if result.Read%warmupReportEvery == 0 {
+			w.report(ctx, fmt.Sprintf("Cache warm-up of chat %d: %d messages read, %d cached", chatID, result.Read, result.Added))
+		}
+	}
+	w.logger.Info("cache warmed up", "chat_id", chatID, "read", result.Read, "added", result.Added, "old", result.Old, "skipped", result.Skipped)
+	return result, nil
+}
+
+// cutoff returns the date of the oldest message worth caching in the chat
+func (w *Warmer) cutoff(ctx context.Context, chatID int64) (int64, error) {
+	var retention int64
+	err := w.service.db.WithContext(ctx).Raw(
+		`SELECT COALESCE(MAX(cache_retention_seconds), 0) FROM chat_settings WHERE chat_id = ?`, chatID).
+		Scan(&retention).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to get cache retention: %w", err)
+	}
+	keep := w.keep
+	if retention > 0 {
+		keep = time.Duration(retention) * time.Second
+	}
+	return w.clock.Now().Add(-keep).Unix(), nil
+}
+
+// readExportHeader reads the export up to the start of its messages, checking
+// that it is the export of the chat
+func readExportHeader(dec *json.Decoder, chatID int64) error {
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return errors.New("not a Telegram Desktop export: expected a JSON object")
+	}
+	var exportType string
+	var exportID int64
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("invalid export: %w", err)
+		}
+		switch key, _ := tok.(string); key {
+		case "type":
+			err = dec.Decode(&exportType)
+		case "id":
+			err = dec.Decode(&exportID)
+		case "messages":
+			if !strings.HasSuffix(exportType, "supergroup") {
+				return fmt.Errorf("unsupported export of a %q chat, only supergroups can be loaded", exportType)
+			}
+			if channelChatID(exportID) != chatID {
+				return fmt.Errorf("export of chat %d, not %d", channelChatID(exportID), chatID)
+			}
+			if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+				return errors.New("invalid export: messages is not a list")
+			}
+			return nil
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid export: %w", err)
+		}
+	}
+	return errors.New("invalid export: no messages")
+}
+
+// channelChatID converts the ID of a supergroup or channel in exports to
+// its Bot API chat ID, e.g. 1234567890 to -1001234567890
+func channelChatID(id int64) int64 {
+	return -1_000_000_000_000 - id
+}
+
+// exportMessage is a message of a Telegram Desktop export
+type exportMessage struct {
+	ID           int64           `json:"id"`
+	Type         string          `json:"type"`
+	DateUnix     string          `json:"date_unixtime"`
+	EditedUnix   string          `json:"edited_unixtime"`
+	From         *string         `json:"from"`
+	FromID       string          `json:"from_id"`
+	ReplyToID    int64           `json:"reply_to_message_id"`
+	Text         json.RawMessage `json:"text"`
+	TextEntities []struct {
+		Text string `json:"text"`
+	} `json:"text_entities"`
+	Photo     string `json:"photo"`
+	File      string `json:"file"`
+	MediaType string `json:"media_type"`
+}
+
+// message converts the export message to its cached form, or nil for
+// service messages and messages without text
+func (m *exportMessage) message(chatID int64) *message.Message {
+	text := m.text()
+	if m.Type != "message" || text == "" {
+		return nil
+	}
+	date, _ := strconv.ParseInt(m.DateUnix, 10, 64)
+	edited, _ := strconv.ParseInt(m.EditedUnix, 10, 64)
+	msg := &message.Message{
+		MessageID: m.ID,
+		Chat:      message.Chat{ID: chatID, Type: "supergroup"},
+		Date:      date,
+		EditDate:  edited,
+	}
+	if m.Photo != "" || m.File != "" || m.MediaType != "" {
+		msg.Caption = text
+	} else {
+		msg.Text = text
+	}
+	if m.ReplyToID != 0 {
+		msg.ReplyTo = &message.Message{MessageID: m.ReplyToID}
+	}
+
+	name := "Deleted Account"
+	if m.From != nil {
+		name = *m.From
+	}
+	switch {
+	case strings.HasPrefix(m.FromID, "user"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(m.FromID, "user"), 10, 64)
+		msg.From = &message.User{ID: id, FirstName: name}
+	case strings.HasPrefix(m.FromID, "channel"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(m.FromID, "channel"), 10, 64)
+		msg.SenderChat = &message.Chat{ID: channelChatID(id), Type: "channel", Title: name}
+	}
+	return msg
+}
+
+// text returns the plain text of the message. Exports hold it as a string,
+// or as a list of strings and entities when it has formatting.
+func (m *exportMessage) text() string {
+	if len(m.TextEntities) > 0 {
+		var b strings.Builder
+		for _, entity := range m.TextEntities {
+			b.WriteString(entity.Text)
+		}
+		return b.String()
+	}
+	var text string
+	if json.Unmarshal(m.Text, &text) == nil {
+		return text
+	}
+	var parts []json.RawMessage
+	if json.Unmarshal(m.Text, &parts) != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, part := range parts {
+		var entity struct {
+			Text string `json:"text"`
+		}
+		if json.Unmarshal(part, &text) == nil {
+			b.WriteString(text)
+		} else if json.Unmarshal(part, &entity) == nil {
+			b.WriteString(entity.Text)
+		}
+	}
+	return b.String()
+}
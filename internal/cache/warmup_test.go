@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testExport is a Telegram Desktop export of supergroup -1001234567890
+const testExport = `{
+ "name": "Friends",
+ "type": "private_supergroup",
+ "id": 1234567890,
+ "messages": [
+  {"id": 1, "type": "service", "date_unixtime": "1704103200", "actor": "Ana", "action": "create_group"},
+  {"id": 2, "type": "message", "date_unixtime": "1672567200", "from": "Ana", "from_id": "user111", "text": "too old"},
+  {"id": 3, "type": "message", "date_unixtime": "1704103200", "from": "Ana", "from_id": "user111", "text": "hello", "text_entities": [{"type": "plain", "text": "hello"}]},
+  {"id": 4, "type": "message", "date_unixtime": "1704103260", "from": "Bob", "from_id": "user222", "reply_to_message_id": 3,
+   "text": ["see ", {"type": "bold", "text": "this"}], "text_entities": [{"type": "plain", "text": "see "}, {"type": "bold", "text": "this"}]},
+  {"id": 5, "type": "message", "date_unixtime": "1704103320", "from": "Friends", "from_id": "channel1234567890", "photo": "photos/1.jpg", "text": "a photo"},
+  {"id": 6, "type": "message", "date_unixtime": "1704103380", "from": null, "from_id": "user333", "sticker_emoji": "👍", "text": ""}
+ ]
+}`
+
+func TestExportMessage_Message(t *testing.T) {
+	var export struct {
+		Messages []exportMessage `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(testExport), &export))
+	const chatID = -1001234567890
+
+	assert.Nil(t, export.Messages[0].message(chatID), "service message")
+	assert.Nil(t, export.Messages[5].message(chatID), "no text")
+
+	reply := export.Messages[3].message(chatID)
+	assert.Equal(t, int64(4), reply.MessageID)
+	assert.Equal(t, int64(chatID), reply.Chat.ID)
+	assert.Equal(t, int64(1704103260), reply.Date)
+	assert.Equal(t, "see this", reply.Text)
+	assert.Equal(t, &User{ID: 222, FirstName: "Bob"}, reply.From)
+	assert.Equal(t, int64(3), *reply.ReplyToID())
+
+	photo := export.Messages[4].message(chatID)
+	assert.Empty(t, photo.Text)
+	assert.Equal(t, "a photo", photo.Caption)
+	assert.Nil(t, photo.From)
+	assert.Equal(t, &Chat{ID: chatID, Type: "channel", Title: "Friends"}, photo.SenderChat)
+}
+
+func TestReadExportHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		export      string
+		chatID      int64
+		errContains string
+	}{
+		{name: "supergroup", export: testExport, chatID: -1001234567890},
+		{name: "other chat", export: testExport, chatID: -1009999999999, errContains: "export of chat -1001234567890"},
+		{name: "basic group", export: `{"type": "private_group", "id": 42, "messages": []}`, chatID: -42, errContains: "only supergroups"},
+		{name: "not an object", export: `[]`, chatID: -42, errContains: "not a Telegram Desktop export"},
+		{name: "no messages", export: `{"type": "private_supergroup", "id": 42}`, chatID: -1000000000042, errContains: "no messages"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := readExportHeader(json.NewDecoder(strings.NewReader(tt.export)), tt.chatID)
+			if tt.errContains != "" {
+				assert.ErrorContains(t, err, tt.errContains)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWarmer_Warm(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "-1001234567890.json"), []byte(testExport), 0o600))
+
+	var reports []string
+	clk := clock.NewMock(time.Unix(1704103200, 0).Add(time.Hour))
+	warmer := NewWarmer(NewService(db.DB), dir, 48*time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil))).
+		WithClock(clk).
+		WithReport(func(ctx context.Context, text string) { reports = append(reports, text) })
+
+	result, ok, err := warmer.Warm(context.Background(), -1001234567890)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, WarmupResult{ChatID: -1001234567890, Read: 6, Added: 3, Old: 1, Skipped: 2}, result)
+	assert.Len(t, reports, 2)
+
+	chain, err := NewService(db.DB).GetChain(context.Background(), -1001234567890, 4)
+	require.NoError(t, err)
+	assert.Len(t, chain, 2)
+
+	_, ok, err = warmer.Warm(context.Background(), -1005555555555)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,134 @@
+package changelog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/settings"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Announcement is the last version whose notes were announced
+type Announcement struct {
+	ID          int `gorm:"primaryKey"` // Always 1, the table holds one row
+	Version     string
+	AnnouncedAt time.Time
+}
+
+// TableName specifies the table name for GORM
+func (Announcement) TableName() string {
+	return "release_announcement"
+}
+
+// Announcer posts the notes of the releases since the last announced one
+// to the admin and to the chats that opted in with /settings news on
+type Announcer struct {
+	db       *gorm.DB
+	releases []Release
+	settings *settings.Service
+	outbox   *outbox.Outbox
+	admin    func(ctx context.Context, text string)
+	allowed  func(chatID int64) bool
+	logger   *slog.Logger
+}
+
+// NewAnnouncer creates an announcer of releases
+func NewAnnouncer(db *gorm.DB, releases []Release, logger *slog.Logger) *Announcer {
+	return &Announcer{
+		db:       db,
+		releases: releases,
+		settings: settings.NewService(db),
+		outbox:   outbox.New(db),
+		admin:    func(context.Context, string) {},
+		allowed:  func(int64) bool { return true },
+		logger:   logger,
+	}
+}
+
+// WithAdmin sends the notes to the admin too, e.g. through the
+// notification sinks
+func (a *Announcer) WithAdmin(admin func(ctx context.Context, text string)) *Announcer {
+	a.admin = admin
+	return a
+}
+
+// WithAllowed only posts to the opted in chats the bot still works in
+func (a *Announcer) WithAllowed(allowed func(chatID int64) bool) *Announcer {
+	a.allowed = allowed
+	return a
+}
+
+// Announce posts the notes of the releases newer than the last announced
+// one, up to version, and records version as announced. The first run
+// only records it, so new installs are not sent the whole changelog, and
+// builds that are not vX.Y.Z releases announce nothing. Replicas starting
+// together announce once: the first to record the version posts it.
+func (a *Announcer) Announce(ctx context.Context, sender outbox.Sender, version string) error {
+	previous, ok, err := a.claim(ctx, version)
+	if err != nil || !ok {
+		return err
+	}
+	releases := Between(a.releases, previous, version)
+	if len(releases) == 0 {
+		a.logger.Info("upgraded without release notes", "from", previous, "to", version)
+		return nil
+	}
+	text := Text(releases)
+	a.admin(ctx, text)
+
+	chats, err := a.settings.NewsChats(ctx)
+	if err != nil {
+		return err
+	}
+	posted := 0
+	for _, chatID := range chats {
+		if !a.allowed(chatID) {
+			continue
+		}
+		if _, err := a.outbox.Send(ctx, sender, &outbox.Message{ChatID: chatID, Text: text}); err != nil {
+			a.logger.Warn("failed to post release notes", "chat_id", chatID, "error", err)
+			continue
+		}
+		posted++
+	}
+	a.logger.Info("announced release notes", "from", previous, "to", version, "chats", posted)
+	return nil
+}
+
+// claim records version as announced when it is newer than the last one,
+// returning the last one. It reports false on the first run and when
+// there is nothing new, either version is no release or another replica
+// claimed it first.
+func (a *Announcer) claim(ctx context.Context, version string) (string, bool, error) {
+	if _, ok := parseVersion(version); !ok {
+		return "", false, nil
+	}
+	var previous string
+	announce := false
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var last Announcement
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&last, 1).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Two first runs at once both land here; either row will do
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&Announcement{ID: 1, Version: version, AnnouncedAt: time.Now()}).Error
+		}
+		if err != nil {
+			return err
+		}
+		if !Newer(version, last.Version) {
+			return nil
+		}
+		previous, announce = last.Version, true
+		return tx.Model(&last).Updates(map[string]any{"version": version, "announced_at": time.Now()}).Error
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to record the announced release: %w", err)
+	}
+	return previous, announce, nil
+}
@@ -0,0 +1,71 @@
+package changelog
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/settings"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSender records sent messages
+type fakeSender struct {
+	sent []*bot.SendMessageParams
+}
+
+func (f *fakeSender) SendMessage(_ context.Context, params *bot.SendMessageParams) (*models.Message, error) {
+	f.sent = append(f.sent, params)
+	return &models.Message{ID: len(f.sent)}, nil
+}
+
+func TestAnnouncer_Announce(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+	releases, err := Parse(sample)
+	require.NoError(t, err)
+
+	service := settings.NewService(db.DB)
+	for _, chatID := range []int64{-100123, -100456, -100789} {
+		cs, err := service.Get(ctx, chatID)
+		require.NoError(t, err)
+		cs.News = chatID != -100789
+		require.NoError(t, service.Save(ctx, cs))
+	}
+
+	var admin []string
+	announcer := NewAnnouncer(db.DB, releases, slog.Default()).
+		WithAdmin(func(_ context.Context, text string) { admin = append(admin, text) }).
+		WithAllowed(func(chatID int64) bool { return chatID != -100456 })
+	sender := &fakeSender{}
+
+	// The first run only records the version
+	require.NoError(t, announcer.Announce(ctx, sender, "v1.0.0"))
+	assert.Empty(t, admin)
+	assert.Empty(t, sender.sent)
+
+	// Local builds announce nothing and keep the recorded version
+	require.NoError(t, announcer.Announce(ctx, sender, "(devel)"))
+	assert.Empty(t, admin)
+
+	require.NoError(t, announcer.Announce(ctx, sender, "v1.2.0"))
+	require.Len(t, admin, 1)
+	assert.Contains(t, admin[0], "What's new in wanon v1.2.0")
+	assert.Contains(t, admin[0], "Fix the digest")
+	require.Len(t, sender.sent, 1, "only the allowed chat that opted in")
+	assert.Equal(t, int64(-100123), sender.sent[0].ChatID)
+	assert.Equal(t, admin[0], sender.sent[0].Text)
+
+	// Restarting or rolling back announces nothing
+	require.NoError(t, announcer.Announce(ctx, sender, "v1.2.0"))
+	require.NoError(t, announcer.Announce(ctx, sender, "v1.1.1"))
+	assert.Len(t, admin, 1)
+
+	var last Announcement
+	require.NoError(t, db.DB.Take(&last).Error)
+	assert.Equal(t, "v1.2.0", last.Version)
+}
@@ -0,0 +1,144 @@
+// Package changelog announces what is new after the bot is upgraded. The
+// notes come from changelog.md, embedded in the binary: a "## vX.Y.Z"
+// heading per release, newest first, each followed by "- " notes. Notes
+// under "## Unreleased" wait for the release that ships them.
+package changelog
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//go:embed changelog.md
+var embedded string
+
+// unreleased is the heading of the notes not released yet
+const unreleased = "Unreleased"
+
+// Release is the notes of a version
+type Release struct {
+	Version string
+	Notes   []string
+}
+
+// Load returns the releases of the embedded changelog, newest first
+func Load() ([]Release, error) {
+	return Parse(embedded)
+}
+
+// Parse reads the releases of a changelog, newest first. Versions must be
+// vX.Y.Z and go down; the Unreleased section is left out.
+func Parse(text string) ([]Release, error) {
+	var releases []Release
+	var current *Release // Nil before the first heading and in Unreleased
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(text, "## "):
+			heading := strings.TrimSpace(strings.TrimPrefix(text, "## "))
+			current = nil
+			if heading == unreleased {
+				continue
+			}
+			version, ok := parseVersion(heading)
+			if !ok {
+				return nil, fmt.Errorf("changelog line %d: %q is not a vX.Y.Z version", line, heading)
+			}
+			if len(releases) > 0 {
+				previous, _ := parseVersion(releases[len(releases)-1].Version)
+				if compare(version, previous) >= 0 {
+					return nil, fmt.Errorf("changelog line %d: %s is not older than %s", line, heading, releases[len(releases)-1].Version)
+				}
+			}
+			releases = append(releases, Release{Version: heading})
+			current = &releases[len(releases)-1]
+		case strings.HasPrefix(text, "- ") && current != nil:
+			current.Notes = append(current.Notes, strings.TrimSpace(strings.TrimPrefix(text, "- ")))
+		}
+	}
+	return releases, scanner.Err()
+}
+
+// Between returns the releases newer than from, up to and including to,
+// newest first. Both must be vX.Y.Z versions; builds of a commit or a
+// pre-release have no notes.
+func Between(releases []Release, from, to string) []Release {
+	low, ok := parseVersion(from)
+	if !ok {
+		return nil
+	}
+	high, ok := parseVersion(to)
+	if !ok {
+		return nil
+	}
+	var between []Release
+	for _, release := range releases {
+		version, _ := parseVersion(release.Version)
+		if compare(version, low) > 0 && compare(version, high) <= 0 {
+			between = append(between, release)
+		}
+	}
+	return between
+}
+
+// Text renders the notes of releases, newest first, as a message
+func Text(releases []Release) string {
+	var sb strings.Builder
+	for i, release := range releases {
+		if i == 0 {
+			fmt.Fprintf(&sb, "🆕 What's new in wanon %s:\n", release.Version)
+		} else {
+			fmt.Fprintf(&sb, "\n%s:\n", release.Version)
+		}
+		for _, note := range release.Notes {
+			fmt.Fprintf(&sb, "• %s\n", note)
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// Newer reports whether version is a vX.Y.Z release newer than than, or
+// than is no release at all
+func Newer(version, than string) bool {
+	a, ok := parseVersion(version)
+	if !ok {
+		return false
+	}
+	b, ok := parseVersion(than)
+	return !ok || compare(a, b) > 0
+}
+
+// parseVersion parses a vX.Y.Z version, turning down pre-releases and
+// builds of a commit
+func parseVersion(version string) ([3]int, bool) {
+	var parsed [3]int
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if !strings.HasPrefix(version, "v") || len(parts) != 3 {
+		return parsed, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (len(part) > 1 && part[0] == '0') {
+			return parsed, false
+		}
+		parsed[i] = n
+	}
+	return parsed, true
+}
+
+// compare orders two versions like strings.Compare
+func compare(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+package changelog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sample = `# Changelog
+
+Intro text, ignored.
+
+## Unreleased
+
+- Not shipped yet
+
+## v1.2.0
+
+- /topquotes
+- Rating buttons
+
+## v1.1.1
+
+- Fix the digest
+
+## v1.0.0
+
+- First release
+`
+
+func TestParse(t *testing.T) {
+	releases, err := Parse(sample)
+	require.NoError(t, err)
+	assert.Equal(t, []Release{
+		{Version: "v1.2.0", Notes: []string{"/topquotes", "Rating buttons"}},
+		{Version: "v1.1.1", Notes: []string{"Fix the digest"}},
+		{Version: "v1.0.0", Notes: []string{"First release"}},
+	}, releases)
+
+	_, err = Parse("## 1.0\n- note\n")
+	assert.Error(t, err)
+	_, err = Parse("## v1.0.0\n## v1.1.0\n")
+	assert.Error(t, err, "versions must go down")
+
+	// The embedded changelog must always parse
+	_, err = Load()
+	assert.NoError(t, err)
+}
+
+func TestBetween(t *testing.T) {
+	releases, err := Parse(sample)
+	require.NoError(t, err)
+
+	between := Between(releases, "v1.0.0", "v1.2.0")
+	require.Len(t, between, 2)
+	assert.Equal(t, "v1.2.0", between[0].Version)
+	assert.Equal(t, "v1.1.1", between[1].Version)
+
+	assert.Len(t, Between(releases, "v1.0.0", "v1.1.5"), 1)
+	assert.Empty(t, Between(releases, "v1.2.0", "v1.2.0"))
+	assert.Empty(t, Between(releases, "(devel)", "v1.2.0"))
+
+	assert.Equal(t, "🆕 What's new in wanon v1.2.0:\n• /topquotes\n• Rating buttons\n\nv1.1.1:\n• Fix the digest", Text(between))
+}
+
+func TestNewer(t *testing.T) {
+	assert.True(t, Newer("v1.10.0", "v1.9.3"))
+	assert.True(t, Newer("v1.0.0", "(devel)"))
+	assert.False(t, Newer("v1.0.0", "v1.0.0"))
+	assert.False(t, Newer("v0.9.0", "v1.0.0"))
+	assert.False(t, Newer("(devel)", "v1.0.0"))
+	assert.False(t, Newer("v1.0.0-rc.1", "v0.9.0"))
+	assert.False(t, Newer("v1.01.0", "v0.9.0"))
+}
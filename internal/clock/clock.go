@@ -0,0 +1,53 @@
+// Package clock provides injectable time and randomness sources so that
+// scheduling and selection logic can be tested deterministically.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the real wall clock
+type System struct{}
+
+// Now returns the current local time
+func (System) Now() time.Time {
+	return time.Now()
+}
+
+// Mock is a manually driven clock for tests
+type Mock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewMock creates a mock clock frozen at now
+func NewMock(now time.Time) *Mock {
+	return &Mock{now: now}
+}
+
+// Now returns the frozen time
+func (m *Mock) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// Set freezes the clock at now
+func (m *Mock) Set(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+// Advance moves the clock forward by d
+func (m *Mock) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = m.now.Add(d)
+}
@@ -0,0 +1,42 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMock(start)
+
+	assert.Equal(t, start, m.Now())
+
+	m.Advance(90 * time.Minute)
+	assert.Equal(t, start.Add(90*time.Minute), m.Now())
+
+	m.Set(start)
+	assert.Equal(t, start, m.Now())
+}
+
+func TestSystem(t *testing.T) {
+	assert.WithinDuration(t, time.Now(), System{}.Now(), time.Second)
+}
+
+func TestNewSeeded_Deterministic(t *testing.T) {
+	a := NewSeeded(42)
+	b := NewSeeded(42)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, a.Int64N(1000), b.Int64N(1000))
+	}
+}
+
+func TestSystemRandom_Range(t *testing.T) {
+	var r Random = SystemRandom{}
+	for i := 0; i < 100; i++ {
+		n := r.Int64N(5)
+		assert.GreaterOrEqual(t, n, int64(0))
+		assert.Less(t, n, int64(5))
+	}
+}
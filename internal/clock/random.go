@@ -0,0 +1,24 @@
+package clock
+
+import (
+	"math/rand/v2"
+)
+
+// Random picks random numbers. *rand.Rand from math/rand/v2 implements it.
+type Random interface {
+	// Int64N returns a random number in [0, n). It panics if n <= 0.
+	Int64N(n int64) int64
+}
+
+// SystemRandom uses the automatically seeded global generator
+type SystemRandom struct{}
+
+// Int64N returns a random number in [0, n)
+func (SystemRandom) Int64N(n int64) int64 {
+	return rand.Int64N(n)
+}
+
+// NewSeeded returns a deterministic generator for tests
+func NewSeeded(seed uint64) *rand.Rand {
+	return rand.New(rand.NewPCG(seed, seed))
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -14,18 +15,82 @@ import (
 
 // Config holds all application configuration
 type Config struct {
-	Environment           string         `koanf:"environment"`
-	Telegram              TelegramConfig `koanf:"telegram"`
-	Database              DatabaseConfig `koanf:"database"`
-	Cache                 CacheConfig    `koanf:"cache"`
-	AllowedChatIDs        []int64        `koanf:"allowed_chat_ids"`
-	AutoLeaveUnauthorized bool           `koanf:"auto_leave_unauthorized"`
+	Environment           string              `koanf:"environment"`
+	Telegram              TelegramConfig      `koanf:"telegram"`
+	Database              DatabaseConfig      `koanf:"database"`
+	Startup               StartupConfig       `koanf:"startup"`
+	Cache                 CacheConfig         `koanf:"cache"`
+	Export                ExportConfig        `koanf:"export"`
+	Quotes                QuotesConfig        `koanf:"quotes"`
+	History               HistoryConfig       `koanf:"history"`
+	Web                   WebConfig           `koanf:"web"`
+	Metrics               MetricsConfig       `koanf:"metrics"`
+	API                   APIConfig           `koanf:"api"`
+	Usage                 UsageConfig         `koanf:"usage"`
+	Telemetry             TelemetryConfig     `koanf:"telemetry"`
+	Tenancy               TenancyConfig       `koanf:"tenancy"`
+	Events                EventsConfig        `koanf:"events"`
+	Redis                 RedisConfig         `koanf:"redis"`
+	Notifications         NotificationsConfig `koanf:"notifications"`
+	Plugins               PluginsConfig       `koanf:"plugins"` // Config section of each plugin, by plugin name
+	AllowedChatIDs        []int64             `koanf:"allowed_chat_ids"`
+	OwnerIDs              []int64             `koanf:"owner_ids"`     // Users allowed to run bot-wide commands such as /doctor
+	AdminChatID           int64               `koanf:"admin_chat_id"` // Chat receiving onboarding reports and notifications; 0 uses the owners' private chats instead
+	AutoLeaveUnauthorized bool                `koanf:"auto_leave_unauthorized"`
 }
 
+// PluginsConfig holds the config sections of the plugins compiled into the
+// bot, by plugin name. Each plugin decodes its own section.
+type PluginsConfig map[string]map[string]interface{}
+
 // TelegramConfig holds Telegram bot configuration
 type TelegramConfig struct {
-	Token   string `koanf:"token"`
-	Webhook string `koanf:"webhook"`
+	Token string `koanf:"token"`
+	// APIURL is the Bot API server, Telegram's when empty. Point it to a
+	// local or fake server for offline development.
+	APIURL string `koanf:"api_url"`
+	// Webhook is the public URL Telegram posts updates to. When set the
+	// server takes updates on WebhookListen instead of polling; wanon
+	// switch-mode points Telegram to it.
+	Webhook       string `koanf:"webhook"`
+	WebhookListen string `koanf:"webhook_listen"` // e.g. ":8443"
+	WebhookSecret string `koanf:"webhook_secret"` // Checked on every webhook request
+	// UpdatesBuffer is how many received updates wait to be dispatched.
+	// When it is full, polling stops until there is room; nothing is dropped.
+	UpdatesBuffer int `koanf:"updates_buffer"`
+	// Workers dispatch the buffered updates
+	Workers int `koanf:"workers"`
+	// BlockingHandlers runs each update on its worker instead of in its own
+	// goroutine, so slow handlers fill the buffer and pause polling
+	BlockingHandlers bool `koanf:"blocking_handlers"`
+	// MaxInFlight is how many updates are handled at once; further updates
+	// wait up to QueueTimeout for a slot. Zero is unlimited.
+	MaxInFlight  int           `koanf:"max_in_flight"`
+	QueueTimeout time.Duration `koanf:"queue_timeout"` // e.g., "30s", 0 waits until shutdown
+	// PollTimeout is how long each getUpdates call waits for updates
+	PollTimeout time.Duration `koanf:"poll_timeout"`
+	// PollLimit is the most updates a getUpdates call returns, 1 to 100
+	PollLimit int `koanf:"poll_limit"`
+	// PollInterval is the least time between getUpdates calls; 0 polls
+	// again as soon as a call returns
+	PollInterval time.Duration `koanf:"poll_interval"`
+	// AdminCacheTTL is how long the administrators of a chat are cached
+	// for admin checks
+	AdminCacheTTL time.Duration `koanf:"admin_cache_ttl"`
+	// Chaos fails Bot API requests at random, for testing retries and the
+	// outbox. Off unless a rate or the latency is set.
+	Chaos ChaosConfig `koanf:"chaos"`
+}
+
+// ChaosConfig holds the Telegram API failures injected in chaos mode. Rates
+// go from 0 to 1.
+type ChaosConfig struct {
+	RateLimit   float64       `koanf:"rate_limit"`   // Share of requests answered 429
+	ServerError float64       `koanf:"server_error"` // Share of requests answered 500
+	Drop        float64       `koanf:"drop"`         // Share of requests lost before reaching Telegram
+	Latency     time.Duration `koanf:"latency"`      // Most random delay added to each request
+	Methods     []string      `koanf:"methods"`      // Methods failing; empty is all but getUpdates and getMe
+	Seed        uint64        `koanf:"seed"`         // Repeats the same failures; 0 is random
 }
 
 // DatabaseConfig holds database connection configuration
@@ -37,12 +102,239 @@ type DatabaseConfig struct {
 	Database   string `koanf:"database"`
 	SSLMode    string `koanf:"sslmode"`
 	Migrations string `koanf:"migrations"`
+	// Replicas are the DSNs of read replicas, e.g. "host=replica1 port=5432
+	// user=wanon password=secret dbname=wanon sslmode=disable". Searches,
+	// statistics and exports read from them; everything else uses the
+	// primary.
+	Replicas []string `koanf:"replicas"`
+	// ReplicaCheckInterval is how often replicas are pinged; those failing
+	// are left out until they answer again
+	ReplicaCheckInterval time.Duration `koanf:"replica_check_interval"`
+}
+
+// StartupConfig holds how long each stage of the server startup may take.
+// Zero waits until the server is stopped.
+type StartupConfig struct {
+	DatabaseTimeout   time.Duration `koanf:"database_timeout"`   // Connecting to the database
+	MigrationsTimeout time.Duration `koanf:"migrations_timeout"` // Migrating it, when the server does
+	TelegramTimeout   time.Duration `koanf:"telegram_timeout"`   // Checking the bot token with getMe
 }
 
 // CacheConfig holds cache-specific configuration
 type CacheConfig struct {
 	CleanInterval time.Duration `koanf:"clean_interval"` // e.g., "10m"
 	KeepDuration  time.Duration `koanf:"keep_duration"`  // e.g., "48h"
+	CompactAfter  time.Duration `koanf:"compact_after"`  // e.g., "6h", 0 disables compaction
+	// WarmupDir holds Telegram Desktop exports named "<chat id>.json",
+	// loaded into the cache when the bot joins or is allowed in the chat.
+	// Empty disables the warm-up.
+	WarmupDir string `koanf:"warmup_dir"`
+	// KeepMaxDays is the most days /keep spares a message from the cleaner
+	KeepMaxDays int `koanf:"keep_max_days"`
+	// Redact masks sensitive data in messages before they are cached
+	Redact RedactConfig `koanf:"redact"`
+	// Maintenance vacuums the cache tables the cleaner churns through
+	Maintenance MaintenanceConfig `koanf:"maintenance"`
+}
+
+// MaintenanceConfig holds the periodic VACUUM or ANALYZE of the cache
+// tables. A zero interval disables it.
+type MaintenanceConfig struct {
+	Interval time.Duration `koanf:"interval"` // Least time between runs, e.g. "24h"
+	Window   string        `koanf:"window"`   // UTC hours runs start in, e.g. "03:00-05:00"; empty is any hour
+	Mode     string        `koanf:"mode"`     // vacuum (VACUUM ANALYZE) or analyze
+	Tables   []string      `koanf:"tables"`
+}
+
+// RedactConfig holds what is masked in messages before they are cached.
+// Chats can turn it off with /settings redact off.
+type RedactConfig struct {
+	Rules    []string `koanf:"rules"`    // Built-in rules: cards, phones
+	Patterns []string `koanf:"patterns"` // Extra regular expressions
+}
+
+// QuotesConfig holds configuration for quote commands
+type QuotesConfig struct {
+	// CoalesceWindow folds repeated /rquote commands in a chat within this
+	// window into one posted quote. Zero disables it.
+	CoalesceWindow time.Duration `koanf:"coalesce_window"` // e.g., "3s"
+	// SkipAnonymousAdmins leaves messages sent as the group itself (anonymous
+	// admins) out of new quotes
+	SkipAnonymousAdmins bool `koanf:"skip_anonymous_admins"`
+	// SkipOwnMessages leaves the bot's own messages out of the threads
+	// /addquote builds, which go on through them
+	SkipOwnMessages bool `koanf:"skip_own_messages"`
+	// CreatorRetention is what is stored about the user adding a quote:
+	// full, minimal (ID and first name) or hash (a keyed hash of the ID)
+	CreatorRetention string `koanf:"creator_retention"`
+	CreatorHashKey   string `koanf:"creator_hash_key"` // Secret key of the hash retention
+	// DuelWindow is how long /quoteduel votes are open
+	DuelWindow time.Duration `koanf:"duel_window"` // e.g., "1h"
+	// GameWindow is how long /quotegame polls are open
+	GameWindow time.Duration `koanf:"game_window"` // e.g., "10m"
+	// AppendReplies makes /addquote on answers to a quote the bot posted
+	// add them to that quote instead of creating a new one
+	AppendReplies bool `koanf:"append_replies"`
+	// CustomEmoji posts quotes with their custom emoji instead of the
+	// fallback emoji. Only bots with premium sticker access (an extra
+	// username bought on Fragment) can send them.
+	CustomEmoji bool `koanf:"custom_emoji"`
+	// MaxThreadDepth is the most messages of a reply chain /addquote
+	// follows; longer threads keep their newest messages
+	MaxThreadDepth int `koanf:"max_thread_depth"`
+	// CreatorEditWindow is how long after adding a quote its creator can
+	// reorder or delete it without being an admin. Zero is forever.
+	CreatorEditWindow time.Duration `koanf:"creator_edit_window"` // e.g., "15m"
+	// JunkGuard is what /addquote does with commands, the bot's own
+	// messages and empty messages: off, refuse or confirm
+	JunkGuard string `koanf:"junk_guard"`
+}
+
+// HistoryConfig holds /history settings
+type HistoryConfig struct {
+	// Searches is how many searches each user can make per window; 0 is unlimited
+	Searches int           `koanf:"searches"`
+	Window   time.Duration `koanf:"window"` // e.g., "1h"
+}
+
+// MetricsConfig holds configuration for command metrics and latency alerts
+type MetricsConfig struct {
+	Listen string `koanf:"listen"` // Address serving /metrics, e.g. ":9100"; empty disables it
+	// SLOLatency is the p95 latency objective of every command over SLOWindow.
+	// Owners are notified when a command goes over it. Zero disables alerts.
+	SLOLatency time.Duration `koanf:"slo_latency"` // e.g., "2s"
+	SLOWindow  time.Duration `koanf:"slo_window"`  // e.g., "5m"
+}
+
+// APIConfig holds the admin HTTP API
+type APIConfig struct {
+	Enabled bool   `koanf:"enabled"`
+	Listen  string `koanf:"listen"` // e.g. "127.0.0.1:8090"
+	Token   string `koanf:"token"`  // Bearer token of every request; required when enabled
+}
+
+// NotificationsConfig holds where alerts, reports and errors are sent. Each
+// sink takes the kinds it receives in events (alert, report, error); empty
+// receives all of them.
+type NotificationsConfig struct {
+	// Telegram messages admin_chat_id, or the owners in private without it
+	Telegram       bool            `koanf:"telegram"`
+	TelegramEvents []string        `koanf:"telegram_events"`
+	Webhooks       []WebhookConfig `koanf:"webhooks"`
+	SMTP           SMTPConfig      `koanf:"smtp"`
+}
+
+// WebhookConfig holds a webhook notification sink
+type WebhookConfig struct {
+	URL    string   `koanf:"url"`
+	Format string   `koanf:"format"` // json (default) or slack
+	Events []string `koanf:"events"`
+}
+
+// SMTPConfig holds the email notification sink; an empty host disables it
+type SMTPConfig struct {
+	Host     string   `koanf:"host"`
+	Port     int      `koanf:"port"` // 587 by default
+	Username string   `koanf:"username"`
+	Password string   `koanf:"password"`
+	From     string   `koanf:"from"`
+	To       []string `koanf:"to"`
+	Events   []string `koanf:"events"`
+}
+
+// UsageConfig holds configuration for usage reports
+type UsageConfig struct {
+	// MonthlyReport sends the owners a usage report of every chat at the
+	// start of each month
+	MonthlyReport bool `koanf:"monthly_report"`
+}
+
+// TelemetryConfig holds the anonymous usage reports shared with the
+// maintainers: command counts, error rates and the version. Off unless
+// opted in.
+type TelemetryConfig struct {
+	Mode     string        `koanf:"mode"`     // off, local (logged, never sent) or remote
+	Endpoint string        `koanf:"endpoint"` // Where remote reports are posted
+	Interval time.Duration `koanf:"interval"` // How often a report is made
+}
+
+// TenancyConfig groups chats into tenants with plan limits, for operators
+// hosting the bot for several communities. No tenants disables it.
+type TenancyConfig struct {
+	Plans   []PlanConfig   `koanf:"plans"`
+	Tenants []TenantConfig `koanf:"tenants"`
+	// Refresh is how long usage counted for limits is trusted before
+	// counting it again
+	Refresh time.Duration `koanf:"refresh"` // e.g., "1m"
+}
+
+// PlanConfig holds the limits of a plan; 0 is no limit
+type PlanConfig struct {
+	Name              string `koanf:"name"`
+	MaxQuotes         int64  `koanf:"max_quotes"`
+	MaxCachedMessages int64  `koanf:"max_cached_messages"`
+	MaxAPICalls       int64  `koanf:"max_api_calls"` // Commands handled per month
+}
+
+// TenantConfig holds a tenant: a community, its chats and its plan
+type TenantConfig struct {
+	Name    string  `koanf:"name"`
+	Plan    string  `koanf:"plan"`
+	ChatIDs []int64 `koanf:"chat_ids"`
+}
+
+// EventsConfig holds where domain events, such as quotes added or settings
+// changed, are sent
+type EventsConfig struct {
+	File     string             `koanf:"file"`      // Append-only JSONL event log; empty disables it
+	AuditLog bool               `koanf:"audit_log"` // Log every event as an audit line
+	Webhook  QuoteWebhookConfig `koanf:"webhook"`
+}
+
+// QuoteWebhookConfig holds the webhook added and deleted quotes are posted
+// to; an empty URL disables it
+type QuoteWebhookConfig struct {
+	URL    string `koanf:"url"`
+	Secret string `koanf:"secret"` // Key of the HMAC-SHA256 signature of each request
+}
+
+// RedisConfig holds the Redis server replicas share their hot state in:
+// cached administrators, rate limits, cooldowns and pending confirmations
+type RedisConfig struct {
+	// host:port, or a redis:// or rediss:// URL whose account and database
+	// override the keys below; empty keeps the state in process
+	Addr     string        `koanf:"addr"`
+	Username string        `koanf:"username"`
+	Password string        `koanf:"password"`
+	DB       int           `koanf:"db"`
+	TLS      bool          `koanf:"tls"`     // Connect over TLS, as rediss:// URLs do
+	Prefix   string        `koanf:"prefix"`  // Put before every key
+	Timeout  time.Duration `koanf:"timeout"` // Bounds each command
+}
+
+// ExportConfig holds configuration for quote exports
+type ExportConfig struct {
+	// FontDir holds DejaVuSerif.ttf and DejaVuSerif-Bold.ttf for PDF books.
+	// Empty uses the built-in PDF fonts, which only cover Latin-1 text.
+	FontDir string `koanf:"font_dir"`
+}
+
+// WebConfig holds the public links the bot points users to
+type WebConfig struct {
+	// URL of the quote web UI or published archive, shown in /start.
+	// Empty hides the button.
+	URL string `koanf:"url"`
+	// Avatars shows the profile photos of authors in published archives
+	Avatars AvatarsConfig `koanf:"avatars"`
+}
+
+// AvatarsConfig holds the profile photo cache. Only photos users let bots
+// see are fetched.
+type AvatarsConfig struct {
+	Enabled    bool          `koanf:"enabled"`
+	Dir        string        `koanf:"dir"`          // Cache directory
+	TTL        time.Duration `koanf:"ttl"`          // e.g. "24h", before checking for a new photo
+	MaxCacheMB int64         `koanf:"max_cache_mb"` // Total cache size before evicting
 }
 
 // DSN returns the PostgreSQL connection string
@@ -57,19 +349,33 @@ func (c *DatabaseConfig) DSN() string {
 	)
 }
 
-// Load loads configuration from environment variables and config files
+// DefaultDir is the directory of the config files
+const DefaultDir = "config"
+
+// Load loads configuration from environment variables and the config files
+// in DefaultDir
 func Load(environment string) (*Config, error) {
+	return LoadFrom(DefaultDir, environment)
+}
+
+// LoadFrom loads configuration from environment variables and the config
+// files in dir: base.yaml, shared by every environment, overlaid with
+// <environment>.yaml. Overlays are deep-merged, so they only list what
+// differs; lists are replaced as a whole.
+func LoadFrom(dir, environment string) (*Config, error) {
 	k := koanf.New(".")
 	// Load defaults first (lowest priority)
 	if err := k.Load(structs.Provider(defaultConfig(), "koanf"), nil); err != nil {
 		return nil, fmt.Errorf("error loading defaults: %w", err)
 	}
 
-	// Load from config file based on environment
-	configFile := fmt.Sprintf("config/%s.yaml", environment)
-	if err := k.Load(file.Provider(configFile), yaml.Parser()); err != nil {
-		// Config file is optional, log but don't fail
-		fmt.Printf("Warning: could not load config file %s: %v\n", configFile, err)
+	// Then the shared file and the environment overlay
+	for _, name := range []string{"base", environment} {
+		configFile := filepath.Join(dir, name+".yaml")
+		if err := k.Load(file.Provider(configFile), yaml.Parser()); err != nil {
+			// Config files are optional, log but don't fail
+			fmt.Printf("Warning: could not load config file %s: %v\n", configFile, err)
+		}
 	}
 
 	// Load from environment variables with WANON_ prefix
@@ -106,14 +412,82 @@ func Load(environment string) (*Config, error) {
 // defaultConfig returns the default configuration values
 func defaultConfig() Config {
 	return Config{
+		Telegram: TelegramConfig{
+			UpdatesBuffer: 1024,
+			Workers:       1,
+			MaxInFlight:   64,
+			QueueTimeout:  30 * time.Second,
+			PollTimeout:   59 * time.Second,
+			PollLimit:     100,
+			WebhookListen: ":8443",
+			AdminCacheTTL: 5 * time.Minute,
+		},
 		Database: DatabaseConfig{
-			Port:       5432,
-			SSLMode:    "disable",
-			Migrations: "./migrations",
+			Port:                 5432,
+			SSLMode:              "disable",
+			Migrations:           "./migrations",
+			ReplicaCheckInterval: 30 * time.Second,
+		},
+		Startup: StartupConfig{
+			DatabaseTimeout:   30 * time.Second,
+			MigrationsTimeout: 5 * time.Minute,
+			TelegramTimeout:   30 * time.Second,
 		},
 		Cache: CacheConfig{
 			CleanInterval: 10 * time.Minute,
 			KeepDuration:  48 * time.Hour,
+			CompactAfter:  6 * time.Hour,
+			KeepMaxDays:   30,
+			Maintenance: MaintenanceConfig{
+				Window: "03:00-05:00",
+				Mode:   "vacuum",
+				Tables: []string{"cache_entry"},
+			},
+		},
+		Quotes: QuotesConfig{
+			CoalesceWindow:    3 * time.Second,
+			CreatorRetention:  "full",
+			DuelWindow:        time.Hour,
+			GameWindow:        10 * time.Minute,
+			AppendReplies:     true,
+			SkipOwnMessages:   true,
+			MaxThreadDepth:    100,
+			CreatorEditWindow: 15 * time.Minute,
+			JunkGuard:         "confirm",
+		},
+		History: HistoryConfig{
+			Searches: 5,
+			Window:   time.Hour,
+		},
+		Web: WebConfig{
+			Avatars: AvatarsConfig{
+				Dir:        "./data/avatars",
+				TTL:        24 * time.Hour,
+				MaxCacheMB: 32,
+			},
+		},
+		Metrics: MetricsConfig{
+			SLOWindow: 5 * time.Minute,
+		},
+		API: APIConfig{
+			Listen: "127.0.0.1:8090",
+		},
+		Usage: UsageConfig{
+			MonthlyReport: true,
+		},
+		Telemetry: TelemetryConfig{
+			Mode:     "off",
+			Interval: 24 * time.Hour,
+		},
+		Tenancy: TenancyConfig{
+			Refresh: time.Minute,
+		},
+		Redis: RedisConfig{
+			Prefix:  "wanon:",
+			Timeout: 2 * time.Second,
+		},
+		Notifications: NotificationsConfig{
+			Telegram: true,
 		},
 	}
 }
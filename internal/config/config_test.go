@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -74,10 +76,71 @@ func TestLoad_Defaults(t *testing.T) {
 	require.NoError(t, err)
 
 	// Check defaults
+	assert.Equal(t, 1024, cfg.Telegram.UpdatesBuffer)
+	assert.Equal(t, 1, cfg.Telegram.Workers)
+	assert.False(t, cfg.Telegram.BlockingHandlers)
+	assert.Equal(t, 64, cfg.Telegram.MaxInFlight)
+	assert.Equal(t, 30*time.Second, cfg.Telegram.QueueTimeout)
+	assert.Equal(t, 59*time.Second, cfg.Telegram.PollTimeout)
+	assert.Equal(t, 100, cfg.Telegram.PollLimit)
+	assert.Zero(t, cfg.Telegram.PollInterval)
+	assert.Equal(t, 5*time.Minute, cfg.Telegram.AdminCacheTTL)
+	assert.Zero(t, cfg.Telegram.Chaos.RateLimit)
+	assert.Zero(t, cfg.Telegram.Chaos.Latency)
+	assert.Empty(t, cfg.Telegram.Webhook)
+	assert.Equal(t, ":8443", cfg.Telegram.WebhookListen)
 	assert.Equal(t, 5432, cfg.Database.Port)
 	assert.Equal(t, "disable", cfg.Database.SSLMode)
+	assert.Empty(t, cfg.Database.Replicas)
+	assert.Equal(t, 30*time.Second, cfg.Database.ReplicaCheckInterval)
+	assert.Equal(t, 30*time.Second, cfg.Startup.DatabaseTimeout)
+	assert.Equal(t, 5*time.Minute, cfg.Startup.MigrationsTimeout)
+	assert.Equal(t, 30*time.Second, cfg.Startup.TelegramTimeout)
+	assert.Empty(t, cfg.Telegram.APIURL)
+	assert.False(t, cfg.Web.Avatars.Enabled)
+	assert.False(t, cfg.API.Enabled)
+	assert.Equal(t, "127.0.0.1:8090", cfg.API.Listen)
+	assert.Empty(t, cfg.API.Token)
+	assert.Equal(t, 24*time.Hour, cfg.Web.Avatars.TTL)
+	assert.Equal(t, int64(32), cfg.Web.Avatars.MaxCacheMB)
 	assert.NotZero(t, cfg.Cache.CleanInterval)
 	assert.NotZero(t, cfg.Cache.KeepDuration)
+	assert.Equal(t, 6*time.Hour, cfg.Cache.CompactAfter)
+	assert.Empty(t, cfg.Cache.WarmupDir)
+	assert.Equal(t, 30, cfg.Cache.KeepMaxDays)
+	assert.Empty(t, cfg.Cache.Redact.Rules)
+	assert.Empty(t, cfg.Cache.Redact.Patterns)
+	assert.Zero(t, cfg.Cache.Maintenance.Interval)
+	assert.Equal(t, "03:00-05:00", cfg.Cache.Maintenance.Window)
+	assert.Equal(t, "vacuum", cfg.Cache.Maintenance.Mode)
+	assert.Equal(t, []string{"cache_entry"}, cfg.Cache.Maintenance.Tables)
+	assert.Equal(t, 3*time.Second, cfg.Quotes.CoalesceWindow)
+	assert.False(t, cfg.Quotes.SkipAnonymousAdmins)
+	assert.Equal(t, "full", cfg.Quotes.CreatorRetention)
+	assert.Equal(t, time.Hour, cfg.Quotes.DuelWindow)
+	assert.Equal(t, 10*time.Minute, cfg.Quotes.GameWindow)
+	assert.True(t, cfg.Quotes.AppendReplies)
+	assert.True(t, cfg.Quotes.SkipOwnMessages)
+	assert.False(t, cfg.Quotes.CustomEmoji)
+	assert.Equal(t, 100, cfg.Quotes.MaxThreadDepth)
+	assert.Equal(t, 15*time.Minute, cfg.Quotes.CreatorEditWindow)
+	assert.Equal(t, "confirm", cfg.Quotes.JunkGuard)
+	assert.Equal(t, 5, cfg.History.Searches)
+	assert.Equal(t, time.Hour, cfg.History.Window)
+	assert.True(t, cfg.Usage.MonthlyReport)
+	assert.Equal(t, "off", cfg.Telemetry.Mode)
+	assert.Equal(t, 24*time.Hour, cfg.Telemetry.Interval)
+	assert.Empty(t, cfg.Tenancy.Tenants)
+	assert.Equal(t, time.Minute, cfg.Tenancy.Refresh)
+	assert.Empty(t, cfg.Events.File)
+	assert.False(t, cfg.Events.AuditLog)
+	assert.Empty(t, cfg.Redis.Addr)
+	assert.Equal(t, "wanon:", cfg.Redis.Prefix)
+	assert.Equal(t, 2*time.Second, cfg.Redis.Timeout)
+	assert.True(t, cfg.Notifications.Telegram)
+	assert.Empty(t, cfg.Notifications.Webhooks)
+	assert.Empty(t, cfg.Notifications.SMTP.Host)
+	assert.Equal(t, 5*time.Minute, cfg.Metrics.SLOWindow)
 }
 
 func TestDSN(t *testing.T) {
@@ -161,3 +224,59 @@ func TestDSN_WithLoadedConfig(t *testing.T) {
 	dsn := cfg.Database.DSN()
 	assert.Equal(t, "host=testhost port=5433 user=testuser password=testpassword dbname=testdatabase sslmode=require", dsn)
 }
+
+func TestLoadFrom_Overlay(t *testing.T) {
+	dir := t.TempDir()
+	base := `telegram:
+  workers: 4
+database:
+  host: base
+  port: 5433
+notifications:
+  telegram_events: [alert, report]
+`
+	overlay := `database:
+  host: overlay
+notifications:
+  telegram_events: [error]
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "base.yaml"), []byte(base), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "staging.yaml"), []byte(overlay), 0o600))
+
+	cfg, err := LoadFrom(dir, "staging")
+	require.NoError(t, err)
+
+	assert.Equal(t, "staging", cfg.Environment)
+	assert.Equal(t, 4, cfg.Telegram.Workers)
+	assert.Equal(t, 64, cfg.Telegram.MaxInFlight)
+	assert.Equal(t, "overlay", cfg.Database.Host)
+	assert.Equal(t, 5433, cfg.Database.Port)
+	assert.Equal(t, []string{"error"}, cfg.Notifications.TelegramEvents)
+}
+
+func TestLoadFrom_MissingFiles(t *testing.T) {
+	cfg, err := LoadFrom(t.TempDir(), "staging")
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, cfg.Telegram.Workers)
+	assert.Equal(t, 5432, cfg.Database.Port)
+}
+
+func TestLoadFrom_PluginSections(t *testing.T) {
+	dir := t.TempDir()
+	base := `plugins:
+  karma:
+    cooldown: 1m
+    emoji: ["+1"]
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "base.yaml"), []byte(base), 0o600))
+	t.Setenv("WANON_PLUGINS__KARMA__POINTS", "3")
+
+	cfg, err := LoadFrom(dir, "staging")
+	require.NoError(t, err)
+
+	require.Contains(t, cfg.Plugins, "karma")
+	assert.Equal(t, "1m", cfg.Plugins["karma"]["cooldown"])
+	assert.Equal(t, []interface{}{"+1"}, cfg.Plugins["karma"]["emoji"])
+	assert.Equal(t, "3", cfg.Plugins["karma"]["points"])
+}
@@ -0,0 +1,258 @@
+// Package doctor runs self-diagnostics of a running bot: the health of its
+// database, Telegram connection and background jobs. wanon doctor runs the
+// checks that need no running bot before it starts.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/storage"
+	"gorm.io/gorm"
+)
+
+// Latency limits above which a check fails
+const (
+	maxDatabaseLatency = 500 * time.Millisecond
+	maxTelegramLatency = 2 * time.Second
+)
+
+// maxOutboxDelay is how long a message may wait in the outbox before the
+// outbox counts as stuck
+const maxOutboxDelay = 5 * time.Minute
+
+// TelegramClient is the part of the Bot API the checks use
+type TelegramClient interface {
+	GetMe(ctx context.Context) (*models.User, error)
+	GetWebhookInfo(ctx context.Context) (*models.WebhookInfo, error)
+}
+
+// CleanerStatus reports the last run of the cache cleaner
+type CleanerStatus interface {
+	LastRun() (time.Time, error)
+}
+
+// Options configures the checks with what the bot is expected to look like
+type Options struct {
+	MigrationsDir  string        // Directory of the migration files
+	MigrateOnStart bool          // Pending migrations are applied when the server starts
+	WebhookURL     string        // Configured webhook, empty when polling
+	CleanInterval  time.Duration // How often the cache cleaner runs
+}
+
+// Check is the outcome of a single diagnostic
+type Check struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// Report is the outcome of all diagnostics
+type Report struct {
+	Checks []Check
+}
+
+// Failed returns how many checks failed
+func (r Report) Failed() int {
+	failed := 0
+	for _, check := range r.Checks {
+		if !check.OK {
+			failed++
+		}
+	}
+	return failed
+}
+
+// String renders the report for a chat message
+func (r Report) String() string {
+	lines := []string{"Doctor report:"}
+	for _, check := range r.Checks {
+		mark := "✅"
+		if !check.OK {
+			mark = "❌"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s: %s", mark, check.Name, check.Detail))
+	}
+	if failed := r.Failed(); failed > 0 {
+		lines = append(lines, "", fmt.Sprintf("%d of %d checks failed.", failed, len(r.Checks)))
+	} else {
+		lines = append(lines, "", "All checks passed.")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Doctor runs the diagnostics
+type Doctor struct {
+	db      *gorm.DB
+	client  TelegramClient
+	cleaner CleanerStatus
+	outbox  *outbox.Outbox
+	opts    Options
+	clock   clock.Clock
+}
+
+// New creates a doctor checking the given database, Telegram client and
+// cache cleaner
+func New(db *gorm.DB, client TelegramClient, cleaner CleanerStatus, opts Options) *Doctor {
+	return &Doctor{
+		db:      db,
+		client:  client,
+		cleaner: cleaner,
+		outbox:  outbox.New(db),
+		opts:    opts,
+		clock:   clock.System{},
+	}
+}
+
+// WithClock replaces the time source used for latencies and ages
+func (d *Doctor) WithClock(clk clock.Clock) *Doctor {
+	d.clock = clk
+	return d
+}
+
+// Run runs every check. Failing checks do not stop the others.
+func (d *Doctor) Run(ctx context.Context) Report {
+	return Report{Checks: []Check{
+		d.checkDatabase(ctx),
+		d.checkMigrations(ctx),
+		d.checkTelegram(ctx),
+		d.checkWebhook(ctx),
+		d.checkCache(ctx),
+		d.checkCleaner(),
+		d.checkOutbox(ctx),
+	}}
+}
+
+// checkDatabase measures a database round trip
+func (d *Doctor) checkDatabase(ctx context.Context) Check {
+	start := d.clock.Now()
+	if err := d.db.WithContext(ctx).Exec("SELECT 1").Error; err != nil {
+		return Check{Name: "database", Detail: err.Error()}
+	}
+	return latencyCheck("database", d.clock.Now().Sub(start), maxDatabaseLatency)
+}
+
+// checkMigrations compares the applied migrations with the shipped ones
+func (d *Doctor) checkMigrations(ctx context.Context) Check {
+	applied, err := storage.MigrationVersion(ctx, d.db)
+	if err != nil {
+		return Check{Name: "migrations", Detail: err.Error()}
+	}
+	latest, err := storage.LatestMigration(d.opts.MigrationsDir)
+	if err != nil {
+		return Check{Name: "migrations", Detail: err.Error()}
+	}
+	switch {
+	case applied > latest:
+		return Check{Name: "migrations", Detail: fmt.Sprintf("version %d applied, newer than the %d of this build", applied, latest)}
+	case applied < latest && d.opts.MigrateOnStart:
+		return Check{Name: "migrations", OK: true, Detail: fmt.Sprintf("version %d applied, %d on start", applied, latest)}
+	case applied < latest:
+		return Check{Name: "migrations", Detail: fmt.Sprintf("version %d applied, %d available", applied, latest)}
+	}
+	return Check{Name: "migrations", OK: true, Detail: fmt.Sprintf("version %d", applied)}
+}
+
+// checkTelegram measures a Bot API round trip
+func (d *Doctor) checkTelegram(ctx context.Context) Check {
+	start := d.clock.Now()
+	if _, err := d.client.GetMe(ctx); err != nil {
+		return Check{Name: "telegram", Detail: err.Error()}
+	}
+	return latencyCheck("telegram", d.clock.Now().Sub(start), maxTelegramLatency)
+}
+
+// checkWebhook verifies that Telegram delivers updates the way the bot
+// expects them
+func (d *Doctor) checkWebhook(ctx context.Context) Check {
+	info, err := d.client.GetWebhookInfo(ctx)
+	if err != nil {
+		return Check{Name: "webhook", Detail: err.Error()}
+	}
+	pending := fmt.Sprintf("%d pending update(s)", info.PendingUpdateCount)
+
+	switch {
+	case d.opts.WebhookURL == "" && info.URL != "":
+		return Check{Name: "webhook", Detail: fmt.Sprintf("set to %s while polling", info.URL)}
+	case d.opts.WebhookURL == "":
+		return Check{Name: "webhook", OK: true, Detail: "polling, " + pending}
+	case info.URL != d.opts.WebhookURL:
+		return Check{Name: "webhook", Detail: fmt.Sprintf("set to %q, expected %s", info.URL, d.opts.WebhookURL)}
+	case info.LastErrorMessage != "":
+		return Check{Name: "webhook", Detail: fmt.Sprintf("last error: %s, %s", info.LastErrorMessage, pending)}
+	}
+	return Check{Name: "webhook", OK: true, Detail: pending}
+}
+
+// checkCache reports how much the message cache holds
+func (d *Doctor) checkCache(ctx context.Context) Check {
+	var row struct {
+		Entries int64
+		Bytes   int64
+	}
+	err := d.db.WithContext(ctx).
+		Raw("SELECT (SELECT COUNT(*) FROM cache_entry) AS entries, pg_total_relation_size('cache_entry') AS bytes").
+		Scan(&row).Error
+	if err != nil {
+		return Check{Name: "cache", Detail: err.Error()}
+	}
+	return Check{Name: "cache", OK: true, Detail: fmt.Sprintf("%d message(s), %s", row.Entries, formatBytes(row.Bytes))}
+}
+
+// checkCleaner verifies the cache cleaner runs on schedule
+func (d *Doctor) checkCleaner() Check {
+	lastRun, err := d.cleaner.LastRun()
+	if lastRun.IsZero() {
+		return Check{Name: "cleaner", Detail: "has not run yet"}
+	}
+	age := d.clock.Now().Sub(lastRun).Round(time.Second)
+	if err != nil {
+		return Check{Name: "cleaner", Detail: fmt.Sprintf("failed %s ago: %v", age, err)}
+	}
+	if d.opts.CleanInterval > 0 && age > 2*d.opts.CleanInterval {
+		return Check{Name: "cleaner", Detail: fmt.Sprintf("last ran %s ago, every %s expected", age, d.opts.CleanInterval)}
+	}
+	return Check{Name: "cleaner", OK: true, Detail: fmt.Sprintf("last ran %s ago", age)}
+}
+
+// checkOutbox verifies outgoing messages are not piling up
+func (d *Doctor) checkOutbox(ctx context.Context) Check {
+	count, oldest, err := d.outbox.Pending(ctx)
+	if err != nil {
+		return Check{Name: "outbox", Detail: err.Error()}
+	}
+	if count == 0 {
+		return Check{Name: "outbox", OK: true, Detail: "nothing pending"}
+	}
+	age := d.clock.Now().Sub(oldest).Round(time.Second)
+	detail := fmt.Sprintf("%d pending, oldest %s ago", count, age)
+	return Check{Name: "outbox", OK: age <= maxOutboxDelay, Detail: detail}
+}
+
+// latencyCheck builds the check of a round trip
+func latencyCheck(name string, latency, limit time.Duration) Check {
+	detail := latency.Round(time.Millisecond).String()
+	if latency > limit {
+		return Check{Name: name, Detail: fmt.Sprintf("%s, slower than %s", detail, limit)}
+	}
+	return Check{Name: name, OK: true, Detail: detail}
+}
+
+// formatBytes prints a size with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,187 @@
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClient answers the Bot API calls of the checks
+type fakeClient struct {
+	err     error
+	webhook models.WebhookInfo
+}
+
+func (f *fakeClient) GetMe(context.Context) (*models.User, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.User{ID: 1, IsBot: true}, nil
+}
+
+func (f *fakeClient) GetWebhookInfo(context.Context) (*models.WebhookInfo, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &f.webhook, nil
+}
+
+// fakeCleaner reports a fixed last run
+type fakeCleaner struct {
+	lastRun time.Time
+	err     error
+}
+
+func (f fakeCleaner) LastRun() (time.Time, error) {
+	return f.lastRun, f.err
+}
+
+func TestReport_String(t *testing.T) {
+	report := Report{Checks: []Check{
+		{Name: "database", OK: true, Detail: "2ms"},
+		{Name: "migrations", Detail: "version 9 applied, 10 available"},
+	}}
+	assert.Equal(t, 1, report.Failed())
+	assert.Equal(t, "Doctor report:\n✅ database: 2ms\n❌ migrations: version 9 applied, 10 available\n\n1 of 2 checks failed.", report.String())
+
+	report.Checks = report.Checks[:1]
+	assert.Contains(t, report.String(), "All checks passed.")
+}
+
+func TestDoctor_CheckTelegram(t *testing.T) {
+	d := New(nil, &fakeClient{}, nil, Options{}).WithClock(clock.NewMock(time.Now()))
+	check := d.checkTelegram(context.Background())
+	assert.True(t, check.OK)
+	assert.Equal(t, "0s", check.Detail)
+
+	d.client = &fakeClient{err: errors.New("unauthorized")}
+	check = d.checkTelegram(context.Background())
+	assert.False(t, check.OK)
+	assert.Equal(t, "unauthorized", check.Detail)
+}
+
+func TestDoctor_CheckWebhook(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		info       models.WebhookInfo
+		ok         bool
+		detail     string
+	}{
+		{name: "polling", info: models.WebhookInfo{PendingUpdateCount: 3}, ok: true, detail: "polling, 3 pending update(s)"},
+		{name: "webhook left behind", info: models.WebhookInfo{URL: "https://old.example.com"}, detail: "set to https://old.example.com while polling"},
+		{name: "webhook", configured: "https://bot.example.com", info: models.WebhookInfo{URL: "https://bot.example.com"}, ok: true, detail: "0 pending update(s)"},
+		{name: "webhook missing", configured: "https://bot.example.com", detail: `set to "", expected https://bot.example.com`},
+		{name: "webhook failing", configured: "https://bot.example.com", info: models.WebhookInfo{URL: "https://bot.example.com", LastErrorMessage: "Connection refused", PendingUpdateCount: 12}, detail: "last error: Connection refused, 12 pending update(s)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(nil, &fakeClient{webhook: tt.info}, nil, Options{WebhookURL: tt.configured})
+			check := d.checkWebhook(context.Background())
+			assert.Equal(t, tt.ok, check.OK)
+			assert.Equal(t, tt.detail, check.Detail)
+		})
+	}
+}
+
+func TestDoctor_CheckCleaner(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		cleaner fakeCleaner
+		ok      bool
+		detail  string
+	}{
+		{name: "never ran", detail: "has not run yet"},
+		{name: "recent", cleaner: fakeCleaner{lastRun: now.Add(-5 * time.Minute)}, ok: true, detail: "last ran 5m0s ago"},
+		{name: "overdue", cleaner: fakeCleaner{lastRun: now.Add(-time.Hour)}, detail: "last ran 1h0m0s ago, every 10m0s expected"},
+		{name: "failed", cleaner: fakeCleaner{lastRun: now.Add(-time.Minute), err: errors.New("deadlock")}, detail: "failed 1m0s ago: deadlock"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(nil, nil, tt.cleaner, Options{CleanInterval: 10 * time.Minute}).WithClock(clock.NewMock(now))
+			check := d.checkCleaner()
+			assert.Equal(t, tt.ok, check.OK)
+			assert.Equal(t, tt.detail, check.Detail)
+		})
+	}
+}
+
+func TestLatencyCheck(t *testing.T) {
+	assert.Equal(t, Check{Name: "db", OK: true, Detail: "12ms"}, latencyCheck("db", 12*time.Millisecond, time.Second))
+	assert.Equal(t, Check{Name: "db", Detail: "1.5s, slower than 1s"}, latencyCheck("db", 1500*time.Millisecond, time.Second))
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "8.0 KiB", formatBytes(8192))
+	assert.Equal(t, "1.5 MiB", formatBytes(1536*1024))
+}
+
+func TestHandler_Command(t *testing.T) {
+	handler := NewHandler(nil, nil, []int64{1})
+	assert.Equal(t, "/doctor", handler.Command())
+	assert.True(t, handler.owners[1])
+}
+
+func TestCheckConfig(t *testing.T) {
+	valid := func() *config.Config {
+		return &config.Config{Environment: "production", Telegram: config.TelegramConfig{Token: "123:abc"}}
+	}
+	assert.Equal(t, Check{Name: "config", OK: true, Detail: "environment production"}, CheckConfig(valid(), nil))
+
+	check := CheckConfig(nil, errors.New("invalid quotes.junk_guard"))
+	assert.False(t, check.OK)
+	assert.Equal(t, "invalid quotes.junk_guard", check.Detail)
+
+	cfg := valid()
+	cfg.Telegram.Token = ""
+	assert.Equal(t, "telegram.token is not set", CheckConfig(cfg, nil).Detail)
+
+	cfg = valid()
+	cfg.Telegram.Webhook = "http://bot.example.com/hook"
+	assert.False(t, CheckConfig(cfg, nil).OK)
+
+	cfg = valid()
+	cfg.API.Enabled = true
+	assert.False(t, CheckConfig(cfg, nil).OK)
+}
+
+func TestDoctor_Preflight(t *testing.T) {
+	d := New(nil, &fakeClient{webhook: models.WebhookInfo{URL: "https://old.example.com"}}, nil, Options{}).WithClock(clock.NewMock(time.Now()))
+	report := d.Preflight(context.Background(), errors.New("connection refused"))
+
+	require.Len(t, report.Checks, 4)
+	assert.Equal(t, Check{Name: "database", Detail: "connection refused"}, report.Checks[0])
+	assert.False(t, report.Checks[1].OK, "migrations cannot pass without a database")
+	assert.True(t, report.Checks[2].OK)
+	assert.Equal(t, "set to https://old.example.com while polling", report.Checks[3].Detail)
+	assert.Equal(t, 3, report.Failed())
+}
+
+func TestReport_MarshalJSON(t *testing.T) {
+	report := Report{Checks: []Check{
+		{Name: "config", OK: true, Detail: "environment production"},
+		{Name: "database", Detail: "connection refused"},
+	}}
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"ok":false,"failed":1,"checks":[
+		{"name":"config","ok":true,"detail":"environment production"},
+		{"name":"database","ok":false,"detail":"connection refused"}
+	]}`, string(data))
+
+	data, err = json.Marshal(Report{Checks: report.Checks[:1]})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"ok":true`)
+}
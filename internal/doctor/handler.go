@@ -0,0 +1,56 @@
+package doctor
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"gorm.io/gorm"
+)
+
+// Handler handles the /doctor command
+type Handler struct {
+	doctor *Doctor
+	outbox *outbox.Outbox
+	owners map[int64]bool
+}
+
+// NewHandler creates a /doctor handler answering only the given owners
+func NewHandler(db *gorm.DB, doctor *Doctor, ownerIDs []int64) *Handler {
+	owners := make(map[int64]bool, len(ownerIDs))
+	for _, id := range ownerIDs {
+		owners[id] = true
+	}
+	return &Handler{doctor: doctor, outbox: outbox.New(db), owners: owners}
+}
+
+// Handle runs the diagnostics and replies with the report. Commands from
+// anyone but the owners are ignored, so the bot internals are not revealed.
+func (h *Handler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	if !h.owners[msg.From.ID] {
+		slog.Info("ignoring /doctor from non-owner", "audit", true, "chat_id", msg.Chat.ID, "user_id", msg.From.ID)
+		return nil
+	}
+
+	report := h.doctor.Run(ctx)
+	slog.Info("doctor report", "chat_id", msg.Chat.ID, "user_id", msg.From.ID, "failed", report.Failed())
+
+	_, err := h.outbox.Send(ctx, b, &outbox.Message{ChatID: msg.Chat.ID, Text: report.String()})
+	return err
+}
+
+// Command returns the command name
+func (h *Handler) Command() string {
+	return "/doctor"
+}
+
+// Description returns the command description
+func (h *Handler) Description() string {
+	return "Run bot self-diagnostics (owners only)"
+}
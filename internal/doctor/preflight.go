@@ -0,0 +1,65 @@
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/graffic/wanon-go/internal/config"
+)
+
+// CheckConfig reports whether the config loaded, with err when it did not,
+// and holds what the server cannot start without
+func CheckConfig(cfg *config.Config, err error) Check {
+	if err != nil {
+		return Check{Name: "config", Detail: err.Error()}
+	}
+	if cfg.Telegram.Token == "" {
+		return Check{Name: "config", Detail: "telegram.token is not set"}
+	}
+	if cfg.Telegram.Webhook != "" {
+		if webhook, err := url.Parse(cfg.Telegram.Webhook); err != nil || webhook.Scheme != "https" {
+			return Check{Name: "config", Detail: fmt.Sprintf("telegram.webhook %q is not an https URL", cfg.Telegram.Webhook)}
+		}
+	}
+	if cfg.API.Enabled && cfg.API.Token == "" {
+		return Check{Name: "config", Detail: "api.token is not set with the admin API enabled"}
+	}
+	return Check{Name: "config", OK: true, Detail: "environment " + cfg.Environment}
+}
+
+// Preflight checks the environment before the server starts, for deploy
+// pipelines: the database and its migrations, the bot token and the webhook
+// Telegram delivers to. The doctor has no database when connecting failed
+// with dbErr; its checks then fail without running.
+func (d *Doctor) Preflight(ctx context.Context, dbErr error) Report {
+	var checks []Check
+	if d.db == nil {
+		checks = append(checks,
+			Check{Name: "database", Detail: dbErr.Error()},
+			Check{Name: "migrations", Detail: "not checked without a database"})
+	} else {
+		checks = append(checks, d.checkDatabase(ctx), d.checkMigrations(ctx))
+	}
+	return Report{Checks: append(checks, d.checkTelegram(ctx), d.checkWebhook(ctx))}
+}
+
+// MarshalJSON writes the report for scripts: whether every check passed,
+// how many failed and each check
+func (r Report) MarshalJSON() ([]byte, error) {
+	type check struct {
+		Name   string `json:"name"`
+		OK     bool   `json:"ok"`
+		Detail string `json:"detail"`
+	}
+	checks := make([]check, 0, len(r.Checks))
+	for _, c := range r.Checks {
+		checks = append(checks, check{Name: c.Name, OK: c.OK, Detail: c.Detail})
+	}
+	return json.Marshal(struct {
+		OK     bool    `json:"ok"`
+		Failed int     `json:"failed"`
+		Checks []check `json:"checks"`
+	}{OK: r.Failed() == 0, Failed: r.Failed(), Checks: checks})
+}
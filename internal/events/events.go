@@ -0,0 +1,169 @@
+// Package events carries the domain events of the bot, such as a quote
+// being added or settings changing, to the subscribers that consume them:
+// the JSONL event log, the audit log and external integrations all see the
+// same stream.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+)
+
+// Type names a domain event
+type Type string
+
+const (
+	// QuoteAdded is a new quote; its data is the quote with its entries
+	QuoteAdded Type = "quote_added"
+	// QuoteChanged is a quote whose entries changed, e.g. appended or
+	// reordered; its data is the quote with all its entries
+	QuoteChanged Type = "quote_changed"
+	// QuoteDeleted is a deleted quote; its data is a QuoteRef
+	QuoteDeleted Type = "quote_deleted"
+	// CacheCleaned is a cache cleanup; its data is a CacheCleanup
+	CacheCleaned Type = "cache_cleaned"
+	// SettingsChanged is a chat whose settings were saved; its data is the
+	// chat settings
+	SettingsChanged Type = "settings_changed"
+)
+
+// Event is something that happened to the bot's data
+type Event struct {
+	Type    Type            `json:"type"`
+	At      time.Time       `json:"at"`
+	ChatID  int64           `json:"chat_id,omitempty"`
+	ActorID int64           `json:"actor_id,omitempty"` // User whose command caused it, if any
+	Data    json.RawMessage `json:"data"`
+}
+
+// QuoteRef is the data of events naming a quote
+type QuoteRef struct {
+	QuoteID uint `json:"quote_id"`
+}
+
+// CacheCleanup is the data of CacheCleaned events
+type CacheCleanup struct {
+	Deleted   int64 `json:"deleted"`   // Messages older than their retention
+	Compacted int64 `json:"compacted"` // Messages stripped down to their quotable fields
+}
+
+// New creates an event of a chat with data, and the actor of ctx
+func New(ctx context.Context, typ Type, chatID int64, data any) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to marshal %s event: %w", typ, err)
+	}
+	return Event{Type: typ, ChatID: chatID, ActorID: ActorFrom(ctx), Data: raw}, nil
+}
+
+// Publisher takes domain events; *Bus implements it
+type Publisher interface {
+	Publish(ctx context.Context, event Event)
+}
+
+// Subscriber consumes domain events
+type Subscriber interface {
+	Receive(ctx context.Context, event Event) error
+}
+
+// subscription is a named subscriber
+type subscription struct {
+	name       string
+	subscriber Subscriber
+}
+
+// Bus hands every published event to its subscribers, in order and one
+// event at a time, so they all see the same sequence
+type Bus struct {
+	clock  clock.Clock
+	logger *slog.Logger
+
+	mu            sync.Mutex
+	subscriptions []subscription
+}
+
+// NewBus creates a bus without subscribers
+func NewBus(logger *slog.Logger) *Bus {
+	return &Bus{clock: clock.System{}, logger: logger}
+}
+
+// WithClock replaces the time source stamping events
+func (b *Bus) WithClock(clk clock.Clock) *Bus {
+	b.clock = clk
+	return b
+}
+
+// Subscribe adds a subscriber, named in logs
+func (b *Bus) Subscribe(name string, subscriber Subscriber) *Bus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions = append(b.subscriptions, subscription{name: name, subscriber: subscriber})
+	return b
+}
+
+// Publish stamps an event and hands it to every subscriber. A failing
+// subscriber is logged and does not stop the others.
+func (b *Bus) Publish(ctx context.Context, event Event) {
+	if event.At.IsZero() {
+		event.At = b.clock.Now().UTC()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.subscriptions {
+		if err := s.subscriber.Receive(ctx, event); err != nil {
+			b.logger.Error("event subscriber failed", "subscriber", s.name, "type", event.Type, "chat_id", event.ChatID, "error", err)
+		}
+	}
+}
+
+// Publish creates an event and publishes it, logging events that cannot be
+// created. A nil publisher drops it.
+func Publish(ctx context.Context, publisher Publisher, typ Type, chatID int64, data any) {
+	if publisher == nil {
+		return
+	}
+	event, err := New(ctx, typ, chatID, data)
+	if err != nil {
+		slog.Error("failed to create event", "type", typ, "chat_id", chatID, "error", err)
+		return
+	}
+	publisher.Publish(ctx, event)
+}
+
+// actorKey is the context key of the actor
+type actorKey struct{}
+
+// WithActor returns a context whose events name userID as their actor
+func WithActor(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, actorKey{}, userID)
+}
+
+// ActorFrom returns the actor of a context, 0 for none
+func ActorFrom(ctx context.Context) int64 {
+	id, _ := ctx.Value(actorKey{}).(int64)
+	return id
+}
+
+// Middleware returns a bot middleware naming the sender of each message or
+// callback as the actor of the events it causes
+func Middleware() bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			switch {
+			case update.Message != nil && update.Message.From != nil:
+				ctx = WithActor(ctx, update.Message.From.ID)
+			case update.CallbackQuery != nil:
+				ctx = WithActor(ctx, update.CallbackQuery.From.ID)
+			}
+			next(ctx, b, update)
+		}
+	}
+}
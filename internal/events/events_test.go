@@ -0,0 +1,135 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// subscriberFunc adapts a function to a Subscriber
+type subscriberFunc func(ctx context.Context, event Event) error
+
+func (f subscriberFunc) Receive(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestBus_Publish(t *testing.T) {
+	now := time.Date(2026, 9, 15, 12, 0, 0, 0, time.UTC)
+	bus := NewBus(discardLogger()).WithClock(clock.NewMock(now))
+
+	var first, second []Event
+	bus.Subscribe("failing", subscriberFunc(func(ctx context.Context, event Event) error {
+		first = append(first, event)
+		return errors.New("boom")
+	}))
+	bus.Subscribe("second", subscriberFunc(func(ctx context.Context, event Event) error {
+		second = append(second, event)
+		return nil
+	}))
+
+	ctx := WithActor(context.Background(), 42)
+	Publish(ctx, bus, QuoteDeleted, -100123, QuoteRef{QuoteID: 7})
+	Publish(ctx, bus, CacheCleaned, 0, CacheCleanup{Deleted: 3})
+
+	require.Len(t, first, 2)
+	assert.Equal(t, first, second, "a failing subscriber does not stop the others")
+	assert.Equal(t, QuoteDeleted, second[0].Type)
+	assert.Equal(t, now, second[0].At)
+	assert.Equal(t, int64(-100123), second[0].ChatID)
+	assert.Equal(t, int64(42), second[0].ActorID)
+	assert.JSONEq(t, `{"quote_id":7}`, string(second[0].Data))
+	assert.Equal(t, CacheCleaned, second[1].Type)
+}
+
+func TestPublish_NilPublisher(t *testing.T) {
+	assert.NotPanics(t, func() {
+		Publish(context.Background(), nil, SettingsChanged, -100123, struct{}{})
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	var actors []int64
+	handler := Middleware()(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		actors = append(actors, ActorFrom(ctx))
+	})
+
+	handler(context.Background(), nil, &models.Update{Message: &models.Message{From: &models.User{ID: 7}}})
+	handler(context.Background(), nil, &models.Update{CallbackQuery: &models.CallbackQuery{From: models.User{ID: 8}}})
+	handler(context.Background(), nil, &models.Update{Message: &models.Message{}})
+
+	assert.Equal(t, []int64{7, 8, 0}, actors)
+}
+
+func TestFileLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	at := time.Date(2026, 9, 15, 12, 0, 0, 0, time.UTC)
+
+	write := func(event Event) {
+		log, err := OpenFileLog(path)
+		require.NoError(t, err)
+		require.NoError(t, log.Receive(context.Background(), event))
+		require.NoError(t, log.Close())
+	}
+	// Reopening appends instead of truncating
+	write(Event{Type: QuoteDeleted, At: at, ChatID: -100123, Data: json.RawMessage(`{"quote_id":1}`)})
+	write(Event{Type: QuoteDeleted, At: at, ChatID: -100123, Data: json.RawMessage(`{"quote_id":2}`)})
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var lines []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		lines = append(lines, event)
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{"quote_id":2}`, string(lines[1].Data))
+	assert.Equal(t, at, lines[1].At)
+}
+
+func TestRead(t *testing.T) {
+	log := `{"type":"quote_deleted","chat_id":-100123,"data":{"quote_id":1}}
+
+{"type":"cache_cleaned","data":{"deleted":3}}
+`
+	var lines []int
+	var types []Type
+	err := Read(strings.NewReader(log), func(line int, event Event) error {
+		lines = append(lines, line)
+		types = append(types, event.Type)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 3}, lines)
+	assert.Equal(t, []Type{QuoteDeleted, CacheCleaned}, types)
+
+	err = Read(strings.NewReader(log), func(line int, event Event) error {
+		return errors.New("stop")
+	})
+	assert.EqualError(t, err, "line 1: stop")
+
+	err = Read(strings.NewReader(`{"data":{}}`), func(int, Event) error { return nil })
+	assert.EqualError(t, err, "line 1: event without a type")
+}
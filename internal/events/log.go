@@ -0,0 +1,68 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// FileLog appends every event to a JSONL file, one event per line. The file
+// is only ever appended to, and each event is synced before the next.
+type FileLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenFileLog opens the event log at path, creating it if needed
+func OpenFileLog(path string) (*FileLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	return &FileLog{file: f}, nil
+}
+
+// Receive appends an event to the log
+func (l *FileLog) Receive(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write event log: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync event log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the log file
+func (l *FileLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// AuditLog writes every event to a logger as an audit line
+type AuditLog struct {
+	logger *slog.Logger
+}
+
+// NewAuditLog creates an audit log subscriber
+func NewAuditLog(logger *slog.Logger) *AuditLog {
+	return &AuditLog{logger: logger}
+}
+
+// Receive logs an event
+func (a *AuditLog) Receive(ctx context.Context, event Event) error {
+	a.logger.Info("domain event", "audit", true, "type", event.Type, "chat_id", event.ChatID, "actor_id", event.ActorID)
+	return nil
+}
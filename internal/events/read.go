@@ -0,0 +1,39 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxLine is the longest event line read, enough for quotes of long threads
+const maxLine = 16 << 20
+
+// Read calls fn with each event of a JSONL event log, in order. Blank lines
+// are skipped; a line that is not an event stops the read.
+func Read(r io.Reader, fn func(line int, event Event) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("line %d: invalid event: %w", line, err)
+		}
+		if event.Type == "" {
+			return fmt.Errorf("line %d: event without a type", line)
+		}
+		if err := fn(line, event); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read event log: %w", err)
+	}
+	return nil
+}
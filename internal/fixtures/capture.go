@@ -0,0 +1,212 @@
+// Package fixtures captures recent cached messages as anonymized test
+// fixtures, in the update format of the files in testdata.
+package fixtures
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/cache"
+	"github.com/graffic/wanon-go/internal/message"
+	"gorm.io/gorm"
+)
+
+// FixtureChatID is the chat captured messages are moved to, the group of
+// the other fixtures
+const FixtureChatID = -1001234567890
+
+// Options tunes what a capture keeps
+type Options struct {
+	// KeepText keeps texts and captions as they are instead of scrubbing
+	// their letters and digits. Only for bugs that depend on the words, and
+	// only after reading them.
+	KeepText bool
+}
+
+// Capture reads the last messages cached for a chat, oldest first, and
+// returns them as anonymized updates. Replies to captured messages carry
+// the whole message they reply to, as Telegram sends them.
+func Capture(ctx context.Context, db *gorm.DB, chatID int64, last int, opts Options) ([]models.Update, error) {
+	var entries []cache.CacheEntry
+	if err := db.WithContext(ctx).
+		Where("chat_id = ?", chatID).
+		Order("message_id DESC").
+		Limit(last).
+		Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to read the cache: %w", err)
+	}
+	slices.Reverse(entries)
+
+	anonymizer := NewAnonymizer(chatID, opts)
+	captured := make(map[int64]*message.Message, len(entries))
+	updates := make([]models.Update, 0, len(entries))
+	for i, entry := range entries {
+		msg, err := message.Parse(entry.Message)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", entry.MessageID, err)
+		}
+		anonymizer.Message(msg)
+		if msg.ReplyTo != nil {
+			if replied, ok := captured[msg.ReplyTo.MessageID]; ok {
+				parent := *replied
+				parent.ReplyTo = nil // Telegram does not nest replies further
+				msg.ReplyTo = &parent
+			} else {
+				msg.ReplyTo.Chat = msg.Chat
+			}
+		}
+		captured[msg.MessageID] = msg
+		updates = append(updates, models.Update{ID: int64(i + 1), Message: msg.Telegram()})
+	}
+	return updates, nil
+}
+
+// Marshal writes updates in the layout of the fixture files
+func Marshal(updates []models.Update) ([]byte, error) {
+	data, err := json.MarshalIndent(updates, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Anonymizer replaces the users, chats, files and words of messages by
+// placeholders. The same user, chat or file gets the same placeholder in
+// every message, so replies and authors still line up.
+type Anonymizer struct {
+	chatID int64
+	opts   Options
+	users  map[int64]*message.User
+	chats  map[int64]*message.Chat
+	files  map[string]string
+}
+
+// NewAnonymizer creates an anonymizer moving chatID to FixtureChatID
+func NewAnonymizer(chatID int64, opts Options) *Anonymizer {
+	return &Anonymizer{
+		chatID: chatID,
+		opts:   opts,
+		users:  make(map[int64]*message.User),
+		chats:  make(map[int64]*message.Chat),
+		files:  make(map[string]string),
+	}
+}
+
+// Message anonymizes a message in place. The message it replies to is
+// cached by ID only and left alone.
+func (a *Anonymizer) Message(msg *message.Message) {
+	if msg == nil {
+		return
+	}
+	a.chat(&msg.Chat)
+	msg.From = a.user(msg.From)
+	msg.ViaBot = a.user(msg.ViaBot)
+	if msg.SenderChat != nil {
+		a.chat(msg.SenderChat)
+	}
+	if !a.opts.KeepText {
+		msg.Text = Scrub(msg.Text)
+		msg.Caption = Scrub(msg.Caption)
+	}
+	if msg.Media != nil {
+		msg.Media.FileID = a.file(msg.Media.FileID)
+	}
+	if origin := msg.ForwardOrigin; origin != nil {
+		origin.SenderUser = a.user(origin.SenderUser)
+		if origin.SenderChat != nil {
+			a.chat(origin.SenderChat)
+		}
+		if origin.Chat != nil {
+			a.chat(origin.Chat)
+		}
+		if origin.SenderUserName != "" {
+			origin.SenderUserName = "Hidden User"
+		}
+	}
+}
+
+// user returns the placeholder of a user
+func (a *Anonymizer) user(user *message.User) *message.User {
+	if user == nil {
+		return nil
+	}
+	if placeholder, ok := a.users[user.ID]; ok {
+		return placeholder
+	}
+	n := len(a.users) + 1
+	placeholder := &message.User{ID: int64(100000 + n), FirstName: fmt.Sprintf("User %d", n), IsBot: user.IsBot}
+	if user.Username != "" {
+		placeholder.Username = fmt.Sprintf("user%d", n)
+		if user.IsBot {
+			placeholder.Username += "_bot"
+		}
+	}
+	a.users[user.ID] = placeholder
+	return placeholder
+}
+
+// chat replaces a chat by its placeholder, in place
+func (a *Anonymizer) chat(chat *message.Chat) {
+	placeholder, ok := a.chats[chat.ID]
+	if !ok {
+		n := len(a.chats) + 1
+		placeholder = &message.Chat{ID: -1001000000000 - int64(n), Type: chat.Type, Title: fmt.Sprintf("Chat %d", n)}
+		if chat.ID == a.chatID {
+			placeholder.ID, placeholder.Title = FixtureChatID, "Test Group"
+		}
+		if chat.Username != "" {
+			placeholder.Username = fmt.Sprintf("chat%d", n)
+		}
+		a.chats[chat.ID] = placeholder
+	}
+	*chat = *placeholder
+}
+
+// file returns the placeholder of a file ID
+func (a *Anonymizer) file(id string) string {
+	if id == "" {
+		return ""
+	}
+	if placeholder, ok := a.files[id]; ok {
+		return placeholder
+	}
+	placeholder := fmt.Sprintf("file-%d", len(a.files)+1)
+	a.files[id] = placeholder
+	return placeholder
+}
+
+// Scrub replaces the letters of a text by x and its digits by 0, keeping
+// its length in UTF-16 code units so entity offsets still match. Commands
+// are kept, as are spaces, punctuation and emoji.
+func Scrub(text string) string {
+	var sb strings.Builder
+	command := false
+	prev := ' '
+	for _, r := range text {
+		switch {
+		case r == '/' && unicode.IsSpace(prev):
+			command = true
+		case unicode.IsSpace(r):
+			command = false
+		}
+		prev = r
+		switch {
+		case command || r > 0xFFFF: // Runes outside the BMP take two code units
+			sb.WriteRune(r)
+		case unicode.IsDigit(r):
+			sb.WriteRune('0')
+		case unicode.IsUpper(r):
+			sb.WriteRune('X')
+		case unicode.IsLetter(r):
+			sb.WriteRune('x')
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,71 @@
+package fixtures
+
+import (
+	"context"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/cache"
+	"github.com/graffic/wanon-go/internal/message"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestScrub(t *testing.T) {
+	assert.Equal(t, "Xxxx 00 /addquote 😀!", Scrub("Hola 42 /addquote 😀!"))
+	assert.Equal(t, "xxxxx/xxx", Scrub("hello/bar"), "only a slash after a space starts a command")
+	assert.Equal(t, "", Scrub(""))
+}
+
+func TestAnonymizer_SamePlaceholders(t *testing.T) {
+	a := NewAnonymizer(-100555, Options{})
+	alice := &message.User{ID: 42, FirstName: "Alice", Username: "alice"}
+	first := &message.Message{MessageID: 1, Chat: message.Chat{ID: -100555, Type: "supergroup", Title: "Secret"}, From: alice, Text: "hi",
+		Media: &message.Media{Type: "photo", FileID: "AgACAgQ"}}
+	second := &message.Message{MessageID: 2, Chat: message.Chat{ID: -100555, Type: "supergroup", Title: "Secret"}, From: &message.User{ID: 42, FirstName: "Alice"},
+		ForwardOrigin: &message.Origin{Type: "hidden_user", SenderUserName: "Real Name"}, Media: &message.Media{Type: "photo", FileID: "AgACAgQ"}}
+	a.Message(first)
+	a.Message(second)
+
+	assert.Equal(t, message.Chat{ID: FixtureChatID, Type: "supergroup", Title: "Test Group"}, first.Chat)
+	assert.Equal(t, &message.User{ID: 100001, FirstName: "User 1", Username: "user1"}, first.From)
+	assert.Equal(t, first.From, second.From)
+	assert.Equal(t, "xx", first.Text)
+	assert.Equal(t, "file-1", second.Media.FileID)
+	assert.Equal(t, "Hidden User", second.ForwardOrigin.SenderUserName)
+
+	kept := NewAnonymizer(-100555, Options{KeepText: true})
+	msg := &message.Message{Chat: message.Chat{ID: -100777}, Text: "hi"}
+	kept.Message(msg)
+	assert.Equal(t, "hi", msg.Text)
+	assert.Equal(t, int64(-1001000000001), msg.Chat.ID)
+}
+
+func TestCapture(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	replyID := int64(11)
+	entries := []cache.CacheEntry{
+		{ChatID: -100555, MessageID: 10, Date: 1, Message: datatypes.JSON(`{"message_id":10,"chat":{"id":-100555,"type":"supergroup"},"date":1,"from":{"id":7,"first_name":"Old"},"text":"too old"}`)},
+		{ChatID: -100555, MessageID: 11, Date: 2, Message: datatypes.JSON(`{"message_id":11,"chat":{"id":-100555,"type":"supergroup"},"date":2,"from":{"id":42,"first_name":"Alice"},"text":"first"}`)},
+		{ChatID: -100555, MessageID: 12, Date: 3, ReplyID: &replyID, Message: datatypes.JSON(`{"message_id":12,"chat":{"id":-100555,"type":"supergroup"},"date":3,"from":{"id":43,"first_name":"Bob"},"text":"second","reply_to_message":{"message_id":11}}`)},
+		{ChatID: -100999, MessageID: 13, Date: 4, Message: datatypes.JSON(`{"message_id":13,"chat":{"id":-100999,"type":"supergroup"},"date":4,"text":"elsewhere"}`)},
+	}
+	require.NoError(t, db.DB.Create(&entries).Error)
+
+	updates, err := Capture(context.Background(), db.DB, -100555, 2, Options{})
+	require.NoError(t, err)
+	require.Len(t, updates, 2)
+	assert.Equal(t, int64(1), updates[0].ID)
+	assert.Equal(t, "xxxxx", updates[0].Message.Text)
+	assert.Equal(t, int64(FixtureChatID), updates[0].Message.Chat.ID)
+
+	reply := updates[1].Message
+	require.NotNil(t, reply.ReplyToMessage)
+	assert.Equal(t, "xxxxx", reply.ReplyToMessage.Text, "the whole parent is nested")
+	assert.Equal(t, updates[0].Message.From.ID, reply.ReplyToMessage.From.ID)
+
+	data, err := Marshal(updates)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "Alice")
+}
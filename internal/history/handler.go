@@ -0,0 +1,143 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/kv"
+	"github.com/graffic/wanon-go/internal/message"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/settings"
+	"gorm.io/gorm"
+)
+
+// maxResults is how many messages a search shows
+const maxResults = 5
+
+// Handler handles the /history command
+type Handler struct {
+	db       *gorm.DB
+	settings *settings.Service
+	outbox   *outbox.Outbox
+	limiter  *Limiter
+}
+
+// NewHandler creates a new history handler allowing 5 searches per user
+// and hour
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{
+		db:       db,
+		settings: settings.NewService(db),
+		outbox:   outbox.New(db),
+		limiter:  NewLimiter(5, time.Hour),
+	}
+}
+
+// WithLimit sets how many searches each user can make per window
+func (h *Handler) WithLimit(searches int, window time.Duration) *Handler {
+	h.limiter = NewLimiter(searches, window)
+	return h
+}
+
+// WithStore shares the search limits of every replica through a store
+func (h *Handler) WithStore(store kv.Store) *Handler {
+	h.limiter.WithStore(store)
+	return h
+}
+
+// Handle processes /history <terms>, replying with the latest cached
+// messages containing every term. Chats have to turn it on with
+// /settings history on.
+func (h *Handler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+
+	cs, err := h.settings.Get(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if !cs.History {
+		return h.notice(ctx, b, chatID, "History search is off in this chat. Admins can turn it on with /settings history on.")
+	}
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	terms := Terms(args.Rest(0))
+	if len(terms) == 0 {
+		return h.notice(ctx, b, chatID, "Usage: /history <words>")
+	}
+
+	if ok, wait := h.limiter.Allow(ctx, msg.From.ID); !ok {
+		slog.Info("history search rate limited", "chat_id", chatID, "user_id", msg.From.ID)
+		return h.notice(ctx, b, chatID, fmt.Sprintf("Too many searches, try again in %s.", wait.Round(time.Second)))
+	}
+	slog.Info("executing /history command", "chat_id", chatID, "user_id", msg.From.ID, "terms", len(terms))
+
+	matches, err := Search(ctx, h.db, chatID, terms, maxResults)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return h.notice(ctx, b, chatID, "No messages found with "+strings.Join(terms, " ")+".")
+	}
+
+	loc := cs.Location(msg.From.LanguageCode)
+	_, err = h.outbox.Send(ctx, b, &outbox.Message{
+		ChatID:    chatID,
+		Text:      Render(matches, terms, loc, cs.Layout(msg.From.LanguageCode)),
+		ParseMode: models.ParseModeHTML,
+	})
+	return err
+}
+
+// Render lists the matches as HTML, with the terms highlighted
+func Render(matches []Match, terms []string, loc *time.Location, layout string) string {
+	lines := []string{"🔎 <b>" + html.EscapeString(strings.Join(terms, " ")) + "</b>"}
+	for _, match := range matches {
+		header := fmt.Sprintf("<i>%s, %s</i>",
+			html.EscapeString(senderName(match.Message)),
+			html.EscapeString(time.Unix(match.Date, 0).In(loc).Format(layout)))
+		lines = append(lines, "", header, Highlight(match.Message.Body(), terms))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// senderName names who sent a message
+func senderName(msg *message.Message) string {
+	switch {
+	case msg.SenderChat != nil && msg.SenderChat.Title != "":
+		return msg.SenderChat.Title
+	case msg.From == nil:
+		return "Unknown"
+	case msg.From.FirstName != "":
+		return strings.TrimSpace(msg.From.FirstName + " " + msg.From.LastName)
+	case msg.From.Username != "":
+		return "@" + msg.From.Username
+	}
+	return "Unknown"
+}
+
+// notice sends a reply deleted after the chat's autodelete delay
+func (h *Handler) notice(ctx context.Context, b *bot.Bot, chatID int64, text string) error {
+	_, err := h.outbox.Send(ctx, b, &outbox.Message{ChatID: chatID, Text: text, Transient: true})
+	return err
+}
+
+// Command returns the command name
+func (h *Handler) Command() string {
+	return "/history"
+}
+
+// Description returns the command description
+func (h *Handler) Description() string {
+	return "Search the recent messages of the chat"
+}
@@ -0,0 +1,148 @@
+// Package history searches the messages a chat keeps in the cache, not only
+// those saved as quotes.
+package history
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/graffic/wanon-go/internal/message"
+	"github.com/graffic/wanon-go/internal/textutil"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// searchVector is the full-text document of a cached message. It has to
+// match the expression of idx_cache_entry_search to use the index.
+const searchVector = `to_tsvector('simple', COALESCE(message->>'text', message->>'caption', ''))`
+
+// Match is a cached message matching a search
+type Match struct {
+	MessageID int64
+	Date      int64
+	Message   *message.Message
+}
+
+// Search returns the most recent messages of a chat containing every term,
+// newest first. Terms are whole words in any case.
+func Search(ctx context.Context, db *gorm.DB, chatID int64, terms []string, limit int) ([]Match, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	var rows []struct {
+		MessageID int64
+		Date      int64
+		Message   datatypes.JSON
+	}
+	err := db.WithContext(ctx).
+		Table("cache_entry").
+		Select("message_id, date, message").
+		Where("chat_id = ?", chatID).
+		Where(searchVector+" @@ plainto_tsquery('simple', ?)", strings.Join(terms, " ")).
+		Order("date DESC, message_id DESC").
+		Limit(limit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to search history: %w", err)
+	}
+
+	matches := make([]Match, 0, len(rows))
+	for _, row := range rows {
+		msg, err := message.Parse(row.Message)
+		if err != nil {
+			continue
+		}
+		matches = append(matches, Match{MessageID: row.MessageID, Date: row.Date, Message: msg})
+	}
+	return matches, nil
+}
+
+// Terms splits a search into the words it looks for, lower case and without
+// duplicates
+func Terms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), isSeparator) {
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// isSeparator reports whether r splits words, as in the text search parser
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+}
+
+// snippetUnits is about how much of a message a result shows, in UTF-16
+// code units as Telegram counts message lengths
+const snippetUnits = 200
+
+// Highlight returns an HTML snippet of text with the terms in bold. Long
+// texts are cut around the first match.
+func Highlight(text string, terms []string) string {
+	spans := matchSpans(text, terms)
+
+	start, end := 0, len(text)
+	if textutil.UTF16Len(text) > snippetUnits {
+		first := 0
+		if len(spans) > 0 {
+			first = spans[0][0]
+		}
+		start = textutil.Back(text, first, snippetUnits/4)
+		end = start + len(textutil.Truncate(text[start:], snippetUnits))
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, span := range spans {
+		if span[0] < pos || span[1] > end {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:span[0]]))
+		b.WriteString("<b>" + html.EscapeString(text[span[0]:span[1]]) + "</b>")
+		pos = span[1]
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// matchSpans returns the byte ranges of whole-word, case-insensitive
+// matches of the terms in text, in order and not overlapping
+func matchSpans(text string, terms []string) [][2]int {
+	if len(terms) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	// Longer terms first so that they win over their prefixes
+	sort.Slice(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	pattern := regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}_])(` + strings.Join(quoted, "|") + `)(?:$|[^\p{L}\p{N}_])`)
+
+	var spans [][2]int
+	for offset := 0; offset < len(text); {
+		loc := pattern.FindStringSubmatchIndex(text[offset:])
+		if loc == nil {
+			break
+		}
+		spans = append(spans, [2]int{offset + loc[2], offset + loc[3]})
+		// The separator after a match may start the next one
+		offset += loc[3]
+	}
+	return spans
+}
@@ -0,0 +1,98 @@
+package history
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/graffic/wanon-go/internal/message"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/graffic/wanon-go/internal/textutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestTerms(t *testing.T) {
+	assert.Equal(t, []string{"pizza", "friday"}, Terms("  Pizza, FRIDAY pizza!"))
+	assert.Equal(t, []string{"café", "año_2024"}, Terms("café año_2024"))
+	assert.Empty(t, Terms(" ?! "))
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		terms    []string
+		expected string
+	}{
+		{"whole words", "Pizza on friday? pizzas are fine", []string{"pizza", "friday"}, "<b>Pizza</b> on <b>friday</b>? pizzas are fine"},
+		{"escapes html", "<b>pizza</b> & beer", []string{"pizza"}, "&lt;b&gt;<b>pizza</b>&lt;/b&gt; &amp; beer"},
+		{"adjacent matches", "pizza pizza", []string{"pizza"}, "<b>pizza</b> <b>pizza</b>"},
+		{"longest term wins", "new york", []string{"new", "newyork", "york"}, "<b>new</b> <b>york</b>"},
+		{"no match", "nothing here", []string{"pizza"}, "nothing here"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Highlight(tt.text, tt.terms))
+		})
+	}
+}
+
+func TestHighlight_LongText(t *testing.T) {
+	text := strings.Repeat("blah ", 100) + "pizza " + strings.Repeat("blah ", 100)
+	snippet := Highlight(text, []string{"pizza"})
+	assert.True(t, strings.HasPrefix(snippet, "…"))
+	assert.True(t, strings.HasSuffix(snippet, "…"))
+	assert.Contains(t, snippet, "<b>pizza</b>")
+	assert.Less(t, len([]rune(snippet)), snippetUnits+20)
+}
+
+func TestHighlight_LongEmojiText(t *testing.T) {
+	// Each 🍕 is two UTF-16 code units, as Telegram counts them
+	text := strings.Repeat("🍕", 150) + " pizza " + strings.Repeat("🍕", 150)
+	snippet := Highlight(text, []string{"pizza"})
+	assert.True(t, strings.HasPrefix(snippet, "…"+strings.Repeat("🍕", 24)+" <b>pizza</b> "))
+	assert.True(t, strings.HasSuffix(snippet, "🍕…"))
+	assert.LessOrEqual(t, textutil.UTF16Len(strings.Trim(snippet, "…")), snippetUnits+len("<b></b>"))
+	assert.True(t, utf8.ValidString(snippet))
+}
+
+func TestRender(t *testing.T) {
+	matches := []Match{
+		{MessageID: 2, Date: 1609459200, Message: &message.Message{Text: "pizza <3", From: &message.User{ID: 1, FirstName: "Ana", LastName: "García"}}},
+		{MessageID: 1, Date: 1609455600, Message: &message.Message{Caption: "more pizza", From: &message.User{ID: 2, Username: "bob"}}},
+	}
+	expected := "🔎 <b>pizza</b>\n\n" +
+		"<i>Ana García, 2021-01-01 00:00</i>\n<b>pizza</b> &lt;3\n\n" +
+		"<i>@bob, 2020-12-31 23:00</i>\nmore <b>pizza</b>"
+	assert.Equal(t, expected, Render(matches, []string{"pizza"}, time.UTC, "2006-01-02 15:04"))
+}
+
+func TestSearch(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+
+	cache := func(chatID, id, date int64, json string) {
+		require.NoError(t, db.DB.Exec(
+			"INSERT INTO cache_entry (chat_id, message_id, date, message) VALUES (?, ?, ?, ?)",
+			chatID, id, date, datatypes.JSON(json)).Error)
+	}
+	cache(-100123, 1, 100, `{"message_id":1,"text":"Pizza on Friday"}`)
+	cache(-100123, 2, 200, `{"message_id":2,"caption":"friday pizza photo"}`)
+	cache(-100123, 3, 300, `{"message_id":3,"text":"pizza only"}`)
+	cache(-100456, 4, 400, `{"message_id":4,"text":"pizza friday elsewhere"}`)
+
+	matches, err := Search(ctx, db.DB, -100123, Terms("pizza friday"), 5)
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, int64(2), matches[0].MessageID)
+	assert.Equal(t, int64(1), matches[1].MessageID)
+
+	matches, err = Search(ctx, db.DB, -100123, Terms("pizza"), 1)
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+	assert.Equal(t, int64(3), matches[0].MessageID)
+}
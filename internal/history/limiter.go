@@ -0,0 +1,84 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/kv"
+)
+
+// Limiter allows each user a number of searches per window, counted across
+// every chat
+type Limiter struct {
+	limit  int
+	window time.Duration
+	clock  clock.Clock
+	store  kv.Store // Shared counts, instead of searches
+
+	mu       sync.Mutex
+	searches map[int64][]time.Time // Recent searches of each user, oldest first
+}
+
+// NewLimiter creates a limiter of limit searches per user in any window.
+// A limit of zero or less allows every search.
+func NewLimiter(limit int, window time.Duration) *Limiter {
+	return &Limiter{limit: limit, window: window, clock: clock.System{}, searches: make(map[int64][]time.Time)}
+}
+
+// WithClock replaces the time source
+func (l *Limiter) WithClock(clk clock.Clock) *Limiter {
+	l.clock = clk
+	return l
+}
+
+// WithStore counts the searches in a store shared by every replica. Shared
+// counts are kept per fixed window rather than over the last window.
+func (l *Limiter) WithStore(store kv.Store) *Limiter {
+	l.store = store
+	return l
+}
+
+// Allow records a search of a user. Over the limit the search is not
+// recorded and Allow returns false with the time until the next one is
+// allowed.
+func (l *Limiter) Allow(ctx context.Context, userID int64) (bool, time.Duration) {
+	if l.limit <= 0 {
+		return true, 0
+	}
+	now := l.clock.Now()
+	if l.store != nil {
+		return l.allowShared(ctx, userID, now)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	recent := l.searches[userID]
+	for len(recent) > 0 && !recent[0].After(now.Add(-l.window)) {
+		recent = recent[1:]
+	}
+	if len(recent) >= l.limit {
+		l.searches[userID] = recent
+		return false, recent[0].Add(l.window).Sub(now)
+	}
+	l.searches[userID] = append(recent, now)
+	return true, 0
+}
+
+// allowShared counts a search in the store. A failing store allows it.
+func (l *Limiter) allowShared(ctx context.Context, userID int64, now time.Time) (bool, time.Duration) {
+	start := now.Truncate(l.window)
+	key := fmt.Sprintf("history:%d:%d", userID, start.Unix())
+	count, err := l.store.Incr(ctx, key, l.window)
+	if err != nil {
+		slog.Warn("failed to count a history search, allowing it", "user_id", userID, "error", err)
+		return true, 0
+	}
+	if count > int64(l.limit) {
+		return false, start.Add(l.window).Sub(now)
+	}
+	return true, 0
+}
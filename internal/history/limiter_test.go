@@ -0,0 +1,66 @@
+package history
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/kv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC))
+	limiter := NewLimiter(2, time.Hour).WithClock(clk)
+
+	ok, _ := limiter.Allow(context.Background(), 1)
+	assert.True(t, ok)
+	clk.Advance(10 * time.Minute)
+	ok, _ = limiter.Allow(context.Background(), 1)
+	assert.True(t, ok)
+
+	// Over the limit until the first search leaves the window
+	ok, wait := limiter.Allow(context.Background(), 1)
+	assert.False(t, ok)
+	assert.Equal(t, 50*time.Minute, wait)
+
+	// Other users have their own limit
+	ok, _ = limiter.Allow(context.Background(), 2)
+	assert.True(t, ok)
+
+	clk.Advance(50 * time.Minute)
+	ok, _ = limiter.Allow(context.Background(), 1)
+	assert.True(t, ok)
+	ok, wait = limiter.Allow(context.Background(), 1)
+	assert.False(t, ok)
+	assert.Equal(t, 10*time.Minute, wait)
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	limiter := NewLimiter(0, time.Hour)
+	for i := 0; i < 100; i++ {
+		ok, _ := limiter.Allow(context.Background(), 1)
+		assert.True(t, ok)
+	}
+}
+
+func TestLimiter_Shared(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, time.May, 1, 12, 10, 0, 0, time.UTC))
+	store := kv.NewMemory().WithClock(clk)
+	// Two replicas count against the same limit
+	first := NewLimiter(2, time.Hour).WithClock(clk).WithStore(store)
+	second := NewLimiter(2, time.Hour).WithClock(clk).WithStore(store)
+
+	ok, _ := first.Allow(context.Background(), 1)
+	assert.True(t, ok)
+	ok, _ = second.Allow(context.Background(), 1)
+	assert.True(t, ok)
+	ok, wait := first.Allow(context.Background(), 1)
+	assert.False(t, ok)
+	assert.Equal(t, 50*time.Minute, wait, "shared counts reset with the window")
+
+	clk.Advance(50 * time.Minute)
+	ok, _ = second.Allow(context.Background(), 1)
+	assert.True(t, ok)
+}
@@ -0,0 +1,182 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVParser reads one quote per row. Columns are selected by header name or
+// by 1-based position.
+type CSVParser struct {
+	Delimiter    rune   // Field separator, ',' if zero
+	NoHeader     bool   // The first row is data rather than column names
+	AuthorColumn string // Column with the author, "author" if empty
+	TextColumn   string // Column with the quote text, "text" if empty
+	DateColumn   string // Column with the date, "date" if empty; optional
+	DateLayout   string // Go layout of the dates, common layouts if empty
+}
+
+// csvColumns holds the resolved positions of the mapped columns, -1 if absent
+type csvColumns struct {
+	author, text, date int
+}
+
+// Parse reads the quotes of a CSV file
+func (p *CSVParser) Parse(r io.Reader) (*Result, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	if p.Delimiter != 0 {
+		reader.Comma = p.Delimiter
+	}
+
+	var header []string
+	if !p.NoHeader {
+		var err error
+		header, err = reader.Read()
+		if err == io.EOF {
+			return &Result{}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+	}
+
+	columns, err := p.columns(header)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			result.Errors = append(result.Errors, &LineError{Line: parseErr.StartLine, Err: parseErr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		quote, err := p.quote(record, columns)
+		if err != nil {
+			result.Errors = append(result.Errors, &LineError{Line: line, Err: err})
+			continue
+		}
+		quote.Line = line
+		result.Quotes = append(result.Quotes, quote)
+	}
+	return result, nil
+}
+
+// quote builds a quote from a CSV record
+func (p *CSVParser) quote(record []string, columns csvColumns) (Quote, error) {
+	field := func(column int) string {
+		if column < 0 || column >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[column])
+	}
+
+	text := field(columns.text)
+	if text == "" {
+		return Quote{}, errors.New("empty quote text")
+	}
+
+	author := field(columns.author)
+	if author == "" {
+		author = "Unknown"
+	}
+
+	var date time.Time
+	if value := field(columns.date); value != "" {
+		var err error
+		if date, err = parseDate(value, p.DateLayout); err != nil {
+			return Quote{}, err
+		}
+	}
+
+	return Quote{Date: date, Lines: []Line{{Author: author, Text: text}}}, nil
+}
+
+// columns resolves the column mapping against the header
+func (p *CSVParser) columns(header []string) (csvColumns, error) {
+	var columns csvColumns
+	var err error
+	if columns.author, err = findColumn(header, p.AuthorColumn, "author", false); err != nil {
+		return columns, err
+	}
+	if columns.text, err = findColumn(header, p.TextColumn, "text", true); err != nil {
+		return columns, err
+	}
+	if columns.date, err = findColumn(header, p.DateColumn, "date", false); err != nil {
+		return columns, err
+	}
+	return columns, nil
+}
+
+// findColumn returns the index of a column given by name or 1-based
+// position. Columns left at their default name may be missing unless required.
+func findColumn(header []string, column, fallback string, required bool) (int, error) {
+	explicit := column != ""
+	if !explicit {
+		column = fallback
+	}
+
+	if n, err := strconv.Atoi(column); err == nil {
+		if n < 1 {
+			return -1, fmt.Errorf("invalid column %q, positions start at 1", column)
+		}
+		return n - 1, nil
+	}
+
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return i, nil
+		}
+	}
+	if explicit || required {
+		return -1, fmt.Errorf("column %q not found in CSV header", column)
+	}
+	return -1, nil
+}
+
+// dateLayouts are tried in order when no layout is given
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02/01/2006",
+}
+
+// parseDate parses a date with the given layout, common layouts or as a
+// Unix timestamp. Dates without a zone are taken as UTC.
+func parseDate(value, layout string) (time.Time, error) {
+	if layout != "" {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q for layout %q", value, layout)
+		}
+		return t, nil
+	}
+
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
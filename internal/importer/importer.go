@@ -0,0 +1,139 @@
+// Package importer reads quotes exported by other quote bots.
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/message"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"gorm.io/datatypes"
+)
+
+// Line is a single utterance of an imported quote
+type Line struct {
+	Author string
+	Text   string
+}
+
+// Quote is a quote read from an export file
+type Quote struct {
+	Line  int // Line of the file where the quote starts, for error reports
+	Date  time.Time
+	Lines []Line
+}
+
+// LineError reports an invalid record of an export file
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Result holds the quotes parsed from a file and the records that could
+// not be parsed
+type Result struct {
+	Quotes []Quote
+	Errors []*LineError
+}
+
+// Parser reads the quotes of an export file
+type Parser interface {
+	Parse(r io.Reader) (*Result, error)
+}
+
+// Formats lists the supported export formats
+func Formats() []string {
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parsers maps format names to parsers with default options
+var parsers = map[string]func() Parser{
+	"csv":     func() Parser { return &CSVParser{} },
+	"eggdrop": func() Parser { return &IRCParser{} },
+	"irssi":   func() Parser { return &IRCParser{} },
+}
+
+// ParserFor returns the parser of a format with its default options
+func ParserFor(format string) (Parser, error) {
+	newParser, ok := parsers[strings.ToLower(format)]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(Formats(), ", "))
+	}
+	return newParser(), nil
+}
+
+// importer is the creator recorded on imported quotes
+var importer = map[string]interface{}{
+	"id":         0,
+	"is_bot":     true,
+	"first_name": "wanon import",
+}
+
+// Import stores the parsed quotes in a chat. Either every quote is stored
+// or, on error, none is.
+func Import(ctx context.Context, store *quotes.Store, chatID int64, parsed []Quote) (int, error) {
+	err := store.Transaction(ctx, func(tx *quotes.Store) error {
+		for _, quote := range parsed {
+			entries, err := cacheEntries(chatID, quote)
+			if err != nil {
+				return &LineError{Line: quote.Line, Err: err}
+			}
+			_, err = tx.Store(ctx, quotes.StoreOptions{
+				Creator:   importer,
+				ChatID:    chatID,
+				Entries:   entries,
+				CreatedAt: quote.Date,
+			})
+			if err != nil {
+				return &LineError{Line: quote.Line, Err: err}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(parsed), nil
+}
+
+// cacheEntries turns an imported quote into Telegram-like messages so it
+// renders like any other quote
+func cacheEntries(chatID int64, quote Quote) ([]quotes.CacheEntry, error) {
+	var date int64
+	if !quote.Date.IsZero() {
+		date = quote.Date.Unix()
+	}
+
+	entries := make([]quotes.CacheEntry, 0, len(quote.Lines))
+	for _, line := range quote.Lines {
+		msg := &message.Message{
+			Date: date,
+			Chat: message.Chat{ID: chatID},
+			From: &message.User{FirstName: line.Author},
+			Text: line.Text,
+		}
+		data, err := msg.JSON()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, quotes.CacheEntry{ChatID: chatID, Date: date, Message: datatypes.JSON(data)})
+	}
+	return entries, nil
+}
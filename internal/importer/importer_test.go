@@ -0,0 +1,155 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVParser_Defaults(t *testing.T) {
+	input := `author,text,date
+alice,"hello, world",2019-01-02
+bob,"multi
+line",1546387200
+,no author,
+carol,,2019-01-03
+dave,bad date,yesterday
+`
+	result, err := (&CSVParser{}).Parse(strings.NewReader(input))
+	require.NoError(t, err)
+
+	require.Len(t, result.Quotes, 3)
+	assert.Equal(t, Quote{
+		Line:  2,
+		Date:  time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC),
+		Lines: []Line{{Author: "alice", Text: "hello, world"}},
+	}, result.Quotes[0])
+	assert.Equal(t, "multi\nline", result.Quotes[1].Lines[0].Text)
+	assert.Equal(t, time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC), result.Quotes[1].Date)
+	assert.Equal(t, "Unknown", result.Quotes[2].Lines[0].Author)
+	assert.True(t, result.Quotes[2].Date.IsZero())
+
+	require.Len(t, result.Errors, 2)
+	assert.Equal(t, 6, result.Errors[0].Line)
+	assert.Contains(t, result.Errors[0].Error(), "empty quote text")
+	assert.Equal(t, 7, result.Errors[1].Line)
+	assert.Contains(t, result.Errors[1].Error(), "invalid date")
+}
+
+func TestCSVParser_Mapping(t *testing.T) {
+	input := "15/03/2020;said;who\n16/03/2020;hi;ana\n"
+	parser := &CSVParser{
+		Delimiter:    ';',
+		NoHeader:     true,
+		AuthorColumn: "3",
+		TextColumn:   "2",
+		DateColumn:   "1",
+		DateLayout:   "02/01/2006",
+	}
+	result, err := parser.Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Empty(t, result.Errors)
+	require.Len(t, result.Quotes, 2)
+	assert.Equal(t, Line{Author: "ana", Text: "hi"}, result.Quotes[1].Lines[0])
+	assert.Equal(t, time.Date(2020, 3, 16, 0, 0, 0, 0, time.UTC), result.Quotes[1].Date)
+}
+
+func TestCSVParser_MissingColumn(t *testing.T) {
+	_, err := (&CSVParser{TextColumn: "quote"}).Parse(strings.NewReader("author,text\na,b\n"))
+	assert.ErrorContains(t, err, `column "quote" not found`)
+
+	_, err = (&CSVParser{}).Parse(strings.NewReader("who,what\na,b\n"))
+	assert.ErrorContains(t, err, `column "text" not found`)
+}
+
+func TestIRCParser(t *testing.T) {
+	input := `# exported from eggdrop
+[2009-05-01 22:14] <alice> is it friday yet? | <@bob> it's tuesday
+
+1241216040 * carol facepalms
+<dave> no date here
+[2009-05-01 <erin> broken
+just some text
+`
+	result, err := (&IRCParser{}).Parse(strings.NewReader(input))
+	require.NoError(t, err)
+
+	require.Len(t, result.Quotes, 3)
+	assert.Equal(t, Quote{
+		Line: 2,
+		Date: time.Date(2009, 5, 1, 22, 14, 0, 0, time.UTC),
+		Lines: []Line{
+			{Author: "alice", Text: "is it friday yet?"},
+			{Author: "bob", Text: "it's tuesday"},
+		},
+	}, result.Quotes[0])
+	assert.Equal(t, Quote{
+		Line:  4,
+		Date:  time.Unix(1241216040, 0).UTC(),
+		Lines: []Line{{Author: "carol", Text: "* carol facepalms"}},
+	}, result.Quotes[1])
+	assert.True(t, result.Quotes[2].Date.IsZero())
+
+	require.Len(t, result.Errors, 2)
+	assert.Equal(t, 6, result.Errors[0].Line)
+	assert.Equal(t, 7, result.Errors[1].Line)
+}
+
+func TestParserFor(t *testing.T) {
+	for _, format := range []string{"csv", "eggdrop", "irssi", "CSV"} {
+		parser, err := ParserFor(format)
+		require.NoError(t, err)
+		assert.NotNil(t, parser)
+	}
+
+	_, err := ParserFor("xml")
+	assert.ErrorContains(t, err, "expected one of csv, eggdrop, irssi")
+}
+
+func TestImport(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := quotes.NewStore(db.DB)
+	ctx := context.Background()
+
+	date := time.Date(2009, 5, 1, 22, 14, 0, 0, time.UTC)
+	imported, err := Import(ctx, store, -100123, []Quote{
+		{Line: 1, Date: date, Lines: []Line{{Author: "alice", Text: "hi"}, {Author: "bob", Text: "hello"}}},
+		{Line: 2, Lines: []Line{{Author: "carol", Text: "undated"}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, imported)
+
+	var stored []quotes.Quote
+	require.NoError(t, db.DB.Preload("Entries").Where("chat_id = ?", -100123).Order("id").Find(&stored).Error)
+	require.Len(t, stored, 2)
+	assert.True(t, stored[0].CreatedAt.Equal(date))
+	require.Len(t, stored[0].Entries, 2)
+
+	text, err := quotes.NewRenderer().RenderSimple(&stored[0])
+	require.NoError(t, err)
+	assert.Equal(t, "alice: hi\nbob: hello", text)
+	assert.WithinDuration(t, time.Now(), stored[1].CreatedAt, time.Minute)
+}
+
+func TestImport_AllOrNothing(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := quotes.NewStore(db.DB)
+
+	_, err := Import(context.Background(), store, -100123, []Quote{
+		{Line: 1, Lines: []Line{{Author: "alice", Text: "hi"}}},
+		{Line: 2}, // No entries
+	})
+	var lineErr *LineError
+	require.ErrorAs(t, err, &lineErr)
+	assert.Equal(t, 2, lineErr.Line)
+
+	count, err := store.CountForChat(context.Background(), -100123)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+}
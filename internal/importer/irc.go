@@ -0,0 +1,121 @@
+package importer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// IRCParser reads the flat quote files kept by eggdrop and irssi quote
+// scripts: one quote per line, utterances separated by " | ", each written
+// as "<nick> text" or "* nick action". A quote may start with a date in
+// brackets or a Unix timestamp:
+//
+//	[2009-05-01 22:14] <alice> is it friday yet? | <bob> it's tuesday
+//	1241216040 * carol facepalms
+//
+// Blank lines and lines starting with "#" are ignored.
+type IRCParser struct {
+	DateLayout string // Go layout of bracketed dates, common layouts if empty
+}
+
+// Parse reads the quotes of an IRC quotes file
+func (p *IRCParser) Parse(r io.Reader) (*Result, error) {
+	result := &Result{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		quote, err := p.quote(line)
+		if err != nil {
+			result.Errors = append(result.Errors, &LineError{Line: lineNo, Err: err})
+			continue
+		}
+		quote.Line = lineNo
+		result.Quotes = append(result.Quotes, quote)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read quotes file: %w", err)
+	}
+	return result, nil
+}
+
+// quote parses a single quote line
+func (p *IRCParser) quote(line string) (Quote, error) {
+	var quote Quote
+
+	// Optional leading date
+	if rest, ok := strings.CutPrefix(line, "["); ok {
+		value, rest, found := strings.Cut(rest, "]")
+		if !found {
+			return quote, errors.New("unterminated date")
+		}
+		date, err := parseDate(strings.TrimSpace(value), p.DateLayout)
+		if err != nil {
+			return quote, err
+		}
+		quote.Date = date
+		line = strings.TrimSpace(rest)
+	} else if first, rest, found := strings.Cut(line, " "); found && isDigits(first) {
+		date, err := parseDate(first, "")
+		if err != nil {
+			return quote, err
+		}
+		quote.Date = date
+		line = strings.TrimSpace(rest)
+	}
+
+	for _, part := range strings.Split(line, " | ") {
+		utterance, err := parseUtterance(strings.TrimSpace(part))
+		if err != nil {
+			return quote, err
+		}
+		quote.Lines = append(quote.Lines, utterance)
+	}
+	return quote, nil
+}
+
+// parseUtterance parses "<nick> text" or "* nick action"
+func parseUtterance(part string) (Line, error) {
+	if rest, ok := strings.CutPrefix(part, "<"); ok {
+		nick, text, found := strings.Cut(rest, ">")
+		nick = strings.TrimLeft(strings.TrimSpace(nick), "@+%&~")
+		text = strings.TrimSpace(text)
+		if !found || nick == "" || text == "" {
+			return Line{}, fmt.Errorf("invalid utterance %q", part)
+		}
+		return Line{Author: nick, Text: text}, nil
+	}
+
+	if rest, ok := strings.CutPrefix(part, "* "); ok {
+		nick, action, found := strings.Cut(strings.TrimSpace(rest), " ")
+		if !found || nick == "" {
+			return Line{}, fmt.Errorf("invalid action %q", part)
+		}
+		return Line{Author: nick, Text: "* " + nick + " " + strings.TrimSpace(action)}, nil
+	}
+
+	return Line{}, fmt.Errorf("expected \"<nick> text\" or \"* nick action\", got %q", part)
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/quotes"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LegacyTables names the quote tables of the Elixir bot's database
+type LegacyTables struct {
+	Quotes  string
+	Entries string
+}
+
+// DefaultLegacyTables are the tables Ecto created for the Elixir bot
+var DefaultLegacyTables = LegacyTables{Quotes: "quotes", Entries: "quote_entries"}
+
+// LegacyQuote is a quote of the Elixir bot mapped to the Go schema
+type LegacyQuote struct {
+	ID        int64 // In the Elixir bot's database, for error reports
+	ChatID    int64
+	Creator   map[string]interface{}
+	CreatedAt time.Time
+	Entries   []quotes.CacheEntry
+}
+
+// LegacyError reports a quote of the Elixir bot that cannot be mapped
+type LegacyError struct {
+	QuoteID int64
+	Err     error
+}
+
+func (e *LegacyError) Error() string {
+	return fmt.Sprintf("quote %d: %v", e.QuoteID, e.Err)
+}
+
+func (e *LegacyError) Unwrap() error {
+	return e.Err
+}
+
+// legacyRow is a quote entry of the Elixir bot joined with its quote
+type legacyRow struct {
+	QuoteID    int64
+	ChatID     int64
+	Creator    []byte
+	InsertedAt time.Time
+	Order      int
+	Message    []byte
+}
+
+// ReadLegacy reads the quotes of the Elixir bot, those of a chat or all of
+// them when chatID is 0, oldest first. Quotes that cannot be mapped are
+// returned as errors instead.
+func ReadLegacy(ctx context.Context, db *gorm.DB, tables LegacyTables, chatID int64) ([]LegacyQuote, []*LegacyError, error) {
+	var rows []legacyRow
+	err := db.WithContext(ctx).Raw(`
+		SELECT q.id AS quote_id, q.chat_id, q.creator, q.inserted_at, e."order", e.message
+		FROM ? q
+		JOIN ? e ON e.quote_id = q.id
+		WHERE ? = 0 OR q.chat_id = ?
+		ORDER BY q.id, e."order"`,
+		clause.Table{Name: tables.Quotes}, clause.Table{Name: tables.Entries}, chatID, chatID,
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the legacy quotes: %w", err)
+	}
+	legacy, errs := legacyQuotes(rows)
+	return legacy, errs, nil
+}
+
+// legacyQuotes groups the entries of each quote and maps their JSON to the
+// Go schema
+func legacyQuotes(rows []legacyRow) ([]LegacyQuote, []*LegacyError) {
+	var legacy []LegacyQuote
+	var errs []*LegacyError
+	for start := 0; start < len(rows); {
+		end := start + 1
+		for end < len(rows) && rows[end].QuoteID == rows[start].QuoteID {
+			end++
+		}
+		quote, err := legacyQuote(rows[start:end])
+		if err != nil {
+			errs = append(errs, &LegacyError{QuoteID: rows[start].QuoteID, Err: err})
+		} else {
+			legacy = append(legacy, quote)
+		}
+		start = end
+	}
+	return legacy, errs
+}
+
+// legacyQuote maps the entries of a single quote
+func legacyQuote(rows []legacyRow) (LegacyQuote, error) {
+	first := rows[0]
+	quote := LegacyQuote{ID: first.QuoteID, ChatID: first.ChatID, CreatedAt: first.InsertedAt}
+	if err := unmarshalLegacy(first.Creator, &quote.Creator); err != nil {
+		return LegacyQuote{}, fmt.Errorf("invalid creator: %w", err)
+	}
+
+	for _, row := range rows {
+		var msg map[string]interface{}
+		if err := unmarshalLegacy(row.Message, &msg); err != nil {
+			return LegacyQuote{}, fmt.Errorf("invalid message at order %d: %w", row.Order, err)
+		}
+		// Old entries may lack the chat the Go renderer and search expect
+		if _, ok := msg["chat"].(map[string]interface{}); !ok {
+			msg["chat"] = map[string]interface{}{"id": first.ChatID}
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return LegacyQuote{}, err
+		}
+		entry := quotes.CacheEntry{ChatID: first.ChatID, Message: datatypes.JSON(data)}
+		if id, ok := msg["message_id"].(float64); ok {
+			entry.MessageID = int64(id)
+		}
+		if date, ok := msg["date"].(float64); ok {
+			entry.Date = int64(date)
+		}
+		quote.Entries = append(quote.Entries, entry)
+	}
+	return quote, nil
+}
+
+// unmarshalLegacy decodes a JSON object stored by the Elixir bot. Its
+// Telegram library stored every field of its structs, so the fields Telegram
+// did not send are null; they are dropped as the Go bot never stores them.
+func unmarshalLegacy(data []byte, v *map[string]interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	if *v == nil {
+		return fmt.Errorf("not a JSON object")
+	}
+	dropNulls(*v)
+	return nil
+}
+
+// dropNulls removes the null fields of an object and of the objects within
+func dropNulls(object map[string]interface{}) {
+	for key, value := range object {
+		switch value := value.(type) {
+		case nil:
+			delete(object, key)
+		case map[string]interface{}:
+			dropNulls(value)
+		case []interface{}:
+			for _, item := range value {
+				if item, ok := item.(map[string]interface{}); ok {
+					dropNulls(item)
+				}
+			}
+		}
+	}
+}
+
+// ImportLegacy stores the quotes of the Elixir bot in their chats. Either
+// every quote is stored or, on error, none is.
+func ImportLegacy(ctx context.Context, store *quotes.Store, legacy []LegacyQuote) (int, error) {
+	err := store.Transaction(ctx, func(tx *quotes.Store) error {
+		for _, quote := range legacy {
+			_, err := tx.Store(ctx, quotes.StoreOptions{
+				Creator:   quote.Creator,
+				ChatID:    quote.ChatID,
+				Entries:   quote.Entries,
+				CreatedAt: quote.CreatedAt,
+			})
+			if err != nil {
+				return &LegacyError{QuoteID: quote.ID, Err: err}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(legacy), nil
+}
+
+// LegacyChats returns the chats of the quotes, in order of appearance
+func LegacyChats(legacy []LegacyQuote) []int64 {
+	seen := make(map[int64]bool)
+	var chats []int64
+	for _, quote := range legacy {
+		if !seen[quote.ChatID] {
+			seen[quote.ChatID] = true
+			chats = append(chats, quote.ChatID)
+		}
+	}
+	return chats
+}
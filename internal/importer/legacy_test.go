@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var insertedAt = time.Date(2017, 3, 4, 20, 0, 0, 0, time.UTC)
+
+func TestLegacyQuotes(t *testing.T) {
+	rows := []legacyRow{
+		{QuoteID: 1, ChatID: -100123, Creator: []byte(`{"id": 7, "first_name": "Ana", "username": null}`), InsertedAt: insertedAt, Order: 0,
+			Message: []byte(`{"message_id": 10, "date": 1488657600, "chat": {"id": -100123, "title": null}, "from": {"id": 8, "first_name": "Bob", "last_name": null}, "text": "hi", "photo": null}`)},
+		{QuoteID: 1, ChatID: -100123, Creator: []byte(`{"id": 7}`), InsertedAt: insertedAt, Order: 1,
+			Message: []byte(`{"message_id": 11, "date": 1488657660, "from": {"first_name": "Ana"}, "text": "hello"}`)},
+		{QuoteID: 2, ChatID: -100123, Creator: []byte(`{"id": 7}`), InsertedAt: insertedAt, Order: 0, Message: []byte(`"not an object"`)},
+		{QuoteID: 3, ChatID: -100456, Creator: []byte(`null`), InsertedAt: insertedAt, Order: 0, Message: []byte(`{"text": "x"}`)},
+		{QuoteID: 4, ChatID: -100456, Creator: []byte(`{"id": 9}`), InsertedAt: insertedAt, Order: 0, Message: []byte(`{"text": "bye"}`)},
+	}
+
+	legacy, errs := legacyQuotes(rows)
+	require.Len(t, legacy, 2)
+	quote := legacy[0]
+	assert.Equal(t, int64(1), quote.ID)
+	assert.Equal(t, int64(-100123), quote.ChatID)
+	assert.Equal(t, insertedAt, quote.CreatedAt)
+	assert.Equal(t, map[string]interface{}{"id": float64(7), "first_name": "Ana"}, quote.Creator)
+	require.Len(t, quote.Entries, 2)
+	assert.JSONEq(t, `{"message_id": 10, "date": 1488657600, "chat": {"id": -100123}, "from": {"id": 8, "first_name": "Bob"}, "text": "hi"}`, string(quote.Entries[0].Message))
+	assert.Equal(t, int64(10), quote.Entries[0].MessageID)
+	assert.Equal(t, int64(1488657600), quote.Entries[0].Date)
+	assert.JSONEq(t, `{"message_id": 11, "date": 1488657660, "chat": {"id": -100123}, "from": {"first_name": "Ana"}, "text": "hello"}`, string(quote.Entries[1].Message),
+		"entries without a chat get the quote's")
+	assert.Equal(t, int64(4), legacy[1].ID)
+	assert.Equal(t, []int64{-100123, -100456}, LegacyChats(legacy))
+
+	require.Len(t, errs, 2)
+	assert.Equal(t, "quote 2: invalid message at order 0: json: cannot unmarshal string into Go value of type map[string]interface {}", errs[0].Error())
+	assert.Equal(t, "quote 3: invalid creator: not a JSON object", errs[1].Error())
+}
+
+func TestReadLegacy(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+	require.NoError(t, db.DB.Exec(`
+		CREATE TABLE quotes (id BIGSERIAL PRIMARY KEY, creator JSONB, chat_id BIGINT, inserted_at TIMESTAMP, updated_at TIMESTAMP);
+		CREATE TABLE quote_entries (id BIGSERIAL PRIMARY KEY, quote_id BIGINT REFERENCES quotes(id), "order" INT, message JSONB);
+		INSERT INTO quotes (creator, chat_id, inserted_at) VALUES ('{"id": 7, "first_name": "Ana"}', -100123, '2017-03-04 20:00:00'), ('{"id": 7}', -100456, '2017-03-05 20:00:00');
+		INSERT INTO quote_entries (quote_id, "order", message) VALUES
+			(1, 1, '{"message_id": 11, "date": 1488657660, "text": "second"}'),
+			(1, 0, '{"message_id": 10, "date": 1488657600, "text": "first"}'),
+			(2, 0, '{"message_id": 3, "date": 1488744000, "text": "other chat"}');`).Error)
+
+	legacy, errs, err := ReadLegacy(ctx, db.DB, DefaultLegacyTables, -100123)
+	require.NoError(t, err)
+	assert.Empty(t, errs)
+	require.Len(t, legacy, 1)
+	require.Len(t, legacy[0].Entries, 2)
+	assert.Contains(t, string(legacy[0].Entries[0].Message), "first")
+
+	legacy, _, err = ReadLegacy(ctx, db.DB, DefaultLegacyTables, 0)
+	require.NoError(t, err)
+	require.Len(t, legacy, 2)
+
+	imported, err := ImportLegacy(ctx, quotes.NewStore(db.DB), legacy)
+	require.NoError(t, err)
+	assert.Equal(t, 2, imported)
+	stored, err := quotes.NewStore(db.DB).CountForChat(ctx, -100456)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stored)
+}
@@ -0,0 +1,186 @@
+// Package integrity finds and repairs inconsistent rows that the schema
+// constraints do not rule out, or that predate them: databases migrated
+// from the Elixir bot, restored by hand or with constraints dropped.
+package integrity
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// sampleSize is how many row IDs a report shows per issue
+const sampleSize = 10
+
+// check is a single integrity check. find selects the IDs of the offending
+// rows of table; fixing deletes them.
+type check struct {
+	name        string
+	description string
+	table       string
+	find        string
+}
+
+// checks run in order: removing invalid entries can leave quotes without
+// entries, which the next check then finds
+var checks = []check{
+	{
+		name:        "orphaned-entries",
+		description: "quote entries of missing quotes",
+		table:       "quote_entry",
+		find:        `SELECT e.id FROM quote_entry e WHERE NOT EXISTS (SELECT 1 FROM quote q WHERE q.id = e.quote_id)`,
+	},
+	{
+		name:        "invalid-entries",
+		description: "quote entries whose message is not a Telegram message object",
+		table:       "quote_entry",
+		find: `SELECT id FROM quote_entry WHERE jsonb_typeof(message) IS DISTINCT FROM 'object'
+			OR jsonb_typeof(message->'chat') IS DISTINCT FROM 'object'
+			OR jsonb_typeof(message->'date') IS DISTINCT FROM 'number'`,
+	},
+	{
+		name:        "empty-quotes",
+		description: "quotes without entries",
+		table:       "quote",
+		find: `SELECT q.id FROM quote q WHERE NOT EXISTS
+			(SELECT 1 FROM quote_entry e WHERE e.quote_id = q.id AND e.deleted_at IS NULL)`,
+	},
+	{
+		name:        "cache-missing-ids",
+		description: "cached messages without a chat or message ID",
+		table:       "cache_entry",
+		find:        `SELECT id FROM cache_entry WHERE chat_id IS NULL OR chat_id = 0 OR message_id IS NULL OR message_id = 0`,
+	},
+	{
+		name:        "cache-duplicates",
+		description: "cached messages with the same chat and message ID as a newer one",
+		table:       "cache_entry",
+		find: `SELECT id FROM (
+			SELECT id, row_number() OVER (PARTITION BY chat_id, message_id ORDER BY id DESC) AS n FROM cache_entry
+		) c WHERE c.n > 1`,
+	},
+}
+
+// Issue is the outcome of a check
+type Issue struct {
+	Name        string
+	Description string
+	Count       int64
+	Fixed       int64
+	Sample      []int64 // First offending row IDs
+}
+
+// Report is the outcome of every check
+type Report struct {
+	Issues []Issue
+}
+
+// Found returns how many offending rows the checks found
+func (r Report) Found() int64 {
+	var found int64
+	for _, issue := range r.Issues {
+		found += issue.Count
+	}
+	return found
+}
+
+// Remaining returns how many offending rows were not fixed
+func (r Report) Remaining() int64 {
+	var remaining int64
+	for _, issue := range r.Issues {
+		remaining += issue.Count - issue.Fixed
+	}
+	return remaining
+}
+
+// String renders the report for the terminal
+func (r Report) String() string {
+	lines := make([]string, 0, len(r.Issues)+2)
+	for _, issue := range r.Issues {
+		mark := "✅"
+		detail := "none"
+		if issue.Count > 0 {
+			mark = "❌"
+			detail = fmt.Sprintf("%d (ids %s)", issue.Count, formatSample(issue.Sample, issue.Count))
+			if issue.Fixed > 0 {
+				mark = "🔧"
+				detail += fmt.Sprintf(", %d deleted", issue.Fixed)
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s %s: %s: %s", mark, issue.Name, issue.Description, detail))
+	}
+	switch {
+	case r.Found() == 0:
+		lines = append(lines, "", "No integrity issues found.")
+	case r.Remaining() > 0:
+		lines = append(lines, "", fmt.Sprintf("%d row(s) with integrity issues; run with --fix to delete them.", r.Remaining()))
+	default:
+		lines = append(lines, "", fmt.Sprintf("Fixed %d row(s).", r.Found()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatSample lists the sample IDs, noting when there are more
+func formatSample(ids []int64, count int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	text := strings.Join(parts, ", ")
+	if count > int64(len(ids)) {
+		text += ", …"
+	}
+	return text
+}
+
+// Verify runs every check. With fix the offending rows are deleted, all
+// in a single transaction.
+func Verify(ctx context.Context, db *gorm.DB, fix bool) (Report, error) {
+	var report Report
+	run := func(tx *gorm.DB) error {
+		for _, c := range checks {
+			issue, err := c.run(ctx, tx, fix)
+			if err != nil {
+				return err
+			}
+			report.Issues = append(report.Issues, issue)
+		}
+		return nil
+	}
+
+	if !fix {
+		return report, run(db)
+	}
+	err := db.WithContext(ctx).Transaction(run)
+	if err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+// run runs a check, deleting the offending rows with fix
+func (c check) run(ctx context.Context, db *gorm.DB, fix bool) (Issue, error) {
+	issue := Issue{Name: c.name, Description: c.description}
+	db = db.WithContext(ctx)
+
+	if err := db.Raw(`SELECT count(*) FROM (` + c.find + `) f`).Scan(&issue.Count).Error; err != nil {
+		return Issue{}, fmt.Errorf("%s: %w", c.name, err)
+	}
+	if issue.Count == 0 {
+		return issue, nil
+	}
+	if err := db.Raw(`SELECT id FROM (`+c.find+`) f ORDER BY id LIMIT ?`, sampleSize).Scan(&issue.Sample).Error; err != nil {
+		return Issue{}, fmt.Errorf("%s: %w", c.name, err)
+	}
+
+	if fix {
+		result := db.Exec(`DELETE FROM ` + c.table + ` WHERE id IN (` + c.find + `)`)
+		if result.Error != nil {
+			return Issue{}, fmt.Errorf("%s: failed to delete: %w", c.name, result.Error)
+		}
+		issue.Fixed = result.RowsAffected
+	}
+	return issue, nil
+}
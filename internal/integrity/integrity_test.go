@@ -0,0 +1,68 @@
+package integrity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport_String(t *testing.T) {
+	report := Report{Issues: []Issue{
+		{Name: "empty-quotes", Description: "quotes without entries", Count: 12, Sample: []int64{1, 2, 3}},
+		{Name: "cache-duplicates", Description: "duplicated cached messages"},
+	}}
+	assert.Equal(t, "❌ empty-quotes: quotes without entries: 12 (ids 1, 2, 3, …)\n"+
+		"✅ cache-duplicates: duplicated cached messages: none\n\n"+
+		"12 row(s) with integrity issues; run with --fix to delete them.", report.String())
+
+	report.Issues[0].Fixed = 12
+	assert.Zero(t, report.Remaining())
+	assert.Contains(t, report.String(), "🔧 empty-quotes: quotes without entries: 12 (ids 1, 2, 3, …), 12 deleted\n")
+	assert.Contains(t, report.String(), "Fixed 12 row(s).")
+
+	assert.Contains(t, Report{Issues: []Issue{{Name: "empty-quotes"}}}.String(), "No integrity issues found.")
+}
+
+func TestVerify(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+
+	exec := func(sql string, args ...interface{}) {
+		require.NoError(t, db.DB.Exec(sql, args...).Error)
+	}
+	exec(`INSERT INTO quote (id, creator, chat_id) VALUES (1, '{}', -100), (2, '{}', -100), (3, '{}', -100)`)
+	exec(`INSERT INTO quote_entry (quote_id, "order", message) VALUES
+		(1, 0, '{"chat": {"id": -100}, "date": 1, "text": "fine"}'),
+		(2, 0, '"not a message"')`)
+	exec(`INSERT INTO cache_entry (chat_id, message_id, date, message) VALUES (0, 5, 1, '{}'), (-100, 6, 1, '{}')`)
+
+	report, err := Verify(ctx, db.DB, false)
+	require.NoError(t, err)
+	counts := map[string]int64{}
+	for _, issue := range report.Issues {
+		counts[issue.Name] = issue.Count
+	}
+	assert.Equal(t, map[string]int64{
+		"orphaned-entries":  0,
+		"invalid-entries":   1,
+		"empty-quotes":      1, // Quote 3; quote 2 still has its invalid entry
+		"cache-missing-ids": 1,
+		"cache-duplicates":  0,
+	}, counts)
+
+	report, err = Verify(ctx, db.DB, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), report.Found()) // Removing the invalid entry empties quote 2
+	assert.Zero(t, report.Remaining())
+
+	report, err = Verify(ctx, db.DB, false)
+	require.NoError(t, err)
+	assert.Zero(t, report.Found())
+
+	var quotes int64
+	require.NoError(t, db.DB.Table("quote").Count(&quotes).Error)
+	assert.Equal(t, int64(1), quotes)
+}
@@ -0,0 +1,167 @@
+// Package kv is the key-value store replicas share their hot state in:
+// cached administrators, rate limits, command cooldowns and pending
+// confirmations. Without a store each of them keeps its state in process,
+// which is right for a single replica.
+package kv
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+)
+
+// Store keeps values that expire. Every key is set with a TTL.
+type Store interface {
+	// Get returns the value of a key, and false if it is missing
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores a value for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetNX stores a value for ttl unless the key exists, and reports
+	// whether it did
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Take returns the value of a key and deletes it, so that only one
+	// caller gets it
+	Take(ctx context.Context, key string) ([]byte, bool, error)
+	// Delete removes a key
+	Delete(ctx context.Context, key string) error
+	// Incr adds one to a counter and returns its value. A new counter
+	// expires after ttl; incrementing does not extend it.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
+
+// Ensure both stores keep satisfying the interface
+var (
+	_ Store = (*Memory)(nil)
+	_ Store = (*Redis)(nil)
+)
+
+// memorySweepInterval is how often writes drop every expired key, so keys
+// that are never read again do not pile up
+const memorySweepInterval = time.Minute
+
+// Memory is a Store in process memory, for tests and single replicas
+type Memory struct {
+	clock clock.Clock
+
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	nextSweep time.Time
+}
+
+// memoryEntry is a value and when it expires
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory creates an empty in-process store
+func NewMemory() *Memory {
+	return &Memory{clock: clock.System{}, entries: make(map[string]memoryEntry)}
+}
+
+// WithClock replaces the time source keys expire by
+func (m *Memory) WithClock(clk clock.Clock) *Memory {
+	m.clock = clk
+	return m
+}
+
+// Get returns the value of a key
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.live(key)
+	return entry.value, ok, nil
+}
+
+// Set stores a value for ttl
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep()
+	m.entries[key] = memoryEntry{value: value, expires: m.clock.Now().Add(ttl)}
+	return nil
+}
+
+// SetNX stores a value for ttl unless the key exists
+func (m *Memory) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.live(key); ok {
+		return false, nil
+	}
+	m.sweep()
+	m.entries[key] = memoryEntry{value: value, expires: m.clock.Now().Add(ttl)}
+	return true, nil
+}
+
+// Take returns the value of a key and deletes it
+func (m *Memory) Take(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.live(key)
+	delete(m.entries, key)
+	return entry.value, ok, nil
+}
+
+// Delete removes a key
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// Incr adds one to a counter
+func (m *Memory) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.live(key)
+	if !ok {
+		m.sweep()
+		entry = memoryEntry{expires: m.clock.Now().Add(ttl)}
+	}
+	count := decodeCount(entry.value) + 1
+	entry.value = encodeCount(count)
+	m.entries[key] = entry
+	return count, nil
+}
+
+// live returns the entry of a key unless it expired, forgetting expired
+// ones. Callers hold the lock.
+func (m *Memory) live(key string) (memoryEntry, bool) {
+	entry, ok := m.entries[key]
+	if ok && !m.clock.Now().Before(entry.expires) {
+		delete(m.entries, key)
+		return memoryEntry{}, false
+	}
+	return entry, ok
+}
+
+// sweep drops every expired key, at most once per memorySweepInterval.
+// Callers hold the lock.
+func (m *Memory) sweep() {
+	now := m.clock.Now()
+	if now.Before(m.nextSweep) {
+		return
+	}
+	m.nextSweep = now.Add(memorySweepInterval)
+	for key, entry := range m.entries {
+		if !now.Before(entry.expires) {
+			delete(m.entries, key)
+		}
+	}
+}
+
+// encodeCount writes a counter in decimal, as Redis keeps them
+func encodeCount(count int64) []byte {
+	return strconv.AppendInt(nil, count, 10)
+}
+
+// decodeCount reads a counter, zero for none
+func decodeCount(value []byte) int64 {
+	count, _ := strconv.ParseInt(string(value), 10, 64)
+	return count
+}
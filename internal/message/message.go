@@ -0,0 +1,422 @@
+// Package message defines the canonical form in which Telegram messages are
+// cached and stored in quotes, and converts it to and from the Bot API types.
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// Message is the part of a Telegram message the bot keeps. Its JSON uses the
+// Bot API field names, so stored messages read like the original updates.
+type Message struct {
+	MessageID  int64    `json:"message_id"`
+	Chat       Chat     `json:"chat"`
+	Date       int64    `json:"date"`
+	EditDate   int64    `json:"edit_date,omitempty"`
+	Text       string   `json:"text,omitempty"`
+	Caption    string   `json:"caption,omitempty"` // Text of photos, videos and documents
+	From       *User    `json:"from,omitempty"`
+	ViaBot     *User    `json:"via_bot,omitempty"`
+	SenderChat *Chat    `json:"sender_chat,omitempty"` // Channel or chat the message was sent on behalf of
+	ReplyTo    *Message `json:"reply_to_message,omitempty"`
+	// Entities and CaptionEntities are the custom emoji of the text and the
+	// caption; other formatting is not kept
+	Entities        []Entity `json:"entities,omitempty"`
+	CaptionEntities []Entity `json:"caption_entities,omitempty"`
+	// IsAutomaticForward marks channel posts forwarded to the linked
+	// discussion group
+	IsAutomaticForward bool `json:"is_automatic_forward,omitempty"`
+	// ForwardOrigin is where a forwarded message was first sent
+	ForwardOrigin *Origin `json:"forward_origin,omitempty"`
+	// Media is the photo, video or other file the message carries
+	Media *Media `json:"media,omitempty"`
+}
+
+// Media is the file of a message: its kind, as the Bot API field holding
+// it (photo, video, animation, sticker, voice, video_note, audio or
+// document), and the file ID it can be sent again with
+type Media struct {
+	Type   string `json:"type"`
+	FileID string `json:"file_id"`
+}
+
+// Origin is where a forwarded message was first sent. Only channel posts
+// carry the original message ID; other origins are known by sender and date.
+type Origin struct {
+	Type           string `json:"type"` // user, hidden_user, chat or channel
+	Date           int64  `json:"date"`
+	SenderUser     *User  `json:"sender_user,omitempty"`      // user
+	SenderUserName string `json:"sender_user_name,omitempty"` // hidden_user
+	SenderChat     *Chat  `json:"sender_chat,omitempty"`      // chat
+	Chat           *Chat  `json:"chat,omitempty"`             // channel
+	MessageID      int64  `json:"message_id,omitempty"`       // channel
+}
+
+// Entity is a custom emoji of a message text. Offset and Length count
+// UTF-16 code units, as in the Bot API; the text it covers is the emoji
+// shown where custom emoji are not available.
+type Entity struct {
+	Type          string `json:"type"`
+	Offset        int    `json:"offset"`
+	Length        int    `json:"length"`
+	CustomEmojiID string `json:"custom_emoji_id,omitempty"`
+}
+
+// Chat is a Telegram chat
+type Chat struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// User is a Telegram user
+type User struct {
+	ID        int64  `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name,omitempty"`
+	Username  string `json:"username,omitempty"`
+	IsBot     bool   `json:"is_bot,omitempty"`
+}
+
+// FromTelegram converts a Bot API message. The message it replies to is
+// kept by ID only, as it is cached on its own.
+func FromTelegram(msg *models.Message) *Message {
+	if msg == nil {
+		return nil
+	}
+	m := &Message{
+		MessageID:          int64(msg.ID),
+		Chat:               *FromTelegramChat(&msg.Chat),
+		Date:               int64(msg.Date),
+		EditDate:           int64(msg.EditDate),
+		Text:               msg.Text,
+		Caption:            msg.Caption,
+		Entities:           fromTelegramEntities(msg.Entities),
+		CaptionEntities:    fromTelegramEntities(msg.CaptionEntities),
+		From:               FromTelegramUser(msg.From),
+		ViaBot:             FromTelegramUser(msg.ViaBot),
+		SenderChat:         FromTelegramChat(msg.SenderChat),
+		IsAutomaticForward: msg.IsAutomaticForward,
+		ForwardOrigin:      fromTelegramOrigin(msg.ForwardOrigin),
+		Media:              fromTelegramMedia(msg),
+	}
+	if msg.ReplyToMessage != nil {
+		m.ReplyTo = &Message{MessageID: int64(msg.ReplyToMessage.ID)}
+	}
+	return m
+}
+
+// fromTelegramMedia returns the file of a Bot API message, the largest size
+// of photos, or nil for messages without one
+func fromTelegramMedia(msg *models.Message) *Media {
+	switch {
+	case len(msg.Photo) > 0:
+		return &Media{Type: "photo", FileID: msg.Photo[len(msg.Photo)-1].FileID}
+	case msg.Video != nil:
+		return &Media{Type: "video", FileID: msg.Video.FileID}
+	case msg.Animation != nil:
+		// Animations carry a document too, for old clients
+		return &Media{Type: "animation", FileID: msg.Animation.FileID}
+	case msg.Sticker != nil:
+		return &Media{Type: "sticker", FileID: msg.Sticker.FileID}
+	case msg.Voice != nil:
+		return &Media{Type: "voice", FileID: msg.Voice.FileID}
+	case msg.VideoNote != nil:
+		return &Media{Type: "video_note", FileID: msg.VideoNote.FileID}
+	case msg.Audio != nil:
+		return &Media{Type: "audio", FileID: msg.Audio.FileID}
+	case msg.Document != nil:
+		return &Media{Type: "document", FileID: msg.Document.FileID}
+	}
+	return nil
+}
+
+// fromTelegramEntities keeps the custom emoji of Bot API entities
+func fromTelegramEntities(entities []models.MessageEntity) []Entity {
+	var kept []Entity
+	for _, entity := range entities {
+		if entity.Type != models.MessageEntityTypeCustomEmoji {
+			continue
+		}
+		kept = append(kept, Entity{
+			Type:          string(entity.Type),
+			Offset:        entity.Offset,
+			Length:        entity.Length,
+			CustomEmojiID: entity.CustomEmojiID,
+		})
+	}
+	return kept
+}
+
+// fromTelegramOrigin converts the Bot API origin of a forwarded message
+func fromTelegramOrigin(origin *models.MessageOrigin) *Origin {
+	if origin == nil {
+		return nil
+	}
+	o := &Origin{Type: string(origin.Type)}
+	switch {
+	case origin.MessageOriginUser != nil:
+		o.Date = int64(origin.MessageOriginUser.Date)
+		o.SenderUser = FromTelegramUser(&origin.MessageOriginUser.SenderUser)
+	case origin.MessageOriginHiddenUser != nil:
+		o.Date = int64(origin.MessageOriginHiddenUser.Date)
+		o.SenderUserName = origin.MessageOriginHiddenUser.SenderUserName
+	case origin.MessageOriginChat != nil:
+		o.Date = int64(origin.MessageOriginChat.Date)
+		o.SenderChat = FromTelegramChat(&origin.MessageOriginChat.SenderChat)
+	case origin.MessageOriginChannel != nil:
+		o.Date = int64(origin.MessageOriginChannel.Date)
+		o.Chat = FromTelegramChat(&origin.MessageOriginChannel.Chat)
+		o.MessageID = int64(origin.MessageOriginChannel.MessageID)
+	}
+	return o
+}
+
+// FromTelegramUser converts a Bot API user
+func FromTelegramUser(user *models.User) *User {
+	if user == nil {
+		return nil
+	}
+	return &User{
+		ID:        user.ID,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Username:  user.Username,
+		IsBot:     user.IsBot,
+	}
+}
+
+// FromTelegramChat converts a Bot API chat
+func FromTelegramChat(chat *models.Chat) *Chat {
+	if chat == nil {
+		return nil
+	}
+	return &Chat{
+		ID:       chat.ID,
+		Type:     string(chat.Type),
+		Title:    chat.Title,
+		Username: chat.Username,
+	}
+}
+
+// Telegram converts the message back to the Bot API type
+func (m *Message) Telegram() *models.Message {
+	if m == nil {
+		return nil
+	}
+	msg := &models.Message{
+		ID:                 int(m.MessageID),
+		Chat:               *m.Chat.telegram(),
+		Date:               int(m.Date),
+		EditDate:           int(m.EditDate),
+		Text:               m.Text,
+		Caption:            m.Caption,
+		Entities:           telegramEntities(m.Entities),
+		CaptionEntities:    telegramEntities(m.CaptionEntities),
+		From:               m.From.telegram(),
+		ViaBot:             m.ViaBot.telegram(),
+		SenderChat:         m.SenderChat.telegram(),
+		IsAutomaticForward: m.IsAutomaticForward,
+		ForwardOrigin:      m.ForwardOrigin.telegram(),
+	}
+	if m.ReplyTo != nil {
+		msg.ReplyToMessage = m.ReplyTo.Telegram()
+	}
+	m.Media.telegram(msg)
+	return msg
+}
+
+// telegram sets the file back on a Bot API message. Photos get a single
+// size, the one kept.
+func (m *Media) telegram(msg *models.Message) {
+	if m == nil {
+		return
+	}
+	switch m.Type {
+	case "photo":
+		msg.Photo = []models.PhotoSize{{FileID: m.FileID}}
+	case "video":
+		msg.Video = &models.Video{FileID: m.FileID}
+	case "animation":
+		msg.Animation = &models.Animation{FileID: m.FileID}
+	case "sticker":
+		msg.Sticker = &models.Sticker{FileID: m.FileID}
+	case "voice":
+		msg.Voice = &models.Voice{FileID: m.FileID}
+	case "video_note":
+		msg.VideoNote = &models.VideoNote{FileID: m.FileID}
+	case "audio":
+		msg.Audio = &models.Audio{FileID: m.FileID}
+	case "document":
+		msg.Document = &models.Document{FileID: m.FileID}
+	}
+}
+
+// telegramEntities converts entities back to the Bot API type
+func telegramEntities(entities []Entity) []models.MessageEntity {
+	if entities == nil {
+		return nil
+	}
+	converted := make([]models.MessageEntity, 0, len(entities))
+	for _, entity := range entities {
+		converted = append(converted, models.MessageEntity{
+			Type:          models.MessageEntityType(entity.Type),
+			Offset:        entity.Offset,
+			Length:        entity.Length,
+			CustomEmojiID: entity.CustomEmojiID,
+		})
+	}
+	return converted
+}
+
+// telegram converts the origin back to the Bot API type
+func (o *Origin) telegram() *models.MessageOrigin {
+	if o == nil {
+		return nil
+	}
+	origin := &models.MessageOrigin{Type: models.MessageOriginType(o.Type)}
+	switch origin.Type {
+	case models.MessageOriginTypeUser:
+		origin.MessageOriginUser = &models.MessageOriginUser{Type: origin.Type, Date: int(o.Date)}
+		if user := o.SenderUser.telegram(); user != nil {
+			origin.MessageOriginUser.SenderUser = *user
+		}
+	case models.MessageOriginTypeHiddenUser:
+		origin.MessageOriginHiddenUser = &models.MessageOriginHiddenUser{Type: origin.Type, Date: int(o.Date), SenderUserName: o.SenderUserName}
+	case models.MessageOriginTypeChat:
+		origin.MessageOriginChat = &models.MessageOriginChat{Type: origin.Type, Date: int(o.Date)}
+		if chat := o.SenderChat.telegram(); chat != nil {
+			origin.MessageOriginChat.SenderChat = *chat
+		}
+	case models.MessageOriginTypeChannel:
+		origin.MessageOriginChannel = &models.MessageOriginChannel{Type: origin.Type, Date: int(o.Date), MessageID: int(o.MessageID)}
+		if chat := o.Chat.telegram(); chat != nil {
+			origin.MessageOriginChannel.Chat = *chat
+		}
+	}
+	return origin
+}
+
+// telegram converts the user back to the Bot API type
+func (u *User) telegram() *models.User {
+	if u == nil {
+		return nil
+	}
+	return &models.User{
+		ID:        u.ID,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Username:  u.Username,
+		IsBot:     u.IsBot,
+	}
+}
+
+// telegram converts the chat back to the Bot API type
+func (c *Chat) telegram() *models.Chat {
+	if c == nil {
+		return nil
+	}
+	return &models.Chat{
+		ID:       c.ID,
+		Type:     models.ChatType(c.Type),
+		Title:    c.Title,
+		Username: c.Username,
+	}
+}
+
+// Parse reads a stored message
+func Parse(data []byte) (*Message, error) {
+	var m Message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	// Messages stored as full updates have every kind of entity
+	m.Entities = customEmoji(m.Entities)
+	m.CaptionEntities = customEmoji(m.CaptionEntities)
+	return &m, nil
+}
+
+// customEmoji returns the custom emoji among entities, nil if none
+func customEmoji(entities []Entity) []Entity {
+	var kept []Entity
+	for _, entity := range entities {
+		if entity.Type == string(models.MessageEntityTypeCustomEmoji) {
+			kept = append(kept, entity)
+		}
+	}
+	return kept
+}
+
+// JSON encodes the message for storage
+func (m *Message) JSON() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// Body returns the text of the message, or the caption of its media
+func (m *Message) Body() string {
+	if m.Text != "" {
+		return m.Text
+	}
+	return m.Caption
+}
+
+// BodyEntities returns the entities of the text Body returns
+func (m *Message) BodyEntities() []Entity {
+	if m.Text != "" {
+		return m.Entities
+	}
+	return m.CaptionEntities
+}
+
+// HasMedia reports whether the message carries a file. Messages cached
+// before their media was kept are known by their caption, which only media
+// have.
+func (m *Message) HasMedia() bool {
+	return m.Media != nil || m.Caption != ""
+}
+
+// ReplyToID returns the ID of the message this one replies to, or nil
+func (m *Message) ReplyToID() *int64 {
+	if m.ReplyTo == nil || m.ReplyTo.MessageID == 0 {
+		return nil
+	}
+	id := m.ReplyTo.MessageID
+	return &id
+}
+
+// IsBot reports whether the message was written by a bot or sent via an
+// inline bot. Messages sent on behalf of a chat come from a bot account but
+// are not counted.
+func (m *Message) IsBot() bool {
+	return (m.From != nil && m.From.IsBot && m.SenderChat == nil) || m.ViaBot != nil
+}
+
+// IsAnonymousAdmin reports whether the message was sent by an anonymous
+// admin, that is on behalf of the chat itself
+func (m *Message) IsAnonymousAdmin() bool {
+	return m.SenderChat != nil && m.SenderChat.ID == m.Chat.ID
+}
+
+// Link returns the t.me link opening the message in its chat, or "" when
+// the chat has none. Public chats link by username; other supergroups and
+// channels only open for their members.
+func (m *Message) Link() string {
+	if m.MessageID == 0 {
+		return ""
+	}
+	if m.Chat.Username != "" && m.Chat.Type != "private" {
+		return fmt.Sprintf("https://t.me/%s/%d", m.Chat.Username, m.MessageID)
+	}
+	// Supergroup and channel IDs are -100 followed by the ID the links use
+	id, ok := strings.CutPrefix(strconv.FormatInt(m.Chat.ID, 10), "-100")
+	if !ok || id == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://t.me/c/%s/%d", id, m.MessageID)
+}
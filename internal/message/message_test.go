@@ -0,0 +1,288 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// telegramMessages cover every field the canonical message keeps
+var telegramMessages = map[string]*models.Message{
+	"text": {
+		ID:   1,
+		Chat: models.Chat{ID: -100123, Type: models.ChatTypeSupergroup, Title: "Quote Club"},
+		Date: 1609459200,
+		Text: "hello",
+		From: &models.User{ID: 42, FirstName: "Ana", LastName: "García", Username: "ana"},
+	},
+	"edited reply": {
+		ID:             2,
+		Chat:           models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+		Date:           1609459200,
+		EditDate:       1609459260,
+		Text:           "fixed typo",
+		From:           &models.User{ID: 42, FirstName: "Ana"},
+		ReplyToMessage: &models.Message{ID: 1},
+	},
+	"photo caption": {
+		ID:      3,
+		Chat:    models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+		Date:    1609459200,
+		Caption: "look at this",
+		From:    &models.User{ID: 42, FirstName: "Ana"},
+	},
+	"via inline bot": {
+		ID:     4,
+		Chat:   models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+		Date:   1609459200,
+		Text:   "a gif",
+		From:   &models.User{ID: 42, FirstName: "Ana"},
+		ViaBot: &models.User{ID: 9, FirstName: "GIF", Username: "gif", IsBot: true},
+	},
+	"linked channel post": {
+		ID:                 5,
+		Chat:               models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+		Date:               1609459200,
+		Text:               "new episode",
+		From:               &models.User{ID: 777000, FirstName: "Telegram"},
+		SenderChat:         &models.Chat{ID: -100555, Type: models.ChatTypeChannel, Title: "News", Username: "news"},
+		IsAutomaticForward: true,
+	},
+	"anonymous admin": {
+		ID:         6,
+		Chat:       models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+		Date:       1609459200,
+		Text:       "rules updated",
+		From:       &models.User{ID: 1087968824, FirstName: "Group", Username: "GroupAnonymousBot", IsBot: true},
+		SenderChat: &models.Chat{ID: -100123, Type: models.ChatTypeSupergroup, Title: "Quote Club"},
+	},
+	"custom emoji": {
+		ID:   11,
+		Chat: models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+		Date: 1609459200,
+		Text: "nice 👍 one",
+		From: &models.User{ID: 42, FirstName: "Ana"},
+		Entities: []models.MessageEntity{
+			{Type: models.MessageEntityTypeCustomEmoji, Offset: 5, Length: 2, CustomEmojiID: "5368324170671202286"},
+		},
+	},
+	"custom emoji caption": {
+		ID:      12,
+		Chat:    models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+		Date:    1609459200,
+		Caption: "🔥",
+		From:    &models.User{ID: 42, FirstName: "Ana"},
+		CaptionEntities: []models.MessageEntity{
+			{Type: models.MessageEntityTypeCustomEmoji, Offset: 0, Length: 2, CustomEmojiID: "5420315771991497307"},
+		},
+	},
+	"forwarded from user": {
+		ID:   7,
+		Chat: models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+		Date: 1609459300,
+		Text: "as she said",
+		From: &models.User{ID: 42, FirstName: "Ana"},
+		ForwardOrigin: &models.MessageOrigin{
+			Type: models.MessageOriginTypeUser,
+			MessageOriginUser: &models.MessageOriginUser{
+				Type: models.MessageOriginTypeUser, Date: 1609459200, SenderUser: models.User{ID: 43, FirstName: "Bea"},
+			},
+		},
+	},
+	"forwarded from hidden user": {
+		ID:   8,
+		Chat: models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+		Date: 1609459300,
+		Text: "anonymous wisdom",
+		From: &models.User{ID: 42, FirstName: "Ana"},
+		ForwardOrigin: &models.MessageOrigin{
+			Type: models.MessageOriginTypeHiddenUser,
+			MessageOriginHiddenUser: &models.MessageOriginHiddenUser{
+				Type: models.MessageOriginTypeHiddenUser, Date: 1609459200, SenderUserName: "Someone",
+			},
+		},
+	},
+	"photo": {
+		ID:      11,
+		Chat:    models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+		Date:    1609459300,
+		Caption: "look",
+		From:    &models.User{ID: 42, FirstName: "Ana"},
+		Photo:   []models.PhotoSize{{FileID: "AgAD-large"}},
+	},
+	"sticker": {
+		ID:      12,
+		Chat:    models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+		Date:    1609459300,
+		From:    &models.User{ID: 42, FirstName: "Ana"},
+		Sticker: &models.Sticker{FileID: "CAAD-sticker"},
+	},
+	"forwarded from chat": {
+		ID:   9,
+		Chat: models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+		Date: 1609459300,
+		Text: "admins say",
+		From: &models.User{ID: 42, FirstName: "Ana"},
+		ForwardOrigin: &models.MessageOrigin{
+			Type: models.MessageOriginTypeChat,
+			MessageOriginChat: &models.MessageOriginChat{
+				Type: models.MessageOriginTypeChat, Date: 1609459200, SenderChat: models.Chat{ID: -100456, Type: models.ChatTypeSupergroup},
+			},
+		},
+	},
+	"forwarded from channel": {
+		ID:   10,
+		Chat: models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+		Date: 1609459300,
+		Text: "breaking",
+		From: &models.User{ID: 42, FirstName: "Ana"},
+		ForwardOrigin: &models.MessageOrigin{
+			Type: models.MessageOriginTypeChannel,
+			MessageOriginChannel: &models.MessageOriginChannel{
+				Type: models.MessageOriginTypeChannel, Date: 1609459200, MessageID: 31,
+				Chat: models.Chat{ID: -100555, Type: models.ChatTypeChannel, Title: "News"},
+			},
+		},
+	},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, original := range telegramMessages {
+		t.Run(name, func(t *testing.T) {
+			data, err := FromTelegram(original).JSON()
+			require.NoError(t, err)
+
+			parsed, err := Parse(data)
+			require.NoError(t, err)
+			assert.Equal(t, FromTelegram(original), parsed)
+			assert.Equal(t, original, parsed.Telegram())
+		})
+	}
+}
+
+func TestFromTelegram_Media(t *testing.T) {
+	msg := FromTelegram(&models.Message{
+		ID:    1,
+		Photo: []models.PhotoSize{{FileID: "small", Width: 90}, {FileID: "large", Width: 1280}},
+	})
+	assert.Equal(t, &Media{Type: "photo", FileID: "large"}, msg.Media, "the largest size")
+	assert.True(t, msg.HasMedia())
+
+	msg = FromTelegram(&models.Message{
+		ID:        2,
+		Animation: &models.Animation{FileID: "gif"},
+		Document:  &models.Document{FileID: "gif"},
+	})
+	assert.Equal(t, "animation", msg.Media.Type)
+
+	assert.False(t, FromTelegram(&models.Message{ID: 3, Text: "hi"}).HasMedia())
+	assert.True(t, (&Message{Caption: "cached before media was kept"}).HasMedia())
+}
+
+func TestFromTelegram_Nil(t *testing.T) {
+	assert.Nil(t, FromTelegram(nil))
+	assert.Nil(t, FromTelegramUser(nil))
+	assert.Nil(t, FromTelegramChat(nil))
+	assert.Nil(t, (*Message)(nil).Telegram())
+}
+
+func TestFromTelegram_ReplyKeptByID(t *testing.T) {
+	msg := FromTelegram(&models.Message{
+		ID:             2,
+		ReplyToMessage: &models.Message{ID: 1, Text: "original", From: &models.User{ID: 7}},
+	})
+	assert.Equal(t, &Message{MessageID: 1}, msg.ReplyTo)
+	require.NotNil(t, msg.ReplyToID())
+	assert.Equal(t, int64(1), *msg.ReplyToID())
+
+	assert.Nil(t, FromTelegram(&models.Message{ID: 1}).ReplyToID())
+}
+
+func TestFromTelegramUser(t *testing.T) {
+	assert.Equal(t, &User{ID: 1, FirstName: "Ana"}, FromTelegramUser(&models.User{ID: 1, FirstName: "Ana", LanguageCode: "es"}))
+	assert.Equal(t,
+		&User{ID: 2, FirstName: "GIF", Username: "gif", IsBot: true},
+		FromTelegramUser(&models.User{ID: 2, FirstName: "GIF", Username: "gif", IsBot: true}))
+}
+
+func TestJSON(t *testing.T) {
+	data, err := FromTelegram(telegramMessages["via inline bot"]).JSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"message_id": 4,
+		"chat": {"id": -100123, "type": "supergroup"},
+		"date": 1609459200,
+		"text": "a gif",
+		"from": {"id": 42, "first_name": "Ana"},
+		"via_bot": {"id": 9, "first_name": "GIF", "username": "gif", "is_bot": true}
+	}`, string(data))
+}
+
+func TestParse(t *testing.T) {
+	// Messages stored as full Bot API updates keep the fields the bot uses
+	msg, err := Parse([]byte(`{"message_id":1,"chat":{"id":-100123,"type":"group","all_members_are_administrators":true},"date":5,"text":"hi","from":{"id":1,"first_name":"Ana","language_code":"es"},"entities":[]}`))
+	require.NoError(t, err)
+	assert.Equal(t, &Message{
+		MessageID: 1,
+		Chat:      Chat{ID: -100123, Type: "group"},
+		Date:      5,
+		Text:      "hi",
+		From:      &User{ID: 1, FirstName: "Ana"},
+	}, msg)
+
+	_, err = Parse([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestFromTelegram_KeepsOnlyCustomEmoji(t *testing.T) {
+	msg := FromTelegram(&models.Message{
+		ID:   1,
+		Text: "bold 😀",
+		Entities: []models.MessageEntity{
+			{Type: models.MessageEntityTypeBold, Offset: 0, Length: 4},
+			{Type: models.MessageEntityTypeCustomEmoji, Offset: 5, Length: 2, CustomEmojiID: "1"},
+		},
+	})
+	assert.Equal(t, []Entity{{Type: "custom_emoji", Offset: 5, Length: 2, CustomEmojiID: "1"}}, msg.Entities)
+	assert.Nil(t, FromTelegram(&models.Message{ID: 1, Text: "plain"}).Entities)
+
+	// Full updates keep their custom emoji only
+	parsed, err := Parse([]byte(`{"message_id":1,"chat":{"id":1},"date":5,"text":"bold 😀","entities":[{"type":"bold","offset":0,"length":4},{"type":"custom_emoji","offset":5,"length":2,"custom_emoji_id":"1"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, msg.Entities, parsed.Entities)
+}
+
+func TestMessage_BodyEntities(t *testing.T) {
+	assert.Equal(t, "5368324170671202286", FromTelegram(telegramMessages["custom emoji"]).BodyEntities()[0].CustomEmojiID)
+	assert.Equal(t, "5420315771991497307", FromTelegram(telegramMessages["custom emoji caption"]).BodyEntities()[0].CustomEmojiID)
+	assert.Nil(t, FromTelegram(telegramMessages["text"]).BodyEntities())
+}
+
+func TestMessage_Body(t *testing.T) {
+	assert.Equal(t, "hello", FromTelegram(telegramMessages["text"]).Body())
+	assert.Equal(t, "look at this", FromTelegram(telegramMessages["photo caption"]).Body())
+	assert.Equal(t, "", (&Message{}).Body())
+}
+
+func TestMessage_IsBot(t *testing.T) {
+	assert.False(t, FromTelegram(telegramMessages["text"]).IsBot())
+	assert.True(t, FromTelegram(telegramMessages["via inline bot"]).IsBot())
+	assert.True(t, (&Message{From: &User{ID: 9, IsBot: true}}).IsBot())
+	assert.False(t, FromTelegram(telegramMessages["anonymous admin"]).IsBot())
+}
+
+func TestMessage_IsAnonymousAdmin(t *testing.T) {
+	assert.True(t, FromTelegram(telegramMessages["anonymous admin"]).IsAnonymousAdmin())
+	assert.False(t, FromTelegram(telegramMessages["linked channel post"]).IsAnonymousAdmin())
+	assert.False(t, FromTelegram(telegramMessages["text"]).IsAnonymousAdmin())
+}
+
+func TestMessage_Link(t *testing.T) {
+	assert.Equal(t, "https://t.me/c/1234567890/42", (&Message{MessageID: 42, Chat: Chat{ID: -1001234567890, Type: "supergroup"}}).Link())
+	assert.Equal(t, "https://t.me/wanonchat/42", (&Message{MessageID: 42, Chat: Chat{ID: -1001234567890, Username: "wanonchat"}}).Link())
+	assert.Empty(t, (&Message{MessageID: 42, Chat: Chat{ID: -123456, Type: "group"}}).Link(), "basic groups have no links")
+	assert.Empty(t, (&Message{MessageID: 42, Chat: Chat{ID: 1001, Type: "private", Username: "ana"}}).Link())
+	assert.Empty(t, (&Message{Chat: Chat{ID: -1001234567890}}).Link())
+}
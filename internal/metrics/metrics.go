@@ -0,0 +1,233 @@
+// Package metrics measures command handlers and exposes them in the
+// Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the latency histogram
+var durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultWindow is how long recent latencies are kept for percentiles
+const DefaultWindow = 5 * time.Minute
+
+// Recorder collects the duration and outcome of every handled command
+type Recorder struct {
+	window time.Duration
+	clock  clock.Clock
+
+	mu         sync.Mutex
+	commands   map[string]*commandStats
+	collectors []Collector
+}
+
+// Collector writes metrics measured outside the recorder
+type Collector interface {
+	WritePrometheus(w io.Writer) error
+}
+
+// commandStats are the measurements of a single command
+type commandStats struct {
+	ok      uint64
+	failed  uint64
+	buckets []uint64 // Observations per bucket, not cumulative; the last is +Inf
+	sum     time.Duration
+	recent  []sample // Observations within the window, oldest first
+}
+
+// sample is a single observation kept for percentiles
+type sample struct {
+	at       time.Time
+	duration time.Duration
+}
+
+// NewRecorder creates a recorder keeping the latencies of the last window
+// for percentiles. A zero window uses DefaultWindow.
+func NewRecorder(window time.Duration) *Recorder {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &Recorder{
+		window:   window,
+		clock:    clock.System{},
+		commands: make(map[string]*commandStats),
+	}
+}
+
+// WithClock replaces the time source used to age observations
+func (r *Recorder) WithClock(clk clock.Clock) *Recorder {
+	r.clock = clk
+	return r
+}
+
+// Register adds a collector whose metrics are written after the command metrics
+func (r *Recorder) Register(collector Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collector)
+}
+
+// Window returns how long recent latencies are kept
+func (r *Recorder) Window() time.Duration {
+	return r.window
+}
+
+// Observe records a handled command, its duration and whether it failed
+func (r *Recorder) Observe(command string, duration time.Duration, err error) {
+	now := r.clock.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats, ok := r.commands[command]
+	if !ok {
+		stats = &commandStats{buckets: make([]uint64, len(durationBuckets)+1)}
+		r.commands[command] = stats
+	}
+	if err != nil {
+		stats.failed++
+	} else {
+		stats.ok++
+	}
+	stats.buckets[sort.SearchFloat64s(durationBuckets, duration.Seconds())]++
+	stats.sum += duration
+	stats.recent = append(r.expire(stats.recent, now), sample{at: now, duration: duration})
+}
+
+// expire drops the samples older than the window
+func (r *Recorder) expire(samples []sample, now time.Time) []sample {
+	cutoff := now.Add(-r.window)
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].at.After(cutoff) })
+	return samples[i:]
+}
+
+// Commands returns the names of the observed commands, sorted
+func (r *Recorder) Commands() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Count is how many times a command was handled, by outcome
+type Count struct {
+	OK     uint64
+	Failed uint64
+}
+
+// Counts returns how many times each observed command was handled since
+// the recorder was created
+func (r *Recorder) Counts() map[string]Count {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := make(map[string]Count, len(r.commands))
+	for name, stats := range r.commands {
+		counts[name] = Count{OK: stats.ok, Failed: stats.failed}
+	}
+	return counts
+}
+
+// P95 returns the 95th percentile latency of a command over the window and
+// how many observations it is based on
+func (r *Recorder) P95(command string) (time.Duration, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats, ok := r.commands[command]
+	if !ok {
+		return 0, 0
+	}
+	stats.recent = r.expire(stats.recent, r.clock.Now())
+	if len(stats.recent) == 0 {
+		return 0, 0
+	}
+
+	durations := make([]time.Duration, len(stats.recent))
+	for i, s := range stats.recent {
+		durations[i] = s.duration
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	// Nearest rank
+	rank := (95*len(durations) + 99) / 100
+	return durations[rank-1], len(durations)
+}
+
+// WritePrometheus writes every metric in the Prometheus text format
+func (r *Recorder) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{
+		"# HELP wanon_command_duration_seconds Time spent handling bot commands.",
+		"# TYPE wanon_command_duration_seconds histogram",
+	}
+	for _, name := range names {
+		stats := r.commands[name]
+		var cumulative uint64
+		for i, count := range stats.buckets {
+			cumulative += count
+			le := "+Inf"
+			if i < len(durationBuckets) {
+				le = strconv.FormatFloat(durationBuckets[i], 'g', -1, 64)
+			}
+			lines = append(lines, fmt.Sprintf("wanon_command_duration_seconds_bucket{command=%q,le=%q} %d", name, le, cumulative))
+		}
+		lines = append(lines,
+			fmt.Sprintf("wanon_command_duration_seconds_sum{command=%q} %s", name, strconv.FormatFloat(stats.sum.Seconds(), 'g', -1, 64)),
+			fmt.Sprintf("wanon_command_duration_seconds_count{command=%q} %d", name, cumulative),
+		)
+	}
+
+	lines = append(lines,
+		"# HELP wanon_commands_total Bot commands handled, by result.",
+		"# TYPE wanon_commands_total counter",
+	)
+	for _, name := range names {
+		stats := r.commands[name]
+		lines = append(lines,
+			fmt.Sprintf("wanon_commands_total{command=%q,result=\"ok\"} %d", name, stats.ok),
+			fmt.Sprintf("wanon_commands_total{command=%q,result=\"error\"} %d", name, stats.failed),
+		)
+	}
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+	for _, collector := range r.collectors {
+		if err := collector.WritePrometheus(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the metrics to Prometheus scrapes
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := r.WritePrometheus(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
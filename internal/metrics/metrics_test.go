@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder_P95(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC))
+	recorder := NewRecorder(5 * time.Minute).WithClock(clk)
+
+	p95, samples := recorder.P95("rquote")
+	assert.Zero(t, p95)
+	assert.Zero(t, samples)
+
+	for i := 1; i <= 20; i++ {
+		recorder.Observe("rquote", time.Duration(i)*10*time.Millisecond, nil)
+	}
+	p95, samples = recorder.P95("rquote")
+	assert.Equal(t, 190*time.Millisecond, p95)
+	assert.Equal(t, 20, samples)
+
+	// Old observations leave the window
+	clk.Advance(5 * time.Minute)
+	recorder.Observe("rquote", 30*time.Millisecond, nil)
+	p95, samples = recorder.P95("rquote")
+	assert.Equal(t, 30*time.Millisecond, p95)
+	assert.Equal(t, 1, samples)
+}
+
+func TestRecorder_WritePrometheus(t *testing.T) {
+	recorder := NewRecorder(0)
+	recorder.Observe("rquote", 40*time.Millisecond, nil)
+	recorder.Observe("rquote", 100*time.Millisecond, nil)
+	recorder.Observe("rquote", 20*time.Second, errors.New("timeout"))
+	recorder.Observe("addquote", 300*time.Millisecond, nil)
+
+	var out strings.Builder
+	require.NoError(t, recorder.WritePrometheus(&out))
+	text := out.String()
+
+	assert.Contains(t, text, "# TYPE wanon_command_duration_seconds histogram\n")
+	assert.Contains(t, text, `wanon_command_duration_seconds_bucket{command="rquote",le="0.05"} 1`+"\n")
+	assert.Contains(t, text, `wanon_command_duration_seconds_bucket{command="rquote",le="0.1"} 2`+"\n")
+	assert.Contains(t, text, `wanon_command_duration_seconds_bucket{command="rquote",le="10"} 2`+"\n")
+	assert.Contains(t, text, `wanon_command_duration_seconds_bucket{command="rquote",le="+Inf"} 3`+"\n")
+	assert.Contains(t, text, `wanon_command_duration_seconds_sum{command="rquote"} 20.14`+"\n")
+	assert.Contains(t, text, `wanon_command_duration_seconds_count{command="rquote"} 3`+"\n")
+	assert.Contains(t, text, `wanon_commands_total{command="rquote",result="ok"} 2`+"\n")
+	assert.Contains(t, text, `wanon_commands_total{command="rquote",result="error"} 1`+"\n")
+	assert.Contains(t, text, `wanon_commands_total{command="addquote",result="ok"} 1`+"\n")
+
+	// Commands are sorted
+	assert.Less(t, strings.Index(text, `command="addquote"`), strings.Index(text, `command="rquote"`))
+}
+
+type fakeCollector struct{}
+
+func (fakeCollector) WritePrometheus(w io.Writer) error {
+	_, err := io.WriteString(w, "wanon_updates_in_flight 2\n")
+	return err
+}
+
+func TestRecorder_Register(t *testing.T) {
+	recorder := NewRecorder(0)
+	recorder.Observe("rquote", time.Millisecond, nil)
+	recorder.Register(fakeCollector{})
+
+	var out strings.Builder
+	require.NoError(t, recorder.WritePrometheus(&out))
+	assert.True(t, strings.HasSuffix(out.String(), "wanon_updates_in_flight 2\n"))
+}
+
+func TestRecorder_ServeHTTP(t *testing.T) {
+	recorder := NewRecorder(0)
+	recorder.Observe("rquote", time.Millisecond, nil)
+
+	rec := httptest.NewRecorder()
+	recorder.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, 200, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, rec.Body.String(), "wanon_commands_total")
+}
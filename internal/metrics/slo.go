@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// minSLOSamples is how many observations a window needs before its p95 is
+// trusted; a couple of slow commands on a quiet chat are not an outage
+const minSLOSamples = 5
+
+// Alert reports a command whose latency broke its objective
+type Alert struct {
+	Command   string
+	P95       time.Duration
+	Threshold time.Duration
+	Window    time.Duration
+	Samples   int
+}
+
+// String describes the alert for owners and logs
+func (a Alert) String() string {
+	return "/" + a.Command + " is slow: p95 " + a.P95.Round(time.Millisecond).String() +
+		" over the last " + a.Window.String() + " (objective " + a.Threshold.String() + ")"
+}
+
+// Notifier delivers alerts, for example to the bot owners
+type Notifier func(ctx context.Context, alert Alert)
+
+// SLOMonitor alerts when the p95 latency of a command over the recorder
+// window goes over a threshold. Each command alerts once until it recovers.
+type SLOMonitor struct {
+	recorder  *Recorder
+	threshold time.Duration
+	notify    Notifier
+	logger    *slog.Logger
+
+	alerting map[string]bool // Commands over the threshold at the last check
+}
+
+// NewSLOMonitor creates a monitor of the commands of a recorder
+func NewSLOMonitor(recorder *Recorder, threshold time.Duration, notify Notifier, logger *slog.Logger) *SLOMonitor {
+	return &SLOMonitor{
+		recorder:  recorder,
+		threshold: threshold,
+		notify:    notify,
+		logger:    logger,
+		alerting:  make(map[string]bool),
+	}
+}
+
+// Check compares every command with the objective and notifies the new
+// breaches, which it returns
+func (m *SLOMonitor) Check(ctx context.Context) []Alert {
+	var alerts []Alert
+	for _, command := range m.recorder.Commands() {
+		p95, samples := m.recorder.P95(command)
+		breached := samples >= minSLOSamples && p95 > m.threshold
+
+		switch {
+		case breached && !m.alerting[command]:
+			alert := Alert{
+				Command:   command,
+				P95:       p95,
+				Threshold: m.threshold,
+				Window:    m.recorder.Window(),
+				Samples:   samples,
+			}
+			m.logger.Warn("command latency objective breached", "command", command, "p95", p95, "threshold", m.threshold, "samples", samples)
+			if m.notify != nil {
+				m.notify(ctx, alert)
+			}
+			alerts = append(alerts, alert)
+		case !breached && m.alerting[command]:
+			m.logger.Info("command latency back within objective", "command", command, "p95", p95)
+		}
+		m.alerting[command] = breached
+	}
+	return alerts
+}
+
+// Start checks the objective every interval until the context is done
+func (m *SLOMonitor) Start(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			m.Check(ctx)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSLOMonitor_Check(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC))
+	recorder := NewRecorder(5 * time.Minute).WithClock(clk)
+	var notified []Alert
+	monitor := NewSLOMonitor(recorder, time.Second, func(_ context.Context, alert Alert) {
+		notified = append(notified, alert)
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	// Too few observations to judge
+	for i := 0; i < minSLOSamples-1; i++ {
+		recorder.Observe("exportpdf", 3*time.Second, nil)
+	}
+	assert.Empty(t, monitor.Check(ctx))
+
+	recorder.Observe("exportpdf", 3*time.Second, nil)
+	recorder.Observe("rquote", 10*time.Millisecond, nil)
+	alerts := monitor.Check(ctx)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "exportpdf", alerts[0].Command)
+	assert.Equal(t, 3*time.Second, alerts[0].P95)
+	assert.Equal(t, "/exportpdf is slow: p95 3s over the last 5m0s (objective 1s)", alerts[0].String())
+	assert.Equal(t, alerts, notified)
+
+	// A breach alerts once
+	assert.Empty(t, monitor.Check(ctx))
+	assert.Len(t, notified, 1)
+
+	// Once the slow commands leave the window it can alert again
+	clk.Advance(6 * time.Minute)
+	assert.Empty(t, monitor.Check(ctx))
+	for i := 0; i < minSLOSamples; i++ {
+		recorder.Observe("exportpdf", 2*time.Second, nil)
+	}
+	assert.Len(t, monitor.Check(ctx), 1)
+	assert.Len(t, notified, 2)
+}
@@ -0,0 +1,197 @@
+// Package migrate applies SQL migrations in process. Migrations are files
+// named like 003_create_chat_settings.sql, in tern's format: the statements
+// that apply a migration, then "---- create above / drop below ----" and the
+// statements that undo it. The applied version is kept in a one-row table,
+// as tern does, so databases migrated by either are interchangeable.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// separator splits the up and down statements of a migration
+const separator = "---- create above / drop below ----"
+
+// DefaultVersionTable is the version table of the bot's own migrations
+const DefaultVersionTable = "schema_version"
+
+// Migration is a numbered schema change and the statements undoing it
+type Migration struct {
+	Version int
+	Name    string // File name
+	Up      string
+	Down    string // Empty when the migration cannot be undone
+}
+
+// Load reads the migrations in the root of fsys. Versions must run from 1
+// with no gaps or repeats.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, file := range files {
+		prefix, _, ok := strings.Cut(path.Base(file), "_")
+		if !ok {
+			continue
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", file, err)
+		}
+		up, down, _ := strings.Cut(string(data), separator)
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    file,
+			Up:      strings.TrimSpace(up),
+			Down:    strings.TrimSpace(down),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration %s: expected version %d", migration.Name, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrator moves a database between the versions of a set of migrations
+type Migrator struct {
+	db           *sql.DB
+	migrations   []Migration
+	versionTable string
+}
+
+// New creates a migrator recording the applied version in versionTable
+func New(db *sql.DB, migrations []Migration, versionTable string) *Migrator {
+	return &Migrator{db: db, migrations: migrations, versionTable: versionTable}
+}
+
+// Latest returns the version of the last migration
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Version returns the version applied to the database, 0 if none
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := m.ensureVersionTable(ctx, conn); err != nil {
+		return 0, err
+	}
+	return m.version(ctx, conn)
+}
+
+// Migrate applies every migration not applied yet
+func (m *Migrator) Migrate(ctx context.Context) error {
+	return m.MigrateTo(ctx, m.Latest())
+}
+
+// MigrateTo applies or undoes migrations until the database is at target.
+// Each migration runs in its own transaction with the version it leads to,
+// and an advisory lock keeps two migrators from running at once.
+func (m *Migrator) MigrateTo(ctx context.Context, target int) error {
+	if target < 0 || target > m.Latest() {
+		return fmt.Errorf("no migration version %d, latest is %d", target, m.Latest())
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", m.versionTable); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	// Unlocked even when ctx is done, before the connection goes back
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", m.versionTable)
+
+	if err := m.ensureVersionTable(ctx, conn); err != nil {
+		return err
+	}
+	current, err := m.version(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("database is at version %d, newer than the latest migration %d", current, m.Latest())
+	}
+
+	for current < target {
+		migration := m.migrations[current]
+		if err := m.apply(ctx, conn, migration.Up, migration.Version); err != nil {
+			return fmt.Errorf("migration %s: %w", migration.Name, err)
+		}
+		current++
+	}
+	for current > target {
+		migration := m.migrations[current-1]
+		if migration.Down == "" {
+			return fmt.Errorf("migration %s cannot be undone", migration.Name)
+		}
+		if err := m.apply(ctx, conn, migration.Down, migration.Version-1); err != nil {
+			return fmt.Errorf("undoing migration %s: %w", migration.Name, err)
+		}
+		current--
+	}
+	return nil
+}
+
+// apply runs the statements of a migration and records the version they
+// lead to, all or nothing
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, statements string, version int) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // No-op once committed
+
+	if statements != "" {
+		if _, err := tx.ExecContext(ctx, statements); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET version = $1", m.versionTable), version); err != nil {
+		return fmt.Errorf("failed to record version %d: %w", version, err)
+	}
+	return tx.Commit()
+}
+
+// ensureVersionTable creates the version table at version 0 if missing
+func (m *Migrator) ensureVersionTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %[1]s (version int4 NOT NULL);
+		INSERT INTO %[1]s (version) SELECT 0 WHERE NOT EXISTS (SELECT 1 FROM %[1]s)`, m.versionTable))
+	if err != nil {
+		return fmt.Errorf("failed to create version table %s: %w", m.versionTable, err)
+	}
+	return nil
+}
+
+// version reads the applied version
+func (m *Migrator) version(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+	if err := conn.QueryRowContext(ctx, fmt.Sprintf("SELECT version FROM %s", m.versionTable)).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read migration version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,42 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_add_column.sql":    {Data: []byte("ALTER TABLE t ADD COLUMN c INT;\n\n---- create above / drop below ----\n\nALTER TABLE t DROP COLUMN c;\n")},
+		"001_create_table.sql":  {Data: []byte("CREATE TABLE t (id INT);\n---- create above / drop below ----\nDROP TABLE t;")},
+		"003_data_only.sql":     {Data: []byte("UPDATE t SET id = 1;")},
+		"tern.conf":             {Data: []byte("[database]")},
+		"README_migrations.sql": {Data: []byte("-- not numbered")},
+	}
+
+	migrations, err := Load(fsys)
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "001_create_table.sql", Up: "CREATE TABLE t (id INT);", Down: "DROP TABLE t;"},
+		{Version: 2, Name: "002_add_column.sql", Up: "ALTER TABLE t ADD COLUMN c INT;", Down: "ALTER TABLE t DROP COLUMN c;"},
+		{Version: 3, Name: "003_data_only.sql", Up: "UPDATE t SET id = 1;"},
+	}, migrations)
+}
+
+func TestLoad_Gaps(t *testing.T) {
+	_, err := Load(fstest.MapFS{
+		"001_a.sql": {Data: []byte("SELECT 1;")},
+		"003_c.sql": {Data: []byte("SELECT 3;")},
+	})
+	assert.EqualError(t, err, "migration 003_c.sql: expected version 2")
+
+	_, err = Load(fstest.MapFS{
+		"001_a.sql": {Data: []byte("SELECT 1;")},
+		"001_b.sql": {Data: []byte("SELECT 1;")},
+		"002_c.sql": {Data: []byte("SELECT 2;")},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+// The migrations are tested from outside the package: testutils applies
+// them with this package, so the package's own tests cannot import it.
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/migrate"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMigrator returns a migrator of the bot's migrations on an empty
+// database
+func newMigrator(t *testing.T) (*migrate.Migrator, *sql.DB) {
+	t.Helper()
+	migrations, err := migrate.Load(os.DirFS(testutils.MigrationsDir()))
+	require.NoError(t, err)
+	db, err := testutils.NewScratchDB(t).DB.DB()
+	require.NoError(t, err)
+	return migrate.New(db, migrations, migrate.DefaultVersionTable), db
+}
+
+// schema describes the schema of the database
+func schema(t *testing.T, db *sql.DB) string {
+	t.Helper()
+	schema, err := migrate.Schema(context.Background(), db)
+	require.NoError(t, err)
+	return schema
+}
+
+// TestMigrations_Reversible applies each migration, undoes it and applies it
+// again: undoing must give back the schema before it, and applying it again
+// the same schema as the first time
+func TestMigrations_Reversible(t *testing.T) {
+	m, db := newMigrator(t)
+	ctx := context.Background()
+
+	before := schema(t, db)
+	for version := 1; version <= m.Latest(); version++ {
+		require.NoError(t, m.MigrateTo(ctx, version), "applying version %d", version)
+		after := schema(t, db)
+
+		require.NoError(t, m.MigrateTo(ctx, version-1), "undoing version %d", version)
+		assert.Equal(t, before, schema(t, db), "undoing version %d", version)
+
+		require.NoError(t, m.MigrateTo(ctx, version), "applying version %d again", version)
+		assert.Equal(t, after, schema(t, db), "applying version %d again", version)
+		before = after
+	}
+
+	// All the way down leaves nothing but the version table
+	require.NoError(t, m.MigrateTo(ctx, 0))
+	assert.Empty(t, schema(t, db))
+}
+
+// TestMigrations_Idempotent migrates twice: the second run changes nothing
+func TestMigrations_Idempotent(t *testing.T) {
+	m, db := newMigrator(t)
+	ctx := context.Background()
+
+	require.NoError(t, m.Migrate(ctx))
+	migrated := schema(t, db)
+	require.NoError(t, m.Migrate(ctx))
+	assert.Equal(t, migrated, schema(t, db))
+
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, m.Latest(), version)
+}
+
+// TestMigrations_Schema compares the migrated schema with
+// testdata/schema.golden, so changes to it show up in review. Accept them
+// with: go test ./internal/migrate -run Schema -update
+func TestMigrations_Schema(t *testing.T) {
+	m, db := newMigrator(t)
+	require.NoError(t, m.Migrate(context.Background()))
+	testutils.AssertGolden(t, "schema", schema(t, db))
+}
@@ -0,0 +1,126 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Schema describes the tables, columns, constraints, indexes, triggers and
+// functions of the public schema as sorted text, to compare schemas or
+// snapshot them. Version tables, named like DefaultVersionTable, are left
+// out.
+func Schema(ctx context.Context, db *sql.DB) (string, error) {
+	tables := make(map[string][]string)
+	var order []string
+	add := func(table, line string) {
+		if _, ok := tables[table]; !ok {
+			order = append(order, table)
+		}
+		tables[table] = append(tables[table], "  "+line)
+	}
+
+	queries := []struct {
+		sql  string
+		line func(values []string) string
+	}{
+		{
+			`SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod),
+				CASE WHEN a.attnotnull THEN ' not null' ELSE '' END,
+				COALESCE(' default ' || pg_get_expr(d.adbin, d.adrelid), '')
+			FROM pg_attribute a
+			JOIN pg_class c ON c.oid = a.attrelid
+			LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+			WHERE ` + publicTables + ` AND a.attnum > 0 AND NOT a.attisdropped
+			ORDER BY 1, 2`,
+			func(v []string) string { return "column " + v[1] + " " + v[2] + v[3] + v[4] },
+		},
+		{
+			`SELECT c.relname, con.conname, pg_get_constraintdef(con.oid)
+			FROM pg_constraint con
+			JOIN pg_class c ON c.oid = con.conrelid
+			WHERE ` + publicTables + `
+			ORDER BY 1, 2`,
+			func(v []string) string { return "constraint " + v[1] + " " + v[2] },
+		},
+		{
+			`SELECT c.relname, i.relname, CASE WHEN x.indisunique THEN ' unique' ELSE '' END
+			FROM pg_index x
+			JOIN pg_class i ON i.oid = x.indexrelid
+			JOIN pg_class c ON c.oid = x.indrelid
+			WHERE ` + publicTables + `
+			ORDER BY 1, 2`,
+			func(v []string) string { return "index " + v[1] + v[2] },
+		},
+		{
+			`SELECT c.relname, t.tgname
+			FROM pg_trigger t
+			JOIN pg_class c ON c.oid = t.tgrelid
+			WHERE ` + publicTables + ` AND NOT t.tgisinternal
+			ORDER BY 1, 2`,
+			func(v []string) string { return "trigger " + v[1] },
+		},
+	}
+
+	// Tables come in name order from the first query; every table has
+	// columns, so later queries only add to them
+	for _, query := range queries {
+		rows, err := queryStrings(ctx, db, query.sql)
+		if err != nil {
+			return "", err
+		}
+		for _, values := range rows {
+			add(values[0], query.line(values))
+		}
+	}
+
+	var sb strings.Builder
+	for _, table := range order {
+		fmt.Fprintf(&sb, "table %s\n%s\n", table, strings.Join(tables[table], "\n"))
+	}
+
+	functions, err := queryStrings(ctx, db, `
+		SELECT p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')'
+		FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = 'public'
+		ORDER BY 1`)
+	if err != nil {
+		return "", err
+	}
+	for _, values := range functions {
+		fmt.Fprintf(&sb, "function %s\n", values[0])
+	}
+	return sb.String(), nil
+}
+
+// publicTables restricts a query on pg_class c to the tables of the public
+// schema other than version tables
+const publicTables = `c.relkind = 'r' AND c.relnamespace = 'public'::regnamespace AND c.relname NOT LIKE '` + DefaultVersionTable + `%'`
+
+// queryStrings runs a query returning text columns
+func queryStrings(ctx context.Context, db *sql.DB, query string) ([][]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the schema: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var result [][]string
+	for rows.Next() {
+		values := make([]string, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to read the schema: %w", err)
+		}
+		result = append(result, values)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,69 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// SMTPSink emails notifications
+type SMTPSink struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTPSink creates a sink emailing from one address to others through
+// an SMTP server. Without a username no authentication is used.
+func NewSMTPSink(host string, port int, username, password, from string, to []string) (*SMTPSink, error) {
+	if host == "" || from == "" || len(to) == 0 {
+		return nil, fmt.Errorf("smtp sink needs a host, a from address and at least one recipient")
+	}
+	if port == 0 {
+		port = 587
+	}
+	sink := &SMTPSink{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		from: from,
+		to:   to,
+		send: smtp.SendMail,
+	}
+	if username != "" {
+		sink.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return sink, nil
+}
+
+// Send emails a notification. The SMTP client does not take a context; the
+// connection ends when the server answers or drops it.
+func (s *SMTPSink) Send(ctx context.Context, n Notification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.send(s.addr, s.auth, s.from, s.to, s.message(n)); err != nil {
+		return fmt.Errorf("failed to email notification: %w", err)
+	}
+	return nil
+}
+
+// message builds the email of a notification
+func (s *SMTPSink) message(n Notification) []byte {
+	subject := n.Subject
+	if subject == "" {
+		subject = "wanon " + string(n.Kind)
+	}
+	headers := []string{
+		"From: " + s.from,
+		"To: " + strings.Join(s.to, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(n.Text, "\n", "\r\n") + "\r\n")
+}
@@ -0,0 +1,105 @@
+// Package notifications delivers alerts and reports to the people running
+// the bot through the configured sinks: Telegram, webhooks and email.
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Kind classifies notifications so sinks can pick the ones they want
+type Kind string
+
+const (
+	// KindAlert needs attention, for example a missed latency objective
+	KindAlert Kind = "alert"
+	// KindReport is a periodic report, for example the monthly usage
+	KindReport Kind = "report"
+	// KindError is a failed component
+	KindError Kind = "error"
+)
+
+// ParseKinds parses the kinds a sink is configured for
+func ParseKinds(names []string) ([]Kind, error) {
+	kinds := make([]Kind, 0, len(names))
+	for _, name := range names {
+		switch kind := Kind(name); kind {
+		case KindAlert, KindReport, KindError:
+			kinds = append(kinds, kind)
+		default:
+			return nil, fmt.Errorf("unknown notification kind %q (want alert, report or error)", name)
+		}
+	}
+	return kinds, nil
+}
+
+// Notification is a single message to deliver
+type Notification struct {
+	Kind    Kind
+	Subject string // Short summary, used as the email subject
+	Text    string
+}
+
+// Sink delivers notifications somewhere
+type Sink interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// route is a sink and the kinds it receives
+type route struct {
+	name  string
+	sink  Sink
+	kinds map[Kind]bool // Empty receives every kind
+}
+
+// Notifier fans notifications out to its sinks
+type Notifier struct {
+	routes []route
+	logger *slog.Logger
+}
+
+// New creates a notifier without sinks
+func New(logger *slog.Logger) *Notifier {
+	return &Notifier{logger: logger}
+}
+
+// Add sends the given kinds of notifications, or every kind when none are
+// given, to a sink
+func (n *Notifier) Add(name string, sink Sink, kinds ...Kind) *Notifier {
+	r := route{name: name, sink: sink, kinds: make(map[Kind]bool, len(kinds))}
+	for _, kind := range kinds {
+		r.kinds[kind] = true
+	}
+	n.routes = append(n.routes, r)
+	return n
+}
+
+// Empty reports whether the notifier has no sinks
+func (n *Notifier) Empty() bool {
+	return len(n.routes) == 0
+}
+
+// Notify delivers a notification to every sink receiving its kind. A failed
+// sink does not stop the others; the failures are logged and returned.
+func (n *Notifier) Notify(ctx context.Context, notification Notification) error {
+	var errs []error
+	for _, r := range n.routes {
+		if len(r.kinds) > 0 && !r.kinds[notification.Kind] {
+			continue
+		}
+		if err := r.sink.Send(ctx, notification); err != nil {
+			n.logger.Error("failed to send notification", "sink", r.name, "kind", notification.Kind, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", r.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Func adapts the notifier to components delivering plain text
+func (n *Notifier) Func(kind Kind, subject string) func(ctx context.Context, text string) {
+	return func(ctx context.Context, text string) {
+		_ = n.Notify(ctx, Notification{Kind: kind, Subject: subject, Text: text})
+	}
+}
@@ -0,0 +1,111 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSink struct {
+	sent []Notification
+	err  error
+}
+
+func (f *fakeSink) Send(ctx context.Context, n Notification) error {
+	f.sent = append(f.sent, n)
+	return f.err
+}
+
+func TestNotifier_Routes(t *testing.T) {
+	all, alerts, broken := &fakeSink{}, &fakeSink{}, &fakeSink{err: errors.New("down")}
+	notifier := New(slog.New(slog.NewTextHandler(io.Discard, nil))).
+		Add("all", all).
+		Add("alerts", alerts, KindAlert).
+		Add("broken", broken, KindReport)
+
+	require.NoError(t, notifier.Notify(context.Background(), Notification{Kind: KindAlert, Text: "slow"}))
+	notifier.Func(KindReport, "Monthly usage report")(context.Background(), "📊")
+
+	assert.Len(t, all.sent, 2)
+	require.Len(t, alerts.sent, 1)
+	assert.Equal(t, "slow", alerts.sent[0].Text)
+	require.Len(t, broken.sent, 1)
+	assert.Equal(t, Notification{Kind: KindReport, Subject: "Monthly usage report", Text: "📊"}, broken.sent[0])
+
+	err := notifier.Notify(context.Background(), Notification{Kind: KindReport})
+	assert.ErrorContains(t, err, "broken: down")
+	assert.Len(t, all.sent, 3)
+}
+
+func TestParseKinds(t *testing.T) {
+	kinds, err := ParseKinds([]string{"alert", "error"})
+	require.NoError(t, err)
+	assert.Equal(t, []Kind{KindAlert, KindError}, kinds)
+
+	_, err = ParseKinds([]string{"backup"})
+	assert.Error(t, err)
+}
+
+func TestWebhookSink(t *testing.T) {
+	var bodies []map[string]string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		bodies = append(bodies, body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	n := Notification{Kind: KindError, Subject: "wanon stopped", Text: "🛑 database down"}
+
+	sink, err := NewWebhookSink(server.URL, "")
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(context.Background(), n))
+
+	slack, err := NewWebhookSink(server.URL, FormatSlack)
+	require.NoError(t, err)
+	require.NoError(t, slack.Send(context.Background(), n))
+
+	assert.Equal(t, []map[string]string{
+		{"kind": "error", "subject": "wanon stopped", "text": "🛑 database down"},
+		{"text": "🛑 database down"},
+	}, bodies)
+
+	status = http.StatusInternalServerError
+	assert.ErrorContains(t, sink.Send(context.Background(), n), "500")
+
+	_, err = NewWebhookSink(server.URL, "xml")
+	assert.Error(t, err)
+}
+
+func TestSMTPSink(t *testing.T) {
+	sink, err := NewSMTPSink("mail.example.com", 0, "", "", "bot@example.com", []string{"ana@example.com", "bob@example.com"})
+	require.NoError(t, err)
+
+	var addr string
+	var msg string
+	sink.send = func(a string, _ smtp.Auth, from string, to []string, m []byte) error {
+		addr, msg = a, string(m)
+		return nil
+	}
+	require.NoError(t, sink.Send(context.Background(), Notification{Kind: KindReport, Subject: "Monthly usage report", Text: "📊 Usage\n• 3 commands"}))
+
+	assert.Equal(t, "mail.example.com:587", addr)
+	assert.Contains(t, msg, "To: ana@example.com, bob@example.com\r\n")
+	assert.Contains(t, msg, "Subject: Monthly usage report\r\n")
+	assert.True(t, strings.HasSuffix(msg, "\r\n\r\n📊 Usage\r\n• 3 commands\r\n"))
+
+	_, err = NewSMTPSink("mail.example.com", 25, "", "", "bot@example.com", nil)
+	assert.Error(t, err)
+}
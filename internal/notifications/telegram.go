@@ -0,0 +1,33 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/graffic/wanon-go/internal/outbox"
+	"gorm.io/gorm"
+)
+
+// TelegramSink messages Telegram chats, such as the owners in private
+type TelegramSink struct {
+	outbox  *outbox.Outbox
+	sender  outbox.Sender
+	chatIDs []int64
+}
+
+// NewTelegramSink creates a sink messaging the given chats through the outbox
+func NewTelegramSink(db *gorm.DB, sender outbox.Sender, chatIDs []int64) *TelegramSink {
+	return &TelegramSink{outbox: outbox.New(db), sender: sender, chatIDs: chatIDs}
+}
+
+// Send messages every chat, carrying on after failures
+func (s *TelegramSink) Send(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, chatID := range s.chatIDs {
+		if _, err := s.outbox.Send(ctx, s.sender, &outbox.Message{ChatID: chatID, Text: n.Text}); err != nil {
+			errs = append(errs, fmt.Errorf("chat %d: %w", chatID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
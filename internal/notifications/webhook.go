@@ -0,0 +1,75 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Webhook payload formats
+const (
+	FormatJSON  = "json"  // {"kind", "subject", "text"}
+	FormatSlack = "slack" // Slack incoming webhooks: {"text"}
+)
+
+// WebhookSink posts notifications to a URL
+type WebhookSink struct {
+	url    string
+	format string
+	client *http.Client
+}
+
+// NewWebhookSink creates a sink posting to url in the given format; an
+// empty format is FormatJSON
+func NewWebhookSink(url, format string) (*WebhookSink, error) {
+	if url == "" {
+		return nil, fmt.Errorf("webhook sink needs a url")
+	}
+	switch format {
+	case "":
+		format = FormatJSON
+	case FormatJSON, FormatSlack:
+	default:
+		return nil, fmt.Errorf("unknown webhook format %q (want json or slack)", format)
+	}
+	return &WebhookSink{url: url, format: format, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// WithClient replaces the HTTP client posting the notifications
+func (s *WebhookSink) WithClient(client *http.Client) *WebhookSink {
+	s.client = client
+	return s
+}
+
+// Send posts a notification, failing on any status but 2xx
+func (s *WebhookSink) Send(ctx context.Context, n Notification) error {
+	var payload any
+	switch s.format {
+	case FormatSlack:
+		payload = map[string]string{"text": n.Text}
+	default:
+		payload = map[string]string{"kind": string(n.Kind), "subject": n.Subject, "text": n.Text}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package onboarding
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/cache"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/settings"
+	"gorm.io/gorm"
+)
+
+// ChecklistClient is the part of the Bot API the chat checklist uses;
+// *bot.Bot implements it
+type ChecklistClient interface {
+	outbox.Sender
+	GetMe(ctx context.Context) (*models.User, error)
+	GetChat(ctx context.Context, params *bot.GetChatParams) (*models.ChatFullInfo, error)
+	GetChatMember(ctx context.Context, params *bot.GetChatMemberParams) (*models.ChatMember, error)
+}
+
+// Check is the outcome of a single onboarding step
+type Check struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// Checklist is the outcome of onboarding a chat
+type Checklist struct {
+	ChatID int64
+	Title  string
+	Checks []Check
+}
+
+// Ready reports whether every step succeeded
+func (c Checklist) Ready() bool {
+	for _, check := range c.Checks {
+		if !check.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the checklist for the owners
+func (c Checklist) String() string {
+	name := fmt.Sprintf("chat %d", c.ChatID)
+	if c.Title != "" {
+		name = fmt.Sprintf("%s (%d)", c.Title, c.ChatID)
+	}
+	lines := []string{"Onboarding " + name + ":"}
+	failed := 0
+	for _, check := range c.Checks {
+		mark := "✅"
+		if !check.OK {
+			mark = "❌"
+			failed++
+		}
+		lines = append(lines, fmt.Sprintf("%s %s: %s", mark, check.Name, check.Detail))
+	}
+	if failed > 0 {
+		lines = append(lines, "", fmt.Sprintf("Not ready: %d of %d steps failed.", failed, len(c.Checks)))
+	} else {
+		lines = append(lines, "", "Ready.")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Onboarder prepares chats the bot was just allowed in
+type Onboarder struct {
+	settings *settings.Service
+	outbox   *outbox.Outbox
+	commands []Command
+	warmer   *cache.Warmer
+}
+
+// NewOnboarder creates an onboarder announcing the given commands
+func NewOnboarder(db *gorm.DB, commands []Command) *Onboarder {
+	return &Onboarder{
+		settings: settings.NewService(db),
+		outbox:   outbox.New(db),
+		commands: commands,
+	}
+}
+
+// WithWarmer fills the cache of onboarded chats from their export, when
+// the warmer is enabled
+func (o *Onboarder) WithWarmer(warmer *cache.Warmer) *Onboarder {
+	o.warmer = warmer
+	return o
+}
+
+// Run onboards a chat: it checks that the bot can work there, stores its
+// default settings and tells the chat what the bot can do. Failed steps are
+// reported in the checklist rather than returned as errors.
+func (o *Onboarder) Run(ctx context.Context, client ChecklistClient, chatID int64) Checklist {
+	list := Checklist{ChatID: chatID}
+
+	me, err := client.GetMe(ctx)
+	if err != nil {
+		list.Checks = append(list.Checks, Check{Name: "Telegram", Detail: err.Error()})
+		return list
+	}
+	chat, err := client.GetChat(ctx, &bot.GetChatParams{ChatID: chatID})
+	if err != nil {
+		list.Checks = append(list.Checks, Check{Name: "Chat", Detail: "cannot see the chat, add the bot to it first: " + err.Error()})
+		return list
+	}
+	list.Title = chat.Title
+
+	member, err := client.GetChatMember(ctx, &bot.GetChatMemberParams{ChatID: chatID, UserID: me.ID})
+	if err != nil {
+		list.Checks = append(list.Checks, Check{Name: "Membership", Detail: err.Error()})
+		return list
+	}
+	membership := checkMembership(member)
+	list.Checks = append(list.Checks, membership, checkPrivacy(me, chat, member))
+
+	list.Checks = append(list.Checks, o.createSettings(ctx, chatID))
+	if o.warmer != nil && o.warmer.Enabled() {
+		list.Checks = append(list.Checks, o.warmUp(ctx, chatID))
+	}
+
+	if membership.OK {
+		list.Checks = append(list.Checks, o.announce(ctx, client, chatID))
+	}
+	return list
+}
+
+// checkMembership checks that the bot is in the chat and can post
+func checkMembership(member *models.ChatMember) Check {
+	check := Check{Name: "Membership"}
+	switch member.Type {
+	case models.ChatMemberTypeOwner, models.ChatMemberTypeAdministrator:
+		check.OK, check.Detail = true, "administrator"
+	case models.ChatMemberTypeMember:
+		check.OK, check.Detail = true, "member"
+	case models.ChatMemberTypeRestricted:
+		restricted := member.Restricted
+		check.OK = restricted != nil && restricted.IsMember && restricted.CanSendMessages
+		check.Detail = "restricted member"
+		if !check.OK {
+			check.Detail = "restricted, the bot cannot send messages"
+		}
+	default:
+		check.Detail = "the bot is not in the chat, add it first"
+	}
+	return check
+}
+
+// checkPrivacy checks that the bot sees the messages it has to cache. With
+// privacy mode on, bots that are not administrators only get commands and
+// replies to their own messages, so most replies cannot be quoted.
+func checkPrivacy(me *models.User, chat *models.ChatFullInfo, member *models.ChatMember) Check {
+	check := Check{Name: "Privacy mode", OK: true}
+	switch {
+	case chat.Type == models.ChatTypePrivate || chat.Type == models.ChatTypeChannel:
+		check.Detail = "not a group"
+	case me.CanReadAllGroupMessages:
+		check.Detail = "off, the bot sees every message"
+	case member.Type == models.ChatMemberTypeAdministrator || member.Type == models.ChatMemberTypeOwner:
+		check.Detail = "on, but administrators see every message"
+	default:
+		check.OK = false
+		check.Detail = "on, the bot only sees commands; disable it with @BotFather (/setprivacy) or make the bot an administrator"
+	}
+	return check
+}
+
+// createSettings stores the default settings of the chat, keeping any
+// settings it already has
+func (o *Onboarder) createSettings(ctx context.Context, chatID int64) Check {
+	check := Check{Name: "Settings"}
+	cs, err := o.settings.Get(ctx, chatID)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	if !cs.CreatedAt.IsZero() {
+		check.OK, check.Detail = true, "kept the existing settings"
+		return check
+	}
+	if err := o.settings.Save(ctx, cs); err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	check.OK, check.Detail = true, "created with the defaults"
+	return check
+}
+
+// warmUp fills the cache of the chat from its export, if one was provided
+func (o *Onboarder) warmUp(ctx context.Context, chatID int64) Check {
+	check := Check{Name: "Cache warm-up"}
+	result, ok, err := o.warmer.Warm(ctx, chatID)
+	switch {
+	case err != nil:
+		check.Detail = err.Error()
+	case !ok:
+		check.OK, check.Detail = true, "no export provided, the cache starts empty"
+	default:
+		check.OK, check.Detail = true, result.String()
+	}
+	return check
+}
+
+// announce tells the chat what the bot can do
+func (o *Onboarder) announce(ctx context.Context, client ChecklistClient, chatID int64) Check {
+	check := Check{Name: "Announcement"}
+	text := "👋 Hi! Reply to a message with /addquote to save it as a quote, and /rquote brings a random one back.\n\n" + Help(o.commands)
+	if _, err := o.outbox.Send(ctx, client, &outbox.Message{ChatID: chatID, Text: text}); err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	check.OK, check.Detail = true, "sent the list of commands"
+	return check
+}
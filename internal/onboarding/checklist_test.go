@@ -0,0 +1,120 @@
+package onboarding
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/cache"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChecklistClient is a bot in one group, recording what it sends
+type fakeChecklistClient struct {
+	fakeChatClient
+	me   models.User
+	sent []string
+}
+
+func (f *fakeChecklistClient) GetMe(context.Context) (*models.User, error) {
+	return &f.me, nil
+}
+
+func (f *fakeChecklistClient) SendMessage(_ context.Context, params *bot.SendMessageParams) (*models.Message, error) {
+	f.sent = append(f.sent, params.Text)
+	return &models.Message{ID: len(f.sent)}, nil
+}
+
+func TestCheckMembership(t *testing.T) {
+	tests := []struct {
+		name   string
+		member models.ChatMember
+		ok     bool
+	}{
+		{name: "administrator", member: models.ChatMember{Type: models.ChatMemberTypeAdministrator}, ok: true},
+		{name: "member", member: models.ChatMember{Type: models.ChatMemberTypeMember}, ok: true},
+		{name: "muted", member: models.ChatMember{Type: models.ChatMemberTypeRestricted, Restricted: &models.ChatMemberRestricted{IsMember: true}}},
+		{name: "restricted", member: models.ChatMember{Type: models.ChatMemberTypeRestricted, Restricted: &models.ChatMemberRestricted{IsMember: true, CanSendMessages: true}}, ok: true},
+		{name: "left", member: models.ChatMember{Type: models.ChatMemberTypeLeft}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.ok, checkMembership(&tt.member).OK)
+		})
+	}
+}
+
+func TestCheckPrivacy(t *testing.T) {
+	group := &models.ChatFullInfo{Type: models.ChatTypeSupergroup}
+	member := &models.ChatMember{Type: models.ChatMemberTypeMember}
+	admin := &models.ChatMember{Type: models.ChatMemberTypeAdministrator}
+
+	assert.True(t, checkPrivacy(&models.User{CanReadAllGroupMessages: true}, group, member).OK)
+	assert.True(t, checkPrivacy(&models.User{}, group, admin).OK)
+	check := checkPrivacy(&models.User{}, group, member)
+	assert.False(t, check.OK)
+	assert.Contains(t, check.Detail, "/setprivacy")
+}
+
+func TestChecklist_String(t *testing.T) {
+	list := Checklist{ChatID: -100123, Title: "Friends", Checks: []Check{
+		{Name: "Membership", OK: true, Detail: "member"},
+		{Name: "Privacy mode", Detail: "on"},
+	}}
+	assert.False(t, list.Ready())
+	assert.Equal(t, "Onboarding Friends (-100123):\n✅ Membership: member\n❌ Privacy mode: on\n\nNot ready: 1 of 2 steps failed.", list.String())
+
+	list.Checks[1].OK = true
+	assert.True(t, list.Ready())
+	assert.Contains(t, list.String(), "\n\nReady.")
+}
+
+func TestOnboarder_Run(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	client := &fakeChecklistClient{
+		fakeChatClient: fakeChatClient{
+			members: map[int64]models.ChatMemberType{-100123: models.ChatMemberTypeAdministrator},
+			titles:  map[int64]string{-100123: "Friends"},
+		},
+		me: models.User{ID: 7, IsBot: true},
+	}
+	onboarder := NewOnboarder(db.DB, []Command{fakeCommand{"/rquote", "Get a random quote"}})
+
+	list := onboarder.Run(context.Background(), client, -100123)
+	assert.True(t, list.Ready(), list.String())
+	assert.Equal(t, "Friends", list.Title)
+	require.Len(t, client.sent, 1)
+	assert.Contains(t, client.sent[0], "/rquote - Get a random quote")
+
+	var settingsRows int64
+	require.NoError(t, db.DB.Table("chat_settings").Where("chat_id = ?", -100123).Count(&settingsRows).Error)
+	assert.Equal(t, int64(1), settingsRows)
+
+	// Chats the bot is not in fail without announcing anything
+	list = onboarder.Run(context.Background(), client, -100999)
+	assert.False(t, list.Ready())
+	assert.Len(t, client.sent, 1)
+}
+
+func TestOnboarder_RunWarmUp(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	client := &fakeChecklistClient{
+		fakeChatClient: fakeChatClient{
+			members: map[int64]models.ChatMemberType{-100123: models.ChatMemberTypeAdministrator},
+			titles:  map[int64]string{-100123: "Friends"},
+		},
+		me: models.User{ID: 7, IsBot: true},
+	}
+	warmer := cache.NewWarmer(cache.NewService(db.DB), t.TempDir(), 48*time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	onboarder := NewOnboarder(db.DB, nil).WithWarmer(warmer)
+
+	list := onboarder.Run(context.Background(), client, -100123)
+	assert.True(t, list.Ready(), list.String())
+	assert.Contains(t, list.String(), "✅ Cache warm-up: no export provided")
+}
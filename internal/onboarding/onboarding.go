@@ -0,0 +1,230 @@
+// Package onboarding welcomes users who talk to the bot in private and
+// prepares the chats the bot is newly allowed in.
+package onboarding
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"gorm.io/gorm"
+)
+
+// maxCheckedChats bounds how many known chats are checked for membership
+// on each /start, as every check is a Bot API call
+const maxCheckedChats = 50
+
+// helpPayload is the /start payload of the help deep link
+const helpPayload = "help"
+
+// Command describes a bot command; the command handlers implement it. It is
+// the same set of commands shown in Telegram's command menu.
+type Command = botcmd.MenuCommand
+
+// ChatClient is the part of the Bot API used to find the chats a user
+// shares with the bot
+type ChatClient interface {
+	GetChat(ctx context.Context, params *bot.GetChatParams) (*models.ChatFullInfo, error)
+	GetChatMember(ctx context.Context, params *bot.GetChatMemberParams) (*models.ChatMember, error)
+}
+
+// Options configures the onboarding
+type Options struct {
+	BotUsername    string  // Without @, used for the help deep link
+	WebURL         string  // Quote web UI, empty hides its button
+	AllowedChatIDs []int64 // Chats the bot serves besides those with quotes
+}
+
+// SharedChat is a group both the user and the bot are in
+type SharedChat struct {
+	ID    int64
+	Title string
+}
+
+// DeepLinkFunc answers a /start deep link in a private chat. payload is
+// the /start payload without the prefix the function was registered with.
+type DeepLinkFunc func(ctx context.Context, b *bot.Bot, msg *models.Message, payload string) error
+
+// Handler handles /start in private chats
+type Handler struct {
+	db        *gorm.DB
+	outbox    *outbox.Outbox
+	commands  []Command
+	opts      Options
+	deepLinks map[string]DeepLinkFunc // By payload prefix
+}
+
+// NewHandler creates a new start handler listing the given commands
+func NewHandler(db *gorm.DB, commands []Command, opts Options) *Handler {
+	return &Handler{
+		db:        db,
+		outbox:    outbox.New(db),
+		commands:  commands,
+		opts:      opts,
+		deepLinks: make(map[string]DeepLinkFunc),
+	}
+}
+
+// WithDeepLink answers the /start payloads starting with prefix with open,
+// for other commands that send users to a private chat with the bot
+func (h *Handler) WithDeepLink(prefix string, open DeepLinkFunc) *Handler {
+	h.deepLinks[prefix] = open
+	return h
+}
+
+// Handle processes the /start command. Groups are ignored; in private
+// chats it replies with a welcome, with the command list for the help deep
+// link, or with what the other deep links registered answer.
+func (h *Handler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil || msg.Chat.Type != models.ChatTypePrivate {
+		return nil
+	}
+	slog.Info("executing /start command", "user_id", msg.From.ID)
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	if args.Arg(0) == helpPayload {
+		_, err := h.outbox.Send(ctx, b, &outbox.Message{
+			ChatID:   msg.Chat.ID,
+			Text:     Help(h.commands),
+			Keyboard: Keyboard(Options{WebURL: h.opts.WebURL}),
+		})
+		return err
+	}
+	for prefix, open := range h.deepLinks {
+		if payload, ok := strings.CutPrefix(args.Arg(0), prefix); ok {
+			return open(ctx, b, msg, payload)
+		}
+	}
+
+	chatIDs, err := h.knownChats(ctx)
+	if err != nil {
+		return err
+	}
+	shared := FindSharedChats(ctx, b, chatIDs, msg.From.ID)
+
+	_, err = h.outbox.Send(ctx, b, &outbox.Message{
+		ChatID:   msg.Chat.ID,
+		Text:     Welcome(msg.From, shared),
+		Keyboard: Keyboard(h.opts),
+	})
+	return err
+}
+
+// knownChats returns the groups the bot serves: the allowed chats and
+// those with quotes or settings
+func (h *Handler) knownChats(ctx context.Context) ([]int64, error) {
+	var stored []int64
+	err := h.db.WithContext(ctx).Raw(`
+		SELECT chat_id FROM quote WHERE chat_id < 0
+		UNION SELECT chat_id FROM chat_settings WHERE chat_id < 0
+		ORDER BY chat_id LIMIT ?`, maxCheckedChats).
+		Scan(&stored).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list known chats: %w", err)
+	}
+
+	seen := make(map[int64]bool)
+	var chatIDs []int64
+	for _, id := range append(append([]int64{}, h.opts.AllowedChatIDs...), stored...) {
+		if !seen[id] && len(chatIDs) < maxCheckedChats {
+			seen[id] = true
+			chatIDs = append(chatIDs, id)
+		}
+	}
+	return chatIDs, nil
+}
+
+// FindSharedChats returns the chats among chatIDs the user is a member of.
+// Chats that cannot be resolved, e.g. because the bot left them, are skipped.
+func FindSharedChats(ctx context.Context, client ChatClient, chatIDs []int64, userID int64) []SharedChat {
+	var shared []SharedChat
+	for _, chatID := range chatIDs {
+		member, err := client.GetChatMember(ctx, &bot.GetChatMemberParams{ChatID: chatID, UserID: userID})
+		if err != nil || !isMember(member) {
+			continue
+		}
+		chat, err := client.GetChat(ctx, &bot.GetChatParams{ChatID: chatID})
+		if err != nil {
+			slog.Debug("failed to resolve shared chat", "chat_id", chatID, "error", err)
+			continue
+		}
+		shared = append(shared, SharedChat{ID: chatID, Title: chat.Title})
+	}
+	return shared
+}
+
+// isMember reports whether a chat member is currently in the chat
+func isMember(member *models.ChatMember) bool {
+	switch member.Type {
+	case models.ChatMemberTypeOwner, models.ChatMemberTypeAdministrator, models.ChatMemberTypeMember:
+		return true
+	case models.ChatMemberTypeRestricted:
+		return member.Restricted != nil && member.Restricted.IsMember
+	}
+	return false
+}
+
+// Welcome renders the /start message
+func Welcome(user *models.User, shared []SharedChat) string {
+	lines := []string{
+		fmt.Sprintf("Hi %s! I keep the best lines of your group chats.", user.FirstName),
+		"",
+		"How it works:",
+		"• Add me to a group",
+		"• Reply to a memorable message with /addquote",
+		"• Send /rquote for a random quote",
+		"",
+	}
+	if len(shared) == 0 {
+		lines = append(lines, "We are not in any group together yet.")
+	} else {
+		lines = append(lines, "Groups we share:")
+		for _, chat := range shared {
+			lines = append(lines, "• "+chat.Title)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Help renders the list of commands
+func Help(commands []Command) string {
+	lines := []string{"Commands:"}
+	for _, command := range commands {
+		lines = append(lines, fmt.Sprintf("%s - %s", command.Command(), command.Description()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Keyboard builds the link buttons of the onboarding messages, or nil when
+// there are none
+func Keyboard(opts Options) *models.InlineKeyboardMarkup {
+	var row []models.InlineKeyboardButton
+	if opts.BotUsername != "" {
+		link := fmt.Sprintf("https://t.me/%s?start=%s", url.PathEscape(opts.BotUsername), helpPayload)
+		row = append(row, models.InlineKeyboardButton{Text: "Help", URL: link})
+	}
+	if opts.WebURL != "" {
+		row = append(row, models.InlineKeyboardButton{Text: "Open quotes", URL: opts.WebURL})
+	}
+	if len(row) == 0 {
+		return nil
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+}
+
+// Command returns the command name
+func (h *Handler) Command() string {
+	return "/start"
+}
+
+// Description returns the command description
+func (h *Handler) Description() string {
+	return "Introduce the bot (private chats)"
+}
@@ -0,0 +1,118 @@
+package onboarding
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeChatClient answers membership and chat lookups from maps
+type fakeChatClient struct {
+	members map[int64]models.ChatMemberType
+	titles  map[int64]string
+}
+
+func (f *fakeChatClient) GetChatMember(_ context.Context, params *bot.GetChatMemberParams) (*models.ChatMember, error) {
+	memberType, ok := f.members[params.ChatID.(int64)]
+	if !ok {
+		return nil, errors.New("chat not found")
+	}
+	return &models.ChatMember{Type: memberType}, nil
+}
+
+func (f *fakeChatClient) GetChat(_ context.Context, params *bot.GetChatParams) (*models.ChatFullInfo, error) {
+	title, ok := f.titles[params.ChatID.(int64)]
+	if !ok {
+		return nil, errors.New("chat not found")
+	}
+	return &models.ChatFullInfo{ID: params.ChatID.(int64), Title: title}, nil
+}
+
+type fakeCommand struct{ name, description string }
+
+func (c fakeCommand) Command() string     { return c.name }
+func (c fakeCommand) Description() string { return c.description }
+
+func TestFindSharedChats(t *testing.T) {
+	client := &fakeChatClient{
+		members: map[int64]models.ChatMemberType{
+			-1: models.ChatMemberTypeMember,
+			-2: models.ChatMemberTypeLeft,
+			-3: models.ChatMemberTypeAdministrator,
+			-4: models.ChatMemberTypeMember, // Title cannot be resolved
+		},
+		titles: map[int64]string{-1: "Friends", -2: "Old group", -3: "Work"},
+	}
+
+	shared := FindSharedChats(context.Background(), client, []int64{-1, -2, -3, -4, -5}, 42)
+	assert.Equal(t, []SharedChat{{ID: -1, Title: "Friends"}, {ID: -3, Title: "Work"}}, shared)
+}
+
+func TestIsMember(t *testing.T) {
+	assert.True(t, isMember(&models.ChatMember{Type: models.ChatMemberTypeOwner}))
+	assert.False(t, isMember(&models.ChatMember{Type: models.ChatMemberTypeBanned}))
+	assert.True(t, isMember(&models.ChatMember{Type: models.ChatMemberTypeRestricted, Restricted: &models.ChatMemberRestricted{IsMember: true}}))
+	assert.False(t, isMember(&models.ChatMember{Type: models.ChatMemberTypeRestricted, Restricted: &models.ChatMemberRestricted{}}))
+}
+
+func TestWelcome(t *testing.T) {
+	user := &models.User{ID: 42, FirstName: "Ana"}
+
+	text := Welcome(user, nil)
+	assert.Contains(t, text, "Hi Ana!")
+	assert.Contains(t, text, "/addquote")
+	assert.Contains(t, text, "not in any group together yet")
+
+	text = Welcome(user, []SharedChat{{ID: -1, Title: "Friends"}})
+	assert.Contains(t, text, "Groups we share:\n• Friends")
+}
+
+func TestHelp(t *testing.T) {
+	text := Help([]Command{
+		fakeCommand{"/addquote", "Add a quote"},
+		fakeCommand{"/rquote", "Get a random quote"},
+	})
+	assert.Equal(t, "Commands:\n/addquote - Add a quote\n/rquote - Get a random quote", text)
+}
+
+func TestKeyboard(t *testing.T) {
+	assert.Nil(t, Keyboard(Options{}))
+
+	keyboard := Keyboard(Options{BotUsername: "wanonbot", WebURL: "https://quotes.example.com"})
+	require.NotNil(t, keyboard)
+	require.Len(t, keyboard.InlineKeyboard, 1)
+	row := keyboard.InlineKeyboard[0]
+	require.Len(t, row, 2)
+	assert.Equal(t, "https://t.me/wanonbot?start=help", row[0].URL)
+	assert.Equal(t, "https://quotes.example.com", row[1].URL)
+}
+
+func TestHandler_KnownChats(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	require.NoError(t, db.DB.Exec(`INSERT INTO quote (creator, chat_id) VALUES ('{}', -100), ('{}', -100), ('{}', 7)`).Error)
+	require.NoError(t, db.DB.Exec(`INSERT INTO chat_settings (chat_id) VALUES (-200)`).Error)
+
+	handler := NewHandler(db.DB, nil, Options{AllowedChatIDs: []int64{-300, -100}})
+	chatIDs, err := handler.knownChats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []int64{-300, -100, -200}, chatIDs)
+}
+
+func TestHandler_DeepLink(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	var opened string
+	h.Register(NewHandler(h.DB.DB, nil, Options{}).WithDeepLink("fq_", func(_ context.Context, _ *bot.Bot, _ *models.Message, payload string) error {
+		opened = payload
+		return nil
+	}))
+
+	require.NoError(t, h.Send(&models.Message{ID: 1, From: h.User, Chat: models.Chat{ID: h.User.ID, Type: models.ChatTypePrivate}, Text: "/start fq_abc"}))
+	assert.Equal(t, "abc", opened)
+	assert.Empty(t, h.Requests("sendMessage"))
+}
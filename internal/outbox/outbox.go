@@ -0,0 +1,209 @@
+// Package outbox records the messages the bot sends before sending them,
+// so that messages lost to a crash are retried on startup and every sent
+// message can be traced back to what it was about, such as a quote.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/storage"
+	"gorm.io/gorm"
+)
+
+// Defaults for retrying unsent messages
+const (
+	DefaultMaxAttempts = 5
+	DefaultMaxAge      = time.Hour
+)
+
+// Message is an outgoing text message
+type Message struct {
+	ID               uint                         `gorm:"primaryKey" json:"id"`
+	ChatID           int64                        `gorm:"not null" json:"chat_id"`
+	Text             string                       `gorm:"not null" json:"text"`
+	ParseMode        models.ParseMode             `gorm:"not null;default:''" json:"parse_mode"` // Plain text if empty
+	ReplyToMessageID int                          `gorm:"not null;default:0" json:"reply_to_message_id"`
+	Keyboard         *models.InlineKeyboardMarkup `gorm:"column:reply_markup;serializer:json" json:"reply_markup"`
+	QuoteID          *uint                        `json:"quote_id"`                             // Quote the message posts, if any
+	MessageID        int                          `gorm:"not null;default:0" json:"message_id"` // Telegram message ID once sent
+	Attempts         int                          `gorm:"not null;default:0" json:"attempts"`
+	LastError        string                       `gorm:"not null;default:''" json:"last_error"`
+	SentAt           *time.Time                   `json:"sent_at"`
+	// Transient messages, such as usage errors and confirmations, are
+	// deleted after the chat's autodelete delay; RemovedAt records when
+	Transient bool       `gorm:"not null;default:false" json:"transient"`
+	RemovedAt *time.Time `json:"removed_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for Message
+func (Message) TableName() string {
+	return "outbox_message"
+}
+
+// Sender sends Telegram messages; *bot.Bot implements it
+type Sender interface {
+	SendMessage(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error)
+}
+
+// Outbox stores outgoing messages and delivers them
+type Outbox struct {
+	db          *gorm.DB
+	clock       clock.Clock
+	maxAttempts int
+	maxAge      time.Duration
+}
+
+// New creates a new outbox
+func New(db *gorm.DB) *Outbox {
+	return &Outbox{
+		db:          db,
+		clock:       clock.System{},
+		maxAttempts: DefaultMaxAttempts,
+		maxAge:      DefaultMaxAge,
+	}
+}
+
+// WithClock replaces the clock used to timestamp deliveries and to decide
+// which unsent messages are too old to retry
+func (o *Outbox) WithClock(clk clock.Clock) *Outbox {
+	o.clock = clk
+	return o
+}
+
+// Send records msg and sends it. If sending fails the message stays in the
+// outbox and is retried by RetryPending.
+func (o *Outbox) Send(ctx context.Context, sender Sender, msg *Message) (*models.Message, error) {
+	if err := o.db.WithContext(ctx).Create(msg).Error; err != nil {
+		return nil, fmt.Errorf("failed to record outgoing message: %w", err)
+	}
+	return o.deliver(ctx, sender, msg)
+}
+
+// SendAfterCommit records msg in a unit of work and sends it once the unit
+// is committed, so the message only goes out along with the unit's other
+// writes. Failed sends stay in the outbox and are retried by RetryPending.
+func (o *Outbox) SendAfterCommit(ctx context.Context, u *storage.Unit, sender Sender, msg *Message) error {
+	if err := u.DB().WithContext(ctx).Create(msg).Error; err != nil {
+		return fmt.Errorf("failed to record outgoing message: %w", err)
+	}
+	u.AfterCommit(func(ctx context.Context) error {
+		_, err := o.deliver(ctx, sender, msg)
+		return err
+	})
+	return nil
+}
+
+// deliver sends a recorded message and stores the outcome
+func (o *Outbox) deliver(ctx context.Context, sender Sender, msg *Message) (*models.Message, error) {
+	params := &bot.SendMessageParams{
+		ChatID:    msg.ChatID,
+		Text:      msg.Text,
+		ParseMode: msg.ParseMode,
+	}
+	if msg.ReplyToMessageID != 0 {
+		params.ReplyParameters = &models.ReplyParameters{MessageID: msg.ReplyToMessageID}
+	}
+	if msg.Keyboard != nil {
+		params.ReplyMarkup = msg.Keyboard
+	}
+
+	sent, sendErr := sender.SendMessage(ctx, params)
+
+	updates := map[string]interface{}{"attempts": gorm.Expr("attempts + 1")}
+	if sendErr != nil {
+		updates["last_error"] = sendErr.Error()
+	} else {
+		now := o.clock.Now()
+		updates["sent_at"] = now
+		updates["message_id"] = sent.ID
+		updates["last_error"] = ""
+		msg.SentAt = &now
+		msg.MessageID = sent.ID
+	}
+	msg.Attempts++
+
+	// The message is out even if recording that fails, so report the send
+	if err := o.db.WithContext(ctx).Model(msg).Updates(updates).Error; err != nil {
+		slog.Error("failed to update outbox message", "id", msg.ID, "error", err)
+	}
+	if sendErr != nil {
+		return nil, fmt.Errorf("failed to send message: %w", sendErr)
+	}
+	return sent, nil
+}
+
+// RetryPending sends the unsent messages left behind by failed sends or a
+// crash, oldest first. Messages older than the max age or attempted too
+// many times are left alone. It returns how many messages were sent.
+func (o *Outbox) RetryPending(ctx context.Context, sender Sender) (int, error) {
+	var pending []Message
+	if err := o.db.WithContext(ctx).
+		Where("sent_at IS NULL AND attempts < ? AND created_at >= ?", o.maxAttempts, o.clock.Now().Add(-o.maxAge)).
+		Order("id ASC").
+		Find(&pending).Error; err != nil {
+		return 0, fmt.Errorf("failed to list pending messages: %w", err)
+	}
+
+	sent := 0
+	for i := range pending {
+		if _, err := o.deliver(ctx, sender, &pending[i]); err != nil {
+			slog.Warn("failed to resend outbox message", "id", pending[i].ID, "chat_id", pending[i].ChatID, "error", err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// Pending returns how many messages are still unsent and when the oldest
+// of them was recorded; the time is zero if there are none
+func (o *Outbox) Pending(ctx context.Context) (int64, time.Time, error) {
+	var row struct {
+		Count  int64
+		Oldest *time.Time
+	}
+	if err := o.db.WithContext(ctx).Model(&Message{}).
+		Select("COUNT(*) AS count, MIN(created_at) AS oldest").
+		Where("sent_at IS NULL").
+		Scan(&row).Error; err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to count pending messages: %w", err)
+	}
+	if row.Oldest == nil {
+		return row.Count, time.Time{}, nil
+	}
+	return row.Count, *row.Oldest, nil
+}
+
+// Sent returns the outbox message sent as a Telegram message, or nil if
+// the bot did not send it through the outbox
+func (o *Outbox) Sent(ctx context.Context, chatID int64, messageID int) (*Message, error) {
+	var msg Message
+	err := o.db.WithContext(ctx).
+		Where("chat_id = ? AND message_id = ? AND sent_at IS NOT NULL", chatID, messageID).
+		First(&msg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sent message: %w", err)
+	}
+	return &msg, nil
+}
+
+// QuoteFor returns the quote a sent message posted, or nil if the message
+// was not a quote or was not sent by the bot
+func (o *Outbox) QuoteFor(ctx context.Context, chatID int64, messageID int) (*uint, error) {
+	msg, err := o.Sent(ctx, chatID, messageID)
+	if err != nil || msg == nil {
+		return nil, err
+	}
+	return msg.QuoteID, nil
+}
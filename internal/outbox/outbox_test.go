@@ -0,0 +1,153 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/storage"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSender records sent messages and fails while err is set
+type fakeSender struct {
+	err    error
+	nextID int
+	sent   []*bot.SendMessageParams
+}
+
+func (f *fakeSender) SendMessage(_ context.Context, params *bot.SendMessageParams) (*models.Message, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.nextID++
+	f.sent = append(f.sent, params)
+	return &models.Message{ID: f.nextID}, nil
+}
+
+func TestOutbox_Send(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	clk := clock.NewMock(time.Now())
+	out := New(db.DB).WithClock(clk)
+	ctx := context.Background()
+	sender := &fakeSender{nextID: 100}
+
+	keyboard := &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{{Text: "OK", CallbackData: "ok"}}}}
+	sent, err := out.Send(ctx, sender, &Message{ChatID: -100123, Text: "hello", Keyboard: keyboard})
+	require.NoError(t, err)
+	assert.Equal(t, 101, sent.ID)
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, keyboard, sender.sent[0].ReplyMarkup)
+
+	var stored Message
+	require.NoError(t, db.DB.First(&stored).Error)
+	assert.Equal(t, 101, stored.MessageID)
+	assert.Equal(t, 1, stored.Attempts)
+	assert.NotNil(t, stored.SentAt)
+	assert.Equal(t, keyboard, stored.Keyboard)
+}
+
+func TestOutbox_SendAfterCommit(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	out := New(db.DB)
+	ctx := context.Background()
+	sender := &fakeSender{}
+
+	// Rolled back units neither record nor send their messages
+	failed := errors.New("later step failed")
+	err := storage.Atomic(ctx, db.DB, func(u *storage.Unit) error {
+		require.NoError(t, out.SendAfterCommit(ctx, u, sender, &Message{ChatID: -100123, Text: "lost"}))
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	assert.Empty(t, sender.sent)
+
+	err = storage.Atomic(ctx, db.DB, func(u *storage.Unit) error {
+		require.NoError(t, out.SendAfterCommit(ctx, u, sender, &Message{ChatID: -100123, Text: "hello"}))
+		assert.Empty(t, sender.sent, "sent only after the commit")
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, "hello", sender.sent[0].Text)
+
+	var stored []Message
+	require.NoError(t, db.DB.Find(&stored).Error)
+	require.Len(t, stored, 1)
+	assert.Equal(t, "hello", stored[0].Text)
+	assert.NotNil(t, stored[0].SentAt)
+}
+
+func TestOutbox_RetryPending(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	clk := clock.NewMock(time.Now())
+	out := New(db.DB).WithClock(clk)
+	ctx := context.Background()
+	sender := &fakeSender{err: errors.New("network down")}
+
+	_, err := out.Send(ctx, sender, &Message{ChatID: -100123, Text: "first"})
+	require.Error(t, err)
+	_, err = out.Send(ctx, sender, &Message{ChatID: -100123, Text: "second"})
+	require.Error(t, err)
+
+	var failed Message
+	require.NoError(t, db.DB.First(&failed).Error)
+	assert.Equal(t, "network down", failed.LastError)
+	assert.Nil(t, failed.SentAt)
+
+	sender.err = nil
+	resent, err := out.RetryPending(ctx, sender)
+	require.NoError(t, err)
+	assert.Equal(t, 2, resent)
+	require.Len(t, sender.sent, 2)
+	assert.Equal(t, "first", sender.sent[0].Text)
+	assert.Equal(t, "second", sender.sent[1].Text)
+
+	// Sent messages are not sent again
+	resent, err = out.RetryPending(ctx, sender)
+	require.NoError(t, err)
+	assert.Zero(t, resent)
+}
+
+func TestOutbox_RetryPendingSkipsOldMessages(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	clk := clock.NewMock(time.Now())
+	out := New(db.DB).WithClock(clk)
+	ctx := context.Background()
+
+	_, err := out.Send(ctx, &fakeSender{err: errors.New("down")}, &Message{ChatID: -100123, Text: "stale"})
+	require.Error(t, err)
+
+	clk.Advance(DefaultMaxAge + time.Minute)
+	sender := &fakeSender{}
+	resent, err := out.RetryPending(ctx, sender)
+	require.NoError(t, err)
+	assert.Zero(t, resent)
+	assert.Empty(t, sender.sent)
+}
+
+func TestOutbox_QuoteFor(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	out := New(db.DB)
+	ctx := context.Background()
+
+	require.NoError(t, db.DB.Exec(`INSERT INTO quote (id, creator, chat_id) VALUES (7, '{}', -100123)`).Error)
+	quoteID := uint(7)
+	sent, err := out.Send(ctx, &fakeSender{nextID: 40}, &Message{ChatID: -100123, Text: "#7", QuoteID: &quoteID})
+	require.NoError(t, err)
+
+	found, err := out.QuoteFor(ctx, -100123, sent.ID)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, uint(7), *found)
+
+	found, err = out.QuoteFor(ctx, -100123, 999)
+	require.NoError(t, err)
+	assert.Nil(t, found)
+}
@@ -0,0 +1,184 @@
+// Package plugin lets forks add commands to the bot without changing
+// cmd/wanon. A plugin registers itself from an init function, and a file
+// of its own in cmd/wanon imports it:
+//
+//	import _ "example.com/wanon-karma"
+//
+// Each plugin gets the config section plugins.<name> and may bring tern
+// migrations, applied at startup after the bot's own and tracked in a
+// version table of its own.
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/knadh/koanf/v2"
+	"gorm.io/gorm"
+)
+
+// Plugin is a set of commands added to the bot
+type Plugin interface {
+	// Name identifies the plugin in its config section, its migration
+	// version table and the logs: lower case letters, digits and
+	// underscores
+	Name() string
+	// Commands returns the commands of the plugin, in the order the command
+	// menu shows them
+	Commands() []botcmd.MenuCommand
+	// Handle processes a message starting with one of the commands
+	Handle(ctx context.Context, b *bot.Bot, update *models.Update) error
+	// Migrations returns the tern migrations of the plugin, or nil for none
+	Migrations() fs.FS
+}
+
+// Configurable is a plugin set up before the bot starts, with its config
+// section and the database
+type Configurable interface {
+	Configure(env Env) error
+}
+
+// Env is what a plugin is configured with
+type Env struct {
+	DB      *gorm.DB
+	Section Section
+	Logger  *slog.Logger // Tagged with the plugin name
+}
+
+// Section is the config section of a plugin, plugins.<name>. Keys are
+// lower case, as the config loader leaves them.
+type Section map[string]interface{}
+
+// Decode fills target, a pointer to a struct with koanf tags, from the
+// section. Durations are read from strings such as "5m".
+func (s Section) Decode(target interface{}) error {
+	k := koanf.New(".")
+	if err := k.Load(sectionProvider(s), nil); err != nil {
+		return err
+	}
+	return k.UnmarshalWithConf("", target, koanf.UnmarshalConf{Tag: "koanf"})
+}
+
+// sectionProvider loads a section into koanf
+type sectionProvider Section
+
+func (p sectionProvider) ReadBytes() ([]byte, error) {
+	return nil, errors.New("plugin sections are read as maps")
+}
+
+func (p sectionProvider) Read() (map[string]interface{}, error) {
+	return p, nil
+}
+
+// validName matches plugin names, which go into table names
+var validName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Registry holds the plugins compiled into the bot
+type Registry struct {
+	mu      sync.Mutex
+	plugins map[string]Plugin
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{plugins: make(map[string]Plugin)}
+}
+
+// Register adds a plugin. Names must be valid and unique.
+func (r *Registry) Register(p Plugin) error {
+	name := p.Name()
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid plugin name %q: use lower case letters, digits and underscores", name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.plugins[name]; ok {
+		return fmt.Errorf("plugin %q registered twice", name)
+	}
+	r.plugins[name] = p
+	return nil
+}
+
+// Plugins returns the registered plugins sorted by name
+func (r *Registry) Plugins() []Plugin {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	plugins := make([]Plugin, 0, len(r.plugins))
+	for _, p := range r.plugins {
+		plugins = append(plugins, p)
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name() < plugins[j].Name() })
+	return plugins
+}
+
+// registry holds the plugins registered from init functions
+var registry = NewRegistry()
+
+// Register adds a plugin to the bot. It is meant to be called from an init
+// function and panics on invalid or duplicate names, like database/sql
+// drivers.
+func Register(p Plugin) {
+	if err := registry.Register(p); err != nil {
+		panic(err)
+	}
+}
+
+// Registered returns the plugins added with Register, sorted by name
+func Registered() []Plugin {
+	return registry.Plugins()
+}
+
+// Handler is a command of a plugin, handled like the bot's own commands
+type Handler struct {
+	botcmd.MenuCommand
+	plugin Plugin
+}
+
+// Handle passes the command to its plugin
+func (h *Handler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	return h.plugin.Handle(ctx, b, update)
+}
+
+// Plugin returns the name of the plugin of the command
+func (h *Handler) Plugin() string {
+	return h.plugin.Name()
+}
+
+// Load configures the plugins with their sections of sections and returns
+// their commands in order. Commands already taken, given without the
+// slash, or claimed by two plugins are an error.
+func Load(plugins []Plugin, db *gorm.DB, sections map[string]map[string]interface{}, logger *slog.Logger, taken []string) ([]*Handler, error) {
+	owners := make(map[string]string, len(taken))
+	for _, name := range taken {
+		owners[name] = "the bot"
+	}
+
+	var handlers []*Handler
+	for _, p := range plugins {
+		if configurable, ok := p.(Configurable); ok {
+			env := Env{DB: db, Section: sections[p.Name()], Logger: logger.With("plugin", p.Name())}
+			if err := configurable.Configure(env); err != nil {
+				return nil, fmt.Errorf("failed to configure plugin %s: %w", p.Name(), err)
+			}
+		}
+		for _, command := range p.Commands() {
+			name := strings.TrimPrefix(command.Command(), "/")
+			if owner, ok := owners[name]; ok {
+				return nil, fmt.Errorf("plugin %s: command /%s is already taken by %s", p.Name(), name, owner)
+			}
+			owners[name] = "plugin " + p.Name()
+			handlers = append(handlers, &Handler{MenuCommand: command, plugin: p})
+		}
+	}
+	return handlers, nil
+}
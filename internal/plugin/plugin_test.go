@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCommand struct{ name string }
+
+func (c testCommand) Command() string     { return "/" + c.name }
+func (c testCommand) Description() string { return "Test " + c.name }
+
+type testPlugin struct {
+	name     string
+	commands []string
+	handled  int
+	env      *Env
+	err      error
+}
+
+func (p *testPlugin) Name() string { return p.name }
+
+func (p *testPlugin) Commands() []botcmd.MenuCommand {
+	var commands []botcmd.MenuCommand
+	for _, name := range p.commands {
+		commands = append(commands, testCommand{name})
+	}
+	return commands
+}
+
+func (p *testPlugin) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	p.handled++
+	return nil
+}
+
+func (p *testPlugin) Migrations() fs.FS { return nil }
+
+// configurablePlugin records the environment it is configured with
+type configurablePlugin struct{ testPlugin }
+
+func (p *configurablePlugin) Configure(env Env) error {
+	p.env = &env
+	return p.err
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.Register(&testPlugin{name: "karma"}))
+	require.NoError(t, r.Register(&testPlugin{name: "dice_2"}))
+
+	assert.ErrorContains(t, r.Register(&testPlugin{name: "karma"}), "registered twice")
+	for _, name := range []string{"", "Karma", "2dice", "dice-roll", "karma; drop"} {
+		assert.ErrorContains(t, r.Register(&testPlugin{name: name}), "invalid plugin name", name)
+	}
+
+	plugins := r.Plugins()
+	require.Len(t, plugins, 2)
+	assert.Equal(t, "dice_2", plugins[0].Name())
+	assert.Equal(t, "karma", plugins[1].Name())
+}
+
+func TestSection_Decode(t *testing.T) {
+	var target struct {
+		Points   int           `koanf:"points"`
+		Cooldown time.Duration `koanf:"cooldown"`
+		Emoji    []string      `koanf:"emoji"`
+	}
+	section := Section{"points": 3, "cooldown": "5m", "emoji": []interface{}{"👍", "👎"}}
+	require.NoError(t, section.Decode(&target))
+	assert.Equal(t, 3, target.Points)
+	assert.Equal(t, 5*time.Minute, target.Cooldown)
+	assert.Equal(t, []string{"👍", "👎"}, target.Emoji)
+
+	// A missing section leaves the defaults
+	target.Points = 7
+	require.NoError(t, Section(nil).Decode(&target))
+	assert.Equal(t, 7, target.Points)
+}
+
+func TestLoad(t *testing.T) {
+	karma := &configurablePlugin{testPlugin{name: "karma", commands: []string{"karma", "topkarma"}}}
+	dice := &testPlugin{name: "dice", commands: []string{"roll"}}
+	sections := map[string]map[string]interface{}{"karma": {"points": 3}}
+
+	handlers, err := Load([]Plugin{dice, karma}, nil, sections, slog.Default(), []string{"rquote"})
+	require.NoError(t, err)
+	require.Len(t, handlers, 3)
+	assert.Equal(t, "/roll", handlers[0].Command())
+	assert.Equal(t, "dice", handlers[0].Plugin())
+	assert.Equal(t, "/topkarma", handlers[2].Command())
+	assert.Equal(t, "Test topkarma", handlers[2].Description())
+
+	require.NotNil(t, karma.env)
+	assert.Equal(t, Section{"points": 3}, karma.env.Section)
+
+	require.NoError(t, handlers[1].Handle(context.Background(), nil, &models.Update{}))
+	assert.Equal(t, 1, karma.handled)
+	assert.Zero(t, dice.handled)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	_, err := Load([]Plugin{&testPlugin{name: "quotes", commands: []string{"rquote"}}}, nil, nil, slog.Default(), []string{"rquote"})
+	assert.ErrorContains(t, err, "plugin quotes: command /rquote is already taken by the bot")
+
+	a := &testPlugin{name: "a", commands: []string{"roll"}}
+	b := &testPlugin{name: "b", commands: []string{"roll"}}
+	_, err = Load([]Plugin{a, b}, nil, nil, slog.Default(), nil)
+	assert.ErrorContains(t, err, "plugin b: command /roll is already taken by plugin a")
+
+	broken := &configurablePlugin{testPlugin{name: "broken", err: errors.New("missing api_key")}}
+	_, err = Load([]Plugin{broken}, nil, nil, slog.Default(), nil)
+	assert.ErrorContains(t, err, "failed to configure plugin broken: missing api_key")
+}
@@ -0,0 +1,305 @@
+// Package publish generates a static HTML archive of the quotes of a chat,
+// suitable for hosting on GitHub Pages or any static file server.
+package publish
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/telegram"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+//go:embed static
+var staticFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// batchSize is the number of quotes loaded from the database at a time
+const batchSize = 200
+
+// Options configures the generated site
+type Options struct {
+	Title    string
+	Location *time.Location  // Time zone used for years and dates, UTC if nil
+	Layout   string          // Date layout, quotes.DefaultDateLayout if empty
+	Authors  *quotes.Authors // Chat nicknames shown instead of Telegram names
+	Avatars  AvatarSource    // Profile photos shown next to authors, none if nil
+}
+
+// AvatarSource returns the local path of the profile photo of a user, or
+// telegram.ErrNoAvatar. *telegram.Avatars implements it.
+type AvatarSource interface {
+	Avatar(ctx context.Context, userID int64) (string, error)
+}
+
+// avatarDir is the directory of the site holding the profile photos
+const avatarDir = "avatars"
+
+// Site is a static site being generated. Quotes must be added in
+// chronological order; each year is written to its own page as soon as the
+// next year starts, so only one year is held in memory.
+type Site struct {
+	dir      string
+	opts     Options
+	renderer *quotes.Renderer
+	years    []yearSummary
+	current  *yearPage
+	search   []searchDoc
+	avatars  map[int64]string // Site path of the photo of each user, "" if none
+}
+
+// yearSummary is an entry of the index page
+type yearSummary struct {
+	Year   int
+	Page   string
+	Quotes int
+}
+
+// yearPage holds the quotes of the year being generated
+type yearPage struct {
+	Title  string
+	Year   int
+	Quotes []pageQuote
+}
+
+// pageQuote is a quote as shown on a year page
+type pageQuote struct {
+	ID      uint
+	Anchor  string
+	Date    string
+	Entries []pageEntry
+}
+
+// pageEntry is a message of a quote as shown on a year page
+type pageEntry struct {
+	quotes.RenderedEntry
+	Avatar string // Site path of the author's profile photo, if any
+}
+
+// searchDoc is an entry of the client-side search index
+type searchDoc struct {
+	ID   uint   `json:"id"`
+	Page string `json:"page"`
+	Date string `json:"date"`
+	Text string `json:"text"`
+}
+
+// New creates a site that will be written to dir
+func New(dir string, opts Options) (*Site, error) {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if opts.Layout == "" {
+		opts.Layout = quotes.DefaultDateLayout
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	return &Site{
+		dir:      dir,
+		opts:     opts,
+		renderer: quotes.NewRenderer(),
+		search:   []searchDoc{},
+		avatars:  make(map[int64]string),
+	}, nil
+}
+
+// AddQuote adds a quote to the page of its year
+func (s *Site) AddQuote(ctx context.Context, quote *quotes.Quote) error {
+	entries, err := s.renderer.Entries(quote, s.opts.Authors)
+	if err != nil {
+		return fmt.Errorf("failed to render quote %d: %w", quote.ID, err)
+	}
+
+	created := quote.CreatedAt.In(s.opts.Location)
+	if s.current == nil || s.current.Year != created.Year() {
+		if err := s.flushYear(); err != nil {
+			return err
+		}
+		s.current = &yearPage{Title: s.opts.Title, Year: created.Year()}
+	}
+
+	page := yearPageName(created.Year())
+	anchor := "q" + strconv.FormatUint(uint64(quote.ID), 10)
+	date := created.Format(s.opts.Layout)
+
+	pageEntries := make([]pageEntry, len(entries))
+	for i, entry := range entries {
+		pageEntries[i] = pageEntry{RenderedEntry: entry, Avatar: s.avatar(ctx, entry.UserID)}
+	}
+	s.current.Quotes = append(s.current.Quotes, pageQuote{
+		ID:      quote.ID,
+		Anchor:  anchor,
+		Date:    date,
+		Entries: pageEntries,
+	})
+
+	var text []string
+	for _, entry := range entries {
+		text = append(text, entry.Author+": "+entry.Text)
+	}
+	s.search = append(s.search, searchDoc{
+		ID:   quote.ID,
+		Page: page + "#" + anchor,
+		Date: date,
+		Text: strings.Join(text, "\n"),
+	})
+	return nil
+}
+
+// avatar copies the profile photo of a user into the site, once, and
+// returns its path. Users without a visible photo, and photos that fail to
+// download, are shown without one rather than failing the site.
+func (s *Site) avatar(ctx context.Context, userID int64) string {
+	if s.opts.Avatars == nil || userID == 0 {
+		return ""
+	}
+	if path, ok := s.avatars[userID]; ok {
+		return path
+	}
+	s.avatars[userID] = ""
+
+	src, err := s.opts.Avatars.Avatar(ctx, userID)
+	if err != nil {
+		if !errors.Is(err, telegram.ErrNoAvatar) {
+			slog.Warn("failed to fetch profile photo", "user_id", userID, "error", err)
+		}
+		return ""
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		slog.Warn("failed to read profile photo", "user_id", userID, "error", err)
+		return ""
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir, avatarDir), 0o755); err != nil {
+		slog.Warn("failed to create the avatars directory", "error", err)
+		return ""
+	}
+	path := avatarDir + "/" + strconv.FormatInt(userID, 10) + filepath.Ext(src)
+	if err := os.WriteFile(filepath.Join(s.dir, filepath.FromSlash(path)), data, 0o644); err != nil {
+		slog.Warn("failed to write profile photo", "user_id", userID, "error", err)
+		return ""
+	}
+	s.avatars[userID] = path
+	return path
+}
+
+// Quotes returns the number of quotes added to the site
+func (s *Site) Quotes() int {
+	return len(s.search)
+}
+
+// Close writes the remaining pages, the search index and the static assets
+func (s *Site) Close() error {
+	if err := s.flushYear(); err != nil {
+		return err
+	}
+
+	// Newest years first on the index
+	years := make([]yearSummary, len(s.years))
+	for i, year := range s.years {
+		years[len(years)-1-i] = year
+	}
+
+	err := s.writePage("index.html", "index.html", struct {
+		Title  string
+		Quotes int
+		Years  []yearSummary
+	}{s.opts.Title, s.Quotes(), years})
+	if err != nil {
+		return err
+	}
+
+	if err := s.writeSearchIndex(); err != nil {
+		return err
+	}
+	return s.copyStatic()
+}
+
+// flushYear writes the page of the year being generated
+func (s *Site) flushYear() error {
+	if s.current == nil {
+		return nil
+	}
+	page := yearPageName(s.current.Year)
+	if err := s.writePage(page, "year.html", s.current); err != nil {
+		return err
+	}
+	s.years = append(s.years, yearSummary{Year: s.current.Year, Page: page, Quotes: len(s.current.Quotes)})
+	s.current = nil
+	return nil
+}
+
+// writePage renders a template into a file of the site
+func (s *Site) writePage(name, tmpl string, data any) error {
+	f, err := os.Create(filepath.Join(s.dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	if err := templates.ExecuteTemplate(f, tmpl, data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return f.Close()
+}
+
+// writeSearchIndex writes the JSON index used by the search page
+func (s *Site) writeSearchIndex() error {
+	data, err := json.Marshal(s.search)
+	if err != nil {
+		return fmt.Errorf("failed to encode search index: %w", err)
+	}
+	return os.WriteFile(filepath.Join(s.dir, "search.json"), data, 0o644)
+}
+
+// copyStatic copies the embedded stylesheet and scripts
+func (s *Site) copyStatic() error {
+	return fs.WalkDir(staticFS, "static", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := staticFS.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(s.dir, d.Name()), data, 0o644)
+	})
+}
+
+// yearPageName returns the file name of the page of a year
+func yearPageName(year int) string {
+	return strconv.Itoa(year) + ".html"
+}
+
+// Publish generates the site of a chat into dir
+func Publish(ctx context.Context, store *quotes.Store, chatID int64, dir string, opts Options) (*Site, error) {
+	site, err := New(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = store.EachForChat(ctx, chatID, batchSize, func(quote *quotes.Quote) error {
+		return site.AddQuote(ctx, quote)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := site.Close(); err != nil {
+		return nil, err
+	}
+	return site, nil
+}
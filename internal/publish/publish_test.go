@@ -0,0 +1,145 @@
+package publish
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// quoteAt builds a quote with a single entry created at the given time
+func quoteAt(id uint, created time.Time, text string) *quotes.Quote {
+	message := fmt.Sprintf(`{"text":%q,"date":%d,"from":{"id":1,"first_name":"Ana"}}`, text, created.Unix())
+	return &quotes.Quote{
+		ID:        id,
+		ChatID:    -100123,
+		CreatedAt: created,
+		Entries:   []quotes.QuoteEntry{{Message: datatypes.JSON(message)}},
+	}
+}
+
+// readFile reads a generated file of the site
+func readFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestSite_GeneratesPagesPerYear(t *testing.T) {
+	dir := t.TempDir()
+	site, err := New(dir, Options{Title: "Our chat"})
+	require.NoError(t, err)
+
+	require.NoError(t, site.AddQuote(context.Background(), quoteAt(1, time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC), "first")))
+	require.NoError(t, site.AddQuote(context.Background(), quoteAt(2, time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC), "second")))
+	require.NoError(t, site.AddQuote(context.Background(), quoteAt(3, time.Date(2021, 1, 5, 10, 0, 0, 0, time.UTC), "third")))
+	require.NoError(t, site.Close())
+
+	assert.Equal(t, 3, site.Quotes())
+	for _, name := range []string{"index.html", "2019.html", "2021.html", "search.json", "style.css", "search.js"} {
+		assert.FileExists(t, filepath.Join(dir, name))
+	}
+
+	index := readFile(t, dir, "index.html")
+	assert.Contains(t, index, "<h1>Our chat</h1>")
+	assert.Contains(t, index, `<a href="2019.html">2019</a> <span class="count">2 quotes</span>`)
+	// Newest year first
+	assert.Less(t, strings.Index(index, "2021.html"), strings.Index(index, "2019.html"))
+
+	year := readFile(t, dir, "2019.html")
+	assert.Contains(t, year, `<article class="quote" id="q1">`)
+	assert.Contains(t, year, "<strong>Ana:</strong> second")
+	assert.NotContains(t, year, "third")
+}
+
+func TestSite_EscapesHTML(t *testing.T) {
+	dir := t.TempDir()
+	site, err := New(dir, Options{Title: "<Chat>"})
+	require.NoError(t, err)
+
+	require.NoError(t, site.AddQuote(context.Background(), quoteAt(1, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), "<script>alert(1)</script>")))
+	require.NoError(t, site.Close())
+
+	year := readFile(t, dir, "2020.html")
+	assert.NotContains(t, year, "<script>alert(1)</script>")
+	assert.Contains(t, year, "&lt;script&gt;")
+	assert.Contains(t, readFile(t, dir, "index.html"), "&lt;Chat&gt;")
+}
+
+func TestSite_SearchIndex(t *testing.T) {
+	dir := t.TempDir()
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+	site, err := New(dir, Options{Title: "Chat", Location: madrid, Layout: "02/01/2006"})
+	require.NoError(t, err)
+
+	// Still 2019 in UTC, already 2020 in Madrid
+	require.NoError(t, site.AddQuote(context.Background(), quoteAt(7, time.Date(2019, 12, 31, 23, 30, 0, 0, time.UTC), "happy new year")))
+	require.NoError(t, site.Close())
+
+	var docs []searchDoc
+	require.NoError(t, json.Unmarshal([]byte(readFile(t, dir, "search.json")), &docs))
+	assert.Equal(t, []searchDoc{{
+		ID:   7,
+		Page: "2020.html#q7",
+		Date: "01/01/2020",
+		Text: "Ana: happy new year",
+	}}, docs)
+}
+
+// fakeAvatars serves profile photos from a directory, by user ID
+type fakeAvatars struct {
+	paths map[int64]string
+	calls int
+}
+
+func (a *fakeAvatars) Avatar(ctx context.Context, userID int64) (string, error) {
+	a.calls++
+	if path, ok := a.paths[userID]; ok {
+		return path, nil
+	}
+	return "", telegram.ErrNoAvatar
+}
+
+func TestSite_Avatars(t *testing.T) {
+	photo := filepath.Join(t.TempDir(), "ana.jpg")
+	require.NoError(t, os.WriteFile(photo, []byte("jpeg"), 0o644))
+	avatars := &fakeAvatars{paths: map[int64]string{1: photo}}
+
+	dir := t.TempDir()
+	site, err := New(dir, Options{Title: "Chat", Avatars: avatars})
+	require.NoError(t, err)
+	require.NoError(t, site.AddQuote(context.Background(), quoteAt(1, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), "hi")))
+	require.NoError(t, site.AddQuote(context.Background(), quoteAt(2, time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), "again")))
+	hidden := quoteAt(3, time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), "no photo")
+	hidden.Entries[0].Message = datatypes.JSON(`{"text":"no photo","from":{"id":2,"first_name":"Bea"}}`)
+	require.NoError(t, site.AddQuote(context.Background(), hidden))
+	require.NoError(t, site.Close())
+
+	assert.Equal(t, "jpeg", readFile(t, dir, "avatars/1.jpg"))
+	assert.Equal(t, 2, avatars.calls, "each user is looked up once")
+	year := readFile(t, dir, "2020.html")
+	assert.Contains(t, year, `<img class="avatar" src="avatars/1.jpg" alt="" width="24" height="24"> <strong>Ana:</strong> hi`)
+	assert.Contains(t, year, "<p><strong>Bea:</strong> no photo</p>")
+}
+
+func TestSite_Empty(t *testing.T) {
+	dir := t.TempDir()
+	site, err := New(dir, Options{Title: "Chat"})
+	require.NoError(t, err)
+	require.NoError(t, site.Close())
+
+	assert.Contains(t, readFile(t, dir, "index.html"), "0 quotes")
+	assert.Equal(t, "[]", readFile(t, dir, "search.json"))
+}
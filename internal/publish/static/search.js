@@ -0,0 +1,53 @@
+// Client-side search over search.json, loaded on first use.
+(function () {
+  var input = document.getElementById("search-input");
+  var results = document.getElementById("search-results");
+  var index = null;
+
+  function load() {
+    if (index) {
+      return Promise.resolve(index);
+    }
+    return fetch("search.json")
+      .then(function (response) { return response.json(); })
+      .then(function (docs) {
+        index = docs.map(function (doc) {
+          doc.haystack = doc.text.toLowerCase();
+          return doc;
+        });
+        return index;
+      });
+  }
+
+  function render(matches) {
+    results.textContent = "";
+    matches.slice(0, 50).forEach(function (doc) {
+      var item = document.createElement("li");
+      var link = document.createElement("a");
+      link.href = doc.page;
+      link.textContent = "#" + doc.id + " · " + doc.date;
+      var text = document.createElement("p");
+      text.textContent = doc.text;
+      item.appendChild(link);
+      item.appendChild(text);
+      results.appendChild(item);
+    });
+  }
+
+  document.getElementById("search").addEventListener("submit", function (event) {
+    event.preventDefault();
+  });
+
+  input.addEventListener("input", function () {
+    var terms = input.value.toLowerCase().split(/\s+/).filter(Boolean);
+    if (terms.length === 0) {
+      results.textContent = "";
+      return;
+    }
+    load().then(function (docs) {
+      render(docs.filter(function (doc) {
+        return terms.every(function (term) { return doc.haystack.indexOf(term) !== -1; });
+      }));
+    });
+  });
+})();
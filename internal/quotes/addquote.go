@@ -2,30 +2,160 @@ package quotes
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/cache"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/kv"
+	"github.com/graffic/wanon-go/internal/message"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/redact"
+	"github.com/graffic/wanon-go/internal/settings"
+	"github.com/graffic/wanon-go/internal/storage"
+	"github.com/graffic/wanon-go/internal/telegram"
 	"gorm.io/gorm"
 )
 
 // AddQuoteHandler handles the /addquote command
 // This ports the Quotes.AddQuote functionality from Elixir
 type AddQuoteHandler struct {
-	db      *gorm.DB
-	builder *Builder
-	store   *Store
+	db        *gorm.DB
+	builder   *Builder
+	store     *Store
+	settings  *settings.Service
+	blocklist *Blocklist
+	contests  *Contests
+	outbox    *outbox.Outbox
+	redactor  *redact.Redactor
+	pending   kv.Store // Quotes of likely junk waiting for confirmation
+
+	guard               *editGuard // Who can add answers to a posted quote
+	junkGuard           JunkGuard
+	skipAnonymousAdmins bool
+	skipOwnMessages     bool
+	appendReplies       bool
+	quota               func(ctx context.Context, chatID int64) error
 }
 
 // NewAddQuoteHandler creates a new addquote handler
 func NewAddQuoteHandler(db *gorm.DB) *AddQuoteHandler {
+	store := NewStore(db)
 	return &AddQuoteHandler{
-		db:      db,
-		builder: NewBuilder(db),
-		store:   NewStore(db),
+		db:        db,
+		builder:   NewBuilder(db),
+		store:     store,
+		settings:  settings.NewService(db),
+		blocklist: NewBlocklist(db),
+		contests:  NewContests(db),
+		outbox:    outbox.New(db),
+		pending:   kv.NewMemory(),
+		guard:     &editGuard{store: store, clock: clock.System{}, window: DefaultEditWindow},
+		junkGuard: JunkConfirm,
+	}
+}
+
+// WithSkipAnonymousAdmins leaves messages of anonymous admins out of new
+// quotes
+func (h *AddQuoteHandler) WithSkipAnonymousAdmins(skip bool) *AddQuoteHandler {
+	h.skipAnonymousAdmins = skip
+	return h
+}
+
+// WithSkipOwnMessages leaves the bot's own messages out of the threads of
+// new quotes. The message quoted is kept, for the junk guard to decide on.
+func (h *AddQuoteHandler) WithSkipOwnMessages(skip bool) *AddQuoteHandler {
+	h.skipOwnMessages = skip
+	return h
+}
+
+// WithAppendReplies adds the answers to a quote the bot posted to that quote,
+// instead of quoting them on their own
+func (h *AddQuoteHandler) WithAppendReplies(appendReplies bool) *AddQuoteHandler {
+	h.appendReplies = appendReplies
+	return h
+}
+
+// WithAdmins checks admins against a shared cache of chat administrators
+func (h *AddQuoteHandler) WithAdmins(admins *telegram.AdminService) *AddQuoteHandler {
+	h.guard.admins = admins
+	return h
+}
+
+// WithEditWindow sets how long creators can add answers to their quotes;
+// zero is forever
+func (h *AddQuoteHandler) WithEditWindow(window time.Duration) *AddQuoteHandler {
+	h.guard.window = window
+	return h
+}
+
+// WithClock replaces the clock timing the edit window
+func (h *AddQuoteHandler) WithClock(clk clock.Clock) *AddQuoteHandler {
+	h.guard.clock = clk
+	return h
+}
+
+// WithMaxDepth sets the most messages of a reply chain followed into a
+// quote
+func (h *AddQuoteHandler) WithMaxDepth(depth int) *AddQuoteHandler {
+	h.builder.WithMaxDepth(depth)
+	return h
+}
+
+// WithBuildStats counts the quotes built in stats, shared with the metrics
+// and /cachestats
+func (h *AddQuoteHandler) WithBuildStats(stats *BuildStats) *AddQuoteHandler {
+	h.builder.WithStats(stats)
+	return h
+}
+
+// WithRedactor masks sensitive data in messages quoted straight from the
+// reply, when they are not cached
+func (h *AddQuoteHandler) WithRedactor(redactor *redact.Redactor) *AddQuoteHandler {
+	h.redactor = redactor
+	return h
+}
+
+// WithQuota checks new quotes against a quota, such as the quotes of a
+// hosting plan. Its error explains the refusal to the chat.
+func (h *AddQuoteHandler) WithQuota(quota func(ctx context.Context, chatID int64) error) *AddQuoteHandler {
+	h.quota = quota
+	return h
+}
+
+// WithEvents publishes the quotes added and appended to
+func (h *AddQuoteHandler) WithEvents(publisher events.Publisher) *AddQuoteHandler {
+	h.store.WithEvents(publisher)
+	return h
+}
+
+// WithCreatorPolicy limits what is stored about the user adding a quote
+func (h *AddQuoteHandler) WithCreatorPolicy(policy CreatorPolicy) *AddQuoteHandler {
+	h.store.WithCreatorPolicy(policy)
+	return h
+}
+
+// WithJunkGuard sets what happens to targets usually quoted by mistake:
+// commands, the bot's own messages and empty messages
+func (h *AddQuoteHandler) WithJunkGuard(guard JunkGuard) *AddQuoteHandler {
+	h.junkGuard = guard
+	return h
+}
+
+// WithStore keeps the quotes waiting for confirmation in a store shared by
+// every replica, so any of them takes the button press
+func (h *AddQuoteHandler) WithStore(store kv.Store) *AddQuoteHandler {
+	if store != nil {
+		h.pending = store
 	}
+	return h
 }
 
 // Handle processes the /addquote command
@@ -35,57 +165,248 @@ func (h *AddQuoteHandler) Handle(ctx context.Context, b *bot.Bot, update *models
 	if msg == nil {
 		return nil
 	}
+	slog.Info("executing /addquote command", "chat_id", msg.Chat.ID, "user_id", msg.From.ID)
+	return h.add(ctx, b, msg, false)
+}
 
+// add quotes the message msg replies to. Unless confirmed, likely junk is
+// refused or confirmed first as the junk guard says.
+func (h *AddQuoteHandler) add(ctx context.Context, b *bot.Bot, msg *models.Message, confirmed bool) error {
 	chatID := msg.Chat.ID
-	slog.Info("executing /addquote command", "chat_id", chatID, "user_id", msg.From.ID)
 
 	// Check if message is a reply
 	if msg.ReplyToMessage == nil {
-		_, err := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: chatID,
-			Text:   "Please reply to a message to add it as a quote.",
-		})
+		return sendNotice(ctx, h.outbox, b, chatID, "Please reply to a message to add it as a quote.")
+	}
+	// /addquote N also quotes the N cached messages before the replied one
+	args, _ := botcmd.ParseArgs(msg.Text)
+	before := 0
+	if args.Len() > 0 {
+		n, err := strconv.Atoi(args.Arg(0))
+		if err != nil || n < 1 || args.Len() != 1 {
+			return sendNotice(ctx, h.outbox, b, chatID, "Usage: reply to a message with /addquote, or with /addquote <n> to quote it and the n messages before it.")
+		}
+		before = n
+	}
+
+	blocked, err := h.blocklist.IsBlocked(ctx, chatID, msg.From)
+	if err != nil {
 		return err
 	}
+	if blocked {
+		slog.Info("blocked quoter tried to add a quote", "audit", true, "chat_id", chatID, "user_id", msg.From.ID)
+		return sendNotice(ctx, h.outbox, b, chatID, "You are not allowed to add quotes in this chat.")
+	}
+
+	chatSettings, err := h.settings.Get(ctx, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to get chat settings: %w", err)
+	}
+	linked, err := h.settings.ClusterChats(ctx, chatSettings)
+	if err != nil {
+		return err
+	}
+	opts := BuildOptions{
+		SkipBots:            chatSettings.BotMessages == settings.BotsSkip,
+		SkipAnonymousAdmins: h.skipAnonymousAdmins,
+		SkipOwn:             h.skipOwnMessages,
+		LinkedChats:         linked,
+	}
 
 	// Build the quote from cache
 	replyMsg := msg.ReplyToMessage
-	result, err := h.builder.BuildFrom(ctx, chatID, int64(replyMsg.ID))
+	if h.appendReplies && before == 0 {
+		posted, err := h.outbox.QuoteFor(ctx, chatID, replyMsg.ID)
+		if err != nil {
+			return err
+		}
+		if posted != nil {
+			return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("That is quote #%d already. Reply to an answer to it to add the answers to the quote.", *posted))
+		}
+	}
+	if reason := junkReason(b, replyMsg); reason != "" && !confirmed {
+		switch h.junkGuard {
+		case JunkRefuse:
+			return sendNotice(ctx, h.outbox, b, chatID, reason+", so it was not quoted.")
+		case JunkConfirm:
+			return h.confirmJunk(ctx, b, msg, reason)
+		}
+	}
+	var result *BuildResult
+	if before > 0 {
+		result, err = h.builder.BuildRangeWithOptions(ctx, chatID, int64(replyMsg.ID), before, opts)
+	} else {
+		result, err = h.builder.BuildFromWithOptions(ctx, chatID, int64(replyMsg.ID), opts)
+	}
+	if errors.Is(err, ErrOnlyBotMessages) {
+		return h.replyOnlyBots(ctx, b, chatID)
+	}
+	if errors.Is(err, ErrOnlyAnonymousAdmins) {
+		return h.replyOnlyAnonymousAdmins(ctx, b, chatID)
+	}
+	if err != nil && before > 0 {
+		// The messages before an uncached one cannot be told apart
+		return sendNotice(ctx, h.outbox, b, chatID, "Could not build quote. The message may be too old or not in cache.")
+	}
 	if err != nil {
 		// If not in cache, try to use the reply message directly
 		// This handles the case where the message is recent but cache missed
-		result, err = h.buildFromReplyMessage(replyMsg)
+		result, err = h.buildFromReplyMessage(ctx, replyMsg)
+		if err == nil && opts.SkipBots && IsBotEntry(result.Entries[0]) {
+			return h.replyOnlyBots(ctx, b, chatID)
+		}
+		if err == nil && opts.SkipAnonymousAdmins && IsAnonymousAdminEntry(result.Entries[0]) {
+			return h.replyOnlyAnonymousAdmins(ctx, b, chatID)
+		}
+		if err != nil {
+			return sendNotice(ctx, h.outbox, b, chatID, "Could not build quote. The message may be too old or not in cache.")
+		}
+		h.builder.stats.fallback()
+	}
+
+	var refused string // Why the answers were not added to the quote they answer
+	if h.appendReplies && before == 0 {
+		target, err := h.answeredQuote(ctx, chatID, result)
 		if err != nil {
-			_, err := b.SendMessage(ctx, &bot.SendMessageParams{
-				ChatID: chatID,
-				Text:   "Could not build quote. The message may be too old or not in cache.",
-			})
 			return err
 		}
+		if target != nil {
+			refused, err = h.canAppend(ctx, b, msg, *target)
+			if err != nil {
+				return err
+			}
+			if refused == "" {
+				return h.append(ctx, b, msg, *target, result)
+			}
+			refused = fmt.Sprintf(" It was not added to quote #%d. %s", *target, refused)
+		}
+	}
+
+	if h.quota != nil {
+		if err := h.quota(ctx, chatID); err != nil {
+			slog.Info("quote refused by quota", "chat_id", chatID, "user_id", msg.From.ID, "reason", err)
+			return sendNotice(ctx, h.outbox, b, chatID, err.Error())
+		}
 	}
 
 	// Store the quote
 	creator := extractUser(msg.From)
 
-	quote, err := h.store.StoreFromBuild(ctx, creator, result)
+	// The quote and its confirmation are committed together, so a failure
+	// recording the reply does not leave an unannounced quote behind. New
+	// quotes enter the chat's running contest, if any, and their
+	// confirmation stays with the vote button.
+	return storage.Atomic(ctx, h.db, func(u *storage.Unit) error {
+		quote, err := h.store.In(u).StoreFromBuild(ctx, creator, result)
+		if err != nil {
+			return fmt.Errorf("failed to store quote: %w", err)
+		}
+		contest, err := h.contests.In(u).Enter(ctx, chatID, quote.ID, msg.From.ID)
+		if err != nil {
+			return err
+		}
+		confirmation := &outbox.Message{ChatID: chatID, Text: fmt.Sprintf("Quote #%d added with %d entries!", quote.ID, len(quote.Entries)), Transient: true}
+		if contest != nil {
+			confirmation = &outbox.Message{
+				ChatID:   chatID,
+				Text:     fmt.Sprintf("Quote #%d added with %d entries and entered in the quote contest! Vote for it below.", quote.ID, len(quote.Entries)),
+				Keyboard: contestKeyboard(contest.ID, quote.ID, 0),
+			}
+		}
+		switch {
+		case result.Partial():
+			confirmation.Text += " The thread was too long, so only its latest messages were quoted."
+		case before > 0 && result.End == cache.ChainMissing:
+			confirmation.Text += " Fewer messages were cached before it than asked for."
+		}
+		confirmation.Text += refused
+		return h.outbox.SendAfterCommit(ctx, u, b, confirmation)
+	})
+}
+
+// answeredQuote returns the quote a built thread answers: the quote the bot
+// posted in its first entry, which is taken out of the thread, or in the
+// message that entry replies to. It returns nil for threads that do not
+// answer a posted quote.
+func (h *AddQuoteHandler) answeredQuote(ctx context.Context, chatID int64, result *BuildResult) (*uint, error) {
+	first := result.Entries[0]
+	if first.ChatID != chatID {
+		return nil, nil
+	}
+	// With the bot's own messages kept the thread starts with the quote
+	// posted, which is not added to itself
+	if first.Outgoing {
+		posted, err := h.outbox.QuoteFor(ctx, chatID, int(first.MessageID))
+		if err != nil || posted == nil {
+			return nil, err
+		}
+		result.Entries = result.Entries[1:]
+		return posted, nil
+	}
+	if first.ReplyID == nil || *first.ReplyID == 0 {
+		return nil, nil
+	}
+	return h.outbox.QuoteFor(ctx, chatID, int(*first.ReplyID))
+}
+
+// canAppend checks that the sender of msg can add answers to a posted
+// quote, as the edit guard says. It returns why not; answers to a quote
+// that is gone can go anywhere.
+func (h *AddQuoteHandler) canAppend(ctx context.Context, b *bot.Bot, msg *models.Message, quoteID uint) (string, error) {
+	quote, err := h.store.GetByID(ctx, quoteID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to store quote: %w", err)
+		return "", err
 	}
+	_, refused, err := h.guard.allow(ctx, b, msg, quote, "add to")
+	return refused, err
+}
 
-	// Send confirmation
-	confirmation := fmt.Sprintf("Quote #%d added with %d entries!", quote.ID, len(quote.Entries))
-	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: chatID,
-		Text:   confirmation,
+// append adds a thread answering a posted quote to that quote. If the quote
+// is gone the thread is stored as a new quote.
+func (h *AddQuoteHandler) append(ctx context.Context, b *bot.Bot, msg *models.Message, quoteID uint, result *BuildResult) error {
+	chatID := msg.Chat.ID
+	return storage.Atomic(ctx, h.db, func(u *storage.Unit) error {
+		store := h.store.In(u)
+		quote, err := store.Append(ctx, chatID, quoteID, result.Entries)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			quote, err = store.StoreFromBuild(ctx, extractUser(msg.From), result)
+			if err != nil {
+				return fmt.Errorf("failed to store quote: %w", err)
+			}
+			confirmation := fmt.Sprintf("Quote #%d added with %d entries!", quote.ID, len(quote.Entries))
+			return h.outbox.SendAfterCommit(ctx, u, b, &outbox.Message{ChatID: chatID, Text: confirmation, Transient: true})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to append to quote: %w", err)
+		}
+		slog.Info("answers appended to quote", "audit", true, "chat_id", chatID, "user_id", msg.From.ID, "quote_id", quoteID, "entries", len(result.Entries))
+		confirmation := fmt.Sprintf("Added %d entries to quote #%d, it has %d now!", len(result.Entries), quote.ID, len(quote.Entries))
+		return h.outbox.SendAfterCommit(ctx, u, b, &outbox.Message{ChatID: chatID, Text: confirmation, Transient: true})
 	})
-	return err
+}
+
+// replyOnlyBots explains that nothing was quoted because of the bot policy
+func (h *AddQuoteHandler) replyOnlyBots(ctx context.Context, b *bot.Bot, chatID int64) error {
+	return sendNotice(ctx, h.outbox, b, chatID, "Nothing to quote: messages from bots are skipped in this chat (see /settings bots).")
+}
+
+// replyOnlyAnonymousAdmins explains that nothing was quoted because messages
+// of anonymous admins are skipped
+func (h *AddQuoteHandler) replyOnlyAnonymousAdmins(ctx context.Context, b *bot.Bot, chatID int64) error {
+	return sendNotice(ctx, h.outbox, b, chatID, "Nothing to quote: messages from anonymous admins are not quoted.")
 }
 
 // buildFromReplyMessage builds a quote result from a reply message directly
 // This is a fallback when the message is not in cache
-func (h *AddQuoteHandler) buildFromReplyMessage(replyMsg *models.Message) (*BuildResult, error) {
-	// Convert message to JSON
-	msgJSON, err := json.Marshal(replyMsg)
+func (h *AddQuoteHandler) buildFromReplyMessage(ctx context.Context, replyMsg *models.Message) (*BuildResult, error) {
+	msg := message.FromTelegram(replyMsg)
+	if err := h.redactor.Apply(ctx, msg); err != nil {
+		return nil, err
+	}
+	msgJSON, err := msg.JSON()
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal message: %w", err)
 	}
@@ -94,7 +415,9 @@ func (h *AddQuoteHandler) buildFromReplyMessage(replyMsg *models.Message) (*Buil
 
 	entry := CacheEntry{
 		ChatID:    chatID,
-		MessageID: int64(replyMsg.ID),
+		MessageID: msg.MessageID,
+		ReplyID:   msg.ReplyToID(),
+		Date:      msg.Date,
 		Message:   msgJSON,
 	}
 
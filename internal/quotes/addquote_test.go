@@ -3,9 +3,16 @@ package quotes
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
 	"testing"
+	"time"
 
 	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/cache"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/outbox"
 	"github.com/graffic/wanon-go/internal/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -43,7 +50,7 @@ func TestAddQuoteHandler_buildFromReplyMessage(t *testing.T) {
 		},
 	}
 
-	result, err := handler.buildFromReplyMessage(replyMsg)
+	result, err := handler.buildFromReplyMessage(context.Background(), replyMsg)
 	require.NoError(t, err)
 	assert.Equal(t, int64(-100123), result.ChatID)
 	assert.Len(t, result.Entries, 1)
@@ -96,7 +103,7 @@ func TestAddQuoteHandler_Handle_WithReply_MessageNotInCache(t *testing.T) {
 		},
 	}
 
-	result, err := handler.buildFromReplyMessage(replyMsg)
+	result, err := handler.buildFromReplyMessage(context.Background(), replyMsg)
 	require.NoError(t, err)
 	assert.Equal(t, int64(-100123), result.ChatID)
 	assert.Len(t, result.Entries, 1)
@@ -112,6 +119,81 @@ func TestAddQuoteHandler_Handle_WithReply_MessageNotInCache(t *testing.T) {
 	assert.Len(t, quote.Entries, 1)
 }
 
+func TestAddQuoteHandler_answeredQuote(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	handler := NewAddQuoteHandler(db.DB)
+	ctx := context.Background()
+
+	require.NoError(t, db.DB.Exec(`INSERT INTO quote (id, creator, chat_id) VALUES (7, '{}', -100123)`).Error)
+	quoteID := uint(7)
+	now := time.Now()
+	require.NoError(t, db.DB.Create(&outbox.Message{ChatID: -100123, Text: "#7", QuoteID: &quoteID, MessageID: 40, SentAt: &now}).Error)
+
+	answer := int64(40)
+	found, err := handler.answeredQuote(ctx, -100123, &BuildResult{Entries: []CacheEntry{{ChatID: -100123, MessageID: 41, ReplyID: &answer}}})
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, uint(7), *found)
+
+	other := int64(39)
+	found, err = handler.answeredQuote(ctx, -100123, &BuildResult{Entries: []CacheEntry{{ChatID: -100123, MessageID: 41, ReplyID: &other}}})
+	require.NoError(t, err)
+	assert.Nil(t, found)
+
+	found, err = handler.answeredQuote(ctx, -100123, &BuildResult{Entries: []CacheEntry{{ChatID: -100123, MessageID: 41}}})
+	require.NoError(t, err)
+	assert.Nil(t, found)
+
+	// A thread keeping the bot's messages starts with the posted quote
+	result := &BuildResult{Entries: []CacheEntry{
+		{ChatID: -100123, MessageID: 40, Outgoing: true},
+		{ChatID: -100123, MessageID: 41, ReplyID: &answer},
+	}}
+	found, err = handler.answeredQuote(ctx, -100123, result)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, uint(7), *found)
+	require.Len(t, result.Entries, 1)
+	assert.Equal(t, int64(41), result.Entries[0].MessageID)
+}
+
+func TestAddQuoteHandler_AppendEditWindow(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	ctx := context.Background()
+	const chatID = -100123
+	created := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewMock(created.Add(time.Hour))
+	h.Use(cache.NewMiddleware(cache.NewService(h.DB.DB), slog.New(slog.NewTextHandler(io.Discard, nil))).BotMiddleware())
+	h.Register(NewAddQuoteHandler(h.DB.DB).WithAppendReplies(true).WithClock(clk).WithEditWindow(10 * time.Minute))
+
+	// Someone else added the quote, posted by the bot as message 500
+	store := NewStore(h.DB.DB)
+	quote, err := store.Store(ctx, StoreOptions{
+		ChatID:    chatID,
+		Creator:   map[string]interface{}{"id": 2},
+		Entries:   []CacheEntry{{ChatID: chatID, MessageID: 1, Message: datatypes.JSON(`{"text":"hi","from":{"id":2,"first_name":"Bob"}}`)}},
+		CreatedAt: created,
+	})
+	require.NoError(t, err)
+	now := clk.Now()
+	require.NoError(t, h.DB.DB.Create(&outbox.Message{ChatID: chatID, Text: "hi", QuoteID: &quote.ID, MessageID: 500, SentAt: &now}).Error)
+	posted := &models.Message{ID: 500, Chat: models.Chat{ID: chatID, Type: models.ChatTypeSupergroup}, From: &models.User{ID: 99, IsBot: true}}
+
+	// After the window the answers of others are quoted on their own
+	answer := h.ReplyText(posted, "classic")
+	h.ReplyText(answer, "/addquote")
+	assert.Equal(t, fmt.Sprintf("Quote #%d added with 1 entries! It was not added to quote #%d. Only the user who added the quote and chat administrators can add to it.", quote.ID+1, quote.ID), h.LastReply())
+	unchanged, err := store.GetByID(ctx, quote.ID)
+	require.NoError(t, err)
+	assert.Len(t, unchanged.Entries, 1)
+
+	// Admins can still add to it
+	h.SetAdmin(chatID, h.User.ID)
+	answer = h.ReplyText(posted, "so classic")
+	h.ReplyText(answer, "/addquote")
+	assert.Equal(t, fmt.Sprintf("Added 1 entries to quote #%d, it has 2 now!", quote.ID), h.LastReply())
+}
+
 func TestExtractUser(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -158,3 +240,70 @@ func TestExtractUser(t *testing.T) {
 		})
 	}
 }
+
+func TestAddQuoteHandler_EndToEnd(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    bool // Reply to a cached message
+		blocked  bool
+		expected string
+	}{
+		{name: "not a reply", expected: "Please reply to a message to add it as a quote."},
+		{name: "reply to a cached message", reply: true, expected: "Quote #1 added with 1 entries!"},
+		{name: "blocked quoter", reply: true, blocked: true, expected: "You are not allowed to add quotes in this chat."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := testutils.NewBotHarness(t)
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			h.Use(cache.NewMiddleware(cache.NewService(h.DB.DB), logger).BotMiddleware())
+			h.Register(NewAddQuoteHandler(h.DB.DB))
+
+			if tt.blocked {
+				_, err := NewBlocklist(h.DB.DB).Block(context.Background(), -100123, BlockTarget{UserID: h.User.ID}, 1)
+				require.NoError(t, err)
+			}
+
+			original := h.SendText(-100123, "Message to quote")
+			if tt.reply {
+				h.ReplyText(original, "/addquote")
+			} else {
+				h.SendText(-100123, "/addquote")
+			}
+
+			assert.Equal(t, tt.expected, h.LastReply())
+			assert.Len(t, h.Replies(), 1)
+		})
+	}
+}
+
+func TestAddQuoteHandler_Range(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+	}{
+		{name: "previous messages", command: "/addquote 2", expected: "Quote #1 added with 3 entries!"},
+		{name: "more than cached", command: "/addquote 5", expected: "Quote #1 added with 4 entries! Fewer messages were cached before it than asked for."},
+		{name: "not a number", command: "/addquote two", expected: "Usage: reply to a message with /addquote, or with /addquote <n> to quote it and the n messages before it."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := testutils.NewBotHarness(t)
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			h.Use(cache.NewMiddleware(cache.NewService(h.DB.DB), logger).BotMiddleware())
+			h.Register(NewAddQuoteHandler(h.DB.DB))
+
+			// None of them reply to each other
+			h.SendText(-100123, "First")
+			h.SendText(-100123, "Second")
+			h.SendText(-100123, "Third")
+			original := h.SendText(-100123, "Fourth")
+			h.ReplyText(original, tt.command)
+
+			assert.Equal(t, tt.expected, h.LastReply())
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package quotes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AuthorAlias is a user ID merged into another one of the same chat
+type AuthorAlias struct {
+	ChatID      int64     `gorm:"primaryKey;autoIncrement:false" json:"chat_id"`
+	AliasID     int64     `gorm:"primaryKey;autoIncrement:false" json:"alias_id"`
+	CanonicalID int64     `gorm:"not null" json:"canonical_id"`
+	MergedBy    int64     `gorm:"not null" json:"merged_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for AuthorAlias
+func (AuthorAlias) TableName() string {
+	return "author_alias"
+}
+
+// ErrSameAuthor is returned when merging a user into themselves
+var ErrSameAuthor = errors.New("both users are already the same author")
+
+// Aliases merges author identities, e.g. a person's old and new accounts,
+// so quotes treat them as one person
+type Aliases struct {
+	db *gorm.DB
+}
+
+// NewAliases creates a new alias store
+func NewAliases(db *gorm.DB) *Aliases {
+	return &Aliases{db: db}
+}
+
+// Merge makes aliasID an alias of canonicalID in a chat. If canonicalID is
+// itself an alias its canonical user is used, and users previously merged
+// into aliasID follow it. It returns the canonical user ID.
+func (a *Aliases) Merge(ctx context.Context, chatID, aliasID, canonicalID, mergedBy int64) (int64, error) {
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var target AuthorAlias
+		err := tx.Where("chat_id = ? AND alias_id = ?", chatID, canonicalID).First(&target).Error
+		if err == nil {
+			canonicalID = target.CanonicalID
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to resolve author alias: %w", err)
+		}
+		if canonicalID == aliasID {
+			return ErrSameAuthor
+		}
+
+		if err := tx.Model(&AuthorAlias{}).
+			Where("chat_id = ? AND canonical_id = ?", chatID, aliasID).
+			Update("canonical_id", canonicalID).Error; err != nil {
+			return fmt.Errorf("failed to move author aliases: %w", err)
+		}
+
+		alias := AuthorAlias{ChatID: chatID, AliasID: aliasID, CanonicalID: canonicalID, MergedBy: mergedBy}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chat_id"}, {Name: "alias_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"canonical_id", "merged_by"}),
+		}).Create(&alias).Error; err != nil {
+			return fmt.Errorf("failed to merge authors: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return canonicalID, nil
+}
+
+// Unmerge makes an alias its own author again. It returns false if the user
+// was not merged into anyone.
+func (a *Aliases) Unmerge(ctx context.Context, chatID, aliasID int64) (bool, error) {
+	result := a.db.WithContext(ctx).
+		Where("chat_id = ? AND alias_id = ?", chatID, aliasID).
+		Delete(&AuthorAlias{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to unmerge author: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// List returns the aliases of a chat, grouped by canonical user
+func (a *Aliases) List(ctx context.Context, chatID int64) ([]AuthorAlias, error) {
+	var aliases []AuthorAlias
+	if err := a.db.WithContext(ctx).
+		Where("chat_id = ?", chatID).
+		Order("canonical_id ASC, alias_id ASC").
+		Find(&aliases).Error; err != nil {
+		return nil, fmt.Errorf("failed to list author aliases: %w", err)
+	}
+	return aliases, nil
+}
+
+// Identities returns every user ID that is the same author as userID in a
+// chat, starting with the canonical one
+func (a *Aliases) Identities(ctx context.Context, chatID, userID int64) ([]int64, error) {
+	return authorIdentities(ctx, a.db, chatID, userID)
+}
+
+// authorIdentities resolves the identities of an author with any gorm
+// handle, so stores can use it inside their own transactions
+func authorIdentities(ctx context.Context, db *gorm.DB, chatID, userID int64) ([]int64, error) {
+	var canonical []int64
+	if err := db.WithContext(ctx).Model(&AuthorAlias{}).
+		Where("chat_id = ? AND alias_id = ?", chatID, userID).
+		Pluck("canonical_id", &canonical).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve author alias: %w", err)
+	}
+	if len(canonical) > 0 {
+		userID = canonical[0]
+	}
+
+	var aliases []int64
+	if err := db.WithContext(ctx).Model(&AuthorAlias{}).
+		Where("chat_id = ? AND canonical_id = ?", chatID, userID).
+		Order("alias_id ASC").
+		Pluck("alias_id", &aliases).Error; err != nil {
+		return nil, fmt.Errorf("failed to list author aliases: %w", err)
+	}
+	return append([]int64{userID}, aliases...), nil
+}
+
+// ParseMergeArgs reads the user IDs of `/mergeauthors <from> <into>`
+func ParseMergeArgs(args botcmd.Args) (int64, int64, error) {
+	if args.Len() != 2 {
+		return 0, 0, errors.New("usage: /mergeauthors <user id to merge> <user id to keep>")
+	}
+	ids := make([]int64, 2)
+	for i := range ids {
+		id, err := strconv.ParseInt(args.Arg(i), 10, 64)
+		if err != nil || id <= 0 {
+			return 0, 0, fmt.Errorf("invalid user ID %q", args.Arg(i))
+		}
+		ids[i] = id
+	}
+	return ids[0], ids[1], nil
+}
+
+// MergeAuthorsHandler handles the /mergeauthors and /unmergeauthors commands
+type MergeAuthorsHandler struct {
+	aliases *Aliases
+	outbox  *outbox.Outbox
+	admins  *telegram.AdminService
+	merge   bool
+}
+
+// NewMergeAuthorsHandler creates the /mergeauthors handler
+func NewMergeAuthorsHandler(db *gorm.DB) *MergeAuthorsHandler {
+	return &MergeAuthorsHandler{aliases: NewAliases(db), outbox: outbox.New(db), merge: true}
+}
+
+// NewUnmergeAuthorsHandler creates the /unmergeauthors handler
+func NewUnmergeAuthorsHandler(db *gorm.DB) *MergeAuthorsHandler {
+	return &MergeAuthorsHandler{aliases: NewAliases(db), outbox: outbox.New(db)}
+}
+
+// WithAdmins checks admins against a shared cache of chat administrators
+func (h *MergeAuthorsHandler) WithAdmins(admins *telegram.AdminService) *MergeAuthorsHandler {
+	h.admins = admins
+	return h
+}
+
+// Handle processes the command. /mergeauthors without arguments lists the
+// merged authors of the chat.
+func (h *MergeAuthorsHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	if h.merge && args.Len() == 0 {
+		return h.list(ctx, b, chatID)
+	}
+
+	admin, err := h.admins.IsSenderAdmin(ctx, b, msg)
+	var refused *telegram.OriginError
+	if errors.As(err, &refused) {
+		return sendNotice(ctx, h.outbox, b, chatID, refused.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return sendNotice(ctx, h.outbox, b, chatID, "Only chat administrators can merge authors.")
+	}
+
+	if !h.merge {
+		aliasID, err := strconv.ParseInt(args.Arg(0), 10, 64)
+		if err != nil || args.Len() != 1 {
+			return sendNotice(ctx, h.outbox, b, chatID, "Usage: /unmergeauthors <user id>")
+		}
+		removed, err := h.aliases.Unmerge(ctx, chatID, aliasID)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("User %d is not merged into anyone.", aliasID))
+		}
+		slog.Info("author unmerged", "audit", true, "chat_id", chatID, "admin_id", msg.From.ID, "alias_id", aliasID)
+		return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("User %d is their own author again.", aliasID))
+	}
+
+	aliasID, canonicalID, err := ParseMergeArgs(args)
+	if err != nil {
+		return sendNotice(ctx, h.outbox, b, chatID, err.Error())
+	}
+	canonicalID, err = h.aliases.Merge(ctx, chatID, aliasID, canonicalID, msg.From.ID)
+	if errors.Is(err, ErrSameAuthor) {
+		return sendNotice(ctx, h.outbox, b, chatID, "Both users are already the same author.")
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("authors merged", "audit", true, "chat_id", chatID, "admin_id", msg.From.ID, "alias_id", aliasID, "canonical_id", canonicalID)
+	return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("Quotes by user %d now count as user %d.", aliasID, canonicalID))
+}
+
+// list replies with the merged authors of the chat
+func (h *MergeAuthorsHandler) list(ctx context.Context, b *bot.Bot, chatID int64) error {
+	aliases, err := h.aliases.List(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if len(aliases) == 0 {
+		return sendNotice(ctx, h.outbox, b, chatID, "No merged authors.\n\nUsage: /mergeauthors <user id to merge> <user id to keep>")
+	}
+
+	lines := []string{"Merged authors:"}
+	for _, alias := range aliases {
+		lines = append(lines, fmt.Sprintf("• user %d → user %d", alias.AliasID, alias.CanonicalID))
+	}
+	return sendText(ctx, h.outbox, b, chatID, strings.Join(lines, "\n"))
+}
+
+// Command returns the command name
+func (h *MergeAuthorsHandler) Command() string {
+	if h.merge {
+		return "/mergeauthors"
+	}
+	return "/unmergeauthors"
+}
+
+// Description returns the command description
+func (h *MergeAuthorsHandler) Description() string {
+	if h.merge {
+		return "Treat two user IDs as the same author (admins only)"
+	}
+	return "Undo an author merge (admins only)"
+}
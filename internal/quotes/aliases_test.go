@@ -0,0 +1,107 @@
+package quotes
+
+import (
+	"context"
+	"testing"
+
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMergeArgs(t *testing.T) {
+	args, _ := botcmd.ParseArgs("/mergeauthors 111 222")
+	from, into, err := ParseMergeArgs(args)
+	require.NoError(t, err)
+	assert.Equal(t, int64(111), from)
+	assert.Equal(t, int64(222), into)
+
+	args, _ = botcmd.ParseArgs("/mergeauthors 111")
+	_, _, err = ParseMergeArgs(args)
+	assert.ErrorContains(t, err, "usage")
+
+	args, _ = botcmd.ParseArgs("/mergeauthors @bob 222")
+	_, _, err = ParseMergeArgs(args)
+	assert.ErrorContains(t, err, "invalid user ID")
+}
+
+func TestAuthors_Canonical(t *testing.T) {
+	authors := NewAuthors(nil).WithAliases(map[int64]int64{1: 2}, nil)
+	assert.Equal(t, int64(2), authors.Canonical(1))
+	assert.Equal(t, int64(3), authors.Canonical(3))
+
+	var none *Authors
+	assert.Equal(t, int64(1), none.Canonical(1))
+}
+
+func TestAliases(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	aliases := NewAliases(db.DB)
+	ctx := context.Background()
+	chatID := int64(-100123)
+
+	canonical, err := aliases.Merge(ctx, chatID, 1, 2, 99)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), canonical)
+
+	// Merging into an alias resolves to its canonical user
+	canonical, err = aliases.Merge(ctx, chatID, 3, 1, 99)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), canonical)
+
+	// Merging a canonical user moves its aliases along
+	canonical, err = aliases.Merge(ctx, chatID, 2, 4, 99)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), canonical)
+
+	ids, err := aliases.Identities(ctx, chatID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4, 1, 2, 3}, ids)
+
+	_, err = aliases.Merge(ctx, chatID, 4, 3, 99)
+	assert.ErrorIs(t, err, ErrSameAuthor)
+
+	removed, err := aliases.Unmerge(ctx, chatID, 3)
+	require.NoError(t, err)
+	assert.True(t, removed)
+
+	ids, err = aliases.Identities(ctx, chatID, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3}, ids)
+
+	removed, err = aliases.Unmerge(ctx, chatID, 3)
+	require.NoError(t, err)
+	assert.False(t, removed)
+}
+
+func TestLoadAuthors_MergedNames(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ctx := context.Background()
+	chatID := int64(-100123)
+
+	for _, message := range []string{
+		`{"text":"old","from":{"id":111,"first_name":"Juan"}}`,
+		`{"text":"new","from":{"id":222,"first_name":"Juan Carlos"}}`,
+	} {
+		_, err := store.Store(ctx, StoreOptions{
+			ChatID:  chatID,
+			Creator: map[string]interface{}{"id": 1},
+			Entries: []CacheEntry{{Message: []byte(message)}},
+		})
+		require.NoError(t, err)
+	}
+
+	_, err := NewAliases(db.DB).Merge(ctx, chatID, 111, 222, 1)
+	require.NoError(t, err)
+
+	authors, err := LoadAuthors(ctx, db.DB, chatID)
+	require.NoError(t, err)
+	assert.Equal(t, "Juan Carlos", authors.DisplayName(111, "Juan"))
+
+	// Author filters match every identity
+	count, err := store.BulkDelete(ctx, BulkDeleteFilter{ChatID: chatID, AuthorID: 222}, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
@@ -0,0 +1,150 @@
+package quotes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/graffic/wanon-go/internal/message"
+	"gorm.io/gorm"
+)
+
+// Authors resolves how quote authors are displayed in a chat. A nil
+// *Authors shows Telegram names unchanged.
+type Authors struct {
+	nicknames map[int64]string // User ID to display name
+	aliases   map[int64]int64  // Merged user ID to canonical user ID
+	names     map[int64]string // Telegram name of canonical users
+}
+
+// NewAuthors creates an author directory from user ID to nickname mappings
+func NewAuthors(nicknames map[int64]string) *Authors {
+	return &Authors{nicknames: nicknames}
+}
+
+// WithAliases makes the directory treat merged users as their canonical
+// user. names holds the Telegram name shown for canonical users without a
+// nickname.
+func (a *Authors) WithAliases(aliases map[int64]int64, names map[int64]string) *Authors {
+	a.aliases = aliases
+	a.names = names
+	return a
+}
+
+// Canonical returns the user a user ID was merged into, or the ID itself
+func (a *Authors) Canonical(userID int64) int64 {
+	if a == nil {
+		return userID
+	}
+	if canonical, ok := a.aliases[userID]; ok {
+		return canonical
+	}
+	return userID
+}
+
+// DisplayName returns the nickname of a user, or fallback if they have none.
+// Merged users are shown as their canonical user.
+func (a *Authors) DisplayName(userID int64, fallback string) string {
+	if a == nil || userID == 0 {
+		return fallback
+	}
+	canonical := a.Canonical(userID)
+	if nickname, ok := a.nicknames[canonical]; ok {
+		return nickname
+	}
+	if name, ok := a.names[canonical]; ok && canonical != userID {
+		return name
+	}
+	return fallback
+}
+
+// LoadAuthors builds the author directory used to render the quotes of a chat
+func LoadAuthors(ctx context.Context, db *gorm.DB, chatID int64) (*Authors, error) {
+	nicknames, err := NewNicknames(db).List(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	byUser := make(map[int64]string, len(nicknames))
+	for _, nickname := range nicknames {
+		byUser[nickname.UserID] = nickname.Nickname
+	}
+
+	aliases, err := NewAliases(db).List(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if len(aliases) == 0 {
+		return NewAuthors(byUser), nil
+	}
+	canonicals := make(map[int64]int64, len(aliases))
+	var ids []int64
+	for _, alias := range aliases {
+		if _, seen := canonicals[alias.CanonicalID]; !seen {
+			ids = append(ids, alias.CanonicalID)
+		}
+		canonicals[alias.AliasID] = alias.CanonicalID
+	}
+	names, err := latestNames(ctx, db, chatID, ids)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuthors(byUser).WithAliases(canonicals, names), nil
+}
+
+// latestNames finds the Telegram name users had in their most recently
+// quoted message of a chat
+func latestNames(ctx context.Context, db *gorm.DB, chatID int64, userIDs []int64) (map[int64]string, error) {
+	var rows []struct {
+		UserID int64
+		Sender []byte
+	}
+	err := db.WithContext(ctx).Raw(`
+		SELECT DISTINCT ON (user_id) user_id, sender FROM (
+			SELECT (e.message->'from'->>'id')::bigint AS user_id, e.message->'from' AS sender, e.id
+			FROM quote_entry e JOIN quote q ON q.id = e.quote_id
+			WHERE q.chat_id = ? AND e.deleted_at IS NULL
+		) entries
+		WHERE user_id IN ?
+		ORDER BY user_id, id DESC`, chatID, userIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find author names: %w", err)
+	}
+
+	names := make(map[int64]string, len(rows))
+	for _, row := range rows {
+		var from message.User
+		if err := json.Unmarshal(row.Sender, &from); err != nil {
+			continue
+		}
+		names[row.UserID] = authorName(from.FirstName, from.LastName, from.Username)
+	}
+	return names, nil
+}
+
+// authorName builds a display name from user info
+func authorName(firstName, lastName, username string) string {
+	var parts []string
+
+	if firstName != "" {
+		parts = append(parts, firstName)
+	}
+	if lastName != "" {
+		parts = append(parts, lastName)
+	}
+
+	name := strings.Join(parts, " ")
+
+	// If no name available, use username
+	if name == "" && username != "" {
+		name = "@" + username
+	}
+
+	// Fallback
+	if name == "" {
+		name = "Unknown"
+	}
+
+	return name
+}
@@ -0,0 +1,273 @@
+package quotes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"gorm.io/gorm"
+)
+
+// QuoterBlock is a user who cannot add quotes in a chat
+type QuoterBlock struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ChatID    int64     `gorm:"index;not null" json:"chat_id"`
+	UserID    int64     `gorm:"not null;default:0" json:"user_id"`   // Zero when only the username is known
+	Username  string    `gorm:"not null;default:''" json:"username"` // Without @
+	BlockedBy int64     `gorm:"not null" json:"blocked_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for QuoterBlock
+func (QuoterBlock) TableName() string {
+	return "quoter_block"
+}
+
+// BlockTarget identifies a user by ID, username or both
+type BlockTarget struct {
+	UserID   int64
+	Username string
+}
+
+// String renders the target for messages and logs
+func (t BlockTarget) String() string {
+	switch {
+	case t.Username != "":
+		return "@" + t.Username
+	case t.UserID != 0:
+		return fmt.Sprintf("user %d", t.UserID)
+	}
+	return "unknown user"
+}
+
+// Blocklist keeps the users who cannot add quotes in each chat
+type Blocklist struct {
+	db *gorm.DB
+}
+
+// NewBlocklist creates a new blocklist
+func NewBlocklist(db *gorm.DB) *Blocklist {
+	return &Blocklist{db: db}
+}
+
+// matching scopes a query to the blocks of a chat matching the target
+func (b *Blocklist) matching(ctx context.Context, chatID int64, target BlockTarget) *gorm.DB {
+	return b.db.WithContext(ctx).
+		Where("chat_id = ?", chatID).
+		Where("(user_id <> 0 AND user_id = ?) OR (username <> '' AND lower(username) = lower(?))", target.UserID, target.Username)
+}
+
+// Block prevents a user from adding quotes in a chat. It returns false if the
+// user was already blocked; known details of the user are filled in anyway.
+func (b *Blocklist) Block(ctx context.Context, chatID int64, target BlockTarget, blockedBy int64) (bool, error) {
+	var existing QuoterBlock
+	err := b.matching(ctx, chatID, target).First(&existing).Error
+	if err == nil {
+		updates := map[string]interface{}{}
+		if existing.UserID == 0 && target.UserID != 0 {
+			updates["user_id"] = target.UserID
+		}
+		if existing.Username == "" && target.Username != "" {
+			updates["username"] = target.Username
+		}
+		if len(updates) > 0 {
+			if err := b.db.WithContext(ctx).Model(&existing).Updates(updates).Error; err != nil {
+				return false, fmt.Errorf("failed to update quoter block: %w", err)
+			}
+		}
+		return false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, fmt.Errorf("failed to check quoter block: %w", err)
+	}
+
+	block := QuoterBlock{
+		ChatID:    chatID,
+		UserID:    target.UserID,
+		Username:  target.Username,
+		BlockedBy: blockedBy,
+	}
+	if err := b.db.WithContext(ctx).Create(&block).Error; err != nil {
+		return false, fmt.Errorf("failed to block quoter: %w", err)
+	}
+	return true, nil
+}
+
+// Unblock allows a user to add quotes again. It returns false if the user
+// was not blocked.
+func (b *Blocklist) Unblock(ctx context.Context, chatID int64, target BlockTarget) (bool, error) {
+	result := b.matching(ctx, chatID, target).Delete(&QuoterBlock{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to unblock quoter: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// IsBlocked reports whether a user cannot add quotes in a chat
+func (b *Blocklist) IsBlocked(ctx context.Context, chatID int64, user *models.User) (bool, error) {
+	if user == nil {
+		return false, nil
+	}
+	var count int64
+	err := b.matching(ctx, chatID, BlockTarget{UserID: user.ID, Username: user.Username}).
+		Model(&QuoterBlock{}).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check quoter block: %w", err)
+	}
+	return count > 0, nil
+}
+
+// List returns the blocked users of a chat, oldest first
+func (b *Blocklist) List(ctx context.Context, chatID int64) ([]QuoterBlock, error) {
+	var blocks []QuoterBlock
+	if err := b.db.WithContext(ctx).
+		Where("chat_id = ?", chatID).
+		Order("id ASC").
+		Find(&blocks).Error; err != nil {
+		return nil, fmt.Errorf("failed to list quoter blocks: %w", err)
+	}
+	return blocks, nil
+}
+
+// ParseBlockTarget finds the user a block command is about: an "@username"
+// or numeric ID argument, or else the author of the replied message.
+func ParseBlockTarget(args botcmd.Args, reply *models.Message) (BlockTarget, error) {
+	if arg := args.Arg(0); arg != "" {
+		if id, err := strconv.ParseInt(arg, 10, 64); err == nil && id > 0 {
+			return BlockTarget{UserID: id}, nil
+		}
+		if username := strings.TrimPrefix(arg, "@"); username != arg && username != "" {
+			return BlockTarget{Username: username}, nil
+		}
+		return BlockTarget{}, fmt.Errorf("invalid user %q, use @username, a user ID or reply to one of their messages", arg)
+	}
+	if reply != nil && reply.From != nil {
+		return BlockTarget{UserID: reply.From.ID, Username: reply.From.Username}, nil
+	}
+	return BlockTarget{}, errors.New("tell me who: use @username, a user ID or reply to one of their messages")
+}
+
+// QuoterBlockHandler handles the /blockquoter and /unblockquoter commands
+type QuoterBlockHandler struct {
+	blocklist *Blocklist
+	outbox    *outbox.Outbox
+	admins    *telegram.AdminService
+	block     bool
+}
+
+// NewBlockQuoterHandler creates the /blockquoter handler
+func NewBlockQuoterHandler(db *gorm.DB) *QuoterBlockHandler {
+	return &QuoterBlockHandler{blocklist: NewBlocklist(db), outbox: outbox.New(db), block: true}
+}
+
+// NewUnblockQuoterHandler creates the /unblockquoter handler
+func NewUnblockQuoterHandler(db *gorm.DB) *QuoterBlockHandler {
+	return &QuoterBlockHandler{blocklist: NewBlocklist(db), outbox: outbox.New(db)}
+}
+
+// WithAdmins checks admins against a shared cache of chat administrators
+func (h *QuoterBlockHandler) WithAdmins(admins *telegram.AdminService) *QuoterBlockHandler {
+	h.admins = admins
+	return h
+}
+
+// Handle processes the command. /blockquoter without a target lists the
+// blocked users of the chat.
+func (h *QuoterBlockHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+
+	admin, err := h.admins.IsSenderAdmin(ctx, b, msg)
+	var refused *telegram.OriginError
+	if errors.As(err, &refused) {
+		return sendNotice(ctx, h.outbox, b, chatID, refused.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return sendNotice(ctx, h.outbox, b, chatID, "Only chat administrators can manage who adds quotes.")
+	}
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	if h.block && args.Len() == 0 && msg.ReplyToMessage == nil {
+		return h.list(ctx, b, chatID)
+	}
+
+	target, err := ParseBlockTarget(args, msg.ReplyToMessage)
+	if err != nil {
+		return sendNotice(ctx, h.outbox, b, chatID, err.Error())
+	}
+
+	if !h.block {
+		removed, err := h.blocklist.Unblock(ctx, chatID, target)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("%s is not blocked.", target))
+		}
+		slog.Info("quoter unblocked", "audit", true, "chat_id", chatID, "admin_id", msg.From.ID, "target_id", target.UserID, "target_username", target.Username)
+		return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("%s can add quotes again.", target))
+	}
+
+	if target.UserID == msg.From.ID {
+		return sendNotice(ctx, h.outbox, b, chatID, "You cannot block yourself.")
+	}
+
+	added, err := h.blocklist.Block(ctx, chatID, target, msg.From.ID)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("%s is already blocked.", target))
+	}
+	slog.Info("quoter blocked", "audit", true, "chat_id", chatID, "admin_id", msg.From.ID, "target_id", target.UserID, "target_username", target.Username)
+	return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("%s can no longer add quotes.", target))
+}
+
+// list replies with the blocked users of the chat
+func (h *QuoterBlockHandler) list(ctx context.Context, b *bot.Bot, chatID int64) error {
+	blocks, err := h.blocklist.List(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if len(blocks) == 0 {
+		return sendNotice(ctx, h.outbox, b, chatID, "Nobody is blocked from adding quotes.\n\nUsage: /blockquoter @username")
+	}
+
+	lines := []string{"Blocked from adding quotes:"}
+	for _, block := range blocks {
+		lines = append(lines, "• "+BlockTarget{UserID: block.UserID, Username: block.Username}.String())
+	}
+	return sendText(ctx, h.outbox, b, chatID, strings.Join(lines, "\n"))
+}
+
+// Command returns the command name
+func (h *QuoterBlockHandler) Command() string {
+	if h.block {
+		return "/blockquoter"
+	}
+	return "/unblockquoter"
+}
+
+// Description returns the command description
+func (h *QuoterBlockHandler) Description() string {
+	if h.block {
+		return "Stop a user from adding quotes (admins only)"
+	}
+	return "Allow a blocked user to add quotes again (admins only)"
+}
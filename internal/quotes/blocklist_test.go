@@ -0,0 +1,107 @@
+package quotes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBlockTarget(t *testing.T) {
+	reply := &models.Message{From: &models.User{ID: 42, Username: "bob"}}
+
+	tests := []struct {
+		name        string
+		text        string
+		reply       *models.Message
+		expected    BlockTarget
+		errContains string
+	}{
+		{name: "username", text: "/blockquoter @bob", expected: BlockTarget{Username: "bob"}},
+		{name: "user id", text: "/blockquoter 12345", expected: BlockTarget{UserID: 12345}},
+		{name: "argument wins over reply", text: "/blockquoter @carol", reply: reply, expected: BlockTarget{Username: "carol"}},
+		{name: "reply", text: "/blockquoter", reply: reply, expected: BlockTarget{UserID: 42, Username: "bob"}},
+		{name: "bare name", text: "/blockquoter bob", errContains: "invalid user"},
+		{name: "nobody", text: "/unblockquoter", errContains: "tell me who"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, _ := botcmd.ParseArgs(tt.text)
+			target, err := ParseBlockTarget(args, tt.reply)
+			if tt.errContains != "" {
+				assert.ErrorContains(t, err, tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, target)
+		})
+	}
+}
+
+func TestBlockTarget_String(t *testing.T) {
+	assert.Equal(t, "@bob", BlockTarget{UserID: 1, Username: "bob"}.String())
+	assert.Equal(t, "user 1", BlockTarget{UserID: 1}.String())
+}
+
+func TestQuoterBlockHandler_Command(t *testing.T) {
+	assert.Equal(t, "/blockquoter", (&QuoterBlockHandler{block: true}).Command())
+	assert.Equal(t, "/unblockquoter", (&QuoterBlockHandler{}).Command())
+}
+
+func TestBlocklist(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	blocklist := NewBlocklist(db.DB)
+	ctx := context.Background()
+
+	bob := &models.User{ID: 42, Username: "Bob"}
+
+	blocked, err := blocklist.IsBlocked(ctx, -100123, bob)
+	require.NoError(t, err)
+	assert.False(t, blocked)
+
+	// Blocking by username matches case-insensitively
+	added, err := blocklist.Block(ctx, -100123, BlockTarget{Username: "bob"}, 1)
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	blocked, err = blocklist.IsBlocked(ctx, -100123, bob)
+	require.NoError(t, err)
+	assert.True(t, blocked)
+
+	// Other chats are not affected
+	blocked, err = blocklist.IsBlocked(ctx, -100999, bob)
+	require.NoError(t, err)
+	assert.False(t, blocked)
+
+	// Blocking again fills in the user ID, so renames do not escape the block
+	added, err = blocklist.Block(ctx, -100123, BlockTarget{UserID: 42, Username: "bob"}, 1)
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	blocked, err = blocklist.IsBlocked(ctx, -100123, &models.User{ID: 42, Username: "bob_renamed"})
+	require.NoError(t, err)
+	assert.True(t, blocked)
+
+	blocks, err := blocklist.List(ctx, -100123)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	assert.Equal(t, int64(42), blocks[0].UserID)
+
+	// Unblocking by ID removes the block
+	removed, err := blocklist.Unblock(ctx, -100123, BlockTarget{UserID: 42})
+	require.NoError(t, err)
+	assert.True(t, removed)
+
+	removed, err = blocklist.Unblock(ctx, -100123, BlockTarget{UserID: 42})
+	require.NoError(t, err)
+	assert.False(t, removed)
+
+	blocked, err = blocklist.IsBlocked(ctx, -100123, bob)
+	require.NoError(t, err)
+	assert.False(t, blocked)
+}
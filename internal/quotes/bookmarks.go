@@ -0,0 +1,382 @@
+package quotes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"github.com/graffic/wanon-go/internal/textutil"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// bookmarkCallbackPrefix prefixes the callback data of the Save buttons on
+// posted quotes and the remove buttons of /saved
+const bookmarkCallbackPrefix = "bookmark:"
+
+// bookmarkReaction is the reaction that bookmarks a posted quote
+const bookmarkReaction = "⭐"
+
+// Limits of the /saved list, which fits in one message
+const (
+	savedLimit   = 20
+	savedPreview = 120 // UTF-16 code units of each quote shown
+)
+
+// Bookmark is a quote a user saved for themselves
+type Bookmark struct {
+	UserID    int64     `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	QuoteID   uint      `gorm:"primaryKey;autoIncrement:false" json:"quote_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for Bookmark
+func (Bookmark) TableName() string {
+	return "user_bookmarks"
+}
+
+// Bookmarks stores the quotes each user saved
+type Bookmarks struct {
+	db *gorm.DB
+}
+
+// NewBookmarks creates a bookmark store
+func NewBookmarks(db *gorm.DB) *Bookmarks {
+	return &Bookmarks{db: db}
+}
+
+// Add bookmarks a quote for a user. It returns false if the user had
+// already saved it.
+func (s *Bookmarks) Add(ctx context.Context, userID int64, quoteID uint) (bool, error) {
+	result := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Bookmark{UserID: userID, QuoteID: quoteID})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to save bookmark: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Remove deletes the bookmark of a user on a quote. It returns false if
+// there was none.
+func (s *Bookmarks) Remove(ctx context.Context, userID int64, quoteID uint) (bool, error) {
+	result := s.db.WithContext(ctx).
+		Where("user_id = ? AND quote_id = ?", userID, quoteID).
+		Delete(&Bookmark{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to remove bookmark: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// List returns up to limit quotes a user saved, latest bookmark first,
+// with their entries
+func (s *Bookmarks) List(ctx context.Context, userID int64, limit int) ([]Quote, error) {
+	var quotes []Quote
+	if err := s.db.WithContext(ctx).
+		Joins("JOIN user_bookmarks ON user_bookmarks.quote_id = quote.id").
+		Where("user_bookmarks.user_id = ?", userID).
+		Order("user_bookmarks.created_at DESC, quote.id DESC").
+		Limit(limit).
+		Preload("Entries", func(db *gorm.DB) *gorm.DB {
+			return db.Order("quote_entry.order ASC")
+		}).
+		Find(&quotes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list bookmarks: %w", err)
+	}
+	return quotes, nil
+}
+
+// Count returns how many quotes a user saved
+func (s *Bookmarks) Count(ctx context.Context, userID int64) (int64, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&Bookmark{}).
+		Where("user_id = ?", userID).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count bookmarks: %w", err)
+	}
+	return count, nil
+}
+
+// saveKeyboard is the Save button under a posted quote
+func saveKeyboard(quoteID uint) *models.InlineKeyboardMarkup {
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{
+		{Text: "⭐ Save", CallbackData: fmt.Sprintf("%ssave:%d", bookmarkCallbackPrefix, quoteID)},
+	}}}
+}
+
+// parseBookmarkCallback extracts the action, save or remove, and the quote
+// of a bookmark button
+func parseBookmarkCallback(data string) (action string, quoteID uint, ok bool) {
+	if !strings.HasPrefix(data, bookmarkCallbackPrefix) {
+		return "", 0, false
+	}
+	action, id, found := strings.Cut(strings.TrimPrefix(data, bookmarkCallbackPrefix), ":")
+	if !found || (action != "save" && action != "remove") {
+		return "", 0, false
+	}
+	parsed, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || parsed == 0 {
+		return "", 0, false
+	}
+	return action, uint(parsed), true
+}
+
+// hasBookmarkReaction reports whether reactions include the bookmark one
+func hasBookmarkReaction(reactions []models.ReactionType) bool {
+	for _, reaction := range reactions {
+		if reaction.ReactionTypeEmoji != nil && reaction.ReactionTypeEmoji.Emoji == bookmarkReaction {
+			return true
+		}
+	}
+	return false
+}
+
+// SavedHandler handles the /saved command, the Save buttons of posted
+// quotes and ⭐ reactions to them. Bookmarks are private: they are only
+// listed to their owner, in a private chat.
+type SavedHandler struct {
+	store     *Store
+	bookmarks *Bookmarks
+	renderer  *Renderer
+	outbox    *outbox.Outbox
+	invites   *telegram.InviteLinks
+}
+
+// NewSavedHandler creates a new saved handler
+func NewSavedHandler(db *gorm.DB) *SavedHandler {
+	return &SavedHandler{
+		store:     NewStore(db),
+		bookmarks: NewBookmarks(db),
+		renderer:  NewRenderer(),
+		outbox:    outbox.New(db),
+	}
+}
+
+// WithInviteLinks adds a button opening the original chat to saved quotes
+// without a message link, e.g. those of basic groups
+func (h *SavedHandler) WithInviteLinks(invites *telegram.InviteLinks) *SavedHandler {
+	h.invites = invites
+	return h
+}
+
+// HandleMyChatMember forgets the invite links of the chats where the bot
+// lost its admin rights
+func (h *SavedHandler) HandleMyChatMember(update *models.Update) {
+	if h.invites != nil {
+		h.invites.HandleMyChatMember(update.MyChatMember)
+	}
+}
+
+// Handle processes the /saved command, listing the bookmarks of the sender
+// with a button to remove each of them
+func (h *SavedHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID, userID := msg.Chat.ID, msg.From.ID
+	if msg.Chat.Type != models.ChatTypePrivate {
+		return sendNotice(ctx, h.outbox, b, chatID, "Send /saved to me in a private chat.")
+	}
+	slog.Info("executing /saved command", "user_id", userID)
+
+	text, keyboard, err := h.list(ctx, userID)
+	if err != nil {
+		return err
+	}
+	_, err = h.outbox.Send(ctx, b, &outbox.Message{ChatID: chatID, Text: text, Keyboard: keyboard})
+	return err
+}
+
+// list renders the bookmarks of a user and their remove buttons
+func (h *SavedHandler) list(ctx context.Context, userID int64) (string, *models.InlineKeyboardMarkup, error) {
+	quotes, err := h.bookmarks.List(ctx, userID, savedLimit)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(quotes) == 0 {
+		return "You have no saved quotes. React with ⭐ to a quote or press its Save button to keep it here.", nil, nil
+	}
+	count, err := h.bookmarks.Count(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	lines := []string{fmt.Sprintf("⭐ Your saved quotes (%d):", count)}
+	var rows [][]models.InlineKeyboardButton
+	invites := make(map[int64]string)
+	for i := range quotes {
+		quote := &quotes[i]
+		lines = append(lines, fmt.Sprintf("#%d %s", quote.ID, h.preview(quote)))
+		row := []models.InlineKeyboardButton{{
+			Text:         fmt.Sprintf("❌ Remove #%d", quote.ID),
+			CallbackData: fmt.Sprintf("%sremove:%d", bookmarkCallbackPrefix, quote.ID),
+		}}
+		if link := h.originalLink(ctx, quote, userID, invites); link != "" {
+			row = append(row, models.InlineKeyboardButton{Text: "🔗 Original", URL: link})
+		}
+		rows = append(rows, row)
+	}
+	if count > int64(len(quotes)) {
+		lines = append(lines, fmt.Sprintf("…and %d older ones. Remove some to see them.", count-int64(len(quotes))))
+	}
+	return strings.Join(lines, "\n\n"), &models.InlineKeyboardMarkup{InlineKeyboard: rows}, nil
+}
+
+// originalLink returns the link to the message of a saved quote, or else an
+// invite link to its chat when the user is still in it. invites holds the
+// links already looked up for the list, "" when there is none.
+func (h *SavedHandler) originalLink(ctx context.Context, quote *Quote, userID int64, invites map[int64]string) string {
+	if link := quote.Link(); link != "" {
+		return link
+	}
+	if h.invites == nil {
+		return ""
+	}
+	if link, ok := invites[quote.ChatID]; ok {
+		return link
+	}
+	link, err := h.invites.GetForMember(ctx, quote.ChatID, userID)
+	if err != nil {
+		slog.Debug("no invite link for saved quote", "chat_id", quote.ChatID, "user_id", userID, "error", err)
+	}
+	invites[quote.ChatID] = link
+	return link
+}
+
+// preview shortens a quote to one line for the /saved list
+func (h *SavedHandler) preview(quote *Quote) string {
+	return quotePreview(h.renderer, quote, savedPreview)
+}
+
+// quotePreview renders a quote on one line of at most limit UTF-16 code
+// units, for lists of quotes
+func quotePreview(renderer *Renderer, quote *Quote, limit int) string {
+	text, err := renderer.RenderSimple(quote)
+	if err != nil {
+		return "(empty quote)"
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if short := textutil.Truncate(text, limit); short != text {
+		return short + "…"
+	}
+	return text
+}
+
+// HandleCallback processes the Save buttons of posted quotes and the remove
+// buttons of /saved
+func (h *SavedHandler) HandleCallback(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil {
+		return nil
+	}
+	action, quoteID, ok := parseBookmarkCallback(query.Data)
+	if !ok {
+		return nil
+	}
+	message := query.Message.Message
+	userID := query.From.ID
+
+	if action == "save" {
+		text, err := h.save(ctx, message.Chat.ID, userID, quoteID)
+		if err != nil {
+			return err
+		}
+		_, err = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID, Text: text})
+		return err
+	}
+
+	removed, err := h.bookmarks.Remove(ctx, userID, quoteID)
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("Removed quote #%d from your saved quotes.", quoteID)
+	if !removed {
+		text = fmt.Sprintf("Quote #%d was not saved.", quoteID)
+	}
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID, Text: text}); err != nil {
+		return err
+	}
+
+	list, keyboard, err := h.list(ctx, userID)
+	if err != nil {
+		return err
+	}
+	params := &bot.EditMessageTextParams{ChatID: message.Chat.ID, MessageID: message.ID, Text: list}
+	if keyboard != nil {
+		params.ReplyMarkup = keyboard
+	}
+	_, err = b.EditMessageText(ctx, params)
+	return err
+}
+
+// save bookmarks a quote posted in a chat and returns the answer for the
+// user. Only quotes of the chat the button is in are saved, whatever the
+// callback data says.
+func (h *SavedHandler) save(ctx context.Context, chatID, userID int64, quoteID uint) (string, error) {
+	quote, err := h.store.GetByID(ctx, quoteID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && quote.ChatID != chatID) {
+		return "This quote no longer exists.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	added, err := h.bookmarks.Add(ctx, userID, quoteID)
+	if err != nil {
+		return "", err
+	}
+	if !added {
+		return fmt.Sprintf("Quote #%d is already in your saved quotes.", quoteID), nil
+	}
+	slog.Info("bookmarked quote", "chat_id", chatID, "user_id", userID, "quote_id", quoteID)
+	return fmt.Sprintf("Saved quote #%d. Send /saved to me in a private chat to see your saved quotes.", quoteID), nil
+}
+
+// HandleReaction bookmarks a posted quote when a user reacts to it with ⭐,
+// and removes the bookmark when they take the reaction back. Reactions to
+// other messages, and anonymous ones, are ignored.
+func (h *SavedHandler) HandleReaction(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	reaction := update.MessageReaction
+	if reaction == nil || reaction.User == nil {
+		return nil
+	}
+	added := hasBookmarkReaction(reaction.NewReaction) && !hasBookmarkReaction(reaction.OldReaction)
+	removed := hasBookmarkReaction(reaction.OldReaction) && !hasBookmarkReaction(reaction.NewReaction)
+	if !added && !removed {
+		return nil
+	}
+
+	quoteID, err := h.outbox.QuoteFor(ctx, reaction.Chat.ID, reaction.MessageID)
+	if err != nil || quoteID == nil {
+		return err
+	}
+	userID := reaction.User.ID
+	if removed {
+		_, err := h.bookmarks.Remove(ctx, userID, *quoteID)
+		return err
+	}
+	if _, err := h.bookmarks.Add(ctx, userID, *quoteID); err != nil {
+		return err
+	}
+	slog.Info("bookmarked quote", "chat_id", reaction.Chat.ID, "user_id", userID, "quote_id", *quoteID)
+	return nil
+}
+
+// Command returns the command name
+func (h *SavedHandler) Command() string {
+	return "/saved"
+}
+
+// Description returns the command description
+func (h *SavedHandler) Description() string {
+	return "List the quotes you saved with ⭐, in a private chat"
+}
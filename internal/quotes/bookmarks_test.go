@@ -0,0 +1,137 @@
+package quotes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestParseBookmarkCallback(t *testing.T) {
+	action, quoteID, ok := parseBookmarkCallback("bookmark:save:12")
+	require.True(t, ok)
+	assert.Equal(t, "save", action)
+	assert.Equal(t, uint(12), quoteID)
+
+	action, quoteID, ok = parseBookmarkCallback("bookmark:remove:3")
+	require.True(t, ok)
+	assert.Equal(t, "remove", action)
+	assert.Equal(t, uint(3), quoteID)
+
+	for _, data := range []string{"bookmark:share:12", "bookmark:save", "bookmark:save:x", "bookmark:save:0", "quoteduel:save:12"} {
+		_, _, ok := parseBookmarkCallback(data)
+		assert.False(t, ok, data)
+	}
+}
+
+func TestHasBookmarkReaction(t *testing.T) {
+	emoji := func(e string) models.ReactionType {
+		return models.ReactionType{Type: models.ReactionTypeTypeEmoji, ReactionTypeEmoji: &models.ReactionTypeEmoji{Emoji: e}}
+	}
+	assert.True(t, hasBookmarkReaction([]models.ReactionType{emoji("👍"), emoji("⭐")}))
+	assert.False(t, hasBookmarkReaction([]models.ReactionType{emoji("👍")}))
+	assert.False(t, hasBookmarkReaction([]models.ReactionType{{Type: models.ReactionTypeTypePaid, ReactionTypePaid: &models.ReactionTypePaid{}}}))
+	assert.False(t, hasBookmarkReaction(nil))
+}
+
+func TestSaveKeyboard(t *testing.T) {
+	keyboard := saveKeyboard(42)
+	require.Len(t, keyboard.InlineKeyboard, 1)
+	require.Len(t, keyboard.InlineKeyboard[0], 1)
+	assert.Equal(t, "⭐ Save", keyboard.InlineKeyboard[0][0].Text)
+	assert.Equal(t, "bookmark:save:42", keyboard.InlineKeyboard[0][0].CallbackData)
+}
+
+func TestSavedHandler(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	saved := NewSavedHandler(h.DB.DB).WithInviteLinks(telegram.NewInviteLinks(h.Bot, 1, 0))
+	h.SetAdmin(-100123, 1) // The bot, allowed to invite users
+	h.Register(NewRQuoteHandler(h.DB.DB), saved)
+	h.RegisterCallback(bookmarkCallbackPrefix, testutils.HandlerFunc(saved.HandleCallback))
+	ctx := context.Background()
+
+	quote, err := NewStore(h.DB.DB).Store(ctx, StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"to keep","from":{"first_name":"Bob"}}`)}},
+	})
+	require.NoError(t, err)
+
+	// Posted quotes come with a Save button
+	h.SendText(-100123, "/rquote")
+	posts := h.Requests("sendMessage")
+	require.Len(t, posts, 1)
+	assert.Contains(t, posts[0].Params["reply_markup"], "bookmark:save:")
+	var posted outbox.Message
+	require.NoError(t, h.DB.DB.Where("quote_id = ?", quote.ID).First(&posted).Error)
+
+	// Reacting with a star saves it, privately
+	react := func(before, after string) {
+		reaction := func(emoji string) []models.ReactionType {
+			if emoji == "" {
+				return nil
+			}
+			return []models.ReactionType{{Type: models.ReactionTypeTypeEmoji, ReactionTypeEmoji: &models.ReactionTypeEmoji{Emoji: emoji}}}
+		}
+		require.NoError(t, saved.HandleReaction(ctx, h.Bot, &models.Update{MessageReaction: &models.MessageReactionUpdated{
+			Chat:        models.Chat{ID: -100123, Type: models.ChatTypeSupergroup},
+			MessageID:   posted.MessageID,
+			User:        h.User,
+			OldReaction: reaction(before),
+			NewReaction: reaction(after),
+		}}))
+	}
+	react("", "👍")
+	count, err := saved.bookmarks.Count(ctx, h.User.ID)
+	require.NoError(t, err)
+	assert.Zero(t, count, "other reactions do not save")
+	react("👍", "⭐")
+	count, err = saved.bookmarks.Count(ctx, h.User.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Len(t, h.Requests("sendMessage"), 1, "saving does not post in the chat")
+
+	// The button tells the user it is already there
+	group := &models.Message{ID: posted.MessageID, Chat: models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}}
+	h.Press(group, "bookmark:save:"+fmt.Sprint(quote.ID))
+	answers := h.Requests("answerCallbackQuery")
+	require.Len(t, answers, 1)
+	assert.Equal(t, "Quote #"+fmt.Sprint(quote.ID)+" is already in your saved quotes.", answers[0].Params["text"])
+
+	// Buttons cannot save quotes of other chats
+	other := &models.Message{ID: 1, Chat: models.Chat{ID: -100999, Type: models.ChatTypeSupergroup}}
+	h.Press(other, "bookmark:save:"+fmt.Sprint(quote.ID))
+	assert.Equal(t, "This quote no longer exists.", h.Requests("answerCallbackQuery")[1].Params["text"])
+
+	// /saved only lists them in private
+	h.SendText(-100123, "/saved")
+	assert.Equal(t, "Send /saved to me in a private chat.", h.LastReply())
+
+	private := models.Chat{ID: h.User.ID, Type: models.ChatTypePrivate}
+	require.NoError(t, h.Send(&models.Message{ID: 900, From: h.User, Chat: private, Text: "/saved"}))
+	assert.Equal(t, "⭐ Your saved quotes (1):\n\n#"+fmt.Sprint(quote.ID)+" Bob: to keep", h.LastReply())
+	assert.Contains(t, h.Requests("sendMessage")[2].Params["reply_markup"], "bookmark:remove:"+fmt.Sprint(quote.ID))
+	// The quote has no message link, its chat's invite link opens it instead
+	assert.Contains(t, h.Requests("sendMessage")[2].Params["reply_markup"], "https://t.me/+invite100123")
+	require.Len(t, h.Requests("createChatInviteLink"), 1)
+
+	// Removing one updates the list
+	h.Press(&models.Message{ID: 901, Chat: private}, "bookmark:remove:"+fmt.Sprint(quote.ID))
+	edits := h.Requests("editMessageText")
+	require.Len(t, edits, 1)
+	assert.Contains(t, edits[0].Params["text"], "You have no saved quotes.")
+
+	// Taking the star back removes the bookmark too
+	react("", "⭐")
+	react("⭐", "")
+	count, err = saved.bookmarks.Count(ctx, h.User.ID)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
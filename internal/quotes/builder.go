@@ -2,77 +2,119 @@ package quotes
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
 
-	"gorm.io/datatypes"
+	"github.com/graffic/wanon-go/internal/cache"
+	"github.com/graffic/wanon-go/internal/message"
 	"gorm.io/gorm"
 )
 
-// CacheEntry represents a cached message for building quotes
-type CacheEntry struct {
-	ID        uint           `gorm:"primaryKey"`
-	ChatID    int64          `gorm:"index;not null"`
-	MessageID int64          `gorm:"index;not null"`
-	ReplyID   *int64         // Pointer to allow NULL
-	Date      int64          `gorm:"not null"`
-	Message   datatypes.JSON `gorm:"type:jsonb;not null"`
-}
-
-// TableName specifies the table name for CacheEntry
-func (CacheEntry) TableName() string {
-	return "cache_entry"
-}
+// CacheEntry is a cached message quotes are built from
+type CacheEntry = cache.CacheEntry
 
 // Builder builds quote threads from cache entries by following reply chains
 type Builder struct {
-	db *gorm.DB
+	db       *gorm.DB
+	cache    *cache.Service
+	maxDepth int
+	stats    *BuildStats
 }
 
-// NewBuilder creates a new quote builder
+// NewBuilder creates a new quote builder following up to
+// cache.DefaultMaxChainDepth messages
 func NewBuilder(db *gorm.DB) *Builder {
-	return &Builder{db: db}
+	return &Builder{db: db, cache: cache.NewService(db), maxDepth: cache.DefaultMaxChainDepth, stats: NewBuildStats()}
+}
+
+// WithStats counts the threads built in stats, shared with the metrics and
+// /cachestats
+func (b *Builder) WithStats(stats *BuildStats) *Builder {
+	b.stats = stats
+	return b
+}
+
+// WithMaxDepth sets the most messages of a reply chain followed. Longer
+// threads keep their newest messages.
+func (b *Builder) WithMaxDepth(depth int) *Builder {
+	b.maxDepth = depth
+	return b
 }
 
 // BuildResult contains the built quote entries and metadata
 type BuildResult struct {
 	Entries []CacheEntry
 	ChatID  int64
+	// End tells why the reply chain stopped, cache.ChainMaxDepth when older
+	// messages were left out
+	End cache.ChainEnd
+}
+
+// Partial reports whether older messages of the thread were left out for
+// the maximum depth
+func (r *BuildResult) Partial() bool {
+	return r.End == cache.ChainMaxDepth
+}
+
+// BuildOptions tunes how quote threads are built
+type BuildOptions struct {
+	// SkipBots leaves out messages written by bots or sent via inline bots.
+	// The reply chain is still followed through them.
+	SkipBots bool
+	// SkipAnonymousAdmins leaves out messages sent as the group itself
+	SkipAnonymousAdmins bool
+	// SkipOwn leaves out the messages the bot sent itself, such as posted
+	// quotes, so quotes do not quote the bot. The message quoted is kept,
+	// and the reply chain is still followed through them.
+	SkipOwn bool
+	// LinkedChats are the chats whose cache forwarded messages are looked up
+	// in. A forwarded message found there is replaced by its original and
+	// the chain goes on with the replies of the origin chat.
+	LinkedChats []int64
 }
 
 // BuildFrom builds a quote thread starting from a message ID by recursively
 // following reply chains through the cache.
 // This ports the Quotes.Builder.build_from functionality from Elixir.
 func (b *Builder) BuildFrom(ctx context.Context, chatID int64, messageID int64) (*BuildResult, error) {
-	var entries []CacheEntry
-	currentID := messageID
-
-	// Recursively follow reply chains
-	for currentID != 0 {
-		var entry CacheEntry
-		err := b.db.WithContext(ctx).
-			Where("chat_id = ? AND message_id = ?", chatID, currentID).
-			First(&entry).Error
-
-		if err != nil {
-			if err == gorm.ErrRecordNotFound {
-				// Message not in cache, stop building
-				break
-			}
-			return nil, fmt.Errorf("failed to fetch cache entry: %w", err)
-		}
-
-		// Prepend entry (we're building from newest to oldest, but want oldest first)
-		entries = append([]CacheEntry{entry}, entries...)
+	return b.BuildFromWithOptions(ctx, chatID, messageID, BuildOptions{})
+}
 
-		// Follow reply chain
-		if entry.ReplyID != nil && *entry.ReplyID != 0 {
-			currentID = *entry.ReplyID
-		} else {
-			break
+// BuildFromWithOptions builds a quote thread like BuildFrom, applying opts
+func (b *Builder) BuildFromWithOptions(ctx context.Context, chatID int64, messageID int64, opts BuildOptions) (*BuildResult, error) {
+	chainOpts := cache.ChainOptions{
+		MaxDepth: b.maxDepth,
+		// A channel post forwarded to its discussion group is the root of
+		// its comment thread
+		Root: IsAutomaticForward,
+	}
+	// A forward of a message cached in a linked chat continues there
+	if len(opts.LinkedChats) > 0 {
+		chainOpts.Resolve = func(ctx context.Context, entry CacheEntry) (CacheEntry, error) {
+			origin, err := b.forwardOrigin(ctx, entry, opts.LinkedChats)
+			if err != nil || origin == nil {
+				return entry, err
+			}
+			return *origin, nil
 		}
 	}
+	chain, err := b.cache.Chain(ctx, chatID, messageID, chainOpts)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain.Entries) > 0 {
+		b.stats.record(chain.End)
+	}
+	if chain.End == cache.ChainMaxDepth || chain.End == cache.ChainCycle {
+		slog.Warn("reply chain cut short", "chat_id", chatID, "message_id", messageID, "end", chain.End, "messages", len(chain.Entries))
+	}
 
+	entries, err := filterEntries(chain.Entries, opts)
+	if err != nil {
+		return nil, err
+	}
 	if len(entries) == 0 {
 		return nil, fmt.Errorf("no cache entries found for message %d in chat %d", messageID, chatID)
 	}
@@ -80,9 +122,146 @@ func (b *Builder) BuildFrom(ctx context.Context, chatID int64, messageID int64)
 	return &BuildResult{
 		Entries: entries,
 		ChatID:  chatID,
+		End:     chain.End,
 	}, nil
 }
 
+// BuildRange builds a quote from a message and the count cached messages of
+// its chat right before it, whether they reply to each other or not. The
+// message itself must be cached. Fewer messages are quoted when fewer are
+// cached, reported as cache.ChainMissing, and at most the maximum depth,
+// reported as cache.ChainMaxDepth.
+func (b *Builder) BuildRange(ctx context.Context, chatID int64, messageID int64, count int) (*BuildResult, error) {
+	return b.BuildRangeWithOptions(ctx, chatID, messageID, count, BuildOptions{})
+}
+
+// BuildRangeWithOptions builds a quote like BuildRange, leaving out messages
+// as opts says. Left out messages still count towards count, and forwards
+// are quoted as they are, not followed into linked chats.
+func (b *Builder) BuildRangeWithOptions(ctx context.Context, chatID int64, messageID int64, count int, opts BuildOptions) (*BuildResult, error) {
+	end := cache.ChainRoot
+	if count+1 > b.maxDepth {
+		count = b.maxDepth - 1
+		end = cache.ChainMaxDepth
+	}
+
+	var rows []CacheEntry
+	err := b.db.WithContext(ctx).
+		Where("chat_id = ? AND message_id <= ?", chatID, messageID).
+		Order("message_id DESC").
+		Limit(count + 1).
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached messages: %w", err)
+	}
+	if len(rows) == 0 || rows[0].MessageID != messageID {
+		return nil, fmt.Errorf("no cache entry found for message %d in chat %d", messageID, chatID)
+	}
+	if len(rows) < count+1 && end == cache.ChainRoot {
+		end = cache.ChainMissing
+	}
+	slices.Reverse(rows)
+	b.stats.record(end)
+
+	entries, err := filterEntries(rows, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &BuildResult{
+		Entries: entries,
+		ChatID:  chatID,
+		End:     end,
+	}, nil
+}
+
+// filterEntries leaves out the messages the chat does not want quoted. The
+// last of all is the message quoted. It returns why when that leaves none.
+func filterEntries(all []CacheEntry, opts BuildOptions) ([]CacheEntry, error) {
+	var entries []CacheEntry
+	var skipped error // Why a message was left out, if any
+	for i, entry := range all {
+		switch {
+		case opts.SkipOwn && entry.Outgoing && i < len(all)-1:
+			// Never all of them, the message quoted is kept
+		case opts.SkipBots && IsBotEntry(entry):
+			skipped = ErrOnlyBotMessages
+		case opts.SkipAnonymousAdmins && IsAnonymousAdminEntry(entry):
+			skipped = ErrOnlyAnonymousAdmins
+		default:
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 && skipped != nil {
+		return nil, skipped
+	}
+	return entries, nil
+}
+
+// forwardOrigin finds the original of a forwarded message in the cache of
+// the linked chats. Telegram only gives the original message ID of channel
+// posts; other forwards are matched by their sender and date, and only
+// when that points to a single message. It returns nil when the entry is
+// not a forward or its original is not cached.
+func (b *Builder) forwardOrigin(ctx context.Context, entry CacheEntry, linked []int64) (*CacheEntry, error) {
+	msg, err := message.Parse(entry.Message)
+	if err != nil || msg.ForwardOrigin == nil {
+		return nil, nil
+	}
+	origin := msg.ForwardOrigin
+
+	query := b.db.WithContext(ctx).Where("chat_id IN ?", linked)
+	switch {
+	case origin.Chat != nil && origin.MessageID != 0:
+		query = query.Where("chat_id = ? AND message_id = ?", origin.Chat.ID, origin.MessageID)
+	case origin.SenderChat != nil:
+		query = query.Where("date = ? AND (message->'sender_chat'->>'id')::bigint = ?", origin.Date, origin.SenderChat.ID)
+	case origin.SenderUser != nil:
+		query = query.Where("date = ? AND (message->'from'->>'id')::bigint = ?", origin.Date, origin.SenderUser.ID)
+	default:
+		// Hidden users cannot be told apart
+		return nil, nil
+	}
+
+	var found []CacheEntry
+	if err := query.Limit(2).Find(&found).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch forward origin: %w", err)
+	}
+	if len(found) != 1 {
+		return nil, nil
+	}
+	return &found[0], nil
+}
+
+// ErrOnlyBotMessages is returned when every message of a thread was skipped
+// for being written by a bot
+var ErrOnlyBotMessages = errors.New("the thread only has bot messages")
+
+// ErrOnlyAnonymousAdmins is returned when every message of a thread was
+// skipped for being sent by an anonymous admin
+var ErrOnlyAnonymousAdmins = errors.New("the thread only has anonymous admin messages")
+
+// IsBotEntry reports whether a cached message was written by a bot or sent
+// via an inline bot. Messages sent on behalf of a chat come from a bot
+// account but are not counted.
+func IsBotEntry(entry CacheEntry) bool {
+	msg, err := message.Parse(entry.Message)
+	return err == nil && msg.IsBot()
+}
+
+// IsAnonymousAdminEntry reports whether a cached message was sent by an
+// anonymous admin, that is on behalf of the chat itself
+func IsAnonymousAdminEntry(entry CacheEntry) bool {
+	msg, err := message.Parse(entry.Message)
+	return err == nil && msg.IsAnonymousAdmin()
+}
+
+// IsAutomaticForward reports whether a cached message is a channel post
+// forwarded to the linked discussion group
+func IsAutomaticForward(entry CacheEntry) bool {
+	msg, err := message.Parse(entry.Message)
+	return err == nil && msg.IsAutomaticForward
+}
+
 // BuildFromMessage builds a quote from a Telegram message structure directly
 // This is used when we have the message but need to build the full thread
 func (b *Builder) BuildFromMessage(ctx context.Context, chatID int64, messageID int64, replyToMessageID *int64) (*BuildResult, error) {
@@ -100,20 +279,10 @@ func (b *Builder) BuildFromMessage(ctx context.Context, chatID int64, messageID
 	return nil, err
 }
 
-// ExtractMessage extracts the message map from a cache entry's JSON
-type MessageData struct {
-	MessageID int64                  `json:"message_id"`
-	From      map[string]interface{} `json:"from"`
-	Date      int64                  `json:"date"`
-	Text      string                 `json:"text"`
-	Chat      map[string]interface{} `json:"chat"`
-}
+// MessageData is the message stored in a cache or quote entry
+type MessageData = message.Message
 
 // ExtractMessageData extracts message data from a cache entry
 func ExtractMessageData(entry CacheEntry) (*MessageData, error) {
-	var data MessageData
-	if err := json.Unmarshal(entry.Message, &data); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
-	}
-	return &data, nil
+	return message.Parse(entry.Message)
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/graffic/wanon-go/internal/cache"
 	"github.com/graffic/wanon-go/internal/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -17,7 +18,7 @@ func TestBuilder_BuildFrom_NoCacheEntries(t *testing.T) {
 
 	// Try to build from a message that doesn't exist in cache
 	result, err := builder.BuildFrom(context.Background(), -100123, 999)
-	
+
 	// Should return an error since no cache entries found
 	require.Error(t, err)
 	assert.Nil(t, result)
@@ -155,12 +156,15 @@ func TestBuilder_BuildFrom_PartialCache(t *testing.T) {
 	}
 	require.NoError(t, db.DB.Create(&cacheEntry2).Error)
 
-	builder := NewBuilder(db.DB)
+	stats := NewBuildStats()
+	builder := NewBuilder(db.DB).WithStats(stats)
 	result, err := builder.BuildFrom(context.Background(), -100123, 2)
 	require.NoError(t, err)
 	assert.NotNil(t, result)
 	// Should only have the cached entry (msg1 not in cache)
 	assert.Len(t, result.Entries, 1)
+	counts, _ := stats.Counts()
+	assert.Equal(t, BuildCounts{Partial: 1}, counts)
 
 	var msgData MessageData
 	err = json.Unmarshal(result.Entries[0].Message, &msgData)
@@ -190,7 +194,7 @@ func TestBuilder_BuildFrom_DifferentChat(t *testing.T) {
 	builder := NewBuilder(db.DB)
 	// Try to build from different chat
 	result, err := builder.BuildFrom(context.Background(), -100123, 5)
-	
+
 	// Should return error since message not found in this chat
 	require.Error(t, err)
 	assert.Nil(t, result)
@@ -231,7 +235,7 @@ func TestBuilder_BuildFromMessage_NotInCache(t *testing.T) {
 	builder := NewBuilder(db.DB)
 	// Message not in cache, no reply to follow
 	result, err := builder.BuildFromMessage(context.Background(), -100123, 10, nil)
-	
+
 	require.Error(t, err)
 	assert.Nil(t, result)
 	assert.Contains(t, err.Error(), "no cache entries found")
@@ -256,3 +260,264 @@ func TestExtractMessageData(t *testing.T) {
 	assert.Equal(t, "Hello", data.Text)
 	assert.Equal(t, int64(1609459100), data.Date)
 }
+
+func TestIsBotEntry(t *testing.T) {
+	assert.False(t, IsBotEntry(CacheEntry{Message: datatypes.JSON(`{"text":"hi","from":{"id":1}}`)}))
+	assert.True(t, IsBotEntry(CacheEntry{Message: datatypes.JSON(`{"text":"hi","from":{"id":1,"is_bot":true}}`)}))
+	assert.True(t, IsBotEntry(CacheEntry{Message: datatypes.JSON(`{"text":"hi","from":{"id":1},"via_bot":{"id":2}}`)}))
+	assert.False(t, IsBotEntry(CacheEntry{Message: datatypes.JSON(`not json`)}))
+	// Anonymous admins post through a bot account
+	assert.False(t, IsBotEntry(CacheEntry{Message: datatypes.JSON(`{"text":"hi","from":{"id":1087968824,"is_bot":true},"sender_chat":{"id":-100123}}`)}))
+}
+
+func TestIsAnonymousAdminEntry(t *testing.T) {
+	assert.True(t, IsAnonymousAdminEntry(CacheEntry{Message: datatypes.JSON(`{"text":"hi","chat":{"id":-100123},"sender_chat":{"id":-100123}}`)}))
+	assert.False(t, IsAnonymousAdminEntry(CacheEntry{Message: datatypes.JSON(`{"text":"hi","chat":{"id":-100123},"sender_chat":{"id":-100555}}`)}))
+	assert.False(t, IsAnonymousAdminEntry(CacheEntry{Message: datatypes.JSON(`{"text":"hi","chat":{"id":-100123},"from":{"id":1}}`)}))
+	assert.False(t, IsAnonymousAdminEntry(CacheEntry{Message: datatypes.JSON(`not json`)}))
+}
+
+func TestBuilder_BuildFromWithOptions_SkipBots(t *testing.T) {
+	db := testutils.NewTestDB(t)
+
+	// Chain: human (1) <- bot (2) <- human (3)
+	messages := []struct {
+		id      int64
+		replyTo *int64
+		json    string
+	}{
+		{1, nil, `{"message_id":1,"text":"/weather","from":{"id":1,"first_name":"Alice"}}`},
+		{2, ptr(int64(1)), `{"message_id":2,"text":"Sunny","from":{"id":9,"first_name":"WeatherBot","is_bot":true}}`},
+		{3, ptr(int64(2)), `{"message_id":3,"text":"told you","from":{"id":1,"first_name":"Alice"}}`},
+		{4, nil, `{"message_id":4,"text":"Daily forecast","from":{"id":9,"first_name":"WeatherBot","is_bot":true}}`},
+	}
+	for _, m := range messages {
+		require.NoError(t, db.DB.Create(&CacheEntry{
+			ChatID:    -100123,
+			MessageID: m.id,
+			ReplyID:   m.replyTo,
+			Date:      1609459000,
+			Message:   datatypes.JSON(m.json),
+		}).Error)
+	}
+	builder := NewBuilder(db.DB)
+
+	// Without the option every message is kept
+	result, err := builder.BuildFrom(context.Background(), -100123, 3)
+	require.NoError(t, err)
+	assert.Len(t, result.Entries, 3)
+
+	// Skipping bots keeps following the chain through them
+	result, err = builder.BuildFromWithOptions(context.Background(), -100123, 3, BuildOptions{SkipBots: true})
+	require.NoError(t, err)
+	require.Len(t, result.Entries, 2)
+	assert.Equal(t, int64(1), result.Entries[0].MessageID)
+	assert.Equal(t, int64(3), result.Entries[1].MessageID)
+
+	// A thread of bot messages only cannot be quoted
+	_, err = builder.BuildFromWithOptions(context.Background(), -100123, 4, BuildOptions{SkipBots: true})
+	assert.ErrorIs(t, err, ErrOnlyBotMessages)
+}
+
+func TestFilterEntries_SkipOwn(t *testing.T) {
+	// A quote posted by the bot (2) answered twice
+	all := []CacheEntry{
+		{MessageID: 1, Message: datatypes.JSON(`{"text":"/rquote","from":{"id":1}}`)},
+		{MessageID: 2, Outgoing: true, Message: datatypes.JSON(`{"text":"#5 Bob: hi","from":{"id":99,"is_bot":true}}`)},
+		{MessageID: 3, Message: datatypes.JSON(`{"text":"classic","from":{"id":1}}`)},
+	}
+
+	entries, err := filterEntries(all, BuildOptions{})
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	entries, err = filterEntries(all, BuildOptions{SkipOwn: true})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(1), entries[0].MessageID)
+	assert.Equal(t, int64(3), entries[1].MessageID)
+
+	// The message quoted is kept even when the bot sent it
+	entries, err = filterEntries(all[:2], BuildOptions{SkipOwn: true})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.True(t, entries[1].Outgoing)
+}
+
+func TestIsAutomaticForward(t *testing.T) {
+	assert.True(t, IsAutomaticForward(CacheEntry{Message: datatypes.JSON(`{"text":"post","is_automatic_forward":true}`)}))
+	assert.False(t, IsAutomaticForward(CacheEntry{Message: datatypes.JSON(`{"text":"hi","from":{"id":1}}`)}))
+	assert.False(t, IsAutomaticForward(CacheEntry{Message: datatypes.JSON(`not json`)}))
+}
+
+func TestBuilder_BuildFromWithOptions_SkipAnonymousAdmins(t *testing.T) {
+	db := testutils.NewTestDB(t)
+
+	// Chain: anonymous admin (1) <- human (2); anonymous admin (3) alone
+	messages := []struct {
+		id      int64
+		replyTo *int64
+		json    string
+	}{
+		{1, nil, `{"message_id":1,"text":"Rules updated","chat":{"id":-100123},"from":{"id":1087968824,"is_bot":true},"sender_chat":{"id":-100123,"title":"Club"}}`},
+		{2, ptr(int64(1)), `{"message_id":2,"text":"who wrote this?","chat":{"id":-100123},"from":{"id":1,"first_name":"Alice"}}`},
+		{3, nil, `{"message_id":3,"text":"Be nice","chat":{"id":-100123},"from":{"id":1087968824,"is_bot":true},"sender_chat":{"id":-100123,"title":"Club"}}`},
+	}
+	for _, m := range messages {
+		require.NoError(t, db.DB.Create(&CacheEntry{
+			ChatID:    -100123,
+			MessageID: m.id,
+			ReplyID:   m.replyTo,
+			Date:      1609459000,
+			Message:   datatypes.JSON(m.json),
+		}).Error)
+	}
+	builder := NewBuilder(db.DB)
+	opts := BuildOptions{SkipAnonymousAdmins: true}
+
+	result, err := builder.BuildFromWithOptions(context.Background(), -100123, 2, opts)
+	require.NoError(t, err)
+	require.Len(t, result.Entries, 1)
+	assert.Equal(t, int64(2), result.Entries[0].MessageID)
+
+	_, err = builder.BuildFromWithOptions(context.Background(), -100123, 3, opts)
+	assert.ErrorIs(t, err, ErrOnlyAnonymousAdmins)
+
+	// Anonymous admins are not bots
+	result, err = builder.BuildFromWithOptions(context.Background(), -100123, 3, BuildOptions{SkipBots: true})
+	require.NoError(t, err)
+	assert.Len(t, result.Entries, 1)
+}
+
+func TestBuilder_BuildFrom_LinkedChannelRoot(t *testing.T) {
+	db := testutils.NewTestDB(t)
+
+	// Chain: unrelated (1) <- channel post (2) <- comment (3) <- reply (4)
+	messages := []struct {
+		id      int64
+		replyTo *int64
+		json    string
+	}{
+		{1, nil, `{"message_id":1,"text":"earlier","from":{"id":1,"first_name":"Alice"}}`},
+		{2, ptr(int64(1)), `{"message_id":2,"text":"New episode","from":{"id":777000,"first_name":"Telegram"},"sender_chat":{"id":-100555,"type":"channel","title":"News"},"is_automatic_forward":true}`},
+		{3, ptr(int64(2)), `{"message_id":3,"text":"finally","from":{"id":1,"first_name":"Alice"}}`},
+		{4, ptr(int64(3)), `{"message_id":4,"text":"right?","from":{"id":2,"first_name":"Bob"}}`},
+	}
+	for _, m := range messages {
+		require.NoError(t, db.DB.Create(&CacheEntry{
+			ChatID:    -100123,
+			MessageID: m.id,
+			ReplyID:   m.replyTo,
+			Date:      1609459000,
+			Message:   datatypes.JSON(m.json),
+		}).Error)
+	}
+
+	// The thread stops at the channel post
+	result, err := NewBuilder(db.DB).BuildFrom(context.Background(), -100123, 4)
+	require.NoError(t, err)
+	require.Len(t, result.Entries, 3)
+	assert.Equal(t, int64(2), result.Entries[0].MessageID)
+	assert.Equal(t, int64(4), result.Entries[2].MessageID)
+}
+
+func TestBuilder_BuildFromWithOptions_LinkedChats(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	cache := func(chatID, id int64, replyTo *int64, date int64, json string) {
+		require.NoError(t, db.DB.Create(&CacheEntry{
+			ChatID: chatID, MessageID: id, ReplyID: replyTo, Date: date, Message: datatypes.JSON(json),
+		}).Error)
+	}
+
+	// In -100456: question (10) <- answer (11)
+	cache(-100456, 10, nil, 1609459000, `{"message_id":10,"chat":{"id":-100456,"type":"supergroup"},"date":1609459000,"text":"why?","from":{"id":1,"first_name":"Alice"}}`)
+	cache(-100456, 11, ptr(int64(10)), 1609459100, `{"message_id":11,"chat":{"id":-100456,"type":"supergroup"},"date":1609459100,"text":"because","from":{"id":2,"first_name":"Bob"}}`)
+	// In -100123: the answer forwarded (5) <- a reply to it (6)
+	cache(-100123, 5, nil, 1609459200, `{"message_id":5,"chat":{"id":-100123,"type":"supergroup"},"date":1609459200,"text":"because","from":{"id":3,"first_name":"Carol"},"forward_origin":{"type":"user","date":1609459100,"sender_user":{"id":2,"first_name":"Bob"}}}`)
+	cache(-100123, 6, ptr(int64(5)), 1609459300, `{"message_id":6,"chat":{"id":-100123,"type":"supergroup"},"date":1609459300,"text":"fair","from":{"id":3,"first_name":"Carol"}}`)
+
+	builder := NewBuilder(db.DB)
+
+	// Without linked chats the thread stops at the forwarded copy
+	result, err := builder.BuildFrom(context.Background(), -100123, 6)
+	require.NoError(t, err)
+	require.Len(t, result.Entries, 2)
+	assert.Equal(t, int64(-100123), result.Entries[0].ChatID)
+
+	// With the origin chat linked the thread goes on there
+	result, err = builder.BuildFromWithOptions(context.Background(), -100123, 6, BuildOptions{LinkedChats: []int64{-100456}})
+	require.NoError(t, err)
+	require.Len(t, result.Entries, 3)
+	assert.Equal(t, int64(-100123), result.ChatID)
+	assert.Equal(t, [2]int64{-100456, 10}, [2]int64{result.Entries[0].ChatID, result.Entries[0].MessageID})
+	assert.Equal(t, [2]int64{-100456, 11}, [2]int64{result.Entries[1].ChatID, result.Entries[1].MessageID})
+	assert.Equal(t, [2]int64{-100123, 6}, [2]int64{result.Entries[2].ChatID, result.Entries[2].MessageID})
+}
+
+// ptr returns a pointer to v
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestBuilder_BuildFrom_MaxDepth(t *testing.T) {
+	db := testutils.NewTestDB(t)
+
+	for id := int64(1); id <= 4; id++ {
+		entry := CacheEntry{ChatID: -100123, MessageID: id, Date: 1609459000 + id, Message: datatypes.JSON(`{"text":"hi"}`)}
+		if id > 1 {
+			reply := id - 1
+			entry.ReplyID = &reply
+		}
+		require.NoError(t, db.DB.Create(&entry).Error)
+	}
+
+	result, err := NewBuilder(db.DB).WithMaxDepth(2).BuildFrom(context.Background(), -100123, 4)
+	require.NoError(t, err)
+	require.Len(t, result.Entries, 2)
+	assert.Equal(t, int64(3), result.Entries[0].MessageID)
+	assert.Equal(t, cache.ChainMaxDepth, result.End)
+	assert.True(t, result.Partial())
+
+	result, err = NewBuilder(db.DB).BuildFrom(context.Background(), -100123, 4)
+	require.NoError(t, err)
+	assert.Len(t, result.Entries, 4)
+	assert.False(t, result.Partial())
+}
+
+func TestBuilder_BuildRange(t *testing.T) {
+	db := testutils.NewTestDB(t)
+
+	// Messages 1, 2, 4 and 5 are cached, none replying to another
+	for _, id := range []int64{1, 2, 4, 5} {
+		entry := CacheEntry{ChatID: -100123, MessageID: id, Date: 1609459000 + id, Message: datatypes.JSON(`{"text":"hi"}`)}
+		require.NoError(t, db.DB.Create(&entry).Error)
+	}
+	other := CacheEntry{ChatID: -100456, MessageID: 3, Date: 1609459003, Message: datatypes.JSON(`{"text":"elsewhere"}`)}
+	require.NoError(t, db.DB.Create(&other).Error)
+
+	ids := func(result *BuildResult) []int64 {
+		var ids []int64
+		for _, entry := range result.Entries {
+			ids = append(ids, entry.MessageID)
+		}
+		return ids
+	}
+
+	result, err := NewBuilder(db.DB).BuildRange(context.Background(), -100123, 5, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 4, 5}, ids(result))
+	assert.Equal(t, cache.ChainRoot, result.End)
+
+	result, err = NewBuilder(db.DB).BuildRange(context.Background(), -100123, 4, 5)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 4}, ids(result))
+	assert.Equal(t, cache.ChainMissing, result.End)
+
+	result, err = NewBuilder(db.DB).WithMaxDepth(2).BuildRange(context.Background(), -100123, 5, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4, 5}, ids(result))
+	assert.True(t, result.Partial())
+
+	_, err = NewBuilder(db.DB).BuildRange(context.Background(), -100123, 3, 2)
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+package quotes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/cache"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"gorm.io/gorm"
+)
+
+// BuildCounts are the quotes built since the counting started, by how much
+// of their thread the cache had
+type BuildCounts struct {
+	// Full threads were followed to their root
+	Full uint64
+	// Partial threads stopped at a message no longer cached, usually
+	// because it expired
+	Partial uint64
+	// Truncated threads were cut at the maximum depth
+	Truncated uint64
+	// Fallback quotes were built from the replied message alone, as it was
+	// not cached
+	Fallback uint64
+}
+
+// Total returns the number of quotes built
+func (c BuildCounts) Total() uint64 {
+	return c.Full + c.Partial + c.Truncated + c.Fallback
+}
+
+// Incomplete returns the share of quotes built from an incomplete cache,
+// partial threads and fallbacks, or 0 before any was built
+func (c BuildCounts) Incomplete() float64 {
+	if c.Total() == 0 {
+		return 0
+	}
+	return float64(c.Partial+c.Fallback) / float64(c.Total())
+}
+
+// BuildStats counts how often quotes are built from an incomplete cache,
+// to tune the cache retention
+type BuildStats struct {
+	mu     sync.Mutex
+	since  time.Time
+	counts BuildCounts
+}
+
+// NewBuildStats starts counting quote builds
+func NewBuildStats() *BuildStats {
+	return &BuildStats{since: time.Now()}
+}
+
+// record counts a thread read from the cache by why its chain stopped. A
+// cycle repeats messages already in the thread, so nothing is missing.
+func (s *BuildStats) record(end cache.ChainEnd) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch end {
+	case cache.ChainMissing:
+		s.counts.Partial++
+	case cache.ChainMaxDepth:
+		s.counts.Truncated++
+	default:
+		s.counts.Full++
+	}
+}
+
+// fallback counts a quote built from the replied message alone
+func (s *BuildStats) fallback() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts.Fallback++
+}
+
+// Counts returns the counts so far and when the counting started
+func (s *BuildStats) Counts() (BuildCounts, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts, s.since
+}
+
+// WritePrometheus writes the quote builds in the Prometheus text format
+func (s *BuildStats) WritePrometheus(w io.Writer) error {
+	counts, _ := s.Counts()
+	var sb strings.Builder
+	sb.WriteString("# HELP wanon_quote_builds_total Quotes built by how much of their thread was cached.\n" +
+		"# TYPE wanon_quote_builds_total counter\n")
+	fmt.Fprintf(&sb, "wanon_quote_builds_total{result=\"full\"} %d\n", counts.Full)
+	fmt.Fprintf(&sb, "wanon_quote_builds_total{result=\"partial\"} %d\n", counts.Partial)
+	fmt.Fprintf(&sb, "wanon_quote_builds_total{result=\"truncated\"} %d\n", counts.Truncated)
+	fmt.Fprintf(&sb, "wanon_quote_builds_total{result=\"fallback\"} %d\n", counts.Fallback)
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// CacheStatsHandler handles the /cachestats command
+type CacheStatsHandler struct {
+	stats  *BuildStats
+	outbox *outbox.Outbox
+	owners map[int64]bool
+}
+
+// NewCacheStatsHandler creates a /cachestats handler answering only the
+// given owners
+func NewCacheStatsHandler(db *gorm.DB, stats *BuildStats, ownerIDs []int64) *CacheStatsHandler {
+	owners := make(map[int64]bool, len(ownerIDs))
+	for _, id := range ownerIDs {
+		owners[id] = true
+	}
+	return &CacheStatsHandler{stats: stats, outbox: outbox.New(db), owners: owners}
+}
+
+// Handle replies with how the quotes were built since the bot started.
+// Commands from anyone but the owners are ignored.
+func (h *CacheStatsHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	if !h.owners[msg.From.ID] {
+		slog.Info("ignoring /cachestats from non-owner", "audit", true, "chat_id", msg.Chat.ID, "user_id", msg.From.ID)
+		return nil
+	}
+	_, err := h.outbox.Send(ctx, b, &outbox.Message{ChatID: msg.Chat.ID, Text: cacheStatsReport(h.stats)})
+	return err
+}
+
+// cacheStatsReport describes the quote builds of a replica
+func cacheStatsReport(stats *BuildStats) string {
+	counts, since := stats.Counts()
+	if counts.Total() == 0 {
+		return fmt.Sprintf("No quotes were built since %s.", since.UTC().Format("2006-01-02 15:04 MST"))
+	}
+	share := func(n uint64) string {
+		return fmt.Sprintf("%d (%.0f%%)", n, 100*float64(n)/float64(counts.Total()))
+	}
+	lines := []string{
+		fmt.Sprintf("📊 %d quote(s) built since %s:", counts.Total(), since.UTC().Format("2006-01-02 15:04 MST")),
+		"Full threads: " + share(counts.Full),
+		"Partial threads, older messages not cached: " + share(counts.Partial),
+		"Threads cut at the maximum depth: " + share(counts.Truncated),
+		"Only the replied message, not cached: " + share(counts.Fallback),
+		fmt.Sprintf("%.0f%% were built from an incomplete cache; a longer cache.keep_duration lowers it.", 100*counts.Incomplete()),
+		"Counted by this bot replica since it started.",
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Command returns the command name
+func (h *CacheStatsHandler) Command() string {
+	return "/cachestats"
+}
+
+// Description returns the command description
+func (h *CacheStatsHandler) Description() string {
+	return "Show how often quotes are built from an incomplete cache (owners only)"
+}
@@ -0,0 +1,64 @@
+package quotes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildStats_Counts(t *testing.T) {
+	stats := NewBuildStats()
+	stats.record(cache.ChainRoot)
+	stats.record(cache.ChainCycle)
+	stats.record(cache.ChainMissing)
+	stats.record(cache.ChainMaxDepth)
+	stats.fallback()
+
+	counts, since := stats.Counts()
+	assert.Equal(t, BuildCounts{Full: 2, Partial: 1, Truncated: 1, Fallback: 1}, counts)
+	assert.False(t, since.IsZero())
+	assert.Equal(t, uint64(5), counts.Total())
+	assert.InDelta(t, 0.4, counts.Incomplete(), 0.001)
+	assert.Zero(t, BuildCounts{}.Incomplete())
+}
+
+func TestBuildStats_WritePrometheus(t *testing.T) {
+	stats := NewBuildStats()
+	stats.record(cache.ChainRoot)
+	stats.fallback()
+	stats.fallback()
+
+	var sb strings.Builder
+	require.NoError(t, stats.WritePrometheus(&sb))
+	out := sb.String()
+	assert.Contains(t, out, "# TYPE wanon_quote_builds_total counter")
+	assert.Contains(t, out, `wanon_quote_builds_total{result="full"} 1`)
+	assert.Contains(t, out, `wanon_quote_builds_total{result="partial"} 0`)
+	assert.Contains(t, out, `wanon_quote_builds_total{result="truncated"} 0`)
+	assert.Contains(t, out, `wanon_quote_builds_total{result="fallback"} 2`)
+}
+
+func TestCacheStatsReport(t *testing.T) {
+	stats := NewBuildStats()
+	assert.Contains(t, cacheStatsReport(stats), "No quotes were built since")
+
+	stats.record(cache.ChainRoot)
+	stats.record(cache.ChainMissing)
+	stats.fallback()
+	stats.fallback()
+	report := cacheStatsReport(stats)
+	assert.Contains(t, report, "4 quote(s) built since")
+	assert.Contains(t, report, "Full threads: 1 (25%)")
+	assert.Contains(t, report, "Partial threads, older messages not cached: 1 (25%)")
+	assert.Contains(t, report, "Only the replied message, not cached: 2 (50%)")
+	assert.Contains(t, report, "75% were built from an incomplete cache")
+}
+
+func TestCacheStatsHandler_Command(t *testing.T) {
+	h := NewCacheStatsHandler(nil, NewBuildStats(), []int64{1})
+	assert.Equal(t, "/cachestats", h.Command())
+	assert.Contains(t, h.Description(), "owners only")
+}
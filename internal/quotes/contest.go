@@ -0,0 +1,701 @@
+package quotes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/settings"
+	"github.com/graffic/wanon-go/internal/storage"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"gorm.io/gorm"
+)
+
+// contestCallbackPrefix prefixes the callback data of the contest vote
+// buttons
+const contestCallbackPrefix = "quotecontest:"
+
+// Contest limits
+const (
+	minContestLength = time.Hour
+	maxContestLength = 30 * 24 * time.Hour
+	contestListed    = 10 // Entries listed in the standings
+	contestPreview   = 80 // UTF-16 code units of each listed quote
+)
+
+// Contest errors
+var (
+	ErrContestRunning  = errors.New("a quote contest is already running in this chat")
+	ErrContestOver     = errors.New("the quote contest is over")
+	ErrContestNotFound = errors.New("quote contest entry not found")
+	ErrOwnContestEntry = errors.New("users cannot vote for the quotes they entered")
+)
+
+// Contest is a time-boxed quote contest of a chat. Quotes added while it
+// runs are entered, and the most voted entries win.
+type Contest struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	ChatID     int64      `gorm:"not null" json:"chat_id"`
+	StartedBy  int64      `gorm:"not null" json:"started_by"`
+	MessageID  int        `gorm:"not null;default:0" json:"message_id"` // Announcement of the contest
+	EndsAt     time.Time  `gorm:"not null" json:"ends_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for Contest
+func (Contest) TableName() string {
+	return "quote_contest"
+}
+
+// ContestEntry is a quote entered in a contest
+type ContestEntry struct {
+	ContestID   uint      `gorm:"primaryKey" json:"contest_id"`
+	QuoteID     uint      `gorm:"primaryKey" json:"quote_id"`
+	SubmittedBy int64     `gorm:"not null" json:"submitted_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for ContestEntry
+func (ContestEntry) TableName() string {
+	return "quote_contest_entry"
+}
+
+// ContestVote is the vote of a user for a contest entry
+type ContestVote struct {
+	ContestID uint      `gorm:"primaryKey" json:"contest_id"`
+	QuoteID   uint      `gorm:"primaryKey" json:"quote_id"`
+	UserID    int64     `gorm:"primaryKey" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for ContestVote
+func (ContestVote) TableName() string {
+	return "quote_contest_vote"
+}
+
+// Standing is a contest entry with its votes
+type Standing struct {
+	QuoteID uint
+	Votes   int64
+	Quote   *Quote `gorm:"-"` // Loaded for the listed entries only
+}
+
+// ContestResult is the outcome of a finished contest
+type ContestResult struct {
+	Contest   Contest
+	Standings []Standing // Most voted first
+}
+
+// Winners returns the most voted entries, none if nobody voted
+func (r ContestResult) Winners() []uint {
+	var winners []uint
+	for _, standing := range r.Standings {
+		if standing.Votes == 0 || standing.Votes < r.Standings[0].Votes {
+			break
+		}
+		winners = append(winners, standing.QuoteID)
+	}
+	return winners
+}
+
+// String announces the result in the chat
+func (r ContestResult) String() string {
+	if len(r.Standings) == 0 {
+		return "🏁 The quote contest is over, but no quotes were entered."
+	}
+	entered := fmt.Sprintf("%d quotes were", len(r.Standings))
+	if len(r.Standings) == 1 {
+		entered = "1 quote was"
+	}
+	parts := []string{fmt.Sprintf("🏁 The quote contest is over! %s entered.", entered), standingsText(r.Standings)}
+
+	winners := r.Winners()
+	switch len(winners) {
+	case 0:
+		parts = append(parts, "Nobody voted, so there is no winner.")
+	case 1:
+		parts = append(parts, fmt.Sprintf("🏆 Quote #%d wins with %s!", winners[0], votes(r.Standings[0].Votes)))
+	default:
+		ids := make([]string, len(winners))
+		for i, id := range winners {
+			ids[i] = fmt.Sprintf("#%d", id)
+		}
+		list := strings.Join(ids[:len(ids)-1], ", ") + " and " + ids[len(ids)-1]
+		parts = append(parts, fmt.Sprintf("🏆 Quotes %s share the win with %s each!", list, votes(r.Standings[0].Votes)))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// standingMarks mark the first three entries of the standings
+var standingMarks = []string{"🥇", "🥈", "🥉"}
+
+// standingsText lists the first entries of the standings, one per line
+func standingsText(standings []Standing) string {
+	renderer := NewRenderer()
+	var lines []string
+	for i, standing := range standings {
+		if i == contestListed {
+			lines = append(lines, fmt.Sprintf("…and %d more.", len(standings)-contestListed))
+			break
+		}
+		mark := fmt.Sprintf("%d.", i+1)
+		if i < len(standingMarks) {
+			mark = standingMarks[i]
+		}
+		preview := "(deleted quote)"
+		if standing.Quote != nil {
+			preview = quotePreview(renderer, standing.Quote, contestPreview)
+		}
+		lines = append(lines, fmt.Sprintf("%s #%d %s — %s", mark, standing.QuoteID, preview, votes(standing.Votes)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Contests stores quote contests, their entries and votes
+type Contests struct {
+	db    *gorm.DB
+	clock clock.Clock
+}
+
+// NewContests creates a contest store
+func NewContests(db *gorm.DB) *Contests {
+	return &Contests{db: db, clock: clock.System{}}
+}
+
+// WithClock replaces the clock deciding when contests end
+func (c *Contests) WithClock(clk clock.Clock) *Contests {
+	c.clock = clk
+	return c
+}
+
+// In returns a copy of the store writing through a unit of work
+func (c *Contests) In(u *storage.Unit) *Contests {
+	return &Contests{db: u.DB(), clock: c.clock}
+}
+
+// Start opens a contest in a chat for length. Chats run one contest at a
+// time.
+func (c *Contests) Start(ctx context.Context, chatID, userID int64, length time.Duration) (*Contest, error) {
+	var running int64
+	if err := c.db.WithContext(ctx).Model(&Contest{}).
+		Where("chat_id = ? AND finished_at IS NULL", chatID).
+		Count(&running).Error; err != nil {
+		return nil, fmt.Errorf("failed to look for running contests: %w", err)
+	}
+	if running > 0 {
+		return nil, ErrContestRunning
+	}
+
+	contest := &Contest{ChatID: chatID, StartedBy: userID, EndsAt: c.clock.Now().Add(length)}
+	if err := c.db.WithContext(ctx).Create(contest).Error; err != nil {
+		return nil, fmt.Errorf("failed to create contest: %w", err)
+	}
+	return contest, nil
+}
+
+// SetMessage records the announcement of a contest
+func (c *Contests) SetMessage(ctx context.Context, contest *Contest, messageID int) error {
+	contest.MessageID = messageID
+	if err := c.db.WithContext(ctx).Model(contest).Update("message_id", messageID).Error; err != nil {
+		return fmt.Errorf("failed to record contest message: %w", err)
+	}
+	return nil
+}
+
+// Running returns the contest of a chat taking entries, or nil
+func (c *Contests) Running(ctx context.Context, chatID int64) (*Contest, error) {
+	var contests []Contest
+	if err := c.db.WithContext(ctx).
+		Where("chat_id = ? AND finished_at IS NULL AND ends_at > ?", chatID, c.clock.Now()).
+		Limit(1).
+		Find(&contests).Error; err != nil {
+		return nil, fmt.Errorf("failed to get running contest: %w", err)
+	}
+	if len(contests) == 0 {
+		return nil, nil
+	}
+	return &contests[0], nil
+}
+
+// Enter enters a new quote in the contest running in its chat, if any, and
+// returns that contest
+func (c *Contests) Enter(ctx context.Context, chatID int64, quoteID uint, userID int64) (*Contest, error) {
+	contest, err := c.Running(ctx, chatID)
+	if err != nil || contest == nil {
+		return nil, err
+	}
+	entry := ContestEntry{ContestID: contest.ID, QuoteID: quoteID, SubmittedBy: userID}
+	if err := c.db.WithContext(ctx).Create(&entry).Error; err != nil {
+		return nil, fmt.Errorf("failed to enter quote in contest: %w", err)
+	}
+	return contest, nil
+}
+
+// Vote toggles the vote of a user for a contest entry. It returns whether
+// the user now votes for it and the votes of the entry.
+func (c *Contests) Vote(ctx context.Context, contestID, quoteID uint, userID int64) (bool, int64, error) {
+	var contest Contest
+	err := c.db.WithContext(ctx).First(&contest, contestID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, 0, ErrContestNotFound
+	}
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to get contest: %w", err)
+	}
+	if contest.FinishedAt != nil || !c.clock.Now().Before(contest.EndsAt) {
+		return false, 0, ErrContestOver
+	}
+	var entry ContestEntry
+	err = c.db.WithContext(ctx).Where("contest_id = ? AND quote_id = ?", contestID, quoteID).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, 0, ErrContestNotFound
+	}
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to get contest entry: %w", err)
+	}
+	if entry.SubmittedBy == userID {
+		return false, 0, ErrOwnContestEntry
+	}
+
+	vote := ContestVote{ContestID: contestID, QuoteID: quoteID, UserID: userID}
+	result := c.db.WithContext(ctx).Where(&vote).Delete(&ContestVote{})
+	if result.Error != nil {
+		return false, 0, fmt.Errorf("failed to take back vote: %w", result.Error)
+	}
+	voted := result.RowsAffected == 0
+	if voted {
+		if err := c.db.WithContext(ctx).Create(&vote).Error; err != nil {
+			return false, 0, fmt.Errorf("failed to record vote: %w", err)
+		}
+	}
+
+	var count int64
+	if err := c.db.WithContext(ctx).Model(&ContestVote{}).
+		Where("contest_id = ? AND quote_id = ?", contestID, quoteID).
+		Count(&count).Error; err != nil {
+		return false, 0, fmt.Errorf("failed to count votes: %w", err)
+	}
+	return voted, count, nil
+}
+
+// Standings returns the entries of a contest, most voted first and the
+// oldest first among ties. The listed entries come with their quotes.
+func (c *Contests) Standings(ctx context.Context, contestID uint) ([]Standing, error) {
+	var standings []Standing
+	if err := c.db.WithContext(ctx).Raw(`
+		SELECT e.quote_id, count(v.user_id) AS votes
+		FROM quote_contest_entry e
+		LEFT JOIN quote_contest_vote v ON v.contest_id = e.contest_id AND v.quote_id = e.quote_id
+		WHERE e.contest_id = ?
+		GROUP BY e.quote_id
+		ORDER BY votes DESC, e.quote_id ASC`, contestID).
+		Scan(&standings).Error; err != nil {
+		return nil, fmt.Errorf("failed to count contest votes: %w", err)
+	}
+
+	listed := standings[:min(len(standings), contestListed)]
+	ids := make([]uint, len(listed))
+	for i, standing := range listed {
+		ids[i] = standing.QuoteID
+	}
+	var quotes []Quote
+	if len(ids) > 0 {
+		if err := c.db.WithContext(ctx).
+			Preload("Entries", func(db *gorm.DB) *gorm.DB {
+				return db.Order("quote_entry.order ASC")
+			}).
+			Where("id IN ?", ids).
+			Find(&quotes).Error; err != nil {
+			return nil, fmt.Errorf("failed to get contest quotes: %w", err)
+		}
+	}
+	for i := range quotes {
+		for j := range listed {
+			if listed[j].QuoteID == quotes[i].ID {
+				listed[j].Quote = &quotes[i]
+			}
+		}
+	}
+	return standings, nil
+}
+
+// Finish ends a contest now and returns its result
+func (c *Contests) Finish(ctx context.Context, contest Contest) (ContestResult, error) {
+	standings, err := c.Standings(ctx, contest.ID)
+	if err != nil {
+		return ContestResult{}, err
+	}
+	now := c.clock.Now()
+	contest.FinishedAt = &now
+	if err := c.db.WithContext(ctx).Model(&contest).Update("finished_at", now).Error; err != nil {
+		return ContestResult{}, fmt.Errorf("failed to finish contest %d: %w", contest.ID, err)
+	}
+	return ContestResult{Contest: contest, Standings: standings}, nil
+}
+
+// Due returns the contests whose time is over but are not finished yet,
+// oldest first
+func (c *Contests) Due(ctx context.Context) ([]Contest, error) {
+	var due []Contest
+	if err := c.db.WithContext(ctx).
+		Where("finished_at IS NULL AND ends_at <= ?", c.clock.Now()).
+		Order("ends_at ASC").
+		Find(&due).Error; err != nil {
+		return nil, fmt.Errorf("failed to list finished contests: %w", err)
+	}
+	return due, nil
+}
+
+// FinishDue finishes every contest whose time is over, oldest first
+func (c *Contests) FinishDue(ctx context.Context) ([]ContestResult, error) {
+	due, err := c.Due(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ContestResult, 0, len(due))
+	for _, contest := range due {
+		result, err := c.Finish(ctx, contest)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// contestKeyboard builds the vote button of a contest entry
+func contestKeyboard(contestID, quoteID uint, count int64) *models.InlineKeyboardMarkup {
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{{
+		Text:         fmt.Sprintf("👍 Vote (%d)", count),
+		CallbackData: fmt.Sprintf("%s%d:%d", contestCallbackPrefix, contestID, quoteID),
+	}}}}
+}
+
+// parseContestCallback extracts the contest and quote of a vote button
+func parseContestCallback(data string) (contestID, quoteID uint, ok bool) {
+	rest, found := strings.CutPrefix(data, contestCallbackPrefix)
+	if !found {
+		return 0, 0, false
+	}
+	contestText, quoteText, found := strings.Cut(rest, ":")
+	if !found {
+		return 0, 0, false
+	}
+	contest, err := strconv.ParseUint(contestText, 10, 64)
+	if err != nil || contest == 0 {
+		return 0, 0, false
+	}
+	quote, err := strconv.ParseUint(quoteText, 10, 64)
+	if err != nil || quote == 0 {
+		return 0, 0, false
+	}
+	return uint(contest), uint(quote), true
+}
+
+// parseContestLength parses the length of a contest such as "7d" or "12h"
+func parseContestLength(value string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(value)
+	}
+	if err != nil || d < minContestLength || d > maxContestLength {
+		return 0, fmt.Errorf("invalid contest length %q, use e.g. 7d or 12h, between 1 hour and 30 days", value)
+	}
+	return d, nil
+}
+
+// contestUsage explains /quotecontest
+const contestUsage = "Usage: /quotecontest shows the standings. Admins start a contest with /quotecontest <length>, e.g. 7d, and end it early with /quotecontest stop."
+
+// QuoteContestHandler handles the /quotecontest command and the vote
+// buttons of the entries
+type QuoteContestHandler struct {
+	contests *Contests
+	settings *settings.Service
+	outbox   *outbox.Outbox
+	admins   *telegram.AdminService
+}
+
+// NewQuoteContestHandler creates a new quotecontest handler
+func NewQuoteContestHandler(db *gorm.DB) *QuoteContestHandler {
+	return &QuoteContestHandler{
+		contests: NewContests(db),
+		settings: settings.NewService(db),
+		outbox:   outbox.New(db),
+	}
+}
+
+// WithAdmins checks admins against a shared cache of chat administrators
+func (h *QuoteContestHandler) WithAdmins(admins *telegram.AdminService) *QuoteContestHandler {
+	h.admins = admins
+	return h
+}
+
+// Handle processes /quotecontest, showing the standings, and the admin
+// forms /quotecontest <length> and /quotecontest stop
+func (h *QuoteContestHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+	slog.Info("executing /quotecontest command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	switch {
+	case args.Len() == 0:
+		return h.standings(ctx, b, msg)
+	case args.Len() > 1:
+		return sendNotice(ctx, h.outbox, b, chatID, contestUsage)
+	}
+
+	admin, err := h.admins.IsSenderAdmin(ctx, b, msg)
+	var refused *telegram.OriginError
+	if errors.As(err, &refused) {
+		return sendNotice(ctx, h.outbox, b, chatID, refused.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return sendNotice(ctx, h.outbox, b, chatID, "Only chat administrators can start or stop quote contests.")
+	}
+
+	if args.Arg(0) == "stop" {
+		return h.stop(ctx, b, chatID, msg.From.ID)
+	}
+	length, err := parseContestLength(args.Arg(0))
+	if err != nil {
+		return sendNotice(ctx, h.outbox, b, chatID, err.Error())
+	}
+	contest, err := h.contests.Start(ctx, chatID, msg.From.ID, length)
+	if errors.Is(err, ErrContestRunning) {
+		return sendNotice(ctx, h.outbox, b, chatID, "A quote contest is already running in this chat. See it with /quotecontest.")
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("quote contest started", "audit", true, "chat_id", chatID, "user_id", msg.From.ID, "contest_id", contest.ID, "ends_at", contest.EndsAt)
+
+	endsAt, err := h.formatEnd(ctx, msg, contest)
+	if err != nil {
+		return err
+	}
+	sent, err := h.outbox.Send(ctx, b, &outbox.Message{
+		ChatID: chatID,
+		Text:   fmt.Sprintf("🏁 Quote contest! Quotes added with /addquote until %s enter it. Vote for your favourites with their 👍 button: the most voted win.", endsAt),
+	})
+	if err != nil {
+		return err
+	}
+	return h.contests.SetMessage(ctx, contest, sent.ID)
+}
+
+// standings shows the running contest of a chat
+func (h *QuoteContestHandler) standings(ctx context.Context, b *bot.Bot, msg *models.Message) error {
+	chatID := msg.Chat.ID
+	contest, err := h.contests.Running(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if contest == nil {
+		return sendNotice(ctx, h.outbox, b, chatID, "No quote contest is running. Admins can start one with /quotecontest 7d.")
+	}
+	endsAt, err := h.formatEnd(ctx, msg, contest)
+	if err != nil {
+		return err
+	}
+	standings, err := h.contests.Standings(ctx, contest.ID)
+	if err != nil {
+		return err
+	}
+	if len(standings) == 0 {
+		return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("🏁 The quote contest runs until %s. No quotes entered yet: add some with /addquote!", endsAt))
+	}
+	text := fmt.Sprintf("🏁 The quote contest runs until %s. Standings so far:\n\n%s", endsAt, standingsText(standings))
+	return sendNotice(ctx, h.outbox, b, chatID, text)
+}
+
+// stop finishes the running contest of a chat now
+func (h *QuoteContestHandler) stop(ctx context.Context, b *bot.Bot, chatID, userID int64) error {
+	contest, err := h.contests.Running(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if contest == nil {
+		return sendNotice(ctx, h.outbox, b, chatID, "No quote contest is running.")
+	}
+	result, err := h.contests.Finish(ctx, *contest)
+	if err != nil {
+		return err
+	}
+	slog.Info("quote contest stopped", "audit", true, "chat_id", chatID, "user_id", userID, "contest_id", contest.ID)
+	return announceContest(ctx, h.outbox, b, result)
+}
+
+// formatEnd prints when a contest ends in the chat's time zone and date
+// format
+func (h *QuoteContestHandler) formatEnd(ctx context.Context, msg *models.Message, contest *Contest) (string, error) {
+	chatSettings, err := h.settings.Get(ctx, msg.Chat.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get chat settings: %w", err)
+	}
+	loc := chatSettings.Location(msg.From.LanguageCode)
+	return contest.EndsAt.In(loc).Format(chatSettings.Layout(msg.From.LanguageCode) + " 15:04"), nil
+}
+
+// HandleCallback toggles a vote for a contest entry and updates its button
+func (h *QuoteContestHandler) HandleCallback(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil {
+		return nil
+	}
+	contestID, quoteID, ok := parseContestCallback(query.Data)
+	if !ok {
+		return nil
+	}
+
+	answer := func(text string) error {
+		_, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID, Text: text})
+		return err
+	}
+
+	voted, count, err := h.contests.Vote(ctx, contestID, quoteID, query.From.ID)
+	switch {
+	case errors.Is(err, ErrContestOver), errors.Is(err, ErrContestNotFound):
+		return answer("This contest is over.")
+	case errors.Is(err, ErrOwnContestEntry):
+		return answer("You cannot vote for a quote you entered.")
+	case err != nil:
+		return err
+	}
+	text := fmt.Sprintf("You voted for quote #%d.", quoteID)
+	if !voted {
+		text = fmt.Sprintf("You took back your vote for quote #%d.", quoteID)
+	}
+	if err := answer(text); err != nil {
+		return err
+	}
+
+	_, err = b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:      query.Message.Message.Chat.ID,
+		MessageID:   query.Message.Message.ID,
+		ReplyMarkup: contestKeyboard(contestID, quoteID, count),
+	})
+	return err
+}
+
+// Command returns the command name
+func (h *QuoteContestHandler) Command() string {
+	return "/quotecontest"
+}
+
+// Description returns the command description
+func (h *QuoteContestHandler) Description() string {
+	return "Show the quote contest standings, or start one (admins only)"
+}
+
+// announceContest posts the result of a contest in reply to its
+// announcement
+func announceContest(ctx context.Context, out *outbox.Outbox, sender outbox.Sender, result ContestResult) error {
+	_, err := out.Send(ctx, sender, &outbox.Message{
+		ChatID:           result.Contest.ChatID,
+		Text:             result.String(),
+		ReplyToMessageID: result.Contest.MessageID,
+	})
+	return err
+}
+
+// ContestReferee finishes contests when their time is over and announces
+// the winners, holding results back during the quiet hours of their chat
+type ContestReferee struct {
+	contests *Contests
+	settings *settings.Service
+	outbox   *outbox.Outbox
+	bot      outbox.Sender
+	clock    clock.Clock
+	logger   *slog.Logger
+}
+
+// NewContestReferee creates a contest referee
+func NewContestReferee(db *gorm.DB, b outbox.Sender, logger *slog.Logger) *ContestReferee {
+	return &ContestReferee{
+		contests: NewContests(db),
+		settings: settings.NewService(db),
+		outbox:   outbox.New(db),
+		bot:      b,
+		clock:    clock.System{},
+		logger:   logger,
+	}
+}
+
+// WithClock replaces the clock deciding when contests end
+func (r *ContestReferee) WithClock(clk clock.Clock) *ContestReferee {
+	r.clock = clk
+	r.contests.WithClock(clk)
+	return r
+}
+
+// Check finishes the contests that are over, announcing each result.
+// Contests ending in the quiet hours of their chat stay open until the
+// hours are over, when a later check announces them.
+func (r *ContestReferee) Check(ctx context.Context) error {
+	due, err := r.contests.Due(ctx)
+	if err != nil {
+		return err
+	}
+	now := r.clock.Now()
+	for _, contest := range due {
+		chatSettings, err := r.settings.Get(ctx, contest.ChatID)
+		if err != nil {
+			return fmt.Errorf("failed to get chat settings: %w", err)
+		}
+		if until := chatSettings.DeferScheduled(now, ""); until.After(now) {
+			r.logger.Debug("holding back contest result in quiet hours", "chat_id", contest.ChatID, "contest_id", contest.ID, "until", until)
+			continue
+		}
+
+		result, err := r.contests.Finish(ctx, contest)
+		if err != nil {
+			return err
+		}
+		r.logger.Info("quote contest finished", "chat_id", contest.ChatID, "contest_id", contest.ID, "entries", len(result.Standings), "winners", result.Winners())
+		if err := announceContest(ctx, r.outbox, r.bot, result); err != nil {
+			r.logger.Error("failed to announce contest result", "contest_id", contest.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// Start checks for finished contests every interval until ctx is done
+func (r *ContestReferee) Start(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := r.Check(ctx); err != nil {
+				r.logger.Error("failed to settle quote contests", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package quotes
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/settings"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestParseContestCallback(t *testing.T) {
+	contestID, quoteID, ok := parseContestCallback("quotecontest:3:12")
+	require.True(t, ok)
+	assert.Equal(t, uint(3), contestID)
+	assert.Equal(t, uint(12), quoteID)
+
+	for _, data := range []string{"quotecontest:3", "quotecontest:x:12", "quotecontest:3:0", "quoteduel:3:1"} {
+		_, _, ok := parseContestCallback(data)
+		assert.False(t, ok, data)
+	}
+}
+
+func TestParseContestLength(t *testing.T) {
+	length, err := parseContestLength("7d")
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, length)
+
+	length, err = parseContestLength("12h")
+	require.NoError(t, err)
+	assert.Equal(t, 12*time.Hour, length)
+
+	for _, value := range []string{"30m", "31d", "soon", "d"} {
+		_, err := parseContestLength(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestContestKeyboard(t *testing.T) {
+	keyboard := contestKeyboard(3, 12, 4)
+	require.Len(t, keyboard.InlineKeyboard, 1)
+	require.Len(t, keyboard.InlineKeyboard[0], 1)
+	assert.Equal(t, "👍 Vote (4)", keyboard.InlineKeyboard[0][0].Text)
+	assert.Equal(t, "quotecontest:3:12", keyboard.InlineKeyboard[0][0].CallbackData)
+}
+
+func TestContestResult_String(t *testing.T) {
+	quote := func(text string) *Quote {
+		return &Quote{Entries: []QuoteEntry{{Message: datatypes.JSON(`{"text":"` + text + `","from":{"first_name":"Bob"}}`)}}}
+	}
+
+	assert.Equal(t, "🏁 The quote contest is over, but no quotes were entered.", ContestResult{}.String())
+
+	result := ContestResult{Standings: []Standing{{QuoteID: 4, Quote: quote("hi")}}}
+	assert.Empty(t, result.Winners())
+	assert.Equal(t, "🏁 The quote contest is over! 1 quote was entered.\n\n🥇 #4 Bob: hi — 0 votes\n\nNobody voted, so there is no winner.", result.String())
+
+	result = ContestResult{Standings: []Standing{
+		{QuoteID: 4, Votes: 3, Quote: quote("first")},
+		{QuoteID: 2, Votes: 1, Quote: quote("second")},
+		{QuoteID: 9, Votes: 1},
+	}}
+	assert.Equal(t, []uint{4}, result.Winners())
+	assert.Equal(t, "🏁 The quote contest is over! 3 quotes were entered.\n\n"+
+		"🥇 #4 Bob: first — 3 votes\n🥈 #2 Bob: second — 1 vote\n🥉 #9 (deleted quote) — 1 vote\n\n"+
+		"🏆 Quote #4 wins with 3 votes!", result.String())
+
+	result.Standings[0].Votes = 1
+	assert.Equal(t, []uint{4, 2, 9}, result.Winners())
+	assert.Contains(t, result.String(), "🏆 Quotes #4, #2 and #9 share the win with 1 vote each!")
+}
+
+func TestStandingsText_ListsTheFirstEntries(t *testing.T) {
+	var standings []Standing
+	for i := range 12 {
+		standings = append(standings, Standing{QuoteID: uint(i + 1)})
+	}
+	text := standingsText(standings)
+	assert.Contains(t, text, "10. #10")
+	assert.NotContains(t, text, "#11")
+	assert.Contains(t, text, "…and 2 more.")
+}
+
+func TestContests(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	clk := clock.NewMock(time.Date(2024, time.March, 1, 20, 0, 0, 0, time.UTC))
+	contests := NewContests(db.DB).WithClock(clk)
+	ctx := context.Background()
+
+	newQuote := func() uint {
+		quote, err := store.Store(ctx, StoreOptions{
+			ChatID:  -100123,
+			Creator: map[string]interface{}{"id": 1},
+			Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"hi"}`)}},
+		})
+		require.NoError(t, err)
+		return quote.ID
+	}
+
+	// Quotes added without a contest are not entered
+	contest, err := contests.Enter(ctx, -100123, newQuote(), 1)
+	require.NoError(t, err)
+	assert.Nil(t, contest)
+
+	started, err := contests.Start(ctx, -100123, 1, 24*time.Hour)
+	require.NoError(t, err)
+	_, err = contests.Start(ctx, -100123, 1, 24*time.Hour)
+	assert.ErrorIs(t, err, ErrContestRunning)
+
+	first, second := newQuote(), newQuote()
+	contest, err = contests.Enter(ctx, -100123, first, 10)
+	require.NoError(t, err)
+	require.NotNil(t, contest)
+	assert.Equal(t, started.ID, contest.ID)
+	_, err = contests.Enter(ctx, -100123, second, 20)
+	require.NoError(t, err)
+
+	// Votes toggle, and nobody votes for their own entry
+	_, _, err = contests.Vote(ctx, started.ID, first, 10)
+	assert.ErrorIs(t, err, ErrOwnContestEntry)
+	voted, count, err := contests.Vote(ctx, started.ID, first, 20)
+	require.NoError(t, err)
+	assert.True(t, voted)
+	assert.Equal(t, int64(1), count)
+	_, _, err = contests.Vote(ctx, started.ID, second, 30)
+	require.NoError(t, err)
+	_, count, err = contests.Vote(ctx, started.ID, first, 30)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	voted, count, err = contests.Vote(ctx, started.ID, second, 30)
+	require.NoError(t, err)
+	assert.False(t, voted)
+	assert.Zero(t, count)
+	_, _, err = contests.Vote(ctx, started.ID, 999, 30)
+	assert.ErrorIs(t, err, ErrContestNotFound)
+
+	results, err := contests.FinishDue(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	clk.Advance(24 * time.Hour)
+	_, _, err = contests.Vote(ctx, started.ID, second, 40)
+	assert.ErrorIs(t, err, ErrContestOver)
+	contest, err = contests.Enter(ctx, -100123, newQuote(), 1)
+	require.NoError(t, err)
+	assert.Nil(t, contest, "contests over take no entries")
+
+	results, err = contests.FinishDue(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Len(t, results[0].Standings, 2)
+	assert.Equal(t, []uint{first}, results[0].Winners())
+	assert.Equal(t, int64(2), results[0].Standings[0].Votes)
+	assert.NotNil(t, results[0].Standings[0].Quote)
+
+	results, err = contests.FinishDue(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	_, err = contests.Start(ctx, -100123, 1, time.Hour)
+	assert.NoError(t, err)
+}
+
+func TestContestReferee_QuietHours(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	clk := clock.NewMock(time.Date(2024, time.March, 1, 20, 0, 0, 0, time.UTC))
+	referee := NewContestReferee(h.DB.DB, h.Bot, slog.Default()).WithClock(clk)
+	ctx := context.Background()
+
+	service := settings.NewService(h.DB.DB)
+	chatSettings, err := service.Get(ctx, -100123)
+	require.NoError(t, err)
+	chatSettings.Timezone = "UTC"
+	chatSettings.QuietHoursWindow = "23:00-08:00"
+	require.NoError(t, service.Save(ctx, chatSettings))
+
+	// The contest ends at 23:30, in the quiet hours of the chat
+	contest, err := referee.contests.Start(ctx, -100123, 1, 3*time.Hour+30*time.Minute)
+	require.NoError(t, err)
+	clk.Advance(4 * time.Hour)
+	require.NoError(t, referee.Check(ctx))
+	assert.Empty(t, h.Requests("sendMessage"), "results wait for the quiet hours to end")
+	due, err := referee.contests.Due(ctx)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, contest.ID, due[0].ID)
+
+	// 08:00, the result is announced
+	clk.Advance(8*time.Hour + 30*time.Minute)
+	require.NoError(t, referee.Check(ctx))
+	require.Len(t, h.Requests("sendMessage"), 1)
+	due, err = referee.contests.Due(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+}
+
+func TestQuoteContestHandler(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	contests := NewQuoteContestHandler(h.DB.DB)
+	h.Register(contests)
+	h.RegisterCallback(contestCallbackPrefix, testutils.HandlerFunc(contests.HandleCallback))
+	ctx := context.Background()
+
+	h.SendText(-100123, "/quotecontest")
+	assert.Equal(t, "No quote contest is running. Admins can start one with /quotecontest 7d.", h.LastReply())
+
+	h.SendText(-100123, "/quotecontest 7d")
+	assert.Equal(t, "Only chat administrators can start or stop quote contests.", h.LastReply())
+
+	h.SetAdmin(-100123, h.User.ID)
+	h.SendText(-100123, "/quotecontest 90d")
+	assert.Contains(t, h.LastReply(), "invalid contest length")
+	h.SendText(-100123, "/quotecontest 7d")
+	assert.Contains(t, h.LastReply(), "🏁 Quote contest! Quotes added with /addquote until")
+
+	h.SendText(-100123, "/quotecontest")
+	assert.Contains(t, h.LastReply(), "No quotes entered yet")
+
+	quote, err := NewStore(h.DB.DB).Store(ctx, StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 2},
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"contender","from":{"first_name":"Bob"}}`)}},
+	})
+	require.NoError(t, err)
+	contest, err := contests.contests.Enter(ctx, -100123, quote.ID, 2)
+	require.NoError(t, err)
+
+	group := &models.Message{ID: 1, Chat: models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}}
+	h.Press(group, fmt.Sprintf("quotecontest:%d:%d", contest.ID, quote.ID))
+	answers := h.Requests("answerCallbackQuery")
+	require.Len(t, answers, 1)
+	assert.Equal(t, fmt.Sprintf("You voted for quote #%d.", quote.ID), answers[0].Params["text"])
+	edits := h.Requests("editMessageReplyMarkup")
+	require.Len(t, edits, 1)
+	assert.Contains(t, edits[0].Params["reply_markup"], "👍 Vote (1)")
+
+	h.SendText(-100123, "/quotecontest")
+	assert.Contains(t, h.LastReply(), fmt.Sprintf("🥇 #%d Bob: contender — 1 vote", quote.ID))
+
+	h.SendText(-100123, "/quotecontest stop")
+	assert.Contains(t, h.LastReply(), fmt.Sprintf("🏆 Quote #%d wins with 1 vote!", quote.ID))
+
+	h.Press(group, fmt.Sprintf("quotecontest:%d:%d", contest.ID, quote.ID))
+	assert.Equal(t, "This contest is over.", h.Requests("answerCallbackQuery")[1].Params["text"])
+}
@@ -0,0 +1,144 @@
+package quotes
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"gorm.io/datatypes"
+)
+
+// CreatorRetention is how much of the user who added a quote is stored
+type CreatorRetention string
+
+const (
+	// CreatorFull keeps the ID, names and username of the quoter
+	CreatorFull CreatorRetention = "full"
+	// CreatorMinimal keeps the ID and first name of the quoter
+	CreatorMinimal CreatorRetention = "minimal"
+	// CreatorHash keeps only a keyed hash of the quoter ID, enough to tell
+	// whether two quotes were added by the same user
+	CreatorHash CreatorRetention = "hash"
+)
+
+// CreatorRetentions returns the supported retention policies
+func CreatorRetentions() []CreatorRetention {
+	return []CreatorRetention{CreatorFull, CreatorMinimal, CreatorHash}
+}
+
+// CreatorPolicy reduces the quoter stored with each quote to what its
+// retention allows
+type CreatorPolicy struct {
+	Retention CreatorRetention
+	key       []byte
+}
+
+// NewCreatorPolicy creates a creator policy. The hash retention needs a
+// secret key: without one, hashes of Telegram IDs are easily reversed by
+// trying every ID.
+func NewCreatorPolicy(retention, key string) (CreatorPolicy, error) {
+	policy := CreatorPolicy{Retention: CreatorRetention(retention), key: []byte(key)}
+	switch policy.Retention {
+	case "":
+		policy.Retention = CreatorFull
+	case CreatorFull, CreatorMinimal:
+	case CreatorHash:
+		if key == "" {
+			return CreatorPolicy{}, fmt.Errorf("creator retention %q needs a hash key", CreatorHash)
+		}
+	default:
+		return CreatorPolicy{}, fmt.Errorf("unknown creator retention %q, expected one of %v", retention, CreatorRetentions())
+	}
+	return policy, nil
+}
+
+// Apply returns the part of a creator the policy keeps. Creators already
+// reduced further than the policy asks are returned as they are.
+func (p CreatorPolicy) Apply(creator map[string]interface{}) map[string]interface{} {
+	id, hasID := creator["id"]
+	switch p.Retention {
+	case CreatorMinimal:
+		reduced := map[string]interface{}{}
+		for _, field := range []string{"id", "first_name", "id_hash"} {
+			if value, ok := creator[field]; ok {
+				reduced[field] = value
+			}
+		}
+		return reduced
+	case CreatorHash:
+		if !hasID {
+			return creator
+		}
+		return map[string]interface{}{"id_hash": p.hashID(id)}
+	}
+	return creator
+}
+
+// hashID returns the keyed hash of a Telegram user ID
+func (p CreatorPolicy) hashID(id interface{}) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(creatorID(id)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// creatorID formats a user ID the same way whether it comes from Telegram
+// or from stored JSON
+func creatorID(id interface{}) string {
+	switch v := id.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(id)
+}
+
+// RedactCreators applies the creator policy to every stored quote, for
+// operators that tighten the policy after quotes were added. It returns how
+// many quotes changed; with dryRun nothing is written.
+func (s *Store) RedactCreators(ctx context.Context, dryRun bool) (int, error) {
+	var stored []Quote
+	if err := s.db.WithContext(ctx).Select("id", "creator").Order("id").Find(&stored).Error; err != nil {
+		return 0, fmt.Errorf("failed to list quotes: %w", err)
+	}
+
+	changed := 0
+	err := s.Transaction(ctx, func(tx *Store) error {
+		for _, quote := range stored {
+			var creator map[string]interface{}
+			if err := json.Unmarshal(quote.Creator, &creator); err != nil {
+				return fmt.Errorf("failed to parse creator of quote %d: %w", quote.ID, err)
+			}
+			redacted, err := json.Marshal(s.creators.Apply(creator))
+			if err != nil {
+				return fmt.Errorf("failed to marshal creator of quote %d: %w", quote.ID, err)
+			}
+			if jsonEqual(quote.Creator, redacted) {
+				continue
+			}
+			changed++
+			if dryRun {
+				continue
+			}
+			if err := tx.db.Model(&Quote{}).Where("id = ?", quote.ID).
+				Update("creator", datatypes.JSON(redacted)).Error; err != nil {
+				return fmt.Errorf("failed to update creator of quote %d: %w", quote.ID, err)
+			}
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// jsonEqual reports whether two JSON documents hold the same value
+func jsonEqual(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	x, _ := json.Marshal(va)
+	y, _ := json.Marshal(vb)
+	return string(x) == string(y)
+}
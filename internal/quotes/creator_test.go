@@ -0,0 +1,93 @@
+package quotes
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestNewCreatorPolicy(t *testing.T) {
+	policy, err := NewCreatorPolicy("", "")
+	require.NoError(t, err)
+	assert.Equal(t, CreatorFull, policy.Retention)
+
+	_, err = NewCreatorPolicy("minimal", "")
+	assert.NoError(t, err)
+
+	_, err = NewCreatorPolicy("hash", "")
+	assert.ErrorContains(t, err, "needs a hash key")
+
+	_, err = NewCreatorPolicy("everything", "")
+	assert.ErrorContains(t, err, "unknown creator retention")
+}
+
+func TestCreatorPolicy_Apply(t *testing.T) {
+	creator := map[string]interface{}{
+		"id":         int64(5000000000),
+		"first_name": "Ana",
+		"last_name":  "García",
+		"username":   "ana",
+	}
+
+	full, _ := NewCreatorPolicy("full", "")
+	assert.Equal(t, creator, full.Apply(creator))
+
+	minimal, _ := NewCreatorPolicy("minimal", "")
+	assert.Equal(t, map[string]interface{}{"id": int64(5000000000), "first_name": "Ana"}, minimal.Apply(creator))
+
+	hash, _ := NewCreatorPolicy("hash", "secret")
+	hashed := hash.Apply(creator)
+	require.Len(t, hashed, 1)
+	assert.Len(t, hashed["id_hash"], 64)
+
+	// IDs read back from stored JSON hash the same as fresh ones
+	var stored map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"id":5000000000,"first_name":"Ana"}`), &stored))
+	assert.Equal(t, hashed, hash.Apply(stored))
+
+	// Another key gives another hash
+	other, _ := NewCreatorPolicy("hash", "other")
+	assert.NotEqual(t, hashed, other.Apply(creator))
+
+	// Hashed creators stay as they are
+	assert.Equal(t, hashed, hash.Apply(hashed))
+	assert.Equal(t, hashed, minimal.Apply(hashed))
+}
+
+func TestStore_RedactCreators(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+
+	entries := []CacheEntry{{Message: datatypes.JSON(`{"text":"hello"}`)}}
+	quote, err := NewStore(db.DB).Store(ctx, StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 42, "first_name": "Ana", "username": "ana"},
+		Entries: entries,
+	})
+	require.NoError(t, err)
+
+	minimal, _ := NewCreatorPolicy("minimal", "")
+	store := NewStore(db.DB).WithCreatorPolicy(minimal)
+
+	changed, err := store.RedactCreators(ctx, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, changed)
+
+	changed, err = store.RedactCreators(ctx, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, changed)
+
+	stored, err := store.GetByID(ctx, quote.ID)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":42,"first_name":"Ana"}`, string(stored.Creator))
+
+	// Redacting again changes nothing
+	changed, err = store.RedactCreators(ctx, false)
+	require.NoError(t, err)
+	assert.Zero(t, changed)
+}
@@ -0,0 +1,89 @@
+package quotes
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultDateLayout is the layout used when a DateFormat has no layout
+const DefaultDateLayout = "2006-01-02 15:04"
+
+// DateFormat controls how quote dates are printed
+type DateFormat struct {
+	Location *time.Location // Time zone, defaults to UTC
+	Layout   string         // Go time layout, defaults to DefaultDateLayout
+	Relative bool           // Print "3 years ago" instead of an absolute date
+}
+
+// Format prints t according to the format. now is the reference time for
+// relative dates.
+func (f DateFormat) Format(t, now time.Time) string {
+	if f.Relative {
+		return relativeTime(t, now)
+	}
+
+	loc := f.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	layout := f.Layout
+	if layout == "" {
+		layout = DefaultDateLayout
+	}
+	return t.In(loc).Format(layout)
+}
+
+// relativeTime describes how long ago t happened, e.g. "3 years ago"
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	if d < 0 {
+		return "in the future"
+	}
+
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return ago(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return ago(int(d/time.Hour), "hour")
+	}
+
+	// Calendar based units from here, so "1 year ago" means a calendar year
+	years, months, days := calendarDiff(t, now)
+	switch {
+	case years > 0:
+		return ago(years, "year")
+	case months > 0:
+		return ago(months, "month")
+	default:
+		return ago(days, "day")
+	}
+}
+
+// calendarDiff returns the whole years, months and days between two times
+func calendarDiff(from, to time.Time) (years, months, days int) {
+	from = from.UTC()
+	to = to.UTC()
+
+	months = (to.Year()-from.Year())*12 + int(to.Month()-from.Month())
+	if to.Day() < from.Day() || (to.Day() == from.Day() && timeOfDay(to) < timeOfDay(from)) {
+		months--
+	}
+
+	days = int(to.Sub(from.AddDate(0, months, 0)) / (24 * time.Hour))
+	return months / 12, months % 12, days
+}
+
+// timeOfDay returns the time of day as a duration since midnight
+func timeOfDay(t time.Time) time.Duration {
+	return t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()))
+}
+
+// ago pluralizes a "N units ago" string
+func ago(n int, unit string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s ago", unit)
+	}
+	return fmt.Sprintf("%d %ss ago", n, unit)
+}
@@ -0,0 +1,62 @@
+package quotes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDateFormat_Format(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Skip("tzdata not available")
+	}
+
+	date := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		format   DateFormat
+		expected string
+	}{
+		{"default", DateFormat{}, "2021-01-01 00:00"},
+		{"time zone", DateFormat{Location: madrid}, "2021-01-01 01:00"},
+		{"layout", DateFormat{Layout: "02/01/2006"}, "01/01/2021"},
+		{"relative", DateFormat{Relative: true, Location: madrid}, "3 years ago"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.format.Format(date, now))
+		})
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		then     time.Time
+		expected string
+	}{
+		{now.Add(-10 * time.Second), "just now"},
+		{now.Add(-1 * time.Minute), "1 minute ago"},
+		{now.Add(-45 * time.Minute), "45 minutes ago"},
+		{now.Add(-5 * time.Hour), "5 hours ago"},
+		{now.Add(-36 * time.Hour), "1 day ago"},
+		{now.AddDate(0, 0, -20), "20 days ago"},
+		{now.AddDate(0, -1, 0), "1 month ago"},
+		{now.AddDate(0, -11, -2), "11 months ago"},
+		{now.AddDate(-1, 0, 0), "1 year ago"},
+		{now.AddDate(-3, -5, 0), "3 years ago"},
+		{now.Add(time.Hour), "in the future"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			assert.Equal(t, tt.expected, relativeTime(tt.then, now))
+		})
+	}
+}
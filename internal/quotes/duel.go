@@ -0,0 +1,530 @@
+package quotes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/settings"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultDuelWindow is how long duels are open for votes by default
+const DefaultDuelWindow = time.Hour
+
+// duelCallbackPrefix prefixes the callback data of the duel vote buttons
+const duelCallbackPrefix = "quoteduel:"
+
+// Duel errors
+var (
+	ErrDuelRunning  = errors.New("a duel is already running in this chat")
+	ErrDuelOver     = errors.New("the duel is over")
+	ErrDuelNotFound = errors.New("duel not found")
+)
+
+// Duel is a vote between two quotes of a chat
+type Duel struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	ChatID        int64      `gorm:"not null" json:"chat_id"`
+	FirstQuoteID  uint       `gorm:"not null" json:"first_quote_id"`
+	SecondQuoteID uint       `gorm:"not null" json:"second_quote_id"`
+	MessageID     int        `gorm:"not null;default:0" json:"message_id"` // Message with the vote buttons
+	EndsAt        time.Time  `gorm:"not null" json:"ends_at"`
+	WinnerQuoteID *uint      `json:"winner_quote_id"` // Nil until finished, and for ties
+	FinishedAt    *time.Time `json:"finished_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for Duel
+func (Duel) TableName() string {
+	return "quote_duel"
+}
+
+// QuoteIDs returns the quotes of the duel in button order
+func (d *Duel) QuoteIDs() [2]uint {
+	return [2]uint{d.FirstQuoteID, d.SecondQuoteID}
+}
+
+// DuelVote is the quote a user voted for in a duel
+type DuelVote struct {
+	DuelID    uint      `gorm:"primaryKey" json:"duel_id"`
+	UserID    int64     `gorm:"primaryKey" json:"user_id"`
+	QuoteID   uint      `gorm:"not null" json:"quote_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for DuelVote
+func (DuelVote) TableName() string {
+	return "quote_duel_vote"
+}
+
+// DuelResult is the outcome of a finished duel
+type DuelResult struct {
+	Duel  Duel
+	Votes [2]int64 // Votes of the first and second quote
+	Wins  int64    // Duels won so far by the winner, this one included
+}
+
+// Winner returns the winning quote, or 0 for a tie
+func (r DuelResult) Winner() uint {
+	switch {
+	case r.Votes[0] > r.Votes[1]:
+		return r.Duel.FirstQuoteID
+	case r.Votes[1] > r.Votes[0]:
+		return r.Duel.SecondQuoteID
+	}
+	return 0
+}
+
+// String announces the result in the chat
+func (r DuelResult) String() string {
+	first, second := r.Duel.FirstQuoteID, r.Duel.SecondQuoteID
+	if r.Votes[0] == 0 && r.Votes[1] == 0 {
+		return fmt.Sprintf("Nobody voted in the duel between quotes #%d and #%d.", first, second)
+	}
+	winner := r.Winner()
+	if winner == 0 {
+		return fmt.Sprintf("The duel between quotes #%d and #%d ended in a tie, %s each.", first, second, votes(r.Votes[0]))
+	}
+	loser, high, low := second, r.Votes[0], r.Votes[1]
+	if winner == second {
+		loser, high, low = first, r.Votes[1], r.Votes[0]
+	}
+	text := fmt.Sprintf("🏆 Quote #%d wins the duel against #%d, %s to %d.", winner, loser, votes(high), low)
+	if r.Wins > 1 {
+		text += fmt.Sprintf(" It has won %d duels.", r.Wins)
+	}
+	return text
+}
+
+// votes formats a vote count
+func votes(n int64) string {
+	if n == 1 {
+		return "1 vote"
+	}
+	return fmt.Sprintf("%d votes", n)
+}
+
+// Duels stores quote duels and their votes
+type Duels struct {
+	db    *gorm.DB
+	clock clock.Clock
+}
+
+// NewDuels creates a duel store
+func NewDuels(db *gorm.DB) *Duels {
+	return &Duels{db: db, clock: clock.System{}}
+}
+
+// WithClock replaces the clock deciding when duels end
+func (d *Duels) WithClock(clk clock.Clock) *Duels {
+	d.clock = clk
+	return d
+}
+
+// Start opens a duel between two quotes of a chat for window. Chats run one
+// duel at a time.
+func (d *Duels) Start(ctx context.Context, chatID int64, first, second uint, window time.Duration) (*Duel, error) {
+	var running int64
+	if err := d.db.WithContext(ctx).Model(&Duel{}).
+		Where("chat_id = ? AND finished_at IS NULL", chatID).
+		Count(&running).Error; err != nil {
+		return nil, fmt.Errorf("failed to look for running duels: %w", err)
+	}
+	if running > 0 {
+		return nil, ErrDuelRunning
+	}
+
+	duel := &Duel{
+		ChatID:        chatID,
+		FirstQuoteID:  first,
+		SecondQuoteID: second,
+		EndsAt:        d.clock.Now().Add(window),
+	}
+	if err := d.db.WithContext(ctx).Create(duel).Error; err != nil {
+		return nil, fmt.Errorf("failed to create duel: %w", err)
+	}
+	return duel, nil
+}
+
+// SetMessage records the message holding the vote buttons of a duel
+func (d *Duels) SetMessage(ctx context.Context, duel *Duel, messageID int) error {
+	duel.MessageID = messageID
+	if err := d.db.WithContext(ctx).Model(duel).Update("message_id", messageID).Error; err != nil {
+		return fmt.Errorf("failed to record duel message: %w", err)
+	}
+	return nil
+}
+
+// Vote records the vote of a user for one side of a duel (0 or 1), replacing
+// any earlier vote of theirs
+func (d *Duels) Vote(ctx context.Context, duelID uint, userID int64, side int) (*Duel, error) {
+	var duel Duel
+	err := d.db.WithContext(ctx).First(&duel, duelID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDuelNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get duel: %w", err)
+	}
+	if duel.FinishedAt != nil || !d.clock.Now().Before(duel.EndsAt) {
+		return nil, ErrDuelOver
+	}
+	if side != 0 && side != 1 {
+		return nil, fmt.Errorf("invalid duel side %d", side)
+	}
+
+	vote := DuelVote{DuelID: duel.ID, UserID: userID, QuoteID: duel.QuoteIDs()[side]}
+	if err := d.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "duel_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"quote_id"}),
+	}).Create(&vote).Error; err != nil {
+		return nil, fmt.Errorf("failed to record vote: %w", err)
+	}
+	return &duel, nil
+}
+
+// Tally returns the votes of each side of a duel
+func (d *Duels) Tally(ctx context.Context, duel *Duel) ([2]int64, error) {
+	var rows []struct {
+		QuoteID uint
+		Votes   int64
+	}
+	if err := d.db.WithContext(ctx).Model(&DuelVote{}).
+		Select("quote_id, count(*) AS votes").
+		Where("duel_id = ?", duel.ID).
+		Group("quote_id").
+		Scan(&rows).Error; err != nil {
+		return [2]int64{}, fmt.Errorf("failed to count votes: %w", err)
+	}
+
+	var tally [2]int64
+	for _, row := range rows {
+		for side, quoteID := range duel.QuoteIDs() {
+			if row.QuoteID == quoteID {
+				tally[side] = row.Votes
+			}
+		}
+	}
+	return tally, nil
+}
+
+// FinishDue settles every duel whose window is over, oldest first
+func (d *Duels) FinishDue(ctx context.Context) ([]DuelResult, error) {
+	var due []Duel
+	if err := d.db.WithContext(ctx).
+		Where("finished_at IS NULL AND ends_at <= ?", d.clock.Now()).
+		Order("ends_at ASC").
+		Find(&due).Error; err != nil {
+		return nil, fmt.Errorf("failed to list finished duels: %w", err)
+	}
+
+	results := make([]DuelResult, 0, len(due))
+	for _, duel := range due {
+		result, err := d.finish(ctx, duel)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// finish counts the votes of a duel and records its winner
+func (d *Duels) finish(ctx context.Context, duel Duel) (DuelResult, error) {
+	tally, err := d.Tally(ctx, &duel)
+	if err != nil {
+		return DuelResult{}, err
+	}
+	result := DuelResult{Duel: duel, Votes: tally}
+
+	now := d.clock.Now()
+	result.Duel.FinishedAt = &now
+	if winner := result.Winner(); winner != 0 {
+		result.Duel.WinnerQuoteID = &winner
+	}
+	if err := d.db.WithContext(ctx).Model(&duel).Updates(map[string]interface{}{
+		"finished_at":     now,
+		"winner_quote_id": result.Duel.WinnerQuoteID,
+	}).Error; err != nil {
+		return DuelResult{}, fmt.Errorf("failed to finish duel %d: %w", duel.ID, err)
+	}
+
+	if result.Duel.WinnerQuoteID != nil {
+		if result.Wins, err = d.Wins(ctx, *result.Duel.WinnerQuoteID); err != nil {
+			return DuelResult{}, err
+		}
+	}
+	return result, nil
+}
+
+// Wins returns how many duels a quote has won, a measure of how much the
+// chat likes it
+func (d *Duels) Wins(ctx context.Context, quoteID uint) (int64, error) {
+	var wins int64
+	if err := d.db.WithContext(ctx).Model(&Duel{}).
+		Where("winner_quote_id = ?", quoteID).
+		Count(&wins).Error; err != nil {
+		return 0, fmt.Errorf("failed to count duel wins: %w", err)
+	}
+	return wins, nil
+}
+
+// duelKeyboard builds the vote buttons of a duel with the current tally
+func duelKeyboard(duel *Duel, tally [2]int64) *models.InlineKeyboardMarkup {
+	row := make([]models.InlineKeyboardButton, 0, 2)
+	for side, quoteID := range duel.QuoteIDs() {
+		row = append(row, models.InlineKeyboardButton{
+			Text:         fmt.Sprintf("%s #%d (%d)", duelSides[side], quoteID, tally[side]),
+			CallbackData: fmt.Sprintf("%s%d:%d", duelCallbackPrefix, duel.ID, side),
+		})
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+}
+
+// duelSides marks the two quotes of a duel
+var duelSides = [2]string{"1️⃣", "2️⃣"}
+
+// parseDuelCallback extracts the duel and side of a vote button
+func parseDuelCallback(data string) (duelID uint, side int, ok bool) {
+	id, sideText, found := strings.Cut(strings.TrimPrefix(data, duelCallbackPrefix), ":")
+	if !found || !strings.HasPrefix(data, duelCallbackPrefix) {
+		return 0, 0, false
+	}
+	parsedID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	side, err = strconv.Atoi(sideText)
+	if err != nil || side < 0 || side > 1 {
+		return 0, 0, false
+	}
+	return uint(parsedID), side, true
+}
+
+// QuoteDuelHandler handles the /quoteduel command and its vote buttons
+type QuoteDuelHandler struct {
+	store    *Store
+	duels    *Duels
+	poster   *quotePoster
+	settings *settings.Service
+	outbox   *outbox.Outbox
+	window   time.Duration
+}
+
+// NewQuoteDuelHandler creates a new quoteduel handler
+func NewQuoteDuelHandler(db *gorm.DB) *QuoteDuelHandler {
+	return &QuoteDuelHandler{
+		store:    NewStore(db),
+		duels:    NewDuels(db),
+		poster:   newQuotePoster(db),
+		settings: settings.NewService(db),
+		outbox:   outbox.New(db),
+		window:   DefaultDuelWindow,
+	}
+}
+
+// WithWindow sets how long duels are open for votes
+func (h *QuoteDuelHandler) WithWindow(window time.Duration) *QuoteDuelHandler {
+	if window > 0 {
+		h.window = window
+	}
+	return h
+}
+
+// Handle processes the /quoteduel command, posting two random quotes of the
+// chat with a vote button for each
+func (h *QuoteDuelHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+	slog.Info("executing /quoteduel command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	first, err := h.store.GetRandomForChat(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	var second *Quote
+	if first != nil {
+		if second, err = h.store.getRandom(ctx, "chat_id = ? AND id <> ?", chatID, first.ID); err != nil {
+			return err
+		}
+	}
+	if second == nil {
+		return sendNotice(ctx, h.outbox, b, chatID, "A duel needs at least two quotes. Add some with /addquote!")
+	}
+
+	duel, err := h.duels.Start(ctx, chatID, first.ID, second.ID, h.window)
+	if errors.Is(err, ErrDuelRunning) {
+		return sendNotice(ctx, h.outbox, b, chatID, "A duel is already running in this chat, vote there first!")
+	}
+	if err != nil {
+		return err
+	}
+
+	text, err := h.render(ctx, msg, duel, first, second)
+	if err != nil {
+		return err
+	}
+	sent, err := h.outbox.Send(ctx, b, &outbox.Message{
+		ChatID:   chatID,
+		Text:     text,
+		Keyboard: duelKeyboard(duel, [2]int64{}),
+	})
+	if err != nil {
+		return err
+	}
+	return h.duels.SetMessage(ctx, duel, sent.ID)
+}
+
+// render writes the duel announcement with both quotes
+func (h *QuoteDuelHandler) render(ctx context.Context, msg *models.Message, duel *Duel, contenders ...*Quote) (string, error) {
+	chatSettings, err := h.settings.Get(ctx, msg.Chat.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get chat settings: %w", err)
+	}
+	endsAt := duel.EndsAt.In(chatSettings.Location(msg.From.LanguageCode))
+
+	parts := []string{fmt.Sprintf("⚔️ Quote duel! Vote for your favourite until %s.", endsAt.Format("15:04"))}
+	for side, quote := range contenders {
+		rendered, err := h.poster.render(ctx, msg, quote)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, duelSides[side]+" "+rendered)
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// HandleCallback records a vote and updates the tally on the buttons
+func (h *QuoteDuelHandler) HandleCallback(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil {
+		return nil
+	}
+	duelID, side, ok := parseDuelCallback(query.Data)
+	if !ok {
+		return nil
+	}
+
+	duel, err := h.duels.Vote(ctx, duelID, query.From.ID, side)
+	if errors.Is(err, ErrDuelOver) || errors.Is(err, ErrDuelNotFound) {
+		_, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            "This duel is over.",
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: query.ID,
+		Text:            fmt.Sprintf("You voted for quote #%d.", duel.QuoteIDs()[side]),
+	}); err != nil {
+		return err
+	}
+
+	tally, err := h.duels.Tally(ctx, duel)
+	if err != nil {
+		return err
+	}
+	_, err = b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:      query.Message.Message.Chat.ID,
+		MessageID:   query.Message.Message.ID,
+		ReplyMarkup: duelKeyboard(duel, tally),
+	})
+	return err
+}
+
+// Command returns the command name
+func (h *QuoteDuelHandler) Command() string {
+	return "/quoteduel"
+}
+
+// Description returns the command description
+func (h *QuoteDuelHandler) Description() string {
+	return "Vote between two random quotes"
+}
+
+// DuelBot is the part of the Bot API used to announce duel results;
+// *bot.Bot implements it
+type DuelBot interface {
+	outbox.Sender
+	EditMessageReplyMarkup(ctx context.Context, params *bot.EditMessageReplyMarkupParams) (*models.Message, error)
+}
+
+// DuelReferee settles duels when their voting window ends and announces the
+// winners
+type DuelReferee struct {
+	duels  *Duels
+	outbox *outbox.Outbox
+	bot    DuelBot
+	logger *slog.Logger
+}
+
+// NewDuelReferee creates a duel referee
+func NewDuelReferee(db *gorm.DB, b DuelBot, logger *slog.Logger) *DuelReferee {
+	return &DuelReferee{
+		duels:  NewDuels(db),
+		outbox: outbox.New(db),
+		bot:    b,
+		logger: logger,
+	}
+}
+
+// Check finishes the duels that are over, announcing each result in reply to
+// the duel and removing its vote buttons
+func (r *DuelReferee) Check(ctx context.Context) error {
+	results, err := r.duels.FinishDue(ctx)
+	for _, result := range results {
+		duel := result.Duel
+		r.logger.Info("quote duel finished", "chat_id", duel.ChatID, "duel_id", duel.ID, "votes", result.Votes, "winner", result.Winner())
+		if duel.MessageID != 0 {
+			if _, err := r.bot.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+				ChatID:      duel.ChatID,
+				MessageID:   duel.MessageID,
+				ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{}},
+			}); err != nil {
+				r.logger.Warn("failed to remove duel buttons", "duel_id", duel.ID, "error", err)
+			}
+		}
+		if _, err := r.outbox.Send(ctx, r.bot, &outbox.Message{
+			ChatID:           duel.ChatID,
+			Text:             result.String(),
+			ReplyToMessageID: duel.MessageID,
+		}); err != nil {
+			r.logger.Error("failed to announce duel result", "duel_id", duel.ID, "error", err)
+		}
+	}
+	return err
+}
+
+// Start checks for finished duels every interval until ctx is done
+func (r *DuelReferee) Start(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := r.Check(ctx); err != nil {
+				r.logger.Error("failed to settle quote duels", "error", err)
+			}
+		}
+	}
+}
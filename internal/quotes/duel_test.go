@@ -0,0 +1,150 @@
+package quotes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestParseDuelCallback(t *testing.T) {
+	duelID, side, ok := parseDuelCallback("quoteduel:12:1")
+	require.True(t, ok)
+	assert.Equal(t, uint(12), duelID)
+	assert.Equal(t, 1, side)
+
+	for _, data := range []string{"quoteduel:12:2", "quoteduel:12", "quoteduel:x:0", "purgequotes:12:0"} {
+		_, _, ok := parseDuelCallback(data)
+		assert.False(t, ok, data)
+	}
+}
+
+func TestDuelKeyboard(t *testing.T) {
+	duel := &Duel{ID: 7, FirstQuoteID: 3, SecondQuoteID: 9}
+	keyboard := duelKeyboard(duel, [2]int64{2, 0})
+
+	require.Len(t, keyboard.InlineKeyboard, 1)
+	row := keyboard.InlineKeyboard[0]
+	require.Len(t, row, 2)
+	assert.Equal(t, "1️⃣ #3 (2)", row[0].Text)
+	assert.Equal(t, "quoteduel:7:0", row[0].CallbackData)
+	assert.Equal(t, "2️⃣ #9 (0)", row[1].Text)
+	assert.Equal(t, "quoteduel:7:1", row[1].CallbackData)
+}
+
+func TestDuelResult_String(t *testing.T) {
+	duel := Duel{FirstQuoteID: 3, SecondQuoteID: 9}
+
+	tests := []struct {
+		name     string
+		result   DuelResult
+		winner   uint
+		expected string
+	}{
+		{
+			name:     "first wins",
+			result:   DuelResult{Duel: duel, Votes: [2]int64{5, 3}, Wins: 1},
+			winner:   3,
+			expected: "🏆 Quote #3 wins the duel against #9, 5 votes to 3.",
+		},
+		{
+			name:     "second wins again",
+			result:   DuelResult{Duel: duel, Votes: [2]int64{0, 1}, Wins: 4},
+			winner:   9,
+			expected: "🏆 Quote #9 wins the duel against #3, 1 vote to 0. It has won 4 duels.",
+		},
+		{
+			name:     "tie",
+			result:   DuelResult{Duel: duel, Votes: [2]int64{2, 2}},
+			expected: "The duel between quotes #3 and #9 ended in a tie, 2 votes each.",
+		},
+		{
+			name:     "no votes",
+			result:   DuelResult{Duel: duel},
+			expected: "Nobody voted in the duel between quotes #3 and #9.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.winner, tt.result.Winner())
+			assert.Equal(t, tt.expected, tt.result.String())
+		})
+	}
+}
+
+func TestDuels(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	clk := clock.NewMock(time.Date(2024, time.March, 1, 20, 0, 0, 0, time.UTC))
+	duels := NewDuels(db.DB).WithClock(clk)
+	ctx := context.Background()
+
+	var ids []uint
+	for range 2 {
+		quote, err := store.Store(ctx, StoreOptions{
+			ChatID:  -100123,
+			Creator: map[string]interface{}{"id": 1},
+			Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"hi"}`)}},
+		})
+		require.NoError(t, err)
+		ids = append(ids, quote.ID)
+	}
+
+	duel, err := duels.Start(ctx, -100123, ids[0], ids[1], time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, duels.SetMessage(ctx, duel, 555))
+
+	// One duel at a time per chat
+	_, err = duels.Start(ctx, -100123, ids[0], ids[1], time.Hour)
+	assert.ErrorIs(t, err, ErrDuelRunning)
+
+	// Voting again changes the vote
+	_, err = duels.Vote(ctx, duel.ID, 1, 0)
+	require.NoError(t, err)
+	_, err = duels.Vote(ctx, duel.ID, 2, 1)
+	require.NoError(t, err)
+	_, err = duels.Vote(ctx, duel.ID, 3, 0)
+	require.NoError(t, err)
+	_, err = duels.Vote(ctx, duel.ID, 3, 1)
+	require.NoError(t, err)
+	_, err = duels.Vote(ctx, duel.ID, 4, 1)
+	require.NoError(t, err)
+
+	tally, err := duels.Tally(ctx, duel)
+	require.NoError(t, err)
+	assert.Equal(t, [2]int64{1, 3}, tally)
+
+	// Nothing is due before the window ends
+	results, err := duels.FinishDue(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	clk.Advance(time.Hour)
+	_, err = duels.Vote(ctx, duel.ID, 5, 0)
+	assert.ErrorIs(t, err, ErrDuelOver)
+
+	results, err = duels.FinishDue(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, ids[1], results[0].Winner())
+	assert.Equal(t, 555, results[0].Duel.MessageID)
+	assert.Equal(t, int64(1), results[0].Wins)
+
+	wins, err := duels.Wins(ctx, ids[1])
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), wins)
+
+	// Finished duels are settled once and free the chat for a new one
+	results, err = duels.FinishDue(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	_, err = duels.Start(ctx, -100123, ids[0], ids[1], time.Hour)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,186 @@
+package quotes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"gorm.io/gorm"
+)
+
+// DefaultEditWindow is how long after adding a quote its creator can change
+// or delete it without being an admin
+const DefaultEditWindow = 15 * time.Minute
+
+// editGuard decides who can change a quote: chat administrators always, and
+// the user who added it during the edit window
+type editGuard struct {
+	store  *Store
+	admins *telegram.AdminService
+	clock  clock.Clock
+	window time.Duration // Zero lets creators change their quotes at any time
+}
+
+// allow checks that the sender of msg can change quote, which verb names.
+// It returns who sent it, or the reason they cannot.
+func (g *editGuard) allow(ctx context.Context, b *bot.Bot, msg *models.Message, quote *Quote, verb string) (telegram.Actor, string, error) {
+	actor, err := telegram.ResolveActor(msg)
+	var refused *telegram.OriginError
+	if errors.As(err, &refused) {
+		return actor, refused.Error(), nil
+	}
+	if err != nil {
+		return actor, "", err
+	}
+
+	creator := !actor.AnonymousAdmin && g.store.createdBy(quote, actor.UserID)
+	if creator && g.inWindow(quote) {
+		return actor, "", nil
+	}
+	admin, err := g.admins.IsSenderAdmin(ctx, b, msg)
+	if err != nil {
+		return actor, "", fmt.Errorf("failed to check admin status: %w", err)
+	}
+	switch {
+	case admin:
+		return actor, "", nil
+	case creator:
+		return actor, fmt.Sprintf("You can only %s your quotes in the first %s after adding them. Ask a chat administrator to %s quote #%d.",
+			verb, windowText(g.window), verb, quote.ID), nil
+	}
+	return actor, fmt.Sprintf("Only the user who added the quote and chat administrators can %s it.", verb), nil
+}
+
+// inWindow reports whether the creator of quote can still change it
+func (g *editGuard) inWindow(quote *Quote) bool {
+	return g.window <= 0 || g.clock.Now().Sub(quote.CreatedAt) <= g.window
+}
+
+// windowText names an edit window, e.g. "15 minutes" or "2 hours"
+func windowText(d time.Duration) string {
+	switch {
+	case d == time.Hour:
+		return "hour"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	case d == time.Minute:
+		return "minute"
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	}
+	return d.String()
+}
+
+// delQuoteUsage explains the /delquote arguments
+const delQuoteUsage = "Usage: /delquote <quote id>, e.g. /delquote 42"
+
+// DelQuoteHandler handles the /delquote command
+type DelQuoteHandler struct {
+	store  *Store
+	outbox *outbox.Outbox
+	guard  *editGuard
+}
+
+// NewDelQuoteHandler creates a delquote handler letting creators delete
+// their quotes for DefaultEditWindow
+func NewDelQuoteHandler(db *gorm.DB) *DelQuoteHandler {
+	store := NewStore(db)
+	return &DelQuoteHandler{
+		store:  store,
+		outbox: outbox.New(db),
+		guard:  &editGuard{store: store, clock: clock.System{}, window: DefaultEditWindow},
+	}
+}
+
+// WithCreatorPolicy matches creators the way the policy stored them
+func (h *DelQuoteHandler) WithCreatorPolicy(policy CreatorPolicy) *DelQuoteHandler {
+	h.store.WithCreatorPolicy(policy)
+	return h
+}
+
+// WithEvents publishes the deleted quotes
+func (h *DelQuoteHandler) WithEvents(publisher events.Publisher) *DelQuoteHandler {
+	h.store.WithEvents(publisher)
+	return h
+}
+
+// WithAdmins checks admins against a shared cache of chat administrators
+func (h *DelQuoteHandler) WithAdmins(admins *telegram.AdminService) *DelQuoteHandler {
+	h.guard.admins = admins
+	return h
+}
+
+// WithEditWindow sets how long creators can delete their quotes; zero is
+// forever
+func (h *DelQuoteHandler) WithEditWindow(window time.Duration) *DelQuoteHandler {
+	h.guard.window = window
+	return h
+}
+
+// WithClock replaces the clock timing the edit window
+func (h *DelQuoteHandler) WithClock(clk clock.Clock) *DelQuoteHandler {
+	h.guard.clock = clk
+	return h
+}
+
+// Handle processes /delquote <quote id>. The user who added the quote can
+// delete it during the edit window, chat administrators at any time.
+func (h *DelQuoteHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	if args.Len() != 1 {
+		return sendNotice(ctx, h.outbox, b, chatID, delQuoteUsage)
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(args.Arg(0), "#"), 10, 64)
+	if err != nil {
+		return sendNotice(ctx, h.outbox, b, chatID, delQuoteUsage)
+	}
+
+	quote, err := h.store.GetByID(ctx, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && quote.ChatID != chatID) {
+		return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("Quote #%d not found in this chat.", id))
+	}
+	if err != nil {
+		return err
+	}
+
+	actor, denied, err := h.guard.allow(ctx, b, msg, quote, "delete")
+	if err != nil {
+		return err
+	}
+	if denied != "" {
+		return sendNotice(ctx, h.outbox, b, chatID, denied)
+	}
+
+	if err := h.store.Delete(ctx, quote.ID); err != nil {
+		return err
+	}
+	slog.Info("quote deleted", "audit", true, "chat_id", chatID, "user_id", actor.UserID, "anonymous_admin", actor.AnonymousAdmin, "quote_id", quote.ID)
+	return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("Quote #%d deleted.", quote.ID))
+}
+
+// Command returns the command name
+func (h *DelQuoteHandler) Command() string {
+	return "/delquote"
+}
+
+// Description returns the command description
+func (h *DelQuoteHandler) Description() string {
+	return "Delete a quote (its creator for a while after adding it, or admins)"
+}
@@ -0,0 +1,136 @@
+package quotes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestWindowText(t *testing.T) {
+	assert.Equal(t, "15 minutes", windowText(15*time.Minute))
+	assert.Equal(t, "minute", windowText(time.Minute))
+	assert.Equal(t, "hour", windowText(time.Hour))
+	assert.Equal(t, "2 hours", windowText(2*time.Hour))
+	assert.Equal(t, "1m30s", windowText(90*time.Second))
+}
+
+func TestEditGuard_InWindow(t *testing.T) {
+	created := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewMock(created.Add(10 * time.Minute))
+	guard := &editGuard{clock: clk, window: 15 * time.Minute}
+	quote := &Quote{CreatedAt: created}
+
+	assert.True(t, guard.inWindow(quote))
+	clk.Advance(5 * time.Minute)
+	assert.True(t, guard.inWindow(quote), "the window includes its last moment")
+	clk.Advance(time.Second)
+	assert.False(t, guard.inWindow(quote))
+
+	guard.window = 0
+	assert.True(t, guard.inWindow(quote), "no window, no limit")
+}
+
+func TestDelQuoteHandler_EditWindow(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	ctx := context.Background()
+	const chatID = -100123
+	created := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewMock(created.Add(time.Minute))
+	h.Register(NewDelQuoteHandler(h.DB.DB).WithClock(clk).WithEditWindow(10 * time.Minute))
+
+	store := NewStore(h.DB.DB)
+	storeQuote := func() *Quote {
+		quote, err := store.Store(ctx, StoreOptions{
+			ChatID:    chatID,
+			Creator:   map[string]interface{}{"id": h.User.ID},
+			Entries:   []CacheEntry{{ChatID: chatID, MessageID: 1, Message: datatypes.JSON(`{"text":"hi"}`)}},
+			CreatedAt: created,
+		})
+		require.NoError(t, err)
+		return quote
+	}
+
+	h.SendText(chatID, "/delquote")
+	assert.Equal(t, delQuoteUsage, h.LastReply())
+
+	// The creator can delete it while the window is open
+	recent := storeQuote()
+	h.SendText(chatID, "/delquote "+fmt.Sprint(recent.ID))
+	assert.Equal(t, "Quote #"+fmt.Sprint(recent.ID)+" deleted.", h.LastReply())
+	_, err := store.GetByID(ctx, recent.ID)
+	assert.Error(t, err)
+
+	// Afterwards only admins can
+	old := storeQuote()
+	clk.Advance(time.Hour)
+	h.SendText(chatID, "/delquote "+fmt.Sprint(old.ID))
+	assert.Equal(t, "You can only delete your quotes in the first 10 minutes after adding them. Ask a chat administrator to delete quote #"+fmt.Sprint(old.ID)+".", h.LastReply())
+	_, err = store.GetByID(ctx, old.ID)
+	require.NoError(t, err)
+
+	h.SetAdmin(chatID, h.User.ID)
+	h.SendText(chatID, "/delquote "+fmt.Sprint(old.ID))
+	assert.Equal(t, "Quote #"+fmt.Sprint(old.ID)+" deleted.", h.LastReply())
+}
+
+func TestDelQuoteHandler_NotCreator(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	const chatID = -100123
+	h.Register(NewDelQuoteHandler(h.DB.DB))
+
+	quote, err := NewStore(h.DB.DB).Store(context.Background(), StoreOptions{
+		ChatID:  chatID,
+		Creator: map[string]interface{}{"id": 2},
+		Entries: []CacheEntry{{ChatID: chatID, MessageID: 1, Message: datatypes.JSON(`{"text":"hi"}`)}},
+	})
+	require.NoError(t, err)
+
+	h.SendText(chatID, "/delquote "+fmt.Sprint(quote.ID))
+	assert.Equal(t, "Only the user who added the quote and chat administrators can delete it.", h.LastReply())
+
+	h.SendText(-100999, "/delquote "+fmt.Sprint(quote.ID))
+	assert.Equal(t, "Quote #"+fmt.Sprint(quote.ID)+" not found in this chat.", h.LastReply())
+}
+
+func TestDelQuoteHandler_CreatorOrAdmin(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	ctx := context.Background()
+	const chatID = -100123
+	created := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewMock(created.Add(30 * 24 * time.Hour))
+	h.Register(NewDelQuoteHandler(h.DB.DB).WithClock(clk).WithEditWindow(0))
+
+	store := NewStore(h.DB.DB)
+	storeQuote := func(creatorID int64) *Quote {
+		quote, err := store.Store(ctx, StoreOptions{
+			ChatID:    chatID,
+			Creator:   map[string]interface{}{"id": creatorID},
+			Entries:   []CacheEntry{{ChatID: chatID, MessageID: 1, Message: datatypes.JSON(`{"text":"hi"}`)}},
+			CreatedAt: created,
+		})
+		require.NoError(t, err)
+		return quote
+	}
+
+	// Without a window the creator can delete old quotes
+	own := storeQuote(h.User.ID)
+	h.SendText(chatID, "/delquote "+fmt.Sprint(own.ID))
+	assert.Equal(t, "Quote #"+fmt.Sprint(own.ID)+" deleted.", h.LastReply())
+
+	// And admins the quotes of anyone
+	other := storeQuote(2)
+	h.SendText(chatID, "/delquote "+fmt.Sprint(other.ID))
+	assert.Equal(t, "Only the user who added the quote and chat administrators can delete it.", h.LastReply())
+	h.SetAdmin(chatID, h.User.ID)
+	h.SendText(chatID, "/delquote #"+fmt.Sprint(other.ID))
+	assert.Equal(t, "Quote #"+fmt.Sprint(other.ID)+" deleted.", h.LastReply())
+	_, err := store.GetByID(ctx, other.ID)
+	assert.Error(t, err)
+}
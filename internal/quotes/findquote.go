@@ -0,0 +1,276 @@
+package quotes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/kv"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"gorm.io/gorm"
+)
+
+const (
+	// findCallbackPrefix prefixes the callback data of the private results
+	// button
+	findCallbackPrefix = "findquote:"
+	// FindQuoteDeepLinkPrefix prefixes the /start payload delivering search
+	// results to users who had not started a private chat with the bot
+	FindQuoteDeepLinkPrefix = "fq_"
+
+	findShown      = 5   // Results listed in the chat
+	findMaxResults = 200 // Results sent privately
+	findPageSize   = 20  // Results in each private message
+	findPreview    = 120 // UTF-16 code units of each quote shown
+	findResultsTTL = time.Hour
+)
+
+// findQuoteUsage explains the /findquote arguments
+const findQuoteUsage = "Usage: /findquote <words>, e.g. /findquote pizza friday"
+
+// pendingFind is a search whose full results can be sent privately to the
+// user who made it
+type pendingFind struct {
+	ChatID    int64  `json:"chat_id"`
+	ChatTitle string `json:"chat_title"`
+	Query     string `json:"query"`
+	UserID    int64  `json:"user_id"`
+}
+
+// FindQuoteHandler handles the /findquote command. Searches with more
+// results than fit in the chat offer to send all of them privately.
+type FindQuoteHandler struct {
+	store       *Store
+	renderer    *Renderer
+	outbox      *outbox.Outbox
+	pending     kv.Store // Searches whose results can still be sent privately
+	botUsername string   // Without @, for the deep link when a private chat is missing
+}
+
+// NewFindQuoteHandler creates a new findquote handler
+func NewFindQuoteHandler(db *gorm.DB) *FindQuoteHandler {
+	return &FindQuoteHandler{
+		store:    NewStore(db),
+		renderer: NewRenderer(),
+		outbox:   outbox.New(db),
+		pending:  kv.NewMemory(),
+	}
+}
+
+// WithStore keeps the searches in a store shared by every replica, so any
+// of them sends the results
+func (h *FindQuoteHandler) WithStore(store kv.Store) *FindQuoteHandler {
+	if store != nil {
+		h.pending = store
+	}
+	return h
+}
+
+// WithBotUsername links users who have not started a private chat with the
+// bot to one that delivers the results
+func (h *FindQuoteHandler) WithBotUsername(username string) *FindQuoteHandler {
+	h.botUsername = username
+	return h
+}
+
+// Handle processes /findquote <words>, listing the newest quotes of the chat
+// with a message containing every word
+func (h *FindQuoteHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+	slog.Info("executing /findquote command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	query := args.Raw
+	if query == "" {
+		return sendNotice(ctx, h.outbox, b, chatID, findQuoteUsage)
+	}
+
+	quotes, count, err := h.store.FindForChat(ctx, chatID, query, findShown)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("No quotes found with %q.", query))
+	}
+
+	lines := []string{fmt.Sprintf("🔎 %d quote(s) with %q:", count, query)}
+	lines = append(lines, h.previews(quotes)...)
+	reply := &outbox.Message{ChatID: chatID}
+	if more := count - int64(len(quotes)); more > 0 {
+		lines = append(lines, fmt.Sprintf("…and %d more.", more))
+		token, err := h.remember(ctx, pendingFind{ChatID: chatID, ChatTitle: msg.Chat.Title, Query: query, UserID: msg.From.ID})
+		if err != nil {
+			return err
+		}
+		reply.Keyboard = &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{
+			{Text: fmt.Sprintf("📬 Send all %d privately", count), CallbackData: findCallbackPrefix + "dm:" + token},
+		}}}
+	}
+	reply.Text = strings.Join(lines, "\n\n")
+	_, err = h.outbox.Send(ctx, b, reply)
+	return err
+}
+
+// HandleCallback processes the button sending the full results privately.
+// Users who have not started a private chat with the bot cannot be written
+// to, so they are sent to one through a deep link that delivers them.
+func (h *FindQuoteHandler) HandleCallback(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	query := update.CallbackQuery
+	if query == nil {
+		return nil
+	}
+	token := strings.TrimPrefix(query.Data, findCallbackPrefix+"dm:")
+	search, ok, err := h.lookup(ctx, token)
+	if err != nil {
+		return err
+	}
+	answer := &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID}
+	switch {
+	case !ok:
+		answer.Text, answer.ShowAlert = "These results expired, search again.", true
+	case search.UserID != query.From.ID:
+		answer.Text, answer.ShowAlert = "Only who searched can get these results privately.", true
+	}
+	if answer.Text != "" {
+		_, err := b.AnswerCallbackQuery(ctx, answer)
+		return err
+	}
+
+	// A chat action fails the same way a message would when the user has
+	// not started the bot or blocked it, without sending anything
+	_, err = b.SendChatAction(ctx, &bot.SendChatActionParams{ChatID: query.From.ID, Action: models.ChatActionTyping})
+	if errors.Is(err, bot.ErrorForbidden) {
+		if h.botUsername == "" {
+			answer.Text, answer.ShowAlert = "Start a private chat with me first, then press the button again.", true
+		} else {
+			answer.URL = fmt.Sprintf("https://t.me/%s?start=%s", url.PathEscape(h.botUsername), FindQuoteDeepLinkPrefix+token)
+		}
+		_, err := b.AnswerCallbackQuery(ctx, answer)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check the private chat: %w", err)
+	}
+
+	if _, ok, err := h.pending.Take(ctx, findCallbackPrefix+token); err != nil || !ok {
+		return err // Another press already sent them
+	}
+	if err := h.sendResults(ctx, b, query.From.ID, search); err != nil {
+		return err
+	}
+	answer.Text = "Sent you the results in a private chat."
+	_, err = b.AnswerCallbackQuery(ctx, answer)
+	return err
+}
+
+// OpenDeepLink delivers the results of a search through the /start deep link
+// the results button sends users without a private chat to. payload is the
+// /start payload without FindQuoteDeepLinkPrefix.
+func (h *FindQuoteHandler) OpenDeepLink(ctx context.Context, b *bot.Bot, msg *models.Message, payload string) error {
+	search, ok, err := h.lookup(ctx, payload)
+	if err != nil {
+		return err
+	}
+	if !ok || search.UserID != msg.From.ID {
+		return sendText(ctx, h.outbox, b, msg.Chat.ID, "These search results expired, search again with /findquote in the group.")
+	}
+	if _, ok, err := h.pending.Take(ctx, findCallbackPrefix+payload); err != nil || !ok {
+		return err
+	}
+	return h.sendResults(ctx, b, msg.Chat.ID, search)
+}
+
+// sendResults sends every result of a search to a private chat, a page of
+// results per message so none goes over Telegram's message length
+func (h *FindQuoteHandler) sendResults(ctx context.Context, b *bot.Bot, chatID int64, search pendingFind) error {
+	quotes, count, err := h.store.FindForChat(ctx, search.ChatID, search.Query, findMaxResults)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sendText(ctx, h.outbox, b, chatID, fmt.Sprintf("No quotes found with %q any more.", search.Query))
+	}
+	title := search.ChatTitle
+	if title == "" {
+		title = "the group"
+	}
+	slog.Info("sending search results privately", "chat_id", search.ChatID, "user_id", search.UserID, "results", len(quotes))
+
+	previews := h.previews(quotes)
+	pages := (len(previews) + findPageSize - 1) / findPageSize
+	for page := 0; page < pages; page++ {
+		end := min((page+1)*findPageSize, len(previews))
+		lines := []string{fmt.Sprintf("🔎 Quotes with %q in %s (%d/%d):", search.Query, title, page+1, pages)}
+		lines = append(lines, previews[page*findPageSize:end]...)
+		if more := count - int64(len(quotes)); page == pages-1 && more > 0 {
+			lines = append(lines, fmt.Sprintf("…and %d older ones. Add words to the search to narrow it.", more))
+		}
+		if err := sendText(ctx, h.outbox, b, chatID, strings.Join(lines, "\n\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// previews shortens each quote to a line starting with its ID
+func (h *FindQuoteHandler) previews(quotes []Quote) []string {
+	lines := make([]string, len(quotes))
+	for i := range quotes {
+		lines[i] = fmt.Sprintf("#%d %s", quotes[i].ID, quotePreview(h.renderer, &quotes[i], findPreview))
+	}
+	return lines
+}
+
+// remember keeps a search for findResultsTTL and returns its token
+func (h *FindQuoteHandler) remember(ctx context.Context, search pendingFind) (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate search token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+	value, err := json.Marshal(search)
+	if err != nil {
+		return "", err
+	}
+	if err := h.pending.Set(ctx, findCallbackPrefix+token, value, findResultsTTL); err != nil {
+		return "", fmt.Errorf("failed to store the search: %w", err)
+	}
+	return token, nil
+}
+
+// lookup returns the search of a token, and false once it expired
+func (h *FindQuoteHandler) lookup(ctx context.Context, token string) (pendingFind, bool, error) {
+	value, ok, err := h.pending.Get(ctx, findCallbackPrefix+token)
+	if err != nil || !ok {
+		return pendingFind{}, false, err
+	}
+	var search pendingFind
+	if err := json.Unmarshal(value, &search); err != nil {
+		return pendingFind{}, false, fmt.Errorf("invalid stored search: %w", err)
+	}
+	return search, true, nil
+}
+
+// Command returns the command name
+func (h *FindQuoteHandler) Command() string {
+	return "/findquote"
+}
+
+// Description returns the command description
+func (h *FindQuoteHandler) Description() string {
+	return "List the quotes containing some words"
+}
@@ -0,0 +1,115 @@
+package quotes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// findHarness registers a findquote handler with seven pizza quotes in
+// -100123, more than the chat is shown
+func findHarness(t *testing.T) (*testutils.BotHarness, *FindQuoteHandler, []uint) {
+	h := testutils.NewBotHarness(t)
+	handler := NewFindQuoteHandler(h.DB.DB).WithBotUsername("wanon_bot")
+	h.Register(handler)
+	h.RegisterCallback(findCallbackPrefix, testutils.HandlerFunc(handler.HandleCallback))
+
+	store := NewStore(h.DB.DB)
+	var ids []uint
+	for i := 1; i <= 7; i++ {
+		quote, err := store.Store(context.Background(), StoreOptions{
+			ChatID:  -100123,
+			Creator: map[string]interface{}{"id": 1},
+			Entries: []CacheEntry{{Message: datatypes.JSON(fmt.Sprintf(`{"text":"pizza number %d","from":{"first_name":"Bob"}}`, i))}},
+		})
+		require.NoError(t, err)
+		ids = append(ids, quote.ID)
+	}
+	return h, handler, ids
+}
+
+func TestFindQuoteHandler_Handle(t *testing.T) {
+	h, _, ids := findHarness(t)
+
+	h.SendText(-100123, "/findquote")
+	assert.Equal(t, findQuoteUsage, h.LastReply())
+	h.SendText(-100123, "/findquote sushi")
+	assert.Equal(t, `No quotes found with "sushi".`, h.LastReply())
+
+	h.SendText(-100123, "/findquote pizza")
+	reply := h.LastReply()
+	assert.True(t, strings.HasPrefix(reply, `🔎 7 quote(s) with "pizza":`+fmt.Sprintf("\n\n#%d Bob: pizza number 7", ids[6])), reply)
+	assert.Contains(t, reply, fmt.Sprintf("#%d Bob: pizza number 3\n\n…and 2 more.", ids[2]))
+	assert.NotContains(t, reply, "pizza number 2")
+	sent := h.Requests("sendMessage")
+	assert.Contains(t, sent[len(sent)-1].Params["reply_markup"], "Send all 7 privately")
+}
+
+func TestFindQuoteHandler_SendPrivately(t *testing.T) {
+	h, _, ids := findHarness(t)
+	h.SendText(-100123, "/findquote pizza")
+	results := &models.Message{ID: 50, Chat: models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}}
+	token := findToken(t, h)
+
+	// Only who searched gets them
+	owner := h.User
+	h.User = &models.User{ID: 2002, FirstName: "Bob"}
+	h.Press(results, findCallbackPrefix+"dm:"+token)
+	answers := h.Requests("answerCallbackQuery")
+	assert.Equal(t, "Only who searched can get these results privately.", answers[len(answers)-1].Params["text"])
+
+	h.User = owner
+	h.Press(results, findCallbackPrefix+"dm:"+token)
+	answers = h.Requests("answerCallbackQuery")
+	assert.Equal(t, "Sent you the results in a private chat.", answers[len(answers)-1].Params["text"])
+	private := h.LastReply()
+	assert.True(t, strings.HasPrefix(private, `🔎 Quotes with "pizza" in the group (1/1):`), private)
+	assert.Contains(t, private, fmt.Sprintf("#%d Bob: pizza number 1", ids[0]))
+	sent := h.Requests("sendMessage")
+	assert.Equal(t, fmt.Sprint(owner.ID), sent[len(sent)-1].Params["chat_id"])
+
+	// They are sent once
+	h.Press(results, findCallbackPrefix+"dm:"+token)
+	answers = h.Requests("answerCallbackQuery")
+	assert.Equal(t, "These results expired, search again.", answers[len(answers)-1].Params["text"])
+}
+
+func TestFindQuoteHandler_DeepLink(t *testing.T) {
+	h, handler, ids := findHarness(t)
+	h.SendText(-100123, "/findquote pizza")
+	results := &models.Message{ID: 50, Chat: models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}}
+	token := findToken(t, h)
+
+	// Users who never started the bot are sent to it
+	h.SetStarted(h.User.ID, false)
+	h.Press(results, findCallbackPrefix+"dm:"+token)
+	answers := h.Requests("answerCallbackQuery")
+	assert.Equal(t, "https://t.me/wanon_bot?start=fq_"+token, answers[len(answers)-1].Params["url"])
+
+	h.SetStarted(h.User.ID, true)
+	start := &models.Message{ID: 60, From: h.User, Chat: models.Chat{ID: h.User.ID, Type: models.ChatTypePrivate}, Text: "/start fq_" + token}
+	require.NoError(t, handler.OpenDeepLink(context.Background(), h.Bot, start, token))
+	assert.Contains(t, h.LastReply(), fmt.Sprintf("#%d Bob: pizza number 7", ids[6]))
+
+	require.NoError(t, handler.OpenDeepLink(context.Background(), h.Bot, start, token))
+	assert.Equal(t, "These search results expired, search again with /findquote in the group.", h.LastReply())
+}
+
+// findToken returns the search token of the last results button
+func findToken(t *testing.T, h *testutils.BotHarness) string {
+	t.Helper()
+	sent := h.Requests("sendMessage")
+	var markup models.InlineKeyboardMarkup
+	require.NoError(t, json.Unmarshal([]byte(sent[len(sent)-1].Params["reply_markup"]), &markup))
+	token, ok := strings.CutPrefix(markup.InlineKeyboard[0][0].CallbackData, findCallbackPrefix+"dm:")
+	require.True(t, ok)
+	return token
+}
@@ -0,0 +1,75 @@
+package quotes
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"gorm.io/gorm"
+)
+
+// fquoteUsage explains the /fquote arguments
+const fquoteUsage = "Usage: /fquote <words>, e.g. /fquote pizza friday"
+
+// FQuoteHandler handles the /fquote command
+type FQuoteHandler struct {
+	store  *Store
+	poster *quotePoster
+	outbox *outbox.Outbox
+}
+
+// NewFQuoteHandler creates a new fquote handler
+func NewFQuoteHandler(db *gorm.DB) *FQuoteHandler {
+	return &FQuoteHandler{
+		store:  NewStore(db),
+		poster: newQuotePoster(db),
+		outbox: outbox.New(db),
+	}
+}
+
+// WithCustomEmoji shows custom emoji in posted quotes instead of their
+// fallback emoji
+func (h *FQuoteHandler) WithCustomEmoji(enabled bool) *FQuoteHandler {
+	h.poster.customEmoji = enabled
+	return h
+}
+
+// Handle processes /fquote <words>, posting a random quote of the chat with
+// a message containing every word
+func (h *FQuoteHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+	slog.Info("executing /fquote command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	query := args.Raw
+	if query == "" {
+		return sendNotice(ctx, h.outbox, b, chatID, fquoteUsage)
+	}
+
+	quote, err := h.store.SearchForChat(ctx, chatID, query)
+	if err != nil {
+		return err
+	}
+	if quote == nil {
+		return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("No quotes found with %q.", query))
+	}
+	return h.poster.post(ctx, b, msg, quote)
+}
+
+// Command returns the command name
+func (h *FQuoteHandler) Command() string {
+	return "/fquote"
+}
+
+// Description returns the command description
+func (h *FQuoteHandler) Description() string {
+	return "Get a random quote containing some words"
+}
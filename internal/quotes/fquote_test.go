@@ -0,0 +1,65 @@
+package quotes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestStore_SearchForChat(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ctx := context.Background()
+
+	stored, err := store.Store(ctx, StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []CacheEntry{
+			{Message: datatypes.JSON(`{"text":"Who ordered the pizza?","from":{"first_name":"Bob"}}`)},
+			{Message: datatypes.JSON(`{"caption":"Friday again","from":{"first_name":"Ana"}}`)},
+		},
+	})
+	require.NoError(t, err)
+
+	// Every word, in any case, across the messages of a quote
+	found, err := store.SearchForChat(ctx, -100123, "PIZZA")
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	assert.Equal(t, stored.ID, found.ID)
+	assert.Len(t, found.Entries, 2)
+	found, err = store.SearchForChat(ctx, -100123, "friday")
+	require.NoError(t, err)
+	assert.NotNil(t, found)
+
+	found, err = store.SearchForChat(ctx, -100123, "pizza sushi")
+	require.NoError(t, err)
+	assert.Nil(t, found)
+	found, err = store.SearchForChat(ctx, -100999, "pizza")
+	require.NoError(t, err)
+	assert.Nil(t, found, "other chats' quotes are not searched")
+}
+
+func TestFQuoteHandler_Handle(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	h.Register(NewFQuoteHandler(h.DB.DB))
+
+	_, err := NewStore(h.DB.DB).Store(context.Background(), StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"pineapple on pizza","from":{"first_name":"Bob"}}`)}},
+	})
+	require.NoError(t, err)
+
+	h.SendText(-100123, "/fquote")
+	assert.Equal(t, fquoteUsage, h.LastReply())
+
+	h.SendText(-100123, "/fquote sushi")
+	assert.Equal(t, `No quotes found with "sushi".`, h.LastReply())
+
+	h.SendText(-100123, "/fquote Pizza")
+	assert.Contains(t, h.LastReply(), "Bob: pineapple on pizza")
+}
@@ -0,0 +1,615 @@
+package quotes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/settings"
+	"github.com/graffic/wanon-go/internal/textutil"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultGameWindow is how long quote game polls are open by default
+const DefaultGameWindow = 10 * time.Minute
+
+const (
+	gameOptions      = 4   // Candidate authors in a game poll, the right one included
+	gameAuthorPool   = 50  // Most quoted authors the wrong candidates are drawn from
+	gameOptionLength = 100 // Longest poll option Telegram takes, in UTF-16 code units
+	gameScoreLimit   = 10  // Players shown in /gamescore
+)
+
+// Game errors
+var (
+	ErrGameRunning  = errors.New("a quote game is already running in this chat")
+	ErrGameOver     = errors.New("the quote game is over")
+	ErrGameNotFound = errors.New("quote game not found")
+)
+
+// Game is a quote posted without its author and a poll of candidate
+// authors to guess it
+type Game struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	ChatID        int64      `gorm:"not null" json:"chat_id"`
+	QuoteID       uint       `gorm:"not null" json:"quote_id"`
+	AuthorName    string     `gorm:"not null" json:"author_name"`    // The answer, as the chat knows the author
+	CorrectOption int        `gorm:"not null" json:"correct_option"` // Poll option of the author
+	MessageID     int        `gorm:"not null;default:0" json:"message_id"`
+	PollMessageID int        `gorm:"not null;default:0" json:"poll_message_id"`
+	PollID        *string    `json:"poll_id"` // Nil until the poll is sent
+	EndsAt        time.Time  `gorm:"not null" json:"ends_at"`
+	FinishedAt    *time.Time `json:"finished_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// TableName specifies the table name for Game
+func (Game) TableName() string {
+	return "quote_game"
+}
+
+// GameAnswer is the option a user picked in a game
+type GameAnswer struct {
+	GameID    uint      `gorm:"primaryKey" json:"game_id"`
+	UserID    int64     `gorm:"primaryKey" json:"user_id"`
+	Name      string    `gorm:"not null" json:"name"` // Telegram name of the user when answering
+	OptionID  int       `gorm:"not null" json:"option_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for GameAnswer
+func (GameAnswer) TableName() string {
+	return "quote_game_answer"
+}
+
+// GameScore is how many games a user answered in a chat and how many they
+// guessed right
+type GameScore struct {
+	ChatID    int64     `gorm:"primaryKey" json:"chat_id"`
+	UserID    int64     `gorm:"primaryKey" json:"user_id"`
+	Name      string    `gorm:"not null" json:"name"` // Telegram name in their latest answer
+	Correct   int       `gorm:"not null" json:"correct"`
+	Played    int       `gorm:"not null" json:"played"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for GameScore
+func (GameScore) TableName() string {
+	return "quote_game_score"
+}
+
+// GameResult is the outcome of a finished game
+type GameResult struct {
+	Game    Game
+	Answers []GameAnswer
+}
+
+// Winners returns the answers that guessed the author
+func (r GameResult) Winners() []GameAnswer {
+	var winners []GameAnswer
+	for _, answer := range r.Answers {
+		if answer.OptionID == r.Game.CorrectOption {
+			winners = append(winners, answer)
+		}
+	}
+	return winners
+}
+
+// String reveals the author in the chat
+func (r GameResult) String() string {
+	text := fmt.Sprintf("🕵️ It was %s!", r.Game.AuthorName)
+	winners := r.Winners()
+	switch {
+	case len(r.Answers) == 0:
+		return text + " Nobody played."
+	case len(winners) == 0:
+		return text + " Nobody guessed it."
+	}
+	names := make([]string, 0, len(winners))
+	for _, winner := range winners {
+		names = append(names, winner.Name)
+	}
+	return text + fmt.Sprintf(" Guessed by %s, %d of %s.", strings.Join(names, ", "), len(winners), players(len(r.Answers)))
+}
+
+// players formats a player count
+func players(n int) string {
+	if n == 1 {
+		return "1 player"
+	}
+	return fmt.Sprintf("%d players", n)
+}
+
+// Games stores quote games, their answers and the leaderboards
+type Games struct {
+	db    *gorm.DB
+	clock clock.Clock
+}
+
+// NewGames creates a game store
+func NewGames(db *gorm.DB) *Games {
+	return &Games{db: db, clock: clock.System{}}
+}
+
+// WithClock replaces the clock deciding when games end
+func (g *Games) WithClock(clk clock.Clock) *Games {
+	g.clock = clk
+	return g
+}
+
+// Start opens a game on a quote of a chat for window. Chats run one game at
+// a time.
+func (g *Games) Start(ctx context.Context, chatID int64, quoteID uint, authorName string, correctOption int, window time.Duration) (*Game, error) {
+	var running int64
+	if err := g.db.WithContext(ctx).Model(&Game{}).
+		Where("chat_id = ? AND finished_at IS NULL", chatID).
+		Count(&running).Error; err != nil {
+		return nil, fmt.Errorf("failed to look for running games: %w", err)
+	}
+	if running > 0 {
+		return nil, ErrGameRunning
+	}
+
+	game := &Game{
+		ChatID:        chatID,
+		QuoteID:       quoteID,
+		AuthorName:    authorName,
+		CorrectOption: correctOption,
+		EndsAt:        g.clock.Now().Add(window),
+	}
+	if err := g.db.WithContext(ctx).Create(game).Error; err != nil {
+		return nil, fmt.Errorf("failed to create game: %w", err)
+	}
+	return game, nil
+}
+
+// Cancel deletes a game that never got its poll out, freeing the chat for
+// another one
+func (g *Games) Cancel(ctx context.Context, game *Game) error {
+	if err := g.db.WithContext(ctx).Delete(&Game{}, game.ID).Error; err != nil {
+		return fmt.Errorf("failed to cancel game %d: %w", game.ID, err)
+	}
+	return nil
+}
+
+// SetMessages records the quote and the poll of a game
+func (g *Games) SetMessages(ctx context.Context, game *Game, messageID, pollMessageID int, pollID string) error {
+	game.MessageID, game.PollMessageID, game.PollID = messageID, pollMessageID, &pollID
+	if err := g.db.WithContext(ctx).Model(game).Updates(map[string]interface{}{
+		"message_id":      messageID,
+		"poll_message_id": pollMessageID,
+		"poll_id":         pollID,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record game messages: %w", err)
+	}
+	return nil
+}
+
+// Answer records the option a user picked in the game of a poll, replacing
+// any earlier answer of theirs. No options takes the answer back.
+func (g *Games) Answer(ctx context.Context, pollID string, userID int64, name string, options []int) (*Game, error) {
+	var game Game
+	err := g.db.WithContext(ctx).Where("poll_id = ?", pollID).First(&game).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGameNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get game: %w", err)
+	}
+	if game.FinishedAt != nil || !g.clock.Now().Before(game.EndsAt) {
+		return nil, ErrGameOver
+	}
+
+	if len(options) == 0 {
+		if err := g.db.WithContext(ctx).Delete(&GameAnswer{}, "game_id = ? AND user_id = ?", game.ID, userID).Error; err != nil {
+			return nil, fmt.Errorf("failed to take back answer: %w", err)
+		}
+		return &game, nil
+	}
+	answer := GameAnswer{GameID: game.ID, UserID: userID, Name: name, OptionID: options[0]}
+	if err := g.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "game_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "option_id", "updated_at"}),
+	}).Create(&answer).Error; err != nil {
+		return nil, fmt.Errorf("failed to record answer: %w", err)
+	}
+	return &game, nil
+}
+
+// FinishDue settles every game whose poll is over, oldest first, adding
+// the answers to the leaderboards
+func (g *Games) FinishDue(ctx context.Context) ([]GameResult, error) {
+	var due []Game
+	if err := g.db.WithContext(ctx).
+		Where("finished_at IS NULL AND ends_at <= ?", g.clock.Now()).
+		Order("ends_at ASC").
+		Find(&due).Error; err != nil {
+		return nil, fmt.Errorf("failed to list finished games: %w", err)
+	}
+
+	results := make([]GameResult, 0, len(due))
+	for _, game := range due {
+		result, finished, err := g.finish(ctx, game)
+		if err != nil {
+			return results, err
+		}
+		if finished {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// finish closes a game and scores its answers. It reports false when
+// another replica finished it first.
+func (g *Games) finish(ctx context.Context, game Game) (GameResult, bool, error) {
+	result := GameResult{Game: game}
+	finished := false
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := g.clock.Now()
+		update := tx.Model(&Game{}).
+			Where("id = ? AND finished_at IS NULL", game.ID).
+			Update("finished_at", now)
+		if update.Error != nil || update.RowsAffected == 0 {
+			return update.Error
+		}
+		finished = true
+		result.Game.FinishedAt = &now
+
+		if err := tx.Where("game_id = ?", game.ID).Order("created_at, user_id").Find(&result.Answers).Error; err != nil {
+			return err
+		}
+		for _, answer := range result.Answers {
+			score := GameScore{ChatID: game.ChatID, UserID: answer.UserID, Name: answer.Name, Played: 1, UpdatedAt: now}
+			if answer.OptionID == game.CorrectOption {
+				score.Correct = 1
+			}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "chat_id"}, {Name: "user_id"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"name":       gorm.Expr("excluded.name"),
+					"correct":    gorm.Expr("quote_game_score.correct + excluded.correct"),
+					"played":     gorm.Expr("quote_game_score.played + 1"),
+					"updated_at": gorm.Expr("excluded.updated_at"),
+				}),
+			}).Create(&score).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return GameResult{}, false, fmt.Errorf("failed to finish game %d: %w", game.ID, err)
+	}
+	return result, finished, nil
+}
+
+// Leaderboard returns the players of a chat who guessed most authors, best
+// first; ties go to whoever needed fewer games
+func (g *Games) Leaderboard(ctx context.Context, chatID int64, limit int) ([]GameScore, error) {
+	var scores []GameScore
+	if err := g.db.WithContext(ctx).
+		Where("chat_id = ?", chatID).
+		Order("correct DESC, played ASC, user_id").
+		Limit(limit).
+		Find(&scores).Error; err != nil {
+		return nil, fmt.Errorf("failed to get game leaderboard: %w", err)
+	}
+	return scores, nil
+}
+
+// GetRandomSingleAuthor retrieves a random quote of a chat whose messages
+// were all sent by one user, merged users counting as one, or nil if there
+// is none
+func (s *Store) GetRandomSingleAuthor(ctx context.Context, chatID int64) (*Quote, error) {
+	return s.getRandom(ctx, `chat_id = ? AND id IN (
+		SELECT e.quote_id FROM quote_entry e
+		LEFT JOIN author_alias a ON a.chat_id = ? AND a.alias_id = (e.message->'from'->>'id')::bigint
+		WHERE e.deleted_at IS NULL
+		GROUP BY e.quote_id
+		HAVING count(e.message->'from'->>'id') = count(*)
+			AND bool_and(e.message->'sender_chat' IS NULL)
+			AND count(DISTINCT COALESCE(a.canonical_id, (e.message->'from'->>'id')::bigint)) = 1
+	)`, chatID, chatID)
+}
+
+// gameCandidates returns the poll options of a game: answer and up to
+// gameOptions-1 other authors of the chat drawn at random, in random
+// order, with the index of answer
+func gameCandidates(random clock.Random, answer string, others []string) ([]string, int) {
+	seen := map[string]bool{answer: true}
+	var pool []string
+	for _, name := range others {
+		if !seen[name] {
+			seen[name] = true
+			pool = append(pool, name)
+		}
+	}
+	for i := len(pool) - 1; i > 0; i-- {
+		j := random.Int64N(int64(i + 1))
+		pool[i], pool[j] = pool[j], pool[i]
+	}
+	options := pool[:min(len(pool), gameOptions-1)]
+	correct := int(random.Int64N(int64(len(options) + 1)))
+	options = append(options[:correct], append([]string{answer}, options[correct:]...)...)
+	return options, correct
+}
+
+// QuoteGameHandler handles the /quotegame command and the answers to its
+// polls
+type QuoteGameHandler struct {
+	db       *gorm.DB
+	store    *Store
+	games    *Games
+	renderer *Renderer
+	settings *settings.Service
+	outbox   *outbox.Outbox
+	random   clock.Random
+	window   time.Duration
+}
+
+// NewQuoteGameHandler creates a new quotegame handler
+func NewQuoteGameHandler(db *gorm.DB) *QuoteGameHandler {
+	return &QuoteGameHandler{
+		db:       db,
+		store:    NewStore(db),
+		games:    NewGames(db),
+		renderer: NewRenderer(),
+		settings: settings.NewService(db),
+		outbox:   outbox.New(db),
+		random:   clock.SystemRandom{},
+		window:   DefaultGameWindow,
+	}
+}
+
+// WithWindow sets how long game polls are open
+func (h *QuoteGameHandler) WithWindow(window time.Duration) *QuoteGameHandler {
+	if window > 0 {
+		h.window = window
+	}
+	return h
+}
+
+// Handle processes the /quotegame command, posting a random quote without
+// its author and a poll to guess who said it
+func (h *QuoteGameHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+	slog.Info("executing /quotegame command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	quote, err := h.store.GetRandomSingleAuthor(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if quote == nil {
+		return sendNotice(ctx, h.outbox, b, chatID, "The game needs quotes of at least two people. Add some with /addquote!")
+	}
+	authors, err := LoadAuthors(ctx, h.db, chatID)
+	if err != nil {
+		return err
+	}
+	entries, err := h.renderer.Entries(quote, authors)
+	if err != nil {
+		return err
+	}
+	counts, err := h.store.CountByAuthor(ctx, chatID, gameAuthorPool)
+	if err != nil {
+		return err
+	}
+	answer := entries[0].Author
+	others := make([]string, 0, len(counts))
+	for _, count := range counts {
+		if count.UserID != authors.Canonical(entries[0].UserID) {
+			others = append(others, authors.DisplayName(count.UserID, count.Name))
+		}
+	}
+	options, correct := gameCandidates(h.random, answer, others)
+	if len(options) < 2 {
+		return sendNotice(ctx, h.outbox, b, chatID, "The game needs quotes of at least two people. Add some with /addquote!")
+	}
+
+	game, err := h.games.Start(ctx, chatID, quote.ID, answer, correct, h.window)
+	if errors.Is(err, ErrGameRunning) {
+		return sendNotice(ctx, h.outbox, b, chatID, "A quote game is already running in this chat, answer that one first!")
+	}
+	if err != nil {
+		return err
+	}
+
+	// A game whose poll is not out would hold the chat until it ends
+	if err := h.post(ctx, b, msg, game, entries, options); err != nil {
+		if cancelErr := h.games.Cancel(ctx, game); cancelErr != nil {
+			slog.Error("failed to cancel quote game", "chat_id", chatID, "game_id", game.ID, "error", cancelErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// post sends the quote of a game without its author and the poll to guess
+// it, recording both in the game
+func (h *QuoteGameHandler) post(ctx context.Context, b *bot.Bot, msg *models.Message, game *Game, entries []RenderedEntry, options []string) error {
+	chatID := msg.Chat.ID
+	chatSettings, err := h.settings.Get(ctx, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to get chat settings: %w", err)
+	}
+	endsAt := game.EndsAt.In(chatSettings.Location(msg.From.LanguageCode))
+	lines := []string{fmt.Sprintf("🕵️ Who said it? Answer in the poll, the author is revealed at %s.", endsAt.Format("15:04")), ""}
+	for _, entry := range entries {
+		lines = append(lines, entry.Text)
+	}
+	sent, err := h.outbox.Send(ctx, b, &outbox.Message{ChatID: chatID, Text: strings.Join(lines, "\n")})
+	if err != nil {
+		return err
+	}
+
+	pollOptions := make([]models.InputPollOption, 0, len(options))
+	for _, option := range options {
+		pollOptions = append(pollOptions, models.InputPollOption{Text: textutil.Truncate(option, gameOptionLength)})
+	}
+	poll, err := b.SendPoll(ctx, &bot.SendPollParams{
+		ChatID:          chatID,
+		Question:        "Who said it?",
+		Options:         pollOptions,
+		IsAnonymous:     bot.False(),
+		ReplyParameters: &models.ReplyParameters{MessageID: sent.ID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send game poll: %w", err)
+	}
+	return h.games.SetMessages(ctx, game, sent.ID, poll.ID, poll.Poll.ID)
+}
+
+// HandlePollAnswer records an answer to a game poll. Answers to other polls
+// and to games already over are ignored.
+func (h *QuoteGameHandler) HandlePollAnswer(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	answer := update.PollAnswer
+	if answer == nil || answer.User == nil {
+		return nil // Anonymous admins answer as their chat, which cannot score
+	}
+	name := authorName(answer.User.FirstName, answer.User.LastName, answer.User.Username)
+	_, err := h.games.Answer(ctx, answer.PollID, answer.User.ID, name, answer.OptionIDs)
+	if errors.Is(err, ErrGameNotFound) || errors.Is(err, ErrGameOver) {
+		return nil
+	}
+	return err
+}
+
+// Command returns the command name
+func (h *QuoteGameHandler) Command() string {
+	return "/quotegame"
+}
+
+// Description returns the command description
+func (h *QuoteGameHandler) Description() string {
+	return "Guess who said a random quote"
+}
+
+// GameScoreHandler handles the /gamescore command
+type GameScoreHandler struct {
+	games  *Games
+	outbox *outbox.Outbox
+}
+
+// NewGameScoreHandler creates a new gamescore handler
+func NewGameScoreHandler(db *gorm.DB) *GameScoreHandler {
+	return &GameScoreHandler{games: NewGames(db), outbox: outbox.New(db)}
+}
+
+// Handle processes the /gamescore command, showing the players of the chat
+// who guessed most authors
+func (h *GameScoreHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+	slog.Info("executing /gamescore command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	scores, err := h.games.Leaderboard(ctx, chatID, gameScoreLimit)
+	if err != nil {
+		return err
+	}
+	if len(scores) == 0 {
+		return sendNotice(ctx, h.outbox, b, chatID, "Nobody has played yet. Start a game with /quotegame!")
+	}
+
+	lines := []string{"🕵️ Quote game leaderboard:"}
+	for i, score := range scores {
+		lines = append(lines, fmt.Sprintf("%d. %s: %d of %d guessed", i+1, score.Name, score.Correct, score.Played))
+	}
+	_, err = h.outbox.Send(ctx, b, &outbox.Message{ChatID: chatID, Text: strings.Join(lines, "\n")})
+	return err
+}
+
+// Command returns the command name
+func (h *GameScoreHandler) Command() string {
+	return "/gamescore"
+}
+
+// Description returns the command description
+func (h *GameScoreHandler) Description() string {
+	return "Show the quote game leaderboard of the chat"
+}
+
+// GameBot is the part of the Bot API used to reveal game results; *bot.Bot
+// implements it
+type GameBot interface {
+	outbox.Sender
+	StopPoll(ctx context.Context, params *bot.StopPollParams) (*models.Poll, error)
+}
+
+// GameReferee closes game polls when their window ends and reveals the
+// authors
+type GameReferee struct {
+	games  *Games
+	outbox *outbox.Outbox
+	bot    GameBot
+	logger *slog.Logger
+}
+
+// NewGameReferee creates a game referee
+func NewGameReferee(db *gorm.DB, b GameBot, logger *slog.Logger) *GameReferee {
+	return &GameReferee{
+		games:  NewGames(db),
+		outbox: outbox.New(db),
+		bot:    b,
+		logger: logger,
+	}
+}
+
+// Check finishes the games that are over, closing each poll and revealing
+// the author in reply to the quote
+func (r *GameReferee) Check(ctx context.Context) error {
+	results, err := r.games.FinishDue(ctx)
+	for _, result := range results {
+		game := result.Game
+		r.logger.Info("quote game finished", "chat_id", game.ChatID, "game_id", game.ID, "answers", len(result.Answers), "winners", len(result.Winners()))
+		if game.PollMessageID != 0 {
+			if _, err := r.bot.StopPoll(ctx, &bot.StopPollParams{
+				ChatID:    game.ChatID,
+				MessageID: game.PollMessageID,
+			}); err != nil {
+				r.logger.Warn("failed to close game poll", "game_id", game.ID, "error", err)
+			}
+		}
+		if _, err := r.outbox.Send(ctx, r.bot, &outbox.Message{
+			ChatID:           game.ChatID,
+			Text:             result.String(),
+			ReplyToMessageID: game.MessageID,
+		}); err != nil {
+			r.logger.Error("failed to reveal game answer", "game_id", game.ID, "error", err)
+		}
+	}
+	return err
+}
+
+// Start checks for finished games every interval until ctx is done
+func (r *GameReferee) Start(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := r.Check(ctx); err != nil {
+				r.logger.Error("failed to settle quote games", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package quotes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestGameCandidates(t *testing.T) {
+	random := clock.NewSeeded(1)
+	for range 20 {
+		options, correct := gameCandidates(random, "Alice", []string{"Bob", "Alice", "Carol", "Bob", "Dave", "Eve"})
+		require.Len(t, options, gameOptions)
+		assert.Equal(t, "Alice", options[correct])
+		seen := map[string]bool{}
+		for _, option := range options {
+			assert.False(t, seen[option], "%v has duplicates", options)
+			seen[option] = true
+		}
+	}
+
+	options, correct := gameCandidates(random, "Alice", []string{"Bob"})
+	assert.ElementsMatch(t, []string{"Alice", "Bob"}, options)
+	assert.Equal(t, "Alice", options[correct])
+
+	options, _ = gameCandidates(random, "Alice", []string{"Alice"})
+	assert.Equal(t, []string{"Alice"}, options, "a single author cannot be a game")
+}
+
+func TestGameResult_String(t *testing.T) {
+	game := Game{AuthorName: "Alice", CorrectOption: 2}
+
+	tests := []struct {
+		name     string
+		answers  []GameAnswer
+		expected string
+	}{
+		{"nobody played", nil, "🕵️ It was Alice! Nobody played."},
+		{"nobody guessed", []GameAnswer{{Name: "Bob", OptionID: 0}}, "🕵️ It was Alice! Nobody guessed it."},
+		{
+			"some guessed",
+			[]GameAnswer{{Name: "Bob", OptionID: 2}, {Name: "Carol", OptionID: 1}, {Name: "Dave", OptionID: 2}},
+			"🕵️ It was Alice! Guessed by Bob, Dave, 2 of 3 players.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, GameResult{Game: game, Answers: tt.answers}.String())
+		})
+	}
+}
+
+func TestStore_GetRandomSingleAuthor(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ctx := context.Background()
+
+	add := func(messages ...string) *Quote {
+		t.Helper()
+		entries := make([]CacheEntry, 0, len(messages))
+		for _, message := range messages {
+			entries = append(entries, CacheEntry{Message: datatypes.JSON(message)})
+		}
+		quote, err := store.Store(ctx, StoreOptions{ChatID: -100123, Creator: map[string]interface{}{"id": 1}, Entries: entries})
+		require.NoError(t, err)
+		return quote
+	}
+
+	// Quotes of two people, of a channel or without a sender are no game
+	add(`{"text":"hi","from":{"id":1,"first_name":"Alice"}}`, `{"text":"hey","from":{"id":2,"first_name":"Bob"}}`)
+	add(`{"text":"news","from":{"id":136817688,"first_name":"Channel"},"sender_chat":{"id":-100999,"title":"News"}}`)
+	add(`{"text":"nobody"}`)
+	quote, err := store.GetRandomSingleAuthor(ctx, -100123)
+	require.NoError(t, err)
+	assert.Nil(t, quote)
+
+	single := add(`{"text":"one","from":{"id":1,"first_name":"Alice"}}`, `{"text":"two","from":{"id":1,"first_name":"Alice"}}`)
+	quote, err = store.GetRandomSingleAuthor(ctx, -100123)
+	require.NoError(t, err)
+	require.NotNil(t, quote)
+	assert.Equal(t, single.ID, quote.ID)
+	assert.Len(t, quote.Entries, 2)
+}
+
+func TestGames(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	clk := clock.NewMock(time.Date(2024, time.March, 1, 20, 0, 0, 0, time.UTC))
+	games := NewGames(db.DB).WithClock(clk)
+	ctx := context.Background()
+
+	quote, err := store.Store(ctx, StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"hi","from":{"id":1,"first_name":"Alice"}}`)}},
+	})
+	require.NoError(t, err)
+
+	game, err := games.Start(ctx, -100123, quote.ID, "Alice", 1, 10*time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, games.SetMessages(ctx, game, 555, 556, "poll-1"))
+
+	// One game at a time per chat
+	_, err = games.Start(ctx, -100123, quote.ID, "Alice", 0, 10*time.Minute)
+	assert.ErrorIs(t, err, ErrGameRunning)
+
+	_, err = games.Answer(ctx, "poll-other", 2, "Bob", []int{1})
+	assert.ErrorIs(t, err, ErrGameNotFound)
+
+	// Answering again changes the answer, and no options take it back
+	for _, answer := range []struct {
+		userID  int64
+		name    string
+		options []int
+	}{
+		{2, "Bob", []int{0}},
+		{2, "Bobby", []int{1}},
+		{3, "Carol", []int{2}},
+		{4, "Dave", []int{1}},
+		{4, "Dave", nil},
+	} {
+		_, err := games.Answer(ctx, "poll-1", answer.userID, answer.name, answer.options)
+		require.NoError(t, err)
+	}
+
+	// Nothing is due before the window ends
+	results, err := games.FinishDue(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	clk.Advance(10 * time.Minute)
+	_, err = games.Answer(ctx, "poll-1", 5, "Eve", []int{1})
+	assert.ErrorIs(t, err, ErrGameOver)
+
+	results, err = games.FinishDue(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, 555, results[0].Game.MessageID)
+	assert.Len(t, results[0].Answers, 2)
+	require.Len(t, results[0].Winners(), 1)
+	assert.Equal(t, "Bobby", results[0].Winners()[0].Name)
+
+	// Finished games are settled once and free the chat for a new one
+	results, err = games.FinishDue(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	game, err = games.Start(ctx, -100123, quote.ID, "Alice", 0, 10*time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, games.SetMessages(ctx, game, 557, 558, "poll-2"))
+	_, err = games.Answer(ctx, "poll-2", 3, "Carol", []int{0})
+	require.NoError(t, err)
+	clk.Advance(10 * time.Minute)
+	_, err = games.FinishDue(ctx)
+	require.NoError(t, err)
+
+	scores, err := games.Leaderboard(ctx, -100123, 10)
+	require.NoError(t, err)
+	require.Len(t, scores, 2)
+	assert.Equal(t, GameScore{ChatID: -100123, UserID: 2, Name: "Bobby", Correct: 1, Played: 1}, withoutTime(scores[0]))
+	assert.Equal(t, GameScore{ChatID: -100123, UserID: 3, Name: "Carol", Correct: 1, Played: 2}, withoutTime(scores[1]))
+}
+
+// withoutTime clears the update time of a score to compare it
+func withoutTime(score GameScore) GameScore {
+	score.UpdatedAt = time.Time{}
+	return score
+}
+
+func TestQuoteGameHandler_PollFailureFreesTheChat(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	h.Register(NewQuoteGameHandler(h.DB.DB))
+	ctx := context.Background()
+
+	store := NewStore(h.DB.DB)
+	for i, name := range []string{"Alice", "Bob", "Carol"} {
+		_, err := store.Store(ctx, StoreOptions{
+			ChatID:  -100123,
+			Creator: map[string]interface{}{"id": 1},
+			Entries: []CacheEntry{{Message: datatypes.JSON(fmt.Sprintf(`{"text":"hi","from":{"id":%d,"first_name":%q}}`, i+1, name))}},
+		})
+		require.NoError(t, err)
+	}
+
+	h.Fail("sendPoll", "polls are not allowed in this chat")
+	group := models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}
+	err := h.Send(&models.Message{ID: 900, From: h.User, Chat: group, Text: "/quotegame"})
+	assert.ErrorContains(t, err, "failed to send game poll")
+	require.Len(t, h.Requests("sendPoll"), 1)
+
+	var games int64
+	require.NoError(t, h.DB.DB.Model(&Game{}).Where("chat_id = ?", -100123).Count(&games).Error)
+	assert.Zero(t, games, "the game is cancelled when its poll is not sent")
+
+	// The next game is not refused as already running
+	err = h.Send(&models.Message{ID: 901, From: h.User, Chat: group, Text: "/quotegame"})
+	assert.Error(t, err)
+	require.Len(t, h.Requests("sendPoll"), 2)
+	assert.NotContains(t, h.Replies(), "A quote game is already running in this chat, answer that one first!")
+}
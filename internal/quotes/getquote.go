@@ -0,0 +1,86 @@
+package quotes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"gorm.io/gorm"
+)
+
+// quoteUsage explains the /quote arguments
+const quoteUsage = "Usage: /quote <quote id>, e.g. /quote 42"
+
+// QuoteHandler handles the /quote command
+type QuoteHandler struct {
+	store  *Store
+	poster *quotePoster
+	outbox *outbox.Outbox
+}
+
+// NewQuoteHandler creates a new quote handler
+func NewQuoteHandler(db *gorm.DB) *QuoteHandler {
+	return &QuoteHandler{
+		store:  NewStore(db),
+		poster: newQuotePoster(db),
+		outbox: outbox.New(db),
+	}
+}
+
+// WithCustomEmoji shows custom emoji in posted quotes instead of their
+// fallback emoji
+func (h *QuoteHandler) WithCustomEmoji(enabled bool) *QuoteHandler {
+	h.poster.customEmoji = enabled
+	return h
+}
+
+// Handle processes /quote <quote id>, posting that quote of the chat
+func (h *QuoteHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	args, ok := botcmd.ParseArgs(msg.Text)
+	if !ok || args.Command != "quote" {
+		return nil // /quotefrom and the other /quote… commands
+	}
+	chatID := msg.Chat.ID
+	slog.Info("executing /quote command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	if args.Len() != 1 {
+		return sendNotice(ctx, h.outbox, b, chatID, quoteUsage)
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(args.Arg(0), "#"), 10, 64)
+	if err != nil || id == 0 {
+		return sendNotice(ctx, h.outbox, b, chatID, quoteUsage)
+	}
+
+	quote, err := h.store.GetByID(ctx, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("There is no quote #%d.", id))
+	}
+	if err != nil {
+		return err
+	}
+	if quote.ChatID != chatID {
+		return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("Quote #%d belongs to another chat.", id))
+	}
+	return h.poster.post(ctx, b, msg, quote)
+}
+
+// Command returns the command name
+func (h *QuoteHandler) Command() string {
+	return "/quote"
+}
+
+// Description returns the command description
+func (h *QuoteHandler) Description() string {
+	return "Get a quote by its number"
+}
@@ -0,0 +1,44 @@
+package quotes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestQuoteHandler_Handle(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	h.Register(NewQuoteHandler(h.DB.DB))
+
+	store := NewStore(h.DB.DB)
+	quote, err := store.Store(context.Background(), StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"the one","from":{"first_name":"Bob"}}`)}},
+	})
+	require.NoError(t, err)
+	id := fmt.Sprint(quote.ID)
+
+	h.SendText(-100123, "/quote")
+	assert.Equal(t, quoteUsage, h.LastReply())
+	h.SendText(-100123, "/quote forty-two")
+	assert.Equal(t, quoteUsage, h.LastReply())
+
+	h.SendText(-100123, "/quote #"+id)
+	assert.Contains(t, h.LastReply(), "#"+id)
+	assert.Contains(t, h.LastReply(), "Bob: the one")
+
+	h.SendText(-100999, "/quote "+id)
+	assert.Equal(t, "Quote #"+id+" belongs to another chat.", h.LastReply())
+	h.SendText(-100123, "/quote 999999")
+	assert.Equal(t, "There is no quote #999999.", h.LastReply())
+
+	replies := len(h.Replies())
+	h.SendText(-100123, "/quotefrom 2020")
+	assert.Len(t, h.Replies(), replies, "other /quote… commands are left alone")
+}
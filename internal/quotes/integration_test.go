@@ -3,8 +3,12 @@ package quotes
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"testing"
+	"time"
 
+	"github.com/graffic/wanon-go/internal/cache"
 	"github.com/graffic/wanon-go/internal/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -60,7 +64,7 @@ func TestQuotesIntegration_AddAndRetrieve(t *testing.T) {
 	assert.Equal(t, quote.ID, randomQuote.ID)
 
 	// Verify the quote can be rendered
-	rendered, err := rQuote.renderer.RenderWithDate(randomQuote)
+	rendered, err := rQuote.poster.renderer.RenderWithDate(randomQuote)
 	require.NoError(t, err)
 	assert.Contains(t, rendered, "Original")
 	assert.Contains(t, rendered, "Message to quote")
@@ -116,7 +120,7 @@ func TestQuotesIntegration_MultipleQuotes(t *testing.T) {
 		require.NoError(t, err)
 		require.NotNil(t, randomQuote)
 
-		rendered, err := rQuote.renderer.RenderWithDate(randomQuote)
+		rendered, err := rQuote.poster.renderer.RenderWithDate(randomQuote)
 		require.NoError(t, err)
 
 		// Track which quotes we found
@@ -213,3 +217,32 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestQuotesIntegration_CompactedCustomEmoji(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+
+	// Cached long before it is quoted, with a keyboard compaction drops
+	date := time.Now().Add(-12 * time.Hour).Unix()
+	entry := CacheEntry{
+		ChatID:    -100123,
+		MessageID: 1,
+		Date:      date,
+		Message: datatypes.JSON(fmt.Sprintf(`{"message_id":1,"chat":{"id":-100123},"date":%d,"text":"nice 👍",
+			"from":{"id":1,"first_name":"Alice"},"reply_markup":{"inline_keyboard":[]},
+			"entities":[{"type":"custom_emoji","offset":5,"length":2,"custom_emoji_id":"111"}]}`, date)),
+	}
+	require.NoError(t, db.DB.Create(&entry).Error)
+
+	cleaner := cache.NewCleaner(cache.NewService(db.DB), cache.Config{KeepDuration: 48 * time.Hour, CompactAfter: 6 * time.Hour}, slog.Default())
+	require.NoError(t, cleaner.CleanOnce(ctx))
+
+	result, err := NewBuilder(db.DB).BuildFrom(ctx, -100123, 1)
+	require.NoError(t, err)
+	assert.NotContains(t, string(result.Entries[0].Message), "reply_markup")
+
+	quote := &Quote{ID: 1, Entries: []QuoteEntry{{Order: 0, Message: result.Entries[0].Message}}}
+	rendered, err := NewRenderer().Render(RenderOptions{Quote: quote, CustomEmoji: true})
+	require.NoError(t, err)
+	assert.Equal(t, `Alice: nice <tg-emoji emoji-id="111">👍</tg-emoji>`, rendered.Text)
+}
@@ -0,0 +1,166 @@
+package quotes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/message"
+	"github.com/graffic/wanon-go/internal/outbox"
+)
+
+// JunkGuard is what /addquote does with targets that are usually quoted by
+// mistake: commands, the bot's own messages and empty messages
+type JunkGuard string
+
+const (
+	// JunkOff quotes them like any other message
+	JunkOff JunkGuard = "off"
+	// JunkRefuse does not quote them
+	JunkRefuse JunkGuard = "refuse"
+	// JunkConfirm asks the quoter to confirm with a button
+	JunkConfirm JunkGuard = "confirm"
+)
+
+// JunkGuards returns the supported junk guards
+func JunkGuards() []JunkGuard {
+	return []JunkGuard{JunkOff, JunkRefuse, JunkConfirm}
+}
+
+// ParseJunkGuard parses a junk guard, confirm when empty
+func ParseJunkGuard(text string) (JunkGuard, error) {
+	switch guard := JunkGuard(text); guard {
+	case "":
+		return JunkConfirm, nil
+	case JunkOff, JunkRefuse, JunkConfirm:
+		return guard, nil
+	}
+	return "", fmt.Errorf("unknown junk guard %q, expected one of %v", text, JunkGuards())
+}
+
+// junkCallbackPrefix prefixes the callback data of the confirmation buttons
+const junkCallbackPrefix = "addquote:"
+
+// junkConfirmationTTL is how long a junk confirmation stays valid
+const junkConfirmationTTL = 5 * time.Minute
+
+// junkReason returns why quoting target is probably a mistake, or "" when
+// it looks like a message worth quoting
+func junkReason(b *bot.Bot, target *models.Message) string {
+	msg := message.FromTelegram(target)
+	switch {
+	case target.From != nil && target.From.IsBot && target.From.ID == b.ID():
+		return "That message is mine"
+	case isCommand(msg.Text):
+		return "That message is a bot command"
+	case strings.TrimSpace(msg.Body()) == "" && !msg.HasMedia():
+		return "That message has nothing to quote"
+	}
+	return ""
+}
+
+// isCommand reports whether text is a bot command such as /rquote
+func isCommand(text string) bool {
+	command, _, _ := strings.Cut(text, " ")
+	return len(command) > 1 && command[0] == '/' && !strings.Contains(command[1:], "/")
+}
+
+// pendingJunk is an /addquote waiting for its quoter to confirm it
+type pendingJunk struct {
+	Command *models.Message `json:"command"` // The /addquote message, with its target
+}
+
+// confirmJunk asks the quoter whether to quote the target anyway
+func (h *AddQuoteHandler) confirmJunk(ctx context.Context, b *bot.Bot, msg *models.Message, reason string) error {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("failed to generate confirmation token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+	value, err := json.Marshal(pendingJunk{Command: msg})
+	if err != nil {
+		return err
+	}
+	if err := h.pending.Set(ctx, junkCallbackPrefix+token, value, junkConfirmationTTL); err != nil {
+		return fmt.Errorf("failed to store the quote confirmation: %w", err)
+	}
+
+	_, err = h.outbox.Send(ctx, b, &outbox.Message{
+		ChatID: msg.Chat.ID,
+		Text:   reason + ", are you sure you want to quote it?",
+		Keyboard: &models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{{
+				{Text: "Quote it anyway", CallbackData: junkCallbackPrefix + "confirm:" + token},
+				{Text: "Cancel", CallbackData: junkCallbackPrefix + "cancel:" + token},
+			}},
+		},
+	})
+	return err
+}
+
+// HandleCallback processes the buttons confirming a quote of a command, a
+// message of the bot or an empty message
+func (h *AddQuoteHandler) HandleCallback(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil {
+		return nil
+	}
+	action, token, _ := strings.Cut(strings.TrimPrefix(query.Data, junkCallbackPrefix), ":")
+	key := junkCallbackPrefix + token
+
+	value, ok, err := h.pending.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	var pending pendingJunk
+	if ok {
+		if err := json.Unmarshal(value, &pending); err != nil {
+			return fmt.Errorf("invalid quote confirmation: %w", err)
+		}
+	}
+	switch {
+	case !ok || pending.Command == nil || pending.Command.From == nil:
+		return h.finishJunk(ctx, b, query, "This confirmation expired, run /addquote again.")
+	case pending.Command.From.ID != query.From.ID:
+		_, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            "Only who asked for the quote can confirm it.",
+			ShowAlert:       true,
+		})
+		return err
+	}
+	// Another replica may have taken it in between
+	if _, ok, err := h.pending.Take(ctx, key); err != nil || !ok {
+		return err
+	}
+	if action == "cancel" {
+		return h.finishJunk(ctx, b, query, "Not quoted.")
+	}
+
+	slog.Info("quote confirmed", "chat_id", pending.Command.Chat.ID, "user_id", query.From.ID)
+	if err := h.finishJunk(ctx, b, query, "Quoting it anyway."); err != nil {
+		return err
+	}
+	return h.add(ctx, b, pending.Command, true)
+}
+
+// finishJunk answers the callback and replaces the confirmation message
+func (h *AddQuoteHandler) finishJunk(ctx context.Context, b *bot.Bot, query *models.CallbackQuery, text string) error {
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID}); err != nil {
+		return err
+	}
+	confirmation := query.Message.Message
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    confirmation.Chat.ID,
+		MessageID: confirmation.ID,
+		Text:      text,
+	})
+	return err
+}
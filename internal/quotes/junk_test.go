@@ -0,0 +1,97 @@
+package quotes
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/cache"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJunkGuard(t *testing.T) {
+	guard, err := ParseJunkGuard("")
+	require.NoError(t, err)
+	assert.Equal(t, JunkConfirm, guard)
+	guard, err = ParseJunkGuard("refuse")
+	require.NoError(t, err)
+	assert.Equal(t, JunkRefuse, guard)
+	_, err = ParseJunkGuard("warn")
+	assert.Error(t, err)
+}
+
+func TestJunkReason(t *testing.T) {
+	b, err := bot.New("4242:token", bot.WithSkipGetMe())
+	require.NoError(t, err)
+	user := &models.User{ID: 1, FirstName: "Ana"}
+
+	assert.Empty(t, junkReason(b, &models.Message{From: user, Text: "pizza time"}))
+	assert.Empty(t, junkReason(b, &models.Message{From: user, Text: "a/b testing"}))
+	assert.Empty(t, junkReason(b, &models.Message{From: user, Caption: "", Photo: []models.PhotoSize{{FileID: "AgAD"}}}))
+	assert.Empty(t, junkReason(b, &models.Message{From: &models.User{ID: 7, IsBot: true}, Text: "other bots are fine"}))
+
+	assert.Equal(t, "That message is a bot command", junkReason(b, &models.Message{From: user, Text: "/rquote"}))
+	assert.Equal(t, "That message is a bot command", junkReason(b, &models.Message{From: user, Text: "/rquote@wanonbot -#nsfw"}))
+	assert.Equal(t, "That message is mine", junkReason(b, &models.Message{From: &models.User{ID: 4242, IsBot: true}, Text: "Quote #1 added with 1 entries!"}))
+	assert.Equal(t, "That message has nothing to quote", junkReason(b, &models.Message{From: user, Text: "  "}))
+}
+
+func TestAddQuoteHandler_JunkRefuse(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	h.Register(NewAddQuoteHandler(h.DB.DB).WithJunkGuard(JunkRefuse))
+
+	command := h.SendText(-100123, "/rquote")
+	h.ReplyText(command, "/addquote")
+	assert.Equal(t, "That message is a bot command, so it was not quoted.", h.LastReply())
+}
+
+func TestAddQuoteHandler_JunkConfirm(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h.Use(cache.NewMiddleware(cache.NewService(h.DB.DB), logger).BotMiddleware())
+	handler := NewAddQuoteHandler(h.DB.DB)
+	h.Register(handler)
+	h.RegisterCallback(junkCallbackPrefix, testutils.HandlerFunc(handler.HandleCallback))
+
+	command := h.SendText(-100123, "/rquote")
+	h.ReplyText(command, "/addquote")
+	assert.Equal(t, "That message is a bot command, are you sure you want to quote it?", h.LastReply())
+	keyboard := h.Requests("sendMessage")[0].Params["reply_markup"]
+	token := junkToken(t, keyboard)
+	confirmation := &models.Message{ID: 100, Chat: models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}}
+
+	// Only the quoter can confirm
+	owner := h.User
+	h.User = &models.User{ID: 2002, FirstName: "Bob"}
+	h.Press(confirmation, junkCallbackPrefix+"confirm:"+token)
+	answers := h.Requests("answerCallbackQuery")
+	assert.Equal(t, "Only who asked for the quote can confirm it.", answers[len(answers)-1].Params["text"])
+
+	h.User = owner
+	h.Press(confirmation, junkCallbackPrefix+"confirm:"+token)
+	assert.Equal(t, "Quoting it anyway.", h.Requests("editMessageText")[0].Params["text"])
+	assert.Equal(t, "Quote #1 added with 1 entries!", h.LastReply())
+
+	// A confirmation works once
+	h.Press(confirmation, junkCallbackPrefix+"confirm:"+token)
+	edits := h.Requests("editMessageText")
+	assert.Equal(t, "This confirmation expired, run /addquote again.", edits[len(edits)-1].Params["text"])
+}
+
+// junkToken returns the confirmation token in the callback data of a
+// keyboard
+func junkToken(t *testing.T, keyboard string) string {
+	t.Helper()
+	var markup models.InlineKeyboardMarkup
+	require.NoError(t, json.Unmarshal([]byte(keyboard), &markup))
+	data := markup.InlineKeyboard[0][0].CallbackData
+	token, ok := strings.CutPrefix(data, junkCallbackPrefix+"confirm:")
+	require.True(t, ok, data)
+	return token
+}
@@ -0,0 +1,152 @@
+package quotes
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"gorm.io/gorm"
+)
+
+// listCallbackPrefix prefixes the callback data of the /listquotes page
+// buttons, followed by the page number
+const listCallbackPrefix = "listquotes:"
+
+const (
+	listPageSize = 10  // Quotes on each page
+	listPreview  = 120 // UTF-16 code units of each quote shown
+)
+
+// ListQuotesHandler handles the /listquotes command, which lists the quotes
+// of a chat a page at a time
+type ListQuotesHandler struct {
+	store    *Store
+	renderer *Renderer
+	outbox   *outbox.Outbox
+}
+
+// NewListQuotesHandler creates a new listquotes handler
+func NewListQuotesHandler(db *gorm.DB) *ListQuotesHandler {
+	return &ListQuotesHandler{
+		store:    NewStore(db),
+		renderer: NewRenderer(),
+		outbox:   outbox.New(db),
+	}
+}
+
+// Handle processes /listquotes, replying with the first page of quotes
+func (h *ListQuotesHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+	slog.Info("executing /listquotes command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	list, err := h.page(ctx, chatID, 0)
+	if err != nil {
+		return err
+	}
+	if list.empty {
+		return sendNotice(ctx, h.outbox, b, chatID, list.text)
+	}
+	reply := &outbox.Message{ChatID: chatID, Text: list.text}
+	if len(list.keyboard.InlineKeyboard) > 0 {
+		reply.Keyboard = list.keyboard
+	}
+	_, err = h.outbox.Send(ctx, b, reply)
+	return err
+}
+
+// HandleCallback processes the Prev and Next buttons, replacing the list
+// with the page they point to. Only quotes of the chat the list is in are
+// shown, whatever the callback data says.
+func (h *ListQuotesHandler) HandleCallback(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil {
+		return nil
+	}
+	message := query.Message.Message
+	page, err := strconv.Atoi(strings.TrimPrefix(query.Data, listCallbackPrefix))
+	if err != nil || page < 0 {
+		return nil
+	}
+
+	list, err := h.page(ctx, message.Chat.ID, page)
+	if err != nil {
+		return err
+	}
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID}); err != nil {
+		return err
+	}
+	// An empty keyboard removes the buttons of a list down to one page
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      message.Chat.ID,
+		MessageID:   message.ID,
+		Text:        list.text,
+		ReplyMarkup: list.keyboard,
+	})
+	return err
+}
+
+// quoteList is a rendered page of /listquotes
+type quoteList struct {
+	text     string
+	keyboard *models.InlineKeyboardMarkup // The Prev and Next buttons, if any
+	empty    bool                         // The chat has no quotes
+}
+
+// page renders a page of the quotes of a chat, newest first, and its
+// navigation buttons. Pages past the end, left by deleted quotes, show the
+// last one.
+func (h *ListQuotesHandler) page(ctx context.Context, chatID int64, page int) (quoteList, error) {
+	quotes, count, err := h.store.ListForChat(ctx, chatID, page*listPageSize, listPageSize)
+	if err != nil {
+		return quoteList{}, err
+	}
+	keyboard := &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{}}
+	if count == 0 {
+		return quoteList{text: "There are no quotes yet. Reply to a message with /addquote to add one.", keyboard: keyboard, empty: true}, nil
+	}
+	pages := int((count + listPageSize - 1) / listPageSize)
+	if page >= pages {
+		page = pages - 1
+		quotes, count, err = h.store.ListForChat(ctx, chatID, page*listPageSize, listPageSize)
+		if err != nil {
+			return quoteList{}, err
+		}
+	}
+
+	first := page*listPageSize + 1
+	lines := []string{fmt.Sprintf("📜 Quotes %d–%d of %d (page %d/%d):", first, first+len(quotes)-1, count, page+1, pages)}
+	for i := range quotes {
+		lines = append(lines, fmt.Sprintf("#%d %s", quotes[i].ID, quotePreview(h.renderer, &quotes[i], listPreview)))
+	}
+
+	var buttons []models.InlineKeyboardButton
+	if page > 0 {
+		buttons = append(buttons, models.InlineKeyboardButton{Text: "◀️ Prev", CallbackData: fmt.Sprintf("%s%d", listCallbackPrefix, page-1)})
+	}
+	if page < pages-1 {
+		buttons = append(buttons, models.InlineKeyboardButton{Text: "Next ▶️", CallbackData: fmt.Sprintf("%s%d", listCallbackPrefix, page+1)})
+	}
+	if len(buttons) > 0 {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, buttons)
+	}
+	return quoteList{text: strings.Join(lines, "\n\n"), keyboard: keyboard}, nil
+}
+
+// Command returns the command name
+func (h *ListQuotesHandler) Command() string {
+	return "/listquotes"
+}
+
+// Description returns the command description
+func (h *ListQuotesHandler) Description() string {
+	return "List the quotes of the chat, 10 at a time"
+}
@@ -0,0 +1,95 @@
+package quotes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestStore_ListForChat(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ctx := context.Background()
+
+	var ids []uint
+	for i := 0; i < 3; i++ {
+		quote, err := store.Store(ctx, StoreOptions{
+			ChatID:  -100123,
+			Creator: map[string]interface{}{"id": 1},
+			Entries: []CacheEntry{{Message: datatypes.JSON(fmt.Sprintf(`{"text":"quote %d"}`, i))}},
+		})
+		require.NoError(t, err)
+		ids = append(ids, quote.ID)
+	}
+
+	quotes, count, err := store.ListForChat(ctx, -100123, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+	require.Len(t, quotes, 2)
+	assert.Equal(t, ids[1], quotes[0].ID, "newest first, past the offset")
+	assert.Equal(t, ids[0], quotes[1].ID)
+	assert.Len(t, quotes[0].Entries, 1)
+
+	quotes, count, err = store.ListForChat(ctx, -100999, 0, 10)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	assert.Empty(t, quotes)
+}
+
+func TestListQuotesHandler(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	list := NewListQuotesHandler(h.DB.DB)
+	h.Register(list)
+	h.RegisterCallback(listCallbackPrefix, testutils.HandlerFunc(list.HandleCallback))
+
+	h.SendText(-100123, "/listquotes")
+	assert.Contains(t, h.LastReply(), "There are no quotes yet.")
+
+	store := NewStore(h.DB.DB)
+	var ids []uint
+	for i := 0; i < 12; i++ {
+		quote, err := store.Store(context.Background(), StoreOptions{
+			ChatID:  -100123,
+			Creator: map[string]interface{}{"id": 1},
+			Entries: []CacheEntry{{Message: datatypes.JSON(fmt.Sprintf(`{"text":"quote %d","from":{"first_name":"Bob"}}`, i))}},
+		})
+		require.NoError(t, err)
+		ids = append(ids, quote.ID)
+	}
+
+	// The first page has the newest quotes and only a Next button
+	h.SendText(-100123, "/listquotes")
+	assert.Contains(t, h.LastReply(), "📜 Quotes 1–10 of 12 (page 1/2):")
+	assert.Contains(t, h.LastReply(), fmt.Sprintf("#%d Bob: quote 11", ids[11]))
+	assert.NotContains(t, h.LastReply(), fmt.Sprintf("#%d ", ids[1]))
+	sent := h.Requests("sendMessage")
+	markup := sent[len(sent)-1].Params["reply_markup"]
+	assert.Contains(t, markup, "listquotes:1")
+	assert.NotContains(t, markup, "Prev")
+
+	// Next shows the rest, with a Prev button
+	group := &models.Message{ID: 500, Chat: models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}}
+	h.Press(group, "listquotes:1")
+	edits := h.Requests("editMessageText")
+	require.Len(t, edits, 1)
+	assert.Contains(t, edits[0].Params["text"], "📜 Quotes 11–12 of 12 (page 2/2):")
+	assert.Contains(t, edits[0].Params["text"], fmt.Sprintf("#%d Bob: quote 0", ids[0]))
+	assert.Contains(t, edits[0].Params["reply_markup"], "listquotes:0")
+	assert.NotContains(t, edits[0].Params["reply_markup"], "Next")
+	assert.Len(t, h.Requests("answerCallbackQuery"), 1)
+
+	// Pages past the end show the last one
+	h.Press(group, "listquotes:7")
+	assert.Contains(t, h.Requests("editMessageText")[1].Params["text"], "(page 2/2)")
+
+	// Buttons only list the quotes of the chat they are in
+	other := &models.Message{ID: 501, Chat: models.Chat{ID: -100999, Type: models.ChatTypeSupergroup}}
+	h.Press(other, "listquotes:0")
+	assert.Contains(t, h.Requests("editMessageText")[2].Params["text"], "There are no quotes yet.")
+}
@@ -3,6 +3,7 @@ package quotes
 import (
 	"time"
 
+	"github.com/graffic/wanon-go/internal/message"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
@@ -13,6 +14,12 @@ type Quote struct {
 	Creator   datatypes.JSON `gorm:"type:jsonb;not null" json:"creator"` // Telegram User who created the quote
 	ChatID    int64          `gorm:"index;not null" json:"chat_id"`
 	CreatedAt time.Time      `json:"created_at"`
+	// QuotedAt is the date of the first entry, when the quoted conversation
+	// happened. Nil for quotes stored without it.
+	QuotedAt *time.Time `json:"quoted_at,omitempty"`
+	// HasMedia marks quotes with a photo, video or other file in an entry,
+	// kept up to date as entries are stored for /rquote media
+	HasMedia bool `gorm:"not null;default:false" json:"has_media,omitempty"`
 
 	// Associations - entries are ordered by the Order field in QuoteEntry
 	Entries []QuoteEntry `gorm:"foreignKey:QuoteID;constraint:OnDelete:CASCADE;" json:"entries,omitempty"`
@@ -34,6 +41,39 @@ type QuoteEntry struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 }
 
+// entriesHaveMedia reports whether any of the messages carries a file
+func entriesHaveMedia(messages ...datatypes.JSON) bool {
+	for _, raw := range messages {
+		if msg, err := message.Parse(raw); err == nil && msg.HasMedia() {
+			return true
+		}
+	}
+	return false
+}
+
+// Link returns the link to the first message of the quote in its chat, or
+// "" when that chat has none
+func (q *Quote) Link() string {
+	if len(q.Entries) == 0 {
+		return ""
+	}
+	msg, err := message.Parse(q.Entries[0].Message)
+	if err != nil {
+		return ""
+	}
+	return msg.Link()
+}
+
+// ContainsMedia reports whether an entry of the quote carries a file, as
+// HasMedia records it
+func (q *Quote) ContainsMedia() bool {
+	messages := make([]datatypes.JSON, len(q.Entries))
+	for i, entry := range q.Entries {
+		messages[i] = entry.Message
+	}
+	return entriesHaveMedia(messages...)
+}
+
 // TableName specifies the table name for QuoteEntry
 func (QuoteEntry) TableName() string {
 	return "quote_entry"
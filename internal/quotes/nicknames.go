@@ -0,0 +1,207 @@
+package quotes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxNicknameLength bounds nicknames, in characters
+const maxNicknameLength = 64
+
+// AuthorNickname is the name a chat gives to a quote author
+type AuthorNickname struct {
+	ChatID    int64     `gorm:"primaryKey;autoIncrement:false" json:"chat_id"`
+	UserID    int64     `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	Nickname  string    `gorm:"not null" json:"nickname"`
+	SetBy     int64     `gorm:"not null" json:"set_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for AuthorNickname
+func (AuthorNickname) TableName() string {
+	return "author_nickname"
+}
+
+// Nicknames stores the author nicknames of each chat. They are applied when
+// rendering, so they also change how existing quotes look.
+type Nicknames struct {
+	db *gorm.DB
+}
+
+// NewNicknames creates a new nickname store
+func NewNicknames(db *gorm.DB) *Nicknames {
+	return &Nicknames{db: db}
+}
+
+// Set gives a user a nickname in a chat, replacing any previous one
+func (n *Nicknames) Set(ctx context.Context, chatID, userID int64, nickname string, setBy int64) error {
+	record := AuthorNickname{ChatID: chatID, UserID: userID, Nickname: nickname, SetBy: setBy}
+	err := n.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chat_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"nickname", "set_by", "updated_at"}),
+	}).Create(&record).Error
+	if err != nil {
+		return fmt.Errorf("failed to set nickname: %w", err)
+	}
+	return nil
+}
+
+// Clear removes the nickname of a user. It returns false if they had none.
+func (n *Nicknames) Clear(ctx context.Context, chatID, userID int64) (bool, error) {
+	result := n.db.WithContext(ctx).
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		Delete(&AuthorNickname{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to clear nickname: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// List returns the nicknames of a chat, ordered by nickname
+func (n *Nicknames) List(ctx context.Context, chatID int64) ([]AuthorNickname, error) {
+	var nicknames []AuthorNickname
+	if err := n.db.WithContext(ctx).
+		Where("chat_id = ?", chatID).
+		Order("nickname ASC").
+		Find(&nicknames).Error; err != nil {
+		return nil, fmt.Errorf("failed to list nicknames: %w", err)
+	}
+	return nicknames, nil
+}
+
+// ParseNickArgs finds the user and nickname of a /nick command: a numeric
+// user ID followed by the nickname, or just the nickname when replying to
+// one of the user's messages. An empty nickname means clearing it.
+func ParseNickArgs(args botcmd.Args, reply *models.Message) (int64, string, error) {
+	var userID int64
+	first := 0
+	if id, err := strconv.ParseInt(args.Arg(0), 10, 64); err == nil && id > 0 {
+		userID = id
+		first = 1
+	} else if reply != nil && reply.From != nil {
+		userID = reply.From.ID
+	} else {
+		return 0, "", errors.New("tell me who: use a user ID or reply to one of their messages")
+	}
+
+	// A single argument is taken unquoted; longer names keep their spacing
+	nickname := args.Rest(first)
+	if args.Len() == first+1 {
+		nickname = args.Arg(first)
+	}
+	nickname = strings.TrimSpace(nickname)
+	if utf8.RuneCountInString(nickname) > maxNicknameLength {
+		return 0, "", fmt.Errorf("nicknames can be at most %d characters long", maxNicknameLength)
+	}
+	return userID, nickname, nil
+}
+
+// NickHandler handles the /nick command
+type NickHandler struct {
+	nicknames *Nicknames
+	outbox    *outbox.Outbox
+	admins    *telegram.AdminService
+}
+
+// NewNickHandler creates a new nick handler
+func NewNickHandler(db *gorm.DB) *NickHandler {
+	return &NickHandler{nicknames: NewNicknames(db), outbox: outbox.New(db)}
+}
+
+// WithAdmins checks admins against a shared cache of chat administrators
+func (h *NickHandler) WithAdmins(admins *telegram.AdminService) *NickHandler {
+	h.admins = admins
+	return h
+}
+
+// Handle processes the /nick command. Without arguments it lists the
+// nicknames of the chat.
+func (h *NickHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	if args.Len() == 0 && msg.ReplyToMessage == nil {
+		return h.list(ctx, b, chatID)
+	}
+
+	admin, err := h.admins.IsSenderAdmin(ctx, b, msg)
+	var refused *telegram.OriginError
+	if errors.As(err, &refused) {
+		return sendNotice(ctx, h.outbox, b, chatID, refused.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return sendNotice(ctx, h.outbox, b, chatID, "Only chat administrators can change nicknames.")
+	}
+
+	userID, nickname, err := ParseNickArgs(args, msg.ReplyToMessage)
+	if err != nil {
+		return sendNotice(ctx, h.outbox, b, chatID, err.Error())
+	}
+
+	if nickname == "" {
+		cleared, err := h.nicknames.Clear(ctx, chatID, userID)
+		if err != nil {
+			return err
+		}
+		if !cleared {
+			return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("User %d has no nickname.", userID))
+		}
+		slog.Info("nickname cleared", "audit", true, "chat_id", chatID, "admin_id", msg.From.ID, "target_id", userID)
+		return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("User %d is shown with their Telegram name again.", userID))
+	}
+
+	if err := h.nicknames.Set(ctx, chatID, userID, nickname, msg.From.ID); err != nil {
+		return err
+	}
+	slog.Info("nickname set", "audit", true, "chat_id", chatID, "admin_id", msg.From.ID, "target_id", userID, "nickname", nickname)
+	return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("User %d is now shown as %s in quotes.", userID, nickname))
+}
+
+// list replies with the nicknames of the chat
+func (h *NickHandler) list(ctx context.Context, b *bot.Bot, chatID int64) error {
+	nicknames, err := h.nicknames.List(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if len(nicknames) == 0 {
+		return sendNotice(ctx, h.outbox, b, chatID, "No nicknames set.\n\nUsage: /nick <user id> \"Nickname\", or reply to a message with /nick Nickname")
+	}
+
+	lines := []string{"Nicknames:"}
+	for _, nickname := range nicknames {
+		lines = append(lines, fmt.Sprintf("• %s (user %d)", nickname.Nickname, nickname.UserID))
+	}
+	return sendText(ctx, h.outbox, b, chatID, strings.Join(lines, "\n"))
+}
+
+// Command returns the command name
+func (h *NickHandler) Command() string {
+	return "/nick"
+}
+
+// Description returns the command description
+func (h *NickHandler) Description() string {
+	return "Show an author with a nickname in quotes (admins only)"
+}
@@ -0,0 +1,89 @@
+package quotes
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNickArgs(t *testing.T) {
+	reply := &models.Message{From: &models.User{ID: 42, FirstName: "Bob"}}
+
+	tests := []struct {
+		name         string
+		text         string
+		reply        *models.Message
+		wantUserID   int64
+		wantNickname string
+		errContains  string
+	}{
+		{name: "quoted nickname", text: `/nick 12345 "El Capitán"`, wantUserID: 12345, wantNickname: "El Capitán"},
+		{name: "unquoted words", text: "/nick 12345 El Capitán", wantUserID: 12345, wantNickname: "El Capitán"},
+		{name: "clear", text: "/nick 12345", wantUserID: 12345},
+		{name: "reply", text: "/nick Bobby Tables", reply: reply, wantUserID: 42, wantNickname: "Bobby Tables"},
+		{name: "id wins over reply", text: "/nick 7 Seven", reply: reply, wantUserID: 7, wantNickname: "Seven"},
+		{name: "nobody", text: "/nick Bobby", errContains: "tell me who"},
+		{name: "too long", text: "/nick 1 " + strings.Repeat("a", maxNicknameLength+1), errContains: "at most"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, _ := botcmd.ParseArgs(tt.text)
+			userID, nickname, err := ParseNickArgs(args, tt.reply)
+			if tt.errContains != "" {
+				assert.ErrorContains(t, err, tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantUserID, userID)
+			assert.Equal(t, tt.wantNickname, nickname)
+		})
+	}
+}
+
+func TestAuthors_DisplayName(t *testing.T) {
+	authors := NewAuthors(map[int64]string{1: "Captain"})
+	assert.Equal(t, "Captain", authors.DisplayName(1, "Juan"))
+	assert.Equal(t, "Bob", authors.DisplayName(2, "Bob"))
+
+	var none *Authors
+	assert.Equal(t, "Juan", none.DisplayName(1, "Juan"))
+}
+
+func TestNicknames(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	nicknames := NewNicknames(db.DB)
+	ctx := context.Background()
+
+	require.NoError(t, nicknames.Set(ctx, -100123, 12345, "Capitán", 1))
+	require.NoError(t, nicknames.Set(ctx, -100123, 12345, "El Capitán", 1))
+	require.NoError(t, nicknames.Set(ctx, -100999, 12345, "Juanito", 1))
+
+	list, err := nicknames.List(ctx, -100123)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "El Capitán", list[0].Nickname)
+
+	authors, err := LoadAuthors(ctx, db.DB, -100123)
+	require.NoError(t, err)
+	assert.Equal(t, "El Capitán", authors.DisplayName(12345, "Juan"))
+
+	cleared, err := nicknames.Clear(ctx, -100123, 12345)
+	require.NoError(t, err)
+	assert.True(t, cleared)
+
+	cleared, err = nicknames.Clear(ctx, -100123, 12345)
+	require.NoError(t, err)
+	assert.False(t, cleared)
+
+	// Other chats keep their own nicknames
+	authors, err = LoadAuthors(ctx, db.DB, -100999)
+	require.NoError(t, err)
+	assert.Equal(t, "Juanito", authors.DisplayName(12345, "Juan"))
+}
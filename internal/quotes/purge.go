@@ -0,0 +1,357 @@
+package quotes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/kv"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"gorm.io/gorm"
+)
+
+// purgeCallbackPrefix prefixes the callback data of the confirmation buttons
+const purgeCallbackPrefix = "purgequotes:"
+
+// purgeConfirmationTTL is how long a purge confirmation stays valid
+const purgeConfirmationTTL = 5 * time.Minute
+
+// PurgeQuotesHandler handles the /purgequotes admin command.
+// Deletion is a two step process: the command reports how many quotes match
+// and only an explicit confirmation button deletes them.
+type PurgeQuotesHandler struct {
+	store  *Store
+	outbox *outbox.Outbox
+	admins *telegram.AdminService
+	clock  clock.Clock
+	shared kv.Store // Pending purges shared by every replica, instead of pending
+
+	mu      sync.Mutex
+	pending map[string]pendingPurge
+}
+
+// pendingPurge is a purge waiting for confirmation
+type pendingPurge struct {
+	filter    BulkDeleteFilter
+	userID    int64
+	count     int64
+	createdAt time.Time
+}
+
+// sharedPurge is a pending purge as kept in a shared store
+type sharedPurge struct {
+	Filter    BulkDeleteFilter `json:"filter"`
+	UserID    int64            `json:"user_id"`
+	Count     int64            `json:"count"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// NewPurgeQuotesHandler creates a new purgequotes handler
+func NewPurgeQuotesHandler(db *gorm.DB) *PurgeQuotesHandler {
+	return &PurgeQuotesHandler{
+		store:   NewStore(db),
+		outbox:  outbox.New(db),
+		clock:   clock.System{},
+		pending: make(map[string]pendingPurge),
+	}
+}
+
+// WithEvents publishes the purged quotes
+func (h *PurgeQuotesHandler) WithEvents(publisher events.Publisher) *PurgeQuotesHandler {
+	h.store.WithEvents(publisher)
+	return h
+}
+
+// WithAdmins checks admins against a shared cache of chat administrators
+func (h *PurgeQuotesHandler) WithAdmins(admins *telegram.AdminService) *PurgeQuotesHandler {
+	h.admins = admins
+	return h
+}
+
+// WithStore keeps pending purges in a store shared by every replica, so
+// any of them takes the confirmation
+func (h *PurgeQuotesHandler) WithStore(store kv.Store) *PurgeQuotesHandler {
+	h.shared = store
+	return h
+}
+
+// Handle processes the /purgequotes command
+func (h *PurgeQuotesHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	slog.Info("executing /purgequotes command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	admin, err := h.admins.IsSenderAdmin(ctx, b, msg)
+	var refused *telegram.OriginError
+	if errors.As(err, &refused) {
+		return sendNotice(ctx, h.outbox, b, chatID, refused.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return sendNotice(ctx, h.outbox, b, chatID, "Only chat administrators can purge quotes.")
+	}
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	filter, err := ParsePurgeFilter(args.Fields)
+	if err != nil {
+		return sendNotice(ctx, h.outbox, b, chatID, err.Error())
+	}
+	filter.ChatID = chatID
+
+	count, err := h.store.BulkDelete(ctx, filter, true)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return sendNotice(ctx, h.outbox, b, chatID, "No quotes match those filters.")
+	}
+
+	token, err := h.remember(ctx, pendingPurge{filter: filter, userID: msg.From.ID, count: count})
+	if err != nil {
+		return err
+	}
+
+	_, err = h.outbox.Send(ctx, b, &outbox.Message{
+		ChatID: chatID,
+		Text:   fmt.Sprintf("This will permanently delete %d quote(s) (%s). Are you sure?", count, describePurgeFilter(filter)),
+		Keyboard: &models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{{
+				{Text: fmt.Sprintf("Delete %d quote(s)", count), CallbackData: purgeCallbackPrefix + "confirm:" + token},
+				{Text: "Cancel", CallbackData: purgeCallbackPrefix + "cancel:" + token},
+			}},
+		},
+	})
+	return err
+}
+
+// HandleCallback processes the confirmation buttons
+func (h *PurgeQuotesHandler) HandleCallback(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil {
+		return nil
+	}
+
+	action, token, _ := strings.Cut(strings.TrimPrefix(query.Data, purgeCallbackPrefix), ":")
+	message := query.Message.Message
+
+	purge, ok, err := h.claim(ctx, token, query.From.ID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !ok || h.clock.Now().Sub(purge.createdAt) > purgeConfirmationTTL:
+		return h.finish(ctx, b, query, message, "This purge request expired, run /purgequotes again.")
+	case purge.userID != query.From.ID:
+		_, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            "Only the administrator who asked for the purge can confirm it.",
+			ShowAlert:       true,
+		})
+		return err
+	case action == "cancel":
+		return h.finish(ctx, b, query, message, "Purge cancelled.")
+	}
+
+	deleted, err := h.store.BulkDelete(ctx, purge.filter, false)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("purged quotes", "chat_id", purge.filter.ChatID, "user_id", query.From.ID, "deleted", deleted)
+	return h.finish(ctx, b, query, message, fmt.Sprintf("Deleted %d quote(s).", deleted))
+}
+
+// finish answers the callback and replaces the confirmation message
+func (h *PurgeQuotesHandler) finish(ctx context.Context, b *bot.Bot, query *models.CallbackQuery, message *models.Message, text string) error {
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID}); err != nil {
+		return err
+	}
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    message.Chat.ID,
+		MessageID: message.ID,
+		Text:      text,
+	})
+	return err
+}
+
+// remember stores a pending purge and returns its confirmation token
+func (h *PurgeQuotesHandler) remember(ctx context.Context, purge pendingPurge) (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate confirmation token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	if h.shared != nil {
+		value, err := json.Marshal(sharedPurge{Filter: purge.filter, UserID: purge.userID, Count: purge.count, CreatedAt: h.clock.Now()})
+		if err != nil {
+			return "", err
+		}
+		if err := h.shared.Set(ctx, purgeCallbackPrefix+token, value, purgeConfirmationTTL); err != nil {
+			return "", fmt.Errorf("failed to store the purge confirmation: %w", err)
+		}
+		return token, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Forget expired confirmations
+	now := h.clock.Now()
+	for key, p := range h.pending {
+		if now.Sub(p.createdAt) > purgeConfirmationTTL {
+			delete(h.pending, key)
+		}
+	}
+
+	purge.createdAt = now
+	h.pending[token] = purge
+	return token, nil
+}
+
+// claim returns the pending purge of a token, removing it when userID is
+// the one who asked for it so that it is confirmed once
+func (h *PurgeQuotesHandler) claim(ctx context.Context, token string, userID int64) (pendingPurge, bool, error) {
+	if h.shared == nil {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		purge, ok := h.pending[token]
+		if ok && purge.userID == userID {
+			delete(h.pending, token)
+		}
+		return purge, ok, nil
+	}
+
+	key := purgeCallbackPrefix + token
+	value, ok, err := h.shared.Get(ctx, key)
+	if err != nil || !ok {
+		return pendingPurge{}, false, err
+	}
+	var stored sharedPurge
+	if err := json.Unmarshal(value, &stored); err != nil {
+		return pendingPurge{}, false, fmt.Errorf("invalid purge confirmation: %w", err)
+	}
+	purge := pendingPurge{filter: stored.Filter, userID: stored.UserID, count: stored.Count, createdAt: stored.CreatedAt}
+	if purge.userID == userID {
+		// Another replica may have taken it in between
+		if _, ok, err = h.shared.Take(ctx, key); err != nil || !ok {
+			return pendingPurge{}, false, err
+		}
+	}
+	return purge, true, nil
+}
+
+// ParsePurgeFilter parses /purgequotes arguments such as
+// "author:@user before:2019-01-01 after:2018".
+func ParsePurgeFilter(args []string) (BulkDeleteFilter, error) {
+	var filter BulkDeleteFilter
+
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, ":")
+		if !found || value == "" {
+			return filter, fmt.Errorf("invalid filter %q\n\n%s", arg, purgeUsage)
+		}
+
+		switch strings.ToLower(key) {
+		case "author":
+			if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+				filter.AuthorID = id
+			} else {
+				filter.AuthorUsername = strings.TrimPrefix(value, "@")
+			}
+		case "before":
+			t, err := parseFilterDate(value)
+			if err != nil {
+				return filter, err
+			}
+			filter.Before = t
+		case "after":
+			t, err := parseFilterDate(value)
+			if err != nil {
+				return filter, err
+			}
+			filter.After = t
+		default:
+			return filter, fmt.Errorf("unknown filter %q\n\n%s", key, purgeUsage)
+		}
+	}
+
+	if filter.IsEmpty() {
+		return filter, fmt.Errorf("at least one filter is required\n\n%s", purgeUsage)
+	}
+	return filter, nil
+}
+
+const purgeUsage = `Usage: /purgequotes [author:@user|author:<id>] [before:YYYY-MM-DD] [after:YYYY-MM-DD]`
+
+// parseFilterDate accepts a year, a month or a day, in UTC
+func parseFilterDate(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, use YYYY, YYYY-MM or YYYY-MM-DD", value)
+}
+
+// describePurgeFilter renders a filter for the confirmation message
+func describePurgeFilter(filter BulkDeleteFilter) string {
+	var parts []string
+	if filter.AuthorUsername != "" {
+		parts = append(parts, "by @"+filter.AuthorUsername)
+	}
+	if filter.AuthorID != 0 {
+		parts = append(parts, fmt.Sprintf("by user %d", filter.AuthorID))
+	}
+	if !filter.After.IsZero() {
+		parts = append(parts, "added since "+filter.After.Format("2006-01-02"))
+	}
+	if !filter.Before.IsZero() {
+		parts = append(parts, "added before "+filter.Before.Format("2006-01-02"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sendText sends a plain text message to the chat through the outbox
+func sendText(ctx context.Context, out *outbox.Outbox, b *bot.Bot, chatID int64, text string) error {
+	_, err := out.Send(ctx, b, &outbox.Message{ChatID: chatID, Text: text})
+	return err
+}
+
+// sendNotice sends a usage error, notice or confirmation, which is deleted
+// after the chat's autodelete delay
+func sendNotice(ctx context.Context, out *outbox.Outbox, b *bot.Bot, chatID int64, text string) error {
+	_, err := out.Send(ctx, b, &outbox.Message{ChatID: chatID, Text: text, Transient: true})
+	return err
+}
+
+// Command returns the command name
+func (h *PurgeQuotesHandler) Command() string {
+	return "/purgequotes"
+}
+
+// Description returns the command description
+func (h *PurgeQuotesHandler) Description() string {
+	return "Delete quotes by author or date range (admins only)"
+}
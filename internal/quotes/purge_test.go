@@ -0,0 +1,117 @@
+package quotes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePurgeFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		expected    BulkDeleteFilter
+		errContains string
+	}{
+		{
+			name:     "author username",
+			args:     []string{"author:@bob"},
+			expected: BulkDeleteFilter{AuthorUsername: "bob"},
+		},
+		{
+			name:     "author id",
+			args:     []string{"author:12345"},
+			expected: BulkDeleteFilter{AuthorID: 12345},
+		},
+		{
+			name: "date range",
+			args: []string{"after:2018", "before:2019-01-01"},
+			expected: BulkDeleteFilter{
+				After:  time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+				Before: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "author and month",
+			args: []string{"author:@bob", "before:2019-05"},
+			expected: BulkDeleteFilter{
+				AuthorUsername: "bob",
+				Before:         time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{name: "no filters", args: nil, errContains: "at least one filter"},
+		{name: "unknown key", args: []string{"text:hello"}, errContains: "unknown filter"},
+		{name: "missing value", args: []string{"author:"}, errContains: "invalid filter"},
+		{name: "bad date", args: []string{"before:yesterday"}, errContains: "invalid date"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParsePurgeFilter(tt.args)
+			if tt.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, filter)
+		})
+	}
+}
+
+func TestDescribePurgeFilter(t *testing.T) {
+	filter := BulkDeleteFilter{
+		AuthorUsername: "bob",
+		Before:         time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	assert.Equal(t, "by @bob, added before 2019-01-01", describePurgeFilter(filter))
+}
+
+func TestPurgeQuotesHandler_RememberExpires(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	handler := &PurgeQuotesHandler{clock: clk, pending: make(map[string]pendingPurge)}
+
+	first, err := handler.remember(context.Background(), pendingPurge{userID: 1})
+	require.NoError(t, err)
+	clk.Advance(purgeConfirmationTTL + time.Second)
+	second, err := handler.remember(context.Background(), pendingPurge{userID: 2})
+	require.NoError(t, err)
+
+	assert.NotContains(t, handler.pending, first)
+	assert.Contains(t, handler.pending, second)
+}
+
+func TestPurgeQuotesHandler_SharedClaim(t *testing.T) {
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := kv.NewMemory().WithClock(clk)
+	// One replica asks for the purge and another takes the confirmation
+	asked := &PurgeQuotesHandler{clock: clk, pending: make(map[string]pendingPurge)}
+	asked.WithStore(store)
+	confirmed := &PurgeQuotesHandler{clock: clk, pending: make(map[string]pendingPurge)}
+	confirmed.WithStore(store)
+	ctx := context.Background()
+
+	filter := BulkDeleteFilter{ChatID: -100123, AuthorUsername: "bob"}
+	token, err := asked.remember(ctx, pendingPurge{filter: filter, userID: 1, count: 3})
+	require.NoError(t, err)
+
+	purge, ok, err := confirmed.claim(ctx, token, 2)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), purge.userID, "someone else sees the purge but does not take it")
+
+	purge, ok, err = confirmed.claim(ctx, token, 1)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, filter, purge.filter)
+	assert.Equal(t, int64(3), purge.count)
+
+	_, ok, err = asked.claim(ctx, token, 1)
+	require.NoError(t, err)
+	assert.False(t, ok, "a purge is confirmed once")
+}
@@ -0,0 +1,209 @@
+package quotes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/settings"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidPeriod is returned for periods that are not YYYY or YYYY-MM
+var ErrInvalidPeriod = errors.New("invalid period, expected YYYY or YYYY-MM")
+
+// Period is a month, or a whole year, in which quoted conversations happened
+type Period struct {
+	Year  int
+	Month time.Month // Zero for the whole year
+}
+
+// ParsePeriod parses a period written as YYYY or YYYY-MM
+func ParsePeriod(text string) (Period, error) {
+	if t, err := time.Parse("2006-01", text); err == nil {
+		return Period{Year: t.Year(), Month: t.Month()}, nil
+	}
+	if t, err := time.Parse("2006", text); err == nil {
+		return Period{Year: t.Year()}, nil
+	}
+	return Period{}, ErrInvalidPeriod
+}
+
+// String returns the period as YYYY or YYYY-MM
+func (p Period) String() string {
+	if p.Month == 0 {
+		return fmt.Sprintf("%04d", p.Year)
+	}
+	return fmt.Sprintf("%04d-%02d", p.Year, p.Month)
+}
+
+// Range returns the start of the period and the start of the next one in a
+// time zone
+func (p Period) Range(loc *time.Location) (from, to time.Time) {
+	if p.Month == 0 {
+		from = time.Date(p.Year, time.January, 1, 0, 0, 0, 0, loc)
+		return from, from.AddDate(1, 0, 0)
+	}
+	from = time.Date(p.Year, p.Month, 1, 0, 0, 0, 0, loc)
+	return from, from.AddDate(0, 1, 0)
+}
+
+// index orders periods of the same kind
+func (p Period) index() int {
+	return p.Year*12 + int(p.Month)
+}
+
+// PeriodCount is the number of quotes of a chat quoted in a period
+type PeriodCount struct {
+	Period Period
+	Quotes int64
+}
+
+// CountByPeriod returns how many quotes of a chat were quoted in each month,
+// or each year with byYear, in a time zone. Periods without quotes are left
+// out; the rest come oldest first.
+func (s *Store) CountByPeriod(ctx context.Context, chatID int64, loc *time.Location, byYear bool) ([]PeriodCount, error) {
+	return s.countByPeriod(ctx, "quoted_at", chatID, loc, byYear)
+}
+
+// countByPeriod counts the quotes of a chat by the period of a timestamp
+// column, oldest first
+func (s *Store) countByPeriod(ctx context.Context, column string, chatID int64, loc *time.Location, byYear bool) ([]PeriodCount, error) {
+	format := "YYYY-MM"
+	if byYear {
+		format = "YYYY"
+	}
+	var rows []struct {
+		Period string
+		Quotes int64
+	}
+	err := s.db.WithContext(ctx).Raw(fmt.Sprintf(`
+		SELECT to_char(%[1]s AT TIME ZONE ?, ?) AS period, count(*) AS quotes
+		FROM quote
+		WHERE chat_id = ? AND %[1]s IS NOT NULL
+		GROUP BY 1
+		ORDER BY 1`, column), loc.String(), format, chatID).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count quotes by period: %w", err)
+	}
+
+	counts := make([]PeriodCount, 0, len(rows))
+	for _, row := range rows {
+		period, err := ParsePeriod(row.Period)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, PeriodCount{Period: period, Quotes: row.Quotes})
+	}
+	return counts, nil
+}
+
+// NearbyPeriods returns up to n periods with quotes before a period and up
+// to n after it, oldest first. counts must be sorted oldest first.
+func NearbyPeriods(counts []PeriodCount, period Period, n int) []PeriodCount {
+	i := sort.Search(len(counts), func(i int) bool {
+		return counts[i].Period.index() >= period.index()
+	})
+	j := i
+	if j < len(counts) && counts[j].Period == period {
+		j++
+	}
+	return append(counts[max(i-n, 0):i:i], counts[j:min(j+n, len(counts))]...)
+}
+
+// QuoteFromHandler handles the /quotefrom command
+type QuoteFromHandler struct {
+	store    *Store
+	poster   *quotePoster
+	settings *settings.Service
+	outbox   *outbox.Outbox
+}
+
+// NewQuoteFromHandler creates a new quotefrom handler
+func NewQuoteFromHandler(db *gorm.DB) *QuoteFromHandler {
+	return &QuoteFromHandler{
+		store:    NewStore(db),
+		poster:   newQuotePoster(db),
+		settings: settings.NewService(db),
+		outbox:   outbox.New(db),
+	}
+}
+
+// WithCustomEmoji shows custom emoji in posted quotes instead of their
+// fallback emoji
+func (h *QuoteFromHandler) WithCustomEmoji(enabled bool) *QuoteFromHandler {
+	h.poster.customEmoji = enabled
+	return h
+}
+
+// Handle processes /quotefrom YYYY-MM (or YYYY), posting a random quote whose
+// conversation happened in that period of the chat time zone
+func (h *QuoteFromHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+	slog.Info("executing /quotefrom command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	period, err := ParsePeriod(args.Raw)
+	if err != nil {
+		return sendNotice(ctx, h.outbox, b, chatID, "Usage: /quotefrom YYYY-MM or /quotefrom YYYY, e.g. /quotefrom 2019-05")
+	}
+
+	chatSettings, err := h.settings.Get(ctx, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to get chat settings: %w", err)
+	}
+	loc := chatSettings.Location(msg.From.LanguageCode)
+
+	from, to := period.Range(loc)
+	quote, err := h.store.GetRandomQuotedBetween(ctx, chatID, from, to)
+	if err != nil {
+		return err
+	}
+	if quote == nil {
+		return h.replyNoQuotes(ctx, b, chatID, period, loc)
+	}
+	return h.poster.post(ctx, b, msg, quote)
+}
+
+// replyNoQuotes tells that a period has no quotes, suggesting the closest
+// periods that have some
+func (h *QuoteFromHandler) replyNoQuotes(ctx context.Context, b *bot.Bot, chatID int64, period Period, loc *time.Location) error {
+	counts, err := h.store.CountByPeriod(ctx, chatID, loc, period.Month == 0)
+	if err != nil {
+		return err
+	}
+	if len(counts) == 0 {
+		return sendNotice(ctx, h.outbox, b, chatID, "No quotes found in this chat. Add some with /addquote!")
+	}
+
+	nearby := NearbyPeriods(counts, period, 2)
+	suggestions := make([]string, 0, len(nearby))
+	for _, count := range nearby {
+		suggestions = append(suggestions, fmt.Sprintf("%s (%d)", count.Period, count.Quotes))
+	}
+	text := fmt.Sprintf("No quotes from %s. Closest periods with quotes: %s", period, strings.Join(suggestions, ", "))
+	return sendNotice(ctx, h.outbox, b, chatID, text)
+}
+
+// Command returns the command name
+func (h *QuoteFromHandler) Command() string {
+	return "/quotefrom"
+}
+
+// Description returns the command description
+func (h *QuoteFromHandler) Description() string {
+	return "Get a random quote from a month (YYYY-MM) or year"
+}
@@ -0,0 +1,122 @@
+package quotes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected Period
+		valid    bool
+	}{
+		{text: "2019-05", expected: Period{Year: 2019, Month: time.May}, valid: true},
+		{text: "2019", expected: Period{Year: 2019}, valid: true},
+		{text: "2019-13"},
+		{text: "2019-5"},
+		{text: "may 2019"},
+		{text: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			period, err := ParsePeriod(tt.text)
+			if !tt.valid {
+				assert.ErrorIs(t, err, ErrInvalidPeriod)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, period)
+			assert.Equal(t, tt.text, period.String())
+		})
+	}
+}
+
+func TestPeriod_Range(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+
+	from, to := Period{Year: 2019, Month: time.December}.Range(madrid)
+	assert.Equal(t, time.Date(2019, time.December, 1, 0, 0, 0, 0, madrid), from)
+	assert.Equal(t, time.Date(2020, time.January, 1, 0, 0, 0, 0, madrid), to)
+
+	from, to = Period{Year: 2019}.Range(time.UTC)
+	assert.Equal(t, time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC), to)
+}
+
+func TestNearbyPeriods(t *testing.T) {
+	month := func(year int, m time.Month) PeriodCount {
+		return PeriodCount{Period: Period{Year: year, Month: m}, Quotes: 1}
+	}
+	counts := []PeriodCount{
+		month(2018, time.November), month(2019, time.January), month(2019, time.March),
+		month(2019, time.August), month(2019, time.September), month(2020, time.February),
+	}
+
+	nearby := NearbyPeriods(counts, Period{Year: 2019, Month: time.May}, 2)
+	assert.Equal(t, []PeriodCount{counts[1], counts[2], counts[3], counts[4]}, nearby)
+
+	// Before every period
+	nearby = NearbyPeriods(counts, Period{Year: 2010, Month: time.May}, 2)
+	assert.Equal(t, []PeriodCount{counts[0], counts[1]}, nearby)
+
+	// After every period
+	nearby = NearbyPeriods(counts, Period{Year: 2021, Month: time.May}, 2)
+	assert.Equal(t, []PeriodCount{counts[4], counts[5]}, nearby)
+
+	// The period itself is not suggested
+	nearby = NearbyPeriods(counts, Period{Year: 2019, Month: time.March}, 1)
+	assert.Equal(t, []PeriodCount{counts[1], counts[3]}, nearby)
+
+	// The input is left untouched
+	assert.Equal(t, month(2019, time.August), counts[3])
+}
+
+func TestStore_QuotedAt(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ctx := context.Background()
+
+	may := time.Date(2019, time.May, 20, 12, 0, 0, 0, time.UTC)
+	add := func(date time.Time) *Quote {
+		quote, err := store.Store(ctx, StoreOptions{
+			ChatID:  -100123,
+			Creator: map[string]interface{}{"id": 1},
+			Entries: []CacheEntry{{Date: date.Unix(), Message: datatypes.JSON(`{"text":"hi"}`)}},
+		})
+		require.NoError(t, err)
+		return quote
+	}
+	inMay := add(may)
+	add(may.AddDate(0, 3, 0))
+	add(may.AddDate(1, 0, 0))
+
+	require.NotNil(t, inMay.QuotedAt)
+	assert.True(t, may.Equal(*inMay.QuotedAt))
+
+	from, to := Period{Year: 2019, Month: time.May}.Range(time.UTC)
+	quote, err := store.GetRandomQuotedBetween(ctx, -100123, from, to)
+	require.NoError(t, err)
+	require.NotNil(t, quote)
+	assert.Equal(t, inMay.ID, quote.ID)
+
+	from, to = Period{Year: 2019, Month: time.June}.Range(time.UTC)
+	quote, err = store.GetRandomQuotedBetween(ctx, -100123, from, to)
+	require.NoError(t, err)
+	assert.Nil(t, quote)
+
+	counts, err := store.CountByPeriod(ctx, -100123, time.UTC, true)
+	require.NoError(t, err)
+	assert.Equal(t, []PeriodCount{
+		{Period: Period{Year: 2019}, Quotes: 2},
+		{Period: Period{Year: 2020}, Quotes: 1},
+	}, counts)
+}
@@ -0,0 +1,265 @@
+package quotes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/settings"
+	"gorm.io/gorm"
+)
+
+const (
+	statsMonths   = 12 // Months shown in /quotestats, newest last
+	statsBarWidth = 12 // Width of the bar of the busiest month
+)
+
+// AuthorCount is how many quotes of a chat have messages of an author
+type AuthorCount struct {
+	UserID int64
+	Name   string // Telegram name in their latest quoted message
+	Quotes int64
+}
+
+// CountByAuthor returns the authors with most quotes in a chat, most quoted
+// first. Merged users count as their canonical user, and a quote counts
+// once per author however many of its messages are theirs.
+func (s *Store) CountByAuthor(ctx context.Context, chatID int64, limit int) ([]AuthorCount, error) {
+	var rows []struct {
+		UserID int64
+		Quotes int64
+		Sender []byte
+	}
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT COALESCE(a.canonical_id, entries.user_id) AS user_id, count(DISTINCT entries.quote_id) AS quotes,
+			(array_agg(entries.sender ORDER BY entries.id DESC))[1] AS sender
+		FROM (
+			SELECT (e.message->'from'->>'id')::bigint AS user_id, e.message->'from' AS sender, e.quote_id, e.id
+			FROM quote_entry e JOIN quote q ON q.id = e.quote_id
+			WHERE q.chat_id = ? AND e.deleted_at IS NULL AND e.message->'from'->>'id' IS NOT NULL
+		) entries
+		LEFT JOIN author_alias a ON a.chat_id = ? AND a.alias_id = entries.user_id
+		GROUP BY 1
+		ORDER BY quotes DESC, user_id
+		LIMIT ?`, chatID, chatID, limit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count quotes by author: %w", err)
+	}
+
+	counts := make([]AuthorCount, 0, len(rows))
+	for _, row := range rows {
+		var from struct {
+			FirstName string `json:"first_name"`
+			LastName  string `json:"last_name"`
+			Username  string `json:"username"`
+		}
+		_ = json.Unmarshal(row.Sender, &from)
+		counts = append(counts, AuthorCount{
+			UserID: row.UserID,
+			Name:   authorName(from.FirstName, from.LastName, from.Username),
+			Quotes: row.Quotes,
+		})
+	}
+	return counts, nil
+}
+
+// CreatorCount is how many quotes of a chat a user added
+type CreatorCount struct {
+	UserID int64  // Zero when the creator retention only kept a hash
+	Name   string // Name stored with their latest quote, "Unknown" if none
+	Quotes int64
+}
+
+// CountByCreator returns the users who added most quotes to a chat, most
+// active first. Quotes whose creator is only a hash are grouped by it.
+func (s *Store) CountByCreator(ctx context.Context, chatID int64, limit int) ([]CreatorCount, error) {
+	var rows []struct {
+		Quotes  int64
+		Creator []byte
+	}
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT count(*) AS quotes, (array_agg(creator ORDER BY id DESC))[1] AS creator
+		FROM quote
+		WHERE chat_id = ? AND COALESCE(creator->>'id', creator->>'id_hash') IS NOT NULL
+		GROUP BY COALESCE(creator->>'id', creator->>'id_hash')
+		ORDER BY quotes DESC, COALESCE(creator->>'id', creator->>'id_hash')
+		LIMIT ?`, chatID, limit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count quotes by creator: %w", err)
+	}
+
+	counts := make([]CreatorCount, 0, len(rows))
+	for _, row := range rows {
+		var creator struct {
+			ID        int64  `json:"id"`
+			FirstName string `json:"first_name"`
+			LastName  string `json:"last_name"`
+			Username  string `json:"username"`
+		}
+		_ = json.Unmarshal(row.Creator, &creator)
+		counts = append(counts, CreatorCount{
+			UserID: creator.ID,
+			Name:   authorName(creator.FirstName, creator.LastName, creator.Username),
+			Quotes: row.Quotes,
+		})
+	}
+	return counts, nil
+}
+
+// CountAddedByMonth returns how many quotes were added to a chat in each
+// month in a time zone, oldest first. Months without quotes are left out.
+func (s *Store) CountAddedByMonth(ctx context.Context, chatID int64, loc *time.Location) ([]PeriodCount, error) {
+	return s.countByPeriod(ctx, "created_at", chatID, loc, false)
+}
+
+// QuoteStats summarizes the quotes of a chat
+type QuoteStats struct {
+	Total      int64
+	TopAuthor  *AuthorCount  // Nil when no quote has an author
+	TopCreator *CreatorCount // Nil when no quote has a creator
+	Months     []PeriodCount // Quotes added in the latest months with any, oldest first
+}
+
+// LoadQuoteStats gathers the stats of the quotes of a chat, with months in
+// a time zone and authors shown with their nicknames
+func LoadQuoteStats(ctx context.Context, db *gorm.DB, chatID int64, loc *time.Location) (*QuoteStats, error) {
+	store := NewStore(db)
+	stats := &QuoteStats{}
+	var err error
+	if stats.Total, err = store.CountForChat(ctx, chatID); err != nil || stats.Total == 0 {
+		return stats, err
+	}
+
+	authors, err := LoadAuthors(ctx, db, chatID)
+	if err != nil {
+		return nil, err
+	}
+	topAuthors, err := store.CountByAuthor(ctx, chatID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(topAuthors) > 0 {
+		stats.TopAuthor = &topAuthors[0]
+		stats.TopAuthor.Name = authors.DisplayName(stats.TopAuthor.UserID, stats.TopAuthor.Name)
+	}
+	topCreators, err := store.CountByCreator(ctx, chatID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(topCreators) > 0 {
+		stats.TopCreator = &topCreators[0]
+		stats.TopCreator.Name = authors.DisplayName(authors.Canonical(stats.TopCreator.UserID), stats.TopCreator.Name)
+	}
+
+	months, err := store.CountAddedByMonth(ctx, chatID, loc)
+	if err != nil {
+		return nil, err
+	}
+	stats.Months = months[max(len(months)-statsMonths, 0):]
+	return stats, nil
+}
+
+// HTML renders the stats as a Telegram HTML message, with a bar per month
+func (s *QuoteStats) HTML() string {
+	if s.Total == 0 {
+		return "There are no quotes yet. Reply to a message with /addquote to add one."
+	}
+	lines := []string{fmt.Sprintf("📊 <b>Quote stats</b>\n\nTotal quotes: %d", s.Total)}
+	if s.TopAuthor != nil {
+		lines = append(lines, fmt.Sprintf("Most quoted: %s (%s)", html.EscapeString(s.TopAuthor.Name), pluralQuotes(s.TopAuthor.Quotes)))
+	}
+	if s.TopCreator != nil {
+		lines = append(lines, fmt.Sprintf("Most quotes added by: %s (%s)", html.EscapeString(s.TopCreator.Name), pluralQuotes(s.TopCreator.Quotes)))
+	}
+	if len(s.Months) > 0 {
+		lines = append(lines, "\nQuotes added per month:\n<pre>"+monthBars(s.Months)+"</pre>")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// monthBars draws a bar for each month, scaled to the busiest one
+func monthBars(months []PeriodCount) string {
+	var peak int64
+	for _, month := range months {
+		peak = max(peak, month.Quotes)
+	}
+	rows := make([]string, 0, len(months))
+	for _, month := range months {
+		// Any quote gets at least one block
+		width := max(int(month.Quotes*statsBarWidth/peak), 1)
+		rows = append(rows, fmt.Sprintf("%s %-*s %d", month.Period, statsBarWidth, strings.Repeat("█", width), month.Quotes))
+	}
+	return strings.Join(rows, "\n")
+}
+
+// pluralQuotes formats a number of quotes
+func pluralQuotes(n int64) string {
+	if n == 1 {
+		return "1 quote"
+	}
+	return fmt.Sprintf("%d quotes", n)
+}
+
+// QuoteStatsHandler handles the /quotestats command
+type QuoteStatsHandler struct {
+	db       *gorm.DB
+	settings *settings.Service
+	outbox   *outbox.Outbox
+}
+
+// NewQuoteStatsHandler creates a new quotestats handler
+func NewQuoteStatsHandler(db *gorm.DB) *QuoteStatsHandler {
+	return &QuoteStatsHandler{
+		db:       db,
+		settings: settings.NewService(db),
+		outbox:   outbox.New(db),
+	}
+}
+
+// Handle processes /quotestats, replying with the stats of the chat's
+// quotes, months in the chat's time zone
+func (h *QuoteStatsHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+	slog.Info("executing /quotestats command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	cs, err := h.settings.Get(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	stats, err := LoadQuoteStats(ctx, h.db, chatID, cs.Location(msg.From.LanguageCode))
+	if err != nil {
+		return err
+	}
+	if stats.Total == 0 {
+		return sendNotice(ctx, h.outbox, b, chatID, stats.HTML())
+	}
+	_, err = h.outbox.Send(ctx, b, &outbox.Message{
+		ChatID:    chatID,
+		Text:      stats.HTML(),
+		ParseMode: models.ParseModeHTML,
+	})
+	return err
+}
+
+// Command returns the command name
+func (h *QuoteStatsHandler) Command() string {
+	return "/quotestats"
+}
+
+// Description returns the command description
+func (h *QuoteStatsHandler) Description() string {
+	return "Show stats of the chat's quotes"
+}
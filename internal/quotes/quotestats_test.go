@@ -0,0 +1,92 @@
+package quotes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestQuoteStats_HTML(t *testing.T) {
+	assert.Contains(t, (&QuoteStats{}).HTML(), "There are no quotes yet.")
+
+	stats := &QuoteStats{
+		Total:      7,
+		TopAuthor:  &AuthorCount{UserID: 2, Name: "Bob <3", Quotes: 5},
+		TopCreator: &CreatorCount{UserID: 1, Name: "Alice", Quotes: 1},
+		Months: []PeriodCount{
+			{Period: Period{Year: 2026, Month: time.August}, Quotes: 1},
+			{Period: Period{Year: 2026, Month: time.September}, Quotes: 6},
+		},
+	}
+	text := stats.HTML()
+	assert.Contains(t, text, "Total quotes: 7")
+	assert.Contains(t, text, "Most quoted: Bob &lt;3 (5 quotes)")
+	assert.Contains(t, text, "Most quotes added by: Alice (1 quote)")
+	assert.Contains(t, text, "2026-08 ██           1\n2026-09 ████████████ 6")
+}
+
+func TestStore_QuoteStatsQueries(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ctx := context.Background()
+
+	add := func(creator int64, senders ...int64) {
+		var entries []CacheEntry
+		for _, sender := range senders {
+			entries = append(entries, CacheEntry{Message: datatypes.JSON(fmt.Sprintf(`{"text":"hi","from":{"id":%d,"first_name":"User %d"}}`, sender, sender))})
+		}
+		_, err := store.Store(ctx, StoreOptions{
+			ChatID:  -100123,
+			Creator: map[string]interface{}{"id": creator, "first_name": fmt.Sprintf("Creator %d", creator)},
+			Entries: entries,
+		})
+		require.NoError(t, err)
+	}
+	add(1, 10, 10, 11) // A quote counts once per author
+	add(1, 11)
+	add(2, 12)
+	_, err := NewAliases(db.DB).Merge(ctx, -100123, 12, 10, 1)
+	require.NoError(t, err)
+
+	authors, err := store.CountByAuthor(ctx, -100123, 5)
+	require.NoError(t, err)
+	assert.Equal(t, []AuthorCount{
+		{UserID: 10, Name: "User 12", Quotes: 2}, // 12 merged into 10, named as in the latest quote
+		{UserID: 11, Name: "User 11", Quotes: 2},
+	}, authors)
+
+	creators, err := store.CountByCreator(ctx, -100123, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []CreatorCount{{UserID: 1, Name: "Creator 1", Quotes: 2}}, creators)
+
+	stats, err := LoadQuoteStats(ctx, db.DB, -100123, time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Total)
+	require.Len(t, stats.Months, 1)
+	assert.Equal(t, int64(3), stats.Months[0].Quotes)
+}
+
+func TestQuoteStatsHandler(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	h.Register(NewQuoteStatsHandler(h.DB.DB))
+
+	h.SendText(-100123, "/quotestats")
+	assert.Contains(t, h.LastReply(), "There are no quotes yet.")
+
+	_, err := NewStore(h.DB.DB).Store(context.Background(), StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1, "first_name": "Alice"},
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"hi","from":{"id":2,"first_name":"Bob"}}`)}},
+	})
+	require.NoError(t, err)
+
+	h.SendText(-100123, "/quotestats")
+	assert.Contains(t, h.LastReply(), "Most quoted: Bob (1 quote)")
+	assert.Contains(t, h.LastReply(), "Most quotes added by: Alice (1 quote)")
+}
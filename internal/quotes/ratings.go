@@ -0,0 +1,343 @@
+package quotes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// rateCallbackPrefix prefixes the callback data of the 👍 and 👎 buttons
+// under posted quotes, followed by the quote and up or down
+const rateCallbackPrefix = "quoterate:"
+
+// topQuotesLimit is how many quotes /topquotes shows
+const topQuotesLimit = 10
+
+// QuoteVote is the thumbs up (1) or down (-1) a user gave a quote
+type QuoteVote struct {
+	QuoteID   uint  `gorm:"primaryKey"`
+	UserID    int64 `gorm:"primaryKey"`
+	Value     int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName specifies the table name for GORM
+func (QuoteVote) TableName() string {
+	return "quote_vote"
+}
+
+// Rating is the tally of the votes of a quote, and of the duels it won
+type Rating struct {
+	Up   int64
+	Down int64
+	Wins int64 // Duels won, each worth a thumbs up
+}
+
+// Score is the thumbs up and duels won minus the thumbs down
+func (r Rating) Score() int64 {
+	return r.Up + r.Wins - r.Down
+}
+
+// RatedQuote is a quote with its rating
+type RatedQuote struct {
+	Quote
+	Rating
+}
+
+// Ratings stores the votes users give posted quotes
+type Ratings struct {
+	db *gorm.DB
+}
+
+// NewRatings creates a ratings store
+func NewRatings(db *gorm.DB) *Ratings {
+	return &Ratings{db: db}
+}
+
+// Vote records the vote of a user for a quote, 1 or -1. Voting the same
+// again takes the vote back. It returns the vote the user is left with, 0
+// when taken back.
+func (r *Ratings) Vote(ctx context.Context, quoteID uint, userID int64, value int) (int, error) {
+	if value != 1 && value != -1 {
+		return 0, fmt.Errorf("invalid vote %d", value)
+	}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current QuoteVote
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("quote_id = ? AND user_id = ?", quoteID, userID).
+			Take(&current).Error
+		if err == nil && current.Value == value {
+			value = 0
+			return tx.Delete(&current).Error
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "quote_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+		}).Create(&QuoteVote{QuoteID: quoteID, UserID: userID, Value: value}).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to record vote: %w", err)
+	}
+	return value, nil
+}
+
+// Tally returns the rating of a quote
+func (r *Ratings) Tally(ctx context.Context, quoteID uint) (Rating, error) {
+	var rating Rating
+	err := r.db.WithContext(ctx).Model(&QuoteVote{}).
+		Select("count(*) FILTER (WHERE value > 0) AS up, count(*) FILTER (WHERE value < 0) AS down").
+		Where("quote_id = ?", quoteID).
+		Scan(&rating).Error
+	if err != nil {
+		return Rating{}, fmt.Errorf("failed to tally votes: %w", err)
+	}
+	return rating, nil
+}
+
+// Top returns up to limit quotes of a chat with a positive score, highest
+// first, with their entries. Duels won count like thumbs up. Ties go to the
+// quote with more thumbs up, then to the oldest.
+func (r *Ratings) Top(ctx context.Context, chatID int64, limit int) ([]RatedQuote, error) {
+	var rows []struct {
+		QuoteID uint
+		Up      int64
+		Down    int64
+		Wins    int64
+	}
+	err := r.db.WithContext(ctx).Raw(`
+		WITH votes AS (
+			SELECT v.quote_id, count(*) FILTER (WHERE v.value > 0) AS up, count(*) FILTER (WHERE v.value < 0) AS down
+			FROM quote_vote v JOIN quote q ON q.id = v.quote_id
+			WHERE q.chat_id = ?
+			GROUP BY v.quote_id
+		), wins AS (
+			SELECT winner_quote_id AS quote_id, count(*) AS wins
+			FROM quote_duel
+			WHERE chat_id = ? AND winner_quote_id IS NOT NULL
+			GROUP BY winner_quote_id
+		), ranked AS (
+			SELECT q.id AS quote_id, coalesce(v.up, 0) AS up, coalesce(v.down, 0) AS down, coalesce(w.wins, 0) AS wins
+			FROM quote q
+			LEFT JOIN votes v ON v.quote_id = q.id
+			LEFT JOIN wins w ON w.quote_id = q.id
+			WHERE q.chat_id = ? AND q.deleted_at IS NULL AND (v.quote_id IS NOT NULL OR w.quote_id IS NOT NULL)
+		)
+		SELECT quote_id, up, down, wins
+		FROM ranked
+		WHERE up + wins - down > 0
+		ORDER BY up + wins - down DESC, up DESC, quote_id
+		LIMIT ?`, chatID, chatID, chatID, limit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank quotes: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.QuoteID
+	}
+	var quotes []Quote
+	if err := r.db.WithContext(ctx).
+		Where("id IN ?", ids).
+		Preload("Entries", func(db *gorm.DB) *gorm.DB {
+			return db.Order("quote_entry.order ASC")
+		}).
+		Find(&quotes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get top quotes: %w", err)
+	}
+	byID := make(map[uint]Quote, len(quotes))
+	for _, quote := range quotes {
+		byID[quote.ID] = quote
+	}
+
+	top := make([]RatedQuote, 0, len(rows))
+	for _, row := range rows {
+		if quote, ok := byID[row.QuoteID]; ok {
+			top = append(top, RatedQuote{Quote: quote, Rating: Rating{Up: row.Up, Down: row.Down, Wins: row.Wins}})
+		}
+	}
+	return top, nil
+}
+
+// ratingButtons are the 👍 and 👎 buttons of a quote with its tally
+func ratingButtons(quoteID uint, rating Rating) []models.InlineKeyboardButton {
+	return []models.InlineKeyboardButton{
+		{Text: fmt.Sprintf("👍 %d", rating.Up), CallbackData: fmt.Sprintf("%s%d:up", rateCallbackPrefix, quoteID)},
+		{Text: fmt.Sprintf("👎 %d", rating.Down), CallbackData: fmt.Sprintf("%s%d:down", rateCallbackPrefix, quoteID)},
+	}
+}
+
+// withRatingButtons returns a copy of keyboard with its rating buttons
+// showing a new tally, keeping every other button
+func withRatingButtons(keyboard *models.InlineKeyboardMarkup, quoteID uint, rating Rating) *models.InlineKeyboardMarkup {
+	updated := &models.InlineKeyboardMarkup{}
+	if keyboard != nil {
+		for _, row := range keyboard.InlineKeyboard {
+			if len(row) > 0 && strings.HasPrefix(row[0].CallbackData, rateCallbackPrefix) {
+				continue
+			}
+			updated.InlineKeyboard = append(updated.InlineKeyboard, row)
+		}
+	}
+	updated.InlineKeyboard = append(updated.InlineKeyboard, ratingButtons(quoteID, rating))
+	return updated
+}
+
+// parseRateCallback extracts the quote and the vote, 1 or -1, of a rating
+// button
+func parseRateCallback(data string) (quoteID uint, value int, ok bool) {
+	if !strings.HasPrefix(data, rateCallbackPrefix) {
+		return 0, 0, false
+	}
+	id, direction, found := strings.Cut(strings.TrimPrefix(data, rateCallbackPrefix), ":")
+	if !found {
+		return 0, 0, false
+	}
+	switch direction {
+	case "up":
+		value = 1
+	case "down":
+		value = -1
+	default:
+		return 0, 0, false
+	}
+	parsed, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || parsed == 0 {
+		return 0, 0, false
+	}
+	return uint(parsed), value, true
+}
+
+// RateHandler handles the rating buttons under posted quotes
+type RateHandler struct {
+	store   *Store
+	ratings *Ratings
+}
+
+// NewRateHandler creates a new rating button handler
+func NewRateHandler(db *gorm.DB) *RateHandler {
+	return &RateHandler{store: NewStore(db), ratings: NewRatings(db)}
+}
+
+// HandleCallback records a vote and updates the tally on the buttons. Only
+// quotes of the chat the buttons are in are rated, whatever the callback
+// data says.
+func (h *RateHandler) HandleCallback(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil {
+		return nil
+	}
+	quoteID, value, ok := parseRateCallback(query.Data)
+	if !ok {
+		return nil
+	}
+	message := query.Message.Message
+
+	quote, err := h.store.GetByID(ctx, quoteID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && quote.ChatID != message.Chat.ID) {
+		_, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID, Text: "This quote no longer exists."})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	vote, err := h.ratings.Vote(ctx, quoteID, query.From.ID, value)
+	if err != nil {
+		return err
+	}
+	text := fmt.Sprintf("You took back your vote for quote #%d.", quoteID)
+	switch vote {
+	case 1:
+		text = fmt.Sprintf("You liked quote #%d.", quoteID)
+	case -1:
+		text = fmt.Sprintf("You disliked quote #%d.", quoteID)
+	}
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID, Text: text}); err != nil {
+		return err
+	}
+
+	rating, err := h.ratings.Tally(ctx, quoteID)
+	if err != nil {
+		return err
+	}
+	_, err = b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:      message.Chat.ID,
+		MessageID:   message.ID,
+		ReplyMarkup: withRatingButtons(message.ReplyMarkup, quoteID, rating),
+	})
+	return err
+}
+
+// TopQuotesHandler handles the /topquotes command
+type TopQuotesHandler struct {
+	ratings  *Ratings
+	renderer *Renderer
+	outbox   *outbox.Outbox
+}
+
+// NewTopQuotesHandler creates a new topquotes handler
+func NewTopQuotesHandler(db *gorm.DB) *TopQuotesHandler {
+	return &TopQuotesHandler{
+		ratings:  NewRatings(db),
+		renderer: NewRenderer(),
+		outbox:   outbox.New(db),
+	}
+}
+
+// Handle processes /topquotes, replying with the highest rated quotes of
+// the chat
+func (h *TopQuotesHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+	slog.Info("executing /topquotes command", "chat_id", chatID, "user_id", msg.From.ID)
+
+	top, err := h.ratings.Top(ctx, chatID, topQuotesLimit)
+	if err != nil {
+		return err
+	}
+	if len(top) == 0 {
+		return sendNotice(ctx, h.outbox, b, chatID, "No rated quotes yet. Vote for quotes with the 👍 and 👎 buttons under /rquote.")
+	}
+
+	lines := []string{"🏆 Top rated quotes:"}
+	for i := range top {
+		tally := fmt.Sprintf("%+d, 👍 %d 👎 %d", top[i].Score(), top[i].Up, top[i].Down)
+		if top[i].Wins > 0 {
+			tally += fmt.Sprintf(" ⚔️ %d", top[i].Wins)
+		}
+		lines = append(lines, fmt.Sprintf("%d. #%d (%s) %s", i+1, top[i].ID, tally, quotePreview(h.renderer, &top[i].Quote, listPreview)))
+	}
+	_, err = h.outbox.Send(ctx, b, &outbox.Message{ChatID: chatID, Text: strings.Join(lines, "\n\n")})
+	return err
+}
+
+// Command returns the command name
+func (h *TopQuotesHandler) Command() string {
+	return "/topquotes"
+}
+
+// Description returns the command description
+func (h *TopQuotesHandler) Description() string {
+	return "Show the highest rated quotes of the chat"
+}
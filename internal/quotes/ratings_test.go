@@ -0,0 +1,157 @@
+package quotes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestParseRateCallback(t *testing.T) {
+	quoteID, value, ok := parseRateCallback("quoterate:12:up")
+	require.True(t, ok)
+	assert.Equal(t, uint(12), quoteID)
+	assert.Equal(t, 1, value)
+
+	_, value, ok = parseRateCallback("quoterate:12:down")
+	require.True(t, ok)
+	assert.Equal(t, -1, value)
+
+	for _, data := range []string{"quoterate:12:sideways", "quoterate:12", "quoterate:0:up", "quoterate:x:up", "bookmark:save:12"} {
+		_, _, ok := parseRateCallback(data)
+		assert.False(t, ok, data)
+	}
+}
+
+func TestWithRatingButtons(t *testing.T) {
+	keyboard := withRatingButtons(saveKeyboard(7), 7, Rating{})
+	require.Len(t, keyboard.InlineKeyboard, 2)
+	assert.Equal(t, "⭐ Save", keyboard.InlineKeyboard[0][0].Text)
+	row := keyboard.InlineKeyboard[1]
+	require.Len(t, row, 2)
+	assert.Equal(t, "👍 0", row[0].Text)
+	assert.Equal(t, "quoterate:7:up", row[0].CallbackData)
+	assert.Equal(t, "👎 0", row[1].Text)
+	assert.Equal(t, "quoterate:7:down", row[1].CallbackData)
+
+	// A new tally replaces the buttons in place of adding more
+	keyboard = withRatingButtons(keyboard, 7, Rating{Up: 3, Down: 1})
+	require.Len(t, keyboard.InlineKeyboard, 2)
+	assert.Equal(t, []models.InlineKeyboardButton{
+		{Text: "👍 3", CallbackData: "quoterate:7:up"},
+		{Text: "👎 1", CallbackData: "quoterate:7:down"},
+	}, keyboard.InlineKeyboard[1])
+}
+
+func TestRatings(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ratings := NewRatings(db.DB)
+	ctx := context.Background()
+
+	var ids []uint
+	for _, chatID := range []int64{-100123, -100123, -100123, -100456} {
+		quote, err := store.Store(ctx, StoreOptions{
+			ChatID:  chatID,
+			Creator: map[string]interface{}{"id": 1},
+			Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"hi"}`)}},
+		})
+		require.NoError(t, err)
+		ids = append(ids, quote.ID)
+	}
+
+	vote := func(quoteID uint, userID int64, value int) int {
+		t.Helper()
+		got, err := ratings.Vote(ctx, quoteID, userID, value)
+		require.NoError(t, err)
+		return got
+	}
+
+	// Voting the same again takes the vote back, the other way changes it
+	assert.Equal(t, 1, vote(ids[0], 1, 1))
+	assert.Equal(t, 0, vote(ids[0], 1, 1))
+	assert.Equal(t, 1, vote(ids[0], 1, 1))
+	assert.Equal(t, -1, vote(ids[0], 2, -1))
+	assert.Equal(t, 1, vote(ids[0], 2, 1))
+	vote(ids[0], 3, -1)
+
+	rating, err := ratings.Tally(ctx, ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, Rating{Up: 2, Down: 1}, rating)
+	assert.Equal(t, int64(1), rating.Score())
+
+	_, err = ratings.Vote(ctx, ids[0], 1, 2)
+	assert.Error(t, err)
+
+	// Quote 2 ranks first, quote 3 has no positive score and quote 4 is
+	// in another chat
+	vote(ids[1], 1, 1)
+	vote(ids[1], 2, 1)
+	vote(ids[2], 1, -1)
+	vote(ids[3], 1, 1)
+
+	top, err := ratings.Top(ctx, -100123, 10)
+	require.NoError(t, err)
+	require.Len(t, top, 2)
+	assert.Equal(t, ids[1], top[0].ID)
+	assert.Equal(t, Rating{Up: 2}, top[0].Rating)
+	assert.Equal(t, ids[0], top[1].ID)
+	assert.Len(t, top[1].Entries, 1)
+
+	// Deleted quotes leave the ranking
+	require.NoError(t, store.Delete(ctx, ids[1]))
+	top, err = ratings.Top(ctx, -100123, 10)
+	require.NoError(t, err)
+	require.Len(t, top, 1)
+	assert.Equal(t, ids[0], top[0].ID)
+}
+
+func TestRatings_TopCountsDuelWins(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ratings := NewRatings(db.DB)
+	ctx := context.Background()
+
+	var ids []uint
+	for i := 0; i < 3; i++ {
+		quote, err := store.Store(ctx, StoreOptions{
+			ChatID:  -100123,
+			Creator: map[string]interface{}{"id": 1},
+			Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"hi"}`)}},
+		})
+		require.NoError(t, err)
+		ids = append(ids, quote.ID)
+	}
+	win := func(winner, loser uint) {
+		t.Helper()
+		require.NoError(t, db.DB.Create(&Duel{ChatID: -100123, FirstQuoteID: winner, SecondQuoteID: loser, EndsAt: time.Now(), WinnerQuoteID: &winner}).Error)
+	}
+
+	// Quote 1 has a thumbs up; quote 2 was never voted but won two duels;
+	// quote 3 won one and got a thumbs down
+	_, err := ratings.Vote(ctx, ids[0], 1, 1)
+	require.NoError(t, err)
+	win(ids[1], ids[0])
+	win(ids[1], ids[2])
+	win(ids[2], ids[0])
+	_, err = ratings.Vote(ctx, ids[2], 1, -1)
+	require.NoError(t, err)
+
+	top, err := ratings.Top(ctx, -100123, 10)
+	require.NoError(t, err)
+	require.Len(t, top, 2, "a win and a thumbs down cancel out")
+	assert.Equal(t, ids[1], top[0].ID)
+	assert.Equal(t, Rating{Wins: 2}, top[0].Rating)
+	assert.Equal(t, int64(2), top[0].Score())
+	assert.Equal(t, ids[0], top[1].ID)
+
+	// Other chats' duels do not count
+	top, err = ratings.Top(ctx, -100456, 10)
+	require.NoError(t, err)
+	assert.Empty(t, top)
+}
@@ -1,26 +1,45 @@
 package quotes
 
 import (
-	"encoding/json"
 	"fmt"
+	"html"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/message"
+	"github.com/graffic/wanon-go/internal/textutil"
 )
 
 // Render formats quotes as readable text.
 // This ports the Quotes.Render.render functionality from Elixir.
 
-type Renderer struct{}
+type Renderer struct {
+	clock clock.Clock // Reference time for relative dates
+}
 
 // NewRenderer creates a new quote renderer
 func NewRenderer() *Renderer {
-	return &Renderer{}
+	return NewRendererWithClock(clock.System{})
+}
+
+// NewRendererWithClock creates a quote renderer using clk as the reference
+// time for relative dates, making its output fully deterministic
+func NewRendererWithClock(clk clock.Clock) *Renderer {
+	return &Renderer{clock: clk}
 }
 
 // RenderOptions contains options for rendering a quote
 type RenderOptions struct {
 	Quote     *Quote
 	IncludeID bool
+	LabelBots bool     // Mark messages written by bots or sent via inline bots
+	Authors   *Authors // Chat nicknames shown instead of Telegram names
+	// CustomEmoji renders the quote as HTML showing custom emoji, which
+	// only bots with premium sticker access can send. Otherwise custom
+	// emoji show as their fallback emoji.
+	CustomEmoji bool
 }
 
 // RenderResult contains the rendered quote text and metadata
@@ -44,7 +63,7 @@ func (r *Renderer) Render(opts RenderOptions) (*RenderResult, error) {
 
 	// Render each entry
 	for _, entry := range opts.Quote.Entries {
-		rendered, err := r.renderEntry(entry)
+		rendered, err := r.renderEntry(entry, opts)
 		if err != nil {
 			return nil, fmt.Errorf("failed to render entry %d: %w", entry.Order, err)
 		}
@@ -54,7 +73,7 @@ func (r *Renderer) Render(opts RenderOptions) (*RenderResult, error) {
 	// Join entries with newlines
 	text := strings.Join(parts, "\n")
 
-	// Optionally include quote ID
+	// Optionally include quote ID, which needs no escaping
 	if opts.IncludeID {
 		text = fmt.Sprintf("#%d\n%s", opts.Quote.ID, text)
 	}
@@ -65,62 +84,134 @@ func (r *Renderer) Render(opts RenderOptions) (*RenderResult, error) {
 	}, nil
 }
 
-// renderEntry formats a single quote entry as text
-func (r *Renderer) renderEntry(entry QuoteEntry) (string, error) {
-	// Extract message data from JSON
-	var msgData struct {
-		Text string `json:"text"`
-		From struct {
-			FirstName    string `json:"first_name"`
-			LastName     string `json:"last_name"`
-			Username     string `json:"username"`
-			ID           int64  `json:"id"`
-			IsBot        bool   `json:"is_bot"`
-			LanguageCode string `json:"language_code"`
-		} `json:"from"`
-		Date int64 `json:"date"`
-	}
+// RenderedEntry is a quote entry split into its printable parts
+type RenderedEntry struct {
+	Author string
+	UserID int64 // Sender of the message, zero when sent on behalf of a chat
+	Text   string
+	Emoji  []message.Entity // Custom emoji in Text, offsets in UTF-16 code units
+	Date   time.Time        // Zero when the message has no date
+	Bot    bool             // Written by a bot
+	ViaBot string           // Inline bot the message was sent through, if any
+}
 
-	if err := json.Unmarshal(entry.Message, &msgData); err != nil {
-		return "", fmt.Errorf("failed to unmarshal message: %w", err)
+// Label returns the author followed by its bot marker, if any
+func (e RenderedEntry) Label() string {
+	switch {
+	case e.Bot:
+		return e.Author + " (bot)"
+	case e.ViaBot != "":
+		return e.Author + " (via " + e.ViaBot + ")"
 	}
+	return e.Author
+}
 
-	// Build author name
-	authorName := r.buildAuthorName(msgData.From.FirstName, msgData.From.LastName, msgData.From.Username)
+// HTML returns the text escaped for the HTML parse mode, with its custom
+// emoji as tg-emoji tags around their fallback emoji
+func (e RenderedEntry) HTML() string {
+	emoji := slices.Clone(e.Emoji)
+	slices.SortFunc(emoji, func(a, b message.Entity) int { return a.Offset - b.Offset })
 
-	// Format the entry
-	// Format: "<Author Name>: <message text>"
-	if msgData.Text == "" {
-		msgData.Text = "(no text)"
+	var b strings.Builder
+	pos := 0
+	for _, entity := range emoji {
+		start := textutil.ByteOffset(e.Text, entity.Offset)
+		end := textutil.ByteOffset(e.Text, entity.Offset+entity.Length)
+		if entity.CustomEmojiID == "" || start < pos || end <= start {
+			// Overlapping or out of range: keep the fallback
+			continue
+		}
+		b.WriteString(html.EscapeString(e.Text[pos:start]))
+		fmt.Fprintf(&b, `<tg-emoji emoji-id="%s">%s</tg-emoji>`, html.EscapeString(entity.CustomEmojiID), html.EscapeString(e.Text[start:end]))
+		pos = end
 	}
+	b.WriteString(html.EscapeString(e.Text[pos:]))
+	return b.String()
+}
 
-	return fmt.Sprintf("%s: %s", authorName, msgData.Text), nil
+// Entries returns the printable parts of every entry of a quote, in order,
+// with authors named as the chat knows them. Layouts other than plain text
+// (PDF, HTML) build on it.
+func (r *Renderer) Entries(quote *Quote, authors *Authors) ([]RenderedEntry, error) {
+	entries := make([]RenderedEntry, 0, len(quote.Entries))
+	for _, entry := range quote.Entries {
+		rendered, err := r.parseEntry(entry, authors)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render entry %d: %w", entry.Order, err)
+		}
+		entries = append(entries, rendered)
+	}
+	return entries, nil
 }
 
-// buildAuthorName builds a display name from user info
-func (r *Renderer) buildAuthorName(firstName, lastName, username string) string {
-	var parts []string
+// renderEntry formats a single quote entry as text
+func (r *Renderer) renderEntry(entry QuoteEntry, opts RenderOptions) (string, error) {
+	rendered, err := r.parseEntry(entry, opts.Authors)
+	if err != nil {
+		return "", err
+	}
 
-	if firstName != "" {
-		parts = append(parts, firstName)
+	author := rendered.Author
+	if opts.LabelBots {
+		author = rendered.Label()
 	}
-	if lastName != "" {
-		parts = append(parts, lastName)
+	if opts.CustomEmoji {
+		return fmt.Sprintf("%s: %s", html.EscapeString(author), rendered.HTML()), nil
 	}
 
-	name := strings.Join(parts, " ")
+	// Format: "<Author Name>: <message text>"
+	return fmt.Sprintf("%s: %s", author, rendered.Text), nil
+}
+
+// parseEntry extracts the author, text and date of a quote entry
+func (r *Renderer) parseEntry(entry QuoteEntry, authors *Authors) (RenderedEntry, error) {
+	msg, err := message.Parse(entry.Message)
+	if err != nil {
+		return RenderedEntry{}, err
+	}
 
-	// If no name available, use username
-	if name == "" && username != "" {
-		name = "@" + username
+	text, emoji := msg.Body(), msg.BodyEntities()
+	switch {
+	case text == "" && msg.Media != nil:
+		text, emoji = "("+strings.ReplaceAll(msg.Media.Type, "_", " ")+")", nil
+	case text == "":
+		text, emoji = "(no text)", nil
 	}
 
-	// Fallback
-	if name == "" {
-		name = "Unknown"
+	from := msg.From
+	if from == nil {
+		from = &message.User{}
+	}
+	rendered := RenderedEntry{
+		Author: authors.DisplayName(from.ID, r.buildAuthorName(from.FirstName, from.LastName, from.Username)),
+		UserID: from.ID,
+		Text:   text,
+		Emoji:  emoji,
+		Bot:    from.IsBot && msg.SenderChat == nil,
+	}
+	if sender := msg.SenderChat; sender != nil {
+		// Channel posts forwarded to the discussion group, anonymous admins
+		// and users posting as a channel come from placeholder accounts;
+		// the chat they speak for is the real author
+		rendered.Author = r.buildAuthorName(sender.Title, "", sender.Username)
+		rendered.UserID = 0
+	}
+	if via := msg.ViaBot; via != nil {
+		// Inline bots are best known by their username
+		rendered.ViaBot = "@" + via.Username
+		if via.Username == "" {
+			rendered.ViaBot = r.buildAuthorName(via.FirstName, "", "")
+		}
+	}
+	if msg.Date > 0 {
+		rendered.Date = time.Unix(msg.Date, 0)
 	}
+	return rendered, nil
+}
 
-	return name
+// buildAuthorName builds a display name from user info
+func (r *Renderer) buildAuthorName(firstName, lastName, username string) string {
+	return authorName(firstName, lastName, username)
 }
 
 // RenderSimple renders a quote in a simple format (just the text)
@@ -134,19 +225,31 @@ func (r *Renderer) RenderSimple(quote *Quote) (string, error) {
 
 // RenderWithDate renders a quote including the date of the first message
 func (r *Renderer) RenderWithDate(quote *Quote) (string, error) {
-	result, err := r.Render(RenderOptions{Quote: quote, IncludeID: true})
+	return r.RenderWithDateFormat(quote, DateFormat{})
+}
+
+// RenderWithDateFormat renders a quote including the date of the first message,
+// printed according to the given date format
+func (r *Renderer) RenderWithDateFormat(quote *Quote, format DateFormat) (string, error) {
+	return r.RenderDated(RenderOptions{Quote: quote, IncludeID: true}, format)
+}
+
+// RenderDated renders a quote like Render, followed by the date of the first
+// message printed according to the given date format
+func (r *Renderer) RenderDated(opts RenderOptions, format DateFormat) (string, error) {
+	quote := opts.Quote
+	result, err := r.Render(opts)
 	if err != nil {
 		return "", err
 	}
 
 	// Try to extract date from first entry
 	if len(quote.Entries) > 0 {
-		var msgData struct {
-			Date int64 `json:"date"`
-		}
-		if err := json.Unmarshal(quote.Entries[0].Message, &msgData); err == nil && msgData.Date > 0 {
-			msgTime := time.Unix(msgData.Date, 0).UTC()
-			dateStr := msgTime.Format("2006-01-02 15:04")
+		if msg, err := message.Parse(quote.Entries[0].Message); err == nil && msg.Date > 0 {
+			dateStr := format.Format(time.Unix(msg.Date, 0), r.clock.Now())
+			if opts.CustomEmoji {
+				dateStr = html.EscapeString(dateStr)
+			}
 			result.Text = fmt.Sprintf("%s\n📅 %s", result.Text, dateStr)
 		}
 	}
@@ -0,0 +1,204 @@
+package quotes
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// goldenNow is the frozen clock used by golden renders
+var goldenNow = time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+func TestRenderer_Golden(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+
+	conversation := createTestQuoteWithDate(42, []testMessage{
+		{FirstName: "Alice", LastName: "Smith", Text: "Did anyone see my keys?"},
+		{Username: "bob", Text: "In the fridge, obviously"},
+		{Text: "Why the fridge?!"},
+		{FirstName: "Alice", Text: ""},
+	}, 1609459200) // 2021-01-01 00:00:00 UTC
+
+	unicode := createTestQuoteWithDate(7, []testMessage{
+		{FirstName: "Zoë", Text: "¿Qué pasa? 🤔 Ça va 👨‍👩‍👧"},
+	}, 1609459200)
+
+	bots := rawQuote(8,
+		`{"text":"/weather","from":{"id":1,"first_name":"Alice"},"date":1609459200}`,
+		`{"text":"Sunny, 25°C","from":{"id":9,"first_name":"WeatherBot","is_bot":true}}`,
+		`{"text":"🎲","from":{"id":1,"first_name":"Alice"},"via_bot":{"id":10,"first_name":"Dice","username":"dice_bot","is_bot":true}}`,
+		`{"text":"Nice roll","from":{"id":2,"first_name":"Bob"},"via_bot":{"id":11,"first_name":"Shouter","is_bot":true}}`,
+	)
+
+	// Bob (3) merged his second account (4) into the first; Alice has a
+	// nickname
+	nicknamed := rawQuote(9,
+		`{"text":"Who ate my lunch?","from":{"id":1,"first_name":"Alice"}}`,
+		`{"text":"Not me","from":{"id":3,"first_name":"Bob"}}`,
+		`{"text":"Definitely not me","from":{"id":4,"first_name":"Robert","username":"bob_alt"}}`,
+		`{"text":"Suspicious","from":{"id":5,"first_name":"Carol"}}`,
+	)
+	authors := NewAuthors(map[int64]string{1: "Ali"}).WithAliases(map[int64]int64{4: 3}, map[int64]string{3: "Bob"})
+
+	anonymous := rawQuote(10,
+		`{"text":"New episode is out!","from":{"id":136817688,"first_name":"Channel","is_bot":true},"sender_chat":{"id":-100555,"title":"Podcast","username":"podcast"},"is_automatic_forward":true}`,
+		`{"text":"Please keep it civil","from":{"id":1087968824,"first_name":"Group","username":"GroupAnonymousBot","is_bot":true},"sender_chat":{"id":-100123,"title":"Book Club"}}`,
+		`{"text":"Sorry!","from":{"id":2,"first_name":"Bob"}}`,
+	)
+
+	emoji := rawQuote(11,
+		`{"text":"café 👍 <3 🔥","from":{"id":1,"first_name":"A&B"},"date":1609459200,
+			"entities":[{"type":"custom_emoji","offset":5,"length":2,"custom_emoji_id":"111"},{"type":"custom_emoji","offset":11,"length":2,"custom_emoji_id":"222"}]}`,
+		`{"caption":"🎉!","from":{"id":2,"first_name":"Bob"},"media":{"type":"photo","file_id":"p1"},
+			"caption_entities":[{"type":"custom_emoji","offset":0,"length":2,"custom_emoji_id":"333"}]}`,
+	)
+
+	media := rawQuote(12,
+		`{"caption":"Look at this","from":{"id":1,"first_name":"Alice"},"media":{"type":"photo","file_id":"p1"}}`,
+		`{"from":{"id":2,"first_name":"Bob"},"media":{"type":"sticker","file_id":"s1"}}`,
+		`{"from":{"id":1,"first_name":"Alice"},"media":{"type":"video_note","file_id":"v1"}}`,
+		`{"from":{"id":2,"first_name":"Bob"},"media":{"type":"voice","file_id":"a1"}}`,
+		`{"from":{"id":3,"first_name":"Carol"}}`,
+	)
+
+	escaping := rawQuote(13,
+		`{"text":"*bold* _italic_ `+"`code`"+` [link](https://example.com)","from":{"id":1,"first_name":"Alice_*"},"date":1609459200}`,
+		`{"text":"<b>not bold</b> & &amp; \"quoted\" 'single'","from":{"id":2,"first_name":"<Bob>"}}`,
+	)
+
+	linked := []*Quote{
+		rawQuote(14, `{"message_id":321,"text":"In public","chat":{"id":-100777,"type":"supergroup","username":"bookclub"},"from":{"id":1,"first_name":"Alice"}}`),
+		rawQuote(15, `{"message_id":654,"text":"In private","chat":{"id":-1001234567890,"type":"supergroup"},"from":{"id":1,"first_name":"Alice"}}`),
+		rawQuote(16, `{"message_id":9,"text":"In a basic group","chat":{"id":-4567,"type":"group"},"from":{"id":1,"first_name":"Alice"}}`),
+	}
+
+	tests := []struct {
+		name   string
+		render func(r *Renderer) (string, error)
+	}{
+		{
+			name:   "simple",
+			render: func(r *Renderer) (string, error) { return r.RenderSimple(conversation) },
+		},
+		{
+			name: "with_id",
+			render: func(r *Renderer) (string, error) {
+				result, err := r.Render(RenderOptions{Quote: conversation, IncludeID: true})
+				if err != nil {
+					return "", err
+				}
+				return result.Text, nil
+			},
+		},
+		{
+			name:   "with_date",
+			render: func(r *Renderer) (string, error) { return r.RenderWithDate(conversation) },
+		},
+		{
+			name: "with_date_localized",
+			render: func(r *Renderer) (string, error) {
+				return r.RenderWithDateFormat(conversation, DateFormat{Location: madrid, Layout: "02/01/2006 15:04"})
+			},
+		},
+		{
+			name: "with_date_relative",
+			render: func(r *Renderer) (string, error) {
+				return r.RenderWithDateFormat(conversation, DateFormat{Relative: true})
+			},
+		},
+		{
+			name:   "unicode",
+			render: func(r *Renderer) (string, error) { return r.RenderWithDate(unicode) },
+		},
+		{
+			name:   "bot_label",
+			render: renderText(RenderOptions{Quote: bots, IncludeID: true, LabelBots: true}),
+		},
+		{
+			name:   "nicknames",
+			render: renderText(RenderOptions{Quote: nicknamed, IncludeID: true, Authors: authors}),
+		},
+		{
+			name:   "anonymous_admins",
+			render: renderText(RenderOptions{Quote: anonymous, IncludeID: true, LabelBots: true}),
+		},
+		{
+			name:   "custom_emoji",
+			render: renderText(RenderOptions{Quote: emoji, IncludeID: true, CustomEmoji: true}),
+		},
+		{
+			name: "custom_emoji_dated",
+			render: func(r *Renderer) (string, error) {
+				return r.RenderDated(RenderOptions{Quote: emoji, IncludeID: true, CustomEmoji: true}, DateFormat{Layout: "02 Jan 2006 <15:04>"})
+			},
+		},
+		{
+			name:   "media_placeholders",
+			render: renderText(RenderOptions{Quote: media, IncludeID: true}),
+		},
+		{
+			name:   "escaping_plain",
+			render: func(r *Renderer) (string, error) { return r.RenderWithDate(escaping) },
+		},
+		{
+			name:   "escaping_html",
+			render: renderText(RenderOptions{Quote: escaping, IncludeID: true, CustomEmoji: true}),
+		},
+		{
+			// Posted quotes link to the original message with a button
+			name: "links",
+			render: func(r *Renderer) (string, error) {
+				var posts []string
+				for _, quote := range linked {
+					text, err := r.RenderDated(RenderOptions{Quote: quote, IncludeID: true}, DateFormat{})
+					if err != nil {
+						return "", err
+					}
+					markup, err := json.MarshalIndent(quoteKeyboard(quote, true), "", "  ")
+					if err != nil {
+						return "", err
+					}
+					posts = append(posts, text+"\n--- reply_markup\n"+string(markup))
+				}
+				return strings.Join(posts, "\n\n"), nil
+			},
+		},
+	}
+
+	renderer := NewRendererWithClock(clock.NewMock(goldenNow))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := tt.render(renderer)
+			require.NoError(t, err)
+			testutils.AssertGolden(t, "render/"+tt.name, text)
+		})
+	}
+}
+
+// renderText renders a quote with opts for a golden file
+func renderText(opts RenderOptions) func(r *Renderer) (string, error) {
+	return func(r *Renderer) (string, error) {
+		result, err := r.Render(opts)
+		if err != nil {
+			return "", err
+		}
+		return result.Text, nil
+	}
+}
+
+// rawQuote builds a quote from the cached JSON of its messages
+func rawQuote(id uint, messages ...string) *Quote {
+	entries := make([]QuoteEntry, len(messages))
+	for i, msg := range messages {
+		entries[i] = QuoteEntry{Order: i, Message: datatypes.JSON(msg)}
+	}
+	return &Quote{ID: id, Entries: entries}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/graffic/wanon-go/internal/message"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/datatypes"
@@ -290,3 +291,188 @@ func createTestQuoteWithRawMessage(id uint, data map[string]interface{}) *Quote
 		},
 	}
 }
+
+func TestRenderer_LabelBots(t *testing.T) {
+	quote := &Quote{
+		ID: 1,
+		Entries: []QuoteEntry{
+			{Order: 0, Message: datatypes.JSON(`{"text":"/weather","from":{"id":1,"first_name":"Alice"}}`)},
+			{Order: 1, Message: datatypes.JSON(`{"text":"Sunny, 25C","from":{"id":2,"first_name":"WeatherBot","is_bot":true}}`)},
+			{Order: 2, Message: datatypes.JSON(`{"text":"look at this","from":{"id":3,"first_name":"Bob"},"via_bot":{"id":4,"first_name":"GIF","username":"gif"}}`)},
+		},
+	}
+	renderer := NewRenderer()
+
+	plain, err := renderer.Render(RenderOptions{Quote: quote})
+	require.NoError(t, err)
+	assert.Equal(t, "Alice: /weather\nWeatherBot: Sunny, 25C\nBob: look at this", plain.Text)
+
+	labelled, err := renderer.Render(RenderOptions{Quote: quote, LabelBots: true})
+	require.NoError(t, err)
+	assert.Equal(t, "Alice: /weather\nWeatherBot (bot): Sunny, 25C\nBob (via @gif): look at this", labelled.Text)
+
+	entries, err := renderer.Entries(quote, nil)
+	require.NoError(t, err)
+	assert.True(t, entries[1].Bot)
+	assert.Equal(t, "@gif", entries[2].ViaBot)
+}
+
+func TestRenderer_Nicknames(t *testing.T) {
+	quote := &Quote{
+		ID: 1,
+		Entries: []QuoteEntry{
+			{Order: 0, Message: datatypes.JSON(`{"text":"ahoy","from":{"id":12345,"first_name":"Juan"}}`)},
+			{Order: 1, Message: datatypes.JSON(`{"text":"hi","from":{"id":2,"first_name":"Bob"}}`)},
+		},
+	}
+	renderer := NewRenderer()
+	authors := NewAuthors(map[int64]string{12345: "El Capitán"})
+
+	result, err := renderer.Render(RenderOptions{Quote: quote, Authors: authors})
+	require.NoError(t, err)
+	assert.Equal(t, "El Capitán: ahoy\nBob: hi", result.Text)
+
+	entries, err := renderer.Entries(quote, authors)
+	require.NoError(t, err)
+	assert.Equal(t, "El Capitán", entries[0].Author)
+	assert.Equal(t, "Bob", entries[1].Author)
+}
+
+func TestRenderer_MergedAuthors(t *testing.T) {
+	quote := &Quote{
+		ID: 1,
+		Entries: []QuoteEntry{
+			{Order: 0, Message: datatypes.JSON(`{"text":"old account","from":{"id":111,"first_name":"Juan"}}`)},
+			{Order: 1, Message: datatypes.JSON(`{"text":"new account","from":{"id":222,"first_name":"Juan Carlos"}}`)},
+		},
+	}
+	renderer := NewRenderer()
+	authors := NewAuthors(nil).WithAliases(map[int64]int64{111: 222}, map[int64]string{222: "Juan Carlos"})
+
+	result, err := renderer.Render(RenderOptions{Quote: quote, Authors: authors})
+	require.NoError(t, err)
+	assert.Equal(t, "Juan Carlos: old account\nJuan Carlos: new account", result.Text)
+
+	// Nicknames of the canonical user apply to every identity
+	authors = NewAuthors(map[int64]string{222: "JC"}).WithAliases(map[int64]int64{111: 222}, nil)
+	result, err = renderer.Render(RenderOptions{Quote: quote, Authors: authors})
+	require.NoError(t, err)
+	assert.Equal(t, "JC: old account\nJC: new account", result.Text)
+}
+
+func TestRenderer_LinkedChannel(t *testing.T) {
+	quote := &Quote{
+		ID: 1,
+		Entries: []QuoteEntry{
+			{Order: 0, Message: datatypes.JSON(`{"text":"New episode out","from":{"id":777000,"first_name":"Telegram"},"sender_chat":{"id":-100555,"type":"channel","title":"Wanon News"},"is_automatic_forward":true}`)},
+			{Order: 1, Message: datatypes.JSON(`{"text":"finally","from":{"id":2,"first_name":"Bob"}}`)},
+			{Order: 2, Message: datatypes.JSON(`{"text":"again","from":{"id":777000,"first_name":"Telegram"},"sender_chat":{"id":-100556,"type":"channel","username":"wanon_news"},"is_automatic_forward":true}`)},
+		},
+	}
+
+	result, err := NewRenderer().Render(RenderOptions{Quote: quote})
+	require.NoError(t, err)
+	assert.Equal(t, "Wanon News: New episode out\nBob: finally\n@wanon_news: again", result.Text)
+}
+
+func TestRenderer_AnonymousAdmin(t *testing.T) {
+	quote := &Quote{
+		ID: 1,
+		Entries: []QuoteEntry{
+			{Order: 0, Message: datatypes.JSON(`{"text":"Rules updated","chat":{"id":-100123},"from":{"id":1087968824,"first_name":"Group","username":"GroupAnonymousBot","is_bot":true},"sender_chat":{"id":-100123,"type":"supergroup","title":"Quote Club"}}`)},
+		},
+	}
+	renderer := NewRenderer()
+
+	result, err := renderer.Render(RenderOptions{Quote: quote, LabelBots: true})
+	require.NoError(t, err)
+	assert.Equal(t, "Quote Club: Rules updated", result.Text)
+}
+
+func TestRenderer_Caption(t *testing.T) {
+	quote := &Quote{
+		ID: 1,
+		Entries: []QuoteEntry{
+			{Order: 0, Message: datatypes.JSON(`{"caption":"look at this cat","from":{"id":1,"first_name":"Alice"}}`)},
+			{Order: 1, Message: datatypes.JSON(`{"from":{"id":2,"first_name":"Bob"}}`)},
+		},
+	}
+
+	result, err := NewRenderer().Render(RenderOptions{Quote: quote})
+	require.NoError(t, err)
+	assert.Equal(t, "Alice: look at this cat\nBob: (no text)", result.Text)
+}
+
+func TestRenderer_MediaWithoutCaption(t *testing.T) {
+	quote := &Quote{
+		ID: 1,
+		Entries: []QuoteEntry{
+			{Order: 0, Message: datatypes.JSON(`{"media":{"type":"video_note","file_id":"x"},"from":{"id":1,"first_name":"Alice"}}`)},
+			{Order: 1, Message: datatypes.JSON(`{"text":"lol","from":{"id":2,"first_name":"Bob"}}`)},
+		},
+	}
+
+	result, err := NewRenderer().Render(RenderOptions{Quote: quote})
+	require.NoError(t, err)
+	assert.Equal(t, "Alice: (video note)\nBob: lol", result.Text)
+}
+
+func TestRenderer_CustomEmoji(t *testing.T) {
+	// 👍 and 🔥 take two UTF-16 code units each, é one
+	quote := &Quote{
+		ID: 1,
+		Entries: []QuoteEntry{
+			{Order: 0, Message: datatypes.JSON(`{"text":"café 👍 <3 🔥","from":{"id":1,"first_name":"A&B"},
+				"entities":[{"type":"custom_emoji","offset":5,"length":2,"custom_emoji_id":"111"},{"type":"custom_emoji","offset":11,"length":2,"custom_emoji_id":"222"}]}`)},
+			{Order: 1, Message: datatypes.JSON(`{"caption":"🎉!","from":{"id":2,"first_name":"Bob"},
+				"caption_entities":[{"type":"custom_emoji","offset":0,"length":2,"custom_emoji_id":"333"}]}`)},
+		},
+	}
+
+	// Without the option custom emoji show as their fallback
+	result, err := NewRenderer().Render(RenderOptions{Quote: quote})
+	require.NoError(t, err)
+	assert.Equal(t, "A&B: café 👍 <3 🔥\nBob: 🎉!", result.Text)
+
+	result, err = NewRenderer().Render(RenderOptions{Quote: quote, IncludeID: true, CustomEmoji: true})
+	require.NoError(t, err)
+	assert.Equal(t, "#1\n"+
+		`A&amp;B: café <tg-emoji emoji-id="111">👍</tg-emoji> &lt;3 <tg-emoji emoji-id="222">🔥</tg-emoji>`+"\n"+
+		`Bob: <tg-emoji emoji-id="333">🎉</tg-emoji>!`, result.Text)
+}
+
+func TestRenderedEntry_HTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry RenderedEntry
+		want  string
+	}{
+		{
+			name:  "no emoji",
+			entry: RenderedEntry{Text: "a <b> & c"},
+			want:  "a &lt;b&gt; &amp; c",
+		},
+		{
+			name: "unsorted entities",
+			entry: RenderedEntry{Text: "😀😀", Emoji: []message.Entity{
+				{Type: "custom_emoji", Offset: 2, Length: 2, CustomEmojiID: "2"},
+				{Type: "custom_emoji", Offset: 0, Length: 2, CustomEmojiID: "1"},
+			}},
+			want: `<tg-emoji emoji-id="1">😀</tg-emoji><tg-emoji emoji-id="2">😀</tg-emoji>`,
+		},
+		{
+			name: "out of range and overlapping entities keep the fallback",
+			entry: RenderedEntry{Text: "x😀", Emoji: []message.Entity{
+				{Type: "custom_emoji", Offset: 1, Length: 2, CustomEmojiID: "1"},
+				{Type: "custom_emoji", Offset: 2, Length: 2, CustomEmojiID: "2"},
+				{Type: "custom_emoji", Offset: 3, Length: 2, CustomEmojiID: "3"},
+			}},
+			want: `x<tg-emoji emoji-id="1">😀</tg-emoji>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.entry.HTML())
+		})
+	}
+}
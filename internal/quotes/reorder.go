@@ -0,0 +1,244 @@
+package quotes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"gorm.io/gorm"
+)
+
+// reorderUsage explains the /reorder arguments
+const reorderUsage = "Usage: /reorder <quote id> <new order>, e.g. /reorder 42 3,1,2 to put the third message first"
+
+// ParseOrder parses a new entry order such as "3,1,2" or "3 1 2": the
+// current positions of the entries, counted from 1, in their new order
+func ParseOrder(args []string) ([]int, error) {
+	fields := strings.FieldsFunc(strings.Join(args, ","), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	if len(fields) == 0 {
+		return nil, errors.New("missing the new order")
+	}
+	order := make([]int, 0, len(fields))
+	for _, field := range fields {
+		position, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid position %q", field)
+		}
+		order = append(order, position)
+	}
+	return order, nil
+}
+
+// ValidateOrder checks that order lists each position from 1 to entries
+// exactly once
+func ValidateOrder(order []int, entries int) error {
+	if len(order) != entries {
+		return fmt.Errorf("the quote has %d messages, the new order lists %d", entries, len(order))
+	}
+	seen := make([]bool, entries)
+	for _, position := range order {
+		if position < 1 || position > entries {
+			return fmt.Errorf("position %d is out of range, use 1 to %d", position, entries)
+		}
+		if seen[position-1] {
+			return fmt.Errorf("position %d is listed twice", position)
+		}
+		seen[position-1] = true
+	}
+	return nil
+}
+
+// Reorder changes the order of the entries of a quote. order lists the
+// current positions of the entries, counted from 1, in their new order.
+// The entries are read and rewritten in one transaction, so the order is
+// checked against the entries it applies to.
+func (s *Store) Reorder(ctx context.Context, quoteID uint, order []int) error {
+	err := s.Transaction(ctx, func(store *Store) error {
+		var entries []QuoteEntry
+		if err := store.db.WithContext(ctx).
+			Where("quote_id = ?", quoteID).
+			Order("quote_entry.order ASC").
+			Find(&entries).Error; err != nil {
+			return fmt.Errorf("failed to get quote entries: %w", err)
+		}
+		if err := ValidateOrder(order, len(entries)); err != nil {
+			return err
+		}
+		if err := store.saveVersion(ctx, quoteID, VersionReorder); err != nil {
+			return err
+		}
+		for i, position := range order {
+			entry := entries[position-1]
+			if entry.Order == i {
+				continue
+			}
+			if err := store.db.WithContext(ctx).
+				Model(&QuoteEntry{}).
+				Where("id = ?", entry.ID).
+				Update("order", i).Error; err != nil {
+				return fmt.Errorf("failed to reorder quote entry %d: %w", entry.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil || s.events == nil {
+		return err
+	}
+	quote, err := s.GetByID(ctx, quoteID)
+	if err != nil {
+		return err
+	}
+	s.publish(ctx, events.QuoteChanged, quote.ChatID, quote)
+	return nil
+}
+
+// createdBy reports whether a user added the quote. Creators kept only as
+// a hash match when the store hashes with the same key.
+func (s *Store) createdBy(quote *Quote, userID int64) bool {
+	var creator map[string]interface{}
+	if err := json.Unmarshal(quote.Creator, &creator); err != nil {
+		return false
+	}
+	id := strconv.FormatInt(userID, 10)
+	if stored, ok := creator["id"]; ok {
+		return creatorID(stored) == id
+	}
+	hash, ok := creator["id_hash"].(string)
+	return ok && hash == s.creators.hashID(id)
+}
+
+// ReorderHandler handles the /reorder command
+type ReorderHandler struct {
+	store  *Store
+	outbox *outbox.Outbox
+	guard  *editGuard
+	poster *quotePoster
+}
+
+// NewReorderHandler creates a new reorder handler letting creators reorder
+// their quotes for DefaultEditWindow
+func NewReorderHandler(db *gorm.DB) *ReorderHandler {
+	store := NewStore(db)
+	return &ReorderHandler{
+		store:  store,
+		outbox: outbox.New(db),
+		guard:  &editGuard{store: store, clock: clock.System{}, window: DefaultEditWindow},
+		poster: newQuotePoster(db),
+	}
+}
+
+// WithCreatorPolicy matches creators the way the policy stored them
+func (h *ReorderHandler) WithCreatorPolicy(policy CreatorPolicy) *ReorderHandler {
+	h.store.WithCreatorPolicy(policy)
+	return h
+}
+
+// WithEvents publishes the reordered quotes
+func (h *ReorderHandler) WithEvents(publisher events.Publisher) *ReorderHandler {
+	h.store.WithEvents(publisher)
+	return h
+}
+
+// WithCustomEmoji shows custom emoji in posted quotes instead of their
+// fallback emoji
+func (h *ReorderHandler) WithCustomEmoji(enabled bool) *ReorderHandler {
+	h.poster.customEmoji = enabled
+	return h
+}
+
+// WithAdmins checks admins against a shared cache of chat administrators
+func (h *ReorderHandler) WithAdmins(admins *telegram.AdminService) *ReorderHandler {
+	h.guard.admins = admins
+	return h
+}
+
+// WithEditWindow sets how long creators can reorder their quotes; zero is
+// forever
+func (h *ReorderHandler) WithEditWindow(window time.Duration) *ReorderHandler {
+	h.guard.window = window
+	return h
+}
+
+// WithClock replaces the clock timing the edit window
+func (h *ReorderHandler) WithClock(clk clock.Clock) *ReorderHandler {
+	h.guard.clock = clk
+	return h
+}
+
+// Handle processes /reorder <quote id> <new order>. The user who added the
+// quote can reorder it during the edit window, chat administrators at any
+// time.
+func (h *ReorderHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	if args.Len() < 2 {
+		return sendNotice(ctx, h.outbox, b, chatID, reorderUsage)
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(args.Arg(0), "#"), 10, 64)
+	if err != nil {
+		return sendNotice(ctx, h.outbox, b, chatID, reorderUsage)
+	}
+	order, err := ParseOrder(args.Fields[1:])
+	if err != nil {
+		return sendNotice(ctx, h.outbox, b, chatID, err.Error()+"\n\n"+reorderUsage)
+	}
+
+	quote, err := h.store.GetByID(ctx, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && quote.ChatID != chatID) {
+		return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("Quote #%d not found in this chat.", id))
+	}
+	if err != nil {
+		return err
+	}
+
+	actor, denied, err := h.guard.allow(ctx, b, msg, quote, "reorder")
+	if err != nil {
+		return err
+	}
+	if denied != "" {
+		return sendNotice(ctx, h.outbox, b, chatID, denied)
+	}
+
+	if err := ValidateOrder(order, len(quote.Entries)); err != nil {
+		return sendNotice(ctx, h.outbox, b, chatID, err.Error()+"\n\n"+reorderUsage)
+	}
+	if err := h.store.Reorder(ctx, quote.ID, order); err != nil {
+		return err
+	}
+	slog.Info("quote reordered", "audit", true, "chat_id", chatID, "user_id", actor.UserID, "anonymous_admin", actor.AnonymousAdmin, "quote_id", quote.ID, "order", order)
+
+	reordered, err := h.store.GetByID(ctx, quote.ID)
+	if err != nil {
+		return err
+	}
+	return h.poster.post(ctx, b, msg, reordered)
+}
+
+// Command returns the command name
+func (h *ReorderHandler) Command() string {
+	return "/reorder"
+}
+
+// Description returns the command description
+func (h *ReorderHandler) Description() string {
+	return "Change the order of the messages of a quote (its creator for a while after adding it, or admins)"
+}
@@ -0,0 +1,100 @@
+package quotes
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestParseOrder(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    []int
+		wantErr bool
+	}{
+		{args: []string{"3,1,2"}, want: []int{3, 1, 2}},
+		{args: []string{"3", "1", "2"}, want: []int{3, 1, 2}},
+		{args: []string{"3,", "1,2"}, want: []int{3, 1, 2}},
+		{args: nil, wantErr: true},
+		{args: []string{"3,a,2"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseOrder(tt.args)
+		if tt.wantErr {
+			assert.Error(t, err, "args %v", tt.args)
+			continue
+		}
+		require.NoError(t, err, "args %v", tt.args)
+		assert.Equal(t, tt.want, got)
+	}
+}
+
+func TestValidateOrder(t *testing.T) {
+	assert.NoError(t, ValidateOrder([]int{3, 1, 2}, 3))
+	assert.NoError(t, ValidateOrder([]int{1}, 1))
+
+	assert.ErrorContains(t, ValidateOrder([]int{2, 1}, 3), "has 3 messages")
+	assert.ErrorContains(t, ValidateOrder([]int{1, 2, 4}, 3), "out of range")
+	assert.ErrorContains(t, ValidateOrder([]int{0, 1, 2}, 3), "out of range")
+	assert.ErrorContains(t, ValidateOrder([]int{1, 1, 2}, 3), "listed twice")
+}
+
+func TestStore_CreatedBy(t *testing.T) {
+	policy, err := NewCreatorPolicy(string(CreatorHash), "secret")
+	require.NoError(t, err)
+	store := NewStore(nil).WithCreatorPolicy(policy)
+
+	plain := &Quote{Creator: datatypes.JSON(`{"id": 123, "first_name": "Ann"}`)}
+	assert.True(t, store.createdBy(plain, 123))
+	assert.False(t, store.createdBy(plain, 456))
+
+	creator, err := json.Marshal(policy.Apply(map[string]interface{}{"id": 123}))
+	require.NoError(t, err)
+	hashed := &Quote{Creator: datatypes.JSON(creator)}
+	assert.True(t, store.createdBy(hashed, 123))
+	assert.False(t, store.createdBy(hashed, 456))
+
+	assert.False(t, store.createdBy(&Quote{Creator: datatypes.JSON(`{}`)}, 123))
+}
+
+func TestStore_Reorder(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ctx := context.Background()
+
+	quote, err := store.Store(ctx, StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []CacheEntry{
+			{Message: datatypes.JSON(`{"text":"first"}`)},
+			{Message: datatypes.JSON(`{"text":"second"}`)},
+			{Message: datatypes.JSON(`{"text":"third"}`)},
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, store.Reorder(ctx, quote.ID, []int{3, 1, 2}))
+
+	reordered, err := store.GetByID(ctx, quote.ID)
+	require.NoError(t, err)
+	var texts []string
+	for _, entry := range reordered.Entries {
+		var msg struct {
+			Text string `json:"text"`
+		}
+		require.NoError(t, json.Unmarshal(entry.Message, &msg))
+		texts = append(texts, msg.Text)
+	}
+	assert.Equal(t, []string{"third", "first", "second"}, texts)
+
+	// An invalid order leaves the quote untouched
+	assert.Error(t, store.Reorder(ctx, quote.ID, []int{1, 1, 2}))
+	unchanged, err := store.GetByID(ctx, quote.ID)
+	require.NoError(t, err)
+	assert.Equal(t, reordered.Entries[0].ID, unchanged.Entries[0].ID)
+}
@@ -4,29 +4,46 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strings"
+	"unicode"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/settings"
 	"gorm.io/gorm"
 )
 
 // RQuoteHandler handles the /rquote command
 // This ports the Quotes.RQuote functionality from Elixir
 type RQuoteHandler struct {
-	db       *gorm.DB
-	store    *Store
-	renderer *Renderer
+	store  *Store
+	poster *quotePoster
+	outbox *outbox.Outbox
 }
 
 // NewRQuoteHandler creates a new rquote handler
 func NewRQuoteHandler(db *gorm.DB) *RQuoteHandler {
+	poster := newQuotePoster(db)
+	poster.ratings = NewRatings(db)
 	return &RQuoteHandler{
-		db:       db,
-		store:    NewStore(db),
-		renderer: NewRenderer(),
+		store:  NewStore(db),
+		poster: poster,
+		outbox: outbox.New(db),
 	}
 }
 
+// WithCustomEmoji shows custom emoji in posted quotes instead of their
+// fallback emoji. The bot needs premium sticker access to send them.
+func (h *RQuoteHandler) WithCustomEmoji(enabled bool) *RQuoteHandler {
+	h.poster.customEmoji = enabled
+	return h
+}
+
+// rquoteUsage explains the arguments of /rquote
+const rquoteUsage = "Usage: /rquote [media] [-#tag] [-@user], e.g. /rquote -#nsfw -@bob leaves out quotes tagged #nsfw or with messages of @bob, and /rquote media only draws quotes with photos, videos or other files"
+
 // Handle processes the /rquote command
 // This signature matches go-telegram/bot handler func
 func (h *RQuoteHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
@@ -38,6 +55,17 @@ func (h *RQuoteHandler) Handle(ctx context.Context, b *bot.Bot, update *models.U
 	chatID := msg.Chat.ID
 	slog.Info("executing /rquote command", "chat_id", chatID, "user_id", msg.From.ID)
 
+	// Tags and authors can be left out of the draw
+	args, _ := botcmd.ParseArgs(msg.Text)
+	exclusions, rest := args.Exclusions()
+	mediaOnly := len(rest) == 1 && strings.EqualFold(rest[0], "media")
+	if mediaOnly {
+		rest = nil
+	}
+	if len(rest) > 0 || !validTags(exclusions.Tags) {
+		return sendNotice(ctx, h.outbox, b, chatID, rquoteUsage)
+	}
+
 	// Check if there are any quotes for this chat
 	count, err := h.store.CountForChat(ctx, chatID)
 	if err != nil {
@@ -45,41 +73,152 @@ func (h *RQuoteHandler) Handle(ctx context.Context, b *bot.Bot, update *models.U
 	}
 
 	if count == 0 {
-		_, err := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: chatID,
-			Text:   "No quotes found in this chat. Add some with /addquote!",
-		})
-		return err
+		return sendNotice(ctx, h.outbox, b, chatID, "No quotes found in this chat. Add some with /addquote!")
 	}
 
 	// Get a random quote for this chat
-	quote, err := h.store.GetRandomForChat(ctx, chatID)
+	quote, err := h.store.GetRandomForChatFiltered(ctx, chatID, RandomFilter{
+		ExcludeTags:    exclusions.Tags,
+		ExcludeAuthors: exclusions.Authors,
+		MediaOnly:      mediaOnly,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to get random quote: %w", err)
 	}
 
+	if quote == nil && mediaOnly && exclusions.IsEmpty() {
+		return sendNotice(ctx, h.outbox, b, chatID, "No quotes with photos, videos or other files in this chat.")
+	}
+	if quote == nil && !exclusions.IsEmpty() {
+		return sendNotice(ctx, h.outbox, b, chatID, "Every quote in this chat is left out by those filters.")
+	}
 	if quote == nil {
-		_, err := b.SendMessage(ctx, &bot.SendMessageParams{
-			ChatID: chatID,
-			Text:   "No quotes found in this chat.",
-		})
-		return err
+		return sendNotice(ctx, h.outbox, b, chatID, "No quotes found in this chat.")
 	}
 
-	// Render the quote
-	rendered, err := h.renderer.RenderWithDate(quote)
+	return h.poster.post(ctx, b, msg, quote)
+}
+
+// validTags reports whether every tag is a hashtag: letters, digits and
+// underscores
+func validTags(tags []string) bool {
+	for _, tag := range tags {
+		for _, c := range tag {
+			if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// quotePoster sends quotes to the chat asking for them
+type quotePoster struct {
+	db       *gorm.DB
+	renderer *Renderer
+	settings *settings.Service
+	outbox   *outbox.Outbox
+
+	customEmoji bool     // Post quotes as HTML with their custom emoji
+	ratings     *Ratings // Adds the 👍 and 👎 buttons when set
+}
+
+// newQuotePoster creates a quote poster
+func newQuotePoster(db *gorm.DB) *quotePoster {
+	return &quotePoster{
+		db:       db,
+		renderer: NewRenderer(),
+		settings: settings.NewService(db),
+		outbox:   outbox.New(db),
+	}
+}
+
+// post renders a quote with the chat preferences and sends it in reply to
+// msg with a button to save it, and buttons to rate it when the poster has
+// ratings, remembering which message posted it
+func (p *quotePoster) post(ctx context.Context, b *bot.Bot, msg *models.Message, quote *Quote) error {
+	chatSettings, err := p.settings.Get(ctx, msg.Chat.ID)
 	if err != nil {
-		return fmt.Errorf("failed to render quote: %w", err)
+		return fmt.Errorf("failed to get chat settings: %w", err)
+	}
+	rendered, err := p.renderWith(ctx, msg, quote, chatSettings)
+	if err != nil {
+		return err
 	}
 
-	// Send the quote
-	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: chatID,
-		Text:   rendered,
-	})
+	// Send the quote, remembering which message posted it
+	keyboard := quoteKeyboard(quote, chatSettings.JumpLinks)
+	if p.ratings != nil {
+		rating, err := p.ratings.Tally(ctx, quote.ID)
+		if err != nil {
+			return err
+		}
+		keyboard = withRatingButtons(keyboard, quote.ID, rating)
+	}
+	posted := &outbox.Message{
+		ChatID:   msg.Chat.ID,
+		Text:     rendered,
+		QuoteID:  &quote.ID,
+		Keyboard: keyboard,
+	}
+	if p.customEmoji {
+		posted.ParseMode = models.ParseModeHTML
+	}
+	_, err = p.outbox.Send(ctx, b, posted)
 	return err
 }
 
+// quoteKeyboard is the reply markup of a posted quote: its Save button and,
+// with jump links on, a button opening the original message when it has a
+// link
+func quoteKeyboard(quote *Quote, jumpLinks bool) *models.InlineKeyboardMarkup {
+	keyboard := saveKeyboard(quote.ID)
+	if link := quote.Link(); jumpLinks && link != "" {
+		keyboard.InlineKeyboard[0] = append(keyboard.InlineKeyboard[0], models.InlineKeyboardButton{Text: "🔗 Original", URL: link})
+	}
+	return keyboard
+}
+
+// render renders a quote with its ID and date, following the preferences of
+// the chat of msg
+func (p *quotePoster) render(ctx context.Context, msg *models.Message, quote *Quote) (string, error) {
+	chatSettings, err := p.settings.Get(ctx, msg.Chat.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get chat settings: %w", err)
+	}
+	return p.renderWith(ctx, msg, quote, chatSettings)
+}
+
+// renderWith renders a quote with its ID and date, following the chat
+// settings already read
+func (p *quotePoster) renderWith(ctx context.Context, msg *models.Message, quote *Quote, chatSettings *settings.ChatSettings) (string, error) {
+	authors, err := LoadAuthors(ctx, p.db, msg.Chat.ID)
+	if err != nil {
+		return "", err
+	}
+	rendered, err := p.renderer.RenderDated(RenderOptions{
+		Quote:       quote,
+		IncludeID:   true,
+		LabelBots:   chatSettings.BotMessages == settings.BotsLabel,
+		Authors:     authors,
+		CustomEmoji: p.customEmoji,
+	}, dateFormatFor(chatSettings, msg.From.LanguageCode))
+	if err != nil {
+		return "", fmt.Errorf("failed to render quote: %w", err)
+	}
+	return rendered, nil
+}
+
+// dateFormatFor builds the date format of a chat. The language of the user
+// running the command is used when the chat has no language configured.
+func dateFormatFor(cs *settings.ChatSettings, languageCode string) DateFormat {
+	return DateFormat{
+		Location: cs.Location(languageCode),
+		Layout:   cs.Layout(languageCode),
+		Relative: cs.RelativeDates,
+	}
+}
+
 // Command returns the command name
 func (h *RQuoteHandler) Command() string {
 	return "/rquote"
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/graffic/wanon-go/internal/settings"
 	"github.com/graffic/wanon-go/internal/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -72,7 +73,7 @@ func TestRQuoteHandler_Handle_OneQuote(t *testing.T) {
 	assert.Equal(t, quote.ID, randomQuote.ID)
 
 	// Test rendering
-	rendered, err := handler.renderer.RenderWithDate(randomQuote)
+	rendered, err := handler.poster.renderer.RenderWithDate(randomQuote)
 	require.NoError(t, err)
 	assert.Contains(t, rendered, "Author: This is a quote")
 	assert.Contains(t, rendered, "#1")
@@ -152,3 +153,93 @@ func TestRQuoteHandler_Handle_DifferentChat(t *testing.T) {
 	require.NoError(t, err)
 	assert.Nil(t, randomQuote)
 }
+
+func TestDateFormatFor(t *testing.T) {
+	format := dateFormatFor(&settings.ChatSettings{DateFormat: "eu", RelativeDates: true}, "")
+	assert.Equal(t, "UTC", format.Location.String())
+	assert.Equal(t, "02/01/2006 15:04", format.Layout)
+	assert.True(t, format.Relative)
+
+	format = dateFormatFor(&settings.ChatSettings{}, "")
+	assert.Equal(t, DefaultDateLayout, format.Layout)
+	assert.False(t, format.Relative)
+}
+
+func TestValidTags(t *testing.T) {
+	assert.True(t, validTags([]string{"nsfw", "año_2024", "42"}))
+	assert.True(t, validTags(nil))
+	assert.False(t, validTags([]string{"ok", "not,ok"}))
+	assert.False(t, validTags([]string{"two words"}))
+}
+
+func TestRQuoteHandler_Handle_Exclusions(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	h.Register(NewRQuoteHandler(h.DB.DB))
+
+	_, err := NewStore(h.DB.DB).Store(context.Background(), StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"#nsfw joke","from":{"first_name":"Bob","username":"bob"}}`)}},
+	})
+	require.NoError(t, err)
+
+	h.SendText(-100123, "/rquote -#nsfw")
+	assert.Equal(t, "Every quote in this chat is left out by those filters.", h.LastReply())
+
+	h.SendText(-100123, "/rquote nsfw")
+	assert.Equal(t, rquoteUsage, h.LastReply())
+
+	h.SendText(-100123, "/rquote -#work -@alice")
+	assert.Contains(t, h.LastReply(), "Bob: #nsfw joke")
+}
+
+func TestRQuoteHandler_Handle_Media(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	h.Register(NewRQuoteHandler(h.DB.DB))
+
+	store := NewStore(h.DB.DB)
+	_, err := store.Store(context.Background(), StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"no pictures","from":{"first_name":"Bob"}}`)}},
+	})
+	require.NoError(t, err)
+
+	h.SendText(-100123, "/rquote media")
+	assert.Equal(t, "No quotes with photos, videos or other files in this chat.", h.LastReply())
+
+	_, err = store.Store(context.Background(), StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"caption":"my cat","media":{"type":"photo","file_id":"AgAD"},"from":{"first_name":"Ana"}}`)}},
+	})
+	require.NoError(t, err)
+
+	h.SendText(-100123, "/rquote media")
+	assert.Contains(t, h.LastReply(), "Ana: my cat")
+}
+
+func TestRQuoteHandler_Handle_JumpLinks(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	h.Register(NewRQuoteHandler(h.DB.DB))
+	ctx := context.Background()
+
+	_, err := NewStore(h.DB.DB).Store(ctx, StoreOptions{
+		ChatID:  -1001234567890,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"message_id":42,"chat":{"id":-1001234567890,"type":"supergroup"},"text":"hi","from":{"first_name":"Bob"}}`)}},
+	})
+	require.NoError(t, err)
+
+	h.SendText(-1001234567890, "/rquote")
+	assert.NotContains(t, h.Requests("sendMessage")[0].Params["reply_markup"], "t.me")
+
+	service := settings.NewService(h.DB.DB)
+	cs, err := service.Get(ctx, -1001234567890)
+	require.NoError(t, err)
+	cs.JumpLinks = true
+	require.NoError(t, service.Save(ctx, cs))
+
+	h.SendText(-1001234567890, "/rquote")
+	assert.Contains(t, h.Requests("sendMessage")[1].Params["reply_markup"], `"url":"https://t.me/c/1234567890/42"`)
+}
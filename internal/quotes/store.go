@@ -4,19 +4,53 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/storage"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Store handles persistence of quotes to the database
 type Store struct {
-	db *gorm.DB
+	db       *gorm.DB
+	random   clock.Random
+	creators CreatorPolicy
+	events   events.Publisher
+
+	unit    *storage.Unit   // Unit the store writes through, if any
+	pending *[]events.Event // Events of the transaction the store writes in, if any
 }
 
 // NewStore creates a new quote store
 func NewStore(db *gorm.DB) *Store {
-	return &Store{db: db}
+	return &Store{db: db, random: clock.SystemRandom{}}
+}
+
+// WithRandom replaces the randomness source used to pick random quotes
+func (s *Store) WithRandom(random clock.Random) *Store {
+	s.random = random
+	return s
+}
+
+// WithCreatorPolicy reduces the creator stored with new quotes to what the
+// policy keeps
+func (s *Store) WithCreatorPolicy(policy CreatorPolicy) *Store {
+	s.creators = policy
+	return s
+}
+
+// WithEvents publishes the quotes added, changed and deleted through the
+// store
+func (s *Store) WithEvents(publisher events.Publisher) *Store {
+	s.events = publisher
+	return s
 }
 
 // StoreOptions contains options for storing a quote
@@ -24,6 +58,60 @@ type StoreOptions struct {
 	Creator map[string]interface{} // Telegram User who created the quote
 	ChatID  int64
 	Entries []CacheEntry // Cache entries to store as quote entries
+	// CreatedAt backdates the quote, e.g. for imports. Zero means now.
+	CreatedAt time.Time
+}
+
+// Transaction runs fn with a store whose writes are committed together,
+// or rolled back if fn returns an error
+func (s *Store) Transaction(ctx context.Context, fn func(store *Store) error) error {
+	var pending []events.Event
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&Store{db: tx, random: s.random, creators: s.creators, events: s.events, pending: &pending})
+	})
+	if err != nil {
+		return err
+	}
+	for _, event := range pending {
+		s.emit(ctx, event)
+	}
+	return nil
+}
+
+// In returns a store writing through a unit of work, committed along with
+// the unit's other writes
+func (s *Store) In(u *storage.Unit) *Store {
+	return &Store{db: u.DB(), random: s.random, creators: s.creators, events: s.events, unit: u}
+}
+
+// publish sends a domain event about the store's writes once they are
+// committed
+func (s *Store) publish(ctx context.Context, typ events.Type, chatID int64, data any) {
+	if s.events == nil {
+		return
+	}
+	event, err := events.New(ctx, typ, chatID, data)
+	if err != nil {
+		slog.Error("failed to create quote event", "type", typ, "chat_id", chatID, "error", err)
+		return
+	}
+	s.emit(ctx, event)
+}
+
+// emit publishes an event after the transaction or unit the store writes
+// in, or right away
+func (s *Store) emit(ctx context.Context, event events.Event) {
+	switch {
+	case s.pending != nil:
+		*s.pending = append(*s.pending, event)
+	case s.unit != nil:
+		s.unit.AfterCommit(func(ctx context.Context) error {
+			s.events.Publish(ctx, event)
+			return nil
+		})
+	default:
+		s.events.Publish(ctx, event)
+	}
 }
 
 // Store saves a quote with its entries to the database.
@@ -35,7 +123,7 @@ func (s *Store) Store(ctx context.Context, opts StoreOptions) (*Quote, error) {
 	}
 
 	// Convert creator to JSON
-	creatorJSON, err := json.Marshal(opts.Creator)
+	creatorJSON, err := json.Marshal(s.creators.Apply(opts.Creator))
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal creator: %w", err)
 	}
@@ -45,8 +133,11 @@ func (s *Store) Store(ctx context.Context, opts StoreOptions) (*Quote, error) {
 	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Create the quote
 		quote = Quote{
-			Creator: creatorJSON,
-			ChatID:  opts.ChatID,
+			Creator:   creatorJSON,
+			ChatID:    opts.ChatID,
+			CreatedAt: opts.CreatedAt,
+			QuotedAt:  quotedAt(opts),
+			HasMedia:  cacheEntriesHaveMedia(opts.Entries),
 		}
 		if err := tx.Create(&quote).Error; err != nil {
 			return fmt.Errorf("failed to create quote: %w", err)
@@ -78,9 +169,31 @@ func (s *Store) Store(ctx context.Context, opts StoreOptions) (*Quote, error) {
 		return nil, fmt.Errorf("failed to reload quote with entries: %w", err)
 	}
 
+	s.publish(ctx, events.QuoteAdded, quote.ChatID, &quote)
 	return &quote, nil
 }
 
+// cacheEntriesHaveMedia reports whether any cached message carries a file
+func cacheEntriesHaveMedia(entries []CacheEntry) bool {
+	messages := make([]datatypes.JSON, len(entries))
+	for i, entry := range entries {
+		messages[i] = entry.Message
+	}
+	return entriesHaveMedia(messages...)
+}
+
+// quotedAt returns when the conversation of a new quote happened: the date
+// of its first entry, or else the time it is added
+func quotedAt(opts StoreOptions) *time.Time {
+	at := opts.CreatedAt
+	if date := opts.Entries[0].Date; date > 0 {
+		at = time.Unix(date, 0)
+	} else if at.IsZero() {
+		at = time.Now()
+	}
+	return &at
+}
+
 // StoreFromBuild stores a quote from a build result
 func (s *Store) StoreFromBuild(ctx context.Context, creator map[string]interface{}, result *BuildResult) (*Quote, error) {
 	return s.Store(ctx, StoreOptions{
@@ -90,6 +203,59 @@ func (s *Store) StoreFromBuild(ctx context.Context, creator map[string]interface
 	})
 }
 
+// Append adds entries after the last entry of a quote of a chat and returns
+// the quote with all its entries. It fails with gorm.ErrRecordNotFound if
+// the chat has no such quote.
+func (s *Store) Append(ctx context.Context, chatID int64, quoteID uint, entries []CacheEntry) (*Quote, error) {
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("cannot append no entries")
+	}
+	err := s.Transaction(ctx, func(store *Store) error {
+		var quote Quote
+		if err := store.db.WithContext(ctx).
+			Where("chat_id = ?", chatID).
+			First(&quote, quoteID).Error; err != nil {
+			return fmt.Errorf("failed to get quote: %w", err)
+		}
+		if err := store.saveVersion(ctx, quoteID, VersionAppend); err != nil {
+			return err
+		}
+		var last int
+		if err := store.db.WithContext(ctx).
+			Model(&QuoteEntry{}).
+			Where("quote_id = ?", quoteID).
+			Select(`COALESCE(MAX("order"), -1)`).
+			Scan(&last).Error; err != nil {
+			return fmt.Errorf("failed to get last quote entry: %w", err)
+		}
+		for i, entry := range entries {
+			quoteEntry := QuoteEntry{
+				Order:   last + 1 + i,
+				Message: entry.Message,
+				QuoteID: quoteID,
+			}
+			if err := store.db.WithContext(ctx).Create(&quoteEntry).Error; err != nil {
+				return fmt.Errorf("failed to append quote entry at order %d: %w", quoteEntry.Order, err)
+			}
+		}
+		if !quote.HasMedia && cacheEntriesHaveMedia(entries) {
+			if err := store.db.WithContext(ctx).Model(&quote).Update("has_media", true).Error; err != nil {
+				return fmt.Errorf("failed to mark quote media: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	quote, err := s.GetByID(ctx, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	s.publish(ctx, events.QuoteChanged, chatID, quote)
+	return quote, nil
+}
+
 // GetByID retrieves a quote by its ID, including all entries
 func (s *Store) GetByID(ctx context.Context, id uint) (*Quote, error) {
 	var quote Quote
@@ -103,14 +269,161 @@ func (s *Store) GetByID(ctx context.Context, id uint) (*Quote, error) {
 	return &quote, nil
 }
 
-// GetRandomForChat retrieves a random quote for a specific chat
+// GetRandomForChat retrieves a random quote for a specific chat.
+// The quote is picked by the store randomness source so selection can be
+// seeded in tests.
 func (s *Store) GetRandomForChat(ctx context.Context, chatID int64) (*Quote, error) {
-	var quote Quote
+	return s.getRandom(ctx, "chat_id = ?", chatID)
+}
 
-	// Use random ordering - PostgreSQL specific
-	err := s.db.WithContext(ctx).
+// GetRandomForChatExcluding retrieves a random quote of a chat leaving out
+// those with an entry tagged with one of tags (hashtags without the #) or
+// sent by one of authors (usernames without the @). Both match ignoring case.
+func (s *Store) GetRandomForChatExcluding(ctx context.Context, chatID int64, tags, authors []string) (*Quote, error) {
+	return s.GetRandomForChatFiltered(ctx, chatID, RandomFilter{ExcludeTags: tags, ExcludeAuthors: authors})
+}
+
+// RandomFilter narrows the quotes a random quote is drawn from
+type RandomFilter struct {
+	ExcludeTags    []string // Hashtags without the #
+	ExcludeAuthors []string // Usernames without the @
+	MediaOnly      bool     // Only quotes with a photo, video or other file
+}
+
+// GetRandomForChatFiltered retrieves a random quote of a chat among those
+// the filter lets through, like GetRandomForChatExcluding
+func (s *Store) GetRandomForChatFiltered(ctx context.Context, chatID int64, filter RandomFilter) (*Quote, error) {
+	condition := "chat_id = ?"
+	args := []interface{}{chatID}
+	tags, authors := filter.ExcludeTags, filter.ExcludeAuthors
+	if filter.MediaOnly {
+		// Matches the idx_quote_media partial index
+		condition += " AND has_media"
+	}
+	if len(tags) > 0 {
+		// Matches the idx_quote_entry_tags expression index. Hashtags are
+		// word characters only, so the comma cannot split one.
+		lowered := make([]string, len(tags))
+		for i, tag := range tags {
+			lowered[i] = strings.ToLower(tag)
+		}
+		condition += ` AND NOT EXISTS (
+			SELECT 1 FROM quote_entry e
+			WHERE e.quote_id = quote.id AND e.deleted_at IS NULL
+			AND quote_entry_tags(e.message) && string_to_array(?, ',')
+		)`
+		args = append(args, strings.Join(lowered, ","))
+	}
+	if len(authors) > 0 {
+		// Matches the idx_quote_entry_author_username expression index
+		lowered := make([]string, len(authors))
+		for i, author := range authors {
+			lowered[i] = strings.ToLower(author)
+		}
+		condition += ` AND NOT EXISTS (
+			SELECT 1 FROM quote_entry e
+			WHERE e.quote_id = quote.id AND e.deleted_at IS NULL
+			AND lower(e.message->'from'->>'username') IN ?
+		)`
+		args = append(args, lowered)
+	}
+	return s.getRandom(ctx, condition, args...)
+}
+
+// searchVector is the full-text document of a quote entry. It has to match
+// the expression of idx_quote_entry_search to use the index.
+const searchVector = `to_tsvector('simple', COALESCE(e.message->>'text', e.message->>'caption', ''))`
+
+// searchCondition matches the quotes of a chat with a message containing
+// every word of a query
+const searchCondition = `chat_id = ? AND EXISTS (
+	SELECT 1 FROM quote_entry e
+	WHERE e.quote_id = quote.id AND e.deleted_at IS NULL
+	AND ` + searchVector + ` @@ plainto_tsquery('simple', ?)
+)`
+
+// SearchForChat retrieves a random quote of a chat with a message containing
+// every word of query, in any case, or nil if none has
+func (s *Store) SearchForChat(ctx context.Context, chatID int64, query string) (*Quote, error) {
+	return s.getRandom(ctx, searchCondition, chatID, query)
+}
+
+// FindForChat returns the newest quotes of a chat with a message containing
+// every word of query, at most limit of them, and how many there are
+func (s *Store) FindForChat(ctx context.Context, chatID int64, query string, limit int) ([]Quote, int64, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).
+		Model(&Quote{}).
+		Where(searchCondition, chatID, query).
+		Count(&count).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count matching quotes: %w", err)
+	}
+	if count == 0 {
+		return nil, 0, nil
+	}
+
+	var quotes []Quote
+	if err := s.db.WithContext(ctx).
+		Where(searchCondition, chatID, query).
+		Order("id DESC").
+		Limit(limit).
+		Preload("Entries", func(db *gorm.DB) *gorm.DB {
+			return db.Order("quote_entry.order ASC")
+		}).
+		Find(&quotes).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to find quotes: %w", err)
+	}
+	return quotes, count, nil
+}
+
+// ListForChat returns up to limit quotes of a chat, newest first, skipping
+// the offset newest ones, with the number of quotes in the chat
+func (s *Store) ListForChat(ctx context.Context, chatID int64, offset, limit int) ([]Quote, int64, error) {
+	count, err := s.CountForChat(ctx, chatID)
+	if err != nil || count == 0 {
+		return nil, 0, err
+	}
+
+	var quotes []Quote
+	if err := s.db.WithContext(ctx).
 		Where("chat_id = ?", chatID).
-		Order("RANDOM()").
+		Order("id DESC").
+		Offset(offset).
+		Limit(limit).
+		Preload("Entries", func(db *gorm.DB) *gorm.DB {
+			return db.Order("quote_entry.order ASC")
+		}).
+		Find(&quotes).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list quotes: %w", err)
+	}
+	return quotes, count, nil
+}
+
+// GetRandomQuotedBetween retrieves a random quote of a chat whose
+// conversation happened at or after from and before to
+func (s *Store) GetRandomQuotedBetween(ctx context.Context, chatID int64, from, to time.Time) (*Quote, error) {
+	return s.getRandom(ctx, "chat_id = ? AND quoted_at >= ? AND quoted_at < ?", chatID, from, to)
+}
+
+// getRandom retrieves a random quote among those matching the condition,
+// or nil if there are none
+func (s *Store) getRandom(ctx context.Context, condition string, args ...interface{}) (*Quote, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).
+		Model(&Quote{}).
+		Where(condition, args...).
+		Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to count quotes: %w", err)
+	}
+	if count == 0 {
+		return nil, nil // No quotes found
+	}
+
+	var quote Quote
+	err := s.db.WithContext(ctx).
+		Where(condition, args...).
+		Order("id ASC").
+		Offset(int(s.random.Int64N(count))).
 		Preload("Entries", func(db *gorm.DB) *gorm.DB {
 			return db.Order("quote_entry.order ASC")
 		}).
@@ -118,7 +431,7 @@ func (s *Store) GetRandomForChat(ctx context.Context, chatID int64) (*Quote, err
 
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, nil // No quotes found
+			return nil, nil // Deleted between count and fetch
 		}
 		return nil, fmt.Errorf("failed to get random quote: %w", err)
 	}
@@ -126,6 +439,80 @@ func (s *Store) GetRandomForChat(ctx context.Context, chatID int64) (*Quote, err
 	return &quote, nil
 }
 
+// EachForChat calls fn for every quote of a chat, oldest first, loading
+// them in batches so whole archives can be exported without holding them
+// in memory. The quote passed to fn is only valid during the call.
+func (s *Store) EachForChat(ctx context.Context, chatID int64, batchSize int, fn func(*Quote) error) error {
+	return s.each(s.db.WithContext(ctx).Where("chat_id = ?", chatID), batchSize, fn)
+}
+
+// EachForUser calls fn like EachForChat for the quotes of a chat that a
+// user added or appears in
+func (s *Store) EachForUser(ctx context.Context, chatID, userID int64, batchSize int, fn func(*Quote) error) error {
+	query, args := s.userCondition(userID)
+	return s.each(s.db.WithContext(ctx).Where("chat_id = ?", chatID).Where(query, args...), batchSize, fn)
+}
+
+// each calls fn for every quote selected by query, oldest first, in batches.
+// Batches are paged by (created_at, id) rather than FindInBatches' id alone,
+// as imported and restored quotes are backdated out of id order.
+func (s *Store) each(query *gorm.DB, batchSize int, fn func(*Quote) error) error {
+	query = query.Session(&gorm.Session{})
+	var last *Quote
+	for {
+		page := query
+		if last != nil {
+			page = page.Where("(created_at, id) > (?, ?)", last.CreatedAt, last.ID)
+		}
+		var batch []Quote
+		if err := page.
+			Order("created_at ASC, id ASC").
+			Limit(batchSize).
+			Preload("Entries", func(db *gorm.DB) *gorm.DB {
+				return db.Order("quote_entry.order ASC")
+			}).
+			Find(&batch).Error; err != nil {
+			return fmt.Errorf("failed to list quotes: %w", err)
+		}
+
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		last = &Quote{ID: batch[len(batch)-1].ID, CreatedAt: batch[len(batch)-1].CreatedAt}
+	}
+}
+
+// UserChats returns the chats with quotes a user added or appears in
+func (s *Store) UserChats(ctx context.Context, userID int64) ([]int64, error) {
+	query, args := s.userCondition(userID)
+	var chatIDs []int64
+	if err := s.db.WithContext(ctx).
+		Model(&Quote{}).
+		Where(query, args...).
+		Distinct().
+		Order("chat_id").
+		Pluck("chat_id", &chatIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list chats of user: %w", err)
+	}
+	return chatIDs, nil
+}
+
+// userCondition selects the quotes a user added or appears in. Creators
+// kept only as a hash match when the store hashes with the same key.
+func (s *Store) userCondition(userID int64) (string, []interface{}) {
+	id := strconv.FormatInt(userID, 10)
+	return `(creator->>'id' = ? OR creator->>'id_hash' = ? OR EXISTS (
+		SELECT 1 FROM quote_entry e
+		WHERE e.quote_id = quote.id AND e.deleted_at IS NULL
+		AND (e.message->'from'->>'id')::bigint = ?
+	))`, []interface{}{id, s.creators.hashID(id), userID}
+}
+
 // CountForChat returns the number of quotes in a chat
 func (s *Store) CountForChat(ctx context.Context, chatID int64) (int64, error) {
 	var count int64
@@ -140,12 +527,86 @@ func (s *Store) CountForChat(ctx context.Context, chatID int64) (int64, error) {
 
 // Delete deletes a quote and its entries (cascade delete handled by GORM constraint)
 func (s *Store) Delete(ctx context.Context, id uint) error {
-	if err := s.db.WithContext(ctx).Delete(&Quote{}, id).Error; err != nil {
-		return fmt.Errorf("failed to delete quote: %w", err)
+	var quote Quote
+	result := s.db.WithContext(ctx).Clauses(clause.Returning{Columns: []clause.Column{{Name: "chat_id"}}}).Delete(&quote, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete quote: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		s.publish(ctx, events.QuoteDeleted, quote.ChatID, events.QuoteRef{QuoteID: id})
 	}
 	return nil
 }
 
+// BulkDeleteFilter selects the quotes of a chat removed by BulkDelete.
+// Zero fields are ignored; an author matches if any entry was sent by them
+// or by a user merged with them.
+type BulkDeleteFilter struct {
+	ChatID         int64
+	AuthorID       int64     // Telegram user ID of an entry author
+	AuthorUsername string    // Telegram username of an entry author, without @
+	Before         time.Time // Quotes created before this time
+	After          time.Time // Quotes created at or after this time
+}
+
+// IsEmpty reports whether the filter would select every quote of the chat
+func (f BulkDeleteFilter) IsEmpty() bool {
+	return f.AuthorID == 0 && f.AuthorUsername == "" && f.Before.IsZero() && f.After.IsZero()
+}
+
+// BulkDelete deletes the quotes matching the filter and returns how many
+// were affected. With dryRun the matching quotes are only counted.
+func (s *Store) BulkDelete(ctx context.Context, filter BulkDeleteFilter, dryRun bool) (int64, error) {
+	if filter.IsEmpty() {
+		return 0, fmt.Errorf("refusing to bulk delete without filters")
+	}
+
+	query := s.db.WithContext(ctx).
+		Model(&Quote{}).
+		Where("chat_id = ?", filter.ChatID)
+
+	if filter.AuthorID != 0 || filter.AuthorUsername != "" {
+		// Merged authors count as the same person
+		authorIDs := []int64{filter.AuthorID}
+		if filter.AuthorID != 0 {
+			var err error
+			if authorIDs, err = authorIdentities(ctx, s.db, filter.ChatID, filter.AuthorID); err != nil {
+				return 0, err
+			}
+		}
+		query = query.Where(`EXISTS (
+			SELECT 1 FROM quote_entry e
+			WHERE e.quote_id = quote.id AND e.deleted_at IS NULL
+			AND ((e.message->'from'->>'id')::bigint IN ? OR lower(e.message->'from'->>'username') = lower(?))
+		)`, authorIDs, filter.AuthorUsername)
+	}
+	if !filter.Before.IsZero() {
+		query = query.Where("created_at < ?", filter.Before)
+	}
+	if !filter.After.IsZero() {
+		query = query.Where("created_at >= ?", filter.After)
+	}
+
+	if dryRun {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return 0, fmt.Errorf("failed to count quotes: %w", err)
+		}
+		return count, nil
+	}
+
+	// Entries are removed by the ON DELETE CASCADE constraint
+	var deleted []Quote
+	result := query.Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).Delete(&deleted)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to bulk delete quotes: %w", result.Error)
+	}
+	for _, quote := range deleted {
+		s.publish(ctx, events.QuoteDeleted, filter.ChatID, events.QuoteRef{QuoteID: quote.ID})
+	}
+	return result.RowsAffected, nil
+}
+
 // Helper function to convert map to datatypes.JSON
 func MapToJSON(m map[string]interface{}) (datatypes.JSON, error) {
 	data, err := json.Marshal(m)
@@ -3,13 +3,17 @@ package quotes
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/graffic/wanon-go/internal/events"
 	"github.com/graffic/wanon-go/internal/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 func TestStore_StoresQuoteWithEntries(t *testing.T) {
@@ -180,6 +184,37 @@ func TestStore_GetRandomForChat(t *testing.T) {
 	assert.Equal(t, int64(-100123), retrieved.ChatID)
 }
 
+// fixedRandom always picks the same index
+type fixedRandom int64
+
+func (f fixedRandom) Int64N(n int64) int64 {
+	return int64(f) % n
+}
+
+func TestStore_GetRandomForChat_UsesRandomSource(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+
+	creator := map[string]interface{}{"id": 123, "first_name": "Test"}
+	var stored []*Quote
+	for _, text := range []string{"first", "second", "third"} {
+		quote, err := store.Store(context.Background(), StoreOptions{
+			ChatID:  -100123,
+			Creator: creator,
+			Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"` + text + `"}`)}},
+		})
+		require.NoError(t, err)
+		stored = append(stored, quote)
+	}
+
+	for i, quote := range stored {
+		retrieved, err := store.WithRandom(fixedRandom(i)).GetRandomForChat(context.Background(), -100123)
+		require.NoError(t, err)
+		require.NotNil(t, retrieved)
+		assert.Equal(t, quote.ID, retrieved.ID)
+	}
+}
+
 func TestStore_GetRandomForChat_NoQuotes(t *testing.T) {
 	db := testutils.NewTestDB(t)
 	store := NewStore(db.DB)
@@ -190,6 +225,76 @@ func TestStore_GetRandomForChat_NoQuotes(t *testing.T) {
 	assert.Nil(t, retrieved)
 }
 
+func TestStore_GetRandomForChatExcluding(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+
+	creator := map[string]interface{}{"id": 123, "first_name": "Test"}
+	ids := map[string]uint{}
+	for name, message := range map[string]string{
+		"tagged":  `{"text":"too much #NSFW here","from":{"id":1,"username":"alice"}}`,
+		"caption": `{"caption":"#work photo","from":{"id":1,"username":"alice"}}`,
+		"bob":     `{"text":"hello #fun","from":{"id":2,"username":"Bob"}}`,
+		"clean":   `{"text":"nothing to hide","from":{"id":1,"username":"alice"}}`,
+	} {
+		quote, err := store.Store(context.Background(), StoreOptions{
+			ChatID:  -100123,
+			Creator: creator,
+			Entries: []CacheEntry{{Message: datatypes.JSON(message)}},
+		})
+		require.NoError(t, err)
+		ids[name] = quote.ID
+	}
+
+	// Whatever the draw, only the quote left after the exclusions comes up
+	for i := range 4 {
+		retrieved, err := store.WithRandom(fixedRandom(i)).GetRandomForChatExcluding(context.Background(), -100123,
+			[]string{"nsfw", "Work"}, []string{"bob"})
+		require.NoError(t, err)
+		require.NotNil(t, retrieved)
+		assert.Equal(t, ids["clean"], retrieved.ID)
+	}
+
+	retrieved, err := store.GetRandomForChatExcluding(context.Background(), -100123, nil, []string{"alice", "BOB"})
+	require.NoError(t, err)
+	assert.Nil(t, retrieved, "every quote is excluded")
+}
+
+func TestStore_GetRandomForChatFiltered_MediaOnly(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ctx := context.Background()
+
+	creator := map[string]interface{}{"id": 123, "first_name": "Test"}
+	ids := map[string]uint{}
+	for name, message := range map[string]string{
+		"photo":   `{"media":{"type":"photo","file_id":"AgAD"},"from":{"id":1}}`,
+		"caption": `{"caption":"cached before media was kept","from":{"id":1}}`,
+		"text":    `{"text":"just words","from":{"id":1}}`,
+	} {
+		quote, err := store.Store(ctx, StoreOptions{
+			ChatID:  -100123,
+			Creator: creator,
+			Entries: []CacheEntry{{Message: datatypes.JSON(message)}},
+		})
+		require.NoError(t, err)
+		ids[name] = quote.ID
+		assert.Equal(t, name != "text", quote.HasMedia, name)
+	}
+
+	for i := range 3 {
+		retrieved, err := store.WithRandom(fixedRandom(i)).GetRandomForChatFiltered(ctx, -100123, RandomFilter{MediaOnly: true})
+		require.NoError(t, err)
+		require.NotNil(t, retrieved)
+		assert.NotEqual(t, ids["text"], retrieved.ID)
+	}
+
+	// Appending a photo marks the quote
+	quote, err := store.Append(ctx, -100123, ids["text"], []CacheEntry{{Message: datatypes.JSON(`{"media":{"type":"sticker","file_id":"CAAD"}}`)}})
+	require.NoError(t, err)
+	assert.True(t, quote.HasMedia)
+}
+
 func TestStore_CountForChat(t *testing.T) {
 	db := testutils.NewTestDB(t)
 	store := NewStore(db.DB)
@@ -265,3 +370,234 @@ func TestStore_StoreFromBuild(t *testing.T) {
 	assert.Equal(t, int64(-100123), quote.ChatID)
 	assert.Len(t, quote.Entries, 1)
 }
+
+func TestStore_BulkDelete(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ctx := context.Background()
+
+	creator := map[string]interface{}{"id": 1, "first_name": "Creator"}
+	add := func(chatID int64, message string) *Quote {
+		quote, err := store.Store(ctx, StoreOptions{
+			ChatID:  chatID,
+			Creator: creator,
+			Entries: []CacheEntry{{Message: datatypes.JSON(message)}},
+		})
+		require.NoError(t, err)
+		return quote
+	}
+
+	bob := `{"text":"hi","from":{"id":42,"first_name":"Bob","username":"Bob"}}`
+	alice := `{"text":"hey","from":{"id":7,"first_name":"Alice"}}`
+	add(-100123, bob)
+	add(-100123, bob)
+	oldAlice := add(-100123, alice)
+	add(-100999, bob) // Other chat, never touched
+
+	db.DB.Model(&Quote{}).Where("id = ?", oldAlice.ID).Update("created_at", time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC))
+
+	// Dry run only counts
+	count, err := store.BulkDelete(ctx, BulkDeleteFilter{ChatID: -100123, AuthorUsername: "bob"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	total, _ := store.CountForChat(ctx, -100123)
+	assert.Equal(t, int64(3), total)
+
+	// Delete by author id
+	deleted, err := store.BulkDelete(ctx, BulkDeleteFilter{ChatID: -100123, AuthorID: 42}, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	// Delete by date
+	deleted, err = store.BulkDelete(ctx, BulkDeleteFilter{ChatID: -100123, Before: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	total, _ = store.CountForChat(ctx, -100123)
+	assert.Equal(t, int64(0), total)
+	total, _ = store.CountForChat(ctx, -100999)
+	assert.Equal(t, int64(1), total)
+
+	// Entries went with their quotes
+	var entries int64
+	db.DB.Model(&QuoteEntry{}).Count(&entries)
+	assert.Equal(t, int64(1), entries)
+}
+
+func TestStore_BulkDelete_RequiresFilter(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+
+	_, err := store.BulkDelete(context.Background(), BulkDeleteFilter{ChatID: -100123}, false)
+	assert.Error(t, err)
+}
+
+func TestStore_EachForChat(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ctx := context.Background()
+
+	creator := map[string]interface{}{"id": 123, "first_name": "Test"}
+	for _, text := range []string{"one", "two", "three"} {
+		_, err := store.Store(ctx, StoreOptions{
+			ChatID:  -100123,
+			Creator: creator,
+			Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"` + text + `"}`)}, {Message: datatypes.JSON(`{"text":"reply"}`)}},
+		})
+		require.NoError(t, err)
+	}
+	_, err := store.Store(ctx, StoreOptions{
+		ChatID:  -100999,
+		Creator: creator,
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"other chat"}`)}},
+	})
+	require.NoError(t, err)
+
+	var visited []Quote
+	err = store.EachForChat(ctx, -100123, 2, func(q *Quote) error {
+		visited = append(visited, *q)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, visited, 3)
+	for i, quote := range visited {
+		assert.Equal(t, int64(-100123), quote.ChatID)
+		require.Len(t, quote.Entries, 2)
+		assert.Equal(t, 0, quote.Entries[0].Order)
+		if i > 0 {
+			assert.Less(t, visited[i-1].ID, quote.ID)
+		}
+	}
+
+	// Errors from the callback stop the iteration
+	stop := errors.New("stop")
+	calls := 0
+	err = store.EachForChat(ctx, -100123, 2, func(q *Quote) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+func TestStore_EachForChat_Backdated(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ctx := context.Background()
+
+	// Imported quotes get higher IDs than the newer quotes stored before them
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, day := range []int{5, 6, 7, 1, 2, 3, 4} {
+		_, err := store.Store(ctx, StoreOptions{
+			ChatID:    -100123,
+			Creator:   map[string]interface{}{"id": 123},
+			Entries:   []CacheEntry{{Message: datatypes.JSON(fmt.Sprintf(`{"text":"day %d"}`, day))}},
+			CreatedAt: base.AddDate(0, 0, day),
+		})
+		require.NoError(t, err)
+	}
+
+	var days []string
+	err := store.EachForChat(ctx, -100123, 2, func(q *Quote) error {
+		var msg struct {
+			Text string `json:"text"`
+		}
+		require.NoError(t, json.Unmarshal(q.Entries[0].Message, &msg))
+		days = append(days, msg.Text)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"day 1", "day 2", "day 3", "day 4", "day 5", "day 6", "day 7"}, days)
+}
+
+func TestStore_Append(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	store := NewStore(db.DB)
+	ctx := context.Background()
+
+	quote, err := store.Store(ctx, StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []CacheEntry{
+			{Message: datatypes.JSON(`{"text":"first"}`)},
+			{Message: datatypes.JSON(`{"text":"second"}`)},
+		},
+	})
+	require.NoError(t, err)
+
+	appended, err := store.Append(ctx, -100123, quote.ID, []CacheEntry{
+		{Message: datatypes.JSON(`{"text":"third"}`)},
+	})
+	require.NoError(t, err)
+	require.Len(t, appended.Entries, 3)
+	assert.Equal(t, 2, appended.Entries[2].Order)
+	assert.JSONEq(t, `{"text":"third"}`, string(appended.Entries[2].Message))
+
+	// Quotes of other chats are not found
+	_, err = store.Append(ctx, -100999, quote.ID, []CacheEntry{{Message: datatypes.JSON(`{}`)}})
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+// recordedEvents keeps the events published to it
+type recordedEvents struct {
+	events []events.Event
+}
+
+func (r *recordedEvents) Publish(ctx context.Context, event events.Event) {
+	r.events = append(r.events, event)
+}
+
+func (r *recordedEvents) types() []events.Type {
+	types := make([]events.Type, 0, len(r.events))
+	for _, event := range r.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestStore_PublishesEvents(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	published := &recordedEvents{}
+	store := NewStore(db.DB).WithEvents(published)
+	ctx := events.WithActor(context.Background(), 42)
+
+	quote, err := store.Store(ctx, StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 42},
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"first","from":{"id":7}}`)}},
+	})
+	require.NoError(t, err)
+	_, err = store.Append(ctx, -100123, quote.ID, []CacheEntry{{Message: datatypes.JSON(`{"text":"second"}`)}})
+	require.NoError(t, err)
+	require.NoError(t, store.Reorder(ctx, quote.ID, []int{2, 1}))
+
+	// Rolled back transactions publish nothing
+	err = store.Transaction(ctx, func(tx *Store) error {
+		if _, err := tx.Store(ctx, StoreOptions{ChatID: -100123, Entries: []CacheEntry{{Message: datatypes.JSON(`{}`)}}}); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	require.Error(t, err)
+
+	_, err = store.BulkDelete(ctx, BulkDeleteFilter{ChatID: -100123, AuthorID: 7}, false)
+	require.NoError(t, err)
+
+	assert.Equal(t, []events.Type{events.QuoteAdded, events.QuoteChanged, events.QuoteChanged, events.QuoteDeleted}, published.types())
+	for _, event := range published.events {
+		assert.Equal(t, int64(-100123), event.ChatID)
+		assert.Equal(t, int64(42), event.ActorID)
+	}
+
+	var added Quote
+	require.NoError(t, json.Unmarshal(published.events[0].Data, &added))
+	assert.Equal(t, quote.ID, added.ID)
+	require.Len(t, added.Entries, 1)
+
+	var reordered Quote
+	require.NoError(t, json.Unmarshal(published.events[2].Data, &reordered))
+	require.Len(t, reordered.Entries, 2)
+	assert.JSONEq(t, `{"text":"second"}`, string(reordered.Entries[0].Message))
+
+	assert.JSONEq(t, fmt.Sprintf(`{"quote_id":%d}`, quote.ID), string(published.events[3].Data))
+}
@@ -0,0 +1,286 @@
+package quotes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// What replaced a quote version
+const (
+	VersionAppend  = "append"
+	VersionReorder = "reorder"
+	VersionRestore = "restore"
+)
+
+// QuoteVersion is a previous version of the entries of a quote, saved
+// before they changed. Versions are never updated.
+type QuoteVersion struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	QuoteID   uint           `gorm:"not null" json:"quote_id"`
+	Version   int            `gorm:"not null" json:"version"` // From 1, per quote
+	Reason    string         `gorm:"not null" json:"reason"`  // What replaced it: append, reorder or restore
+	ActorID   int64          `gorm:"not null" json:"actor_id"`
+	Entries   datatypes.JSON `gorm:"type:jsonb;not null" json:"entries"` // The messages of the entries, in order
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// TableName specifies the table name for QuoteVersion
+func (QuoteVersion) TableName() string {
+	return "quote_version"
+}
+
+// Messages returns the messages of the version, in order
+func (v *QuoteVersion) Messages() ([]datatypes.JSON, error) {
+	var messages []datatypes.JSON
+	if err := json.Unmarshal(v.Entries, &messages); err != nil {
+		return nil, fmt.Errorf("invalid entries of quote version %d: %w", v.Version, err)
+	}
+	return messages, nil
+}
+
+// saveVersion saves the current entries of a quote as its next version,
+// before reason changes them. It runs in the transaction of the change,
+// which it serialises with other changes of the quote.
+func (s *Store) saveVersion(ctx context.Context, quoteID uint, reason string) error {
+	db := s.db.WithContext(ctx)
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&Quote{}, quoteID).Error; err != nil {
+		return fmt.Errorf("failed to lock quote: %w", err)
+	}
+	var messages []datatypes.JSON
+	if err := db.Model(&QuoteEntry{}).
+		Where("quote_id = ?", quoteID).
+		Order(`"order" ASC`).
+		Pluck("message", &messages).Error; err != nil {
+		return fmt.Errorf("failed to get quote entries: %w", err)
+	}
+	entries, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	var last int
+	if err := db.Model(&QuoteVersion{}).
+		Where("quote_id = ?", quoteID).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&last).Error; err != nil {
+		return fmt.Errorf("failed to get last quote version: %w", err)
+	}
+	version := QuoteVersion{QuoteID: quoteID, Version: last + 1, Reason: reason, ActorID: events.ActorFrom(ctx), Entries: entries}
+	if err := db.Create(&version).Error; err != nil {
+		return fmt.Errorf("failed to save quote version: %w", err)
+	}
+	return nil
+}
+
+// Versions returns the saved versions of a quote, newest first
+func (s *Store) Versions(ctx context.Context, quoteID uint) ([]QuoteVersion, error) {
+	var versions []QuoteVersion
+	if err := s.db.WithContext(ctx).
+		Where("quote_id = ?", quoteID).
+		Order("version DESC").
+		Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get quote versions: %w", err)
+	}
+	return versions, nil
+}
+
+// RestoreVersion replaces the entries of a quote with those of a saved
+// version, saving the current entries as a new version first. It fails with
+// gorm.ErrRecordNotFound if the quote has no such version.
+func (s *Store) RestoreVersion(ctx context.Context, quoteID uint, version int) (*Quote, error) {
+	err := s.Transaction(ctx, func(store *Store) error {
+		db := store.db.WithContext(ctx)
+		var saved QuoteVersion
+		if err := db.Where("quote_id = ? AND version = ?", quoteID, version).First(&saved).Error; err != nil {
+			return err
+		}
+		messages, err := saved.Messages()
+		if err != nil {
+			return err
+		}
+		if err := store.saveVersion(ctx, quoteID, VersionRestore); err != nil {
+			return err
+		}
+		if err := db.Unscoped().Where("quote_id = ?", quoteID).Delete(&QuoteEntry{}).Error; err != nil {
+			return fmt.Errorf("failed to remove quote entries: %w", err)
+		}
+		for i, msg := range messages {
+			if err := db.Create(&QuoteEntry{Order: i, Message: msg, QuoteID: quoteID}).Error; err != nil {
+				return fmt.Errorf("failed to restore quote entry at order %d: %w", i, err)
+			}
+		}
+		if err := db.Model(&Quote{ID: quoteID}).Update("has_media", entriesHaveMedia(messages...)).Error; err != nil {
+			return fmt.Errorf("failed to mark quote media: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	quote, err := s.GetByID(ctx, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	s.publish(ctx, events.QuoteChanged, quote.ChatID, quote)
+	return quote, nil
+}
+
+// quoteHistoryUsage explains the /quotehistory arguments
+const quoteHistoryUsage = "Usage: /quotehistory <quote id> to list its previous versions, or /quotehistory <quote id> restore <version>"
+
+// quoteHistoryShown is how many versions /quotehistory lists
+const quoteHistoryShown = 10
+
+// quoteHistoryPreview is how many UTF-16 code units of each version are shown
+const quoteHistoryPreview = 80
+
+// QuoteHistoryHandler handles the /quotehistory admin command
+type QuoteHistoryHandler struct {
+	store  *Store
+	outbox *outbox.Outbox
+	admins *telegram.AdminService
+	poster *quotePoster
+}
+
+// NewQuoteHistoryHandler creates a new quotehistory handler
+func NewQuoteHistoryHandler(db *gorm.DB) *QuoteHistoryHandler {
+	return &QuoteHistoryHandler{
+		store:  NewStore(db),
+		outbox: outbox.New(db),
+		poster: newQuotePoster(db),
+	}
+}
+
+// WithEvents publishes the restored quotes
+func (h *QuoteHistoryHandler) WithEvents(publisher events.Publisher) *QuoteHistoryHandler {
+	h.store.WithEvents(publisher)
+	return h
+}
+
+// WithCustomEmoji shows custom emoji in posted quotes instead of their
+// fallback emoji
+func (h *QuoteHistoryHandler) WithCustomEmoji(enabled bool) *QuoteHistoryHandler {
+	h.poster.customEmoji = enabled
+	return h
+}
+
+// WithAdmins checks admins against a shared cache of chat administrators
+func (h *QuoteHistoryHandler) WithAdmins(admins *telegram.AdminService) *QuoteHistoryHandler {
+	h.admins = admins
+	return h
+}
+
+// Handle processes /quotehistory <quote id> [restore <version>]
+func (h *QuoteHistoryHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+
+	admin, err := h.admins.IsSenderAdmin(ctx, b, msg)
+	var refused *telegram.OriginError
+	if errors.As(err, &refused) {
+		return sendNotice(ctx, h.outbox, b, chatID, refused.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return sendNotice(ctx, h.outbox, b, chatID, "Only chat administrators can see and restore previous versions of quotes.")
+	}
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	if args.Len() != 1 && (args.Len() != 3 || strings.ToLower(args.Arg(1)) != "restore") {
+		return sendNotice(ctx, h.outbox, b, chatID, quoteHistoryUsage)
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(args.Arg(0), "#"), 10, 64)
+	if err != nil {
+		return sendNotice(ctx, h.outbox, b, chatID, quoteHistoryUsage)
+	}
+	quote, err := h.store.GetByID(ctx, uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && quote.ChatID != chatID) {
+		return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("Quote #%d not found in this chat.", id))
+	}
+	if err != nil {
+		return err
+	}
+
+	if args.Len() == 1 {
+		return h.list(ctx, b, msg, quote)
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(args.Arg(2)), "v"))
+	if err != nil {
+		return sendNotice(ctx, h.outbox, b, chatID, quoteHistoryUsage)
+	}
+	restored, err := h.store.RestoreVersion(ctx, quote.ID, version)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return sendNotice(ctx, h.outbox, b, chatID, fmt.Sprintf("Quote #%d has no version %d.", quote.ID, version))
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("quote version restored", "audit", true, "chat_id", chatID, "user_id", msg.From.ID, "quote_id", quote.ID, "version", version)
+	return h.poster.post(ctx, b, msg, restored)
+}
+
+// list replies with the newest versions of a quote
+func (h *QuoteHistoryHandler) list(ctx context.Context, b *bot.Bot, msg *models.Message, quote *Quote) error {
+	versions, err := h.store.Versions(ctx, quote.ID)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		return sendNotice(ctx, h.outbox, b, msg.Chat.ID, fmt.Sprintf("Quote #%d has no previous versions.", quote.ID))
+	}
+	chatSettings, err := h.poster.settings.Get(ctx, msg.Chat.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get chat settings: %w", err)
+	}
+	loc := chatSettings.Location(msg.From.LanguageCode)
+
+	lines := []string{fmt.Sprintf("🕓 Previous versions of quote #%d:", quote.ID)}
+	for _, version := range versions[:min(len(versions), quoteHistoryShown)] {
+		messages, err := version.Messages()
+		if err != nil {
+			return err
+		}
+		old := &Quote{ID: quote.ID, ChatID: quote.ChatID}
+		for i, message := range messages {
+			old.Entries = append(old.Entries, QuoteEntry{Order: i, Message: message})
+		}
+		lines = append(lines, fmt.Sprintf("v%d · %s · before %s · %d message(s)\n%s",
+			version.Version, version.CreatedAt.In(loc).Format("2006-01-02 15:04"), version.Reason, len(messages),
+			quotePreview(h.poster.renderer, old, quoteHistoryPreview)))
+	}
+	if older := len(versions) - quoteHistoryShown; older > 0 {
+		lines = append(lines, fmt.Sprintf("…and %d older version(s).", older))
+	}
+	lines = append(lines, fmt.Sprintf("Restore one with /quotehistory %d restore <version>.", quote.ID))
+	return sendText(ctx, h.outbox, b, msg.Chat.ID, strings.Join(lines, "\n\n"))
+}
+
+// Command returns the command name
+func (h *QuoteHistoryHandler) Command() string {
+	return "/quotehistory"
+}
+
+// Description returns the command description
+func (h *QuoteHistoryHandler) Description() string {
+	return "List or restore previous versions of a quote (admins only)"
+}
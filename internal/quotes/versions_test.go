@@ -0,0 +1,109 @@
+package quotes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func TestQuoteVersion_Messages(t *testing.T) {
+	version := QuoteVersion{Version: 1, Entries: datatypes.JSON(`[{"text":"a"},{"text":"b"}]`)}
+	messages, err := version.Messages()
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.JSONEq(t, `{"text":"b"}`, string(messages[1]))
+
+	_, err = (&QuoteVersion{Version: 2, Entries: datatypes.JSON(`{}`)}).Messages()
+	assert.ErrorContains(t, err, "invalid entries of quote version 2")
+}
+
+func TestStore_Versions(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := events.WithActor(context.Background(), 1001)
+	store := NewStore(db.DB)
+	const chatID = -100123
+
+	quote, err := store.Store(ctx, StoreOptions{
+		ChatID:  chatID,
+		Creator: map[string]interface{}{"id": 1001},
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"one"}`)}, {Message: datatypes.JSON(`{"text":"two"}`)}},
+	})
+	require.NoError(t, err)
+	versions, err := store.Versions(ctx, quote.ID)
+	require.NoError(t, err)
+	assert.Empty(t, versions, "new quotes have no previous versions")
+
+	_, err = store.Append(ctx, chatID, quote.ID, []CacheEntry{{Message: datatypes.JSON(`{"text":"three"}`)}})
+	require.NoError(t, err)
+	require.NoError(t, store.Reorder(ctx, quote.ID, []int{3, 1, 2}))
+
+	versions, err = store.Versions(ctx, quote.ID)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, 2, versions[0].Version)
+	assert.Equal(t, VersionReorder, versions[0].Reason)
+	assert.Equal(t, int64(1001), versions[0].ActorID)
+	assert.JSONEq(t, `[{"text":"one"},{"text":"two"},{"text":"three"}]`, string(versions[0].Entries))
+	assert.Equal(t, VersionAppend, versions[1].Reason)
+	assert.JSONEq(t, `[{"text":"one"},{"text":"two"}]`, string(versions[1].Entries))
+
+	restored, err := store.RestoreVersion(ctx, quote.ID, 1)
+	require.NoError(t, err)
+	require.Len(t, restored.Entries, 2)
+	assert.JSONEq(t, `{"text":"two"}`, string(restored.Entries[1].Message))
+	versions, err = store.Versions(ctx, quote.ID)
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, VersionRestore, versions[0].Reason)
+	assert.JSONEq(t, `[{"text":"three"},{"text":"one"},{"text":"two"}]`, string(versions[0].Entries))
+
+	_, err = store.RestoreVersion(ctx, quote.ID, 9)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	assert.Error(t, db.DB.Model(&QuoteVersion{}).Where("id = ?", versions[0].ID).Update("reason", "edited").Error,
+		"versions are immutable")
+}
+
+func TestQuoteHistoryHandler_Handle(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	ctx := context.Background()
+	const chatID = -100123
+	h.Register(NewQuoteHistoryHandler(h.DB.DB))
+
+	store := NewStore(h.DB.DB)
+	quote, err := store.Store(ctx, StoreOptions{
+		ChatID:  chatID,
+		Creator: map[string]interface{}{"id": h.User.ID},
+		Entries: []CacheEntry{{Message: datatypes.JSON(`{"text":"before","from":{"first_name":"Bob"}}`)}},
+	})
+	require.NoError(t, err)
+	id := fmt.Sprint(quote.ID)
+
+	h.SendText(chatID, "/quotehistory "+id)
+	assert.Equal(t, "Only chat administrators can see and restore previous versions of quotes.", h.LastReply())
+
+	h.SetAdmin(chatID, h.User.ID)
+	h.SendText(chatID, "/quotehistory")
+	assert.Equal(t, quoteHistoryUsage, h.LastReply())
+	h.SendText(chatID, "/quotehistory "+id)
+	assert.Equal(t, "Quote #"+id+" has no previous versions.", h.LastReply())
+
+	_, err = store.Append(ctx, chatID, quote.ID, []CacheEntry{{Message: datatypes.JSON(`{"text":"after","from":{"first_name":"Ana"}}`)}})
+	require.NoError(t, err)
+	h.SendText(chatID, "/quotehistory "+id)
+	assert.Contains(t, h.LastReply(), "🕓 Previous versions of quote #"+id+":\n\nv1 · ")
+	assert.Contains(t, h.LastReply(), " · before append · 1 message(s)\nBob: before\n\nRestore one with /quotehistory "+id+" restore <version>.")
+
+	h.SendText(chatID, "/quotehistory "+id+" restore 5")
+	assert.Equal(t, "Quote #"+id+" has no version 5.", h.LastReply())
+	h.SendText(chatID, "/quotehistory "+id+" restore v1")
+	assert.Contains(t, h.LastReply(), "before")
+	assert.NotContains(t, h.LastReply(), "after")
+}
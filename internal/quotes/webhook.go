@@ -0,0 +1,180 @@
+package quotes
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/events"
+)
+
+// Headers of the requests of QuoteWebhook
+const (
+	WebhookEventHeader     = "X-Wanon-Event"
+	WebhookSignatureHeader = "X-Wanon-Signature" // sha256=<hex HMAC-SHA256 of the body>
+)
+
+// webhookQueue is the number of deliveries waiting for the webhook before
+// new ones are dropped
+const webhookQueue = 100
+
+// WebhookPayload is the body posted to the quote webhook
+type WebhookPayload struct {
+	Event   events.Type  `json:"event"`
+	At      time.Time    `json:"at"`
+	ChatID  int64        `json:"chat_id"`
+	ActorID int64        `json:"actor_id,omitempty"`
+	Quote   WebhookQuote `json:"quote"`
+}
+
+// WebhookQuote is the quote of a webhook payload. Deleted quotes only carry
+// their ID.
+type WebhookQuote struct {
+	ID        uint       `json:"id"`
+	Text      string     `json:"text,omitempty"` // Rendered as /rquote shows it, without HTML
+	Entries   int        `json:"entries,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	QuotedAt  *time.Time `json:"quoted_at,omitempty"`
+}
+
+// QuoteWebhook posts added and deleted quotes to a URL, so automations can
+// follow a chat's quotes without changes to the bot. It subscribes to the
+// domain events and delivers them in order from Start, so a slow endpoint
+// does not hold the commands back.
+type QuoteWebhook struct {
+	url      string
+	secret   []byte
+	client   *http.Client
+	renderer *Renderer
+	logger   *slog.Logger
+	queue    chan delivery
+}
+
+// delivery is a signed request waiting to be posted
+type delivery struct {
+	event events.Type
+	body  []byte
+}
+
+// NewQuoteWebhook creates a webhook posting to url, signing every body with
+// secret
+func NewQuoteWebhook(url, secret string, logger *slog.Logger) (*QuoteWebhook, error) {
+	if url == "" {
+		return nil, fmt.Errorf("quote webhook needs a url")
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("quote webhook needs a secret to sign its requests")
+	}
+	return &QuoteWebhook{
+		url:      url,
+		secret:   []byte(secret),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		renderer: NewRenderer(),
+		logger:   logger,
+		queue:    make(chan delivery, webhookQueue),
+	}, nil
+}
+
+// WithClient replaces the HTTP client posting the quotes
+func (w *QuoteWebhook) WithClient(client *http.Client) *QuoteWebhook {
+	w.client = client
+	return w
+}
+
+// Receive queues added and deleted quotes for delivery, ignoring the other
+// events
+func (w *QuoteWebhook) Receive(ctx context.Context, event events.Event) error {
+	payload, ok, err := w.payload(event)
+	if err != nil || !ok {
+		return err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+	select {
+	case w.queue <- delivery{event: event.Type, body: body}:
+		return nil
+	default:
+		return fmt.Errorf("webhook queue full, dropped %s of quote %d", event.Type, payload.Quote.ID)
+	}
+}
+
+// payload builds the body of an event, false for events the webhook does
+// not post
+func (w *QuoteWebhook) payload(event events.Event) (WebhookPayload, bool, error) {
+	payload := WebhookPayload{Event: event.Type, At: event.At, ChatID: event.ChatID, ActorID: event.ActorID}
+	switch event.Type {
+	case events.QuoteAdded:
+		var quote Quote
+		if err := json.Unmarshal(event.Data, &quote); err != nil {
+			return payload, false, fmt.Errorf("failed to read added quote: %w", err)
+		}
+		text, err := w.renderer.RenderSimple(&quote)
+		if err != nil {
+			return payload, false, fmt.Errorf("failed to render quote %d: %w", quote.ID, err)
+		}
+		createdAt := quote.CreatedAt
+		payload.Quote = WebhookQuote{ID: quote.ID, Text: text, Entries: len(quote.Entries), CreatedAt: &createdAt, QuotedAt: quote.QuotedAt}
+	case events.QuoteDeleted:
+		var ref events.QuoteRef
+		if err := json.Unmarshal(event.Data, &ref); err != nil {
+			return payload, false, fmt.Errorf("failed to read deleted quote: %w", err)
+		}
+		payload.Quote = WebhookQuote{ID: ref.QuoteID}
+	default:
+		return payload, false, nil
+	}
+	return payload, true, nil
+}
+
+// Start posts the queued quotes until ctx is done. Failed deliveries are
+// logged and not retried.
+func (w *QuoteWebhook) Start(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case d := <-w.queue:
+			if err := w.post(ctx, d); err != nil {
+				w.logger.Error("quote webhook failed", "event", d.event, "error", err)
+			}
+		}
+	}
+}
+
+// post sends a delivery, failing on any status but 2xx
+func (w *QuoteWebhook) post(ctx context.Context, d delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(d.event))
+	req.Header.Set(WebhookSignatureHeader, Sign(w.secret, d.body))
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post quote: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the signature header value of a webhook body. Receivers
+// compute it with their copy of the secret and compare it with
+// hmac.Equal.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
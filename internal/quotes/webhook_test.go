@@ -0,0 +1,93 @@
+package quotes
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestNewQuoteWebhook_Validation(t *testing.T) {
+	_, err := NewQuoteWebhook("", "secret", slog.Default())
+	assert.ErrorContains(t, err, "needs a url")
+	_, err = NewQuoteWebhook("https://example.com/hook", "", slog.Default())
+	assert.ErrorContains(t, err, "needs a secret")
+}
+
+func TestQuoteWebhook(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	received := make(chan request, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- request{header: r.Header, body: body}
+	}))
+	defer server.Close()
+
+	hook, err := NewQuoteWebhook(server.URL, "s3cret", slog.Default())
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hook.Start(ctx)
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	quote := &Quote{ID: 7, ChatID: -100123, CreatedAt: at, Entries: []QuoteEntry{
+		{Order: 0, Message: datatypes.JSON(`{"text":"hello","from":{"first_name":"Alice"}}`)},
+		{Order: 1, Message: datatypes.JSON(`{"text":"hi","from":{"first_name":"Bob"}}`)},
+	}}
+	added, err := events.New(events.WithActor(ctx, 42), events.QuoteAdded, -100123, quote)
+	require.NoError(t, err)
+	added.At = at
+	require.NoError(t, hook.Receive(ctx, added))
+
+	// Other events are not posted
+	changed, err := events.New(ctx, events.QuoteChanged, -100123, quote)
+	require.NoError(t, err)
+	require.NoError(t, hook.Receive(ctx, changed))
+
+	deleted, err := events.New(ctx, events.QuoteDeleted, -100123, events.QuoteRef{QuoteID: 7})
+	require.NoError(t, err)
+	require.NoError(t, hook.Receive(ctx, deleted))
+
+	first := <-received
+	assert.Equal(t, "quote_added", first.header.Get(WebhookEventHeader))
+	assert.Equal(t, Sign([]byte("s3cret"), first.body), first.header.Get(WebhookSignatureHeader))
+	var payload WebhookPayload
+	require.NoError(t, json.Unmarshal(first.body, &payload))
+	assert.Equal(t, events.QuoteAdded, payload.Event)
+	assert.Equal(t, int64(-100123), payload.ChatID)
+	assert.Equal(t, int64(42), payload.ActorID)
+	assert.Equal(t, uint(7), payload.Quote.ID)
+	assert.Equal(t, "Alice: hello\nBob: hi", payload.Quote.Text)
+	assert.Equal(t, 2, payload.Quote.Entries)
+
+	second := <-received
+	assert.Equal(t, "quote_deleted", second.header.Get(WebhookEventHeader))
+	assert.JSONEq(t, `{"id":7}`, string(mustField(t, second.body, "quote")))
+	assert.Empty(t, received)
+}
+
+func TestSign(t *testing.T) {
+	// Known HMAC-SHA256 test vector (RFC 4231, test case 2)
+	assert.Equal(t, "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843",
+		Sign([]byte("Jefe"), []byte("what do ya want for nothing?")))
+}
+
+// mustField returns a top level field of a JSON object
+func mustField(t *testing.T, body []byte, name string) json.RawMessage {
+	t.Helper()
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(body, &fields))
+	return fields[name]
+}
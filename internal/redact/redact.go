@@ -0,0 +1,167 @@
+// Package redact masks sensitive data, such as card and phone numbers, in
+// message text before the bot caches or quotes it, so it never lands in the
+// database.
+package redact
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/graffic/wanon-go/internal/message"
+	"github.com/graffic/wanon-go/internal/settings"
+	"github.com/graffic/wanon-go/internal/textutil"
+)
+
+// Mask replaces each letter and digit of a redacted match
+const Mask = '█'
+
+// rule is a pattern whose matches are masked
+type rule struct {
+	pattern *regexp.Regexp
+	valid   func(match string) bool // Nil masks every match
+}
+
+// builtins are the rules enabled by name
+var builtins = map[string]rule{
+	// 13 to 19 digit card numbers, grouped or not, passing the Luhn check
+	"cards": {
+		pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		valid:   luhn,
+	},
+	// International numbers, +34 612 345 678 or 0044 20 7946 0958, and
+	// national ones grouped as 612 345 678 or 555-123-4567
+	"phones": {
+		pattern: regexp.MustCompile(`(?:\+|\b00)[1-9](?:[ .-]?\(?\d\)?){6,14}\b|\b\d{3}[ .-]\d{3}[ .-]\d{3,4}\b`),
+	},
+}
+
+// Rules returns the names of the built-in rules
+func Rules() []string {
+	return []string{"cards", "phones"}
+}
+
+// Redactor masks the matches of its rules in message text and captions
+type Redactor struct {
+	rules    []rule
+	settings *settings.Service
+}
+
+// New creates a redactor with the built-in rules named and custom regular
+// expressions. Without any it redacts nothing.
+func New(names, patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, name := range names {
+		builtin, ok := builtins[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction rule %q, use %s", name, strings.Join(Rules(), " or "))
+		}
+		r.rules = append(r.rules, builtin)
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		r.rules = append(r.rules, rule{pattern: re})
+	}
+	return r, nil
+}
+
+// WithSettings honours the chats that turned redaction off with
+// /settings redact off
+func (r *Redactor) WithSettings(service *settings.Service) *Redactor {
+	r.settings = service
+	return r
+}
+
+// Enabled reports whether the redactor has any rules
+func (r *Redactor) Enabled() bool {
+	return r != nil && len(r.rules) > 0
+}
+
+// Text returns text with the matches of every rule masked, and how many
+// matches were
+func (r *Redactor) Text(text string) (string, int) {
+	masked := 0
+	for _, rl := range r.rules {
+		text = rl.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if rl.valid != nil && !rl.valid(match) {
+				return match
+			}
+			masked++
+			return mask(match)
+		})
+	}
+	return text, masked
+}
+
+// Message masks the text and caption of msg, reporting how many matches
+// were. Masks keep the UTF-16 length of what they replace, so the offsets
+// of the message entities still hold.
+func (r *Redactor) Message(msg *message.Message) int {
+	text, inText := r.Text(msg.Text)
+	caption, inCaption := r.Text(msg.Caption)
+	msg.Text, msg.Caption = text, caption
+	return inText + inCaption
+}
+
+// Apply masks msg unless its chat turned redaction off. A nil or empty
+// redactor leaves every message as is.
+func (r *Redactor) Apply(ctx context.Context, msg *message.Message) error {
+	if !r.Enabled() {
+		return nil
+	}
+	if r.settings != nil {
+		cs, err := r.settings.Get(ctx, msg.Chat.ID)
+		if err != nil {
+			return err
+		}
+		if cs.KeepSensitive {
+			return nil
+		}
+	}
+	r.Message(msg)
+	return nil
+}
+
+// mask replaces the letters and digits of s, keeping spaces and punctuation
+// so the shape of what was redacted shows
+func mask(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+			b.WriteRune(c)
+			continue
+		}
+		// Runes outside the BMP count twice in UTF-16
+		for range textutil.UTF16Len(string(c)) {
+			b.WriteRune(Mask)
+		}
+	}
+	return b.String()
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum of card
+// numbers
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
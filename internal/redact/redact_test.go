@@ -0,0 +1,112 @@
+package redact
+
+import (
+	"context"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/message"
+	"github.com/graffic/wanon-go/internal/textutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor_Cards(t *testing.T) {
+	r, err := New([]string{"cards"}, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", "card 4111111111111111 thanks", "card ████████████████ thanks"},
+		{"grouped", "4111 1111 1111 1111", "████ ████ ████ ████"},
+		{"dashes", "5500-0000-0000-0004!", "████-████-████-████!"},
+		{"fails luhn", "order 4111111111111112", "order 4111111111111112"},
+		{"too short", "ticket 411111111111", "ticket 411111111111"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := r.Text(tt.text)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRedactor_Phones(t *testing.T) {
+	r, err := New([]string{"phones"}, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"international", "call +34 612 345 678", "call +██ ███ ███ ███"},
+		{"double zero", "0044 20 7946 0958 ok", "████ ██ ████ ████ ok"},
+		{"national", "555-123-4567", "███-███-████"},
+		{"spaced", "mi móvil 612 345 678", "mi móvil ███ ███ ███"},
+		{"date", "on 2024-05-10 at 10:30", "on 2024-05-10 at 10:30"},
+		{"count", "we were 120 people", "we were 120 people"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := r.Text(tt.text)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRedactor_Patterns(t *testing.T) {
+	r, err := New(nil, []string{`(?i)password: \S+`})
+	require.NoError(t, err)
+
+	got, n := r.Text("Password: hunter2 and password: ñandú")
+	assert.Equal(t, "████████: ███████ and ████████: █████", got)
+	assert.Equal(t, 2, n)
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := New([]string{"emails"}, nil)
+	assert.ErrorContains(t, err, `unknown redaction rule "emails"`)
+
+	_, err = New(nil, []string{"(unclosed"})
+	assert.ErrorContains(t, err, "invalid redaction pattern")
+}
+
+func TestRedactor_Message(t *testing.T) {
+	r, err := New([]string{"cards"}, []string{`secret\S*`})
+	require.NoError(t, err)
+
+	text := "😀 secret𝐀𝐁 4111111111111111"
+	msg := &message.Message{
+		Chat:     message.Chat{ID: 1},
+		Text:     text,
+		Caption:  "pay to 4111 1111 1111 1111",
+		Entities: []message.Entity{{Type: "custom_emoji", Offset: 0, Length: 2, CustomEmojiID: "1"}},
+	}
+	assert.Equal(t, 3, r.Message(msg))
+	assert.Equal(t, "😀 ██████████ ████████████████", msg.Text, "letters outside the BMP take two masks")
+	assert.Equal(t, "pay to ████ ████ ████ ████", msg.Caption)
+	// Masks keep the UTF-16 length, so entity offsets still hold
+	assert.Equal(t, textutil.UTF16Len(text), textutil.UTF16Len(msg.Text))
+}
+
+func TestRedactor_Apply(t *testing.T) {
+	msg := &message.Message{Chat: message.Chat{ID: 1}, Text: "4111111111111111"}
+
+	var none *Redactor
+	require.NoError(t, none.Apply(context.Background(), msg))
+	assert.Equal(t, "4111111111111111", msg.Text)
+
+	empty, err := New(nil, nil)
+	require.NoError(t, err)
+	assert.False(t, empty.Enabled())
+	require.NoError(t, empty.Apply(context.Background(), msg))
+	assert.Equal(t, "4111111111111111", msg.Text)
+
+	r, err := New([]string{"cards"}, nil)
+	require.NoError(t, err)
+	require.NoError(t, r.Apply(context.Background(), msg))
+	assert.Equal(t, "████████████████", msg.Text)
+}
@@ -0,0 +1,217 @@
+// Package replay rebuilds quotes and chat settings from the domain event
+// log, for disaster recovery and point-in-time restores.
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/settings"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotEmpty is returned when replaying into a database that already has
+// quotes or chat settings
+var ErrNotEmpty = errors.New("the database already has quotes or chat settings, replay needs a fresh one")
+
+// Options configures a replay
+type Options struct {
+	// Until stops at the first event after it, restoring the state at that
+	// time. Zero replays the whole log.
+	Until time.Time
+	// DryRun reads and checks the log without writing anything
+	DryRun bool
+}
+
+// Result is what a replay did
+type Result struct {
+	Applied map[events.Type]int // Events applied by type
+	Ignored int                 // Events that do not change quotes or settings
+	Unknown int                 // Events of types this version does not know
+	Later   int                 // Events after Options.Until, left out
+	Last    time.Time           // Time of the last event applied
+}
+
+// String summarizes the result
+func (r *Result) String() string {
+	types := make([]string, 0, len(r.Applied))
+	for typ, count := range r.Applied {
+		types = append(types, fmt.Sprintf("%s %d", typ, count))
+	}
+	sort.Strings(types)
+	applied := "no events applied"
+	if len(types) > 0 {
+		applied = "applied " + strings.Join(types, ", ")
+	}
+	summary := fmt.Sprintf("%s; %d ignored, %d unknown, %d after the cutoff", applied, r.Ignored, r.Unknown, r.Later)
+	if !r.Last.IsZero() {
+		summary += "; state as of " + r.Last.Format(time.RFC3339)
+	}
+	return summary
+}
+
+// Replay applies an event log to db. Everything is written in one
+// transaction, so a log that fails halfway leaves the database untouched.
+// Quotes keep their IDs, and the ID sequences continue after them.
+func Replay(ctx context.Context, db *gorm.DB, r io.Reader, opts Options) (*Result, error) {
+	result := &Result{Applied: map[events.Type]int{}}
+	if opts.DryRun {
+		err := events.Read(r, func(line int, event events.Event) error {
+			return result.count(event, opts, func() error { return check(event) })
+		})
+		return result, err
+	}
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkEmpty(tx); err != nil {
+			return err
+		}
+		err := events.Read(r, func(line int, event events.Event) error {
+			return result.count(event, opts, func() error { return apply(tx, event) })
+		})
+		if err != nil {
+			return err
+		}
+		return resetSequences(tx)
+	})
+	return result, err
+}
+
+// count runs fn for an event that is not past the cutoff, and records it
+func (r *Result) count(event events.Event, opts Options, fn func() error) error {
+	if !opts.Until.IsZero() && event.At.After(opts.Until) {
+		r.Later++
+		return nil
+	}
+	switch event.Type {
+	case events.QuoteAdded, events.QuoteChanged, events.QuoteDeleted, events.SettingsChanged:
+	case events.CacheCleaned:
+		// The cache is not rebuilt from events
+		r.Ignored++
+		return nil
+	default:
+		r.Unknown++
+		return nil
+	}
+	if err := fn(); err != nil {
+		return fmt.Errorf("%s event: %w", event.Type, err)
+	}
+	r.Applied[event.Type]++
+	r.Last = event.At
+	return nil
+}
+
+// check decodes the data of an event without applying it
+func check(event events.Event) error {
+	switch event.Type {
+	case events.QuoteAdded, events.QuoteChanged:
+		_, err := decodeQuote(event)
+		return err
+	case events.QuoteDeleted:
+		var ref events.QuoteRef
+		return json.Unmarshal(event.Data, &ref)
+	case events.SettingsChanged:
+		var cs settings.ChatSettings
+		return json.Unmarshal(event.Data, &cs)
+	}
+	return nil
+}
+
+// apply writes the change of an event
+func apply(tx *gorm.DB, event events.Event) error {
+	switch event.Type {
+	case events.QuoteAdded, events.QuoteChanged:
+		quote, err := decodeQuote(event)
+		if err != nil {
+			return err
+		}
+		return putQuote(tx, quote)
+	case events.QuoteDeleted:
+		var ref events.QuoteRef
+		if err := json.Unmarshal(event.Data, &ref); err != nil {
+			return err
+		}
+		// Entries are removed by the ON DELETE CASCADE constraint
+		return tx.Delete(&quotes.Quote{}, ref.QuoteID).Error
+	case events.SettingsChanged:
+		var cs settings.ChatSettings
+		if err := json.Unmarshal(event.Data, &cs); err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chat_id"}},
+			UpdateAll: true,
+		}).Create(&cs).Error
+	}
+	return nil
+}
+
+// decodeQuote decodes the quote of an event
+func decodeQuote(event events.Event) (*quotes.Quote, error) {
+	var quote quotes.Quote
+	if err := json.Unmarshal(event.Data, &quote); err != nil {
+		return nil, err
+	}
+	if quote.ID == 0 || len(quote.Entries) == 0 {
+		return nil, fmt.Errorf("quote without an ID or entries")
+	}
+	return &quote, nil
+}
+
+// putQuote stores a quote as the event has it, replacing its previous
+// entries
+func putQuote(tx *gorm.DB, quote *quotes.Quote) error {
+	// Events recorded before quotes marked their media lack the mark
+	quote.HasMedia = quote.ContainsMedia()
+	entries := quote.Entries
+	quote.Entries = nil
+	if err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		UpdateAll: true,
+	}).Create(quote).Error; err != nil {
+		return fmt.Errorf("failed to store quote %d: %w", quote.ID, err)
+	}
+	if err := tx.Unscoped().Where("quote_id = ?", quote.ID).Delete(&quotes.QuoteEntry{}).Error; err != nil {
+		return fmt.Errorf("failed to replace entries of quote %d: %w", quote.ID, err)
+	}
+	for i := range entries {
+		entries[i].QuoteID = quote.ID
+	}
+	if err := tx.Create(&entries).Error; err != nil {
+		return fmt.Errorf("failed to store entries of quote %d: %w", quote.ID, err)
+	}
+	return nil
+}
+
+// checkEmpty refuses databases that already hold quotes or settings
+func checkEmpty(tx *gorm.DB) error {
+	var count int64
+	if err := tx.Raw(`SELECT (SELECT count(*) FROM quote) + (SELECT count(*) FROM chat_settings)`).Scan(&count).Error; err != nil {
+		return fmt.Errorf("failed to check the database is empty: %w", err)
+	}
+	if count > 0 {
+		return ErrNotEmpty
+	}
+	return nil
+}
+
+// resetSequences moves the ID sequences past the replayed IDs
+func resetSequences(tx *gorm.DB) error {
+	for _, table := range []string{"quote", "quote_entry"} {
+		if err := tx.Exec(fmt.Sprintf(
+			`SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE((SELECT MAX(id) FROM %[1]s), 0) + 1, false)`, table,
+		)).Error; err != nil {
+			return fmt.Errorf("failed to reset the %s sequence: %w", table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/quotes"
+	"github.com/graffic/wanon-go/internal/settings"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+// logLines builds an event log from events
+func logLines(t *testing.T, list ...events.Event) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, event := range list {
+		line, err := json.Marshal(event)
+		require.NoError(t, err)
+		buf.Write(append(line, '\n'))
+	}
+	return &buf
+}
+
+func at(hour int) time.Time {
+	return time.Date(2026, 9, 15, hour, 0, 0, 0, time.UTC)
+}
+
+func TestReplay_DryRun(t *testing.T) {
+	quote := `{"id":1,"chat_id":-100123,"creator":{"id":1},"entries":[{"id":1,"order":0,"message":{"text":"hi"}}]}`
+	log := logLines(t,
+		events.Event{Type: events.QuoteAdded, At: at(10), ChatID: -100123, Data: json.RawMessage(quote)},
+		events.Event{Type: events.CacheCleaned, At: at(11), Data: json.RawMessage(`{"deleted":3}`)},
+		events.Event{Type: "quote_starred", At: at(11), Data: json.RawMessage(`{}`)},
+		events.Event{Type: events.SettingsChanged, At: at(12), ChatID: -100123, Data: json.RawMessage(`{"chat_id":-100123,"timezone":"Europe/Madrid"}`)},
+		events.Event{Type: events.QuoteDeleted, At: at(13), ChatID: -100123, Data: json.RawMessage(`{"quote_id":1}`)},
+	)
+
+	result, err := Replay(context.Background(), nil, log, Options{DryRun: true, Until: at(12)})
+	require.NoError(t, err)
+	assert.Equal(t, map[events.Type]int{events.QuoteAdded: 1, events.SettingsChanged: 1}, result.Applied)
+	assert.Equal(t, 1, result.Ignored)
+	assert.Equal(t, 1, result.Unknown)
+	assert.Equal(t, 1, result.Later)
+	assert.Equal(t, at(12), result.Last)
+	assert.Equal(t, "applied quote_added 1, settings_changed 1; 1 ignored, 1 unknown, 1 after the cutoff; state as of 2026-09-15T12:00:00Z", result.String())
+}
+
+func TestReplay_DryRun_InvalidLog(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		err  string
+	}{
+		{"not json", "{\n", "line 1: invalid event"},
+		{"no type", `{"at":"2026-09-15T10:00:00Z"}`, "line 1: event without a type"},
+		{"quote without entries", `{"type":"quote_added","data":{"id":1}}`, "line 1: quote_added event: quote without an ID or entries"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Replay(context.Background(), nil, strings.NewReader(tt.log), Options{DryRun: true})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+// logWriter appends published events to a log
+type logWriter struct {
+	t   *testing.T
+	buf bytes.Buffer
+}
+
+func (w *logWriter) Receive(ctx context.Context, event events.Event) error {
+	line, err := json.Marshal(event)
+	require.NoError(w.t, err)
+	w.buf.Write(append(line, '\n'))
+	return nil
+}
+
+func TestReplay_RebuildsState(t *testing.T) {
+	source := testutils.NewTestDB(t)
+	log := &logWriter{t: t}
+	bus := events.NewBus(slog.New(slog.NewTextHandler(io.Discard, nil))).Subscribe("log", log)
+	store := quotes.NewStore(source.DB).WithEvents(bus)
+	ctx := context.Background()
+
+	kept, err := store.Store(ctx, quotes.StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []quotes.CacheEntry{{Message: datatypes.JSON(`{"text":"first"}`)}},
+	})
+	require.NoError(t, err)
+	_, err = store.Append(ctx, -100123, kept.ID, []quotes.CacheEntry{{Message: datatypes.JSON(`{"text":"second"}`)}})
+	require.NoError(t, err)
+	require.NoError(t, store.Reorder(ctx, kept.ID, []int{2, 1}))
+
+	gone, err := store.Store(ctx, quotes.StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []quotes.CacheEntry{{Message: datatypes.JSON(`{"text":"bye","from":{"id":9}}`)}},
+	})
+	require.NoError(t, err)
+	_, err = store.BulkDelete(ctx, quotes.BulkDeleteFilter{ChatID: -100123, AuthorID: 9}, false)
+	require.NoError(t, err)
+
+	service := settings.NewService(source.DB).WithEvents(bus)
+	require.NoError(t, service.Save(ctx, &settings.ChatSettings{ChatID: -100123, Timezone: "Europe/Madrid"}))
+
+	target := testutils.NewTestDB(t)
+	result, err := Replay(ctx, target.DB, &log.buf, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Applied[events.QuoteAdded])
+	assert.Equal(t, 2, result.Applied[events.QuoteChanged])
+	assert.Equal(t, 1, result.Applied[events.QuoteDeleted])
+
+	restored, err := quotes.NewStore(target.DB).GetByID(ctx, kept.ID)
+	require.NoError(t, err)
+	require.Len(t, restored.Entries, 2)
+	assert.JSONEq(t, `{"text":"second"}`, string(restored.Entries[0].Message))
+	assert.JSONEq(t, `{"text":"first"}`, string(restored.Entries[1].Message))
+
+	_, err = quotes.NewStore(target.DB).GetByID(ctx, gone.ID)
+	assert.Error(t, err)
+
+	cs, err := settings.NewService(target.DB).Get(ctx, -100123)
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Madrid", cs.Timezone)
+
+	// New quotes get IDs after the replayed ones
+	next, err := quotes.NewStore(target.DB).Store(ctx, quotes.StoreOptions{
+		ChatID:  -100123,
+		Creator: map[string]interface{}{"id": 1},
+		Entries: []quotes.CacheEntry{{Message: datatypes.JSON(`{"text":"new"}`)}},
+	})
+	require.NoError(t, err)
+	assert.Greater(t, next.ID, gone.ID)
+
+	// Replaying twice is refused
+	_, err = Replay(ctx, target.DB, strings.NewReader(""), Options{})
+	assert.ErrorIs(t, err, ErrNotEmpty)
+}
@@ -0,0 +1,90 @@
+package settings
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"gorm.io/gorm"
+)
+
+// autoDeleteBatch is how many replies a sweep deletes at most
+const autoDeleteBatch = 100
+
+// ReplySweeper deletes transient replies once the autodelete delay of their
+// chat has passed
+type ReplySweeper struct {
+	db     *gorm.DB
+	client telegram.MessageClient
+	clock  clock.Clock
+	logger *slog.Logger
+}
+
+// NewReplySweeper creates a sweeper deleting messages with the given client
+func NewReplySweeper(db *gorm.DB, client telegram.MessageClient, logger *slog.Logger) *ReplySweeper {
+	return &ReplySweeper{db: db, client: client, clock: clock.System{}, logger: logger}
+}
+
+// WithClock replaces the clock deciding which replies are due
+func (s *ReplySweeper) WithClock(clk clock.Clock) *ReplySweeper {
+	s.clock = clk
+	return s
+}
+
+// Sweep deletes the transient replies whose delay has passed and returns
+// how many it handled. Replies Telegram refuses to delete, for example
+// because someone already did, are not tried again.
+func (s *ReplySweeper) Sweep(ctx context.Context) (int, error) {
+	now := s.clock.Now()
+
+	var due []outbox.Message
+	err := s.db.WithContext(ctx).
+		Table("outbox_message AS m").
+		Select("m.*").
+		Joins("JOIN chat_settings s ON s.chat_id = m.chat_id").
+		Where("m.transient AND m.removed_at IS NULL AND m.sent_at IS NOT NULL AND m.message_id <> 0").
+		Where("s.reply_delete_seconds > 0 AND m.sent_at + s.reply_delete_seconds * interval '1 second' <= ?", now).
+		// Telegram only lets bots delete messages from the last 48 hours
+		Where("m.sent_at > ?", now.Add(-maxReplyDelete)).
+		Order("m.sent_at ASC").
+		Limit(autoDeleteBatch).
+		Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range due {
+		_, err := s.client.DeleteMessage(ctx, &bot.DeleteMessageParams{ChatID: msg.ChatID, MessageID: msg.MessageID})
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			s.logger.Debug("failed to delete transient reply", "chat_id", msg.ChatID, "message_id", msg.MessageID, "error", err)
+		}
+		if err := s.db.WithContext(ctx).Model(&msg).Update("removed_at", now).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+// Start sweeps every interval until ctx is cancelled
+func (s *ReplySweeper) Start(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil {
+				s.logger.Error("failed to delete transient replies", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDeleter struct {
+	deleted []int
+}
+
+func (f *fakeDeleter) DeleteMessage(ctx context.Context, params *bot.DeleteMessageParams) (bool, error) {
+	f.deleted = append(f.deleted, params.MessageID)
+	if params.MessageID == 13 {
+		return false, errors.New("Bad Request: message to delete not found")
+	}
+	return true, nil
+}
+
+func TestReplySweeper(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, NewService(db.DB).Save(ctx, &ChatSettings{ChatID: -100, ReplyDeleteSeconds: 30}))
+	send := func(chatID int64, messageID int, transient bool, sentAgo time.Duration) {
+		sentAt := now.Add(-sentAgo)
+		require.NoError(t, db.DB.Create(&outbox.Message{
+			ChatID: chatID, Text: "notice", MessageID: messageID, Transient: transient, SentAt: &sentAt,
+		}).Error)
+	}
+	send(-100, 11, true, time.Minute)    // Due
+	send(-100, 12, true, 10*time.Second) // Not yet
+	send(-100, 13, true, time.Hour)      // Due, already deleted by someone
+	send(-100, 14, false, time.Hour)     // A quote, kept
+	send(-100, 15, true, 72*time.Hour)   // Too old to delete
+	send(-200, 21, true, time.Hour)      // Chat without autodelete
+
+	client := &fakeDeleter{}
+	sweeper := NewReplySweeper(db.DB, client, slog.New(slog.NewTextHandler(io.Discard, nil))).
+		WithClock(clock.NewMock(now))
+
+	swept, err := sweeper.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, swept)
+	assert.Equal(t, []int{13, 11}, client.deleted)
+
+	// Deleted replies are not tried again
+	swept, err = sweeper.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, swept)
+}
@@ -0,0 +1,177 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"gorm.io/gorm"
+)
+
+// CommandToggleHandler handles the /disable and /enable commands
+type CommandToggleHandler struct {
+	service  *Service
+	outbox   *outbox.Outbox
+	admins   *telegram.AdminService
+	commands []string // Commands that can be turned off, without the slash
+	disable  bool
+}
+
+// NewDisableHandler creates the /disable handler
+func NewDisableHandler(db *gorm.DB) *CommandToggleHandler {
+	return &CommandToggleHandler{service: NewService(db), outbox: outbox.New(db), disable: true}
+}
+
+// NewEnableHandler creates the /enable handler
+func NewEnableHandler(db *gorm.DB) *CommandToggleHandler {
+	return &CommandToggleHandler{service: NewService(db), outbox: outbox.New(db)}
+}
+
+// WithCommands sets the commands admins can turn off, named without the
+// leading slash. Commands left out, such as /settings, are always on.
+func (h *CommandToggleHandler) WithCommands(commands []string) *CommandToggleHandler {
+	h.commands = commands
+	return h
+}
+
+// WithEvents publishes the settings saved
+func (h *CommandToggleHandler) WithEvents(publisher events.Publisher) *CommandToggleHandler {
+	h.service.WithEvents(publisher)
+	return h
+}
+
+// WithAdmins checks admins against a shared cache of chat administrators
+func (h *CommandToggleHandler) WithAdmins(admins *telegram.AdminService) *CommandToggleHandler {
+	h.admins = admins
+	return h
+}
+
+// Handle processes /disable <command> and /enable <command>. Without a
+// command it shows which commands are on.
+func (h *CommandToggleHandler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	chatID := msg.Chat.ID
+
+	cs, err := h.service.Get(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	if args.Len() == 0 {
+		return h.reply(ctx, b, chatID, CommandStatus(cs, h.commands)+"\n\nUsage: "+h.Command()+" <command>")
+	}
+
+	admin, err := h.admins.IsSenderAdmin(ctx, b, msg)
+	var refused *telegram.OriginError
+	if errors.As(err, &refused) {
+		return h.reply(ctx, b, chatID, refused.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return h.reply(ctx, b, chatID, "Only chat administrators can turn commands on or off.")
+	}
+
+	command := CommandArg(args.Arg(0))
+	if !slices.Contains(h.commands, command) {
+		return h.reply(ctx, b, chatID, fmt.Sprintf("/%s cannot be turned off. Commands that can: %s", command, strings.Join(h.commands, ", ")))
+	}
+
+	if !cs.SetDisabled(command, h.disable) {
+		return h.reply(ctx, b, chatID, fmt.Sprintf("/%s is already %s.", command, onOff(!h.disable)))
+	}
+	if err := h.service.Save(ctx, cs); err != nil {
+		return err
+	}
+	slog.Info("command toggled", "audit", true, "chat_id", chatID, "admin_id", msg.From.ID, "command", command, "disabled", h.disable)
+	return h.reply(ctx, b, chatID, fmt.Sprintf("/%s is now %s in this chat.", command, onOff(!h.disable)))
+}
+
+// reply sends a notice deleted after the chat's autodelete delay
+func (h *CommandToggleHandler) reply(ctx context.Context, b *bot.Bot, chatID int64, text string) error {
+	_, err := h.outbox.Send(ctx, b, &outbox.Message{ChatID: chatID, Text: text, Transient: true})
+	return err
+}
+
+// Command returns the command name
+func (h *CommandToggleHandler) Command() string {
+	if h.disable {
+		return "/disable"
+	}
+	return "/enable"
+}
+
+// Description returns the command description
+func (h *CommandToggleHandler) Description() string {
+	if h.disable {
+		return "Turn a command off in this chat (admins only)"
+	}
+	return "Turn a disabled command back on (admins only)"
+}
+
+// CommandArg normalizes a command argument such as "/FindQuote@bot" to
+// its name, "findquote"
+func CommandArg(arg string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(arg, "/"), "@")
+	return strings.ToLower(name)
+}
+
+// CommandStatus lists the commands that can be turned off, each with
+// whether it is on in the chat
+func CommandStatus(cs *ChatSettings, commands []string) string {
+	lines := []string{"Commands:"}
+	for _, command := range commands {
+		lines = append(lines, fmt.Sprintf("/%s: %s", command, onOff(!cs.IsDisabled(command))))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Middleware returns a bot middleware dropping the given commands, named
+// without the leading slash, in the chats that turned them off. Other
+// updates pass through without reading the settings.
+func Middleware(service *Service, commands []string, logger *slog.Logger) bot.Middleware {
+	toggleable := make(map[string]bool, len(commands))
+	for _, command := range commands {
+		toggleable[command] = true
+	}
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			msg := update.Message
+			if msg == nil {
+				next(ctx, b, update)
+				return
+			}
+			args, ok := botcmd.ParseArgs(msg.Text)
+			if !ok || !toggleable[args.Command] {
+				next(ctx, b, update)
+				return
+			}
+			cs, err := service.Get(ctx, msg.Chat.ID)
+			if err != nil {
+				// Fail open: a settings outage should not silence the bot
+				logger.Error("failed to check disabled commands", "chat_id", msg.Chat.ID, "command", args.Command, "error", err)
+				next(ctx, b, update)
+				return
+			}
+			if cs.IsDisabled(args.Command) {
+				logger.Debug("ignoring disabled command", "chat_id", msg.Chat.ID, "command", args.Command)
+				return
+			}
+			next(ctx, b, update)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package settings
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatSettings_SetDisabled(t *testing.T) {
+	cs := &ChatSettings{}
+	assert.False(t, cs.IsDisabled("rquote"))
+
+	assert.True(t, cs.SetDisabled("rquote", true))
+	assert.True(t, cs.SetDisabled("heatmap", true))
+	assert.False(t, cs.SetDisabled("rquote", true))
+	assert.Equal(t, "heatmap rquote", cs.DisabledCommands)
+	assert.True(t, cs.IsDisabled("rquote"))
+	assert.False(t, cs.IsDisabled("quote"))
+
+	assert.True(t, cs.SetDisabled("heatmap", false))
+	assert.False(t, cs.SetDisabled("heatmap", false))
+	assert.Equal(t, []string{"rquote"}, cs.Disabled())
+
+	assert.True(t, cs.SetDisabled("rquote", false))
+	assert.Empty(t, cs.DisabledCommands)
+}
+
+func TestCommandArg(t *testing.T) {
+	assert.Equal(t, "findquote", CommandArg("findquote"))
+	assert.Equal(t, "findquote", CommandArg("/FindQuote"))
+	assert.Equal(t, "rquote", CommandArg("/rquote@wanon_bot"))
+}
+
+func TestCommandStatus(t *testing.T) {
+	cs := &ChatSettings{DisabledCommands: "heatmap"}
+	assert.Equal(t, "Commands:\n/rquote: on\n/heatmap: off", CommandStatus(cs, []string{"rquote", "heatmap"}))
+}
+
+func TestCommandToggleHandler_Command(t *testing.T) {
+	assert.Equal(t, "/disable", (&CommandToggleHandler{disable: true}).Command())
+	assert.Equal(t, "/enable", (&CommandToggleHandler{}).Command())
+}
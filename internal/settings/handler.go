@@ -0,0 +1,413 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/events"
+	"github.com/graffic/wanon-go/internal/kv"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"github.com/graffic/wanon-go/internal/telegram"
+	"gorm.io/gorm"
+)
+
+// Handler handles the /settings command
+type Handler struct {
+	service  *Service
+	outbox   *outbox.Outbox
+	admins   *telegram.AdminService
+	commands []string // Commands that can be turned off, for /settings commands
+	sessions kv.Store // Open settings menus
+}
+
+// NewHandler creates a new settings handler
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{
+		service:  NewService(db),
+		outbox:   outbox.New(db),
+		sessions: kv.NewMemory(),
+	}
+}
+
+// WithCommands sets the commands /settings commands shows, named without
+// the leading slash
+func (h *Handler) WithCommands(commands []string) *Handler {
+	h.commands = commands
+	return h
+}
+
+// WithEvents publishes the settings saved
+func (h *Handler) WithEvents(publisher events.Publisher) *Handler {
+	h.service.WithEvents(publisher)
+	return h
+}
+
+// WithAdmins checks admins against a shared cache of chat administrators
+func (h *Handler) WithAdmins(admins *telegram.AdminService) *Handler {
+	h.admins = admins
+	return h
+}
+
+// Handle processes the /settings command.
+// Without arguments it shows the current settings, with a button opening
+// the settings menu, and with "commands" which commands are on. Otherwise it
+// expects "<key> <value>" and requires the sender to be a chat
+// administrator.
+func (h *Handler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+
+	chatID := msg.Chat.ID
+	cs, err := h.service.Get(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	args, _ := botcmd.ParseArgs(msg.Text)
+	if args.Len() == 0 {
+		_, err := h.outbox.Send(ctx, b, &outbox.Message{ChatID: chatID, Text: Describe(cs, msg.From.LanguageCode), Keyboard: settingsKeyboard()})
+		return err
+	}
+	if args.Len() == 1 && strings.EqualFold(args.Arg(0), "commands") {
+		return h.reply(ctx, b, chatID, CommandStatus(cs, h.commands)+"\n\nAdmins turn them off with /disable and back on with /enable.", false)
+	}
+
+	slog.Info("executing /settings command", "chat_id", chatID, "user_id", msg.From.ID, "key", args.Arg(0))
+
+	admin, err := h.admins.IsSenderAdmin(ctx, b, msg)
+	var refused *telegram.OriginError
+	if errors.As(err, &refused) {
+		return h.reply(ctx, b, chatID, refused.Error(), true)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return h.reply(ctx, b, chatID, "Only chat administrators can change settings.", true)
+	}
+
+	if args.Len() < 2 {
+		return h.reply(ctx, b, chatID, usage, true)
+	}
+
+	// A single (possibly quoted) value is used as is, otherwise the raw text
+	// keeps the spacing of values such as date layouts
+	value := args.Arg(1)
+	if args.Len() > 2 {
+		value = args.Rest(1)
+	}
+
+	if err := Apply(cs, args.Arg(0), value); err != nil {
+		return h.reply(ctx, b, chatID, err.Error(), true)
+	}
+
+	if err := h.service.Save(ctx, cs); err != nil {
+		return err
+	}
+
+	return h.reply(ctx, b, chatID, "Settings updated.\n\n"+Describe(cs, msg.From.LanguageCode), true)
+}
+
+const usage = `Usage: /settings <key> <value>
+  timezone <IANA zone>       e.g. Europe/Madrid, or "default"
+  dateformat <format>        iso, eu, us, long, date, a Go layout, or "default"
+  relative <on|off>          show dates as "3 years ago"
+  language <code>            e.g. es, pt-br, or "default"
+  cache <duration>           keep messages quotable for e.g. 72h or 7d, or "default"
+  bots <keep|label|skip>     how quotes treat messages from bots
+  quiet <HH:MM-HH:MM|off>    hold back scheduled posts, e.g. 23:00-08:00
+  autodelete <duration|off>  delete notices and confirmations after e.g. 30s
+  cluster <name|off>         follow forwarded threads into chats of the same cluster
+  history <on|off>           let members search cached messages with /history
+  redact <on|off>            mask card and phone numbers before caching messages
+  links <on|off>             add a button to posted quotes opening the original message
+  news <on|off>              post what's new in the bot after it is upgraded
+
+/settings alone shows them with a button opening a menu of the common
+ones. /settings commands shows which commands are on; /disable and
+/enable turn them off and on.`
+
+// Apply sets a single setting from its textual key and value
+func Apply(cs *ChatSettings, key, value string) error {
+	value = strings.TrimSpace(value)
+	reset := strings.EqualFold(value, "default")
+
+	switch strings.ToLower(key) {
+	case "timezone", "tz":
+		if reset {
+			cs.Timezone = ""
+			return nil
+		}
+		if _, err := time.LoadLocation(value); err != nil {
+			return fmt.Errorf("unknown timezone %q", value)
+		}
+		cs.Timezone = value
+	case "dateformat", "date":
+		if reset {
+			cs.DateFormat = ""
+			return nil
+		}
+		if !IsNamedDateFormat(value) && !strings.Contains(value, "2006") {
+			return fmt.Errorf("invalid date format %q, use iso, eu, us, long, date or a Go layout", value)
+		}
+		cs.DateFormat = value
+	case "relative":
+		on, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		cs.RelativeDates = on
+	case "language", "lang":
+		if reset {
+			cs.Language = ""
+			return nil
+		}
+		cs.Language = strings.ToLower(value)
+	case "bots":
+		switch policy := BotPolicy(strings.ToLower(value)); policy {
+		case "keep", "default":
+			cs.BotMessages = BotsKeep
+		case BotsLabel, BotsSkip:
+			cs.BotMessages = policy
+		default:
+			return fmt.Errorf("invalid bots policy %q, use keep, label or skip", value)
+		}
+	case "quiet":
+		if reset || strings.EqualFold(value, "off") {
+			cs.QuietHoursWindow = ""
+			return nil
+		}
+		q, err := ParseQuietHours(value)
+		if err != nil {
+			return err
+		}
+		cs.QuietHoursWindow = q.String()
+	case "cache":
+		if reset {
+			cs.CacheRetentionSeconds = 0
+			return nil
+		}
+		d, err := parseRetention(value)
+		if err != nil {
+			return err
+		}
+		cs.CacheRetentionSeconds = int64(d / time.Second)
+	case "autodelete":
+		if reset || strings.EqualFold(value, "off") {
+			cs.ReplyDeleteSeconds = 0
+			return nil
+		}
+		d, err := parseReplyDelete(value)
+		if err != nil {
+			return err
+		}
+		cs.ReplyDeleteSeconds = int64(d / time.Second)
+	case "cluster":
+		if reset || strings.EqualFold(value, "off") {
+			cs.Cluster = ""
+			return nil
+		}
+		if !clusterName.MatchString(value) {
+			return fmt.Errorf("invalid cluster name %q, use up to 64 letters, digits, - or _", value)
+		}
+		cs.Cluster = value
+	case "history":
+		on, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		cs.History = on
+	case "redact":
+		on, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		cs.KeepSensitive = !on
+	case "links":
+		on, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		cs.JumpLinks = on
+	case "news":
+		on, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		cs.News = on
+	default:
+		return fmt.Errorf("unknown setting %q\n\n%s", key, usage)
+	}
+	return nil
+}
+
+// Describe renders the settings of a chat as text
+func Describe(cs *ChatSettings, fallbackLanguage string) string {
+	language := cs.language(fallbackLanguage)
+	if language == "" {
+		language = "en"
+	}
+
+	lines := []string{
+		"Chat settings:",
+		fmt.Sprintf("language: %s", orDefault(cs.Language, language)),
+		fmt.Sprintf("timezone: %s", orDefault(cs.Timezone, cs.Location(fallbackLanguage).String())),
+		fmt.Sprintf("dateformat: %s", orDefault(cs.DateFormat, cs.Layout(fallbackLanguage))),
+		fmt.Sprintf("relative: %s", onOff(cs.RelativeDates)),
+		fmt.Sprintf("cache: %s", orDefault(formatRetention(cs.CacheRetention()), "global")),
+		fmt.Sprintf("bots: %s", orDefault(string(cs.BotMessages), "keep")),
+		fmt.Sprintf("quiet: %s", orDefault(cs.QuietHours().String(), "off")),
+		fmt.Sprintf("autodelete: %s", orDefault(formatDelay(cs.ReplyDelete()), "off")),
+		fmt.Sprintf("cluster: %s", orDefault(cs.Cluster, "off")),
+		fmt.Sprintf("history: %s", onOff(cs.History)),
+		fmt.Sprintf("redact: %s", onOff(!cs.KeepSensitive)),
+		fmt.Sprintf("links: %s", onOff(cs.JumpLinks)),
+		fmt.Sprintf("news: %s", onOff(cs.News)),
+		fmt.Sprintf("disabled: %s", disabledList(cs)),
+	}
+	return strings.Join(lines, "\n")
+}
+
+// disabledList formats the commands turned off in the chat
+func disabledList(cs *ChatSettings) string {
+	disabled := cs.Disabled()
+	if len(disabled) == 0 {
+		return "none"
+	}
+	return "/" + strings.Join(disabled, ", /")
+}
+
+// orDefault formats a setting value, marking derived values as defaults
+func orDefault(value, derived string) string {
+	if value != "" {
+		return value
+	}
+	return derived + " (default)"
+}
+
+// onOff formats a switch
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// parseBool parses on/off style switches
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "yes", "true", "1":
+		return true, nil
+	case "off", "no", "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected on or off, got %q", value)
+}
+
+// clusterName is what a cluster can be called. Any chat naming the same
+// cluster reads the others' forwarded threads, so names work best when
+// hard to guess.
+var clusterName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Bounds for the per-chat cache retention
+const (
+	minCacheRetention = time.Hour
+	maxCacheRetention = 365 * 24 * time.Hour
+)
+
+// parseRetention parses a cache retention such as "72h" or "7d"
+func parseRetention(value string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(value)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid cache duration %q, use e.g. 72h or 7d", value)
+	}
+	if d < minCacheRetention || d > maxCacheRetention {
+		return 0, fmt.Errorf("cache duration must be between %s and %s", formatRetention(minCacheRetention), formatRetention(maxCacheRetention))
+	}
+	return d, nil
+}
+
+// Bounds for the delay before transient replies are deleted. Bots cannot
+// delete messages older than 48 hours.
+const (
+	minReplyDelete = 5 * time.Second
+	maxReplyDelete = 48 * time.Hour
+)
+
+// parseReplyDelete parses the delay before transient replies are deleted,
+// a duration such as "30s" or a number of seconds
+func parseReplyDelete(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if seconds, convErr := strconv.Atoi(value); convErr == nil {
+		d, err = time.Duration(seconds)*time.Second, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid autodelete delay %q, use e.g. 30s or 2m", value)
+	}
+	if d < minReplyDelete || d > maxReplyDelete {
+		return 0, fmt.Errorf("autodelete delay must be between %s and %s", formatDelay(minReplyDelete), formatDelay(maxReplyDelete))
+	}
+	return d.Truncate(time.Second), nil
+}
+
+// formatDelay prints a delay without trailing zero units, e.g. "1m30s" or "2m"
+func formatDelay(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	text := d.String()
+	if strings.HasSuffix(text, "m0s") {
+		text = strings.TrimSuffix(text, "0s")
+	}
+	if strings.HasSuffix(text, "h0m") {
+		text = strings.TrimSuffix(text, "0m")
+	}
+	return text
+}
+
+// formatRetention prints a retention in whole days when possible
+func formatRetention(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(d.String(), "0s"), "0m")
+}
+
+// reply sends a text message to the chat through the outbox. Transient
+// replies are deleted after the chat's autodelete delay.
+func (h *Handler) reply(ctx context.Context, b *bot.Bot, chatID int64, text string, transient bool) error {
+	_, err := h.outbox.Send(ctx, b, &outbox.Message{ChatID: chatID, Text: text, Transient: transient})
+	return err
+}
+
+// Command returns the command name
+func (h *Handler) Command() string {
+	return "/settings"
+}
+
+// Description returns the command description
+func (h *Handler) Description() string {
+	return "Show or change chat settings"
+}
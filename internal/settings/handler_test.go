@@ -0,0 +1,259 @@
+package settings
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name        string
+		key         string
+		value       string
+		check       func(t *testing.T, cs *ChatSettings)
+		errContains string
+	}{
+		{
+			name:  "timezone",
+			key:   "timezone",
+			value: "UTC",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Equal(t, "UTC", cs.Timezone) },
+		},
+		{
+			name:        "invalid timezone",
+			key:         "tz",
+			value:       "Nowhere/Land",
+			errContains: "unknown timezone",
+		},
+		{
+			name:  "named date format",
+			key:   "dateformat",
+			value: "eu",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Equal(t, "eu", cs.DateFormat) },
+		},
+		{
+			name:  "go layout",
+			key:   "dateformat",
+			value: "Jan 2, 2006",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Equal(t, "Jan 2, 2006", cs.DateFormat) },
+		},
+		{
+			name:        "invalid date format",
+			key:         "dateformat",
+			value:       "dd/mm/yyyy",
+			errContains: "invalid date format",
+		},
+		{
+			name:  "relative on",
+			key:   "relative",
+			value: "on",
+			check: func(t *testing.T, cs *ChatSettings) { assert.True(t, cs.RelativeDates) },
+		},
+		{
+			name:        "relative invalid",
+			key:         "relative",
+			value:       "maybe",
+			errContains: "expected on or off",
+		},
+		{
+			name:  "language",
+			key:   "language",
+			value: "PT-BR",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Equal(t, "pt-br", cs.Language) },
+		},
+		{
+			name:  "reset to default",
+			key:   "timezone",
+			value: "default",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Empty(t, cs.Timezone) },
+		},
+		{
+			name:  "cache hours",
+			key:   "cache",
+			value: "72h",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Equal(t, 72*time.Hour, cs.CacheRetention()) },
+		},
+		{
+			name:  "cache days",
+			key:   "cache",
+			value: "7d",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Equal(t, 7*24*time.Hour, cs.CacheRetention()) },
+		},
+		{
+			name:        "cache too short",
+			key:         "cache",
+			value:       "10m",
+			errContains: "must be between",
+		},
+		{
+			name:        "cache invalid",
+			key:         "cache",
+			value:       "forever",
+			errContains: "invalid cache duration",
+		},
+		{
+			name:  "bots label",
+			key:   "bots",
+			value: "Label",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Equal(t, BotsLabel, cs.BotMessages) },
+		},
+		{
+			name:  "bots keep",
+			key:   "bots",
+			value: "keep",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Equal(t, BotsKeep, cs.BotMessages) },
+		},
+		{
+			name:        "bots invalid",
+			key:         "bots",
+			value:       "ban",
+			errContains: "invalid bots policy",
+		},
+		{
+			name:        "unknown key",
+			key:         "colour",
+			value:       "blue",
+			errContains: "unknown setting",
+		},
+		{
+			name:  "quiet hours",
+			key:   "quiet",
+			value: "23:00-8:00",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Equal(t, "23:00-08:00", cs.QuietHoursWindow) },
+		},
+		{
+			name:  "quiet hours off",
+			key:   "quiet",
+			value: "off",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Empty(t, cs.QuietHoursWindow) },
+		},
+		{
+			name:        "invalid quiet hours",
+			key:         "quiet",
+			value:       "late",
+			errContains: "invalid quiet hours",
+		},
+		{
+			name:  "autodelete",
+			key:   "autodelete",
+			value: "2m",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Equal(t, int64(120), cs.ReplyDeleteSeconds) },
+		},
+		{
+			name:  "autodelete seconds",
+			key:   "autodelete",
+			value: "45",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Equal(t, 45*time.Second, cs.ReplyDelete()) },
+		},
+		{
+			name:  "autodelete off",
+			key:   "autodelete",
+			value: "off",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Zero(t, cs.ReplyDeleteSeconds) },
+		},
+		{
+			name:        "autodelete too long",
+			key:         "autodelete",
+			value:       "72h",
+			errContains: "between 5s and 48h",
+		},
+		{
+			name:  "cluster",
+			key:   "cluster",
+			value: "friends-2024",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Equal(t, "friends-2024", cs.Cluster) },
+		},
+		{
+			name:  "cluster off",
+			key:   "cluster",
+			value: "off",
+			check: func(t *testing.T, cs *ChatSettings) { assert.Empty(t, cs.Cluster) },
+		},
+		{
+			name:        "invalid cluster",
+			key:         "cluster",
+			value:       "my friends",
+			errContains: "invalid cluster name",
+		},
+		{
+			name:  "history",
+			key:   "history",
+			value: "on",
+			check: func(t *testing.T, cs *ChatSettings) { assert.True(t, cs.History) },
+		},
+		{
+			name:  "redact off",
+			key:   "redact",
+			value: "off",
+			check: func(t *testing.T, cs *ChatSettings) { assert.True(t, cs.KeepSensitive) },
+		},
+		{
+			name:  "links",
+			key:   "links",
+			value: "on",
+			check: func(t *testing.T, cs *ChatSettings) { assert.True(t, cs.JumpLinks) },
+		},
+		{
+			name:  "news",
+			key:   "news",
+			value: "on",
+			check: func(t *testing.T, cs *ChatSettings) { assert.True(t, cs.News) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := &ChatSettings{ChatID: 1, Timezone: "Europe/Madrid"}
+			err := Apply(cs, tt.key, tt.value)
+			if tt.errContains != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			tt.check(t, cs)
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	cs := &ChatSettings{ChatID: 1, DateFormat: "us", RelativeDates: true}
+
+	text := Describe(cs, "")
+	assert.Contains(t, text, "language: en (default)")
+	assert.Contains(t, text, "timezone: UTC (default)")
+	assert.Contains(t, text, "dateformat: us")
+	assert.Contains(t, text, "relative: on")
+	assert.Contains(t, text, "cache: global (default)")
+	assert.Contains(t, text, "bots: keep (default)")
+	assert.Contains(t, text, "quiet: off (default)")
+	assert.Contains(t, text, "autodelete: off (default)")
+	assert.Contains(t, text, "cluster: off (default)")
+	assert.Contains(t, text, "history: off")
+	assert.Contains(t, text, "redact: on")
+	assert.Contains(t, text, "links: off")
+	assert.Contains(t, text, "news: off")
+	assert.Contains(t, text, "disabled: none")
+
+	cs.CacheRetentionSeconds = int64((36 * time.Hour).Seconds())
+	assert.Contains(t, Describe(cs, ""), "cache: 36h")
+
+	cs.ReplyDeleteSeconds = 90
+	assert.Contains(t, Describe(cs, ""), "autodelete: 1m30s")
+	cs.ReplyDeleteSeconds = 30
+	assert.Contains(t, Describe(cs, ""), "autodelete: 30s")
+	cs.ReplyDeleteSeconds = 120
+	assert.Contains(t, Describe(cs, ""), "autodelete: 2m\n")
+
+	cs.DisabledCommands = "heatmap history"
+	assert.Contains(t, Describe(cs, ""), "disabled: /heatmap, /history")
+}
+
+func TestHandler_Command(t *testing.T) {
+	handler := &Handler{}
+	assert.Equal(t, "/settings", handler.Command())
+	assert.Equal(t, "Show or change chat settings", handler.Description())
+}
@@ -0,0 +1,73 @@
+package settings
+
+import (
+	"strings"
+)
+
+// Locale holds the date defaults derived from a language code
+type Locale struct {
+	Timezone   string
+	DateFormat string
+}
+
+// defaultLocale is used for unknown languages and keeps the historical
+// UTC/ISO rendering.
+var defaultLocale = Locale{Timezone: "UTC", DateFormat: "2006-01-02 15:04"}
+
+// locales maps Telegram language codes to sensible date defaults.
+// Region specific codes (pt-br) take precedence over the base language (pt).
+var locales = map[string]Locale{
+	"en":    defaultLocale,
+	"en-us": {Timezone: "America/New_York", DateFormat: "01/02/2006 3:04 PM"},
+	"en-gb": {Timezone: "Europe/London", DateFormat: "02/01/2006 15:04"},
+	"es":    {Timezone: "Europe/Madrid", DateFormat: "02/01/2006 15:04"},
+	"ca":    {Timezone: "Europe/Madrid", DateFormat: "02/01/2006 15:04"},
+	"gl":    {Timezone: "Europe/Madrid", DateFormat: "02/01/2006 15:04"},
+	"eu":    {Timezone: "Europe/Madrid", DateFormat: "02/01/2006 15:04"},
+	"fr":    {Timezone: "Europe/Paris", DateFormat: "02/01/2006 15:04"},
+	"it":    {Timezone: "Europe/Rome", DateFormat: "02/01/2006 15:04"},
+	"de":    {Timezone: "Europe/Berlin", DateFormat: "02.01.2006 15:04"},
+	"nl":    {Timezone: "Europe/Amsterdam", DateFormat: "02-01-2006 15:04"},
+	"pt":    {Timezone: "Europe/Lisbon", DateFormat: "02/01/2006 15:04"},
+	"pt-br": {Timezone: "America/Sao_Paulo", DateFormat: "02/01/2006 15:04"},
+	"ru":    {Timezone: "Europe/Moscow", DateFormat: "02.01.2006 15:04"},
+	"uk":    {Timezone: "Europe/Kyiv", DateFormat: "02.01.2006 15:04"},
+}
+
+// dateFormats are the named formats accepted by /settings dateformat
+var dateFormats = map[string]string{
+	"iso":  "2006-01-02 15:04",
+	"eu":   "02/01/2006 15:04",
+	"us":   "01/02/2006 3:04 PM",
+	"long": "2 January 2006",
+	"date": "2006-01-02",
+}
+
+// LocaleFor returns the date defaults for a Telegram language code
+func LocaleFor(language string) Locale {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if l, ok := locales[language]; ok {
+		return l
+	}
+	if base, _, found := strings.Cut(language, "-"); found {
+		if l, ok := locales[base]; ok {
+			return l
+		}
+	}
+	return defaultLocale
+}
+
+// ResolveDateFormat turns a named format (iso, eu, us...) into a Go layout.
+// Anything else is assumed to already be a Go layout.
+func ResolveDateFormat(format string) string {
+	if layout, ok := dateFormats[strings.ToLower(format)]; ok {
+		return layout
+	}
+	return format
+}
+
+// IsNamedDateFormat reports whether format is one of the named formats
+func IsNamedDateFormat(format string) bool {
+	_, ok := dateFormats[strings.ToLower(format)]
+	return ok
+}
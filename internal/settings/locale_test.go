@@ -0,0 +1,37 @@
+package settings
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocaleFor(t *testing.T) {
+	tests := []struct {
+		language string
+		expected Locale
+	}{
+		{"", defaultLocale},
+		{"en", defaultLocale},
+		{"xx", defaultLocale},
+		{"es", Locale{Timezone: "Europe/Madrid", DateFormat: "02/01/2006 15:04"}},
+		{"ES", Locale{Timezone: "Europe/Madrid", DateFormat: "02/01/2006 15:04"}},
+		{"es-MX", Locale{Timezone: "Europe/Madrid", DateFormat: "02/01/2006 15:04"}},
+		{"pt-br", Locale{Timezone: "America/Sao_Paulo", DateFormat: "02/01/2006 15:04"}},
+		{"pt", Locale{Timezone: "Europe/Lisbon", DateFormat: "02/01/2006 15:04"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.language, func(t *testing.T) {
+			assert.Equal(t, tt.expected, LocaleFor(tt.language))
+		})
+	}
+}
+
+func TestResolveDateFormat(t *testing.T) {
+	assert.Equal(t, "2006-01-02 15:04", ResolveDateFormat("iso"))
+	assert.Equal(t, "01/02/2006 3:04 PM", ResolveDateFormat("US"))
+	assert.Equal(t, "Jan 2, 2006", ResolveDateFormat("Jan 2, 2006"))
+	assert.True(t, IsNamedDateFormat("long"))
+	assert.False(t, IsNamedDateFormat("2006"))
+}
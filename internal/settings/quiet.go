@@ -0,0 +1,94 @@
+package settings
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily window, in the chat time zone, during which
+// scheduled posts are held back. Windows may wrap past midnight, as in
+// 23:00-08:00. The zero value means no quiet hours.
+type QuietHours struct {
+	Start time.Duration // Offset from midnight
+	End   time.Duration // Offset from midnight
+}
+
+// ParseQuietHours parses a window such as "23:00-08:00"
+func ParseQuietHours(value string) (QuietHours, error) {
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return QuietHours{}, fmt.Errorf("invalid quiet hours %q, use e.g. 23:00-08:00", value)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return QuietHours{}, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return QuietHours{}, err
+	}
+	if start == end {
+		return QuietHours{}, fmt.Errorf("quiet hours must start and end at different times")
+	}
+	return QuietHours{Start: start, End: end}, nil
+}
+
+// parseClock parses a time of day such as "8:30" or "23:00"
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, use HH:MM", strings.TrimSpace(value))
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// IsZero reports whether there are no quiet hours
+func (q QuietHours) IsZero() bool {
+	return q.Start == q.End
+}
+
+// String formats the window as "HH:MM-HH:MM", or "" when there is none
+func (q QuietHours) String() string {
+	if q.IsZero() {
+		return ""
+	}
+	return formatClock(q.Start) + "-" + formatClock(q.End)
+}
+
+// formatClock prints an offset from midnight as HH:MM
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+// Defer returns when something scheduled for t may be posted: t itself, or
+// the end of the quiet window t falls in. Times are read in loc.
+func (q QuietHours) Defer(t time.Time, loc *time.Location) time.Time {
+	if q.IsZero() {
+		return t
+	}
+	local := t.In(loc)
+	year, month, day := local.Date()
+	offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second
+
+	if q.Start < q.End {
+		if offset < q.Start || offset >= q.End {
+			return t
+		}
+		return at(year, month, day, q.End, loc)
+	}
+
+	// The window wraps past midnight
+	switch {
+	case offset >= q.Start:
+		return at(year, month, day+1, q.End, loc)
+	case offset < q.End:
+		return at(year, month, day, q.End, loc)
+	}
+	return t
+}
+
+// at builds the time of a day given as an offset from midnight
+func at(year int, month time.Month, day int, offset time.Duration, loc *time.Location) time.Time {
+	return time.Date(year, month, day, int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, loc)
+}
@@ -0,0 +1,65 @@
+package settings
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	q, err := ParseQuietHours("23:00-08:30")
+	require.NoError(t, err)
+	assert.Equal(t, QuietHours{Start: 23 * time.Hour, End: 8*time.Hour + 30*time.Minute}, q)
+	assert.Equal(t, "23:00-08:30", q.String())
+
+	_, err = ParseQuietHours("23:00")
+	assert.ErrorContains(t, err, "invalid quiet hours")
+	_, err = ParseQuietHours("25:00-08:00")
+	assert.ErrorContains(t, err, "invalid time")
+	_, err = ParseQuietHours("08:00-08:00")
+	assert.ErrorContains(t, err, "different times")
+}
+
+func TestQuietHours_Defer(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+
+	night := QuietHours{Start: 23 * time.Hour, End: 8 * time.Hour}
+	lunch := QuietHours{Start: 13 * time.Hour, End: 15 * time.Hour}
+
+	tests := []struct {
+		name     string
+		quiet    QuietHours
+		at       time.Time
+		expected time.Time
+	}{
+		{"no quiet hours", QuietHours{}, time.Date(2024, 5, 1, 3, 0, 0, 0, madrid), time.Date(2024, 5, 1, 3, 0, 0, 0, madrid)},
+		{"before window", night, time.Date(2024, 5, 1, 22, 59, 0, 0, madrid), time.Date(2024, 5, 1, 22, 59, 0, 0, madrid)},
+		{"late evening", night, time.Date(2024, 5, 1, 23, 30, 0, 0, madrid), time.Date(2024, 5, 2, 8, 0, 0, 0, madrid)},
+		{"early morning", night, time.Date(2024, 5, 2, 6, 0, 0, 0, madrid), time.Date(2024, 5, 2, 8, 0, 0, 0, madrid)},
+		{"window end", night, time.Date(2024, 5, 2, 8, 0, 0, 0, madrid), time.Date(2024, 5, 2, 8, 0, 0, 0, madrid)},
+		{"same day window", lunch, time.Date(2024, 5, 1, 14, 0, 0, 0, madrid), time.Date(2024, 5, 1, 15, 0, 0, 0, madrid)},
+		{"outside same day window", lunch, time.Date(2024, 5, 1, 9, 0, 0, 0, madrid), time.Date(2024, 5, 1, 9, 0, 0, 0, madrid)},
+		// 05:00 UTC is 07:00 in Madrid during summer time
+		{"read in chat zone", night, time.Date(2024, 5, 2, 5, 0, 0, 0, time.UTC), time.Date(2024, 5, 2, 8, 0, 0, 0, madrid)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.quiet.Defer(tt.at, madrid)
+			assert.True(t, tt.expected.Equal(got), "expected %s, got %s", tt.expected, got)
+		})
+	}
+}
+
+func TestChatSettings_DeferScheduled(t *testing.T) {
+	cs := &ChatSettings{Timezone: "Europe/Madrid", QuietHoursWindow: "23:00-08:00"}
+	at := time.Date(2024, 1, 10, 23, 0, 0, 0, time.UTC) // Midnight in Madrid
+	assert.Equal(t, time.Date(2024, 1, 11, 7, 0, 0, 0, time.UTC), cs.DeferScheduled(at, "").UTC())
+
+	// Broken stored values do not hold posts back
+	cs.QuietHoursWindow = "garbage"
+	assert.Equal(t, at, cs.DeferScheduled(at, ""))
+}
@@ -0,0 +1,232 @@
+// Package settings stores per-chat preferences.
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/events"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ChatSettings holds the preferences of a single chat.
+// Empty values mean "use the default".
+type ChatSettings struct {
+	ChatID        int64  `gorm:"primaryKey;autoIncrement:false" json:"chat_id"`
+	Language      string `gorm:"not null;default:''" json:"language"`
+	Timezone      string `gorm:"not null;default:''" json:"timezone"`
+	DateFormat    string `gorm:"not null;default:''" json:"date_format"`
+	RelativeDates bool   `gorm:"not null;default:false" json:"relative_dates"`
+	// CacheRetentionSeconds overrides the global cache keep duration
+	CacheRetentionSeconds int64     `gorm:"not null;default:0" json:"cache_retention_seconds"`
+	BotMessages           BotPolicy `gorm:"not null;default:''" json:"bot_messages"`
+	// QuietHoursWindow holds the quiet hours as "HH:MM-HH:MM", see QuietHours
+	QuietHoursWindow string `gorm:"column:quiet_hours;not null;default:''" json:"quiet_hours"`
+	// ReplyDeleteSeconds deletes transient replies after this long; 0 keeps them
+	ReplyDeleteSeconds int64 `gorm:"not null;default:0" json:"reply_delete_seconds"`
+	// Cluster links chats of the same name: reply chains follow forwarded
+	// messages into the cache of the other chats of the cluster
+	Cluster string `gorm:"not null;default:''" json:"cluster"`
+	// History lets members search the cached messages with /history
+	History bool `gorm:"not null;default:false" json:"history"`
+	// KeepSensitive turns off the redaction of card and phone numbers and
+	// the other configured patterns before messages are cached
+	KeepSensitive bool `gorm:"not null;default:false" json:"keep_sensitive"`
+	// JumpLinks adds a button to posted quotes opening the original message
+	JumpLinks bool `gorm:"not null;default:false" json:"jump_links"`
+	// News posts what's new in the bot after it is upgraded
+	News bool `gorm:"not null;default:false" json:"news"`
+	// DisabledCommands holds the commands turned off in the chat, sorted and
+	// separated by spaces, see IsDisabled
+	DisabledCommands string    `gorm:"not null;default:''" json:"disabled_commands"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// BotPolicy says how quotes treat messages written by bots or sent via
+// inline bots
+type BotPolicy string
+
+const (
+	BotsKeep  BotPolicy = ""      // Quote them like any other message
+	BotsLabel BotPolicy = "label" // Quote them, marked as bot messages
+	BotsSkip  BotPolicy = "skip"  // Leave them out of reply chains
+)
+
+// TableName specifies the table name for ChatSettings
+func (ChatSettings) TableName() string {
+	return "chat_settings"
+}
+
+// Service provides access to chat settings
+type Service struct {
+	db     *gorm.DB
+	events events.Publisher
+}
+
+// NewService creates a new settings service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// WithEvents publishes every save of chat settings
+func (s *Service) WithEvents(publisher events.Publisher) *Service {
+	s.events = publisher
+	return s
+}
+
+// Get returns the settings for a chat.
+// Chats without stored settings get an empty (all defaults) value.
+func (s *Service) Get(ctx context.Context, chatID int64) (*ChatSettings, error) {
+	var cs ChatSettings
+	err := s.db.WithContext(ctx).
+		Where("chat_id = ?", chatID).
+		First(&cs).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &ChatSettings{ChatID: chatID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat settings: %w", err)
+	}
+	return &cs, nil
+}
+
+// Save creates or updates the settings of a chat
+func (s *Service) Save(ctx context.Context, cs *ChatSettings) error {
+	err := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chat_id"}},
+			UpdateAll: true,
+		}).
+		Create(cs).Error
+	if err != nil {
+		return fmt.Errorf("failed to save chat settings: %w", err)
+	}
+	events.Publish(ctx, s.events, events.SettingsChanged, cs.ChatID, cs)
+	return nil
+}
+
+// ClusterChats returns the other chats in the cluster of cs, none when it
+// is not in a cluster
+func (s *Service) ClusterChats(ctx context.Context, cs *ChatSettings) ([]int64, error) {
+	if cs.Cluster == "" {
+		return nil, nil
+	}
+	var ids []int64
+	err := s.db.WithContext(ctx).Model(&ChatSettings{}).
+		Where("cluster = ? AND chat_id <> ?", cs.Cluster, cs.ChatID).
+		Order("chat_id").
+		Pluck("chat_id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster chats: %w", err)
+	}
+	return ids, nil
+}
+
+// NewsChats returns the chats that opted in to what's new after upgrades
+func (s *Service) NewsChats(ctx context.Context) ([]int64, error) {
+	var ids []int64
+	err := s.db.WithContext(ctx).Model(&ChatSettings{}).
+		Where("news").
+		Order("chat_id").
+		Pluck("chat_id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get news chats: %w", err)
+	}
+	return ids, nil
+}
+
+// Location returns the chat time zone, falling back to the language default
+// and finally to UTC.
+func (cs *ChatSettings) Location(fallbackLanguage string) *time.Location {
+	name := cs.Timezone
+	if name == "" {
+		name = LocaleFor(cs.language(fallbackLanguage)).Timezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Layout returns the Go time layout used to print dates in the chat.
+func (cs *ChatSettings) Layout(fallbackLanguage string) string {
+	if cs.DateFormat != "" {
+		return ResolveDateFormat(cs.DateFormat)
+	}
+	return LocaleFor(cs.language(fallbackLanguage)).DateFormat
+}
+
+// CacheRetention returns how long cached messages are kept for the chat.
+// Zero means the global keep duration applies.
+func (cs *ChatSettings) CacheRetention() time.Duration {
+	return time.Duration(cs.CacheRetentionSeconds) * time.Second
+}
+
+// ReplyDelete returns how long transient replies stay in the chat. Zero
+// means they are kept.
+func (cs *ChatSettings) ReplyDelete() time.Duration {
+	return time.Duration(cs.ReplyDeleteSeconds) * time.Second
+}
+
+// QuietHours returns the window during which scheduled posts are held back.
+// Invalid stored values are treated as no quiet hours.
+func (cs *ChatSettings) QuietHours() QuietHours {
+	if cs.QuietHoursWindow == "" {
+		return QuietHours{}
+	}
+	q, err := ParseQuietHours(cs.QuietHoursWindow)
+	if err != nil {
+		return QuietHours{}
+	}
+	return q
+}
+
+// DeferScheduled returns when a post scheduled for t may be sent to the
+// chat, moving it to the end of its quiet hours if needed
+func (cs *ChatSettings) DeferScheduled(t time.Time, fallbackLanguage string) time.Time {
+	return cs.QuietHours().Defer(t, cs.Location(fallbackLanguage))
+}
+
+// Disabled returns the commands turned off in the chat, without the
+// leading slash
+func (cs *ChatSettings) Disabled() []string {
+	return strings.Fields(cs.DisabledCommands)
+}
+
+// IsDisabled reports whether a command, named without the leading slash,
+// is turned off in the chat
+func (cs *ChatSettings) IsDisabled(command string) bool {
+	return slices.Contains(cs.Disabled(), command)
+}
+
+// SetDisabled turns a command off or back on. It returns false when the
+// command already was.
+func (cs *ChatSettings) SetDisabled(command string, disabled bool) bool {
+	commands := cs.Disabled()
+	if slices.Contains(commands, command) == disabled {
+		return false
+	}
+	if disabled {
+		commands = append(commands, command)
+		slices.Sort(commands)
+	} else {
+		commands = slices.DeleteFunc(commands, func(c string) bool { return c == command })
+	}
+	cs.DisabledCommands = strings.Join(commands, " ")
+	return true
+}
+
+// language returns the chat language or the given fallback when unset
+func (cs *ChatSettings) language(fallback string) string {
+	if cs.Language != "" {
+		return cs.Language
+	}
+	return fallback
+}
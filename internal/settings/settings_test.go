@@ -0,0 +1,123 @@
+package settings
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_GetMissingReturnsDefaults(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	service := NewService(db.DB)
+
+	cs, err := service.Get(context.Background(), -100123)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-100123), cs.ChatID)
+	assert.Empty(t, cs.Timezone)
+	assert.Empty(t, cs.DateFormat)
+	assert.False(t, cs.RelativeDates)
+}
+
+func TestService_SaveAndUpdate(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	service := NewService(db.DB)
+	ctx := context.Background()
+
+	require.NoError(t, service.Save(ctx, &ChatSettings{ChatID: -100123, Timezone: "Europe/Madrid"}))
+
+	cs, err := service.Get(ctx, -100123)
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Madrid", cs.Timezone)
+
+	cs.DateFormat = "eu"
+	cs.RelativeDates = true
+	require.NoError(t, service.Save(ctx, cs))
+
+	cs, err = service.Get(ctx, -100123)
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Madrid", cs.Timezone)
+	assert.Equal(t, "eu", cs.DateFormat)
+	assert.True(t, cs.RelativeDates)
+
+	var count int64
+	db.DB.Model(&ChatSettings{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestService_ClusterChats(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	service := NewService(db.DB)
+	ctx := context.Background()
+
+	require.NoError(t, service.Save(ctx, &ChatSettings{ChatID: -100123, Cluster: "friends"}))
+	require.NoError(t, service.Save(ctx, &ChatSettings{ChatID: -100456, Cluster: "friends"}))
+	require.NoError(t, service.Save(ctx, &ChatSettings{ChatID: -100789, Cluster: "work"}))
+	require.NoError(t, service.Save(ctx, &ChatSettings{ChatID: -100999}))
+
+	ids, err := service.ClusterChats(ctx, &ChatSettings{ChatID: -100123, Cluster: "friends"})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{-100456}, ids)
+
+	ids, err = service.ClusterChats(ctx, &ChatSettings{ChatID: -100999})
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestChatSettings_LocationAndLayout(t *testing.T) {
+	tests := []struct {
+		name       string
+		settings   ChatSettings
+		fallback   string
+		wantZone   string
+		wantLayout string
+	}{
+		{"defaults", ChatSettings{}, "", "UTC", "2006-01-02 15:04"},
+		{"language fallback", ChatSettings{}, "es", "Europe/Madrid", "02/01/2006 15:04"},
+		{"chat language wins", ChatSettings{Language: "de"}, "es", "Europe/Berlin", "02.01.2006 15:04"},
+		{"explicit values", ChatSettings{Timezone: "Asia/Tokyo", DateFormat: "us"}, "es", "Asia/Tokyo", "01/02/2006 3:04 PM"},
+		{"invalid zone", ChatSettings{Timezone: "Nowhere/Land"}, "", "UTC", "2006-01-02 15:04"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := tt.settings.Location(tt.fallback)
+			if _, err := time.LoadLocation(tt.wantZone); err != nil {
+				t.Skip("tzdata not available")
+			}
+			assert.Equal(t, tt.wantZone, loc.String())
+			assert.Equal(t, tt.wantLayout, tt.settings.Layout(tt.fallback))
+		})
+	}
+}
+
+func TestMiddleware_DropsDisabledCommands(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	service := NewService(db.DB)
+	ctx := context.Background()
+	require.NoError(t, service.Save(ctx, &ChatSettings{ChatID: -100123, DisabledCommands: "heatmap"}))
+
+	var handled []string
+	handler := Middleware(service, []string{"heatmap", "rquote"}, slog.New(slog.NewTextHandler(io.Discard, nil)))(
+		func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			handled = append(handled, update.Message.Text)
+		},
+	)
+	send := func(chatID int64, text string) {
+		handler(ctx, nil, &models.Update{Message: &models.Message{Chat: models.Chat{ID: chatID}, Text: text}})
+	}
+	send(-100123, "/heatmap")
+	send(-100123, "/heatmap@wanonbot")
+	send(-100123, "/rquote")
+	send(-100123, "hello")
+	send(-100456, "/heatmap")
+
+	assert.Equal(t, []string{"/rquote", "hello", "/heatmap"}, handled)
+}
@@ -0,0 +1,388 @@
+package settings
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/kv"
+)
+
+// wizardCallbackPrefix prefixes the callback data of the settings menu
+const wizardCallbackPrefix = "settings:"
+
+// wizardStartData is the callback data of the button opening the menu
+const wizardStartData = wizardCallbackPrefix + "start"
+
+// wizardTTL is how long an open settings menu keeps its changes since the
+// last button pressed
+const wizardTTL = 15 * time.Minute
+
+// wizardOption is a button setting a key to a value
+type wizardOption struct {
+	label string
+	key   string
+	value string
+}
+
+// wizardStep is a page of the settings menu
+type wizardStep struct {
+	title   string
+	help    string
+	options [][]wizardOption // Rows of buttons
+}
+
+// wizardSteps are the pages of the settings menu, in order. Settings the
+// menu leaves out are still changed with /settings <key> <value>.
+var wizardSteps = []wizardStep{
+	{
+		title: "Language",
+		help:  "The language of the bot, which also sets the default time zone and date format.",
+		options: [][]wizardOption{
+			{{"English", "language", "en"}, {"Español", "language", "es"}, {"Català", "language", "ca"}},
+			{{"Français", "language", "fr"}, {"Deutsch", "language", "de"}, {"Italiano", "language", "it"}},
+			{{"Português", "language", "pt"}, {"Português (BR)", "language", "pt-br"}, {"Automatic", "language", "default"}},
+		},
+	},
+	{
+		title: "Schedule",
+		help:  "Quiet hours hold back scheduled posts until they end, in the chat time zone.",
+		options: [][]wizardOption{
+			{{"No quiet hours", "quiet", "off"}},
+			{{"22:00-08:00", "quiet", "22:00-08:00"}, {"23:00-07:00", "quiet", "23:00-07:00"}, {"00:00-08:00", "quiet", "00:00-08:00"}},
+		},
+	},
+	{
+		title: "Retention",
+		help:  "How long messages stay cached, and so can be quoted with /addquote.",
+		options: [][]wizardOption{
+			{{"Bot default", "cache", "default"}, {"1 day", "cache", "1d"}},
+			{{"3 days", "cache", "3d"}, {"7 days", "cache", "7d"}, {"30 days", "cache", "30d"}},
+		},
+	},
+	{
+		title: "Render format",
+		help:  "How quotes show their dates.",
+		options: [][]wizardOption{
+			{{"Language default", "dateformat", "default"}, {"2006-01-02", "dateformat", "iso"}},
+			{{"02/01/2006", "dateformat", "eu"}, {"01/02/2006", "dateformat", "us"}, {"2 January 2006", "dateformat", "long"}},
+			{{"Exact dates", "relative", "off"}, {"\"3 years ago\"", "relative", "on"}},
+		},
+	},
+}
+
+// wizardSession is an open settings menu: who opened it, the page shown and
+// the changes chosen so far, saved only at the end
+type wizardSession struct {
+	ChatID  int64             `json:"chat_id"`
+	UserID  int64             `json:"user_id"`
+	Step    int               `json:"step"` // len(wizardSteps) is the summary
+	Changes map[string]string `json:"changes"`
+}
+
+// WithStore keeps open settings menus in a store shared by every replica,
+// so any of them takes the next button. Nil keeps them in process.
+func (h *Handler) WithStore(store kv.Store) *Handler {
+	if store != nil {
+		h.sessions = store
+	}
+	return h
+}
+
+// settingsKeyboard is the button under /settings opening the menu
+func settingsKeyboard() *models.InlineKeyboardMarkup {
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{
+		{Text: "⚙️ Change settings", CallbackData: wizardStartData},
+	}}}
+}
+
+// HandleCallback processes the buttons of the settings menu: opening it,
+// picking options, moving between pages, cancelling and saving. Only chat
+// administrators open it, and only the one who did can use it.
+func (h *Handler) HandleCallback(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil {
+		return nil
+	}
+	message := query.Message.Message
+
+	if query.Data == wizardStartData {
+		return h.start(ctx, b, query, message)
+	}
+
+	token, action, _ := strings.Cut(strings.TrimPrefix(query.Data, wizardCallbackPrefix), ":")
+	session, ok, err := h.session(ctx, token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return h.finish(ctx, b, query, message, "This settings menu expired, send /settings again.")
+	}
+	if session.UserID != query.From.ID {
+		return h.alert(ctx, b, query, "Only the administrator who opened this menu can use it.")
+	}
+
+	switch {
+	case action == "cancel":
+		if err := h.sessions.Delete(ctx, wizardKey(token)); err != nil {
+			return err
+		}
+		return h.finish(ctx, b, query, message, "Settings unchanged.")
+	case action == "save":
+		// Another replica may have taken it in between
+		if _, ok, err := h.sessions.Take(ctx, wizardKey(token)); err != nil || !ok {
+			return err
+		}
+		return h.save(ctx, b, query, message, session)
+	case action == "back":
+		session.Step = max(session.Step-1, 0)
+	case action == "next":
+		session.Step = min(session.Step+1, len(wizardSteps))
+	case strings.HasPrefix(action, "pick:"):
+		option, ok := pickedOption(session.Step, strings.TrimPrefix(action, "pick:"))
+		if !ok {
+			return h.alert(ctx, b, query, "That option is no longer available.")
+		}
+		cs, err := h.service.Get(ctx, session.ChatID)
+		if err != nil {
+			return err
+		}
+		// Picking what the chat already has drops the change
+		if strings.EqualFold(wizardValue(cs, option.key), option.value) {
+			delete(session.Changes, option.key)
+		} else {
+			session.Changes[option.key] = option.value
+		}
+	default:
+		return nil
+	}
+
+	if err := h.keep(ctx, token, session); err != nil {
+		return err
+	}
+	return h.show(ctx, b, query, message, token, session)
+}
+
+// start opens the menu on the /settings message for an administrator
+func (h *Handler) start(ctx context.Context, b *bot.Bot, query *models.CallbackQuery, message *models.Message) error {
+	admin, err := h.admins.IsAdmin(ctx, b, message.Chat, query.From.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check admin status: %w", err)
+	}
+	if !admin {
+		return h.alert(ctx, b, query, "Only chat administrators can change settings.")
+	}
+
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("failed to generate settings menu token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+	session := &wizardSession{ChatID: message.Chat.ID, UserID: query.From.ID, Changes: map[string]string{}}
+	if err := h.keep(ctx, token, session); err != nil {
+		return err
+	}
+	slog.Info("opened settings menu", "chat_id", message.Chat.ID, "user_id", query.From.ID)
+	return h.show(ctx, b, query, message, token, session)
+}
+
+// save applies the chosen changes and shows the resulting settings
+func (h *Handler) save(ctx context.Context, b *bot.Bot, query *models.CallbackQuery, message *models.Message, session *wizardSession) error {
+	if len(session.Changes) == 0 {
+		return h.finish(ctx, b, query, message, "Settings unchanged.")
+	}
+	cs, err := h.service.Get(ctx, session.ChatID)
+	if err != nil {
+		return err
+	}
+	for _, key := range slices.Sorted(maps.Keys(session.Changes)) {
+		if err := Apply(cs, key, session.Changes[key]); err != nil {
+			return h.finish(ctx, b, query, message, err.Error())
+		}
+	}
+	if err := h.service.Save(ctx, cs); err != nil {
+		return err
+	}
+	slog.Info("settings changed from the menu", "audit", true, "chat_id", session.ChatID, "user_id", query.From.ID, "changes", session.Changes)
+	return h.finish(ctx, b, query, message, "Settings updated.\n\n"+Describe(cs, query.From.LanguageCode))
+}
+
+// show answers the callback and turns the message into the session's page
+func (h *Handler) show(ctx context.Context, b *bot.Bot, query *models.CallbackQuery, message *models.Message, token string, session *wizardSession) error {
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID}); err != nil {
+		return err
+	}
+	cs, err := h.service.Get(ctx, session.ChatID)
+	if err != nil {
+		return err
+	}
+	text, keyboard := wizardPage(cs, session, token)
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      message.Chat.ID,
+		MessageID:   message.ID,
+		Text:        text,
+		ReplyMarkup: keyboard,
+	})
+	return err
+}
+
+// finish answers the callback and replaces the menu with text
+func (h *Handler) finish(ctx context.Context, b *bot.Bot, query *models.CallbackQuery, message *models.Message, text string) error {
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID}); err != nil {
+		return err
+	}
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    message.Chat.ID,
+		MessageID: message.ID,
+		Text:      text,
+	})
+	return err
+}
+
+// alert answers the callback with a popup, leaving the menu as is
+func (h *Handler) alert(ctx context.Context, b *bot.Bot, query *models.CallbackQuery, text string) error {
+	_, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: query.ID,
+		Text:            text,
+		ShowAlert:       true,
+	})
+	return err
+}
+
+// session returns the open menu of a token
+func (h *Handler) session(ctx context.Context, token string) (*wizardSession, bool, error) {
+	value, ok, err := h.sessions.Get(ctx, wizardKey(token))
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	var session wizardSession
+	if err := json.Unmarshal(value, &session); err != nil {
+		return nil, false, fmt.Errorf("invalid settings menu session: %w", err)
+	}
+	if session.Changes == nil {
+		session.Changes = map[string]string{}
+	}
+	return &session, true, nil
+}
+
+// keep stores an open menu for another wizardTTL
+func (h *Handler) keep(ctx context.Context, token string, session *wizardSession) error {
+	value, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err := h.sessions.Set(ctx, wizardKey(token), value, wizardTTL); err != nil {
+		return fmt.Errorf("failed to store the settings menu: %w", err)
+	}
+	return nil
+}
+
+// wizardKey is the store key of an open menu
+func wizardKey(token string) string {
+	return wizardCallbackPrefix + "wizard:" + token
+}
+
+// pickedOption returns the option of a step by its position, counted
+// across the rows
+func pickedOption(step int, index string) (wizardOption, bool) {
+	if step < 0 || step >= len(wizardSteps) {
+		return wizardOption{}, false
+	}
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		return wizardOption{}, false
+	}
+	options := slices.Concat(wizardSteps[step].options...)
+	if i < 0 || i >= len(options) {
+		return wizardOption{}, false
+	}
+	return options[i], true
+}
+
+// wizardPage renders a page of the menu: the options of a step, the one in
+// effect marked, or the summary of the changes before saving
+func wizardPage(cs *ChatSettings, session *wizardSession, token string) (string, *models.InlineKeyboardMarkup) {
+	data := func(action string) string { return wizardCallbackPrefix + token + ":" + action }
+	back := models.InlineKeyboardButton{Text: "« Back", CallbackData: data("back")}
+	cancel := models.InlineKeyboardButton{Text: "✖ Cancel", CallbackData: data("cancel")}
+
+	if session.Step >= len(wizardSteps) {
+		var sb strings.Builder
+		if len(session.Changes) == 0 {
+			sb.WriteString("Nothing changed yet.")
+		} else {
+			sb.WriteString("Save these changes?\n")
+			for _, key := range slices.Sorted(maps.Keys(session.Changes)) {
+				fmt.Fprintf(&sb, "\n%s: %s → %s", key, wizardValue(cs, key), session.Changes[key])
+			}
+		}
+		return sb.String(), &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{back, {Text: "✔ Save", CallbackData: data("save")}},
+			{cancel},
+		}}
+	}
+
+	step := wizardSteps[session.Step]
+	text := fmt.Sprintf("⚙️ Settings, step %d of %d: %s\n\n%s", session.Step+1, len(wizardSteps), step.title, step.help)
+	var rows [][]models.InlineKeyboardButton
+	i := 0
+	for _, options := range step.options {
+		row := make([]models.InlineKeyboardButton, 0, len(options))
+		for _, option := range options {
+			label := option.label
+			chosen, changed := session.Changes[option.key]
+			if !changed {
+				chosen = wizardValue(cs, option.key)
+			}
+			if strings.EqualFold(chosen, option.value) {
+				label = "✓ " + label
+			}
+			row = append(row, models.InlineKeyboardButton{Text: label, CallbackData: data("pick:" + strconv.Itoa(i))})
+			i++
+		}
+		rows = append(rows, row)
+	}
+	nav := []models.InlineKeyboardButton{}
+	if session.Step > 0 {
+		nav = append(nav, back)
+	}
+	nav = append(nav, cancel, models.InlineKeyboardButton{Text: "Next »", CallbackData: data("next")})
+	rows = append(rows, nav)
+	return text, &models.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// wizardValue is the value a setting the menu changes has in the chat, as
+// its options name it
+func wizardValue(cs *ChatSettings, key string) string {
+	switch key {
+	case "language":
+		return orValue(cs.Language, "default")
+	case "quiet":
+		return orValue(cs.QuietHoursWindow, "off")
+	case "cache":
+		return orValue(formatRetention(cs.CacheRetention()), "default")
+	case "dateformat":
+		return orValue(cs.DateFormat, "default")
+	case "relative":
+		return onOff(cs.RelativeDates)
+	}
+	return ""
+}
+
+// orValue returns value, or fallback when it is empty
+func orValue(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
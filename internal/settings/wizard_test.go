@@ -0,0 +1,152 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickedOption(t *testing.T) {
+	option, ok := pickedOption(0, "1")
+	require.True(t, ok)
+	assert.Equal(t, wizardOption{"Español", "language", "es"}, option)
+
+	// Counted across the rows
+	option, ok = pickedOption(3, "6")
+	require.True(t, ok)
+	assert.Equal(t, wizardOption{"\"3 years ago\"", "relative", "on"}, option)
+
+	_, ok = pickedOption(0, "99")
+	assert.False(t, ok)
+	_, ok = pickedOption(0, "x")
+	assert.False(t, ok)
+	_, ok = pickedOption(len(wizardSteps), "0")
+	assert.False(t, ok, "the summary has no options")
+}
+
+func TestWizardPage(t *testing.T) {
+	cs := &ChatSettings{ChatID: -100123, Language: "es"}
+	session := &wizardSession{Changes: map[string]string{}}
+
+	text, keyboard := wizardPage(cs, session, "abc")
+	assert.Contains(t, text, "step 1 of 4: Language")
+	assert.Equal(t, "✓ Español", keyboard.InlineKeyboard[0][1].Text)
+	assert.Equal(t, "settings:abc:pick:1", keyboard.InlineKeyboard[0][1].CallbackData)
+	nav := keyboard.InlineKeyboard[len(keyboard.InlineKeyboard)-1]
+	require.Len(t, nav, 2, "no back button on the first page")
+	assert.Equal(t, "settings:abc:cancel", nav[0].CallbackData)
+	assert.Equal(t, "settings:abc:next", nav[1].CallbackData)
+
+	// A pending change is marked instead of the saved value
+	session.Changes["language"] = "fr"
+	_, keyboard = wizardPage(cs, session, "abc")
+	assert.Equal(t, "Español", keyboard.InlineKeyboard[0][1].Text)
+	assert.Equal(t, "✓ Français", keyboard.InlineKeyboard[1][0].Text)
+
+	session.Step = 2
+	_, keyboard = wizardPage(cs, session, "abc")
+	assert.Equal(t, "✓ Bot default", keyboard.InlineKeyboard[0][0].Text)
+	assert.Len(t, keyboard.InlineKeyboard[len(keyboard.InlineKeyboard)-1], 3)
+
+	session.Step = len(wizardSteps)
+	text, keyboard = wizardPage(cs, session, "abc")
+	assert.Equal(t, "Save these changes?\n\nlanguage: es → fr", text)
+	assert.Equal(t, "settings:abc:save", keyboard.InlineKeyboard[0][1].CallbackData)
+}
+
+func TestHandler_Wizard(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	handler := NewHandler(h.DB.DB)
+	h.Register(handler)
+	h.RegisterCallback(wizardCallbackPrefix, testutils.HandlerFunc(handler.HandleCallback))
+	ctx := context.Background()
+	const chatID = -100123
+
+	h.SendText(chatID, "/settings")
+	assert.Contains(t, h.Requests("sendMessage")[0].Params["reply_markup"], wizardStartData)
+	menu := &models.Message{ID: 1, Chat: models.Chat{ID: chatID, Type: models.ChatTypeSupergroup}}
+
+	// Members cannot open the menu
+	h.Press(menu, wizardStartData)
+	assert.Equal(t, "Only chat administrators can change settings.", h.Requests("answerCallbackQuery")[0].Params["text"])
+	assert.Empty(t, h.Requests("editMessageText"))
+
+	h.SetAdmin(chatID, h.User.ID)
+	h.Press(menu, wizardStartData)
+	edits := h.Requests("editMessageText")
+	require.Len(t, edits, 1)
+	assert.Contains(t, edits[0].Params["text"], "Language")
+	token := tokenOf(t, edits[0].Params["reply_markup"])
+
+	// Pick Deutsch, skip to the retention page, pick 7 days and save
+	h.Press(menu, "settings:"+token+":pick:4")
+	h.Press(menu, "settings:"+token+":next")
+	h.Press(menu, "settings:"+token+":next")
+	h.Press(menu, "settings:"+token+":pick:3")
+	h.Press(menu, "settings:"+token+":next")
+	h.Press(menu, "settings:"+token+":next")
+	edits = h.Requests("editMessageText")
+	assert.Equal(t, "Save these changes?\n\ncache: default → 7d\nlanguage: default → de", edits[len(edits)-1].Params["text"])
+
+	// Nothing is saved before the end
+	cs, err := handler.service.Get(ctx, chatID)
+	require.NoError(t, err)
+	assert.Empty(t, cs.Language)
+
+	h.Press(menu, "settings:"+token+":save")
+	cs, err = handler.service.Get(ctx, chatID)
+	require.NoError(t, err)
+	assert.Equal(t, "de", cs.Language)
+	assert.Equal(t, "7d", formatRetention(cs.CacheRetention()))
+
+	// The menu is gone once saved
+	h.Press(menu, "settings:"+token+":next")
+	edits = h.Requests("editMessageText")
+	assert.Equal(t, "This settings menu expired, send /settings again.", edits[len(edits)-1].Params["text"])
+}
+
+func TestHandler_WizardCancel(t *testing.T) {
+	h := testutils.NewBotHarness(t)
+	handler := NewHandler(h.DB.DB)
+	h.RegisterCallback(wizardCallbackPrefix, testutils.HandlerFunc(handler.HandleCallback))
+	const chatID = -100123
+	h.SetAdmin(chatID, h.User.ID)
+	menu := &models.Message{ID: 1, Chat: models.Chat{ID: chatID, Type: models.ChatTypeSupergroup}}
+
+	h.Press(menu, wizardStartData)
+	token := tokenOf(t, h.Requests("editMessageText")[0].Params["reply_markup"])
+	h.Press(menu, "settings:"+token+":pick:1")
+
+	// Only who opened the menu can use it
+	owner := h.User
+	h.User = &models.User{ID: 2002, FirstName: "Bob"}
+	h.Press(menu, "settings:"+token+":cancel")
+	answers := h.Requests("answerCallbackQuery")
+	assert.Equal(t, "Only the administrator who opened this menu can use it.", answers[len(answers)-1].Params["text"])
+
+	h.User = owner
+	h.Press(menu, "settings:"+token+":cancel")
+	edits := h.Requests("editMessageText")
+	assert.Equal(t, "Settings unchanged.", edits[len(edits)-1].Params["text"])
+	cs, err := handler.service.Get(context.Background(), chatID)
+	require.NoError(t, err)
+	assert.Empty(t, cs.Language)
+}
+
+// tokenOf returns the session token in the callback data of a menu's
+// keyboard
+func tokenOf(t *testing.T, keyboard string) string {
+	t.Helper()
+	var markup models.InlineKeyboardMarkup
+	require.NoError(t, json.Unmarshal([]byte(keyboard), &markup))
+	data := markup.InlineKeyboard[0][0].CallbackData
+	token, _, ok := strings.Cut(strings.TrimPrefix(data, wizardCallbackPrefix), ":")
+	require.True(t, ok, data)
+	return token
+}
@@ -0,0 +1,105 @@
+// Package startup runs the server startup as explicit stages, each with its
+// own timeout, so a failed start tells which dependency it waited for.
+package startup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// The stages of the server startup, in order
+const (
+	StageConfig     = "config"
+	StageDatabase   = "database"
+	StageMigrations = "migrations"
+	StageTelegram   = "telegram"
+	StageComponents = "components"
+)
+
+// Stage is a step of the startup
+type Stage struct {
+	Name string
+	// Timeout bounds the stage; zero waits until the startup is cancelled
+	Timeout time.Duration
+	// Skip leaves the stage out, e.g. the Telegram check when developing
+	// offline
+	Skip bool
+	Run  func(ctx context.Context) error
+}
+
+// StageError is a startup that failed at a stage
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("startup failed at stage %s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Fail wraps the error of a stage, nil for nil
+func Fail(stage string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StageError{Stage: stage, Err: err}
+}
+
+// Run runs the stages in order and stops at the first one failing or timing
+// out. A stage still blocked when its timeout passes, such as a connection
+// that ignores its context, is left behind: the startup is failing anyway.
+func Run(ctx context.Context, logger *slog.Logger, stages ...Stage) error {
+	for _, stage := range stages {
+		if stage.Skip {
+			logger.Warn("startup stage skipped", "stage", stage.Name)
+			continue
+		}
+		start := time.Now()
+		if err := run(ctx, stage); err != nil {
+			return Fail(stage.Name, err)
+		}
+		logger.Info("startup stage completed", "stage", stage.Name, "duration", time.Since(start))
+	}
+	return nil
+}
+
+// run runs a stage within its timeout
+func run(ctx context.Context, stage Stage) error {
+	if stage.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, stage.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- stage.Run(ctx)
+	}()
+	select {
+	case err := <-done:
+		return timedOut(ctx, stage, err)
+	case <-ctx.Done():
+		// The stage may have given up at the same time
+		select {
+		case err := <-done:
+			return timedOut(ctx, stage, err)
+		default:
+		}
+		return timedOut(ctx, stage, ctx.Err())
+	}
+}
+
+// timedOut tells the error of a stage was its timeout passing
+func timedOut(ctx context.Context, stage Stage, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", stage.Timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestRun_InOrder(t *testing.T) {
+	var ran []string
+	stage := func(name string) Stage {
+		return Stage{Name: name, Run: func(context.Context) error {
+			ran = append(ran, name)
+			return nil
+		}}
+	}
+	skipped := stage(StageTelegram)
+	skipped.Skip = true
+
+	err := Run(context.Background(), discard(), stage(StageDatabase), stage(StageMigrations), skipped, stage(StageComponents))
+	require.NoError(t, err)
+	assert.Equal(t, []string{StageDatabase, StageMigrations, StageComponents}, ran)
+}
+
+func TestRun_StopsAtFailedStage(t *testing.T) {
+	refused := errors.New("connection refused")
+	later := false
+	err := Run(context.Background(), discard(),
+		Stage{Name: StageDatabase, Run: func(context.Context) error { return refused }},
+		Stage{Name: StageMigrations, Run: func(context.Context) error { later = true; return nil }},
+	)
+
+	var stageErr *StageError
+	require.ErrorAs(t, err, &stageErr)
+	assert.Equal(t, StageDatabase, stageErr.Stage)
+	assert.ErrorIs(t, err, refused)
+	assert.Equal(t, "startup failed at stage database: connection refused", err.Error())
+	assert.False(t, later)
+}
+
+func TestRun_Timeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	start := time.Now()
+	err := Run(context.Background(), discard(),
+		// Ignores its context, like a connection without one
+		Stage{Name: StageTelegram, Timeout: 20 * time.Millisecond, Run: func(context.Context) error {
+			<-block
+			return nil
+		}},
+	)
+	require.Error(t, err)
+	assert.Equal(t, "startup failed at stage telegram: timed out after 20ms: context deadline exceeded", err.Error())
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRun_TimeoutHonouredByStage(t *testing.T) {
+	err := Run(context.Background(), discard(),
+		Stage{Name: StageMigrations, Timeout: 10 * time.Millisecond, Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "startup failed at stage migrations: timed out after 10ms")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestFail(t *testing.T) {
+	assert.NoError(t, Fail(StageComponents, nil))
+	err := Fail(StageConfig, errors.New("invalid yaml"))
+	assert.Equal(t, "startup failed at stage config: invalid yaml", err.Error())
+}
@@ -2,19 +2,23 @@ package storage
 
 import (
 	"fmt"
+	"log/slog"
 
 	"github.com/graffic/wanon-go/internal/config"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
 )
 
 // DB holds the database connection
 type DB struct {
 	*gorm.DB
+	replicas *Replicas
 }
 
-// New creates a new database connection
+// New creates a new database connection, with the read replicas of the
+// config if any
 func New(cfg *config.DatabaseConfig) (*DB, error) {
 	gormConfig := &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
@@ -24,8 +28,18 @@ func New(cfg *config.DatabaseConfig) (*DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+	if len(cfg.Replicas) == 0 {
+		return &DB{DB: db}, nil
+	}
 
-	return &DB{db}, nil
+	replicas, err := openReplicas(db, cfg.Replicas, slog.Default())
+	if err != nil {
+		if sqlDB, dbErr := db.DB(); dbErr == nil {
+			sqlDB.Close()
+		}
+		return nil, err
+	}
+	return &DB{DB: db, replicas: replicas}, nil
 }
 
 // NewWithLogger creates a new database connection with custom logger level
@@ -39,11 +53,30 @@ func NewWithLogger(cfg *config.DatabaseConfig, logLevel logger.LogLevel) (*DB, e
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	return &DB{db}, nil
+	return &DB{DB: db}, nil
 }
 
-// Close closes the database connection
+// Reads returns the database for heavy reads, which go to the read
+// replicas when there are any. Writes through it still go to the primary.
+// Replicas lag behind the primary, so it is not meant for reading back what
+// was just written.
+func (db *DB) Reads() *gorm.DB {
+	if db.replicas == nil {
+		return db.DB
+	}
+	return db.DB.Clauses(dbresolver.Use(replicaResolver)).Session(&gorm.Session{})
+}
+
+// Replicas returns the read replicas, nil without any
+func (db *DB) Replicas() *Replicas {
+	return db.replicas
+}
+
+// Close closes the database connection and those of the replicas
 func (db *DB) Close() error {
+	if db.replicas != nil {
+		db.replicas.Close()
+	}
 	sqlDB, err := db.DB.DB()
 	if err != nil {
 		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
@@ -1,36 +1,84 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
-	"os/exec"
 
 	"github.com/graffic/wanon-go/internal/config"
+	"github.com/graffic/wanon-go/internal/migrate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
-func RunMigrations(cfg *config.DatabaseConfig) error {
+// MigrationsDir is where the bot's migrations are read from
+const MigrationsDir = "./migrations"
+
+// RunMigrations applies the bot's migrations not applied yet
+func RunMigrations(ctx context.Context, cfg *config.DatabaseConfig) error {
 	slog.Info("running database migrations")
+	if err := runMigrations(ctx, cfg, os.DirFS(MigrationsDir), migrate.DefaultVersionTable); err != nil {
+		return err
+	}
+	slog.Info("migrations completed successfully")
+	return nil
+}
 
-	// Build connection string from config
-	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Host,
-		cfg.Port,
-		cfg.User,
-		cfg.Password,
-		cfg.Database,
-		cfg.SSLMode,
-	)
-
-	// Run tern migrate using full path
-	cmd := exec.Command("tern", "migrate", "--conn-string", connStr, "--migrations", "./migrations")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to run migrations: %w", err)
+// RunPluginMigrations runs the migrations of a plugin, tracked in the
+// schema_version_<name> table so they are numbered apart from the bot's
+func RunPluginMigrations(ctx context.Context, cfg *config.DatabaseConfig, name string, migrations fs.FS) error {
+	slog.Info("running plugin migrations", "plugin", name)
+	if err := runMigrations(ctx, cfg, migrations, migrate.DefaultVersionTable+"_"+name); err != nil {
+		return fmt.Errorf("plugin %s: %w", name, err)
 	}
+	return nil
+}
 
-	slog.Info("migrations completed successfully")
+// runMigrations applies the migrations in fsys, recording the version in
+// versionTable. It stops when ctx is done.
+func runMigrations(ctx context.Context, cfg *config.DatabaseConfig, fsys fs.FS, versionTable string) error {
+	migrations, err := migrate.Load(fsys)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	db, err := NewWithLogger(cfg, logger.Silent)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+
+	if err := migrate.New(sqlDB, migrations, versionTable).Migrate(ctx); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
 	return nil
 }
+
+// LatestMigration returns the highest migration number in dir, taken from
+// file names such as 003_create_chat_settings.sql
+func LatestMigration(dir string) (int, error) {
+	migrations, err := migrate.Load(os.DirFS(dir))
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, fmt.Errorf("no migrations found in %s", dir)
+	}
+	return len(migrations), nil
+}
+
+// MigrationVersion returns the migration version applied to the database,
+// as recorded by tern
+func MigrationVersion(ctx context.Context, db *gorm.DB) (int, error) {
+	var version int
+	if err := db.WithContext(ctx).Raw("SELECT version FROM schema_version").Scan(&version).Error; err != nil {
+		return 0, fmt.Errorf("failed to read migration version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// replicaResolver names the read replicas in dbresolver. Only queries
+// asking for it go to the replicas; everything else stays on the primary.
+const replicaResolver = "replicas"
+
+// replicaPingTimeout is how long a replica has to answer a health check
+const replicaPingTimeout = 5 * time.Second
+
+// Replicas are read replicas of the primary database. Heavy reads, such as
+// /history searches, statistics and exports, go to a healthy replica in
+// turn, and to the primary when none is. Writes always go to the primary.
+type Replicas struct {
+	primary gorm.ConnPool
+	pools   []*sql.DB
+	healthy []atomic.Bool
+	next    atomic.Uint64
+	logger  *slog.Logger
+}
+
+// openReplicas connects to the replicas and routes the queries asking for
+// them through dbresolver
+func openReplicas(db *gorm.DB, dsns []string, logger *slog.Logger) (*Replicas, error) {
+	r := &Replicas{
+		primary: db.Config.ConnPool,
+		healthy: make([]atomic.Bool, len(dsns)),
+		logger:  logger,
+	}
+	dialectors := make([]gorm.Dialector, len(dsns))
+	for i, dsn := range dsns {
+		pool, err := sql.Open("pgx", dsn)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("failed to open replica %d: %w", i+1, err)
+		}
+		r.pools = append(r.pools, pool)
+		r.healthy[i].Store(true)
+		dialectors[i] = postgres.New(postgres.Config{Conn: pool})
+	}
+	err := db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: dialectors,
+		Policy:   r,
+	}, replicaResolver))
+	if err != nil {
+		r.Close()
+		return nil, fmt.Errorf("failed to register replicas: %w", err)
+	}
+	return r, nil
+}
+
+// Resolve picks the replica of a read: the healthy ones in turn, or the
+// primary when every replica is down
+func (r *Replicas) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	start := r.next.Add(1)
+	for i := range pools {
+		n := int((start + uint64(i)) % uint64(len(pools)))
+		if n < len(r.healthy) && r.healthy[n].Load() {
+			return pools[n]
+		}
+	}
+	return r.primary
+}
+
+// Healthy returns how many replicas passed their last health check
+func (r *Replicas) Healthy() int {
+	healthy := 0
+	for i := range r.healthy {
+		if r.healthy[i].Load() {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// Check pings every replica, taking those that fail out of the rotation
+// until they answer again. Replicas are named by their position in the
+// config, as their DSNs hold passwords.
+func (r *Replicas) Check(ctx context.Context) {
+	for i, pool := range r.pools {
+		pingCtx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+		err := pool.PingContext(pingCtx)
+		cancel()
+		was := r.healthy[i].Swap(err == nil)
+		switch {
+		case err != nil && was:
+			r.logger.Warn("read replica down, reading from the others or the primary", "replica", i+1, "error", err)
+		case err == nil && !was:
+			r.logger.Info("read replica back", "replica", i+1)
+		}
+	}
+}
+
+// Start checks the replicas every interval until ctx is done
+func (r *Replicas) Start(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		r.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the connections to the replicas
+func (r *Replicas) Close() error {
+	var first error
+	for _, pool := range r.pools {
+		if err := pool.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakePool is a connection pool told apart by its name
+type fakePool struct {
+	gorm.ConnPool
+	name string
+}
+
+func newTestReplicas(n int) (*Replicas, []gorm.ConnPool) {
+	r := &Replicas{
+		primary: &fakePool{name: "primary"},
+		healthy: make([]atomic.Bool, n),
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	pools := make([]gorm.ConnPool, n)
+	for i := range pools {
+		r.healthy[i].Store(true)
+		pools[i] = &fakePool{name: string(rune('a' + i))}
+	}
+	return r, pools
+}
+
+func poolName(pool gorm.ConnPool) string {
+	return pool.(*fakePool).name
+}
+
+func TestReplicas_Resolve(t *testing.T) {
+	r, pools := newTestReplicas(3)
+
+	seen := map[string]int{}
+	for range 6 {
+		seen[poolName(r.Resolve(pools))]++
+	}
+	assert.Equal(t, map[string]int{"a": 2, "b": 2, "c": 2}, seen, "healthy replicas in turn")
+
+	r.healthy[1].Store(false)
+	seen = map[string]int{}
+	for range 6 {
+		seen[poolName(r.Resolve(pools))]++
+	}
+	assert.Zero(t, seen["b"], "replicas down are skipped")
+	assert.Equal(t, 2, r.Healthy())
+
+	r.healthy[0].Store(false)
+	r.healthy[2].Store(false)
+	assert.Equal(t, "primary", poolName(r.Resolve(pools)), "the primary when every replica is down")
+}
+
+func TestReplicas_Check(t *testing.T) {
+	// Nothing listens on port 1, so the ping fails at once
+	pool, err := sql.Open("pgx", "host=127.0.0.1 port=1 user=wanon dbname=wanon sslmode=disable connect_timeout=1")
+	require.NoError(t, err)
+	r, _ := newTestReplicas(1)
+	r.pools = []*sql.DB{pool}
+	defer r.Close()
+
+	r.Check(context.Background())
+	assert.Equal(t, 0, r.Healthy())
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Unit is a unit of work: the writes a command makes to several stores,
+// committed together in one transaction. Side effects outside the
+// database, such as sending the reply, wait for the commit.
+type Unit struct {
+	tx          *gorm.DB
+	afterCommit []func(ctx context.Context) error
+}
+
+// Atomic runs fn in a new unit of work on db. The writes made through the
+// unit are committed if fn returns nil and rolled back otherwise. After a
+// commit the functions given to AfterCommit run in order; their errors are
+// returned joined, but the writes stay committed. Units do not nest:
+// stores taking part get the unit itself.
+func Atomic(ctx context.Context, db *gorm.DB, fn func(u *Unit) error) error {
+	u := &Unit{}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		u.tx = tx
+		return fn(u)
+	})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, f := range u.afterCommit {
+		if err := f(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DB returns the transaction of the unit, for stores to write through
+func (u *Unit) DB() *gorm.DB {
+	return u.tx
+}
+
+// AfterCommit defers f until the unit is committed. It is dropped if the
+// unit is rolled back.
+func (u *Unit) AfterCommit(f func(ctx context.Context) error) {
+	u.afterCommit = append(u.afterCommit, f)
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unitRow is a table written in units of work
+type unitRow struct {
+	ID   uint
+	Name string
+}
+
+func TestAtomic(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	require.NoError(t, db.DB.AutoMigrate(&unitRow{}))
+	ctx := context.Background()
+
+	var ran []string
+	err := Atomic(ctx, db.DB, func(u *Unit) error {
+		u.AfterCommit(func(ctx context.Context) error {
+			ran = append(ran, "first")
+			return nil
+		})
+		require.NoError(t, u.DB().Create(&unitRow{Name: "a"}).Error)
+		require.NoError(t, u.DB().Create(&unitRow{Name: "b"}).Error)
+		u.AfterCommit(func(ctx context.Context) error {
+			ran = append(ran, "second")
+			return nil
+		})
+		assert.Empty(t, ran, "nothing runs before the commit")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, ran)
+
+	var count int64
+	require.NoError(t, db.DB.Model(&unitRow{}).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestAtomic_RollsBack(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	require.NoError(t, db.DB.AutoMigrate(&unitRow{}))
+	failed := errors.New("later step failed")
+
+	ran := false
+	err := Atomic(context.Background(), db.DB, func(u *Unit) error {
+		require.NoError(t, u.DB().Create(&unitRow{Name: "a"}).Error)
+		u.AfterCommit(func(ctx context.Context) error {
+			ran = true
+			return nil
+		})
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	assert.False(t, ran)
+
+	var count int64
+	require.NoError(t, db.DB.Model(&unitRow{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestAtomic_AfterCommitErrors(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	require.NoError(t, db.DB.AutoMigrate(&unitRow{}))
+	sendFailed := errors.New("send failed")
+
+	err := Atomic(context.Background(), db.DB, func(u *Unit) error {
+		u.AfterCommit(func(ctx context.Context) error { return sendFailed })
+		return u.DB().Create(&unitRow{Name: "a"}).Error
+	})
+	assert.ErrorIs(t, err, sendFailed)
+
+	var count int64
+	require.NoError(t, db.DB.Model(&unitRow{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count, "the writes stay committed")
+}
@@ -0,0 +1,136 @@
+// Package systemd tells systemd how the server is doing through the
+// sd_notify protocol: when it is ready, that it is alive for the watchdog
+// and when it is stopping. Outside systemd, or in services without
+// Type=notify, every call is a no-op.
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// The states sent to systemd
+const (
+	StateReady    = "READY=1"
+	StateStopping = "STOPPING=1"
+	StateWatchdog = "WATCHDOG=1"
+)
+
+// Notifier sends states to the socket systemd gives the service
+type Notifier struct {
+	socket   string        // Empty outside systemd
+	watchdog time.Duration // Zero without a watchdog
+	logger   *slog.Logger
+}
+
+// New creates a notifier for a socket and watchdog timeout; an empty socket
+// or a zero timeout turns them off
+func New(socket string, watchdog time.Duration, logger *slog.Logger) *Notifier {
+	return &Notifier{socket: socket, watchdog: watchdog, logger: logger}
+}
+
+// FromEnv creates a notifier from the NOTIFY_SOCKET, WATCHDOG_USEC and
+// WATCHDOG_PID variables systemd sets. The watchdog is left off when it
+// is meant for another process.
+func FromEnv(logger *slog.Logger) *Notifier {
+	var watchdog time.Duration
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	pid := os.Getenv("WATCHDOG_PID")
+	if err == nil && usec > 0 && (pid == "" || pid == strconv.Itoa(os.Getpid())) {
+		watchdog = time.Duration(usec) * time.Microsecond
+	}
+	return New(os.Getenv("NOTIFY_SOCKET"), watchdog, logger)
+}
+
+// Enabled reports whether the server runs under systemd with a notify
+// socket
+func (n *Notifier) Enabled() bool {
+	return n.socket != ""
+}
+
+// WatchdogTimeout returns how long systemd waits for a watchdog ping
+// before restarting the service, zero without a watchdog
+func (n *Notifier) WatchdogTimeout() time.Duration {
+	if !n.Enabled() {
+		return 0
+	}
+	return n.watchdog
+}
+
+// Notify sends a state to systemd
+func (n *Notifier) Notify(state string) error {
+	if !n.Enabled() {
+		return nil
+	}
+	// A leading @ is a socket in the abstract namespace
+	addr := &net.UnixAddr{Name: n.socket, Net: "unixgram"}
+	if n.socket[0] == '@' {
+		addr.Name = "\x00" + n.socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return fmt.Errorf("failed to reach systemd: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return nil
+}
+
+// Ready tells systemd the server started
+func (n *Notifier) Ready() error {
+	return n.Notify(StateReady)
+}
+
+// Stopping tells systemd the server is shutting down
+func (n *Notifier) Stopping() error {
+	return n.Notify(StateStopping)
+}
+
+// Start pings the watchdog at half its timeout while check passes, so a
+// server stuck on its dependencies is restarted, and tells systemd the
+// server is stopping once ctx is done. Each check gets half the timeout
+// too.
+func (n *Notifier) Start(ctx context.Context, check func(ctx context.Context) error) error {
+	timeout := n.WatchdogTimeout()
+	if timeout == 0 {
+		<-ctx.Done()
+		n.stopping()
+		return nil
+	}
+
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			n.stopping()
+			return nil
+		case <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, timeout/2)
+			err := check(checkCtx)
+			cancel()
+			if err != nil {
+				n.logger.Warn("watchdog check failed, not pinging systemd", "error", err)
+				continue
+			}
+			if err := n.Notify(StateWatchdog); err != nil {
+				n.logger.Warn("failed to ping the systemd watchdog", "error", err)
+			}
+		}
+	}
+}
+
+// stopping tells systemd the server is stopping, logging failures: the
+// shutdown goes on regardless
+func (n *Notifier) stopping() {
+	if err := n.Stopping(); err != nil {
+		n.logger.Warn("failed to notify systemd of the shutdown", "error", err)
+	}
+}
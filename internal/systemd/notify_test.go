@@ -0,0 +1,136 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listen opens a datagram socket standing in for systemd's. Socket paths
+// are short, so it lives in a temporary directory of its own rather than
+// the test's.
+func listen(t *testing.T) (string, *net.UnixConn) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "sd")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return path, conn
+}
+
+// receive reads the next state sent to the socket
+func receive(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestNotifier_Notify(t *testing.T) {
+	path, conn := listen(t)
+	n := New(path, 0, discard)
+	require.True(t, n.Enabled())
+
+	require.NoError(t, n.Ready())
+	assert.Equal(t, "READY=1", receive(t, conn))
+	require.NoError(t, n.Stopping())
+	assert.Equal(t, "STOPPING=1", receive(t, conn))
+}
+
+func TestNotifier_Disabled(t *testing.T) {
+	n := New("", time.Second, discard)
+	assert.False(t, n.Enabled())
+	assert.Zero(t, n.WatchdogTimeout())
+	assert.NoError(t, n.Ready())
+
+	// Without a watchdog it only waits for the shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, n.Start(ctx, nil))
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "/run/systemd/notify")
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	n := FromEnv(discard)
+	assert.True(t, n.Enabled())
+	assert.Equal(t, 30*time.Second, n.WatchdogTimeout())
+
+	// The watchdog of another process
+	t.Setenv("WATCHDOG_PID", "1")
+	assert.Zero(t, FromEnv(discard).WatchdogTimeout())
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	t.Setenv("WATCHDOG_PID", "")
+	assert.False(t, FromEnv(discard).Enabled())
+}
+
+func TestNotifier_Start(t *testing.T) {
+	path, conn := listen(t)
+	n := New(path, 40*time.Millisecond, discard)
+
+	checks := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- n.Start(ctx, func(ctx context.Context) error {
+			checks <- struct{}{}
+			return nil
+		})
+	}()
+
+	<-checks
+	assert.Equal(t, "WATCHDOG=1", receive(t, conn))
+
+	cancel()
+	require.NoError(t, <-done)
+	// Pings sent before the cancel may still be queued
+	for {
+		state := receive(t, conn)
+		if state != StateWatchdog {
+			assert.Equal(t, "STOPPING=1", state)
+			break
+		}
+	}
+}
+
+func TestNotifier_Start_FailedCheck(t *testing.T) {
+	path, conn := listen(t)
+	n := New(path, 40*time.Millisecond, discard)
+
+	checks := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- n.Start(ctx, func(ctx context.Context) error {
+			checks <- struct{}{}
+			return errors.New("database is down")
+		})
+	}()
+
+	// Failed checks send nothing, so the shutdown notice comes first
+	<-checks
+	<-checks
+	cancel()
+	require.NoError(t, <-done)
+	assert.Equal(t, "STOPPING=1", receive(t, conn))
+}
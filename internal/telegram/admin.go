@@ -0,0 +1,48 @@
+package telegram
+
+import (
+	"context"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// MemberClient is the part of the Bot API used to check chat membership
+type MemberClient interface {
+	GetChatMember(ctx context.Context, params *bot.GetChatMemberParams) (*models.ChatMember, error)
+}
+
+// IsChatAdmin checks if a user is the owner or an administrator of the chat.
+// In private chats the user is always considered an administrator.
+func IsChatAdmin(ctx context.Context, client MemberClient, chat models.Chat, userID int64) (bool, error) {
+	if chat.Type == models.ChatTypePrivate {
+		return true, nil
+	}
+	member, err := client.GetChatMember(ctx, &bot.GetChatMemberParams{
+		ChatID: chat.ID,
+		UserID: userID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return member.Type == models.ChatMemberTypeOwner || member.Type == models.ChatMemberTypeAdministrator, nil
+}
+
+// IsChatMember checks if a user is in a chat: its owner, an administrator,
+// a member or a restricted member who has not left
+func IsChatMember(ctx context.Context, client MemberClient, chatID, userID int64) (bool, error) {
+	member, err := client.GetChatMember(ctx, &bot.GetChatMemberParams{
+		ChatID: chatID,
+		UserID: userID,
+	})
+	if err != nil {
+		return false, err
+	}
+	switch member.Type {
+	case models.ChatMemberTypeOwner, models.ChatMemberTypeAdministrator, models.ChatMemberTypeMember:
+		return true, nil
+	case models.ChatMemberTypeRestricted:
+		return member.Restricted != nil && member.Restricted.IsMember, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,80 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMemberClient returns a fixed membership
+type fakeMemberClient struct {
+	member *models.ChatMember
+	err    error
+	calls  int
+}
+
+func (c *fakeMemberClient) GetChatMember(ctx context.Context, params *bot.GetChatMemberParams) (*models.ChatMember, error) {
+	c.calls++
+	return c.member, c.err
+}
+
+func TestIsChatAdmin(t *testing.T) {
+	group := models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}
+
+	tests := []struct {
+		name     string
+		chat     models.Chat
+		member   models.ChatMemberType
+		expected bool
+	}{
+		{"owner", group, models.ChatMemberTypeOwner, true},
+		{"administrator", group, models.ChatMemberTypeAdministrator, true},
+		{"member", group, models.ChatMemberTypeMember, false},
+		{"restricted", group, models.ChatMemberTypeRestricted, false},
+		{"private chat", models.Chat{ID: 5, Type: models.ChatTypePrivate}, models.ChatMemberTypeMember, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeMemberClient{member: &models.ChatMember{Type: tt.member}}
+			admin, err := IsChatAdmin(context.Background(), client, tt.chat, 7)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, admin)
+		})
+	}
+}
+
+func TestIsChatAdmin_Error(t *testing.T) {
+	client := &fakeMemberClient{err: errors.New("boom")}
+	_, err := IsChatAdmin(context.Background(), client, models.Chat{ID: -1, Type: models.ChatTypeGroup}, 7)
+	assert.Error(t, err)
+}
+
+func TestIsChatMember(t *testing.T) {
+	tests := []struct {
+		name     string
+		member   models.ChatMember
+		expected bool
+	}{
+		{"owner", models.ChatMember{Type: models.ChatMemberTypeOwner}, true},
+		{"member", models.ChatMember{Type: models.ChatMemberTypeMember}, true},
+		{"restricted member", models.ChatMember{Type: models.ChatMemberTypeRestricted, Restricted: &models.ChatMemberRestricted{IsMember: true}}, true},
+		{"restricted, left", models.ChatMember{Type: models.ChatMemberTypeRestricted, Restricted: &models.ChatMemberRestricted{}}, false},
+		{"left", models.ChatMember{Type: models.ChatMemberTypeLeft}, false},
+		{"banned", models.ChatMember{Type: models.ChatMemberTypeBanned}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeMemberClient{member: &tt.member}
+			member, err := IsChatMember(context.Background(), client, -100123, 7)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, member)
+		})
+	}
+}
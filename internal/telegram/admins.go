@@ -0,0 +1,247 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/kv"
+)
+
+// DefaultAdminTTL is how long the administrators of a chat are cached
+const DefaultAdminTTL = 5 * time.Minute
+
+// AdminClient is the part of the Bot API used to look up administrators
+type AdminClient interface {
+	MemberClient
+	GetChatAdministrators(ctx context.Context, params *bot.GetChatAdministratorsParams) ([]models.ChatMember, error)
+}
+
+// AdminService answers admin checks from a cache of the administrators of
+// each chat, so permissioned commands do not call Telegram every time.
+// Lists expire after a TTL, and its middleware drops the list of a chat as
+// soon as a member is promoted or demoted there. A nil service checks every
+// time with getChatMember.
+type AdminService struct {
+	ttl   time.Duration
+	clock clock.Clock
+	store kv.Store // Shared lists, instead of chats
+
+	mu    sync.Mutex
+	chats map[int64]adminList
+}
+
+// adminList is the cached administrators of a chat
+type adminList struct {
+	ids     map[int64]bool
+	fetched time.Time
+}
+
+// NewAdminService creates an admin service caching lists for ttl. A zero
+// ttl uses DefaultAdminTTL.
+func NewAdminService(ttl time.Duration) *AdminService {
+	if ttl <= 0 {
+		ttl = DefaultAdminTTL
+	}
+	return &AdminService{ttl: ttl, clock: clock.System{}, chats: make(map[int64]adminList)}
+}
+
+// WithClock replaces the time source used to expire lists
+func (s *AdminService) WithClock(clk clock.Clock) *AdminService {
+	s.clock = clk
+	return s
+}
+
+// WithStore keeps the lists in a store shared by every replica, so an
+// invalidation on one replica reaches the others
+func (s *AdminService) WithStore(store kv.Store) *AdminService {
+	s.store = store
+	return s
+}
+
+// AdminIDs returns the user IDs of the owner and administrators of a chat,
+// sorted
+func (s *AdminService) AdminIDs(ctx context.Context, client AdminClient, chatID int64) ([]int64, error) {
+	list, err := s.admins(ctx, client, chatID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(list))
+	for id := range list {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// IsAdmin checks if a user is the owner or an administrator of the chat.
+// In private chats the user is always considered an administrator.
+func (s *AdminService) IsAdmin(ctx context.Context, client AdminClient, chat models.Chat, userID int64) (bool, error) {
+	if s == nil {
+		return IsChatAdmin(ctx, client, chat, userID)
+	}
+	if chat.Type == models.ChatTypePrivate {
+		return true, nil
+	}
+	list, err := s.admins(ctx, client, chat.ID)
+	if err != nil {
+		return false, err
+	}
+	return list[userID], nil
+}
+
+// IsSenderAdmin checks if the sender of a command is an administrator of
+// its chat, like the IsSenderAdmin function but from the cache
+func (s *AdminService) IsSenderAdmin(ctx context.Context, client AdminClient, msg *models.Message) (bool, error) {
+	if s == nil {
+		return IsSenderAdmin(ctx, client, msg)
+	}
+	actor, err := ResolveActor(msg)
+	if err != nil {
+		return false, err
+	}
+	if actor.AnonymousAdmin {
+		return true, nil
+	}
+	return s.IsAdmin(ctx, client, msg.Chat, actor.UserID)
+}
+
+// Invalidate drops the cached administrators of a chat
+func (s *AdminService) Invalidate(ctx context.Context, chatID int64) {
+	if s.store != nil {
+		if err := s.store.Delete(ctx, adminsKey(chatID)); err != nil {
+			slog.Warn("failed to invalidate shared chat administrators", "chat_id", chatID, "error", err)
+		}
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.chats, chatID)
+}
+
+// Middleware returns a bot middleware invalidating the list of a chat when
+// a member of it becomes or stops being an administrator. Telegram only
+// sends chat_member updates to bots that are administrators and ask for
+// them; my_chat_member updates about the bot itself always arrive.
+func (s *AdminService) Middleware() bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			for _, change := range []*models.ChatMemberUpdated{update.ChatMember, update.MyChatMember} {
+				if change != nil && (isAdminMember(change.OldChatMember) || isAdminMember(change.NewChatMember)) {
+					s.Invalidate(ctx, change.Chat.ID)
+				}
+			}
+			next(ctx, b, update)
+		}
+	}
+}
+
+// admins returns the cached administrators of a chat, fetching them when
+// missing or expired. Concurrent misses may fetch twice; the last one wins.
+func (s *AdminService) admins(ctx context.Context, client AdminClient, chatID int64) (map[int64]bool, error) {
+	if s.store != nil {
+		return s.sharedAdmins(ctx, client, chatID)
+	}
+
+	now := s.clock.Now()
+	s.mu.Lock()
+	list, ok := s.chats[chatID]
+	s.mu.Unlock()
+	if ok && now.Sub(list.fetched) < s.ttl {
+		return list.ids, nil
+	}
+
+	ids, err := fetchAdmins(ctx, client, chatID)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.chats[chatID] = adminList{ids: ids, fetched: now}
+	s.mu.Unlock()
+	return ids, nil
+}
+
+// sharedAdmins returns the administrators of a chat from the store. When
+// the store fails they are fetched from Telegram.
+func (s *AdminService) sharedAdmins(ctx context.Context, client AdminClient, chatID int64) (map[int64]bool, error) {
+	key := adminsKey(chatID)
+	value, ok, err := s.store.Get(ctx, key)
+	if err != nil {
+		slog.Warn("failed to read shared chat administrators", "chat_id", chatID, "error", err)
+	}
+	if ok {
+		var list []int64
+		if err := json.Unmarshal(value, &list); err == nil {
+			ids := make(map[int64]bool, len(list))
+			for _, id := range list {
+				ids[id] = true
+			}
+			return ids, nil
+		}
+	}
+
+	ids, err := fetchAdmins(ctx, client, chatID)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]int64, 0, len(ids))
+	for id := range ids {
+		list = append(list, id)
+	}
+	value, err = json.Marshal(list)
+	if err == nil {
+		err = s.store.Set(ctx, key, value, s.ttl)
+	}
+	if err != nil {
+		slog.Warn("failed to share chat administrators", "chat_id", chatID, "error", err)
+	}
+	return ids, nil
+}
+
+// fetchAdmins asks Telegram for the owner and administrators of a chat
+func fetchAdmins(ctx context.Context, client AdminClient, chatID int64) (map[int64]bool, error) {
+	members, err := client.GetChatAdministrators(ctx, &bot.GetChatAdministratorsParams{ChatID: chatID})
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[int64]bool, len(members))
+	for _, member := range members {
+		if user := memberUser(member); user != nil && isAdminMember(member) {
+			ids[user.ID] = true
+		}
+	}
+	return ids, nil
+}
+
+// adminsKey is the store key of the administrators of a chat
+func adminsKey(chatID int64) string {
+	return "admins:" + strconv.FormatInt(chatID, 10)
+}
+
+// isAdminMember reports whether a membership is the owner or an
+// administrator
+func isAdminMember(member models.ChatMember) bool {
+	return member.Type == models.ChatMemberTypeOwner || member.Type == models.ChatMemberTypeAdministrator
+}
+
+// memberUser returns the user of a membership
+func memberUser(member models.ChatMember) *models.User {
+	switch member.Type {
+	case models.ChatMemberTypeOwner:
+		if member.Owner != nil {
+			return member.Owner.User
+		}
+	case models.ChatMemberTypeAdministrator:
+		if member.Administrator != nil {
+			return &member.Administrator.User
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAdminClient lists fixed administrators and counts the lookups
+type fakeAdminClient struct {
+	fakeMemberClient
+	admins []models.ChatMember
+	err    error
+	lists  int
+}
+
+func (c *fakeAdminClient) GetChatAdministrators(ctx context.Context, params *bot.GetChatAdministratorsParams) ([]models.ChatMember, error) {
+	c.lists++
+	return c.admins, c.err
+}
+
+func administrator(userID int64) models.ChatMember {
+	return models.ChatMember{
+		Type:          models.ChatMemberTypeAdministrator,
+		Administrator: &models.ChatMemberAdministrator{User: models.User{ID: userID}},
+	}
+}
+
+func TestAdminService_CachesAdministrators(t *testing.T) {
+	group := models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}
+	client := &fakeAdminClient{admins: []models.ChatMember{
+		{Type: models.ChatMemberTypeOwner, Owner: &models.ChatMemberOwner{User: &models.User{ID: 1}}},
+		administrator(7),
+	}}
+	clk := clock.NewMock(time.Date(2026, 9, 15, 12, 0, 0, 0, time.UTC))
+	admins := NewAdminService(time.Minute).WithClock(clk)
+	ctx := context.Background()
+
+	for _, userID := range []int64{1, 7} {
+		admin, err := admins.IsAdmin(ctx, client, group, userID)
+		require.NoError(t, err)
+		assert.True(t, admin, "user %d", userID)
+	}
+	admin, err := admins.IsAdmin(ctx, client, group, 8)
+	require.NoError(t, err)
+	assert.False(t, admin)
+	assert.Equal(t, 1, client.lists)
+
+	ids, err := admins.AdminIDs(ctx, client, group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 7}, ids)
+
+	clk.Advance(time.Minute)
+	_, err = admins.IsAdmin(ctx, client, group, 7)
+	require.NoError(t, err)
+	assert.Equal(t, 2, client.lists, "expired lists are fetched again")
+
+	admin, err = admins.IsAdmin(ctx, client, models.Chat{ID: 5, Type: models.ChatTypePrivate}, 5)
+	require.NoError(t, err)
+	assert.True(t, admin)
+	assert.Equal(t, 2, client.lists, "private chats are not looked up")
+}
+
+func TestAdminService_Error(t *testing.T) {
+	client := &fakeAdminClient{err: errors.New("boom")}
+	admins := NewAdminService(0)
+
+	_, err := admins.IsAdmin(context.Background(), client, models.Chat{ID: -1, Type: models.ChatTypeGroup}, 7)
+	assert.Error(t, err)
+
+	// Failures are not cached
+	client.err = nil
+	client.admins = []models.ChatMember{administrator(7)}
+	admin, err := admins.IsAdmin(context.Background(), client, models.Chat{ID: -1, Type: models.ChatTypeGroup}, 7)
+	require.NoError(t, err)
+	assert.True(t, admin)
+}
+
+func TestAdminService_MiddlewareInvalidates(t *testing.T) {
+	group := models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}
+	client := &fakeAdminClient{admins: []models.ChatMember{administrator(7)}}
+	admins := NewAdminService(time.Hour)
+	ctx := context.Background()
+	handled := 0
+	handler := admins.Middleware()(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		handled++
+	})
+
+	_, err := admins.IsAdmin(ctx, client, group, 7)
+	require.NoError(t, err)
+
+	// A member joining does not touch the administrators
+	handler(ctx, nil, &models.Update{ChatMember: &models.ChatMemberUpdated{
+		Chat:          group,
+		OldChatMember: models.ChatMember{Type: models.ChatMemberTypeLeft},
+		NewChatMember: models.ChatMember{Type: models.ChatMemberTypeMember},
+	}})
+	_, err = admins.IsAdmin(ctx, client, group, 7)
+	require.NoError(t, err)
+	assert.Equal(t, 1, client.lists)
+
+	// Demoting one does
+	client.admins = nil
+	handler(ctx, nil, &models.Update{ChatMember: &models.ChatMemberUpdated{
+		Chat:          group,
+		OldChatMember: administrator(7),
+		NewChatMember: models.ChatMember{Type: models.ChatMemberTypeMember},
+	}})
+	admin, err := admins.IsAdmin(ctx, client, group, 7)
+	require.NoError(t, err)
+	assert.False(t, admin)
+	assert.Equal(t, 2, client.lists)
+	assert.Equal(t, 2, handled, "updates go on to the handlers")
+}
+
+func TestAdminService_SharedStore(t *testing.T) {
+	group := models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}
+	client := &fakeAdminClient{admins: []models.ChatMember{administrator(7)}}
+	store := kv.NewMemory()
+	// Two replicas share the lists
+	first := NewAdminService(time.Hour).WithStore(store)
+	second := NewAdminService(time.Hour).WithStore(store)
+	ctx := context.Background()
+
+	admin, err := first.IsAdmin(ctx, client, group, 7)
+	require.NoError(t, err)
+	assert.True(t, admin)
+	admin, err = second.IsAdmin(ctx, client, group, 7)
+	require.NoError(t, err)
+	assert.True(t, admin)
+	assert.Equal(t, 1, client.lists)
+
+	// A demotion seen by one replica reaches the other
+	client.admins = nil
+	second.Middleware()(func(ctx context.Context, b *bot.Bot, update *models.Update) {})(ctx, nil, &models.Update{ChatMember: &models.ChatMemberUpdated{
+		Chat:          group,
+		OldChatMember: administrator(7),
+		NewChatMember: models.ChatMember{Type: models.ChatMemberTypeMember},
+	}})
+	admin, err = first.IsAdmin(ctx, client, group, 7)
+	require.NoError(t, err)
+	assert.False(t, admin)
+}
+
+func TestAdminService_IsSenderAdmin(t *testing.T) {
+	group := models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}
+	client := &fakeAdminClient{
+		fakeMemberClient: fakeMemberClient{member: &models.ChatMember{Type: models.ChatMemberTypeAdministrator}},
+		admins:           []models.ChatMember{administrator(7)},
+	}
+	ctx := context.Background()
+
+	admin, err := NewAdminService(0).IsSenderAdmin(ctx, client, &models.Message{Chat: group, From: groupAnonymousBot, SenderChat: &group})
+	require.NoError(t, err)
+	assert.True(t, admin)
+	assert.Zero(t, client.lists)
+
+	admin, err = NewAdminService(0).IsSenderAdmin(ctx, client, &models.Message{Chat: group, From: &models.User{ID: 7}})
+	require.NoError(t, err)
+	assert.True(t, admin)
+	assert.Equal(t, 1, client.lists)
+
+	var refused *OriginError
+	_, err = NewAdminService(0).IsSenderAdmin(ctx, client, &models.Message{Chat: group, From: channelBot, SenderChat: &models.Chat{ID: -100999}})
+	assert.ErrorAs(t, err, &refused)
+
+	// Without a service every check asks getChatMember
+	var none *AdminService
+	admin, err = none.IsSenderAdmin(ctx, client, &models.Message{Chat: group, From: &models.User{ID: 9}})
+	require.NoError(t, err)
+	assert.True(t, admin)
+	assert.Equal(t, 1, client.calls)
+}
@@ -0,0 +1,159 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+)
+
+// DefaultAvatarTTL is how long a profile photo is used before checking
+// whether the user changed or hid it
+const DefaultAvatarTTL = 24 * time.Hour
+
+// DefaultAvatarCacheSize bounds the on-disk profile photo cache
+const DefaultAvatarCacheSize = 32 << 20
+
+// avatarMaxFileSize is the largest profile photo downloaded. The picked
+// size is small, so anything larger is not a profile photo worth showing.
+const avatarMaxFileSize = 1 << 20
+
+// avatarWidth is the smallest width picked among the sizes of a photo
+const avatarWidth = 160
+
+// ErrNoAvatar is returned for users without a profile photo the bot can
+// see, either because they have none or because their privacy settings hide
+// it from bots
+var ErrNoAvatar = errors.New("user has no visible profile photo")
+
+// AvatarConfig holds profile photo cache configuration
+type AvatarConfig struct {
+	Dir          string        // Cache directory
+	TTL          time.Duration // Defaults to DefaultAvatarTTL
+	MaxCacheSize int64         // Defaults to DefaultAvatarCacheSize
+}
+
+// Avatars fetches the current profile photo of users and keeps it in a disk
+// cache, by user ID, until its TTL expires. Users whose photo is hidden are
+// remembered for the TTL too, so they are not asked for again on every
+// render.
+type Avatars struct {
+	client    ProfilePhotoClient
+	downloads *Downloader
+	ttl       time.Duration
+	clock     clock.Clock
+
+	mu    sync.Mutex
+	users map[int64]avatarEntry
+}
+
+// avatarEntry is the last profile photo found for a user
+type avatarEntry struct {
+	path    string // Empty when the user has no visible photo
+	checked time.Time
+}
+
+// NewAvatars creates a profile photo service caching photos in config.Dir
+func NewAvatars(client ProfilePhotoClient, config AvatarConfig) (*Avatars, error) {
+	if config.TTL <= 0 {
+		config.TTL = DefaultAvatarTTL
+	}
+	if config.MaxCacheSize <= 0 {
+		config.MaxCacheSize = DefaultAvatarCacheSize
+	}
+	downloads, err := NewDownloader(client, DownloaderConfig{
+		Dir:          config.Dir,
+		MaxFileSize:  avatarMaxFileSize,
+		MaxCacheSize: config.MaxCacheSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Avatars{
+		client:    client,
+		downloads: downloads,
+		ttl:       config.TTL,
+		clock:     clock.System{},
+		users:     make(map[int64]avatarEntry),
+	}, nil
+}
+
+// WithClock replaces the clock used to expire cached photos
+func (a *Avatars) WithClock(c clock.Clock) *Avatars {
+	a.clock = c
+	return a
+}
+
+// Avatar returns the local path of the current profile photo of a user, or
+// ErrNoAvatar when they have none the bot can see
+func (a *Avatars) Avatar(ctx context.Context, userID int64) (string, error) {
+	if path, ok := a.lookup(userID); ok {
+		if path == "" {
+			return "", ErrNoAvatar
+		}
+		return path, nil
+	}
+
+	photos, err := a.client.GetUserProfilePhotos(ctx, &bot.GetUserProfilePhotosParams{UserID: userID, Limit: 1})
+	if err != nil {
+		return "", fmt.Errorf("failed to get profile photos: %w", err)
+	}
+	size, ok := pickAvatarSize(photos)
+	if !ok {
+		a.store(userID, "")
+		return "", ErrNoAvatar
+	}
+	path, err := a.downloads.Download(ctx, size.FileID)
+	if err != nil {
+		return "", err
+	}
+	a.store(userID, path)
+	return path, nil
+}
+
+// lookup returns the cached photo of a user while its TTL lasts
+func (a *Avatars) lookup(userID int64) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry, ok := a.users[userID]
+	if !ok || a.clock.Now().Sub(entry.checked) >= a.ttl {
+		return "", false
+	}
+	if entry.path != "" {
+		if _, err := os.Stat(entry.path); err != nil {
+			// Evicted from the download cache, fetch it again
+			delete(a.users, userID)
+			return "", false
+		}
+	}
+	return entry.path, true
+}
+
+// store records the photo found for a user
+func (a *Avatars) store(userID int64, path string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users[userID] = avatarEntry{path: path, checked: a.clock.Now()}
+}
+
+// pickAvatarSize picks the smallest size of the current profile photo at
+// least avatarWidth wide, or its largest one
+func pickAvatarSize(photos *models.UserProfilePhotos) (models.PhotoSize, bool) {
+	if photos == nil || len(photos.Photos) == 0 || len(photos.Photos[0]) == 0 {
+		return models.PhotoSize{}, false
+	}
+	sizes := photos.Photos[0]
+	for _, size := range sizes {
+		if size.Width >= avatarWidth {
+			return size, true
+		}
+	}
+	return sizes[len(sizes)-1], true
+}
@@ -0,0 +1,76 @@
+package telegram
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProfilePhotoClient serves profile photos by user ID
+type fakeProfilePhotoClient struct {
+	*fakeFileClient
+	photos map[int64][][]models.PhotoSize
+	calls  int32
+}
+
+func (c *fakeProfilePhotoClient) GetUserProfilePhotos(ctx context.Context, params *bot.GetUserProfilePhotosParams) (*models.UserProfilePhotos, error) {
+	atomic.AddInt32(&c.calls, 1)
+	photos := c.photos[params.UserID]
+	return &models.UserProfilePhotos{TotalCount: len(photos), Photos: photos}, nil
+}
+
+func TestAvatars_FetchesAndCaches(t *testing.T) {
+	client := &fakeProfilePhotoClient{
+		fakeFileClient: newFakeFileClient(t, map[string]string{"photos/small.jpg": "s", "photos/medium.jpg": "mm", "photos/new.jpg": "n"}, nil),
+		photos: map[int64][][]models.PhotoSize{
+			1: {{{FileID: "small", Width: 80}, {FileID: "medium", Width: 160}, {FileID: "large", Width: 640}}},
+		},
+	}
+	now := clock.NewMock(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	avatars, err := NewAvatars(client, AvatarConfig{Dir: t.TempDir(), TTL: time.Hour})
+	require.NoError(t, err)
+	avatars.WithClock(now)
+
+	// The smallest size wide enough is picked
+	path, err := avatars.Avatar(context.Background(), 1)
+	require.NoError(t, err)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "mm", string(content))
+
+	// Users who hide their photo from bots have none, and are not asked again
+	_, err = avatars.Avatar(context.Background(), 2)
+	assert.ErrorIs(t, err, ErrNoAvatar)
+	_, err = avatars.Avatar(context.Background(), 2)
+	assert.ErrorIs(t, err, ErrNoAvatar)
+	again, err := avatars.Avatar(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, path, again)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&client.calls))
+
+	// Past the TTL a changed photo is picked up
+	client.photos[1] = [][]models.PhotoSize{{{FileID: "new", Width: 320}}}
+	now.Advance(time.Hour)
+	path, err = avatars.Avatar(context.Background(), 1)
+	require.NoError(t, err)
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "n", string(content))
+}
+
+func TestPickAvatarSize(t *testing.T) {
+	_, ok := pickAvatarSize(&models.UserProfilePhotos{})
+	assert.False(t, ok)
+
+	size, ok := pickAvatarSize(&models.UserProfilePhotos{TotalCount: 1, Photos: [][]models.PhotoSize{{{FileID: "a", Width: 80}, {FileID: "b", Width: 120}}}})
+	require.True(t, ok)
+	assert.Equal(t, "b", size.FileID, "the largest when none is wide enough")
+}
@@ -0,0 +1,147 @@
+package telegram
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// chaosRetryAfter is the retry_after of the injected 429 responses, in
+// seconds
+const chaosRetryAfter = 1
+
+// ChaosConfig injects Telegram API failures at random, to check retries and
+// the outbox end to end. Rates go from 0, never, to 1, every request.
+type ChaosConfig struct {
+	RateLimit   float64       // Share of requests answered 429 Too Many Requests
+	ServerError float64       // Share of requests answered 500 Internal Server Error
+	Drop        float64       // Share of requests failing as a lost connection without reaching Telegram
+	Latency     time.Duration // Most random delay added to each request
+	// Methods are the Bot API methods failing, e.g. sendMessage; empty is
+	// every method but getUpdates and getMe, which polling and startup need
+	Methods []string
+	Seed    uint64 // Makes the failures repeatable; 0 picks a random seed
+}
+
+// Enabled reports whether the config injects anything
+func (c ChaosConfig) Enabled() bool {
+	return c.RateLimit > 0 || c.ServerError > 0 || c.Drop > 0 || c.Latency > 0
+}
+
+// validate checks every rate is a share and they add up to at most 1
+func (c ChaosConfig) validate() error {
+	for name, rate := range map[string]float64{"rate limit": c.RateLimit, "server error": c.ServerError, "drop": c.Drop} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("invalid chaos %s rate %g, use 0 to 1", name, rate)
+		}
+	}
+	if total := c.RateLimit + c.ServerError + c.Drop; total > 1 {
+		return fmt.Errorf("invalid chaos rates, they add up to %g, more than 1", total)
+	}
+	if c.Latency < 0 {
+		return fmt.Errorf("invalid chaos latency %s", c.Latency)
+	}
+	return nil
+}
+
+// ChaosClient is an HTTP client failing Bot API requests at random as its
+// config says. Failed requests never reach Telegram.
+type ChaosClient struct {
+	client bot.HttpClient
+	config ChaosConfig
+	logger *slog.Logger
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewChaosClient wraps an HTTP client with fault injection
+func NewChaosClient(client bot.HttpClient, config ChaosConfig, logger *slog.Logger) *ChaosClient {
+	seed := config.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &ChaosClient{
+		client: client,
+		config: config,
+		logger: logger,
+		rand:   rand.New(rand.NewPCG(seed, seed)),
+	}
+}
+
+// Do sends a Bot API request, or fails it
+func (c *ChaosClient) Do(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	if !c.targets(method) {
+		return c.client.Do(req)
+	}
+
+	delay, roll := c.roll()
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+
+	switch {
+	case roll < c.config.RateLimit:
+		c.logger.Debug("chaos: rate limiting request", "method", method)
+		return chaosResponse(req, http.StatusTooManyRequests,
+			fmt.Sprintf(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after %d","parameters":{"retry_after":%d}}`, chaosRetryAfter, chaosRetryAfter)), nil
+	case roll < c.config.RateLimit+c.config.ServerError:
+		c.logger.Debug("chaos: failing request", "method", method)
+		return chaosResponse(req, http.StatusInternalServerError,
+			`{"ok":false,"error_code":500,"description":"Internal Server Error"}`), nil
+	case roll < c.config.RateLimit+c.config.ServerError+c.config.Drop:
+		c.logger.Debug("chaos: dropping request", "method", method)
+		return nil, fmt.Errorf("chaos: %s dropped: connection reset by peer", method)
+	}
+	return c.client.Do(req)
+}
+
+// targets reports whether requests to method can fail
+func (c *ChaosClient) targets(method string) bool {
+	if len(c.config.Methods) > 0 {
+		return slices.ContainsFunc(c.config.Methods, func(m string) bool { return strings.EqualFold(m, method) })
+	}
+	return method != "getUpdates" && method != "getMe"
+}
+
+// roll draws the delay of a request and the number picking its failure
+func (c *ChaosClient) roll() (time.Duration, float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var delay time.Duration
+	if c.config.Latency > 0 {
+		delay = time.Duration(c.rand.Int64N(int64(c.config.Latency) + 1))
+	}
+	return delay, c.rand.Float64()
+}
+
+// chaosResponse is a Bot API error response as Telegram sends it
+func chaosResponse(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,93 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChaosClient_RateLimit(t *testing.T) {
+	recorder := &recordingClient{}
+	client := NewChaosClient(recorder, ChaosConfig{RateLimit: 1}, slog.Default())
+
+	b, err := bot.New("TOKEN", bot.WithSkipGetMe(), bot.WithHTTPClient(time.Second, client))
+	require.NoError(t, err)
+	_, err = b.SendMessage(context.Background(), &bot.SendMessageParams{ChatID: 1, Text: "hi"})
+
+	var tooMany *bot.TooManyRequestsError
+	require.True(t, errors.As(err, &tooMany), "got %v", err)
+	assert.Equal(t, chaosRetryAfter, tooMany.RetryAfter)
+	assert.Empty(t, recorder.urls, "failed requests never reach Telegram")
+}
+
+func TestChaosClient_ServerErrorAndDrop(t *testing.T) {
+	client := NewChaosClient(&recordingClient{}, ChaosConfig{ServerError: 1}, slog.Default())
+	resp, err := client.Do(newRequest(t, context.Background(), "sendMessage"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `"error_code":500`)
+
+	client = NewChaosClient(&recordingClient{}, ChaosConfig{Drop: 1}, slog.Default())
+	_, err = client.Do(newRequest(t, context.Background(), "sendMessage"))
+	assert.ErrorContains(t, err, "dropped")
+}
+
+func TestChaosClient_Methods(t *testing.T) {
+	recorder := &recordingClient{}
+	client := NewChaosClient(recorder, ChaosConfig{Drop: 1}, slog.Default())
+	for _, method := range []string{"getUpdates", "getMe"} {
+		_, err := client.Do(newRequest(t, context.Background(), method))
+		require.NoError(t, err, method)
+	}
+
+	client = NewChaosClient(recorder, ChaosConfig{Drop: 1, Methods: []string{"sendMessage"}}, slog.Default())
+	_, err := client.Do(newRequest(t, context.Background(), "deleteMessage"))
+	require.NoError(t, err)
+	_, err = client.Do(newRequest(t, context.Background(), "sendMessage"))
+	assert.Error(t, err)
+	assert.Len(t, recorder.urls, 3)
+}
+
+func TestChaosClient_Seed(t *testing.T) {
+	failures := func() []bool {
+		client := NewChaosClient(&recordingClient{}, ChaosConfig{Drop: 0.5, Seed: 42}, slog.Default())
+		var failed []bool
+		for range 20 {
+			_, err := client.Do(newRequest(t, context.Background(), "sendMessage"))
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+	first := failures()
+	assert.Equal(t, first, failures())
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+}
+
+func TestChaosClient_LatencyCanceled(t *testing.T) {
+	client := NewChaosClient(&recordingClient{}, ChaosConfig{Latency: time.Hour, Seed: 1}, slog.Default())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := client.Do(newRequest(t, ctx, "sendMessage"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPollingConfig_OptionsChaos(t *testing.T) {
+	opts, err := PollingConfig{Chaos: ChaosConfig{RateLimit: 0.1, Drop: 0.2}}.Options()
+	require.NoError(t, err)
+	assert.Len(t, opts, 1)
+
+	_, err = PollingConfig{Chaos: ChaosConfig{ServerError: 1.5}}.Options()
+	assert.ErrorContains(t, err, "server error")
+	_, err = PollingConfig{Chaos: ChaosConfig{RateLimit: 0.6, Drop: 0.6}}.Options()
+	assert.ErrorContains(t, err, "more than 1")
+}
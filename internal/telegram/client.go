@@ -0,0 +1,60 @@
+// Package telegram contains helpers built on top of the Telegram Bot API.
+package telegram
+
+import (
+	"context"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// FileClient is the part of the Bot API used to download files
+type FileClient interface {
+	GetFile(ctx context.Context, params *bot.GetFileParams) (*models.File, error)
+	FileDownloadLink(f *models.File) string
+}
+
+// ProfilePhotoClient is the part of the Bot API used to fetch profile
+// photos
+type ProfilePhotoClient interface {
+	FileClient
+	GetUserProfilePhotos(ctx context.Context, params *bot.GetUserProfilePhotosParams) (*models.UserProfilePhotos, error)
+}
+
+// InviteClient is the part of the Bot API used to manage invite links
+type InviteClient interface {
+	GetChatMember(ctx context.Context, params *bot.GetChatMemberParams) (*models.ChatMember, error)
+	CreateChatInviteLink(ctx context.Context, params *bot.CreateChatInviteLinkParams) (*models.ChatInviteLink, error)
+	RevokeChatInviteLink(ctx context.Context, params *bot.RevokeChatInviteLinkParams) (*models.ChatInviteLink, error)
+}
+
+// MessageClient is the part of the Bot API used to tidy up sent messages
+type MessageClient interface {
+	DeleteMessage(ctx context.Context, params *bot.DeleteMessageParams) (bool, error)
+}
+
+// DocumentClient is the part of the Bot API used to send files
+type DocumentClient interface {
+	SendDocument(ctx context.Context, params *bot.SendDocumentParams) (*models.Message, error)
+}
+
+// MediaClient is the part of the Bot API used to send media and to copy
+// messages without the forwarded header
+type MediaClient interface {
+	DocumentClient
+	SendPhoto(ctx context.Context, params *bot.SendPhotoParams) (*models.Message, error)
+	SendSticker(ctx context.Context, params *bot.SendStickerParams) (*models.Message, error)
+	CopyMessage(ctx context.Context, params *bot.CopyMessageParams) (*models.MessageID, error)
+}
+
+// Client is the subset of the Telegram Bot API used by these helpers.
+// *bot.Bot implements it; tests provide fakes of the narrower interfaces.
+type Client interface {
+	ProfilePhotoClient
+	InviteClient
+	MessageClient
+	MediaClient
+}
+
+// Ensure *bot.Bot keeps satisfying the interface
+var _ Client = (*bot.Bot)(nil)
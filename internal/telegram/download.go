@@ -0,0 +1,259 @@
+package telegram
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-telegram/bot"
+)
+
+// DefaultMaxFileSize is the largest file bots can download via getFile
+const DefaultMaxFileSize = 20 << 20
+
+// DefaultMaxCacheSize bounds the on-disk download cache
+const DefaultMaxCacheSize = 256 << 20
+
+// ErrFileTooLarge is returned when a file exceeds the download size limit
+var ErrFileTooLarge = errors.New("file exceeds download size limit")
+
+// DownloaderConfig holds file download configuration
+type DownloaderConfig struct {
+	Dir          string // Cache directory
+	MaxFileSize  int64  // Largest file to download, defaults to DefaultMaxFileSize
+	MaxCacheSize int64  // Total cache size before evicting, defaults to DefaultMaxCacheSize
+}
+
+// Downloader fetches Telegram files via getFile and keeps them in a disk
+// cache with least-recently-used eviction.
+type Downloader struct {
+	client     FileClient
+	httpClient *http.Client
+	config     DownloaderConfig
+
+	mu    sync.Mutex
+	lru   *list.List               // Front is most recently used
+	files map[string]*list.Element // Keyed by file unique ID
+	size  int64
+}
+
+// cachedFile is a downloaded file in the cache
+type cachedFile struct {
+	key  string
+	path string
+	size int64
+}
+
+// NewDownloader creates a downloader, indexing files already in the cache dir
+func NewDownloader(client FileClient, config DownloaderConfig) (*Downloader, error) {
+	if config.Dir == "" {
+		return nil, fmt.Errorf("download directory is required")
+	}
+	if config.MaxFileSize <= 0 {
+		config.MaxFileSize = DefaultMaxFileSize
+	}
+	if config.MaxCacheSize <= 0 {
+		config.MaxCacheSize = DefaultMaxCacheSize
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+
+	d := &Downloader{
+		client:     client,
+		httpClient: http.DefaultClient,
+		config:     config,
+		lru:        list.New(),
+		files:      make(map[string]*list.Element),
+	}
+
+	if err := d.loadExisting(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Download returns the local path of a Telegram file, downloading it when it
+// is not cached yet. Files larger than MaxFileSize are rejected with
+// ErrFileTooLarge, before downloading when Telegram reports the size.
+func (d *Downloader) Download(ctx context.Context, fileID string) (string, error) {
+	file, err := d.client.GetFile(ctx, &bot.GetFileParams{FileID: fileID})
+	if err != nil {
+		return "", fmt.Errorf("failed to get file: %w", err)
+	}
+
+	if file.FileSize > d.config.MaxFileSize {
+		return "", ErrFileTooLarge
+	}
+
+	key := file.FileUniqueID
+	if key == "" {
+		key = file.FileID
+	}
+
+	if path, ok := d.lookup(key); ok {
+		return path, nil
+	}
+
+	size, path, err := d.fetch(ctx, d.client.FileDownloadLink(file), key, filepath.Ext(file.FilePath))
+	if err != nil {
+		return "", fmt.Errorf("file %s: %w", fileID, err)
+	}
+
+	d.add(key, path, size)
+	return path, nil
+}
+
+// fetch downloads a file into the cache directory. The download link
+// carries the bot token, so errors never include it.
+func (d *Downloader) fetch(ctx context.Context, link, key, ext string) (int64, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create download request: %w", redactURL(err))
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to download file: %w", redactURL(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("failed to download file: unexpected status %s", resp.Status)
+	}
+	if resp.ContentLength > d.config.MaxFileSize {
+		return 0, "", ErrFileTooLarge
+	}
+
+	tmp, err := os.CreateTemp(d.config.Dir, ".download-*")
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	// Read one byte past the limit to detect oversized bodies
+	size, err := io.Copy(tmp, io.LimitReader(resp.Body, d.config.MaxFileSize+1))
+	closeErr := tmp.Close()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to write file: %w", err)
+	}
+	if closeErr != nil {
+		return 0, "", fmt.Errorf("failed to write file: %w", closeErr)
+	}
+	if size > d.config.MaxFileSize {
+		return 0, "", ErrFileTooLarge
+	}
+
+	path := filepath.Join(d.config.Dir, sanitizeKey(key)+ext)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, "", fmt.Errorf("failed to store file: %w", err)
+	}
+
+	return size, path, nil
+}
+
+// lookup returns a cached file path and marks it as recently used
+func (d *Downloader) lookup(key string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	elem, ok := d.files[key]
+	if !ok {
+		return "", false
+	}
+
+	file := elem.Value.(*cachedFile)
+	if _, err := os.Stat(file.path); err != nil {
+		// Removed behind our back, forget it
+		d.remove(elem)
+		return "", false
+	}
+
+	d.lru.MoveToFront(elem)
+	return file.path, true
+}
+
+// add records a downloaded file and evicts old files above the cache size
+func (d *Downloader) add(key, path string, size int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if elem, ok := d.files[key]; ok {
+		d.remove(elem)
+	}
+	d.files[key] = d.lru.PushFront(&cachedFile{key: key, path: path, size: size})
+	d.size += size
+
+	// Never evict the file just added
+	for d.size > d.config.MaxCacheSize && d.lru.Len() > 1 {
+		oldest := d.lru.Back()
+		os.Remove(oldest.Value.(*cachedFile).path)
+		d.remove(oldest)
+	}
+}
+
+// remove drops an element from the index. Callers hold the lock.
+func (d *Downloader) remove(elem *list.Element) {
+	file := elem.Value.(*cachedFile)
+	d.lru.Remove(elem)
+	delete(d.files, file.key)
+	d.size -= file.size
+}
+
+// loadExisting indexes files left in the cache directory by a previous run,
+// oldest modification time first
+func (d *Downloader) loadExisting() error {
+	entries, err := os.ReadDir(d.config.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to read download directory: %w", err)
+	}
+
+	var infos []os.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+
+	for _, info := range infos {
+		key := strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+		d.add(key, filepath.Join(d.config.Dir, info.Name()), info.Size())
+	}
+	return nil
+}
+
+// redactURL drops the URL from a *url.Error, keeping the underlying cause
+func redactURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// sanitizeKey makes a file ID safe to use as a file name
+func sanitizeKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, key)
+}
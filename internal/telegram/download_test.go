@@ -0,0 +1,187 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFileClient serves files from an httptest server
+type fakeFileClient struct {
+	server *httptest.Server
+	files  map[string]*models.File
+}
+
+func (c *fakeFileClient) GetFile(ctx context.Context, params *bot.GetFileParams) (*models.File, error) {
+	file, ok := c.files[params.FileID]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	return file, nil
+}
+
+func (c *fakeFileClient) FileDownloadLink(f *models.File) string {
+	return c.server.URL + "/" + f.FilePath
+}
+
+// newFakeFileClient creates a client serving the given path → content map
+func newFakeFileClient(t *testing.T, contents map[string]string, hits *int32) *fakeFileClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits != nil {
+			atomic.AddInt32(hits, 1)
+		}
+		content, ok := contents[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+
+	files := make(map[string]*models.File)
+	for path := range contents {
+		id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		files[id] = &models.File{FileID: id, FileUniqueID: "u" + id, FilePath: path}
+	}
+	return &fakeFileClient{server: server, files: files}
+}
+
+func TestDownloader_DownloadsAndCaches(t *testing.T) {
+	var hits int32
+	client := newFakeFileClient(t, map[string]string{"photos/a.jpg": "aaaa"}, &hits)
+	d, err := NewDownloader(client, DownloaderConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+
+	path, err := d.Download(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, ".jpg", filepath.Ext(path))
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "aaaa", string(content))
+
+	// Second download is served from disk
+	again, err := d.Download(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, path, again)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestDownloader_RejectsReportedSize(t *testing.T) {
+	var hits int32
+	client := newFakeFileClient(t, map[string]string{"big.bin": "0123456789"}, &hits)
+	client.files["big"].FileSize = 10
+	d, err := NewDownloader(client, DownloaderConfig{Dir: t.TempDir(), MaxFileSize: 5})
+	require.NoError(t, err)
+
+	_, err = d.Download(context.Background(), "big")
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&hits))
+}
+
+func TestDownloader_RejectsOversizedBody(t *testing.T) {
+	dir := t.TempDir()
+	client := newFakeFileClient(t, map[string]string{"big.bin": "0123456789"}, nil)
+	d, err := NewDownloader(client, DownloaderConfig{Dir: dir, MaxFileSize: 5})
+	require.NoError(t, err)
+
+	_, err = d.Download(context.Background(), "big")
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "partial downloads must be removed")
+}
+
+func TestDownloader_EvictsLeastRecentlyUsed(t *testing.T) {
+	client := newFakeFileClient(t, map[string]string{
+		"a.txt": "aaaa",
+		"b.txt": "bbbb",
+		"c.txt": "cccc",
+	}, nil)
+	d, err := NewDownloader(client, DownloaderConfig{Dir: t.TempDir(), MaxCacheSize: 8})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	pathA, err := d.Download(ctx, "a")
+	require.NoError(t, err)
+	pathB, err := d.Download(ctx, "b")
+	require.NoError(t, err)
+
+	// Touch a so b becomes the least recently used
+	_, err = d.Download(ctx, "a")
+	require.NoError(t, err)
+
+	pathC, err := d.Download(ctx, "c")
+	require.NoError(t, err)
+
+	assert.FileExists(t, pathA)
+	assert.NoFileExists(t, pathB)
+	assert.FileExists(t, pathC)
+}
+
+func TestDownloader_IndexesExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	var hits int32
+	client := newFakeFileClient(t, map[string]string{"a.txt": "aaaa"}, &hits)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ua.txt"), []byte("cached"), 0o644))
+
+	d, err := NewDownloader(client, DownloaderConfig{Dir: dir})
+	require.NoError(t, err)
+
+	path, err := d.Download(context.Background(), "a")
+	require.NoError(t, err)
+	content, _ := os.ReadFile(path)
+	assert.Equal(t, "cached", string(content))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&hits))
+}
+
+func TestDownloader_ContextCancelled(t *testing.T) {
+	client := newFakeFileClient(t, map[string]string{"a.txt": "aaaa"}, nil)
+	d, err := NewDownloader(client, DownloaderConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = d.Download(ctx, "a")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDownloader_ErrorHidesToken(t *testing.T) {
+	client := newFakeFileClient(t, map[string]string{"a.txt": "aaaa"}, nil)
+	client.server.Close()
+	d, err := NewDownloader(tokenLinkClient{client}, DownloaderConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+
+	_, err = d.Download(context.Background(), "a")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret-token")
+	assert.Contains(t, err.Error(), "file a")
+}
+
+// tokenLinkClient puts a bot token in download links like Telegram does
+type tokenLinkClient struct {
+	*fakeFileClient
+}
+
+func (c tokenLinkClient) FileDownloadLink(f *models.File) string {
+	return c.server.URL + "/file/botsecret-token/" + f.FilePath
+}
+
+func TestNewDownloader_RequiresDir(t *testing.T) {
+	_, err := NewDownloader(nil, DownloaderConfig{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,188 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+)
+
+// DefaultInviteLinkTTL is how long a generated invite link is reused
+const DefaultInviteLinkTTL = 24 * time.Hour
+
+// inviteLinkName labels the links created by the bot in the chat admin UI
+const inviteLinkName = "wanon quotes"
+
+// ErrNoInvitePermission is returned when the bot cannot create invite links
+var ErrNoInvitePermission = errors.New("bot is not allowed to invite users to this chat")
+
+// ErrNotMember is returned when a user who left the chat asks for its link
+var ErrNotMember = errors.New("user is not a member of this chat")
+
+// InviteLinks generates chat invite links for "view original chat" buttons
+// and caches them per chat so a link is not created on every render.
+type InviteLinks struct {
+	client InviteClient
+	botID  int64
+	ttl    time.Duration
+	clock  clock.Clock
+
+	mu    sync.Mutex
+	links map[int64]inviteLink
+}
+
+// inviteLink is a cached invite link
+type inviteLink struct {
+	url       string
+	createdAt time.Time
+}
+
+// NewInviteLinks creates an invite link cache for the bot with the given ID
+func NewInviteLinks(client InviteClient, botID int64, ttl time.Duration) *InviteLinks {
+	if ttl <= 0 {
+		ttl = DefaultInviteLinkTTL
+	}
+	return &InviteLinks{
+		client: client,
+		botID:  botID,
+		ttl:    ttl,
+		clock:  clock.System{},
+		links:  make(map[int64]inviteLink),
+	}
+}
+
+// WithClock replaces the time source used to expire cached links
+func (l *InviteLinks) WithClock(clk clock.Clock) *InviteLinks {
+	l.clock = clk
+	return l
+}
+
+// Get returns an invite link for the chat, creating one when there is no
+// fresh cached link. It fails with ErrNoInvitePermission when the bot is not
+// an administrator allowed to invite users.
+func (l *InviteLinks) Get(ctx context.Context, chatID int64) (string, error) {
+	l.mu.Lock()
+	cached, ok := l.links[chatID]
+	l.mu.Unlock()
+	if ok && l.clock.Now().Sub(cached.createdAt) < l.ttl {
+		return cached.url, nil
+	}
+
+	if err := l.checkPermission(ctx, chatID); err != nil {
+		l.Invalidate(chatID)
+		return "", err
+	}
+
+	link, err := l.client.CreateChatInviteLink(ctx, &bot.CreateChatInviteLinkParams{
+		ChatID: chatID,
+		Name:   inviteLinkName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create invite link: %w", err)
+	}
+
+	l.mu.Lock()
+	l.links[chatID] = inviteLink{url: link.InviteLink, createdAt: l.clock.Now()}
+	l.mu.Unlock()
+
+	// The previous link is superseded, revoke it so old buttons stop
+	// working. It may already be revoked by hand, so failures are only
+	// logged.
+	if ok && cached.url != link.InviteLink {
+		if err := l.revoke(ctx, chatID, cached.url); err != nil {
+			slog.Debug("failed to revoke superseded invite link", "chat_id", chatID, "error", err)
+		}
+	}
+
+	return link.InviteLink, nil
+}
+
+// GetForMember returns the invite link of a chat like Get, but only to users
+// still in it, so buttons never let removed members back in
+func (l *InviteLinks) GetForMember(ctx context.Context, chatID, userID int64) (string, error) {
+	member, err := l.client.GetChatMember(ctx, &bot.GetChatMemberParams{
+		ChatID: chatID,
+		UserID: userID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to check membership: %w", err)
+	}
+	switch member.Type {
+	case models.ChatMemberTypeLeft, models.ChatMemberTypeBanned:
+		return "", ErrNotMember
+	case models.ChatMemberTypeRestricted:
+		if member.Restricted == nil || !member.Restricted.IsMember {
+			return "", ErrNotMember
+		}
+	}
+	return l.Get(ctx, chatID)
+}
+
+// Revoke revokes the cached invite link of a chat, if any
+func (l *InviteLinks) Revoke(ctx context.Context, chatID int64) error {
+	l.mu.Lock()
+	cached, ok := l.links[chatID]
+	delete(l.links, chatID)
+	l.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return l.revoke(ctx, chatID, cached.url)
+}
+
+// Invalidate forgets the cached link of a chat without revoking it, e.g.
+// when an admin revoked it by hand
+func (l *InviteLinks) Invalidate(chatID int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.links, chatID)
+}
+
+// HandleMyChatMember drops cached links when the bot loses its admin rights,
+// since Telegram revokes the links it created
+func (l *InviteLinks) HandleMyChatMember(update *models.ChatMemberUpdated) {
+	if update == nil || update.NewChatMember.Type == models.ChatMemberTypeAdministrator {
+		return
+	}
+	l.Invalidate(update.Chat.ID)
+}
+
+// checkPermission verifies the bot can create invite links in the chat
+func (l *InviteLinks) checkPermission(ctx context.Context, chatID int64) error {
+	member, err := l.client.GetChatMember(ctx, &bot.GetChatMemberParams{
+		ChatID: chatID,
+		UserID: l.botID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check bot permissions: %w", err)
+	}
+
+	switch member.Type {
+	case models.ChatMemberTypeOwner:
+		return nil
+	case models.ChatMemberTypeAdministrator:
+		if member.Administrator != nil && member.Administrator.CanInviteUsers {
+			return nil
+		}
+	}
+	return ErrNoInvitePermission
+}
+
+// revoke revokes an invite link of a chat
+func (l *InviteLinks) revoke(ctx context.Context, chatID int64, url string) error {
+	_, err := l.client.RevokeChatInviteLink(ctx, &bot.RevokeChatInviteLinkParams{
+		ChatID:     chatID,
+		InviteLink: url,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke invite link: %w", err)
+	}
+	return nil
+}
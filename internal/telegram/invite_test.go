@@ -0,0 +1,173 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeInviteClient records invite link calls
+type fakeInviteClient struct {
+	member  *models.ChatMember
+	users   map[int64]*models.ChatMember // Other users than the bot
+	created int
+	revoked []string
+}
+
+func (c *fakeInviteClient) GetChatMember(ctx context.Context, params *bot.GetChatMemberParams) (*models.ChatMember, error) {
+	if member, ok := c.users[params.UserID]; ok {
+		return member, nil
+	}
+	return c.member, nil
+}
+
+func (c *fakeInviteClient) CreateChatInviteLink(ctx context.Context, params *bot.CreateChatInviteLinkParams) (*models.ChatInviteLink, error) {
+	c.created++
+	return &models.ChatInviteLink{InviteLink: fmt.Sprintf("https://t.me/+link%d", c.created), Name: params.Name}, nil
+}
+
+func (c *fakeInviteClient) RevokeChatInviteLink(ctx context.Context, params *bot.RevokeChatInviteLinkParams) (*models.ChatInviteLink, error) {
+	c.revoked = append(c.revoked, params.InviteLink)
+	return &models.ChatInviteLink{InviteLink: params.InviteLink, IsRevoked: true}, nil
+}
+
+func adminMember(canInvite bool) *models.ChatMember {
+	return &models.ChatMember{
+		Type:          models.ChatMemberTypeAdministrator,
+		Administrator: &models.ChatMemberAdministrator{CanInviteUsers: canInvite},
+	}
+}
+
+func TestInviteLinks_CreatesAndCaches(t *testing.T) {
+	client := &fakeInviteClient{member: adminMember(true)}
+	links := NewInviteLinks(client, 42, time.Hour)
+
+	link, err := links.Get(context.Background(), -100123)
+	require.NoError(t, err)
+	assert.Equal(t, "https://t.me/+link1", link)
+
+	link, err = links.Get(context.Background(), -100123)
+	require.NoError(t, err)
+	assert.Equal(t, "https://t.me/+link1", link)
+	assert.Equal(t, 1, client.created)
+}
+
+func TestInviteLinks_ExpiredLinkIsReplacedAndRevoked(t *testing.T) {
+	client := &fakeInviteClient{member: adminMember(true)}
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	links := NewInviteLinks(client, 42, time.Hour).WithClock(clk)
+
+	first, err := links.Get(context.Background(), -100123)
+	require.NoError(t, err)
+
+	clk.Advance(2 * time.Hour)
+	second, err := links.Get(context.Background(), -100123)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, []string{first}, client.revoked)
+}
+
+func TestInviteLinks_PermissionChecks(t *testing.T) {
+	tests := []struct {
+		name    string
+		member  *models.ChatMember
+		wantErr bool
+	}{
+		{"owner", &models.ChatMember{Type: models.ChatMemberTypeOwner}, false},
+		{"admin with invite right", adminMember(true), false},
+		{"admin without invite right", adminMember(false), true},
+		{"plain member", &models.ChatMember{Type: models.ChatMemberTypeMember}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeInviteClient{member: tt.member}
+			links := NewInviteLinks(client, 42, 0)
+
+			_, err := links.Get(context.Background(), -100123)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrNoInvitePermission)
+				assert.Equal(t, 0, client.created)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestInviteLinks_GetForMember(t *testing.T) {
+	client := &fakeInviteClient{member: adminMember(true), users: map[int64]*models.ChatMember{
+		1: {Type: models.ChatMemberTypeMember},
+		2: {Type: models.ChatMemberTypeLeft},
+		3: {Type: models.ChatMemberTypeRestricted, Restricted: &models.ChatMemberRestricted{IsMember: true}},
+		4: {Type: models.ChatMemberTypeBanned},
+	}}
+	links := NewInviteLinks(client, 42, time.Hour)
+	ctx := context.Background()
+
+	for userID, wantErr := range map[int64]error{1: nil, 2: ErrNotMember, 3: nil, 4: ErrNotMember} {
+		link, err := links.GetForMember(ctx, -100123, userID)
+		if wantErr != nil {
+			assert.ErrorIs(t, err, wantErr, "user %d", userID)
+			continue
+		}
+		require.NoError(t, err, "user %d", userID)
+		assert.Equal(t, "https://t.me/+link1", link)
+	}
+	assert.Equal(t, 1, client.created)
+}
+
+func TestInviteLinks_Revoke(t *testing.T) {
+	client := &fakeInviteClient{member: adminMember(true)}
+	links := NewInviteLinks(client, 42, time.Hour)
+	ctx := context.Background()
+
+	// Nothing cached, nothing to revoke
+	require.NoError(t, links.Revoke(ctx, -100123))
+	assert.Empty(t, client.revoked)
+
+	link, err := links.Get(ctx, -100123)
+	require.NoError(t, err)
+	require.NoError(t, links.Revoke(ctx, -100123))
+	assert.Equal(t, []string{link}, client.revoked)
+
+	// A new link is created afterwards
+	_, err = links.Get(ctx, -100123)
+	require.NoError(t, err)
+	assert.Equal(t, 2, client.created)
+}
+
+func TestInviteLinks_HandleMyChatMember(t *testing.T) {
+	client := &fakeInviteClient{member: adminMember(true)}
+	links := NewInviteLinks(client, 42, time.Hour)
+	ctx := context.Background()
+
+	_, err := links.Get(ctx, -100123)
+	require.NoError(t, err)
+
+	// Still admin: cache kept
+	links.HandleMyChatMember(&models.ChatMemberUpdated{
+		Chat:          models.Chat{ID: -100123},
+		NewChatMember: *adminMember(true),
+	})
+	_, err = links.Get(ctx, -100123)
+	require.NoError(t, err)
+	assert.Equal(t, 1, client.created)
+
+	// Demoted: cache dropped
+	links.HandleMyChatMember(&models.ChatMemberUpdated{
+		Chat:          models.Chat{ID: -100123},
+		NewChatMember: models.ChatMember{Type: models.ChatMemberTypeMember},
+	})
+	_, err = links.Get(ctx, -100123)
+	require.NoError(t, err)
+	assert.Equal(t, 2, client.created)
+}
@@ -0,0 +1,60 @@
+package telegram
+
+import (
+	"context"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// OriginError refuses a command whose sender cannot be verified. Its
+// message explains why and is meant to be shown to the chat.
+type OriginError struct {
+	Reason string
+}
+
+func (e *OriginError) Error() string {
+	return e.Reason
+}
+
+// Actor is who really sent a command
+type Actor struct {
+	// UserID is the user behind the command, zero for anonymous admins
+	UserID int64
+	// AnonymousAdmin is set when an administrator sent the command as the
+	// group. Only administrators can, but which one is unknown.
+	AnonymousAdmin bool
+}
+
+// ResolveActor finds who sent a command. The from field of messages sent
+// as a chat is a placeholder bot, so it is never trusted for them: sending
+// as the group itself is an anonymous administrator, and sending as a
+// channel or through an inline bot is refused with an *OriginError.
+func ResolveActor(msg *models.Message) (Actor, error) {
+	if msg.SenderChat != nil {
+		if msg.SenderChat.ID == msg.Chat.ID {
+			return Actor{AnonymousAdmin: true}, nil
+		}
+		return Actor{}, &OriginError{Reason: "This command can't be sent on behalf of a channel. Send it from your own account."}
+	}
+	if msg.ViaBot != nil {
+		return Actor{}, &OriginError{Reason: "This command can't be sent through an inline bot. Type it yourself."}
+	}
+	if msg.From == nil || msg.From.IsBot {
+		return Actor{}, &OriginError{Reason: "This command can only be sent by a user."}
+	}
+	return Actor{UserID: msg.From.ID}, nil
+}
+
+// IsSenderAdmin checks if the sender of a command is an administrator of
+// its chat, resolving the actor first. Anonymous administrators are admins
+// without asking Telegram; unverifiable senders get an *OriginError.
+func IsSenderAdmin(ctx context.Context, client MemberClient, msg *models.Message) (bool, error) {
+	actor, err := ResolveActor(msg)
+	if err != nil {
+		return false, err
+	}
+	if actor.AnonymousAdmin {
+		return true, nil
+	}
+	return IsChatAdmin(ctx, client, msg.Chat, actor.UserID)
+}
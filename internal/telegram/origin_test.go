@@ -0,0 +1,109 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Placeholder senders Telegram puts in the from field of messages sent as a chat
+var (
+	groupAnonymousBot = &models.User{ID: 1087968824, IsBot: true, Username: "GroupAnonymousBot"}
+	channelBot        = &models.User{ID: 136817688, IsBot: true, Username: "Channel_Bot"}
+)
+
+func TestResolveActor(t *testing.T) {
+	group := models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}
+	user := &models.User{ID: 7, FirstName: "Ana"}
+
+	tests := []struct {
+		name     string
+		msg      *models.Message
+		expected Actor
+		refused  bool
+	}{
+		{"user", &models.Message{Chat: group, From: user}, Actor{UserID: 7}, false},
+		{"anonymous admin", &models.Message{Chat: group, From: groupAnonymousBot, SenderChat: &group}, Actor{AnonymousAdmin: true}, false},
+		{"sent as a channel", &models.Message{Chat: group, From: channelBot, SenderChat: &models.Chat{ID: -100999, Type: models.ChatTypeChannel}}, Actor{}, true},
+		{"via bot", &models.Message{Chat: group, From: user, ViaBot: &models.User{ID: 99, IsBot: true, Username: "inline_bot"}}, Actor{}, true},
+		{"bot sender", &models.Message{Chat: group, From: &models.User{ID: 99, IsBot: true}}, Actor{}, true},
+		{"no sender", &models.Message{Chat: group}, Actor{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actor, err := ResolveActor(tt.msg)
+			if tt.refused {
+				var refused *OriginError
+				require.ErrorAs(t, err, &refused)
+				assert.NotEmpty(t, refused.Reason)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, actor)
+		})
+	}
+}
+
+func TestIsSenderAdmin_SenderChat(t *testing.T) {
+	group := models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}
+
+	t.Run("anonymous admin", func(t *testing.T) {
+		client := &fakeMemberClient{member: &models.ChatMember{Type: models.ChatMemberTypeMember}}
+		admin, err := IsSenderAdmin(context.Background(), client, &models.Message{Chat: group, From: groupAnonymousBot, SenderChat: &group})
+		require.NoError(t, err)
+		assert.True(t, admin)
+		assert.Zero(t, client.calls, "the placeholder bot must not be looked up")
+	})
+
+	t.Run("channel", func(t *testing.T) {
+		// The placeholder bot is even an admin here: it must not count
+		client := &fakeMemberClient{member: &models.ChatMember{Type: models.ChatMemberTypeAdministrator}}
+		channel := &models.Chat{ID: -100999, Type: models.ChatTypeChannel}
+		admin, err := IsSenderAdmin(context.Background(), client, &models.Message{Chat: group, From: channelBot, SenderChat: channel})
+		var refused *OriginError
+		require.ErrorAs(t, err, &refused)
+		assert.Contains(t, refused.Error(), "channel")
+		assert.False(t, admin)
+		assert.Zero(t, client.calls)
+	})
+}
+
+func TestIsSenderAdmin_ViaBot(t *testing.T) {
+	group := models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}
+	client := &fakeMemberClient{member: &models.ChatMember{Type: models.ChatMemberTypeOwner}}
+	msg := &models.Message{
+		Chat:   group,
+		From:   &models.User{ID: 7},
+		ViaBot: &models.User{ID: 99, IsBot: true, Username: "inline_bot"},
+		Text:   "/purgequotes all",
+	}
+
+	admin, err := IsSenderAdmin(context.Background(), client, msg)
+	var refused *OriginError
+	require.ErrorAs(t, err, &refused)
+	assert.Contains(t, refused.Error(), "inline bot")
+	assert.False(t, admin)
+	assert.Zero(t, client.calls)
+}
+
+func TestIsSenderAdmin_User(t *testing.T) {
+	group := models.Chat{ID: -100123, Type: models.ChatTypeSupergroup}
+	msg := &models.Message{Chat: group, From: &models.User{ID: 7}}
+
+	client := &fakeMemberClient{member: &models.ChatMember{Type: models.ChatMemberTypeAdministrator}}
+	admin, err := IsSenderAdmin(context.Background(), client, msg)
+	require.NoError(t, err)
+	assert.True(t, admin)
+	assert.Equal(t, 1, client.calls)
+
+	client = &fakeMemberClient{err: errors.New("boom")}
+	_, err = IsSenderAdmin(context.Background(), client, msg)
+	require.Error(t, err)
+	var refused *OriginError
+	assert.False(t, errors.As(err, &refused))
+}
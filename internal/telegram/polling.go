@@ -0,0 +1,118 @@
+package telegram
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+// maxPollLimit is the most updates Telegram returns per getUpdates call
+const maxPollLimit = 100
+
+// defaultRequestTimeout bounds every Bot API request, as the library does
+const defaultRequestTimeout = time.Minute
+
+// AllowedUpdates are the kinds of update the bot asks Telegram for, by
+// polling or webhook. Telegram leaves out reactions and the member changes
+// of chat_member, which refresh the cached administrators, unless asked.
+var AllowedUpdates = bot.AllowedUpdates{
+	"message", "edited_message", "channel_post", "callback_query", "my_chat_member", "chat_member", "message_reaction", "poll_answer",
+}
+
+// PollingConfig tunes how the bot long-polls getUpdates
+type PollingConfig struct {
+	Timeout  time.Duration // How long each getUpdates call waits for updates, in whole seconds
+	Limit    int           // Most updates per call, 1 to 100; 0 is Telegram's default of 100
+	Interval time.Duration // Least time between the start of two calls; 0 polls again at once
+	Chaos    ChaosConfig   // Fails Bot API requests at random when enabled; never in production
+}
+
+// Options returns the bot options applying the config. The library has no
+// setting for the limit nor the interval, so its HTTP client adds them to
+// the getUpdates requests, and injects the chaos failures.
+func (c PollingConfig) Options() ([]bot.Option, error) {
+	if c.Timeout < 0 || c.Timeout%time.Second != 0 {
+		return nil, fmt.Errorf("invalid poll timeout %s, use whole seconds", c.Timeout)
+	}
+	if c.Limit < 0 || c.Limit > maxPollLimit {
+		return nil, fmt.Errorf("invalid poll limit %d, use 1 to %d", c.Limit, maxPollLimit)
+	}
+	if c.Interval < 0 {
+		return nil, fmt.Errorf("invalid poll interval %s", c.Interval)
+	}
+	if err := c.Chaos.validate(); err != nil {
+		return nil, err
+	}
+
+	// The library asks getUpdates to wait a second less than its poll
+	// timeout, and the HTTP client has to wait longer than both
+	pollTimeout := c.Timeout + time.Second
+	client := &http.Client{Timeout: max(pollTimeout, defaultRequestTimeout)}
+	var botClient bot.HttpClient = NewPollingClient(client, c.Limit, c.Interval)
+	if c.Chaos.Enabled() {
+		botClient = NewChaosClient(botClient, c.Chaos, slog.Default())
+	}
+	return []bot.Option{bot.WithHTTPClient(pollTimeout, botClient)}, nil
+}
+
+// PollingClient is the HTTP client of the bot. It limits the updates each
+// getUpdates call returns and spaces the calls; other requests pass
+// through untouched.
+type PollingClient struct {
+	client   bot.HttpClient
+	limit    int
+	interval time.Duration
+
+	mu       sync.Mutex
+	lastPoll time.Time
+}
+
+// NewPollingClient wraps an HTTP client. A zero limit keeps Telegram's
+// default and a zero interval polls again as soon as a call returns.
+func NewPollingClient(client bot.HttpClient, limit int, interval time.Duration) *PollingClient {
+	return &PollingClient{client: client, limit: limit, interval: interval}
+}
+
+// Do sends a Bot API request
+func (c *PollingClient) Do(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/getUpdates") {
+		return c.client.Do(req)
+	}
+	if err := c.wait(req); err != nil {
+		return nil, err
+	}
+	if c.limit > 0 {
+		// The Bot API reads parameters from the query string as well as the
+		// form the library sends
+		query := req.URL.Query()
+		query.Set("limit", strconv.Itoa(c.limit))
+		req.URL.RawQuery = query.Encode()
+	}
+	return c.client.Do(req)
+}
+
+// wait holds a getUpdates call until the interval since the previous one
+// has passed, or the request is canceled
+func (c *PollingClient) wait(req *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.interval > 0 && !c.lastPoll.IsZero() {
+		if delay := time.Until(c.lastPoll.Add(c.interval)); delay > 0 {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-req.Context().Done():
+				return req.Context().Err()
+			case <-timer.C:
+			}
+		}
+	}
+	c.lastPoll = time.Now()
+	return nil
+}
@@ -0,0 +1,131 @@
+package telegram
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingClient answers every request and remembers its URL
+type recordingClient struct {
+	urls []string
+}
+
+func (c *recordingClient) Do(req *http.Request) (*http.Response, error) {
+	c.urls = append(c.urls, req.URL.String())
+	return httptest.NewRecorder().Result(), nil
+}
+
+func newRequest(t *testing.T, ctx context.Context, method string) *http.Request {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.telegram.org/botTOKEN/"+method, nil)
+	require.NoError(t, err)
+	return req
+}
+
+func TestPollingClient_Limit(t *testing.T) {
+	recorder := &recordingClient{}
+	client := NewPollingClient(recorder, 20, 0)
+
+	for _, method := range []string{"getUpdates", "sendMessage"} {
+		_, err := client.Do(newRequest(t, context.Background(), method))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{
+		"https://api.telegram.org/botTOKEN/getUpdates?limit=20",
+		"https://api.telegram.org/botTOKEN/sendMessage",
+	}, recorder.urls)
+}
+
+func TestPollingClient_Interval(t *testing.T) {
+	client := NewPollingClient(&recordingClient{}, 0, 50*time.Millisecond)
+
+	start := time.Now()
+	for range 3 {
+		_, err := client.Do(newRequest(t, context.Background(), "getUpdates"))
+		require.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+	// Other methods do not wait
+	start = time.Now()
+	_, err := client.Do(newRequest(t, context.Background(), "sendMessage"))
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestPollingClient_IntervalCanceled(t *testing.T) {
+	client := NewPollingClient(&recordingClient{}, 0, time.Hour)
+	_, err := client.Do(newRequest(t, context.Background(), "getUpdates"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.Do(newRequest(t, ctx, "getUpdates"))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestPollingConfig_Options(t *testing.T) {
+	opts, err := PollingConfig{Timeout: 10 * time.Second, Limit: 50}.Options()
+	require.NoError(t, err)
+	assert.Len(t, opts, 1)
+
+	_, err = PollingConfig{Timeout: 1500 * time.Millisecond}.Options()
+	assert.ErrorContains(t, err, "whole seconds")
+	_, err = PollingConfig{Limit: 101}.Options()
+	assert.ErrorContains(t, err, "invalid poll limit")
+	_, err = PollingConfig{Interval: -time.Second}.Options()
+	assert.ErrorContains(t, err, "invalid poll interval")
+}
+
+// pollRecorder answers getUpdates with no updates and passes the body of
+// the first call to polls
+type pollRecorder struct {
+	polls chan string
+}
+
+func (c *pollRecorder) Do(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case c.polls <- string(body):
+	default:
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"ok":true,"result":[]}`)),
+	}, nil
+}
+
+func TestAllowedUpdates_Polling(t *testing.T) {
+	recorder := &pollRecorder{polls: make(chan string, 1)}
+	b, err := bot.New("123:abc",
+		bot.WithSkipGetMe(),
+		bot.WithAllowedUpdates(AllowedUpdates),
+		bot.WithHTTPClient(time.Second, recorder),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Start(ctx)
+
+	select {
+	case body := <-recorder.polls:
+		// Quoted, as my_chat_member contains chat_member
+		assert.Contains(t, body, `"chat_member"`, "admin changes refresh the cached administrators")
+		assert.Contains(t, body, `"poll_answer"`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the bot did not poll")
+	}
+}
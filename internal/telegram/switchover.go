@@ -0,0 +1,223 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+)
+
+// Update delivery modes
+const (
+	ModePolling = "polling" // The bot asks for updates with getUpdates
+	ModeWebhook = "webhook" // Telegram posts updates to the webhook URL
+)
+
+// WebhookClient is the part of the Bot API switching modes uses; *bot.Bot
+// implements it
+type WebhookClient interface {
+	GetWebhookInfo(ctx context.Context) (*models.WebhookInfo, error)
+	SetWebhook(ctx context.Context, params *bot.SetWebhookParams) (bool, error)
+	DeleteWebhook(ctx context.Context, params *bot.DeleteWebhookParams) (bool, error)
+}
+
+// WebhookTarget is the webhook updates go to in webhook mode
+type WebhookTarget struct {
+	URL         string
+	SecretToken string // Sent back in every request; empty for none
+}
+
+// Switchover moves update delivery between polling and a webhook without
+// losing updates. Telegram keeps the updates nobody confirmed and hands them
+// to whichever mode is set next, so a switch only has to make sure the new
+// side takes them, and go back if it does not.
+type Switchover struct {
+	client  WebhookClient
+	clock   clock.Clock
+	sleep   func(ctx context.Context, d time.Duration) error
+	logger  *slog.Logger
+	timeout time.Duration // How long each wait lasts
+	every   time.Duration // How often the webhook info is checked while waiting
+}
+
+// NewSwitchover creates a switchover waiting up to timeout for the old side
+// to drain and the new side to take the pending updates
+func NewSwitchover(client WebhookClient, timeout time.Duration, logger *slog.Logger) *Switchover {
+	return &Switchover{
+		client:  client,
+		clock:   clock.System{},
+		sleep:   sleep,
+		logger:  logger,
+		timeout: timeout,
+		every:   2 * time.Second,
+	}
+}
+
+// WithClock replaces the time source of the waits
+func (s *Switchover) WithClock(clk clock.Clock) *Switchover {
+	s.clock = clk
+	return s
+}
+
+// WithCheckEvery sets how often the webhook info is checked while waiting
+func (s *Switchover) WithCheckEvery(every time.Duration) *Switchover {
+	s.every = every
+	return s
+}
+
+// SwitchOptions configures a switch
+type SwitchOptions struct {
+	Webhook WebhookTarget // Set in webhook mode, and restored on a failed switch to polling
+	// DropPending discards the updates waiting for the new side instead of
+	// handing them over
+	DropPending bool
+}
+
+// Switch moves update delivery to mode. Switching to the webhook first lets
+// a running poller take the updates waiting for it, then sets the webhook,
+// which makes the poller's getUpdates calls fail, and waits for Telegram to
+// deliver the pending updates without errors. Switching to polling deletes
+// the webhook and waits for a poller to take the pending updates. If the new
+// side does not take them within the timeout the previous mode is restored.
+func (s *Switchover) Switch(ctx context.Context, mode string, opts SwitchOptions) error {
+	info, err := s.client.GetWebhookInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get webhook info: %w", err)
+	}
+
+	switch mode {
+	case ModeWebhook:
+		if opts.Webhook.URL == "" {
+			return fmt.Errorf("switching to webhook mode needs a webhook URL")
+		}
+		if info.URL == opts.Webhook.URL {
+			s.logger.Info("already in webhook mode", "url", info.URL, "pending", info.PendingUpdateCount)
+			return nil
+		}
+		if info.URL == "" {
+			s.drain(ctx)
+		}
+		if err := s.setWebhook(ctx, opts.Webhook, opts.DropPending); err != nil {
+			return err
+		}
+	case ModePolling:
+		if info.URL == "" {
+			s.logger.Info("already in polling mode", "pending", info.PendingUpdateCount)
+			return nil
+		}
+		if _, err := s.client.DeleteWebhook(ctx, &bot.DeleteWebhookParams{DropPendingUpdates: opts.DropPending}); err != nil {
+			return fmt.Errorf("failed to delete webhook: %w", err)
+		}
+		s.logger.Info("webhook deleted", "url", info.URL, "drop_pending", opts.DropPending)
+	default:
+		return fmt.Errorf("unknown mode %q, expected %s or %s", mode, ModePolling, ModeWebhook)
+	}
+
+	if err := s.verify(ctx, mode); err != nil {
+		if rollbackErr := s.rollback(ctx, info, opts.Webhook); rollbackErr != nil {
+			return fmt.Errorf("switch to %s failed: %w; rollback failed too: %v", mode, err, rollbackErr)
+		}
+		return fmt.Errorf("switch to %s failed, back to %s: %w", mode, modeOf(info), err)
+	}
+	s.logger.Info("update delivery switched", "mode", mode)
+	return nil
+}
+
+// drain gives a running poller time to take the updates waiting for it.
+// A poller that is not running leaves them pending, and the webhook gets
+// them instead, so running out of time is not an error.
+func (s *Switchover) drain(ctx context.Context) {
+	err := s.waitFor(ctx, func(info *models.WebhookInfo) (bool, error) {
+		return info.PendingUpdateCount == 0, nil
+	})
+	if err != nil {
+		s.logger.Warn("poller did not drain the pending updates, the webhook will get them", "error", err)
+	}
+}
+
+// verify waits until the new mode has taken the pending updates
+func (s *Switchover) verify(ctx context.Context, mode string) error {
+	since := s.clock.Now().Unix()
+	return s.waitFor(ctx, func(info *models.WebhookInfo) (bool, error) {
+		if mode == ModeWebhook && info.LastErrorDate != 0 && int64(info.LastErrorDate) >= since {
+			return false, fmt.Errorf("telegram could not deliver to the webhook: %s", info.LastErrorMessage)
+		}
+		return info.PendingUpdateCount == 0, nil
+	})
+}
+
+// waitFor checks the webhook info until done reports true or fails, or
+// the timeout passes
+func (s *Switchover) waitFor(ctx context.Context, done func(info *models.WebhookInfo) (bool, error)) error {
+	deadline := s.clock.Now().Add(s.timeout)
+	for {
+		info, err := s.client.GetWebhookInfo(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get webhook info: %w", err)
+		}
+		ok, err := done(info)
+		if err != nil || ok {
+			return err
+		}
+		if !s.clock.Now().Before(deadline) {
+			return fmt.Errorf("%d updates still pending after %s", info.PendingUpdateCount, s.timeout)
+		}
+		if err := s.sleep(ctx, s.every); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rollback restores the mode before the switch, without dropping updates
+func (s *Switchover) rollback(ctx context.Context, previous *models.WebhookInfo, webhook WebhookTarget) error {
+	if previous.URL == "" {
+		_, err := s.client.DeleteWebhook(ctx, &bot.DeleteWebhookParams{})
+		return err
+	}
+	target := WebhookTarget{URL: previous.URL}
+	if previous.URL == webhook.URL {
+		target.SecretToken = webhook.SecretToken
+	} else {
+		// Telegram does not tell the secret of a webhook
+		s.logger.Warn("restoring a webhook other than the configured one, without its secret token", "url", previous.URL)
+	}
+	return s.setWebhook(ctx, target, false)
+}
+
+// setWebhook points Telegram to a webhook
+func (s *Switchover) setWebhook(ctx context.Context, webhook WebhookTarget, dropPending bool) error {
+	if _, err := s.client.SetWebhook(ctx, &bot.SetWebhookParams{
+		URL:                webhook.URL,
+		SecretToken:        webhook.SecretToken,
+		DropPendingUpdates: dropPending,
+		AllowedUpdates:     AllowedUpdates,
+	}); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+	s.logger.Info("webhook set", "url", webhook.URL, "drop_pending", dropPending)
+	return nil
+}
+
+// modeOf returns the mode a webhook info describes
+func modeOf(info *models.WebhookInfo) string {
+	if info.URL == "" {
+		return ModePolling
+	}
+	return ModeWebhook
+}
@@ -0,0 +1,147 @@
+package telegram
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWebhookAPI plays Telegram's webhook state. Each check of the webhook
+// info runs the tick function first, standing for the side taking updates.
+type fakeWebhookAPI struct {
+	info    models.WebhookInfo
+	tick    func(info *models.WebhookInfo)
+	calls   []string
+	allowed bot.AllowedUpdates // Of the latest webhook set
+}
+
+func (f *fakeWebhookAPI) GetWebhookInfo(ctx context.Context) (*models.WebhookInfo, error) {
+	if f.tick != nil {
+		f.tick(&f.info)
+	}
+	info := f.info
+	return &info, nil
+}
+
+func (f *fakeWebhookAPI) SetWebhook(ctx context.Context, params *bot.SetWebhookParams) (bool, error) {
+	f.calls = append(f.calls, "set "+params.URL+" secret="+params.SecretToken)
+	f.allowed = params.AllowedUpdates
+	f.info.URL = params.URL
+	f.info.LastErrorDate = 0
+	if params.DropPendingUpdates {
+		f.info.PendingUpdateCount = 0
+	}
+	return true, nil
+}
+
+func (f *fakeWebhookAPI) DeleteWebhook(ctx context.Context, params *bot.DeleteWebhookParams) (bool, error) {
+	f.calls = append(f.calls, "delete")
+	f.info.URL = ""
+	if params.DropPendingUpdates {
+		f.info.PendingUpdateCount = 0
+	}
+	return true, nil
+}
+
+var testWebhook = WebhookTarget{URL: "https://bot.example.com/hook", SecretToken: "s3cret"}
+
+// newTestSwitchover returns a switchover on a mock clock that every wait
+// moves forward
+func newTestSwitchover(api *fakeWebhookAPI) *Switchover {
+	clk := clock.NewMock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewSwitchover(api, time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil))).WithClock(clk)
+	s.sleep = func(ctx context.Context, d time.Duration) error {
+		clk.Advance(d)
+		return nil
+	}
+	return s
+}
+
+func TestSwitchover_ToWebhook(t *testing.T) {
+	api := &fakeWebhookAPI{info: models.WebhookInfo{PendingUpdateCount: 3}}
+	// The poller and then the webhook take one update per check
+	api.tick = func(info *models.WebhookInfo) {
+		if info.PendingUpdateCount > 0 {
+			info.PendingUpdateCount--
+		}
+	}
+
+	require.NoError(t, newTestSwitchover(api).Switch(context.Background(), ModeWebhook, SwitchOptions{Webhook: testWebhook}))
+	assert.Equal(t, []string{"set https://bot.example.com/hook secret=s3cret"}, api.calls)
+	assert.Equal(t, testWebhook.URL, api.info.URL)
+	assert.Equal(t, AllowedUpdates, api.allowed)
+	assert.Contains(t, api.allowed, "chat_member", "admin changes refresh the cached administrators")
+}
+
+func TestSwitchover_ToWebhookRollsBackOnDeliveryErrors(t *testing.T) {
+	api := &fakeWebhookAPI{}
+	s := newTestSwitchover(api)
+	api.tick = func(info *models.WebhookInfo) {
+		if info.URL != "" {
+			info.PendingUpdateCount = 1
+			info.LastErrorDate = int(s.clock.Now().Unix())
+			info.LastErrorMessage = "Connection refused"
+		}
+	}
+
+	err := s.Switch(context.Background(), ModeWebhook, SwitchOptions{Webhook: testWebhook})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "back to polling")
+	assert.Contains(t, err.Error(), "Connection refused")
+	assert.Equal(t, []string{"set https://bot.example.com/hook secret=s3cret", "delete"}, api.calls)
+	assert.Empty(t, api.info.URL)
+}
+
+func TestSwitchover_ToPolling(t *testing.T) {
+	api := &fakeWebhookAPI{info: models.WebhookInfo{URL: testWebhook.URL, PendingUpdateCount: 2}}
+	api.tick = func(info *models.WebhookInfo) {
+		if info.URL == "" && info.PendingUpdateCount > 0 {
+			info.PendingUpdateCount--
+		}
+	}
+
+	require.NoError(t, newTestSwitchover(api).Switch(context.Background(), ModePolling, SwitchOptions{Webhook: testWebhook}))
+	assert.Equal(t, []string{"delete"}, api.calls)
+}
+
+func TestSwitchover_ToPollingRollsBackWithoutPoller(t *testing.T) {
+	// Nothing polls, so the updates stay pending
+	api := &fakeWebhookAPI{info: models.WebhookInfo{URL: testWebhook.URL, PendingUpdateCount: 2}}
+
+	err := newTestSwitchover(api).Switch(context.Background(), ModePolling, SwitchOptions{Webhook: testWebhook})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2 updates still pending")
+	assert.Equal(t, []string{"delete", "set https://bot.example.com/hook secret=s3cret"}, api.calls)
+	assert.Equal(t, 2, api.info.PendingUpdateCount)
+}
+
+func TestSwitchover_AlreadyInMode(t *testing.T) {
+	api := &fakeWebhookAPI{info: models.WebhookInfo{URL: testWebhook.URL}}
+	require.NoError(t, newTestSwitchover(api).Switch(context.Background(), ModeWebhook, SwitchOptions{Webhook: testWebhook}))
+
+	api = &fakeWebhookAPI{}
+	require.NoError(t, newTestSwitchover(api).Switch(context.Background(), ModePolling, SwitchOptions{}))
+	assert.Empty(t, api.calls)
+}
+
+func TestSwitchover_DropPending(t *testing.T) {
+	// Without a poller the drain times out, and the dropped updates never
+	// reach the webhook
+	api := &fakeWebhookAPI{info: models.WebhookInfo{PendingUpdateCount: 5}}
+	require.NoError(t, newTestSwitchover(api).Switch(context.Background(), ModeWebhook, SwitchOptions{Webhook: testWebhook, DropPending: true}))
+	assert.Zero(t, api.info.PendingUpdateCount)
+}
+
+func TestSwitchover_InvalidMode(t *testing.T) {
+	s := newTestSwitchover(&fakeWebhookAPI{})
+	assert.ErrorContains(t, s.Switch(context.Background(), "carrier-pigeon", SwitchOptions{}), "unknown mode")
+	assert.ErrorContains(t, s.Switch(context.Background(), ModeWebhook, SwitchOptions{}), "needs a webhook URL")
+}
@@ -0,0 +1,77 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/outbox"
+	"gorm.io/gorm"
+)
+
+// Handler handles the /telemetry command
+type Handler struct {
+	reporter *Reporter
+	outbox   *outbox.Outbox
+}
+
+// NewHandler creates a /telemetry handler describing the reporter's reports
+func NewHandler(db *gorm.DB, reporter *Reporter) *Handler {
+	return &Handler{reporter: reporter, outbox: outbox.New(db)}
+}
+
+// Handle explains what telemetry collects, where it goes, and what the
+// next report holds so far. Anyone can ask, so users can see what is
+// shared about their use of the bot.
+func (h *Handler) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	msg := update.Message
+	if msg == nil {
+		return nil
+	}
+	_, err := h.outbox.Send(ctx, b, &outbox.Message{ChatID: msg.Chat.ID, Text: h.text()})
+	return err
+}
+
+// text describes the telemetry of the bot
+func (h *Handler) text() string {
+	var sb strings.Builder
+	switch h.reporter.Mode() {
+	case ModeOff:
+		sb.WriteString("📊 Telemetry is off: this bot collects no usage data for its maintainers.")
+		return sb.String()
+	case ModeLocal:
+		sb.WriteString("📊 Telemetry is local: usage reports are written to the bot's log and never sent anywhere.\n")
+	case ModeRemote:
+		fmt.Fprintf(&sb, "📊 Telemetry is on: usage reports are sent to %s to help the maintainers decide what to work on.\n", h.reporter.Endpoint())
+	}
+	sb.WriteString("\nEach report holds only:\n")
+	sb.WriteString("• how many times each command ran and failed\n")
+	sb.WriteString("• the bot version, Go version and platform\n")
+	sb.WriteString("\nNo chat, user or message data is ever included. The bot operator can turn this off with telemetry.mode: off.\n")
+
+	report := h.reporter.Pending()
+	if len(report.Commands) == 0 {
+		sb.WriteString("\nNothing to report yet.")
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "\nNext report (%s), so far:\n", report.Version)
+	for _, name := range slices.Sorted(maps.Keys(report.Commands)) {
+		usage := report.Commands[name]
+		fmt.Fprintf(&sb, "• %s: %d runs, %.0f%% failed\n", name, usage.Runs, 100*usage.ErrorRate())
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// Command returns the command name
+func (h *Handler) Command() string {
+	return "/telemetry"
+}
+
+// Description returns the command description
+func (h *Handler) Description() string {
+	return "Show what usage data the bot shares with its maintainers"
+}
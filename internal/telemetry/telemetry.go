@@ -0,0 +1,243 @@
+// Package telemetry reports anonymous, aggregate usage of the bot to its
+// maintainers: how often each command runs, how often it fails, and which
+// version runs it. It is off unless the operator opts in, and can keep the
+// reports local to see what would be sent.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/metrics"
+)
+
+// Mode is what is done with the reports
+type Mode string
+
+const (
+	// ModeOff collects nothing
+	ModeOff Mode = "off"
+	// ModeLocal logs the reports without sending them anywhere
+	ModeLocal Mode = "local"
+	// ModeRemote logs the reports and sends them to the endpoint
+	ModeRemote Mode = "remote"
+)
+
+// ParseMode reads a mode from the config; empty is off
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(s); mode {
+	case "":
+		return ModeOff, nil
+	case ModeOff, ModeLocal, ModeRemote:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown telemetry mode %q, use off, local or remote", s)
+}
+
+// Source counts the commands handled; *metrics.Recorder implements it
+type Source interface {
+	Counts() map[string]metrics.Count
+}
+
+// Report is the usage of the bot over a period. It holds no chat, user or
+// message data.
+type Report struct {
+	Version   string                  `json:"version"`
+	GoVersion string                  `json:"go_version"`
+	OS        string                  `json:"os"`
+	Arch      string                  `json:"arch"`
+	From      time.Time               `json:"from"`
+	To        time.Time               `json:"to"`
+	Commands  map[string]CommandUsage `json:"commands"` // By command name, without the slash
+}
+
+// CommandUsage is how often a command ran and failed over a report's period
+type CommandUsage struct {
+	Runs   uint64 `json:"runs"`
+	Errors uint64 `json:"errors"`
+}
+
+// ErrorRate is the share of runs that failed
+func (u CommandUsage) ErrorRate() float64 {
+	if u.Runs == 0 {
+		return 0
+	}
+	return float64(u.Errors) / float64(u.Runs)
+}
+
+// Reporter builds a report every interval and logs it, sending it too in
+// remote mode
+type Reporter struct {
+	mode     Mode
+	endpoint string
+	source   Source
+	client   *http.Client
+	clock    clock.Clock
+	logger   *slog.Logger
+
+	mu   sync.Mutex
+	from time.Time
+	sent map[string]metrics.Count // Counts already reported
+}
+
+// NewReporter creates a reporter of the commands counted by source. The
+// endpoint is only used in remote mode.
+func NewReporter(mode Mode, endpoint string, source Source, logger *slog.Logger) (*Reporter, error) {
+	if mode == ModeRemote && endpoint == "" {
+		return nil, fmt.Errorf("telemetry mode remote needs an endpoint")
+	}
+	clk := clock.System{}
+	return &Reporter{
+		mode:     mode,
+		endpoint: endpoint,
+		source:   source,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		clock:    clk,
+		logger:   logger,
+		from:     clk.Now(),
+		sent:     make(map[string]metrics.Count),
+	}, nil
+}
+
+// WithClock replaces the clock timing the reports
+func (r *Reporter) WithClock(clk clock.Clock) *Reporter {
+	r.clock = clk
+	r.from = clk.Now()
+	return r
+}
+
+// WithClient replaces the HTTP client sending the reports
+func (r *Reporter) WithClient(client *http.Client) *Reporter {
+	r.client = client
+	return r
+}
+
+// Mode returns what is done with the reports
+func (r *Reporter) Mode() Mode {
+	return r.mode
+}
+
+// Endpoint returns where remote reports are sent
+func (r *Reporter) Endpoint() string {
+	return r.endpoint
+}
+
+// Pending returns the report of the usage since the last one, without
+// ending its period
+func (r *Reporter) Pending() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report, _ := r.build()
+	return report
+}
+
+// Flush ends the current period: it logs its report and, in remote mode,
+// sends it. Periods without commands are not reported.
+func (r *Reporter) Flush(ctx context.Context) error {
+	if r.mode == ModeOff {
+		return nil
+	}
+	r.mu.Lock()
+	report, counts := r.build()
+	if len(report.Commands) == 0 {
+		r.mu.Unlock()
+		return nil
+	}
+	r.from, r.sent = report.To, counts
+	r.mu.Unlock()
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode telemetry report: %w", err)
+	}
+	if r.mode == ModeLocal {
+		r.logger.Info("telemetry report, kept local", "report", string(body))
+		return nil
+	}
+	r.logger.Info("sending telemetry report", "endpoint", r.endpoint, "report", string(body))
+	return r.send(ctx, body)
+}
+
+// send posts a report to the endpoint
+func (r *Reporter) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create telemetry request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send telemetry report: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telemetry endpoint answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Start reports every interval until ctx is done, and the rest of the
+// period on the way out
+func (r *Reporter) Start(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := r.Flush(flushCtx); err != nil {
+				r.logger.Error("failed to flush telemetry", "error", err)
+			}
+			return nil
+		case <-ticker.C:
+			if err := r.Flush(ctx); err != nil {
+				r.logger.Error("failed to report telemetry", "error", err)
+			}
+		}
+	}
+}
+
+// build returns the report of the usage since the last one and the counts
+// it reaches. The caller holds the lock.
+func (r *Reporter) build() (*Report, map[string]metrics.Count) {
+	counts := r.source.Counts()
+	report := &Report{
+		Version:   Version(),
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		From:      r.from,
+		To:        r.clock.Now(),
+		Commands:  make(map[string]CommandUsage),
+	}
+	for name, now := range counts {
+		before := r.sent[name]
+		usage := CommandUsage{
+			Runs:   now.OK + now.Failed - before.OK - before.Failed,
+			Errors: now.Failed - before.Failed,
+		}
+		if usage.Runs > 0 {
+			report.Commands[name] = usage
+		}
+	}
+	return report, counts
+}
+
+// Version returns the version of the running bot, "(devel)" when built
+// from a checkout
+func Version() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
@@ -0,0 +1,124 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode("")
+	require.NoError(t, err)
+	assert.Equal(t, ModeOff, mode)
+	mode, err = ParseMode("local")
+	require.NoError(t, err)
+	assert.Equal(t, ModeLocal, mode)
+	_, err = ParseMode("always")
+	assert.Error(t, err)
+}
+
+func TestNewReporter_RemoteNeedsEndpoint(t *testing.T) {
+	_, err := NewReporter(ModeRemote, "", metrics.NewRecorder(0), slog.Default())
+	assert.Error(t, err)
+}
+
+func TestReporter_Flush(t *testing.T) {
+	var received []Report
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report Report
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&report))
+		received = append(received, report)
+	}))
+	defer server.Close()
+
+	start := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewMock(start)
+	recorder := metrics.NewRecorder(0)
+	reporter, err := NewReporter(ModeRemote, server.URL, recorder, slog.Default())
+	require.NoError(t, err)
+	reporter.WithClock(clk)
+
+	// Nothing ran, nothing is sent
+	require.NoError(t, reporter.Flush(context.Background()))
+	assert.Empty(t, received)
+
+	recorder.Observe("rquote", time.Millisecond, nil)
+	recorder.Observe("rquote", time.Millisecond, errors.New("boom"))
+	recorder.Observe("addquote", time.Millisecond, nil)
+	clk.Advance(24 * time.Hour)
+	require.NoError(t, reporter.Flush(context.Background()))
+
+	require.Len(t, received, 1)
+	assert.Equal(t, map[string]CommandUsage{
+		"rquote":   {Runs: 2, Errors: 1},
+		"addquote": {Runs: 1},
+	}, received[0].Commands)
+	assert.True(t, received[0].From.Equal(start))
+	assert.NotEmpty(t, received[0].Version)
+
+	// The next report only holds what ran since
+	recorder.Observe("rquote", time.Millisecond, nil)
+	clk.Advance(24 * time.Hour)
+	require.NoError(t, reporter.Flush(context.Background()))
+	require.Len(t, received, 2)
+	assert.Equal(t, map[string]CommandUsage{"rquote": {Runs: 1}}, received[1].Commands)
+	assert.True(t, received[1].From.Equal(start.Add(24*time.Hour)))
+}
+
+func TestReporter_FlushLocal(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { requests++ }))
+	defer server.Close()
+
+	recorder := metrics.NewRecorder(0)
+	reporter, err := NewReporter(ModeLocal, server.URL, recorder, slog.Default())
+	require.NoError(t, err)
+	recorder.Observe("rquote", time.Millisecond, nil)
+
+	require.NoError(t, reporter.Flush(context.Background()))
+	assert.Zero(t, requests, "local reports are never sent")
+	assert.Empty(t, reporter.Pending().Commands)
+}
+
+func TestReporter_FlushFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	recorder := metrics.NewRecorder(0)
+	reporter, err := NewReporter(ModeRemote, server.URL, recorder, slog.Default())
+	require.NoError(t, err)
+	recorder.Observe("rquote", time.Millisecond, nil)
+
+	assert.ErrorContains(t, reporter.Flush(context.Background()), "502")
+}
+
+func TestHandler_Text(t *testing.T) {
+	recorder := metrics.NewRecorder(0)
+	off, err := NewReporter(ModeOff, "", recorder, slog.Default())
+	require.NoError(t, err)
+	assert.Contains(t, NewHandler(nil, off).text(), "Telemetry is off")
+
+	remote, err := NewReporter(ModeRemote, "https://telemetry.example.com", recorder, slog.Default())
+	require.NoError(t, err)
+	handler := NewHandler(nil, remote)
+	assert.Contains(t, handler.text(), "Nothing to report yet.")
+
+	recorder.Observe("rquote", time.Millisecond, nil)
+	recorder.Observe("rquote", time.Millisecond, errors.New("boom"))
+	text := handler.text()
+	assert.Contains(t, text, "https://telemetry.example.com")
+	assert.Contains(t, text, "No chat, user or message data")
+	assert.Contains(t, text, "• rquote: 2 runs, 50% failed")
+}
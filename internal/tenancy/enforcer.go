@@ -0,0 +1,200 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/usage"
+)
+
+// DefaultRefresh is how long counted usage is trusted before counting again
+const DefaultRefresh = time.Minute
+
+// LimitError refuses a use past a plan limit. Its message explains the
+// limit and is meant to be shown to the chat.
+type LimitError struct {
+	Tenant   string
+	Plan     string
+	Resource Resource
+	Limit    int64
+	Used     int64
+}
+
+func (e *LimitError) Error() string {
+	switch e.Resource {
+	case ResourceQuotes:
+		return fmt.Sprintf("This community's %s plan stores up to %d quotes, and they are all used.", e.Plan, e.Limit)
+	case ResourceCachedMessages:
+		return fmt.Sprintf("This community's %s plan caches up to %d messages, and they are all used.", e.Plan, e.Limit)
+	case ResourceAPICalls:
+		return fmt.Sprintf("This community's %s plan allows %d commands a month, and they are all used.", e.Plan, e.Limit)
+	}
+	return fmt.Sprintf("This community's %s plan limit of %d %s is reached.", e.Plan, e.Limit, e.Resource)
+}
+
+// Event is a tenant reaching a limit of its plan
+type Event struct {
+	Tenant   *Tenant
+	ChatID   int64 // Chat whose use was refused first
+	Resource Resource
+	Limit    int64
+	Used     int64
+	Month    time.Time
+}
+
+// Hook is told when a tenant reaches a plan limit, for example to notify
+// the operator or to offer an upgrade. It runs once per tenant, resource
+// and month while the process lives.
+type Hook func(ctx context.Context, event Event)
+
+// countKey identifies a counted usage
+type countKey struct {
+	tenant   string
+	resource Resource
+	month    time.Time
+}
+
+// counted is a usage count and when it was taken
+type counted struct {
+	used int64
+	at   time.Time
+}
+
+// Enforcer refuses uses past the limits of the tenants' plans. Counting
+// every use in the database would be costly, so counts are kept for a
+// refresh period and the uses allowed meanwhile are added to them.
+type Enforcer struct {
+	registry *Registry
+	counter  Counter
+	clock    clock.Clock
+	refresh  time.Duration
+	logger   *slog.Logger
+	hooks    []Hook
+
+	mu      sync.Mutex
+	counts  map[countKey]*counted
+	reached map[countKey]bool
+}
+
+// NewEnforcer creates an enforcer of the plans in registry
+func NewEnforcer(registry *Registry, counter Counter, logger *slog.Logger) *Enforcer {
+	return &Enforcer{
+		registry: registry,
+		counter:  counter,
+		clock:    clock.System{},
+		refresh:  DefaultRefresh,
+		logger:   logger,
+		counts:   make(map[countKey]*counted),
+		reached:  make(map[countKey]bool),
+	}
+}
+
+// WithClock replaces the time source of months and refreshes
+func (e *Enforcer) WithClock(clk clock.Clock) *Enforcer {
+	e.clock = clk
+	return e
+}
+
+// WithRefresh sets how long counted usage is trusted
+func (e *Enforcer) WithRefresh(refresh time.Duration) *Enforcer {
+	e.refresh = refresh
+	return e
+}
+
+// WithHook adds a hook told about reached limits
+func (e *Enforcer) WithHook(hook Hook) *Enforcer {
+	e.hooks = append(e.hooks, hook)
+	return e
+}
+
+// Allow checks one more use of a resource in a chat and counts it. It
+// returns a *LimitError when the chat's tenant reached its limit. Chats
+// without a tenant and unlimited resources are always allowed, and so is
+// everything while usage cannot be counted: an accounting outage should
+// not silence the bot.
+func (e *Enforcer) Allow(ctx context.Context, chatID int64, resource Resource) error {
+	tenant := e.registry.TenantOf(chatID)
+	if tenant == nil {
+		return nil
+	}
+	limit := tenant.Plan.Limit(resource)
+	if limit <= 0 {
+		return nil
+	}
+
+	now := e.clock.Now()
+	key := countKey{tenant: tenant.Name, resource: resource, month: usage.MonthOf(now)}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	count := e.counts[key]
+	if count == nil || now.Sub(count.at) >= e.refresh {
+		used, err := e.counter.Count(ctx, tenant, resource, key.month)
+		if err != nil {
+			e.logger.Error("failed to count tenant usage", "tenant", tenant.Name, "resource", resource, "error", err)
+			return nil
+		}
+		count = &counted{used: used, at: now}
+		e.counts[key] = count
+	}
+
+	if count.used >= limit {
+		if !e.reached[key] {
+			e.reached[key] = true
+			e.logger.Info("tenant reached a plan limit", "audit", true, "tenant", tenant.Name, "plan", tenant.Plan.Name, "resource", resource, "limit", limit, "used", count.used)
+			event := Event{Tenant: tenant, ChatID: chatID, Resource: resource, Limit: limit, Used: count.used, Month: key.month}
+			for _, hook := range e.hooks {
+				hook(ctx, event)
+			}
+		}
+		return &LimitError{Tenant: tenant.Name, Plan: tenant.Plan.Name, Resource: resource, Limit: limit, Used: count.used}
+	}
+	count.used++
+	return nil
+}
+
+// Quota returns a check of one resource, for components that take a
+// quota function
+func (e *Enforcer) Quota(resource Resource) func(ctx context.Context, chatID int64) error {
+	return func(ctx context.Context, chatID int64) error {
+		return e.Allow(ctx, chatID, resource)
+	}
+}
+
+// Middleware returns a bot middleware dropping the given commands, named
+// without the leading slash, once the chat's tenant used the API calls of
+// its plan for the month. Other updates pass through.
+func Middleware(enforcer *Enforcer, commands []string, logger *slog.Logger) bot.Middleware {
+	known := make(map[string]bool, len(commands))
+	for _, command := range commands {
+		known[command] = true
+	}
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			msg := update.Message
+			if msg == nil {
+				next(ctx, b, update)
+				return
+			}
+			args, ok := botcmd.ParseArgs(msg.Text)
+			if !ok || !known[args.Command] {
+				next(ctx, b, update)
+				return
+			}
+			var limit *LimitError
+			if err := enforcer.Allow(ctx, msg.Chat.ID, ResourceAPICalls); errors.As(err, &limit) {
+				logger.Debug("dropping command over the plan limit", "chat_id", msg.Chat.ID, "command", args.Command, "tenant", limit.Tenant)
+				return
+			}
+			next(ctx, b, update)
+		}
+	}
+}
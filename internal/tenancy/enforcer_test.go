@@ -0,0 +1,133 @@
+package tenancy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCounter returns fixed usage and counts how often it is asked
+type fakeCounter struct {
+	used  map[Resource]int64
+	err   error
+	calls int
+}
+
+func (c *fakeCounter) Count(ctx context.Context, tenant *Tenant, resource Resource, month time.Time) (int64, error) {
+	c.calls++
+	return c.used[resource], c.err
+}
+
+func newTestEnforcer(t *testing.T, counter Counter) (*Enforcer, *clock.Mock) {
+	t.Helper()
+	registry, err := New(
+		[]Plan{{Name: "free", MaxQuotes: 2, MaxAPICalls: 10}},
+		[]TenantConfig{{Name: "chess", Plan: "free", ChatIDs: []int64{-1001}}},
+	)
+	require.NoError(t, err)
+	clk := clock.NewMock(time.Date(2026, 9, 15, 12, 0, 0, 0, time.UTC))
+	enforcer := NewEnforcer(registry, counter, slog.New(slog.NewTextHandler(io.Discard, nil))).WithClock(clk)
+	return enforcer, clk
+}
+
+func TestEnforcer_Allow(t *testing.T) {
+	counter := &fakeCounter{used: map[Resource]int64{ResourceQuotes: 1}}
+	enforcer, _ := newTestEnforcer(t, counter)
+	var events []Event
+	enforcer.WithHook(func(ctx context.Context, event Event) { events = append(events, event) })
+	ctx := context.Background()
+
+	require.NoError(t, enforcer.Allow(ctx, -1001, ResourceQuotes))
+
+	err := enforcer.Allow(ctx, -1001, ResourceQuotes)
+	var limit *LimitError
+	require.ErrorAs(t, err, &limit)
+	assert.Equal(t, LimitError{Tenant: "chess", Plan: "free", Resource: ResourceQuotes, Limit: 2, Used: 2}, *limit)
+	assert.Equal(t, "This community's free plan stores up to 2 quotes, and they are all used.", err.Error())
+
+	// The hook runs once per limit and month
+	require.Error(t, enforcer.Allow(ctx, -1001, ResourceQuotes))
+	require.Len(t, events, 1)
+	assert.Equal(t, "chess", events[0].Tenant.Name)
+	assert.Equal(t, int64(-1001), events[0].ChatID)
+	assert.Equal(t, time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), events[0].Month)
+
+	assert.Equal(t, 1, counter.calls, "counts are reused within the refresh period")
+}
+
+func TestEnforcer_Allow_Unlimited(t *testing.T) {
+	counter := &fakeCounter{used: map[Resource]int64{ResourceCachedMessages: 1_000_000}}
+	enforcer, _ := newTestEnforcer(t, counter)
+	ctx := context.Background()
+
+	assert.NoError(t, enforcer.Allow(ctx, -1001, ResourceCachedMessages), "the plan has no cache limit")
+	assert.NoError(t, enforcer.Allow(ctx, -2002, ResourceQuotes), "the chat has no tenant")
+	assert.Zero(t, counter.calls)
+}
+
+func TestEnforcer_Allow_Refresh(t *testing.T) {
+	counter := &fakeCounter{used: map[Resource]int64{ResourceQuotes: 2}}
+	enforcer, clk := newTestEnforcer(t, counter)
+	ctx := context.Background()
+
+	require.Error(t, enforcer.Allow(ctx, -1001, ResourceQuotes))
+
+	// Quotes were purged meanwhile
+	counter.used[ResourceQuotes] = 0
+	require.Error(t, enforcer.Allow(ctx, -1001, ResourceQuotes))
+	clk.Advance(DefaultRefresh)
+	assert.NoError(t, enforcer.Allow(ctx, -1001, ResourceQuotes))
+	assert.Equal(t, 2, counter.calls)
+}
+
+func TestEnforcer_Allow_CountError(t *testing.T) {
+	enforcer, _ := newTestEnforcer(t, &fakeCounter{err: errors.New("db down")})
+	assert.NoError(t, enforcer.Allow(context.Background(), -1001, ResourceQuotes))
+}
+
+func TestMiddleware(t *testing.T) {
+	counter := &fakeCounter{used: map[Resource]int64{ResourceAPICalls: 10}}
+	enforcer, _ := newTestEnforcer(t, counter)
+	calls := 0
+	handler := Middleware(enforcer, []string{"rquote"}, slog.New(slog.NewTextHandler(io.Discard, nil)))(
+		func(ctx context.Context, b *bot.Bot, update *models.Update) { calls++ },
+	)
+	send := func(chatID int64, text string) {
+		handler(context.Background(), nil, &models.Update{Message: &models.Message{Chat: models.Chat{ID: chatID}, Text: text}})
+	}
+
+	send(-1001, "/rquote")
+	send(-1001, "hello")
+	send(-1001, "/unknown")
+	send(-2002, "/rquote")
+	handler(context.Background(), nil, &models.Update{})
+
+	assert.Equal(t, 4, calls, "only the command over the limit is dropped")
+}
+
+func TestReport_WriteCSV(t *testing.T) {
+	counter := &fakeCounter{used: map[Resource]int64{ResourceQuotes: 2, ResourceCachedMessages: 300, ResourceAPICalls: 7}}
+	enforcer, _ := newTestEnforcer(t, counter)
+	report, err := BuildReport(context.Background(), enforcer.registry, counter, time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	require.Len(t, report.Tenants, 1)
+	assert.True(t, report.Tenants[0].Over(ResourceQuotes))
+	assert.False(t, report.Tenants[0].Over(ResourceCachedMessages))
+	assert.False(t, report.Tenants[0].Over(ResourceAPICalls))
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteCSV(&buf))
+	assert.Equal(t, "month,tenant,plan,chats,quotes,max_quotes,cached_messages,max_cached_messages,api_calls,max_api_calls\n"+
+		"2026-09,chess,free,1,2,2,300,0,7,10\n", buf.String())
+}
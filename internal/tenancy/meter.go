@@ -0,0 +1,125 @@
+package tenancy
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Counter counts what a tenant uses of a resource; *Meter implements it
+type Counter interface {
+	Count(ctx context.Context, tenant *Tenant, resource Resource, month time.Time) (int64, error)
+}
+
+// Meter accounts for the usage of tenants from the database: the quotes
+// and cached messages their chats hold, and the commands recorded in the
+// command usage log during a month
+type Meter struct {
+	db *gorm.DB
+}
+
+// NewMeter creates a meter
+func NewMeter(db *gorm.DB) *Meter {
+	return &Meter{db: db}
+}
+
+// Count returns the usage of a resource by a tenant. Quotes and cached
+// messages are counted as they are now; API calls over the month starting
+// at month.
+func (m *Meter) Count(ctx context.Context, tenant *Tenant, resource Resource, month time.Time) (int64, error) {
+	if len(tenant.ChatIDs) == 0 {
+		return 0, nil
+	}
+	query := m.db.WithContext(ctx)
+	switch resource {
+	case ResourceQuotes:
+		query = query.Table("quote").Where("chat_id IN ?", tenant.ChatIDs)
+	case ResourceCachedMessages:
+		query = query.Table("cache_entry").Where("chat_id IN ?", tenant.ChatIDs)
+	case ResourceAPICalls:
+		query = query.Table("command_usage").
+			Where("chat_id IN ? AND created_at >= ? AND created_at < ?", tenant.ChatIDs, month, month.AddDate(0, 1, 0))
+	default:
+		return 0, fmt.Errorf("unknown resource %q", resource)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count %s of tenant %s: %w", resource, tenant.Name, err)
+	}
+	return count, nil
+}
+
+// Report is the usage of every tenant in a month
+type Report struct {
+	Month   time.Time      `json:"month"` // First instant of the month, in UTC
+	Tenants []*TenantUsage `json:"tenants"`
+}
+
+// TenantUsage is the usage of a tenant against its plan
+type TenantUsage struct {
+	Tenant  string             `json:"tenant"`
+	Plan    string             `json:"plan"`
+	ChatIDs []int64            `json:"chat_ids"`
+	Used    map[Resource]int64 `json:"used"`
+	Limits  map[Resource]int64 `json:"limits"` // Zero for no limit
+}
+
+// Over reports whether the tenant reached the limit of a resource
+func (u *TenantUsage) Over(resource Resource) bool {
+	limit := u.Limits[resource]
+	return limit > 0 && u.Used[resource] >= limit
+}
+
+// BuildReport accounts for the usage of every tenant in the month starting
+// at month
+func BuildReport(ctx context.Context, registry *Registry, counter Counter, month time.Time) (*Report, error) {
+	report := &Report{Month: month, Tenants: make([]*TenantUsage, 0, len(registry.Tenants()))}
+	for _, tenant := range registry.Tenants() {
+		usage := &TenantUsage{
+			Tenant:  tenant.Name,
+			Plan:    tenant.Plan.Name,
+			ChatIDs: tenant.ChatIDs,
+			Used:    make(map[Resource]int64, len(Resources)),
+			Limits:  make(map[Resource]int64, len(Resources)),
+		}
+		for _, resource := range Resources {
+			used, err := counter.Count(ctx, tenant, resource, month)
+			if err != nil {
+				return nil, err
+			}
+			usage.Used[resource] = used
+			usage.Limits[resource] = tenant.Plan.Limit(resource)
+		}
+		report.Tenants = append(report.Tenants, usage)
+	}
+	return report, nil
+}
+
+// WriteCSV writes the report with a row per tenant, for billing
+func (r *Report) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	header := []string{"month", "tenant", "plan", "chats"}
+	for _, resource := range Resources {
+		header = append(header, string(resource), "max_"+string(resource))
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+	month := r.Month.Format("2006-01")
+	for _, usage := range r.Tenants {
+		row := []string{month, usage.Tenant, usage.Plan, strconv.Itoa(len(usage.ChatIDs))}
+		for _, resource := range Resources {
+			row = append(row, strconv.FormatInt(usage.Used[resource], 10), strconv.FormatInt(usage.Limits[resource], 10))
+		}
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,124 @@
+// Package tenancy groups chats into tenants for operators hosting the bot
+// for several communities: each tenant has a plan whose limits are
+// enforced, and its usage is accounted for billing reports.
+package tenancy
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Resource is something a plan limits
+type Resource string
+
+const (
+	// ResourceQuotes is the quotes stored in the tenant's chats
+	ResourceQuotes Resource = "quotes"
+	// ResourceCachedMessages is the messages cached in the tenant's chats
+	ResourceCachedMessages Resource = "cached_messages"
+	// ResourceAPICalls is the commands the bot handled in the tenant's
+	// chats this month
+	ResourceAPICalls Resource = "api_calls"
+)
+
+// Resources lists every resource, in report order
+var Resources = []Resource{ResourceQuotes, ResourceCachedMessages, ResourceAPICalls}
+
+// Plan is a set of limits. A zero limit is no limit.
+type Plan struct {
+	Name              string `json:"name"`
+	MaxQuotes         int64  `json:"max_quotes"`
+	MaxCachedMessages int64  `json:"max_cached_messages"`
+	MaxAPICalls       int64  `json:"max_api_calls"` // Per calendar month
+}
+
+// Limit returns the limit of a resource, 0 for none
+func (p *Plan) Limit(resource Resource) int64 {
+	switch resource {
+	case ResourceQuotes:
+		return p.MaxQuotes
+	case ResourceCachedMessages:
+		return p.MaxCachedMessages
+	case ResourceAPICalls:
+		return p.MaxAPICalls
+	}
+	return 0
+}
+
+// Tenant is a community with its chats and plan
+type Tenant struct {
+	Name    string
+	Plan    *Plan
+	ChatIDs []int64
+}
+
+// Registry answers which tenant a chat belongs to. Chats outside every
+// tenant have no limits.
+type Registry struct {
+	tenants []*Tenant
+	byChat  map[int64]*Tenant
+}
+
+// TenantConfig is a tenant as configured, with its plan by name
+type TenantConfig struct {
+	Name    string
+	Plan    string
+	ChatIDs []int64
+}
+
+// New creates a registry of tenants. Every tenant must use one of the
+// plans and no chat can belong to two tenants.
+func New(plans []Plan, tenants []TenantConfig) (*Registry, error) {
+	byName := make(map[string]*Plan, len(plans))
+	for i := range plans {
+		plan := &plans[i]
+		if plan.Name == "" {
+			return nil, fmt.Errorf("plan %d has no name", i+1)
+		}
+		if byName[plan.Name] != nil {
+			return nil, fmt.Errorf("plan %q is defined twice", plan.Name)
+		}
+		byName[plan.Name] = plan
+	}
+
+	r := &Registry{byChat: make(map[int64]*Tenant)}
+	names := make(map[string]bool, len(tenants))
+	for i, config := range tenants {
+		if config.Name == "" {
+			return nil, fmt.Errorf("tenant %d has no name", i+1)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("tenant %q is defined twice", config.Name)
+		}
+		names[config.Name] = true
+		plan := byName[config.Plan]
+		if plan == nil {
+			return nil, fmt.Errorf("tenant %q uses unknown plan %q", config.Name, config.Plan)
+		}
+		tenant := &Tenant{Name: config.Name, Plan: plan, ChatIDs: config.ChatIDs}
+		for _, chatID := range config.ChatIDs {
+			if other := r.byChat[chatID]; other != nil {
+				return nil, fmt.Errorf("chat %d belongs to tenants %q and %q", chatID, other.Name, tenant.Name)
+			}
+			r.byChat[chatID] = tenant
+		}
+		r.tenants = append(r.tenants, tenant)
+	}
+	sort.Slice(r.tenants, func(i, j int) bool { return r.tenants[i].Name < r.tenants[j].Name })
+	return r, nil
+}
+
+// Enabled reports whether there are tenants at all
+func (r *Registry) Enabled() bool {
+	return len(r.tenants) > 0
+}
+
+// TenantOf returns the tenant of a chat, or nil for chats without one
+func (r *Registry) TenantOf(chatID int64) *Tenant {
+	return r.byChat[chatID]
+}
+
+// Tenants returns every tenant by name
+func (r *Registry) Tenants() []*Tenant {
+	return r.tenants
+}
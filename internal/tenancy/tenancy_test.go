@@ -0,0 +1,62 @@
+package tenancy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	plans := []Plan{{Name: "free", MaxQuotes: 100}, {Name: "pro"}}
+	registry, err := New(plans, []TenantConfig{
+		{Name: "chess", Plan: "pro", ChatIDs: []int64{-1001, -1002}},
+		{Name: "book-club", Plan: "free", ChatIDs: []int64{-1003}},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, registry.Enabled())
+	require.NotNil(t, registry.TenantOf(-1002))
+	assert.Equal(t, "chess", registry.TenantOf(-1002).Name)
+	assert.Equal(t, int64(100), registry.TenantOf(-1003).Plan.Limit(ResourceQuotes))
+	assert.Nil(t, registry.TenantOf(-1004))
+
+	names := []string{}
+	for _, tenant := range registry.Tenants() {
+		names = append(names, tenant.Name)
+	}
+	assert.Equal(t, []string{"book-club", "chess"}, names)
+}
+
+func TestNew_Empty(t *testing.T) {
+	registry, err := New(nil, nil)
+	require.NoError(t, err)
+	assert.False(t, registry.Enabled())
+	assert.Nil(t, registry.TenantOf(-1001))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		plans   []Plan
+		tenants []TenantConfig
+		err     string
+	}{
+		{"unnamed plan", []Plan{{}}, nil, "plan 1 has no name"},
+		{"plan twice", []Plan{{Name: "free"}, {Name: "free"}}, nil, `plan "free" is defined twice`},
+		{"unnamed tenant", []Plan{{Name: "free"}}, []TenantConfig{{Plan: "free"}}, "tenant 1 has no name"},
+		{"tenant twice", []Plan{{Name: "free"}}, []TenantConfig{{Name: "a", Plan: "free"}, {Name: "a", Plan: "free"}}, `tenant "a" is defined twice`},
+		{"unknown plan", []Plan{{Name: "free"}}, []TenantConfig{{Name: "a", Plan: "gold"}}, `tenant "a" uses unknown plan "gold"`},
+		{"shared chat", []Plan{{Name: "free"}}, []TenantConfig{
+			{Name: "a", Plan: "free", ChatIDs: []int64{-1001}},
+			{Name: "b", Plan: "free", ChatIDs: []int64{-1001}},
+		}, `chat -1001 belongs to tenants "a" and "b"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.plans, tt.tenants)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
@@ -3,12 +3,13 @@ package testutils
 import (
 	"context"
 	"fmt"
-	"os/exec"
+	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
 
+	"github.com/graffic/wanon-go/internal/migrate"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -23,8 +24,21 @@ type TestDB struct {
 	container *postgres.PostgresContainer
 }
 
-// NewTestDB creates a new test database connection using testcontainers
+// NewTestDB creates a new test database connection using testcontainers,
+// with every migration applied
 func NewTestDB(t *testing.T) *TestDB {
+	testDB := NewScratchDB(t)
+
+	// Run migrations in process, as the bot does
+	if err := testDB.RunMigrations(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	return testDB
+}
+
+// NewScratchDB creates an empty test database, without migrations, for
+// tests of the migrations themselves
+func NewScratchDB(t *testing.T) *TestDB {
 	ctx := context.Background()
 
 	// Start PostgreSQL container
@@ -64,12 +78,6 @@ func NewTestDB(t *testing.T) *TestDB {
 		container: container,
 	}
 
-	// Run migrations using tern CLI
-	if err := testDB.RunMigrations(connStr); err != nil {
-		container.Terminate(ctx)
-		t.Fatalf("Failed to run migrations: %v", err)
-	}
-
 	// Clean up after test
 	t.Cleanup(func() {
 		testDB.Cleanup()
@@ -78,20 +86,24 @@ func NewTestDB(t *testing.T) *TestDB {
 	return testDB
 }
 
-// RunMigrations runs database migrations using tern CLI
-func (tdb *TestDB) RunMigrations(connStr string) error {
+// MigrationsDir returns the directory of the bot's migrations
+func MigrationsDir() string {
 	// Get the directory of this file to find migrations
 	_, filename, _, _ := runtime.Caller(0)
-	dir := filepath.Dir(filename)
-	migrationsPath := filepath.Join(dir, "..", "..", "migrations")
+	return filepath.Join(filepath.Dir(filename), "..", "..", "migrations")
+}
 
-	// Run tern migrate using the connection string and migrations path
-	cmd := exec.Command("tern", "migrate", "--conn-string", connStr, "--migrations", migrationsPath)
-	output, err := cmd.CombinedOutput()
+// RunMigrations applies every migration of the bot
+func (tdb *TestDB) RunMigrations() error {
+	migrations, err := migrate.Load(os.DirFS(MigrationsDir()))
+	if err != nil {
+		return err
+	}
+	sqlDB, err := tdb.DB.DB()
 	if err != nil {
-		return fmt.Errorf("tern migrate failed: %w\nOutput: %s", err, string(output))
+		return err
 	}
-	return nil
+	return migrate.New(sqlDB, migrations, migrate.DefaultVersionTable).Migrate(context.Background())
 }
 
 // Cleanup truncates all tables and terminates the container
@@ -99,7 +111,7 @@ func (tdb *TestDB) Cleanup() {
 	ctx := context.Background()
 
 	// Truncate tables
-	tables := []string{"quote_entry", "quote", "cache_entry"}
+	tables := []string{"quote_version", "quote_entry", "quote", "cache_entry", "chat_settings", "quoter_block", "author_nickname", "author_alias", "outbox_message"}
 	for _, table := range tables {
 		tdb.DB.Exec(fmt.Sprintf("TRUNCATE TABLE %s CASCADE", table))
 	}
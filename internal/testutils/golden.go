@@ -0,0 +1,46 @@
+package testutils
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// update rewrites golden files with the current output: go test ./... -update
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// AssertGolden compares actual with the golden file testdata/<name>.golden.
+// Running the tests with -update rewrites the golden file instead.
+func AssertGolden(t *testing.T, name string, actual string) {
+	t.Helper()
+
+	path := goldenPath(name)
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(actual), 0o644); err != nil {
+			t.Fatalf("Failed to update golden file %s: %v", name, err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file %s (run with -update to create it): %v", name, err)
+	}
+
+	if string(expected) != actual {
+		t.Errorf("Output does not match golden file %s (run with -update to accept)\n--- expected\n%s\n--- actual\n%s",
+			name, string(expected), actual)
+	}
+}
+
+// goldenPath returns the path of a golden file in the repository testdata dir
+func goldenPath(name string) string {
+	_, filename, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(filename), "..", "..", "testdata", name+".golden")
+}
@@ -0,0 +1,358 @@
+package testutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Handler is a bot command or callback handler under test
+type Handler interface {
+	Handle(ctx context.Context, b *bot.Bot, update *models.Update) error
+}
+
+// HandlerFunc adapts a handler method, such as a callback handler, to
+// Handler
+type HandlerFunc func(ctx context.Context, b *bot.Bot, update *models.Update) error
+
+// Handle implements Handler
+func (f HandlerFunc) Handle(ctx context.Context, b *bot.Bot, update *models.Update) error {
+	return f(ctx, b, update)
+}
+
+// CommandHandler is a handler of a bot command
+type CommandHandler interface {
+	Handler
+	Command() string
+}
+
+// APIRequest is a Bot API call made by the code under test
+type APIRequest struct {
+	Method string
+	Params map[string]string
+}
+
+// BotHarness runs handlers end to end against a test database and a fake
+// Telegram server that records every API call. Updates go through the
+// middlewares and are routed to the registered handlers like in the server.
+type BotHarness struct {
+	DB   *TestDB
+	Bot  *bot.Bot
+	User *models.User // Sender of the messages, an admin when set with SetAdmin
+
+	t           *testing.T
+	middlewares []bot.Middleware
+	commands    []CommandHandler
+	callbacks   map[string]Handler // By data prefix
+
+	mu         sync.Mutex
+	requests   []APIRequest
+	admins     map[[2]int64]bool // chat ID, user ID
+	notStarted map[int64]bool    // Users who never started a private chat
+	failing    map[string]string // Error description of each failing method
+	messageID  int               // Last message ID handed out
+}
+
+// NewBotHarness creates a harness with its own test database and fake
+// Telegram server
+func NewBotHarness(t *testing.T) *BotHarness {
+	h := &BotHarness{
+		DB:         NewTestDB(t),
+		User:       &models.User{ID: 1001, FirstName: "Alice", Username: "alice"},
+		t:          t,
+		callbacks:  make(map[string]Handler),
+		admins:     make(map[[2]int64]bool),
+		notStarted: make(map[int64]bool),
+		failing:    make(map[string]string),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(h.serveAPI))
+	t.Cleanup(server.Close)
+
+	b, err := bot.New("test-token", bot.WithServerURL(server.URL), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("Failed to create bot: %v", err)
+	}
+	h.Bot = b
+	return h
+}
+
+// Use adds middlewares run on every update before the handlers, such as the
+// cache middleware
+func (h *BotHarness) Use(middlewares ...bot.Middleware) *BotHarness {
+	h.middlewares = append(h.middlewares, middlewares...)
+	return h
+}
+
+// Register routes the messages starting with the command of each handler
+// to it
+func (h *BotHarness) Register(handlers ...CommandHandler) *BotHarness {
+	h.commands = append(h.commands, handlers...)
+	return h
+}
+
+// RegisterCallback routes button presses whose data starts with prefix to
+// a handler
+func (h *BotHarness) RegisterCallback(prefix string, handler Handler) *BotHarness {
+	h.callbacks[prefix] = handler
+	return h
+}
+
+// SetAdmin makes a user an administrator of a chat
+func (h *BotHarness) SetAdmin(chatID, userID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.admins[[2]int64{chatID, userID}] = true
+}
+
+// SetStarted sets whether a user started a private chat with the bot.
+// Users who did not, or blocked it, cannot be written to; every user has
+// started it unless set otherwise.
+func (h *BotHarness) SetStarted(userID int64, started bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.notStarted[userID] = !started
+}
+
+// Fail makes every call of an API method fail with a Bad Request error
+func (h *BotHarness) Fail(method, description string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failing[method] = description
+}
+
+// SendText sends a text message from the harness user to a group chat and
+// returns it. The test fails if a handler returns an error.
+func (h *BotHarness) SendText(chatID int64, text string) *models.Message {
+	return h.send(h.newMessage(chatID, text, nil))
+}
+
+// ReplyText sends a text message replying to another one, in its chat
+func (h *BotHarness) ReplyText(to *models.Message, text string) *models.Message {
+	return h.send(h.newMessage(to.Chat.ID, text, to))
+}
+
+// Send runs an update with a message through the middlewares and handlers
+// and returns the error of the handler, if any
+func (h *BotHarness) Send(msg *models.Message) error {
+	return h.Dispatch(&models.Update{Message: msg})
+}
+
+// Press presses an inline keyboard button with the given data on a message
+func (h *BotHarness) Press(msg *models.Message, data string) {
+	h.t.Helper()
+	err := h.Dispatch(&models.Update{CallbackQuery: &models.CallbackQuery{
+		ID:      strconv.Itoa(h.nextMessageID()),
+		From:    *h.User,
+		Message: models.MaybeInaccessibleMessage{Type: models.MaybeInaccessibleMessageTypeMessage, Message: msg},
+		Data:    data,
+	}})
+	if err != nil {
+		h.t.Fatalf("Handler failed on button %q: %v", data, err)
+	}
+}
+
+// Dispatch runs an update through the middlewares and the matching handler
+// and returns the error of the handler, if any
+func (h *BotHarness) Dispatch(update *models.Update) error {
+	var err error
+	handler := h.route(update)
+	next := func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		if handler != nil {
+			err = handler.Handle(ctx, b, update)
+		}
+	}
+	for i := len(h.middlewares) - 1; i >= 0; i-- {
+		next = h.middlewares[i](next)
+	}
+	next(context.Background(), h.Bot, update)
+	return err
+}
+
+// route finds the handler of an update
+func (h *BotHarness) route(update *models.Update) Handler {
+	if update.Message != nil {
+		for _, handler := range h.commands {
+			if strings.HasPrefix(update.Message.Text, handler.Command()) {
+				return handler
+			}
+		}
+	}
+	if update.CallbackQuery != nil {
+		for prefix, handler := range h.callbacks {
+			if strings.HasPrefix(update.CallbackQuery.Data, prefix) {
+				return handler
+			}
+		}
+	}
+	return nil
+}
+
+// send dispatches a message, failing the test on handler errors
+func (h *BotHarness) send(msg *models.Message) *models.Message {
+	h.t.Helper()
+	if err := h.Send(msg); err != nil {
+		h.t.Fatalf("Handler failed on %q: %v", msg.Text, err)
+	}
+	return msg
+}
+
+// newMessage builds a message from the harness user
+func (h *BotHarness) newMessage(chatID int64, text string, replyTo *models.Message) *models.Message {
+	return &models.Message{
+		ID:             h.nextMessageID(),
+		From:           h.User,
+		Chat:           models.Chat{ID: chatID, Type: models.ChatTypeSupergroup},
+		Date:           int(time.Now().Unix()),
+		Text:           text,
+		ReplyToMessage: replyTo,
+	}
+}
+
+// nextMessageID hands out increasing message IDs, shared with the messages
+// the bot sends
+func (h *BotHarness) nextMessageID() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.messageID++
+	return h.messageID
+}
+
+// Requests returns the API calls made with a method, or all of them when
+// method is empty
+func (h *BotHarness) Requests(method string) []APIRequest {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var requests []APIRequest
+	for _, request := range h.requests {
+		if method == "" || request.Method == method {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// Replies returns the text of every message the bot sent, in order
+func (h *BotHarness) Replies() []string {
+	var replies []string
+	for _, request := range h.Requests("sendMessage") {
+		replies = append(replies, request.Params["text"])
+	}
+	return replies
+}
+
+// LastReply returns the text of the last message the bot sent, failing the
+// test when there is none
+func (h *BotHarness) LastReply() string {
+	h.t.Helper()
+	replies := h.Replies()
+	if len(replies) == 0 {
+		h.t.Fatalf("The bot sent no messages")
+	}
+	return replies[len(replies)-1]
+}
+
+// serveAPI fakes the Bot API, recording every call
+func (h *BotHarness) serveAPI(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	params := map[string]string{}
+	if err := r.ParseMultipartForm(1 << 20); err == nil {
+		for key, values := range r.MultipartForm.Value {
+			params[key] = values[0]
+		}
+	}
+
+	chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+	h.mu.Lock()
+	h.requests = append(h.requests, APIRequest{Method: method, Params: params})
+	notStarted := h.notStarted[chatID]
+	failure, failing := h.failing[method]
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if notStarted {
+		w.WriteHeader(http.StatusForbidden)
+		if err := json.NewEncoder(w).Encode(map[string]any{"ok": false, "error_code": 403, "description": "Forbidden: bot can't initiate conversation with a user"}); err != nil {
+			h.t.Errorf("Failed to write API response: %v", err)
+		}
+		return
+	}
+	if failing {
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(map[string]any{"ok": false, "error_code": 400, "description": "Bad Request: " + failure}); err != nil {
+			h.t.Errorf("Failed to write API response: %v", err)
+		}
+		return
+	}
+	if err := json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": h.result(method, params)}); err != nil {
+		h.t.Errorf("Failed to write API response: %v", err)
+	}
+}
+
+// result builds the response of an API call
+func (h *BotHarness) result(method string, params map[string]string) any {
+	chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+	switch method {
+	case "sendMessage", "sendDocument", "sendPhoto", "sendSticker":
+		return map[string]any{
+			"message_id": h.nextMessageID(),
+			"date":       time.Now().Unix(),
+			"chat":       map[string]any{"id": chatID, "type": chatType(chatID)},
+			"text":       params["text"],
+			"caption":    params["caption"],
+		}
+	case "editMessageText":
+		messageID, _ := strconv.Atoi(params["message_id"])
+		return map[string]any{
+			"message_id": messageID,
+			"date":       time.Now().Unix(),
+			"chat":       map[string]any{"id": chatID, "type": chatType(chatID)},
+			"text":       params["text"],
+		}
+	case "copyMessage":
+		return map[string]any{"message_id": h.nextMessageID()}
+	case "getChatMember":
+		userID, _ := strconv.ParseInt(params["user_id"], 10, 64)
+		h.mu.Lock()
+		admin := h.admins[[2]int64{chatID, userID}]
+		h.mu.Unlock()
+		if admin {
+			return map[string]any{"status": "administrator", "can_invite_users": true, "user": map[string]any{"id": userID, "first_name": fmt.Sprint(userID)}}
+		}
+		return map[string]any{"status": "member", "user": map[string]any{"id": userID, "first_name": fmt.Sprint(userID)}}
+	case "getChatAdministrators":
+		h.mu.Lock()
+		var admins []any
+		for key := range h.admins {
+			if key[0] == chatID {
+				admins = append(admins, map[string]any{"status": "administrator", "user": map[string]any{"id": key[1], "first_name": fmt.Sprint(key[1])}})
+			}
+		}
+		h.mu.Unlock()
+		return admins
+	case "createChatInviteLink":
+		return map[string]any{"invite_link": fmt.Sprintf("https://t.me/+invite%d", -chatID), "name": params["name"]}
+	case "getMe":
+		return map[string]any{"id": 1, "is_bot": true, "first_name": "Wanon", "username": "wanon_bot"}
+	}
+	return true
+}
+
+// chatType guesses the type of a chat from its ID
+func chatType(chatID int64) string {
+	if chatID > 0 {
+		return "private"
+	}
+	return "supergroup"
+}
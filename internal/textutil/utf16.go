@@ -0,0 +1,84 @@
+// Package textutil converts between the byte offsets Go strings use and the
+// UTF-16 code units Telegram counts entity offsets and message lengths in.
+// Characters outside the Basic Multilingual Plane, such as most emoji, take
+// two code units but four bytes, so the two drift apart in emoji-heavy text.
+package textutil
+
+import (
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// UTF16Len returns the length of s in UTF-16 code units
+func UTF16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// ByteOffset converts an offset in UTF-16 code units to a byte offset in s.
+// Offsets inside a surrogate pair round down to the start of its
+// character, and offsets past the end give len(s).
+func ByteOffset(s string, units int) int {
+	if units <= 0 {
+		return 0
+	}
+	n := 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		n += utf16.RuneLen(r)
+		if n > units {
+			return i
+		}
+		i += size
+		if n == units {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// UTF16Offset converts a byte offset in s to UTF-16 code units. Offsets
+// inside a character count up to its start.
+func UTF16Offset(s string, bytes int) int {
+	n := 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if i+size > bytes {
+			break
+		}
+		n += utf16.RuneLen(r)
+		i += size
+	}
+	return n
+}
+
+// Slice returns the part of s an entity covers, given its offset and length
+// in UTF-16 code units. Ranges are clamped to s and never split a character.
+func Slice(s string, offset, length int) string {
+	start := ByteOffset(s, offset)
+	end := ByteOffset(s, offset+max(length, 0))
+	return s[start:end]
+}
+
+// Truncate returns the longest prefix of s at most units UTF-16 code units
+// long
+func Truncate(s string, units int) string {
+	return s[:ByteOffset(s, units)]
+}
+
+// Back returns the byte offset up to units UTF-16 code units before pos
+// in s, without splitting a character
+func Back(s string, pos, units int) int {
+	for pos > 0 {
+		r, size := utf8.DecodeLastRuneInString(s[:pos])
+		if units < utf16.RuneLen(r) {
+			break
+		}
+		units -= utf16.RuneLen(r)
+		pos -= size
+	}
+	return pos
+}
@@ -0,0 +1,82 @@
+package textutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUTF16Len(t *testing.T) {
+	assert.Equal(t, 0, UTF16Len(""))
+	assert.Equal(t, 5, UTF16Len("hello"))
+	assert.Equal(t, 4, UTF16Len("café"))
+	assert.Equal(t, 2, UTF16Len("👍"))
+	// Flags are two regional indicators, families are joined emoji
+	assert.Equal(t, 4, UTF16Len("🇪🇸"))
+	assert.Equal(t, 5, UTF16Len("👩‍👧"))
+	assert.Equal(t, 1, UTF16Len("\xff"))
+}
+
+func TestByteOffset(t *testing.T) {
+	text := "a👍b🔥"
+	tests := []struct {
+		units int
+		want  int
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, 1},  // after a
+		{2, 1},  // inside 👍, rounds down
+		{3, 5},  // after 👍
+		{4, 6},  // after b
+		{6, 10}, // end
+		{9, 10}, // past the end
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ByteOffset(text, tt.units), "units %d", tt.units)
+	}
+	assert.Equal(t, 2, ByteOffset("\xffx", 2))
+}
+
+func TestUTF16Offset(t *testing.T) {
+	text := "a👍b🔥"
+	assert.Equal(t, 0, UTF16Offset(text, 0))
+	assert.Equal(t, 1, UTF16Offset(text, 1))
+	assert.Equal(t, 1, UTF16Offset(text, 3)) // inside 👍
+	assert.Equal(t, 3, UTF16Offset(text, 5))
+	assert.Equal(t, 6, UTF16Offset(text, len(text)))
+	assert.Equal(t, 6, UTF16Offset(text, 100))
+
+	for units := 0; units <= UTF16Len(text); units++ {
+		if offset := ByteOffset(text, units); UTF16Offset(text, offset) != units {
+			assert.Contains(t, []int{2, 5}, units, "only the middle of an emoji does not round trip")
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	// Entities as Telegram sends them for "¡Hola 👋🏽, María! 🎉"
+	text := "¡Hola 👋🏽, María! 🎉"
+	assert.Equal(t, "👋🏽", Slice(text, 6, 4))
+	assert.Equal(t, "María", Slice(text, 12, 5))
+	assert.Equal(t, "🎉", Slice(text, 19, 2))
+	assert.Equal(t, "🎉", Slice(text, 19, 10))
+	assert.Equal(t, "", Slice(text, 30, 2))
+	assert.Equal(t, "", Slice(text, 3, -1))
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "😀😀", Truncate("😀😀😀", 4))
+	assert.Equal(t, "😀", Truncate("😀😀😀", 3))
+	assert.Equal(t, "ab", Truncate("ab", 10))
+	assert.Equal(t, "", Truncate("😀", 1))
+}
+
+func TestBack(t *testing.T) {
+	text := "ab😀😀c"
+	assert.Equal(t, 6, Back(text, 10, 2))
+	assert.Equal(t, 10, Back(text, 10, 1)) // 😀 does not fit
+	assert.Equal(t, 1, Back(text, 10, 5))
+	assert.Equal(t, 0, Back(text, 10, 100))
+	assert.Equal(t, 0, Back(text, 0, 3))
+}
@@ -0,0 +1,59 @@
+package usage
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"gorm.io/gorm"
+)
+
+// API serves usage reports as JSON: GET /stats?month=YYYY-MM, the current
+// month when no month is given
+type API struct {
+	db    *gorm.DB
+	clock clock.Clock
+}
+
+// NewAPI creates the stats API
+func NewAPI(db *gorm.DB) *API {
+	return &API{db: db, clock: clock.System{}}
+}
+
+// WithClock replaces the clock deciding the current month
+func (a *API) WithClock(clk clock.Clock) *API {
+	a.clock = clk
+	return a
+}
+
+// ServeHTTP writes the report of the requested month
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	month := MonthOf(a.clock.Now())
+	if param := r.URL.Query().Get("month"); param != "" {
+		parsed, err := time.Parse("2006-01", param)
+		if err != nil {
+			http.Error(w, "month must be YYYY-MM", http.StatusBadRequest)
+			return
+		}
+		month = parsed
+	}
+
+	report, err := Build(r.Context(), a.db, month)
+	if err != nil {
+		slog.Error("failed to build usage report", "month", month.Format("2006-01"), "error", err)
+		http.Error(w, "failed to build report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		slog.Error("failed to write usage report", "error", err)
+	}
+}
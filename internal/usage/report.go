@@ -0,0 +1,207 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TopUsers is how many users each chat lists in a report
+const TopUsers = 3
+
+// Report is the usage of every chat over a month
+type Report struct {
+	Month time.Time    `json:"month"` // First instant of the month, in UTC
+	Chats []*ChatUsage `json:"chats"` // Busiest first
+}
+
+// ChatUsage is the usage of a chat
+type ChatUsage struct {
+	ChatID      int64            `json:"chat_id"`
+	Title       string           `json:"title,omitempty"`
+	CommandsRun int64            `json:"commands_run"`
+	Commands    map[string]int64 `json:"commands"`
+	QuotesAdded int64            `json:"quotes_added"`
+	TopUsers    []UserUsage      `json:"top_users"`
+}
+
+// UserUsage is the number of commands a user ran in a chat
+type UserUsage struct {
+	UserID   int64  `json:"user_id"`
+	Name     string `json:"name"`
+	Commands int64  `json:"commands"`
+}
+
+// MonthOf returns the first instant, in UTC, of the month of t
+func MonthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Build compiles the usage report of the month starting at month
+func Build(ctx context.Context, db *gorm.DB, month time.Time) (*Report, error) {
+	from, to := month, month.AddDate(0, 1, 0)
+	chats := map[int64]*ChatUsage{}
+	chat := func(chatID int64) *ChatUsage {
+		if chats[chatID] == nil {
+			chats[chatID] = &ChatUsage{ChatID: chatID, Commands: map[string]int64{}, TopUsers: []UserUsage{}}
+		}
+		return chats[chatID]
+	}
+
+	var commands []struct {
+		ChatID  int64
+		Command string
+		Runs    int64
+	}
+	if err := db.WithContext(ctx).Model(&Entry{}).
+		Select("chat_id, command, count(*) AS runs").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("chat_id, command").
+		Scan(&commands).Error; err != nil {
+		return nil, fmt.Errorf("failed to count commands: %w", err)
+	}
+	for _, row := range commands {
+		usage := chat(row.ChatID)
+		usage.Commands[row.Command] = row.Runs
+		usage.CommandsRun += row.Runs
+	}
+
+	var titles []struct {
+		ChatID    int64
+		ChatTitle string
+	}
+	if err := db.WithContext(ctx).Raw(`
+		SELECT DISTINCT ON (chat_id) chat_id, chat_title
+		FROM command_usage
+		WHERE created_at >= ? AND created_at < ?
+		ORDER BY chat_id, created_at DESC`, from, to).
+		Scan(&titles).Error; err != nil {
+		return nil, fmt.Errorf("failed to get chat titles: %w", err)
+	}
+	for _, row := range titles {
+		chat(row.ChatID).Title = row.ChatTitle
+	}
+
+	var users []struct {
+		ChatID   int64
+		UserID   int64
+		UserName string
+		Runs     int64
+	}
+	if err := db.WithContext(ctx).Raw(`
+		SELECT chat_id, user_id, (array_agg(user_name ORDER BY created_at DESC))[1] AS user_name, count(*) AS runs
+		FROM command_usage
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY chat_id, user_id
+		ORDER BY chat_id, runs DESC, user_id`, from, to).
+		Scan(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to count commands by user: %w", err)
+	}
+	for _, row := range users {
+		usage := chat(row.ChatID)
+		if len(usage.TopUsers) < TopUsers {
+			usage.TopUsers = append(usage.TopUsers, UserUsage{UserID: row.UserID, Name: row.UserName, Commands: row.Runs})
+		}
+	}
+
+	var quotes []struct {
+		ChatID int64
+		Quotes int64
+	}
+	if err := db.WithContext(ctx).Raw(`
+		SELECT chat_id, count(*) AS quotes
+		FROM quote
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY chat_id`, from, to).
+		Scan(&quotes).Error; err != nil {
+		return nil, fmt.Errorf("failed to count added quotes: %w", err)
+	}
+	for _, row := range quotes {
+		chat(row.ChatID).QuotesAdded = row.Quotes
+	}
+
+	report := &Report{Month: month, Chats: make([]*ChatUsage, 0, len(chats))}
+	for _, usage := range chats {
+		report.Chats = append(report.Chats, usage)
+	}
+	report.sort()
+	return report, nil
+}
+
+// sort puts the busiest chats first
+func (r *Report) sort() {
+	sort.Slice(r.Chats, func(i, j int) bool {
+		a, b := r.Chats[i], r.Chats[j]
+		if a.CommandsRun+a.QuotesAdded != b.CommandsRun+b.QuotesAdded {
+			return a.CommandsRun+a.QuotesAdded > b.CommandsRun+b.QuotesAdded
+		}
+		return a.ChatID < b.ChatID
+	})
+}
+
+// Text formats the report as a message for the owners
+func (r *Report) Text() string {
+	month := r.Month.Format("January 2006")
+	if len(r.Chats) == 0 {
+		return fmt.Sprintf("📊 No usage in %s.", month)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📊 Usage in %s", month)
+	for _, chat := range r.Chats {
+		sb.WriteString("\n\n")
+		if chat.Title != "" {
+			fmt.Fprintf(&sb, "%s (%d)", chat.Title, chat.ChatID)
+		} else {
+			fmt.Fprintf(&sb, "Chat %d", chat.ChatID)
+		}
+		fmt.Fprintf(&sb, "\n• %s", plural(chat.CommandsRun, "command"))
+		if commands := chat.commandList(); commands != "" {
+			sb.WriteString(": " + commands)
+		}
+		fmt.Fprintf(&sb, "\n• %s added", plural(chat.QuotesAdded, "quote"))
+		if len(chat.TopUsers) > 0 {
+			names := make([]string, 0, len(chat.TopUsers))
+			for _, user := range chat.TopUsers {
+				name := user.Name
+				if name == "" {
+					name = fmt.Sprintf("user %d", user.UserID)
+				}
+				names = append(names, fmt.Sprintf("%s %d", name, user.Commands))
+			}
+			sb.WriteString("\n• Top users: " + strings.Join(names, ", "))
+		}
+	}
+	return sb.String()
+}
+
+// commandList lists the commands of a chat, most run first
+func (c *ChatUsage) commandList() string {
+	names := make([]string, 0, len(c.Commands))
+	for name := range c.Commands {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if c.Commands[names[i]] != c.Commands[names[j]] {
+			return c.Commands[names[i]] > c.Commands[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s %d", name, c.Commands[name])
+	}
+	return strings.Join(names, ", ")
+}
+
+// plural formats a count of things
+func plural(n int64, thing string) string {
+	if n == 1 {
+		return "1 " + thing
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
@@ -0,0 +1,109 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"github.com/graffic/wanon-go/internal/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonthOf(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+
+	// Still April in UTC
+	assert.Equal(t, time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC), MonthOf(time.Date(2024, time.May, 1, 1, 0, 0, 0, madrid)))
+}
+
+func TestReport_Text(t *testing.T) {
+	report := &Report{
+		Month: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC),
+		Chats: []*ChatUsage{
+			{
+				ChatID:      -100123,
+				Title:       "Friends",
+				CommandsRun: 12,
+				Commands:    map[string]int64{"rquote": 8, "addquote": 3, "heatmap": 1},
+				QuotesAdded: 4,
+				TopUsers:    []UserUsage{{UserID: 1, Name: "@ana", Commands: 7}, {UserID: 2, Commands: 5}},
+			},
+			{ChatID: -100999, QuotesAdded: 1, Commands: map[string]int64{}},
+		},
+	}
+
+	expected := "📊 Usage in May 2024\n\n" +
+		"Friends (-100123)\n" +
+		"• 12 commands: rquote 8, addquote 3, heatmap 1\n" +
+		"• 4 quotes added\n" +
+		"• Top users: @ana 7, user 2 5\n\n" +
+		"Chat -100999\n" +
+		"• 0 commands\n" +
+		"• 1 quote added"
+	assert.Equal(t, expected, report.Text())
+
+	assert.Equal(t, "📊 No usage in May 2024.", (&Report{Month: report.Month}).Text())
+}
+
+func TestBuild(t *testing.T) {
+	db := testutils.NewTestDB(t)
+	ctx := context.Background()
+	may := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	record := func(chatID, userID int64, name, command string, at time.Time) {
+		require.NoError(t, db.DB.Create(&Entry{
+			ChatID: chatID, ChatTitle: "Friends", UserID: userID, UserName: name, Command: command, CreatedAt: at,
+		}).Error)
+	}
+	record(-100123, 1, "@ana", "rquote", may.Add(time.Hour))
+	record(-100123, 1, "@ana_new", "rquote", may.Add(2*time.Hour))
+	record(-100123, 2, "Bob", "addquote", may.Add(3*time.Hour))
+	record(-100123, 2, "Bob", "rquote", may.AddDate(0, 1, 0)) // June
+
+	report, err := Build(ctx, db.DB, may)
+	require.NoError(t, err)
+	require.Len(t, report.Chats, 1)
+	chat := report.Chats[0]
+	assert.Equal(t, "Friends", chat.Title)
+	assert.Equal(t, int64(3), chat.CommandsRun)
+	assert.Equal(t, map[string]int64{"rquote": 2, "addquote": 1}, chat.Commands)
+	assert.Equal(t, []UserUsage{{UserID: 1, Name: "@ana_new", Commands: 2}, {UserID: 2, Name: "Bob", Commands: 1}}, chat.TopUsers)
+
+	// The stats API serves the same report
+	api := NewAPI(db.DB)
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats?month=2024-05", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var served Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	require.Len(t, served.Chats, 1)
+	assert.Equal(t, int64(3), served.Chats[0].CommandsRun)
+
+	// Reports go out once, after the month is over
+	var sent []string
+	reporter := NewReporter(db.DB, func(ctx context.Context, text string) { sent = append(sent, text) },
+		slog.New(slog.NewTextHandler(io.Discard, nil))).
+		WithClock(clock.NewMock(time.Date(2024, time.June, 1, 9, 0, 0, 0, time.UTC)))
+	ok, err := reporter.Check(ctx)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = reporter.Check(ctx)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.Len(t, sent, 1)
+	assert.Contains(t, sent[0], "📊 Usage in May 2024")
+}
+
+func TestAPI_BadMonth(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewAPI(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats?month=May", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
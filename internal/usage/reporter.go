@@ -0,0 +1,115 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/graffic/wanon-go/internal/clock"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// KeepMonths is how many months of command usage are kept for the stats API
+const KeepMonths = 12
+
+// Notifier delivers a report, for example to the bot owners
+type Notifier func(ctx context.Context, text string)
+
+// sentReport records that the report of a month was sent
+type sentReport struct {
+	Month  time.Time `gorm:"primaryKey;type:date"`
+	SentAt time.Time
+}
+
+// TableName specifies the table name for sentReport
+func (sentReport) TableName() string {
+	return "usage_report"
+}
+
+// Reporter sends the usage report of the last month once it is over
+type Reporter struct {
+	db     *gorm.DB
+	log    *Log
+	notify Notifier
+	clock  clock.Clock
+	logger *slog.Logger
+}
+
+// NewReporter creates a monthly reporter
+func NewReporter(db *gorm.DB, notify Notifier, logger *slog.Logger) *Reporter {
+	return &Reporter{
+		db:     db,
+		log:    NewLog(db),
+		notify: notify,
+		clock:  clock.System{},
+		logger: logger,
+	}
+}
+
+// WithClock replaces the clock deciding which month is over
+func (r *Reporter) WithClock(clk clock.Clock) *Reporter {
+	r.clock = clk
+	return r
+}
+
+// Check sends the report of the previous month unless it was already sent,
+// then forgets usage older than KeepMonths. Months without usage are not
+// reported. It returns whether a report was sent.
+func (r *Reporter) Check(ctx context.Context) (bool, error) {
+	current := MonthOf(r.clock.Now())
+	month := current.AddDate(0, -1, 0)
+
+	var sent int64
+	if err := r.db.WithContext(ctx).Model(&sentReport{}).Where("month = ?", month).Count(&sent).Error; err != nil {
+		return false, fmt.Errorf("failed to check sent reports: %w", err)
+	}
+	if sent > 0 {
+		return false, nil
+	}
+
+	report, err := Build(ctx, r.db, month)
+	if err != nil {
+		return false, err
+	}
+
+	// Record the report first: a crash after this skips a report rather
+	// than sending it twice
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&sentReport{Month: month, SentAt: r.clock.Now()})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record sent report: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	if len(report.Chats) > 0 {
+		r.notify(ctx, report.Text())
+	}
+
+	pruned, err := r.log.Prune(ctx, current.AddDate(0, -KeepMonths, 0))
+	if err != nil {
+		return true, err
+	}
+	r.logger.Info("usage report sent", "month", month.Format("2006-01"), "chats", len(report.Chats), "pruned", pruned)
+	return len(report.Chats) > 0, nil
+}
+
+// Start checks for a report to send every interval until ctx is done
+func (r *Reporter) Start(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Check(ctx); err != nil {
+			r.logger.Error("failed to send usage report", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Package usage records the commands run in each chat and reports on them:
+// a monthly report sent to the bot owners and the same data as JSON on the
+// stats API.
+package usage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	botcmd "github.com/graffic/wanon-go/internal/bot"
+	"gorm.io/gorm"
+)
+
+// Entry is a command run in a chat
+type Entry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ChatID    int64     `gorm:"not null" json:"chat_id"`
+	ChatTitle string    `gorm:"not null;default:''" json:"chat_title"`
+	UserID    int64     `gorm:"not null" json:"user_id"`
+	UserName  string    `gorm:"not null;default:''" json:"user_name"`
+	Command   string    `gorm:"not null" json:"command"` // Without the leading slash
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for Entry
+func (Entry) TableName() string {
+	return "command_usage"
+}
+
+// Recorder stores command runs; *Log implements it
+type Recorder interface {
+	Record(ctx context.Context, entry *Entry) error
+}
+
+// Log stores command runs in the database
+type Log struct {
+	db *gorm.DB
+}
+
+// NewLog creates a command usage log
+func NewLog(db *gorm.DB) *Log {
+	return &Log{db: db}
+}
+
+// Record stores a command run
+func (l *Log) Record(ctx context.Context, entry *Entry) error {
+	if err := l.db.WithContext(ctx).Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to record command usage: %w", err)
+	}
+	return nil
+}
+
+// Prune deletes the command runs older than before and returns how many
+// were deleted
+func (l *Log) Prune(ctx context.Context, before time.Time) (int64, error) {
+	result := l.db.WithContext(ctx).Where("created_at < ?", before).Delete(&Entry{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune command usage: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Middleware returns a bot middleware recording the given commands, named
+// without the leading slash. Other messages pass through unrecorded.
+func Middleware(recorder Recorder, commands []string, logger *slog.Logger) bot.Middleware {
+	known := make(map[string]bool, len(commands))
+	for _, command := range commands {
+		known[command] = true
+	}
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if entry := entryFor(update.Message, known); entry != nil {
+				if err := recorder.Record(ctx, entry); err != nil {
+					logger.Error("failed to record command usage", "chat_id", entry.ChatID, "command", entry.Command, "error", err)
+				}
+			}
+			next(ctx, b, update)
+		}
+	}
+}
+
+// entryFor returns the usage entry of a message running a known command
+func entryFor(msg *models.Message, known map[string]bool) *Entry {
+	if msg == nil || msg.From == nil {
+		return nil
+	}
+	args, ok := botcmd.ParseArgs(msg.Text)
+	if !ok || !known[args.Command] {
+		return nil
+	}
+	return &Entry{
+		ChatID:    msg.Chat.ID,
+		ChatTitle: msg.Chat.Title,
+		UserID:    msg.From.ID,
+		UserName:  userName(msg.From),
+		Command:   args.Command,
+	}
+}
+
+// userName names a user in reports
+func userName(user *models.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
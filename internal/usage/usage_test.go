@@ -0,0 +1,50 @@
+package usage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRecorder struct {
+	entries []*Entry
+}
+
+func (f *fakeRecorder) Record(ctx context.Context, entry *Entry) error {
+	f.entries = append(f.entries, entry)
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := &fakeRecorder{}
+	calls := 0
+	handler := Middleware(recorder, []string{"rquote", "addquote"}, slog.New(slog.NewTextHandler(io.Discard, nil)))(
+		func(ctx context.Context, b *bot.Bot, update *models.Update) { calls++ },
+	)
+
+	send := func(text string, from *models.User) {
+		handler(context.Background(), nil, &models.Update{Message: &models.Message{
+			Chat: models.Chat{ID: -100123, Title: "Friends"},
+			From: from,
+			Text: text,
+		}})
+	}
+	ana := &models.User{ID: 1, Username: "ana"}
+	send("/rquote@wanonbot", ana)
+	send("/addquote", &models.User{ID: 2, FirstName: "Bob", LastName: "Smith"})
+	send("/unknown", ana)
+	send("hello", ana)
+	send("/rquote", nil)
+
+	assert.Equal(t, 5, calls)
+	require.Len(t, recorder.entries, 2)
+	assert.Equal(t, Entry{ChatID: -100123, ChatTitle: "Friends", UserID: 1, UserName: "@ana", Command: "rquote"}, *recorder.entries[0])
+	assert.Equal(t, "Bob Smith", recorder.entries[1].UserName)
+	assert.Equal(t, "addquote", recorder.entries[1].Command)
+}
@@ -0,0 +1,14 @@
+-- Create chat_settings table
+CREATE TABLE IF NOT EXISTS chat_settings (
+    chat_id BIGINT PRIMARY KEY,
+    language TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT '',
+    date_format TEXT NOT NULL DEFAULT '',
+    relative_dates BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS chat_settings;
@@ -0,0 +1,6 @@
+-- Per-chat cache retention, in seconds. Zero uses the global keep duration.
+ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS cache_retention_seconds BIGINT NOT NULL DEFAULT 0;
+
+---- create above / drop below ----
+
+ALTER TABLE chat_settings DROP COLUMN IF EXISTS cache_retention_seconds;
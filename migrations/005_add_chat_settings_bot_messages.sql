@@ -0,0 +1,7 @@
+-- How quotes treat messages written by bots or sent via inline bots:
+-- '' keeps them as is, 'label' marks them, 'skip' leaves them out.
+ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS bot_messages TEXT NOT NULL DEFAULT '';
+
+---- create above / drop below ----
+
+ALTER TABLE chat_settings DROP COLUMN IF EXISTS bot_messages;
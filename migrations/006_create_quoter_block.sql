@@ -0,0 +1,16 @@
+-- Users who cannot add quotes in a chat. Users blocked by @username before
+-- their ID is known have user_id = 0.
+CREATE TABLE IF NOT EXISTS quoter_block (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL DEFAULT 0,
+    username TEXT NOT NULL DEFAULT '',
+    blocked_by BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_quoter_block_chat_id ON quoter_block(chat_id);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS quoter_block;
@@ -0,0 +1,14 @@
+-- Display names chats give to quote authors, applied when rendering
+CREATE TABLE IF NOT EXISTS author_nickname (
+    chat_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    nickname TEXT NOT NULL,
+    set_by BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chat_id, user_id)
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS author_nickname;
@@ -0,0 +1,16 @@
+-- Author identities merged into another one of the same chat. Canonical
+-- users are never aliases themselves.
+CREATE TABLE IF NOT EXISTS author_alias (
+    chat_id BIGINT NOT NULL,
+    alias_id BIGINT NOT NULL,
+    canonical_id BIGINT NOT NULL,
+    merged_by BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chat_id, alias_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_author_alias_canonical ON author_alias(chat_id, canonical_id);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS author_alias;
@@ -0,0 +1,7 @@
+-- Daily window, as "HH:MM-HH:MM" in the chat time zone, during which
+-- scheduled posts are held back. Empty means no quiet hours.
+ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS quiet_hours TEXT NOT NULL DEFAULT '';
+
+---- create above / drop below ----
+
+ALTER TABLE chat_settings DROP COLUMN IF EXISTS quiet_hours;
@@ -0,0 +1,23 @@
+-- Messages the bot is about to send, recorded first so that a crash between
+-- recording and sending can be recovered on startup. message_id is the
+-- Telegram message ID once sent.
+CREATE TABLE IF NOT EXISTS outbox_message (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    text TEXT NOT NULL,
+    reply_to_message_id BIGINT NOT NULL DEFAULT 0,
+    reply_markup JSONB,
+    quote_id BIGINT REFERENCES quote(id) ON DELETE SET NULL,
+    message_id BIGINT NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_message_pending ON outbox_message(id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_message_sent ON outbox_message(chat_id, message_id) WHERE sent_at IS NOT NULL;
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS outbox_message;
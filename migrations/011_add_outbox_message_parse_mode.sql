@@ -0,0 +1,6 @@
+-- Telegram formatting of outgoing messages, e.g. 'HTML'. Empty is plain text.
+ALTER TABLE outbox_message ADD COLUMN IF NOT EXISTS parse_mode TEXT NOT NULL DEFAULT '';
+
+---- create above / drop below ----
+
+ALTER TABLE outbox_message DROP COLUMN IF EXISTS parse_mode;
@@ -0,0 +1,17 @@
+-- When the quoted conversation happened: the date of the first entry, kept
+-- on the quote so quotes can be searched by period. Quotes whose first
+-- entry has no date use the time they were added.
+ALTER TABLE quote ADD COLUMN IF NOT EXISTS quoted_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE quote q SET quoted_at = to_timestamp((e.message->>'date')::bigint)
+FROM quote_entry e
+WHERE e.quote_id = q.id AND e."order" = 0 AND (e.message->>'date')::bigint > 0;
+
+UPDATE quote SET quoted_at = created_at WHERE quoted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_quote_chat_quoted_at ON quote(chat_id, quoted_at);
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_quote_chat_quoted_at;
+ALTER TABLE quote DROP COLUMN IF EXISTS quoted_at;
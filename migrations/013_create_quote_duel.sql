@@ -0,0 +1,30 @@
+-- Votes between two random quotes of a chat. The winner is settled when the
+-- voting window ends; ties have no winner.
+CREATE TABLE IF NOT EXISTS quote_duel (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    first_quote_id BIGINT NOT NULL REFERENCES quote(id) ON DELETE CASCADE,
+    second_quote_id BIGINT NOT NULL REFERENCES quote(id) ON DELETE CASCADE,
+    message_id BIGINT NOT NULL DEFAULT 0,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    winner_quote_id BIGINT REFERENCES quote(id) ON DELETE SET NULL,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_quote_duel_running ON quote_duel(ends_at) WHERE finished_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_quote_duel_winner ON quote_duel(chat_id, winner_quote_id);
+
+-- One vote per user and duel; voting again changes it
+CREATE TABLE IF NOT EXISTS quote_duel_vote (
+    duel_id BIGINT NOT NULL REFERENCES quote_duel(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL,
+    quote_id BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (duel_id, user_id)
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS quote_duel_vote;
+DROP TABLE IF EXISTS quote_duel;
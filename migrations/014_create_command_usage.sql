@@ -0,0 +1,23 @@
+-- Commands run in each chat, for the monthly usage report and the stats API
+CREATE TABLE IF NOT EXISTS command_usage (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    chat_title TEXT NOT NULL DEFAULT '',
+    user_id BIGINT NOT NULL,
+    user_name TEXT NOT NULL DEFAULT '',
+    command TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_command_usage_created_at ON command_usage(created_at);
+
+-- Months whose usage report was sent to the owners
+CREATE TABLE IF NOT EXISTS usage_report (
+    month DATE PRIMARY KEY,
+    sent_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS usage_report;
+DROP TABLE IF EXISTS command_usage;
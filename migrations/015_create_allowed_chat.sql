@@ -0,0 +1,11 @@
+-- Chats allowed at runtime by the owners with /allowchat, on top of
+-- allowed_chat_ids in the config
+CREATE TABLE IF NOT EXISTS allowed_chat (
+    chat_id BIGINT PRIMARY KEY,
+    added_by BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS allowed_chat;
@@ -0,0 +1,18 @@
+-- Seconds after which transient bot replies (usage errors, notices and
+-- confirmations) are deleted from the chat. 0 keeps them.
+ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS reply_delete_seconds INTEGER NOT NULL DEFAULT 0;
+
+-- Transient messages can be deleted once the chat's delay passes;
+-- removed_at records when they were.
+ALTER TABLE outbox_message ADD COLUMN IF NOT EXISTS transient BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE outbox_message ADD COLUMN IF NOT EXISTS removed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_message_transient ON outbox_message(sent_at)
+    WHERE transient AND removed_at IS NULL AND sent_at IS NOT NULL;
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_outbox_message_transient;
+ALTER TABLE outbox_message DROP COLUMN IF EXISTS removed_at;
+ALTER TABLE outbox_message DROP COLUMN IF EXISTS transient;
+ALTER TABLE chat_settings DROP COLUMN IF EXISTS reply_delete_seconds;
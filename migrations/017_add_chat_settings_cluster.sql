@@ -0,0 +1,10 @@
+-- Chats of the same cluster follow forwarded threads into each other's cache.
+-- Empty means the chat is in no cluster.
+ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS cluster TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_chat_settings_cluster ON chat_settings(cluster) WHERE cluster <> '';
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_chat_settings_cluster;
+ALTER TABLE chat_settings DROP COLUMN IF EXISTS cluster;
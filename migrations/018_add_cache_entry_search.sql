@@ -0,0 +1,12 @@
+-- Chats opt in to /history, the search of their cached messages.
+ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS history BOOLEAN NOT NULL DEFAULT false;
+
+-- Full-text index of the cached messages. The expression must match the one
+-- internal/history searches with.
+CREATE INDEX IF NOT EXISTS idx_cache_entry_search ON cache_entry
+    USING GIN (to_tsvector('simple', COALESCE(message->>'text', message->>'caption', '')));
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_cache_entry_search;
+ALTER TABLE chat_settings DROP COLUMN IF EXISTS history;
@@ -0,0 +1,7 @@
+-- Commands admins turned off in the chat with /disable, separated by spaces.
+-- Empty means every command is on.
+ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS disabled_commands TEXT NOT NULL DEFAULT '';
+
+---- create above / drop below ----
+
+ALTER TABLE chat_settings DROP COLUMN IF EXISTS disabled_commands;
@@ -0,0 +1,14 @@
+-- Quotes users saved for themselves with a ⭐ reaction or the Save button.
+-- Bookmarks are private: only /saved, in a private chat, lists them.
+CREATE TABLE IF NOT EXISTS user_bookmarks (
+    user_id BIGINT NOT NULL,
+    quote_id BIGINT NOT NULL REFERENCES quote(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, quote_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_bookmarks_quote ON user_bookmarks(quote_id);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS user_bookmarks;
@@ -0,0 +1,20 @@
+-- Random quotes can leave out tags and authors, e.g. /rquote -#nsfw -@bob.
+-- A quote's tags are the hashtags in the text or caption of its entries,
+-- lower case and without the #. The expressions must match the ones
+-- internal/quotes filters with.
+CREATE OR REPLACE FUNCTION quote_entry_tags(message JSONB) RETURNS TEXT[]
+    LANGUAGE SQL IMMUTABLE PARALLEL SAFE AS $$
+    SELECT COALESCE(array_agg(DISTINCT lower(m[1])), '{}')
+    FROM regexp_matches(COALESCE(message->>'text', message->>'caption', ''), '#(\w+)', 'g') AS m
+$$;
+
+CREATE INDEX IF NOT EXISTS idx_quote_entry_tags ON quote_entry
+    USING GIN (quote_entry_tags(message));
+CREATE INDEX IF NOT EXISTS idx_quote_entry_author_username ON quote_entry
+    (lower(message->'from'->>'username'));
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_quote_entry_author_username;
+DROP INDEX IF EXISTS idx_quote_entry_tags;
+DROP FUNCTION IF EXISTS quote_entry_tags(JSONB);
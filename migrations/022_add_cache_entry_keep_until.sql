@@ -0,0 +1,7 @@
+-- Messages kept with /keep are spared by the cache cleaner until this Unix
+-- time, so users can quote them later. NULL follows the chat's retention.
+ALTER TABLE cache_entry ADD COLUMN IF NOT EXISTS keep_until BIGINT;
+
+---- create above / drop below ----
+
+ALTER TABLE cache_entry DROP COLUMN IF EXISTS keep_until;
@@ -0,0 +1,39 @@
+-- Time-boxed quote contests: quotes added while one runs are entered, users
+-- vote for the entries they like and the most voted win when it ends.
+CREATE TABLE IF NOT EXISTS quote_contest (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    started_by BIGINT NOT NULL,
+    message_id BIGINT NOT NULL DEFAULT 0,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Chats run one contest at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quote_contest_running_chat ON quote_contest(chat_id) WHERE finished_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_quote_contest_running ON quote_contest(ends_at) WHERE finished_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS quote_contest_entry (
+    contest_id BIGINT NOT NULL REFERENCES quote_contest(id) ON DELETE CASCADE,
+    quote_id BIGINT NOT NULL REFERENCES quote(id) ON DELETE CASCADE,
+    submitted_by BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (contest_id, quote_id)
+);
+
+-- One vote per user and entry; users vote for as many entries as they like
+CREATE TABLE IF NOT EXISTS quote_contest_vote (
+    contest_id BIGINT NOT NULL,
+    quote_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (contest_id, quote_id, user_id),
+    FOREIGN KEY (contest_id, quote_id) REFERENCES quote_contest_entry(contest_id, quote_id) ON DELETE CASCADE
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS quote_contest_vote;
+DROP TABLE IF EXISTS quote_contest_entry;
+DROP TABLE IF EXISTS quote_contest;
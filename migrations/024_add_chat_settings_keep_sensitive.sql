@@ -0,0 +1,6 @@
+-- Chats opt out of the redaction of sensitive data before caching.
+ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS keep_sensitive BOOLEAN NOT NULL DEFAULT false;
+
+---- create above / drop below ----
+
+ALTER TABLE chat_settings DROP COLUMN IF EXISTS keep_sensitive;
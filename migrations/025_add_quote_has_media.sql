@@ -0,0 +1,18 @@
+-- /rquote media draws among the quotes with a photo, video or other file.
+-- Entries stored before their media was kept are known by their caption,
+-- which only media have.
+ALTER TABLE quote ADD COLUMN IF NOT EXISTS has_media BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE quote SET has_media = true
+WHERE EXISTS (
+    SELECT 1 FROM quote_entry e
+    WHERE e.quote_id = quote.id AND e.deleted_at IS NULL
+    AND (e.message ? 'media' OR COALESCE(e.message->>'caption', '') <> '')
+);
+
+CREATE INDEX IF NOT EXISTS idx_quote_media ON quote (chat_id) WHERE has_media;
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_quote_media;
+ALTER TABLE quote DROP COLUMN IF EXISTS has_media;
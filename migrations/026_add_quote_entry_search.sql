@@ -0,0 +1,8 @@
+-- /fquote finds quotes by the words of their messages. The expression must
+-- match the one internal/quotes searches with.
+CREATE INDEX IF NOT EXISTS idx_quote_entry_search ON quote_entry
+    USING GIN (to_tsvector('simple', COALESCE(message->>'text', message->>'caption', '')));
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_quote_entry_search;
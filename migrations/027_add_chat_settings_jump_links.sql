@@ -0,0 +1,6 @@
+-- Chats opt in to a button on posted quotes linking to the original message.
+ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS jump_links BOOLEAN NOT NULL DEFAULT false;
+
+---- create above / drop below ----
+
+ALTER TABLE chat_settings DROP COLUMN IF EXISTS jump_links;
@@ -0,0 +1,27 @@
+-- Previous versions of quotes, saved before their entries change so admins
+-- can inspect and restore them with /quotehistory. Versions are never
+-- updated; they go away with their quote.
+CREATE TABLE IF NOT EXISTS quote_version (
+    id BIGSERIAL PRIMARY KEY,
+    quote_id BIGINT NOT NULL REFERENCES quote(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    reason TEXT NOT NULL,
+    actor_id BIGINT NOT NULL DEFAULT 0,
+    entries JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (quote_id, version)
+);
+
+CREATE OR REPLACE FUNCTION quote_version_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'quote versions cannot be changed';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER quote_version_immutable BEFORE UPDATE ON quote_version
+    FOR EACH ROW EXECUTE FUNCTION quote_version_immutable();
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS quote_version;
+DROP FUNCTION IF EXISTS quote_version_immutable();
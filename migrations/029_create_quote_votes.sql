@@ -0,0 +1,14 @@
+-- Ratings of posted quotes: each user gives a quote a thumbs up (1) or down
+-- (-1), changing or taking it back with the buttons under the quote.
+CREATE TABLE IF NOT EXISTS quote_votes (
+    quote_id BIGINT NOT NULL REFERENCES quote(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL,
+    value SMALLINT NOT NULL CHECK (value IN (-1, 1)),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (quote_id, user_id)
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS quote_votes;
@@ -0,0 +1,11 @@
+-- The last release whose changelog was announced, a single row so replicas
+-- starting together announce an upgrade once.
+CREATE TABLE IF NOT EXISTS release_announcement (
+    id SMALLINT PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    version TEXT NOT NULL,
+    announced_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS release_announcement;
@@ -0,0 +1,6 @@
+-- Chats opt in to what's new in the bot after it is upgraded.
+ALTER TABLE chat_settings ADD COLUMN IF NOT EXISTS news BOOLEAN NOT NULL DEFAULT false;
+
+---- create above / drop below ----
+
+ALTER TABLE chat_settings DROP COLUMN IF EXISTS news;
@@ -0,0 +1,48 @@
+-- Guess the author games: a quote of a chat posted without its author and
+-- a poll of candidate authors. The answer is revealed when the poll closes.
+CREATE TABLE IF NOT EXISTS quote_game (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    quote_id BIGINT NOT NULL REFERENCES quote(id) ON DELETE CASCADE,
+    author_name TEXT NOT NULL,
+    correct_option SMALLINT NOT NULL,
+    message_id BIGINT NOT NULL DEFAULT 0,
+    poll_message_id BIGINT NOT NULL DEFAULT 0,
+    poll_id TEXT,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Chats run one game at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quote_game_running_chat ON quote_game(chat_id) WHERE finished_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_quote_game_running ON quote_game(ends_at) WHERE finished_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quote_game_poll ON quote_game(poll_id);
+
+-- The latest option each user picked in a game; retracting a vote drops it
+CREATE TABLE IF NOT EXISTS quote_game_answer (
+    game_id BIGINT NOT NULL REFERENCES quote_game(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    option_id SMALLINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (game_id, user_id)
+);
+
+-- Leaderboard of each chat: games answered and guessed right by each user
+CREATE TABLE IF NOT EXISTS quote_game_score (
+    chat_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    correct INTEGER NOT NULL DEFAULT 0,
+    played INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chat_id, user_id)
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS quote_game_score;
+DROP TABLE IF EXISTS quote_game_answer;
+DROP TABLE IF EXISTS quote_game;
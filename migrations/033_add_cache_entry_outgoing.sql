@@ -0,0 +1,7 @@
+-- Messages the bot sent itself, cached from the replies to them so reply
+-- chains go on through them.
+ALTER TABLE cache_entry ADD COLUMN IF NOT EXISTS outgoing BOOLEAN NOT NULL DEFAULT false;
+
+---- create above / drop below ----
+
+ALTER TABLE cache_entry DROP COLUMN IF EXISTS outgoing;
@@ -0,0 +1,12 @@
+-- Singular like every other table.
+ALTER TABLE quote_votes RENAME TO quote_vote;
+ALTER TABLE quote_vote RENAME CONSTRAINT quote_votes_pkey TO quote_vote_pkey;
+ALTER TABLE quote_vote RENAME CONSTRAINT quote_votes_quote_id_fkey TO quote_vote_quote_id_fkey;
+ALTER TABLE quote_vote RENAME CONSTRAINT quote_votes_value_check TO quote_vote_value_check;
+
+---- create above / drop below ----
+
+ALTER TABLE quote_vote RENAME CONSTRAINT quote_vote_value_check TO quote_votes_value_check;
+ALTER TABLE quote_vote RENAME CONSTRAINT quote_vote_quote_id_fkey TO quote_votes_quote_id_fkey;
+ALTER TABLE quote_vote RENAME CONSTRAINT quote_vote_pkey TO quote_votes_pkey;
+ALTER TABLE quote_vote RENAME TO quote_votes;